@@ -2,16 +2,29 @@ package v2
 
 import (
 	"errors"
+	"fmt"
+	"math/big"
 	"net"
 
 	"github.com/cybozu-go/netutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// Datapaths of AddressPool.
+const (
+	// DatapathRouted connects Pods with veth pairs and routes their packets on the node.
+	DatapathRouted = "routed"
+
+	// DatapathMACVLAN attaches Pods to the uplink interface of the node with
+	// macvlan interfaces in bridge mode.
+	DatapathMACVLAN = "macvlan"
+)
+
 // SubnetSet defines a IPv4-only or IPv6-only or IPv4/v6 dual stack subnet
 // A dual stack subnet must has the same size subnet of IPv4 and IPv6.
 type SubnetSet struct {
@@ -128,23 +141,68 @@ func (ss SubnetSet) GetBlock(n uint, sizeBits int) (ipv4 *net.IPNet, ipv6 *net.I
 		}
 	}
 	if ss.IPv6 != nil {
-		_, n, err := net.ParseCIDR(*ss.IPv6)
+		_, subnet, err := net.ParseCIDR(*ss.IPv6)
 		if err != nil {
 			panic(err)
 		}
 
+		// blocks of delegated prefixes are too large for int64 offsets
+		offset := new(big.Int).Lsh(new(big.Int).SetUint64(uint64(n)), uint(sizeBits))
+		ip := new(big.Int).Add(new(big.Int).SetBytes(subnet.IP.To16()), offset).Bytes()
+		if len(ip) > net.IPv6len {
+			panic("bug")
+		}
 		ipv6 = &net.IPNet{
-			IP:   netutil.IPAdd(n.IP, blockOffset),
+			IP:   make(net.IP, net.IPv6len),
 			Mask: net.CIDRMask(128-sizeBits, 128),
 		}
-		if ipv6.IP == nil {
-			panic("bug")
-		}
+		copy(ipv6.IP[net.IPv6len-len(ip):], ip)
 	}
 
 	return
 }
 
+// DNSConfig represents DNS settings for Pods returned in the CNI result.
+type DNSConfig struct {
+	// Nameservers is a list of IP addresses of DNS servers.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// Domain is the local domain name.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// Search is a list of search domains.
+	// +optional
+	Search []string `json:"search,omitempty"`
+
+	// Options is a list of resolver options.
+	// +optional
+	Options []string `json:"options,omitempty"`
+}
+
+// Scopes of BlockRouteConfig
+const (
+	RouteScopeGlobal = "global"
+	RouteScopeSite   = "site"
+)
+
+// BlockRouteConfig configures the routes to the address blocks of a pool
+// that coil-router programs on other nodes.
+type BlockRouteConfig struct {
+	// Scope is the scope of the routes.  The default is "global".
+	// +kubebuilder:validation:Enum=global;site
+	// +optional
+	Scope string `json:"scope,omitempty"`
+
+	// SourceInterface is the name of a network interface of the nodes.
+	// The first global address of the interface is set as the preferred
+	// source address, or "src" hint, of the routes of the same address family.
+	// Nodes missing the interface or its address program the routes without the hint.
+	// +optional
+	SourceInterface string `json:"sourceInterface,omitempty"`
+}
+
 // AddressPoolSpec defines the desired state of AddressPool
 type AddressPoolSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -165,6 +223,121 @@ type AddressPoolSpec struct {
 	// This field can be updated only by adding subnets to the list.
 	// +kubebuilder:validation:MinItems=1
 	Subnets []SubnetSet `json:"subnets"`
+
+	// MaxBlocksPerNode limits the number of address blocks a node can acquire
+	// from this pool, so that a node running many Pods cannot take most of a
+	// small pool.  Nodes already having as many blocks cannot allocate addresses
+	// once their blocks are full.  If omitted or 0, the number is not limited.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxBlocksPerNode int32 `json:"maxBlocksPerNode,omitempty"`
+
+	// ReservedBlocks is the number of free address blocks of this pool kept for
+	// system-critical Pods, whose priority is that of system-cluster-critical
+	// or system-node-critical PriorityClass.  When the pool has no more free
+	// blocks than this, blocks are given only to nodes allocating addresses for
+	// such Pods.  Addresses in the blocks already given to nodes are not reserved.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ReservedBlocks int32 `json:"reservedBlocks,omitempty"`
+
+	// ConflictDetection enables probing addresses with ARP or NDP before
+	// assigning them to Pods.  Addresses used by other hosts are not assigned.
+	// This works only for nodes where coild is run with `--uplink-interface`.
+	// +optional
+	ConflictDetection bool `json:"conflictDetection,omitempty"`
+
+	// Quarantine is a list of IP addresses that must not be assigned to Pods.
+	// Addresses found to be conflicting by conflict detection are added automatically.
+	// Remove addresses from this list to make them assignable again.
+	// +optional
+	Quarantine []string `json:"quarantine,omitempty"`
+
+	// NodeSelector limits the nodes that can acquire address blocks from this pool.
+	// If omitted, all nodes can acquire blocks.
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// AcceptRouterAdvertisements allows Pods to accept IPv6 router advertisements
+	// on their interfaces.  By default, Pods ignore router advertisements and do not
+	// configure addresses by SLAAC, so that they use only the addresses and routes
+	// configured by Coil.
+	// +optional
+	AcceptRouterAdvertisements bool `json:"acceptRouterAdvertisements,omitempty"`
+
+	// PrefixDelegation makes each address block of this IPv6-only pool an IPv6
+	// prefix delegated to a node, such as a /64 with BlockSizeBits of 64.
+	// Pods are assigned /128 addresses from the prefix of their node, accept
+	// router advertisements without SLAAC, and are routed to the prefix via the node.
+	// BlockSizeBits must be between 16 and 64, and Datapath must be "routed".
+	// Each subnet can have at most 2^24 blocks, such as a /40 with BlockSizeBits of 64.
+	// +optional
+	PrefixDelegation bool `json:"prefixDelegation,omitempty"`
+
+	// ProxyNeighbors makes nodes answer ARP and NDP requests for addresses of Pods
+	// using this pool on their uplink interfaces.  This allows Pods to be reached
+	// in a flat L2 network without a routing protocol.
+	// This is effective only when coild runs with `--uplink-interface`.
+	// +optional
+	ProxyNeighbors bool `json:"proxyNeighbors,omitempty"`
+
+	// Masquerade makes nodes masquerade traffic from Pods using this pool
+	// when it leaves the node through the uplink interface.  Traffic to the
+	// subnets of any pool is not masqueraded.  This allows Pods with
+	// non-routable addresses to reach the Internet without a separate NAT setup.
+	// This is effective only when coild runs with `--uplink-interface`.
+	// +optional
+	Masquerade bool `json:"masquerade,omitempty"`
+
+	// DNS is the DNS settings returned in the CNI result for Pods using this pool.
+	// Note that kubelet configures DNS of Pods by itself, so this is effective
+	// only for container runtimes or meta plugins that honor the CNI result.
+	// +optional
+	DNS *DNSConfig `json:"dns,omitempty"`
+
+	// Datapath is how Pods using this pool are connected to the network.
+	// "routed" connects Pods with veth pairs and routes their packets on the node.
+	// "macvlan" attaches Pods directly to the L2 network of the node's uplink
+	// interface.  The default is "routed".
+	// +kubebuilder:validation:Enum=routed;macvlan
+	// +optional
+	Datapath string `json:"datapath,omitempty"`
+
+	// Gateways are the default gateways for Pods using the "macvlan" datapath.
+	// At most one IPv4 address and one IPv6 address can be specified.
+	// If omitted, Pods have no default route.
+	// +optional
+	Gateways []string `json:"gateways,omitempty"`
+
+	// Routes is a list of additional destinations in CIDR notation, such as
+	// "169.254.169.254/32" for a metadata service, added to Pods using this pool.
+	// They are routed via the node for the "routed" datapath, or via the gateway
+	// of the same address family for the "macvlan" datapath.
+	// +optional
+	Routes []string `json:"routes,omitempty"`
+
+	// InternetEgress declares whether Pods using this pool are allowed to
+	// reach the Internet.  Coil does not enforce it; it is published as
+	// `coil.cybozu.com/internet-egress` annotation of the Pods when
+	// coil-controller runs with `--annotate-pods`, so that NAT or firewall
+	// automation can derive its rules from it.  If omitted, the annotation
+	// is not added.
+	// +optional
+	InternetEgress *bool `json:"internetEgress,omitempty"`
+
+	// BlockRoutes configures the routes to the address blocks of this pool
+	// programmed by coil-router, so that traffic from nodes with multiple
+	// networks to Pods of this pool uses the desired source address.
+	// +optional
+	BlockRoutes *BlockRouteConfig `json:"blockRoutes,omitempty"`
+}
+
+// DatapathOrDefault returns Datapath, or DatapathRouted if it is empty.
+func (aps AddressPoolSpec) DatapathOrDefault() string {
+	if aps.Datapath == "" {
+		return DatapathRouted
+	}
+	return aps.Datapath
 }
 
 func (aps AddressPoolSpec) validate() field.ErrorList {
@@ -176,6 +349,152 @@ func (aps AddressPoolSpec) validate() field.ErrorList {
 		}
 	}
 
+	allErrs = append(allErrs, aps.validateQuarantine()...)
+	allErrs = append(allErrs, aps.validateDNS()...)
+	allErrs = append(allErrs, aps.validateGateways()...)
+	allErrs = append(allErrs, aps.validateRoutes()...)
+	allErrs = append(allErrs, aps.validatePrefixDelegation()...)
+	return append(allErrs, aps.validateNodeSelector()...)
+}
+
+// Limits of BlockSizeBits for pools with PrefixDelegation.
+const (
+	MinDelegatedBlockSizeBits = 16
+	MaxDelegatedBlockSizeBits = 64
+)
+
+// MaxDelegatedBlockCountBits limits the number of blocks in each subnet of
+// pools with PrefixDelegation to 2^MaxDelegatedBlockCountBits, because
+// coil-controller tracks every block of the pool in memory.
+const MaxDelegatedBlockCountBits = 24
+
+func (aps AddressPoolSpec) validatePrefixDelegation() field.ErrorList {
+	if !aps.PrefixDelegation {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	p := field.NewPath("spec")
+	validSize := aps.BlockSizeBits >= MinDelegatedBlockSizeBits && aps.BlockSizeBits <= MaxDelegatedBlockSizeBits
+	if !validSize {
+		allErrs = append(allErrs, field.Invalid(p.Child("blockSizeBits"), aps.BlockSizeBits,
+			fmt.Sprintf("must be between %d and %d for prefix delegation", MinDelegatedBlockSizeBits, MaxDelegatedBlockSizeBits)))
+	}
+	if aps.DatapathOrDefault() != DatapathRouted {
+		allErrs = append(allErrs, field.Forbidden(p.Child("datapath"), "prefix delegation requires the routed datapath"))
+	}
+	for i, ss := range aps.Subnets {
+		if !ss.IsIPv6() {
+			allErrs = append(allErrs, field.Invalid(p.Child("subnets").Index(i), "", "prefix delegation requires IPv6-only subnets"))
+			continue
+		}
+		_, n, err := net.ParseCIDR(*ss.IPv6)
+		if err != nil || !validSize {
+			// reported elsewhere
+			continue
+		}
+		ones, bits := n.Mask.Size()
+		if bits-ones-int(aps.BlockSizeBits) > MaxDelegatedBlockCountBits {
+			allErrs = append(allErrs, field.Invalid(p.Child("subnets").Index(i).Child("ipv6"), *ss.IPv6,
+				fmt.Sprintf("too many blocks for prefix delegation; the prefix length must be at least %d", 128-int(aps.BlockSizeBits)-MaxDelegatedBlockCountBits)))
+		}
+	}
+	return allErrs
+}
+
+func (aps AddressPoolSpec) validateNodeSelector() field.ErrorList {
+	if aps.NodeSelector == nil {
+		return nil
+	}
+	return metav1validation.ValidateLabelSelector(aps.NodeSelector, field.NewPath("spec", "nodeSelector"))
+}
+
+func (aps AddressPoolSpec) validateDNS() field.ErrorList {
+	if aps.DNS == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	p := field.NewPath("spec", "dns", "nameservers")
+	for i, a := range aps.DNS.Nameservers {
+		if net.ParseIP(a) == nil {
+			allErrs = append(allErrs, field.Invalid(p.Index(i), a, "invalid IP address"))
+		}
+	}
+	return allErrs
+}
+
+func (aps AddressPoolSpec) validateGateways() field.ErrorList {
+	if len(aps.Gateways) == 0 {
+		return nil
+	}
+
+	p := field.NewPath("spec", "gateways")
+	if aps.DatapathOrDefault() != DatapathMACVLAN {
+		return field.ErrorList{field.Forbidden(p, "gateways can be specified only for the macvlan datapath")}
+	}
+
+	var allErrs field.ErrorList
+	var hasIPv4, hasIPv6 bool
+	for i, a := range aps.Gateways {
+		ip := net.ParseIP(a)
+		switch {
+		case ip == nil:
+			allErrs = append(allErrs, field.Invalid(p.Index(i), a, "invalid IP address"))
+		case ip.To4() != nil:
+			if hasIPv4 {
+				allErrs = append(allErrs, field.Duplicate(p.Index(i), a))
+			}
+			hasIPv4 = true
+		default:
+			if hasIPv6 {
+				allErrs = append(allErrs, field.Duplicate(p.Index(i), a))
+			}
+			hasIPv6 = true
+		}
+	}
+	return allErrs
+}
+
+func (aps AddressPoolSpec) validateRoutes() field.ErrorList {
+	var hasIPv4GW, hasIPv6GW bool
+	for _, a := range aps.Gateways {
+		if ip := net.ParseIP(a); ip != nil {
+			if ip.To4() != nil {
+				hasIPv4GW = true
+			} else {
+				hasIPv6GW = true
+			}
+		}
+	}
+	macvlan := aps.DatapathOrDefault() == DatapathMACVLAN
+
+	var allErrs field.ErrorList
+	p := field.NewPath("spec", "routes")
+	for i, r := range aps.Routes {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(p.Index(i), r, "invalid CIDR"))
+			continue
+		}
+		if !macvlan {
+			continue
+		}
+		if (n.IP.To4() != nil && !hasIPv4GW) || (n.IP.To4() == nil && !hasIPv6GW) {
+			allErrs = append(allErrs, field.Invalid(p.Index(i), r, "no gateway of the same address family"))
+		}
+	}
+	return allErrs
+}
+
+func (aps AddressPoolSpec) validateQuarantine() field.ErrorList {
+	var allErrs field.ErrorList
+	p := field.NewPath("spec", "quarantine")
+	for i, a := range aps.Quarantine {
+		if net.ParseIP(a) == nil {
+			allErrs = append(allErrs, field.Invalid(p.Index(i), a, "invalid IP address"))
+		}
+	}
 	return allErrs
 }
 
@@ -186,6 +505,12 @@ func (aps AddressPoolSpec) validateUpdate(old AddressPoolSpec) field.ErrorList {
 	if aps.BlockSizeBits != old.BlockSizeBits {
 		allErrs = append(allErrs, field.Forbidden(p.Child("blockSizeBits"), "unchangeable"))
 	}
+	if aps.DatapathOrDefault() != old.DatapathOrDefault() {
+		allErrs = append(allErrs, field.Forbidden(p.Child("datapath"), "unchangeable"))
+	}
+	if aps.PrefixDelegation != old.PrefixDelegation {
+		allErrs = append(allErrs, field.Forbidden(p.Child("prefixDelegation"), "unchangeable"))
+	}
 
 	p = p.Child("subnets")
 	if len(old.Subnets) > len(aps.Subnets) {
@@ -204,7 +529,12 @@ func (aps AddressPoolSpec) validateUpdate(old AddressPoolSpec) field.ErrorList {
 		}
 	}
 
-	return allErrs
+	allErrs = append(allErrs, aps.validateQuarantine()...)
+	allErrs = append(allErrs, aps.validateDNS()...)
+	allErrs = append(allErrs, aps.validateGateways()...)
+	allErrs = append(allErrs, aps.validateRoutes()...)
+	allErrs = append(allErrs, aps.validatePrefixDelegation()...)
+	return append(allErrs, aps.validateNodeSelector()...)
 }
 
 // +kubebuilder:object:root=true
@@ -235,6 +235,12 @@ func testSubnetSetGetBlock(t *testing.T) {
 			10, 5,
 			makeSubnet("10.2.1.64/27"), makeSubnet("fd02::0900:0140/123"),
 		},
+		{
+			"ipv6-n3-bits64",
+			makeSubnetSet("", "2001:db8::/48"),
+			3, 64,
+			nil, makeSubnet("2001:db8:0:3::/64"),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -222,4 +223,185 @@ var _ = Describe("AddressPool Webhook", func() {
 		err = k8sClient.Update(ctx, r)
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("should allow updating quarantine", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.Quarantine = []string{"10.2.0.1", "10.2.0.10"}
+		err = k8sClient.Update(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.Quarantine = r.Spec.Quarantine[1:]
+		err = k8sClient.Update(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should deny invalid quarantine", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+				Quarantine:    []string{"10.2.0.0/24"},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should allow node selectors", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+				NodeSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"example.com/gpu": "true"},
+				},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.NodeSelector = nil
+		err = k8sClient.Update(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should deny invalid node selectors", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+				NodeSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "example.com/gpu", Operator: metav1.LabelSelectorOpIn},
+					},
+				},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should allow DNS settings", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+				DNS: &DNSConfig{
+					Nameservers: []string{"10.100.0.53", "fd00::53"},
+					Search:      []string{"corp.example.com"},
+				},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.DNS.Nameservers = append(r.Spec.DNS.Nameservers, "dns.example.com")
+		err = k8sClient.Update(ctx, r)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should validate datapath and gateways", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+				Gateways:      []string{"10.2.0.1"},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Datapath = DatapathMACVLAN
+		r.Spec.Gateways = []string{"10.2.0.1", "10.2.0.2"}
+		err = k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Gateways = []string{"10.2.0.1", "fd02::1"}
+		err = k8sClient.Create(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.Datapath = DatapathRouted
+		r.Spec.Gateways = nil
+		err = k8sClient.Update(ctx, r)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should validate routes", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits: 2,
+				Subnets:       []SubnetSet{makeSubnetSet("10.2.0.0/24", "")},
+				Datapath:      DatapathMACVLAN,
+				Gateways:      []string{"10.2.0.1"},
+				Routes:        []string{"169.254.169.254/32", "fd00::53/128"},
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Routes = []string{"169.254.169.254"}
+		err = k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Routes = []string{"169.254.169.254/32"}
+		err = k8sClient.Create(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.Gateways = nil
+		err = k8sClient.Update(ctx, r)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should validate prefix delegation", func() {
+		r := &AddressPool{
+			Spec: AddressPoolSpec{
+				BlockSizeBits:    64,
+				Subnets:          []SubnetSet{makeSubnetSet("10.2.0.0/24", "2001:db8::/120")},
+				PrefixDelegation: true,
+			},
+		}
+		r.Name = "test"
+
+		err := k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Subnets = []SubnetSet{makeSubnetSet("", "2001:db8::/48")}
+		r.Spec.BlockSizeBits = 8
+		err = k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Subnets = []SubnetSet{makeSubnetSet("", "2001:db8::/32")}
+		r.Spec.BlockSizeBits = 64
+		err = k8sClient.Create(ctx, r)
+		Expect(err).To(HaveOccurred())
+
+		r.Spec.Subnets = []SubnetSet{makeSubnetSet("", "2001:db8::/48")}
+		err = k8sClient.Create(ctx, r)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.Spec.PrefixDelegation = false
+		err = k8sClient.Update(ctx, r)
+		Expect(err).To(HaveOccurred())
+	})
 })
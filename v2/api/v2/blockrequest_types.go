@@ -20,6 +20,12 @@ type BlockRequestSpec struct {
 
 	// PoolName is the target AddressPool name.
 	PoolName string `json:"poolName"`
+
+	// Critical is true if the block is requested to allocate addresses for
+	// system-critical Pods.  Such requests may take the blocks kept by
+	// ReservedBlocks of the pool.
+	// +optional
+	Critical bool `json:"critical,omitempty"`
 }
 
 // BlockRequestStatus defines the observed state of BlockRequest
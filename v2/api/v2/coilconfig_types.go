@@ -0,0 +1,124 @@
+package v2
+
+import (
+	"fmt"
+	"net"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CoilConfigSpec defines the cluster-wide defaults of Coil.
+//
+// Fields left empty fall back to the command-line flags of each component.
+type CoilConfigSpec struct {
+	// DefaultPool is the AddressPool for namespaces without pool annotations.
+	// +optional
+	DefaultPool string `json:"defaultPool,omitempty"`
+
+	// GCInterval is the interval of garbage collection by coil-controller.
+	// +optional
+	GCInterval *metav1.Duration `json:"gcInterval,omitempty"`
+
+	// RequestTTL is the retention period of completed or failed BlockRequests.
+	// +optional
+	RequestTTL *metav1.Duration `json:"requestTTL,omitempty"`
+
+	// RenumberInterval is the cooldown between Pod evictions to move
+	// a namespace to another pool.
+	// +optional
+	RenumberInterval *metav1.Duration `json:"renumberInterval,omitempty"`
+
+	// Supernets are the subnets out of which pools requested by PoolRequests
+	// or created by `coilctl pool create` are curved.
+	// +optional
+	Supernets []string `json:"supernets,omitempty"`
+
+	// PoolRequestQuota limits the pools requested by each namespace.
+	// +optional
+	PoolRequestQuota *PoolRequestQuota `json:"poolRequestQuota,omitempty"`
+
+	// ServiceCIDRs are the subnets of Service ClusterIPs.
+	// AddressPools overlapping them are rejected.
+	// +optional
+	ServiceCIDRs []string `json:"serviceCIDRs,omitempty"`
+
+	// NodeNetworks are the subnets of the primary networks of nodes.
+	// AddressPools overlapping them or addresses of nodes are rejected.
+	// +optional
+	NodeNetworks []string `json:"nodeNetworks,omitempty"`
+}
+
+// PoolRequestQuota limits the pools requested by PoolRequests of a namespace.
+// Limits left empty are not enforced.
+type PoolRequestQuota struct {
+	// MaxPools is the maximum number of pools of a namespace.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxPools *int32 `json:"maxPools,omitempty"`
+
+	// MaxIPv4Addresses is the maximum total number of IPv4 addresses
+	// of the pools of a namespace.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxIPv4Addresses *int64 `json:"maxIPv4Addresses,omitempty"`
+}
+
+// Validate validates the spec.
+func (s CoilConfigSpec) Validate() error {
+	durations := []struct {
+		name string
+		d    *metav1.Duration
+	}{
+		{"gcInterval", s.GCInterval},
+		{"requestTTL", s.RequestTTL},
+		{"renumberInterval", s.RenumberInterval},
+	}
+	for _, x := range durations {
+		if x.d != nil && x.d.Duration <= 0 {
+			return fmt.Errorf("%s must be positive: %s", x.name, x.d.Duration)
+		}
+	}
+	subnets := []struct {
+		name  string
+		cidrs []string
+	}{
+		{"supernet", s.Supernets},
+		{"service CIDR", s.ServiceCIDRs},
+		{"node network", s.NodeNetworks},
+	}
+	for _, x := range subnets {
+		for _, sn := range x.cidrs {
+			if _, _, err := net.ParseCIDR(sn); err != nil {
+				return fmt.Errorf("invalid %s %s: %w", x.name, sn, err)
+			}
+		}
+	}
+	return nil
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:JSONPath=.spec.defaultPool,name=DefaultPool,type=string
+
+// CoilConfig is the Schema for the coilconfigs API
+//
+// Only the CoilConfig named "default" is read by Coil.
+type CoilConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CoilConfigSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CoilConfigList contains a list of CoilConfig
+type CoilConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CoilConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CoilConfig{}, &CoilConfigList{})
+}
@@ -0,0 +1,55 @@
+package v2
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCoilConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	spec := CoilConfigSpec{
+		DefaultPool:      "default",
+		GCInterval:       &metav1.Duration{Duration: time.Hour},
+		RenumberInterval: &metav1.Duration{Duration: time.Second},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (CoilConfigSpec{}).Validate(); err != nil {
+		t.Error(err)
+	}
+
+	spec.RequestTTL = &metav1.Duration{}
+	if err := spec.Validate(); err == nil {
+		t.Error("zero duration should be rejected")
+	}
+	spec.RequestTTL = nil
+	spec.GCInterval.Duration = -time.Second
+	if err := spec.Validate(); err == nil {
+		t.Error("negative duration should be rejected")
+	}
+	spec.GCInterval.Duration = time.Hour
+
+	spec.Supernets = []string{"10.0.0.0/8", "fd00::/32"}
+	if err := spec.Validate(); err != nil {
+		t.Error(err)
+	}
+	spec.Supernets = []string{"10.0.0.0"}
+	if err := spec.Validate(); err == nil {
+		t.Error("invalid supernet should be rejected")
+	}
+	spec.Supernets = nil
+
+	spec.ServiceCIDRs = []string{"10.96.0.0/12"}
+	spec.NodeNetworks = []string{"192.168.0.0/16", "fd10::/64"}
+	if err := spec.Validate(); err != nil {
+		t.Error(err)
+	}
+	spec.NodeNetworks = []string{"192.168.0.0/33"}
+	if err := spec.Validate(); err == nil {
+		t.Error("invalid node network should be rejected")
+	}
+}
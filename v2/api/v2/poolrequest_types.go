@@ -0,0 +1,133 @@
+package v2
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IP families of PoolRequest
+const (
+	FamilyIPv4 = "IPv4"
+	FamilyIPv6 = "IPv6"
+)
+
+// PoolRequestSpec defines the address space requested by a team.
+type PoolRequestSpec struct {
+	// Family is the IP family of the requested subnet.
+	// +kubebuilder:validation:Enum=IPv4;IPv6
+	// +kubebuilder:default=IPv4
+	// +optional
+	Family string `json:"family,omitempty"`
+
+	// PrefixLength is the prefix length of the requested subnet, e.g. 24 for "/24".
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=128
+	PrefixLength int32 `json:"prefixLength"`
+
+	// BlockSizeBits is the BlockSizeBits of the pool to be created.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=5
+	// +optional
+	BlockSizeBits int32 `json:"blockSizeBits,omitempty"`
+
+	// Justification tells administrators why the address space is needed.
+	// +kubebuilder:validation:MinLength=1
+	Justification string `json:"justification"`
+}
+
+// IsIPv6 returns true if the requested subnet is of IPv6.
+func (s PoolRequestSpec) IsIPv6() bool {
+	return s.Family == FamilyIPv6
+}
+
+// Validate validates the spec.
+func (s PoolRequestSpec) Validate() error {
+	bits := int32(32)
+	if s.IsIPv6() {
+		bits = 128
+	}
+	if s.PrefixLength < 1 || s.PrefixLength > bits {
+		return fmt.Errorf("invalid prefix length for %s: %d", s.familyOrDefault(), s.PrefixLength)
+	}
+	if s.BlockSizeBits < 0 || s.BlockSizeBits > bits-s.PrefixLength {
+		return fmt.Errorf("block size bits %d is too large for /%d", s.BlockSizeBits, s.PrefixLength)
+	}
+	if s.Justification == "" {
+		return fmt.Errorf("justification is empty")
+	}
+	return nil
+}
+
+func (s PoolRequestSpec) familyOrDefault() string {
+	if s.Family == "" {
+		return FamilyIPv4
+	}
+	return s.Family
+}
+
+// PoolRequestPhase is the phase of a PoolRequest.
+type PoolRequestPhase string
+
+// Valid values for PoolRequestPhase
+const (
+	PoolRequestPending PoolRequestPhase = "Pending"
+	PoolRequestReady   PoolRequestPhase = "Ready"
+	PoolRequestDenied  PoolRequestPhase = "Denied"
+)
+
+// PoolRequestStatus defines the observed state of PoolRequest
+type PoolRequestStatus struct {
+	// Phase is Pending until the request is approved and fulfilled.
+	// +optional
+	Phase PoolRequestPhase `json:"phase,omitempty"`
+
+	// Pool is the name of the AddressPool created for the request.
+	// +optional
+	Pool string `json:"pool,omitempty"`
+
+	// Subnet is the subnet of the pool.
+	// +optional
+	Subnet string `json:"subnet,omitempty"`
+
+	// Supernet is the supernet out of which the subnet was curved.
+	// +optional
+	Supernet string `json:"supernet,omitempty"`
+
+	// Message is a human readable message about the phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=.spec.prefixLength,name=PrefixLength,type=integer
+// +kubebuilder:printcolumn:JSONPath=.status.phase,name=Phase,type=string
+// +kubebuilder:printcolumn:JSONPath=.status.pool,name=Pool,type=string
+// +kubebuilder:printcolumn:JSONPath=.status.subnet,name=Subnet,type=string
+
+// PoolRequest is the Schema for the poolrequests API
+//
+// A PoolRequest asks for a new AddressPool for the namespace.  The pool is
+// created after an administrator approves the request with the annotation
+// `coil.cybozu.com/approved: "true"`.
+type PoolRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PoolRequestSpec   `json:"spec,omitempty"`
+	Status PoolRequestStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PoolRequestList contains a list of PoolRequest
+type PoolRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PoolRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PoolRequest{}, &PoolRequestList{})
+}
@@ -0,0 +1,29 @@
+package v2
+
+import "testing"
+
+func TestPoolRequestValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		spec  PoolRequestSpec
+		valid bool
+	}{
+		{"ipv4", PoolRequestSpec{PrefixLength: 24, BlockSizeBits: 5, Justification: "x"}, true},
+		{"ipv6", PoolRequestSpec{Family: FamilyIPv6, PrefixLength: 64, BlockSizeBits: 5, Justification: "x"}, true},
+		{"long ipv4 prefix", PoolRequestSpec{PrefixLength: 33, Justification: "x"}, false},
+		{"large block", PoolRequestSpec{PrefixLength: 28, BlockSizeBits: 5, Justification: "x"}, false},
+		{"no justification", PoolRequestSpec{PrefixLength: 24}, false},
+	}
+
+	for _, tc := range testCases {
+		err := tc.spec.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: should be invalid", tc.name)
+		}
+	}
+}
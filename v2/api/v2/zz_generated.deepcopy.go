@@ -6,8 +6,9 @@
 package v2
 
 import (
-	"k8s.io/api/apps/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -146,6 +147,41 @@ func (in *AddressPoolSpec) DeepCopyInto(out *AddressPoolSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Quarantine != nil {
+		in, out := &in.Quarantine, &out.Quarantine
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(DNSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Gateways != nil {
+		in, out := &in.Gateways, &out.Gateways
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InternetEgress != nil {
+		in, out := &in.InternetEgress, &out.InternetEgress
+		*out = new(bool)
+		**out = **in
+	}
+	if in.BlockRoutes != nil {
+		in, out := &in.BlockRoutes, &out.BlockRoutes
+		*out = new(BlockRouteConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddressPoolSpec.
@@ -271,6 +307,159 @@ func (in *BlockRequestStatus) DeepCopy() *BlockRequestStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlockRouteConfig) DeepCopyInto(out *BlockRouteConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlockRouteConfig.
+func (in *BlockRouteConfig) DeepCopy() *BlockRouteConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BlockRouteConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CoilConfig) DeepCopyInto(out *CoilConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CoilConfig.
+func (in *CoilConfig) DeepCopy() *CoilConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CoilConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CoilConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CoilConfigList) DeepCopyInto(out *CoilConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CoilConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CoilConfigList.
+func (in *CoilConfigList) DeepCopy() *CoilConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(CoilConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CoilConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CoilConfigSpec) DeepCopyInto(out *CoilConfigSpec) {
+	*out = *in
+	if in.GCInterval != nil {
+		in, out := &in.GCInterval, &out.GCInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RequestTTL != nil {
+		in, out := &in.RequestTTL, &out.RequestTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenumberInterval != nil {
+		in, out := &in.RenumberInterval, &out.RenumberInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Supernets != nil {
+		in, out := &in.Supernets, &out.Supernets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PoolRequestQuota != nil {
+		in, out := &in.PoolRequestQuota, &out.PoolRequestQuota
+		*out = new(PoolRequestQuota)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceCIDRs != nil {
+		in, out := &in.ServiceCIDRs, &out.ServiceCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeNetworks != nil {
+		in, out := &in.NodeNetworks, &out.NodeNetworks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CoilConfigSpec.
+func (in *CoilConfigSpec) DeepCopy() *CoilConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CoilConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSConfig) DeepCopyInto(out *DNSConfig) {
+	*out = *in
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Search != nil {
+		in, out := &in.Search, &out.Search
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Options != nil {
+		in, out := &in.Options, &out.Options
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSConfig.
+func (in *DNSConfig) DeepCopy() *DNSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Egress) DeepCopyInto(out *Egress) {
 	*out = *in
@@ -357,7 +546,7 @@ func (in *EgressSpec) DeepCopyInto(out *EgressSpec) {
 	}
 	if in.Strategy != nil {
 		in, out := &in.Strategy, &out.Strategy
-		*out = new(v1.DeploymentStrategy)
+		*out = new(appsv1.DeploymentStrategy)
 		(*in).DeepCopyInto(*out)
 	}
 	if in.Template != nil {
@@ -426,6 +615,120 @@ func (in *Metadata) DeepCopy() *Metadata {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolRequest) DeepCopyInto(out *PoolRequest) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolRequest.
+func (in *PoolRequest) DeepCopy() *PoolRequest {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolRequest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PoolRequest) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolRequestList) DeepCopyInto(out *PoolRequestList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PoolRequest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolRequestList.
+func (in *PoolRequestList) DeepCopy() *PoolRequestList {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolRequestList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PoolRequestList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolRequestQuota) DeepCopyInto(out *PoolRequestQuota) {
+	*out = *in
+	if in.MaxPools != nil {
+		in, out := &in.MaxPools, &out.MaxPools
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxIPv4Addresses != nil {
+		in, out := &in.MaxIPv4Addresses, &out.MaxIPv4Addresses
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolRequestQuota.
+func (in *PoolRequestQuota) DeepCopy() *PoolRequestQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolRequestQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolRequestSpec) DeepCopyInto(out *PoolRequestSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolRequestSpec.
+func (in *PoolRequestSpec) DeepCopy() *PoolRequestSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolRequestSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolRequestStatus) DeepCopyInto(out *PoolRequestStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolRequestStatus.
+func (in *PoolRequestStatus) DeepCopy() *PoolRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolRequestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubnetSet) DeepCopyInto(out *SubnetSet) {
 	*out = *in
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/clientconfig"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -18,7 +19,27 @@ var config struct {
 	webhookAddr string
 	certDir     string
 	gcInterval  time.Duration
+	requestTTL  time.Duration
+	rebalance   time.Duration
+	maxMoves    int
+	annotate    bool
 	egressPort  int32
+	notifyURLs  []string
+	slackURLs   []string
+	hubConfig   string
+	hubNS       string
+	clusterName string
+	staleAfter  time.Duration
+	pauseStale  bool
+	deadAfter   time.Duration
+	renumber    time.Duration
+	routeAudit  time.Duration
+	overlap     time.Duration
+	canary      time.Duration
+	canaryWait  time.Duration
+	canaryImage string
+	coildPort   int
+	clientOpts  clientconfig.Options
 	zapOpts     zap.Options
 }
 
@@ -49,7 +70,28 @@ func init() {
 	pf.StringVar(&config.webhookAddr, "webhook-addr", ":9443", "bind address of admission webhook")
 	pf.StringVar(&config.certDir, "cert-dir", "/certs", "directory to locate TLS certs for webhook")
 	pf.DurationVar(&config.gcInterval, "gc-interval", 1*time.Hour, "garbage collection interval")
+	pf.DurationVar(&config.requestTTL, "request-ttl", 1*time.Hour, "retention period of completed or failed block requests")
+	pf.DurationVar(&config.rebalance, "rebalance-interval", 0, "interval to move free address blocks to nodes running out of addresses; 0 disables it")
+	pf.IntVar(&config.maxMoves, "rebalance-max-moves", 10, "maximum number of address blocks moved in a rebalance cycle")
+	pf.BoolVar(&config.annotate, "annotate-pods", false, "annotate Pods with the address pool and block of their addresses")
 	pf.Int32Var(&config.egressPort, "egress-port", 5555, "UDP port number used by coil-egress")
+	pf.StringSliceVar(&config.notifyURLs, "notify-url", nil, "URL of a webhook to receive pool events as JSON")
+	pf.StringSliceVar(&config.slackURLs, "notify-slack-url", nil, "URL of a Slack incoming webhook to receive pool events")
+	pf.StringVar(&config.hubConfig, "hub-kubeconfig", "", "kubeconfig file of the hub cluster to coordinate pools with other clusters")
+	pf.StringVar(&config.hubNS, "hub-namespace", "kube-system", "namespace of the hub cluster to store claims of subnets")
+	pf.DurationVar(&config.staleAfter, "stale-node-threshold", 5*time.Minute, "flag nodes whose coild has not sent heartbeats for this duration; 0 disables it")
+	pf.BoolVar(&config.pauseStale, "pause-on-stale-nodes", false, "keep block requests of stale nodes and exclude them from rebalancing")
+	pf.DurationVar(&config.deadAfter, "dead-node-threshold", 1*time.Hour, "flag address blocks of nodes whose coild has not sent heartbeats for this duration as reclaimable; 0 disables it")
+	pf.DurationVar(&config.renumber, "renumber-interval", 30*time.Second, "interval between Pod evictions to move namespaces to another pool")
+	pf.DurationVar(&config.routeAudit, "route-audit-interval", 0, "interval to compare routes exported by coild on every node with address blocks; 0 disables it")
+	pf.DurationVar(&config.overlap, "overlap-check-interval", 10*time.Minute, "interval to check that pools overlap neither each other, node networks, nor Service CIDRs; 0 disables it")
+	pf.DurationVar(&config.canary, "canary-interval", 0, "interval to look for nodes with a new version of coild and check them with canary Pods; 0 disables it")
+	pf.DurationVar(&config.canaryWait, "canary-timeout", 5*time.Minute, "time for a canary Pod to get an address and become reachable before the check fails")
+	pf.StringVar(&config.canaryImage, "canary-image", "", "container image of canary Pods; defaults to the image of coil-controller")
+	pf.IntVar(&config.coildPort, "coild-metrics-port", 9384, "port number of the metrics endpoint of coild to fetch routes for --route-audit-interval")
+	pf.StringVar(&config.clusterName, "cluster-name", "", "unique name of this cluster to label address blocks; required with --hub-kubeconfig")
+
+	config.clientOpts.AddFlags(pf)
 
 	goflags := flag.NewFlagSet("klog", flag.ExitOnError)
 	klog.InitFlags(goflags)
@@ -1,6 +1,7 @@
 package sub
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -9,9 +10,13 @@ import (
 
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/controllers"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
 	"github.com/cybozu-go/coil/v2/pkg/indexing"
 	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/loglevel"
+	"github.com/cybozu-go/coil/v2/pkg/notify"
+	"github.com/cybozu-go/coil/v2/pkg/routeaudit"
 	"github.com/cybozu-go/coil/v2/runners"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -20,10 +25,17 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const (
-	gracefulTimeout = 20 * time.Second
+	gracefulTimeout      = 20 * time.Second
+	federationInterval   = 1 * time.Minute
+	versionCheckInterval = 1 * time.Minute
+	staleCheckInterval   = 30 * time.Second
+	reclaimInterval      = 1 * time.Minute
+	routeAuditTimeout    = 5 * time.Second
+	poolInventoryTTL     = 10 * time.Second
 )
 
 var (
@@ -39,6 +51,7 @@ func init() {
 }
 
 func subMain() error {
+	logLevel := loglevel.Setup(&config.zapOpts)
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&config.zapOpts)))
 
 	host, portStr, err := net.SplitHostPort(config.webhookAddr)
@@ -50,8 +63,13 @@ func subMain() error {
 		return fmt.Errorf("invalid webhook address: %w", err)
 	}
 
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return err
+	}
+
 	timeout := gracefulTimeout
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                  scheme,
 		LeaderElection:          true,
 		LeaderElectionID:        "coil-leader",
@@ -73,10 +91,24 @@ func subMain() error {
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		return err
 	}
+	if err := mgr.AddMetricsExtraHandler("/debug/loglevel", loglevel.Handler(logLevel)); err != nil {
+		return err
+	}
 
 	// register controllers
 
-	pm := ipam.NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("pool-manager"), scheme)
+	notifier := notify.NewWebhookNotifier(ctrl.Log.WithName("notify"), config.notifyURLs, config.slackURLs)
+
+	var guard ipam.SubnetGuard
+	if config.hubConfig != "" {
+		fed, err := setupFederation(mgr)
+		if err != nil {
+			return err
+		}
+		guard = fed
+	}
+
+	pm := ipam.NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("pool-manager"), scheme, config.clusterName, guard)
 	apctrl := controllers.AddressPoolReconciler{
 		Client:  mgr.GetClient(),
 		Scheme:  scheme,
@@ -92,9 +124,10 @@ func subMain() error {
 	}
 
 	brctrl := controllers.BlockRequestReconciler{
-		Client:  mgr.GetClient(),
-		Scheme:  scheme,
-		Manager: pm,
+		Client:   mgr.GetClient(),
+		Scheme:   scheme,
+		Manager:  pm,
+		Notifier: notifier,
 	}
 	if err := brctrl.SetupWithManager(mgr); err != nil {
 		return err
@@ -120,6 +153,45 @@ func subMain() error {
 		return err
 	}
 
+	if config.annotate {
+		if err := controllers.SetupPodAnnotator(mgr); err != nil {
+			return err
+		}
+	}
+
+	coilCfg := coilconfig.NewStore(coilconfig.Defaults{
+		GCInterval:       config.gcInterval,
+		RequestTTL:       config.requestTTL,
+		RenumberInterval: config.renumber,
+	})
+	if _, err := coilCfg.Load(ctx, mgr.GetAPIReader()); err != nil {
+		// the watcher applies the config once it is fixed.
+		setupLog.Error(err, "failed to load the config; using the flags")
+	}
+	cfgWatcher := &controllers.CoilConfigWatcher{
+		Client: mgr.GetClient(),
+		Store:  coilCfg,
+	}
+	if err := cfgWatcher.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	if err := controllers.SetupRenumberer(mgr, coilCfg); err != nil {
+		return err
+	}
+
+	if err := controllers.SetupPoolCordoner(mgr, coilCfg); err != nil {
+		return err
+	}
+
+	if err := controllers.SetupPoolRequestReconciler(mgr, coilCfg); err != nil {
+		return err
+	}
+
+	if err := controllers.SetupBlockQuarantineNotifier(mgr); err != nil {
+		return err
+	}
+
 	// register webhooks
 
 	if err := (&coilv2.AddressPool{}).SetupWebhookWithManager(mgr); err != nil {
@@ -128,13 +200,94 @@ func subMain() error {
 	if err := (&coilv2.Egress{}).SetupWebhookWithManager(mgr); err != nil {
 		return err
 	}
+	controllers.SetupSourceIPWebhook(mgr)
+	controllers.SetupPoolOverlapWebhook(mgr, coilCfg)
+
+	// metrics
+
+	if err := metrics.Registry.Register(ipam.NewBlockCollector(mgr.GetClient(), ctrl.Log.WithName("block-metrics"))); err != nil {
+		return err
+	}
 
 	// other runners
 
-	gc := runners.NewGarbageCollector(mgr, ctrl.Log.WithName("gc"), config.gcInterval)
+	var stale runners.StaleNodeDetector
+	if config.staleAfter > 0 {
+		detector := runners.NewStaleNodeDetector(mgr.GetAPIReader(), mgr.GetEventRecorderFor("coil-controller"),
+			podNS, config.staleAfter, staleCheckInterval, ctrl.Log.WithName("stale-nodes"))
+		if err := mgr.Add(detector); err != nil {
+			return err
+		}
+		if config.pauseStale {
+			stale = detector
+		}
+	} else if config.pauseStale {
+		return errors.New("--pause-on-stale-nodes requires --stale-node-threshold")
+	}
+
+	if config.deadAfter > 0 {
+		reclaimer := runners.NewBlockReclaimer(mgr, podNS, config.deadAfter, reclaimInterval, ctrl.Log.WithName("block-reclaimer"))
+		if err := mgr.Add(reclaimer); err != nil {
+			return err
+		}
+	}
+
+	gc := runners.NewGarbageCollector(mgr, ctrl.Log.WithName("gc"), coilCfg, notifier, stale)
 	if err := mgr.Add(gc); err != nil {
 		return err
 	}
+	if err := mgr.AddMetricsExtraHandler("/status/gc", gc); err != nil {
+		return err
+	}
+	inventory := runners.NewPoolInventoryHandler(mgr.GetClient(), poolInventoryTTL, ctrl.Log.WithName("pool-inventory"))
+	if err := mgr.AddMetricsExtraHandler(runners.PoolInventoryPath, inventory); err != nil {
+		return err
+	}
+
+	if config.routeAudit > 0 {
+		fetch := routeaudit.HTTPFetcher(config.coildPort, routeAuditTimeout)
+		auditor := runners.NewRouteAuditor(mgr, podNS, fetch, config.routeAudit, ctrl.Log.WithName("route-auditor"))
+		if err := mgr.Add(auditor); err != nil {
+			return err
+		}
+		if err := mgr.AddMetricsExtraHandler(routeaudit.StatusPath, auditor); err != nil {
+			return err
+		}
+	}
+
+	if config.overlap > 0 {
+		checker := runners.NewPoolOverlapChecker(mgr.GetClient(), mgr.GetEventRecorderFor("coil-controller"), coilCfg, config.overlap, ctrl.Log.WithName("pool-overlap"))
+		if err := mgr.Add(checker); err != nil {
+			return err
+		}
+	}
+
+	if config.canary > 0 {
+		canaryImage := config.canaryImage
+		if canaryImage == "" {
+			canaryImage = img
+		}
+		canary := runners.NewCanaryChecker(mgr.GetClient(), mgr.GetEventRecorderFor("coil-controller"), podNS, canaryImage, config.canary, config.canaryWait, ctrl.Log.WithName("canary"))
+		if err := mgr.Add(canary); err != nil {
+			return err
+		}
+	}
+
+	versions := runners.NewVersionPublisher(mgr.GetClient(), client.ObjectKey{Namespace: podNS, Name: podName}, "", ctrl.Log.WithName("version-publisher"))
+	if err := mgr.Add(versions); err != nil {
+		return err
+	}
+	checker := runners.NewVersionSkewChecker(mgr, podNS, versionCheckInterval, ctrl.Log.WithName("version-checker"))
+	if err := mgr.Add(checker); err != nil {
+		return err
+	}
+
+	if config.rebalance > 0 {
+		rb := runners.NewRebalancer(mgr, ctrl.Log.WithName("rebalancer"), config.rebalance, config.maxMoves, stale)
+		if err := mgr.Add(rb); err != nil {
+			return err
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
@@ -144,3 +297,24 @@ func subMain() error {
 
 	return nil
 }
+
+func setupFederation(mgr ctrl.Manager) (runners.Federation, error) {
+	if config.clusterName == "" {
+		return nil, errors.New("--cluster-name is required for --hub-kubeconfig")
+	}
+
+	hubCfg, err := config.clientOpts.ConfigFromFile(config.hubConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig of the hub cluster: %w", err)
+	}
+	hub, err := client.New(hubCfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a client for the hub cluster: %w", err)
+	}
+
+	fed := runners.NewFederation(mgr, hub, config.clusterName, config.hubNS, ctrl.Log.WithName("federation"), federationInterval)
+	if err := mgr.Add(fed); err != nil {
+		return nil, err
+	}
+	return fed, nil
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/clientconfig"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -15,6 +16,7 @@ var config struct {
 	metricsAddr string
 	healthAddr  string
 	port        int
+	clientOpts  clientconfig.Options
 	zapOpts     zap.Options
 }
 
@@ -44,6 +46,8 @@ func init() {
 	pf.StringVar(&config.healthAddr, "health-addr", ":8081", "bind address of health/readiness probes")
 	pf.IntVar(&config.port, "fou-port", 5555, "port number for foo-over-udp tunnels")
 
+	config.clientOpts.AddFlags(pf)
+
 	goflags := flag.NewFlagSet("klog", flag.ExitOnError)
 	klog.InitFlags(goflags)
 	config.zapOpts.BindFlags(goflags)
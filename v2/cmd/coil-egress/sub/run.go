@@ -10,6 +10,7 @@ import (
 	"github.com/cybozu-go/coil/v2/controllers"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
 	"github.com/cybozu-go/coil/v2/pkg/founat"
+	"github.com/cybozu-go/coil/v2/pkg/loglevel"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -34,6 +35,7 @@ func init() {
 }
 
 func subMain() error {
+	logLevel := loglevel.Setup(&config.zapOpts)
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&config.zapOpts)))
 
 	myNS := os.Getenv(constants.EnvPodNamespace)
@@ -65,8 +67,13 @@ func subMain() error {
 
 	setupLog.Info("detected local IP addresses", "ipv4", ipv4.String(), "ipv6", ipv6.String())
 
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return err
+	}
+
 	timeout := gracefulTimeout
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                  scheme,
 		LeaderElection:          false,
 		MetricsBindAddress:      config.metricsAddr,
@@ -83,6 +90,9 @@ func subMain() error {
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		return err
 	}
+	if err := mgr.AddMetricsExtraHandler("/debug/loglevel", loglevel.Handler(logLevel)); err != nil {
+		return err
+	}
 
 	ft := founat.NewFoUTunnel(config.port, ipv4, ipv6)
 	if err := ft.Init(); err != nil {
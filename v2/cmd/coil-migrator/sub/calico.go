@@ -0,0 +1,109 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cybozu-go/netutil"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var calicoIPAMBlockGVK = schema.GroupVersionKind{
+	Group:   "crd.projectcalico.org",
+	Version: "v1",
+	Kind:    "IPAMBlockList",
+}
+
+// readCalicoBlocks returns the addresses allocated by Calico IPAM for Pods.
+// Calico must use the Kubernetes API datastore.
+// If `node` is not empty, only the addresses of blocks affine to the node are returned.
+func readCalicoBlocks(ctx context.Context, r client.Reader, node string) ([]usedAddress, error) {
+	blocks := &unstructured.UnstructuredList{}
+	blocks.SetGroupVersionKind(calicoIPAMBlockGVK)
+	if err := r.List(ctx, blocks); err != nil {
+		return nil, fmt.Errorf("failed to list Calico IPAM blocks: %w", err)
+	}
+
+	var addrs []usedAddress
+	for _, b := range blocks.Items {
+		l, err := calicoBlockAddresses(b.Object)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPAM block %s: %w", b.GetName(), err)
+		}
+		for _, a := range l {
+			if node != "" && a.node != node {
+				continue
+			}
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs, nil
+}
+
+// calicoBlockAddresses returns the addresses allocated in a Calico IPAMBlock.
+//
+// Addresses allocated in blocks without host affinity, and those not for Pods
+// such as tunnel addresses of the nodes, are not returned.
+func calicoBlockAddresses(obj map[string]interface{}) ([]usedAddress, error) {
+	affinity, _, err := unstructured.NestedString(obj, "spec", "affinity")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(affinity, "host:") {
+		return nil, nil
+	}
+	node := affinity[len("host:"):]
+
+	cidr, _, err := unstructured.NestedString(obj, "spec", "cidr")
+	if err != nil {
+		return nil, err
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip4 := subnet.IP.To4(); ip4 != nil {
+		subnet.IP = ip4
+	}
+
+	allocations, _, err := unstructured.NestedSlice(obj, "spec", "allocations")
+	if err != nil {
+		return nil, err
+	}
+	attributes, _, err := unstructured.NestedSlice(obj, "spec", "attributes")
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []usedAddress
+	for ordinal, a := range allocations {
+		// allocations are indices to attributes, or null for free addresses.
+		if a == nil {
+			continue
+		}
+		idx, ok := a.(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid allocation: %v", a)
+		}
+		if idx < 0 || int(idx) >= len(attributes) {
+			return nil, fmt.Errorf("allocation out of range: %d", idx)
+		}
+		attr, _ := attributes[idx].(map[string]interface{})
+		handle, _, _ := unstructured.NestedString(attr, "handle_id")
+		if !strings.HasPrefix(handle, "k8s-pod-network.") {
+			continue
+		}
+
+		ip := netutil.IPAdd(subnet.IP, int64(ordinal))
+		if !subnet.Contains(ip) {
+			return nil, fmt.Errorf("allocation %d exceeds %s", ordinal, cidr)
+		}
+		addrs = append(addrs, usedAddress{node: node, ip: ip})
+	}
+	return addrs, nil
+}
@@ -0,0 +1,53 @@
+package sub
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCalicoBlockAddresses(t *testing.T) {
+	t.Parallel()
+
+	block := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"cidr":     "10.2.0.0/30",
+			"affinity": "host:node1",
+			"allocations": []interface{}{
+				int64(0), nil, int64(1), int64(2),
+			},
+			"attributes": []interface{}{
+				map[string]interface{}{"handle_id": "ipip-tunnel-addr-node1"},
+				map[string]interface{}{"handle_id": "k8s-pod-network.abc"},
+				map[string]interface{}{"handle_id": "k8s-pod-network.def"},
+			},
+		},
+	}
+
+	addrs, err := calicoBlockAddresses(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+	for i, expected := range []string{"10.2.0.2", "10.2.0.3"} {
+		if addrs[i].node != "node1" || !addrs[i].ip.Equal(net.ParseIP(expected)) {
+			t.Errorf("addrs[%d] = %v, expected %s on node1", i, addrs[i], expected)
+		}
+	}
+
+	block["spec"].(map[string]interface{})["affinity"] = "virtual:borrowed"
+	addrs, err = calicoBlockAddresses(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 0 {
+		t.Error("addresses in blocks without host affinity should be ignored:", addrs)
+	}
+
+	block["spec"].(map[string]interface{})["affinity"] = "host:node1"
+	block["spec"].(map[string]interface{})["allocations"] = []interface{}{int64(5)}
+	if _, err := calicoBlockAddresses(block); err == nil {
+		t.Error("invalid allocations should be an error")
+	}
+}
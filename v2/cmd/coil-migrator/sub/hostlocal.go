@@ -0,0 +1,34 @@
+package sub
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// readHostLocal returns the addresses recorded in the data directory of
+// host-local IPAM plugin.  host-local creates a file named after each
+// allocated address in the directory.
+func readHostLocal(dir string) ([]net.IP, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var ips []net.IP
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		// other files such as "lock" and "last_reserved_ip.0" are ignored.
+		ip := net.ParseIP(fi.Name())
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
@@ -0,0 +1,40 @@
+package sub
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadHostLocal(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"10.2.0.3", "fd02::4", "lock", "last_reserved_ip.0"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("container\neth0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "10.2.0.9"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := readHostLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 {
+		t.Fatal("unexpected addresses:", ips)
+	}
+	if !ips[0].Equal(net.ParseIP("10.2.0.3")) || len(ips[0]) != net.IPv4len {
+		t.Error("unexpected IPv4 address:", ips[0])
+	}
+	if !ips[1].Equal(net.ParseIP("fd02::4")) {
+		t.Error("unexpected IPv6 address:", ips[1])
+	}
+
+	if _, err := readHostLocal(filepath.Join(dir, "none")); err == nil {
+		t.Error("reading a missing directory should fail")
+	}
+}
@@ -0,0 +1,152 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	sourceHostLocal = "host-local"
+	sourceCalico    = "calico"
+)
+
+var importConfig struct {
+	from    string
+	node    string
+	dataDir string
+	dryRun  bool
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "import addresses allocated by other IPAMs",
+	Long: `Import addresses allocated by other IPAMs into Coil.
+
+This creates reserved AddressBlocks that cover the addresses used by running
+Pods so that Coil never assigns them to other Pods.  The blocks are assigned
+to the nodes where the addresses are used.
+
+Supported IPAMs are:
+
+- host-local: reads the data directory of host-local on the node specified by --node.
+- calico: reads IPAM blocks of Calico using the Kubernetes API datastore.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runImport(context.Background(), cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	pf := importCmd.Flags()
+	pf.StringVar(&importConfig.from, "from", "", "IPAM to import from: host-local or calico")
+	pf.StringVar(&importConfig.node, "node", "", "node name; required for host-local")
+	pf.StringVar(&importConfig.dataDir, "data-dir", "", "data directory of host-local such as /var/lib/cni/networks/NAME")
+	pf.BoolVar(&importConfig.dryRun, "dry-run", false, "print AddressBlocks to be created in YAML without creating them")
+	importCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(importCmd)
+}
+
+func runImport(ctx context.Context, w io.Writer) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var addrs []usedAddress
+	switch importConfig.from {
+	case sourceHostLocal:
+		if importConfig.node == "" || importConfig.dataDir == "" {
+			return errors.New("--node and --data-dir are required for host-local")
+		}
+		ips, err := readHostLocal(importConfig.dataDir)
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, usedAddress{node: importConfig.node, ip: ip})
+		}
+	case sourceCalico:
+		addrs, err = readCalicoBlocks(ctx, c, importConfig.node)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported IPAM: %s", importConfig.from)
+	}
+
+	pools := &coilv2.AddressPoolList{}
+	if err := c.List(ctx, pools); err != nil {
+		return err
+	}
+	blocks, err := planBlocks(pools.Items, addrs)
+	if err != nil {
+		return err
+	}
+
+	if importConfig.dryRun {
+		return printBlocks(w, blocks)
+	}
+	return createBlocks(ctx, c, w, blocks)
+}
+
+func printBlocks(w io.Writer, blocks []*coilv2.AddressBlock) error {
+	for _, b := range blocks {
+		b.APIVersion = coilv2.GroupVersion.String()
+		b.Kind = "AddressBlock"
+		data, err := yaml.Marshal(b)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBlocks creates `blocks`.  Blocks that have already been imported are skipped.
+func createBlocks(ctx context.Context, c client.Client, w io.Writer, blocks []*coilv2.AddressBlock) error {
+	for _, b := range blocks {
+		current := &coilv2.AddressBlock{}
+		err := c.Get(ctx, client.ObjectKey{Name: b.Name}, current)
+		switch {
+		case err == nil:
+			if current.Labels[constants.LabelReserved] != "true" || current.Labels[constants.LabelNode] != b.Labels[constants.LabelNode] {
+				return fmt.Errorf("block %s already exists for node %s", b.Name, current.Labels[constants.LabelNode])
+			}
+			fmt.Fprintf(w, "skipped %s: already imported\n", b.Name)
+			continue
+		case !apierrors.IsNotFound(err):
+			return err
+		}
+
+		if err := c.Create(ctx, b); err != nil {
+			return fmt.Errorf("failed to create %s: %w", b.Name, err)
+		}
+		fmt.Fprintf(w, "created %s for node %s (%s)\n", b.Name, b.Labels[constants.LabelNode], blockRanges(b))
+	}
+	return nil
+}
+
+func blockRanges(b *coilv2.AddressBlock) string {
+	var s []string
+	if b.IPv4 != nil {
+		s = append(s, *b.IPv4)
+	}
+	if b.IPv6 != nil {
+		s = append(s, *b.IPv6)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,136 @@
+package sub
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/netutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// usedAddress is an address used by a Pod on a node.
+type usedAddress struct {
+	node string
+	ip   net.IP
+}
+
+// findBlock returns the index of the block in `ap` that contains `ip`.
+// If no subnet of `ap` contains `ip`, this returns false.
+func findBlock(ap *coilv2.AddressPool, ip net.IP) (uint, bool) {
+	var currentIndex uint
+	for _, ss := range ap.Spec.Subnets {
+		var subnets []*net.IPNet
+		if ss.IPv4 != nil {
+			_, n, _ := net.ParseCIDR(*ss.IPv4) // ss was validated
+			subnets = append(subnets, n)
+		}
+		if ss.IPv6 != nil {
+			_, n, _ := net.ParseCIDR(*ss.IPv6) // ss was validated
+			subnets = append(subnets, n)
+		}
+
+		ones, bits := subnets[0].Mask.Size()
+		size := uint(1) << (bits - ones - int(ap.Spec.BlockSizeBits))
+		for _, n := range subnets {
+			if !n.Contains(ip) {
+				continue
+			}
+			offset := netutil.IPDiff(n.IP, ip)
+			return currentIndex + uint(offset>>ap.Spec.BlockSizeBits), true
+		}
+		currentIndex += size
+	}
+	return 0, false
+}
+
+// blockOf returns the SubnetSet and the index in it of the block `index` of `ap`.
+func blockOf(ap *coilv2.AddressPool, index uint) (coilv2.SubnetSet, uint) {
+	for _, ss := range ap.Spec.Subnets {
+		var n *net.IPNet
+		if ss.IPv4 != nil {
+			_, n, _ = net.ParseCIDR(*ss.IPv4)
+		} else {
+			_, n, _ = net.ParseCIDR(*ss.IPv6)
+		}
+		ones, bits := n.Mask.Size()
+		size := uint(1) << (bits - ones - int(ap.Spec.BlockSizeBits))
+		if index < size {
+			return ss, index
+		}
+		index -= size
+	}
+	panic("block index out of range")
+}
+
+// planBlocks returns reserved AddressBlocks that cover `addrs`.
+//
+// The returned blocks are labeled with the node where the addresses are used.
+// They have no finalizer so that they can be deleted after the Pods are replaced.
+// It is an error if an address is not in any pool, or if a block would
+// contain addresses used on different nodes.
+func planBlocks(pools []coilv2.AddressPool, addrs []usedAddress) ([]*coilv2.AddressBlock, error) {
+	type blockKey struct {
+		pool  int
+		index uint
+	}
+	nodes := make(map[blockKey]string)
+	for _, a := range addrs {
+		found := false
+		for i := range pools {
+			index, ok := findBlock(&pools[i], a.ip)
+			if !ok {
+				continue
+			}
+			found = true
+			key := blockKey{pool: i, index: index}
+			if n, ok := nodes[key]; ok && n != a.node {
+				return nil, fmt.Errorf("block %s-%d would contain addresses of both %s and %s", pools[i].Name, index, n, a.node)
+			}
+			nodes[key] = a.node
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("address %s on node %s is not in any pool", a.ip, a.node)
+		}
+	}
+
+	var blocks []*coilv2.AddressBlock
+	for key, node := range nodes {
+		ap := &pools[key.pool]
+		ss, n := blockOf(ap, key.index)
+		ipv4, ipv6 := ss.GetBlock(n, int(ap.Spec.BlockSizeBits))
+
+		b := &coilv2.AddressBlock{}
+		b.Name = fmt.Sprintf("%s-%d", ap.Name, key.index)
+		if err := controllerutil.SetControllerReference(ap, b, scheme); err != nil {
+			return nil, err
+		}
+		b.Labels = map[string]string{
+			constants.LabelPool:     ap.Name,
+			constants.LabelNode:     node,
+			constants.LabelReserved: "true",
+		}
+		b.Index = int32(key.index)
+		if ipv4 != nil {
+			s := ipv4.String()
+			b.IPv4 = &s
+		}
+		if ipv6 != nil {
+			s := ipv6.String()
+			b.IPv6 = &s
+		}
+		blocks = append(blocks, b)
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		pi, pj := blocks[i].Labels[constants.LabelPool], blocks[j].Labels[constants.LabelPool]
+		if pi != pj {
+			return pi < pj
+		}
+		return blocks[i].Index < blocks[j].Index
+	})
+	return blocks, nil
+}
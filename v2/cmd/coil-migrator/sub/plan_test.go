@@ -0,0 +1,124 @@
+package sub
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func testPools() []coilv2.AddressPool {
+	p1 := coilv2.AddressPool{}
+	p1.Name = "default"
+	p1.UID = "uid-default"
+	p1.Spec.BlockSizeBits = 4
+	p1.Spec.Subnets = []coilv2.SubnetSet{
+		{IPv4: strPtr("10.2.0.0/24")},
+		{IPv4: strPtr("10.3.0.0/28"), IPv6: strPtr("fd03::/124")},
+	}
+
+	p2 := coilv2.AddressPool{}
+	p2.Name = "v6"
+	p2.UID = "uid-v6"
+	p2.Spec.BlockSizeBits = 5
+	p2.Spec.Subnets = []coilv2.SubnetSet{
+		{IPv6: strPtr("fd02::/120")},
+	}
+	return []coilv2.AddressPool{p1, p2}
+}
+
+func TestPlanBlocks(t *testing.T) {
+	t.Parallel()
+
+	pools := testPools()
+	blocks, err := planBlocks(pools, []usedAddress{
+		{node: "node1", ip: net.ParseIP("10.2.0.33").To4()},
+		{node: "node1", ip: net.ParseIP("10.2.0.47").To4()},
+		{node: "node2", ip: net.ParseIP("10.2.0.2").To4()},
+		{node: "node2", ip: net.ParseIP("fd03::5")},
+		{node: "node3", ip: net.ParseIP("fd02::41")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name string
+		node string
+		ipv4 string
+		ipv6 string
+	}{
+		{"default-0", "node2", "10.2.0.0/28", ""},
+		{"default-2", "node1", "10.2.0.32/28", ""},
+		{"default-16", "node2", "10.3.0.0/28", "fd03::/124"},
+		{"v6-2", "node3", "", "fd02::40/123"},
+	}
+	if len(blocks) != len(expected) {
+		t.Fatalf("unexpected number of blocks: %d", len(blocks))
+	}
+	for i, e := range expected {
+		b := blocks[i]
+		if b.Name != e.name {
+			t.Errorf("blocks[%d].Name = %s, expected %s", i, b.Name, e.name)
+		}
+		if b.Labels[constants.LabelNode] != e.node {
+			t.Errorf("%s: unexpected node %s", b.Name, b.Labels[constants.LabelNode])
+		}
+		if b.Labels[constants.LabelReserved] != "true" {
+			t.Errorf("%s: not reserved", b.Name)
+		}
+		if (b.IPv4 == nil && e.ipv4 != "") || (b.IPv4 != nil && *b.IPv4 != e.ipv4) {
+			t.Errorf("%s: unexpected IPv4 %v", b.Name, b.IPv4)
+		}
+		if (b.IPv6 == nil && e.ipv6 != "") || (b.IPv6 != nil && *b.IPv6 != e.ipv6) {
+			t.Errorf("%s: unexpected IPv6 %v", b.Name, b.IPv6)
+		}
+		if len(b.OwnerReferences) != 1 || b.OwnerReferences[0].Name != b.Labels[constants.LabelPool] {
+			t.Errorf("%s: unexpected owner references %+v", b.Name, b.OwnerReferences)
+		}
+	}
+}
+
+func TestPlanBlocksError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		addrs []usedAddress
+		msg   string
+	}{
+		{
+			name:  "not in pools",
+			addrs: []usedAddress{{node: "node1", ip: net.ParseIP("10.4.0.1").To4()}},
+			msg:   "not in any pool",
+		},
+		{
+			name: "shared block",
+			addrs: []usedAddress{
+				{node: "node1", ip: net.ParseIP("10.2.0.1").To4()},
+				{node: "node2", ip: net.ParseIP("10.2.0.15").To4()},
+			},
+			msg: "both node1 and node2",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := planBlocks(testPools(), tc.addrs)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.msg) {
+				t.Error("unexpected error:", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package sub
+
+import (
+	"fmt"
+	"os"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/clientconfig"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(coilv2.AddToScheme(scheme))
+}
+
+var config struct {
+	clientOpts clientconfig.Options
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "coil-migrator",
+	Short: "migrate IP address assignments to Coil",
+	Long: `coil-migrator helps to migrate clusters from other IPAMs to Coil
+without restarting running Pods.`,
+	Version: v2.Version(),
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	config.clientOpts.AddFlags(rootCmd.PersistentFlags())
+}
+
+func newClient() (client.Client, error) {
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
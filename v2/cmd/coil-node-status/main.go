@@ -0,0 +1,7 @@
+package main
+
+import "github.com/cybozu-go/coil/v2/cmd/coil-node-status/sub"
+
+func main() {
+	sub.Execute()
+}
@@ -0,0 +1,161 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var config struct {
+	socketPath string
+	tokenFile  string
+	output     string
+	timeout    time.Duration
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "coil-node-status",
+	Short: "show the status of coild on this node",
+	Long: `coil-node-status shows the status of coild on this node for triage.
+
+It prints the address blocks of the node with the number of allocated
+addresses and whether their routes are exported, and the last errors
+returned by coild.  Run it on the node or in the coild Pod.`,
+	Version: v2.Version(),
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return run(cmd.OutOrStdout())
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	fs := rootCmd.Flags()
+	fs.StringVar(&config.socketPath, "socket", constants.DefaultSocketPath, "UNIX domain socket path of coild")
+	fs.StringVar(&config.tokenFile, "token-file", "", "file of a service account token sent to coild")
+	fs.StringVarP(&config.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&config.timeout, "timeout", 10*time.Second, "timeout of the request to coild")
+}
+
+func run(w io.Writer) error {
+	if config.output != "text" && config.output != "json" {
+		return fmt.Errorf("unknown output format: %s", config.output)
+	}
+
+	dialer := &net.Dialer{}
+	dialFunc := func(ctx context.Context, a string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", a)
+	}
+	conn, err := grpc.Dial(config.socketPath, grpc.WithInsecure(), grpc.WithContextDialer(dialFunc))
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", config.socketPath, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.timeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, cnirpc.APIVersionKey, strconv.Itoa(cnirpc.APIVersion))
+	if config.tokenFile != "" {
+		data, err := os.ReadFile(config.tokenFile)
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+strings.TrimSpace(string(data)))
+	}
+
+	resp, err := cnirpc.NewCNIClient(conn).NodeStatus(ctx, &emptypb.Empty{})
+	if err != nil {
+		return fmt.Errorf("failed to get the status of coild: %w", err)
+	}
+
+	if config.output == "json" {
+		data, err := protojson.MarshalOptions{Multiline: true, UseProtoNames: true, EmitUnpopulated: true}.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	return writeStatus(w, resp)
+}
+
+func writeStatus(w io.Writer, resp *cnirpc.NodeStatusResponse) error {
+	fmt.Fprintf(w, "Node:       %s\n", resp.Node)
+	fmt.Fprintf(w, "Version:    %s\n", resp.Version)
+	fmt.Fprintf(w, "Read-only:  %t\n", resp.ReadOnly)
+
+	var allocated, capacity uint32
+	var missing []string
+	for _, b := range resp.Blocks {
+		allocated += b.Allocated
+		capacity += b.Capacity
+		if !b.Quarantined && !b.RouteExported {
+			missing = append(missing, b.Name)
+		}
+	}
+	fmt.Fprintf(w, "Addresses:  %d/%d allocated in %d blocks\n", allocated, capacity, len(resp.Blocks))
+	if len(missing) > 0 {
+		fmt.Fprintf(w, "Routes:     %d exported, missing for %s\n", len(resp.ExportedRoutes), strings.Join(missing, ","))
+	} else {
+		fmt.Fprintf(w, "Routes:     %d exported\n", len(resp.ExportedRoutes))
+	}
+
+	if len(resp.Blocks) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "BLOCK\tPOOL\tSUBNETS\tALLOCATED\tCAPACITY\tROUTE")
+		for _, b := range resp.Blocks {
+			route := "exported"
+			switch {
+			case b.Quarantined:
+				route = "quarantined"
+			case !b.RouteExported:
+				route = "missing"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", b.Name, b.Pool, strings.Join(b.Subnets, ","), b.Allocated, b.Capacity, route)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(w)
+	if len(resp.Errors) == 0 {
+		fmt.Fprintln(w, "No errors since coild started.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tMETHOD\tPOD\tERROR")
+	for _, e := range resp.Errors {
+		pod := e.Pod
+		if pod == "" {
+			pod = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Time.AsTime().UTC().Format(time.RFC3339), e.Method, pod, e.Message)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,80 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+
+	resp := &cnirpc.NodeStatusResponse{
+		Node:    "node1",
+		Version: "2.0.14",
+		Blocks: []*cnirpc.NodeBlock{
+			{Name: "default-0", Pool: "default", Subnets: []string{"10.64.0.0/27", "fd02::/123"}, Allocated: 3, Capacity: 32, RouteExported: true},
+			{Name: "default-5", Pool: "default", Subnets: []string{"10.64.0.160/27"}, Capacity: 32},
+			{Name: "global-1", Pool: "global", Subnets: []string{"103.79.16.0/32"}, Allocated: 1, Capacity: 1, Quarantined: true},
+		},
+		ExportedRoutes: []string{"10.64.0.0/27", "fd02::/123"},
+		Errors: []*cnirpc.NodeError{
+			{Time: timestamppb.New(time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)), Method: "Add", Pod: "ns1/pod1", Message: "failed to allocate address: out of blocks"},
+			{Time: timestamppb.New(time.Date(2021, 4, 1, 11, 0, 0, 0, time.UTC)), Method: "SetReadOnly", Message: "denied"},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeStatus(buf, resp); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"Node:       node1\n",
+		"Addresses:  4/65 allocated in 3 blocks\n",
+		"Routes:     2 exported, missing for default-5\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("%q is not in the output:\n%s", expected, out)
+		}
+	}
+
+	lines := strings.Split(out, "\n")
+	find := func(prefix string) string {
+		for _, l := range lines {
+			if strings.HasPrefix(l, prefix) {
+				return strings.Join(strings.Fields(l), " ")
+			}
+		}
+		t.Fatalf("no line starting with %s:\n%s", prefix, out)
+		return ""
+	}
+	if l := find("default-0 "); l != "default-0 default 10.64.0.0/27,fd02::/123 3 32 exported" {
+		t.Error("unexpected line:", l)
+	}
+	if l := find("default-5 "); l != "default-5 default 10.64.0.160/27 0 32 missing" {
+		t.Error("unexpected line:", l)
+	}
+	if l := find("global-1 "); l != "global-1 global 103.79.16.0/32 1 1 quarantined" {
+		t.Error("unexpected line:", l)
+	}
+	if l := find("2021-04-01T12:00:00Z"); l != "2021-04-01T12:00:00Z Add ns1/pod1 failed to allocate address: out of blocks" {
+		t.Error("unexpected line:", l)
+	}
+	if l := find("2021-04-01T11:00:00Z"); l != "2021-04-01T11:00:00Z SetReadOnly - denied" {
+		t.Error("unexpected line:", l)
+	}
+
+	buf.Reset()
+	if err := writeStatus(buf, &cnirpc.NodeStatusResponse{Node: "node2"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No errors since coild started.") || strings.Contains(buf.String(), "BLOCK") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
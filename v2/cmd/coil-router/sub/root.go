@@ -7,6 +7,7 @@ import (
 	"time"
 
 	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/clientconfig"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -17,6 +18,7 @@ var config struct {
 	healthAddr     string
 	protocolId     int
 	updateInterval time.Duration
+	clientOpts     clientconfig.Options
 	zapOpts        zap.Options
 }
 
@@ -53,6 +55,8 @@ func init() {
 	pf.IntVar(&config.protocolId, "protocol-id", 31, "route author ID")
 	pf.DurationVar(&config.updateInterval, "update-interval", 10*time.Minute, "interval for forced route update")
 
+	config.clientOpts.AddFlags(pf)
+
 	goflags := flag.NewFlagSet("klog", flag.ExitOnError)
 	klog.InitFlags(goflags)
 	config.zapOpts.BindFlags(goflags)
@@ -8,6 +8,7 @@ import (
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/controllers"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/loglevel"
 	"github.com/cybozu-go/coil/v2/pkg/nodenet"
 	"github.com/cybozu-go/coil/v2/runners"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,6 +36,7 @@ func init() {
 }
 
 func subMain() error {
+	logLevel := loglevel.Setup(&config.zapOpts)
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&config.zapOpts)))
 
 	nodeName := os.Getenv(constants.EnvNode)
@@ -42,8 +44,13 @@ func subMain() error {
 		return errors.New(constants.EnvNode + " environment variable must be set")
 	}
 
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return err
+	}
+
 	timeout := gracefulTimeout
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                  scheme,
 		LeaderElection:          false,
 		MetricsBindAddress:      config.metricsAddr,
@@ -60,6 +67,9 @@ func subMain() error {
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		return err
 	}
+	if err := mgr.AddMetricsExtraHandler("/debug/loglevel", loglevel.Handler(logLevel)); err != nil {
+		return err
+	}
 
 	notifyCh := make(chan struct{}, 1)
 	abr := &controllers.AddressBlockReconciler{Notify: notifyCh}
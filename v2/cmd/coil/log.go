@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+// logEntry is a log of a CNI command written as a JSON line.
+type logEntry struct {
+	Time            time.Time       `json:"time"`
+	Command         string          `json:"command"`
+	ContainerID     string          `json:"container_id"`
+	Netns           string          `json:"netns,omitempty"`
+	Ifname          string          `json:"ifname"`
+	PodNamespace    string          `json:"pod_namespace,omitempty"`
+	PodName         string          `json:"pod_name,omitempty"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Recovered       bool            `json:"recovered,omitempty"`
+	Cached          bool            `json:"cached,omitempty"`
+	Queued          bool            `json:"queued,omitempty"`
+	Error           *types.Error    `json:"error,omitempty"`
+}
+
+func newLogEntry(command string, args *skel.CmdArgs) *logEntry {
+	e := &logEntry{
+		Time:        time.Now().UTC(),
+		Command:     command,
+		ContainerID: args.ContainerID,
+		Netns:       args.Netns,
+		Ifname:      args.IfName,
+	}
+	env := &PluginEnvArgs{}
+	if err := types.LoadArgs(args.Args, env); err == nil {
+		e.PodNamespace = string(env.K8S_POD_NAMESPACE)
+		e.PodName = string(env.K8S_POD_NAME)
+	}
+	return e
+}
+
+// finish records the duration and the error returned to the container runtime.
+func (e *logEntry) finish(err error) {
+	e.DurationSeconds = time.Since(e.Time).Seconds()
+	if err == nil {
+		return
+	}
+	cniErr, ok := err.(*types.Error)
+	if !ok {
+		// skel returns other errors in the same way.
+		cniErr = types.NewError(types.ErrInternal, err.Error(), "")
+	}
+	e.Error = cniErr
+}
+
+// writeLog appends `e` to the log file of `conf` if configured.
+// Failures are ignored because logs must not fail CNI commands.
+func writeLog(conf *PluginConf, e *logEntry) {
+	if conf.LogFile == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	appendLog(conf.LogFile, int64(conf.LogMaxSize)*1024*1024, conf.LogMaxBackups, append(data, '\n'))
+}
+
+// maxLogAttempts limits attempts to open the log file rotated by other processes.
+const maxLogAttempts = 3
+
+// appendLog appends `line` to the file at `path`.
+// If the file would become larger than `maxSize` bytes, it is rotated
+// keeping at most `maxBackups` old files as `path`.1, `path`.2, and so on.
+//
+// Multiple plugin processes run concurrently, so the file is locked
+// while it is written or rotated.
+func appendLog(path string, maxSize int64, maxBackups int, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	for i := 0; i < maxLogAttempts; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		done, err := appendLocked(f, path, maxSize, maxBackups, line)
+		f.Close()
+		if done || err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to open %s", path)
+}
+
+// appendLocked writes `line` to `f` with the lock held.
+// It returns false if `f` needs to be reopened because it has been rotated.
+func appendLocked(f *os.File, path string, maxSize int64, maxBackups int, line []byte) (bool, error) {
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return false, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	// other processes may have rotated the file while waiting for the lock.
+	if pi, err := os.Stat(path); err != nil || !os.SameFile(fi, pi) {
+		return false, nil
+	}
+
+	if fi.Size() > 0 && fi.Size()+int64(len(line)) > maxSize {
+		return false, rotateLog(path, maxBackups)
+	}
+	_, err = f.Write(line)
+	return true, err
+}
+
+func rotateLog(path string, maxBackups int) error {
+	if maxBackups <= 0 {
+		return os.Remove(path)
+	}
+	for i := maxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
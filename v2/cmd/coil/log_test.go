@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+func TestAppendLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log", "cni.log")
+
+	line := []byte(strings.Repeat("a", 9) + "\n")
+	for i := 0; i < 5; i++ {
+		if err := appendLog(path, 25, 2, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 2 lines fit in 25 bytes, so 5 lines are written to 3 files.
+	expected := map[string]int{
+		path:        1,
+		path + ".1": 2,
+		path + ".2": 2,
+	}
+	for p, n := range expected {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, bytes.Repeat(line, n)) {
+			t.Errorf("%s should have %d lines: %q", p, n, data)
+		}
+	}
+
+	// the oldest file is removed.
+	for i := 0; i < 2; i++ {
+		if err := appendLog(path, 25, 2, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("more than 2 backups should not be kept:", err)
+	}
+
+	// without backups, the file is truncated.
+	path2 := filepath.Join(dir, "nobackup.log")
+	for i := 0; i < 3; i++ {
+		if err := appendLog(path2, 15, 0, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, line) {
+		t.Errorf("unexpected content: %q", data)
+	}
+	if _, err := os.Stat(path2 + ".1"); !os.IsNotExist(err) {
+		t.Error("no backups should be kept:", err)
+	}
+}
+
+func TestWriteLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cni.log")
+	conf := &PluginConf{LogFile: path, LogMaxSize: 1, LogMaxBackups: 1}
+	args := &skel.CmdArgs{
+		ContainerID: "abc",
+		Netns:       "/run/netns/test",
+		IfName:      "eth0",
+		Args:        "IgnoreUnknown=1;K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod1",
+	}
+
+	e := newLogEntry("ADD", args)
+	e.Result = json.RawMessage(`{"cniVersion":"1.0.0"}`)
+	e.finish(nil)
+	writeLog(conf, e)
+
+	e = newLogEntry("DEL", args)
+	e.finish(types.NewError(types.ErrTryAgainLater, "coild is not available", "connection refused"))
+	writeLog(conf, e)
+
+	e = newLogEntry("CHECK", args)
+	e.finish(errors.New("failed"))
+	writeLog(conf, e)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %s", len(lines), data)
+	}
+
+	var entries [3]map[string]interface{}
+	for i, l := range lines {
+		if err := json.Unmarshal([]byte(l), &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries[0]["command"] != "ADD" || entries[0]["pod_namespace"] != "ns1" || entries[0]["pod_name"] != "pod1" {
+		t.Error("unexpected ADD entry:", lines[0])
+	}
+	if _, ok := entries[0]["result"]; !ok || entries[0]["error"] != nil {
+		t.Error("ADD entry should have the result:", lines[0])
+	}
+	if _, ok := entries[0]["duration_seconds"]; !ok {
+		t.Error("entry should have the duration:", lines[0])
+	}
+	errEntry, _ := entries[1]["error"].(map[string]interface{})
+	if errEntry["code"] != float64(types.ErrTryAgainLater) || errEntry["details"] != "connection refused" {
+		t.Error("unexpected DEL entry:", lines[1])
+	}
+	errEntry, _ = entries[2]["error"].(map[string]interface{})
+	if errEntry["code"] != float64(types.ErrInternal) || errEntry["msg"] != "failed" {
+		t.Error("unexpected CHECK entry:", lines[2])
+	}
+
+	// no log file is written without log_file.
+	writeLog(&PluginConf{}, e)
+}
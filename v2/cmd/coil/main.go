@@ -1,108 +1,142 @@
 package main
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
 	v2 "github.com/cybozu-go/coil/v2"
-	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/coildclient"
 )
 
-const rpcTimeout = 1 * time.Minute
-
-func cmdAdd(args *skel.CmdArgs) error {
+func cmdAdd(args *skel.CmdArgs) (err error) {
 	conf, err := parseConfig(args.StdinData)
 	if err != nil {
 		return err
 	}
 
+	entry := newLogEntry("ADD", args)
+	defer func() {
+		entry.finish(err)
+		writeLog(conf, entry)
+	}()
+
 	if conf.PrevResult != nil {
 		return types.NewError(types.ErrInvalidNetworkConfig, "coil must be called as the first plugin", "")
 	}
 
-	cniArgs, err := makeCNIArgs(args)
+	req, err := makeRequest(args)
 	if err != nil {
 		return err
 	}
 
-	conn, err := connect(conf.Socket)
+	client, err := coildclient.New(conf.Socket, conf.TokenFile)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
-	defer conn.Close()
+	defer client.Close()
 
-	client := cnirpc.NewCNIClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	ctx, cancel := conf.commandContext()
 	defer cancel()
 
-	resp, err := client.Add(ctx, cniArgs)
-	if err != nil {
-		return convertError(err)
+	// A duplicate ADD, for example after kubelet restarts, receives the
+	// cached result as long as the Pod network is still there.
+	if result := cachedResult(conf.ResultCacheDir, req); result != nil {
+		if err := client.Check(ctx, req); err == nil {
+			entry.Cached = true
+			if data, err := json.Marshal(result); err == nil {
+				entry.Result = json.RawMessage(data)
+			}
+			return types.PrintResult(result, conf.CNIVersion)
+		}
+		forgetResult(conf.ResultCacheDir, req)
 	}
 
-	result, err := current.NewResult(resp.Result)
+	alloc, err := client.NewIP(ctx, req)
 	if err != nil {
-		return types.NewError(types.ErrDecodingFailure, "failed to unmarshal result", err.Error())
+		return convertError(err)
+	}
+	entry.Recovered = alloc.Recovered
+	if data, err := json.Marshal(alloc.Result); err == nil {
+		entry.Result = json.RawMessage(data)
 	}
+	cacheResult(conf.ResultCacheDir, req, alloc.Result)
 
-	return types.PrintResult(result, conf.CNIVersion)
+	return types.PrintResult(alloc.Result, conf.CNIVersion)
 }
 
-func cmdDel(args *skel.CmdArgs) error {
+func cmdDel(args *skel.CmdArgs) (err error) {
 	conf, err := parseConfig(args.StdinData)
 	if err != nil {
 		return err
 	}
 
-	cniArgs, err := makeCNIArgs(args)
+	entry := newLogEntry("DEL", args)
+	defer func() {
+		entry.finish(err)
+		writeLog(conf, entry)
+	}()
+
+	req, err := makeRequest(args)
 	if err != nil {
 		return err
 	}
 
-	conn, err := connect(conf.Socket)
+	forgetResult(conf.ResultCacheDir, req)
+
+	client, err := coildclient.New(conf.Socket, conf.TokenFile)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
-	defer conn.Close()
+	defer client.Close()
 
-	client := cnirpc.NewCNIClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	ctx, cancel := conf.commandContext()
 	defer cancel()
 
-	if _, err = client.Del(ctx, cniArgs); err != nil {
+	err = client.FreeIP(ctx, req)
+	if err != nil && coildclient.IsTransient(err) {
+		// coild will free the addresses when it becomes available.
+		err = enqueueFree(conf.FreeQueueDir, req, err)
+		entry.Queued = err == nil
+		return err
+	}
+	if err != nil {
 		return convertError(err)
 	}
 
 	return nil
 }
 
-func cmdCheck(args *skel.CmdArgs) error {
+func cmdCheck(args *skel.CmdArgs) (err error) {
 	conf, err := parseConfig(args.StdinData)
 	if err != nil {
 		return err
 	}
 
-	cniArgs, err := makeCNIArgs(args)
+	entry := newLogEntry("CHECK", args)
+	defer func() {
+		entry.finish(err)
+		writeLog(conf, entry)
+	}()
+
+	req, err := makeRequest(args)
 	if err != nil {
 		return err
 	}
 
-	conn, err := connect(conf.Socket)
+	client, err := coildclient.New(conf.Socket, conf.TokenFile)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
-	defer conn.Close()
+	defer client.Close()
 
-	client := cnirpc.NewCNIClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	ctx, cancel := conf.commandContext()
 	defer cancel()
 
-	if _, err = client.Check(ctx, cniArgs); err != nil {
+	err = client.Check(ctx, req)
+	if err != nil {
 		return convertError(err)
 	}
 
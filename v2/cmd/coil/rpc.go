@@ -1,59 +1,103 @@
 package main
 
 import (
-	"context"
-	"net"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/cybozu-go/coil/v2/pkg/coildclient"
+	"github.com/cybozu-go/coil/v2/pkg/freequeue"
+	"github.com/cybozu-go/coil/v2/pkg/resultcache"
 )
 
-// makeCNIArgs creates *CNIArgs.
-func makeCNIArgs(args *skel.CmdArgs) (*cnirpc.CNIArgs, error) {
+// makeRequest creates a request to coild.
+func makeRequest(args *skel.CmdArgs) (*coildclient.Request, error) {
 	env := &PluginEnvArgs{}
 	if err := types.LoadArgs(args.Args, env); err != nil {
 		return nil, types.NewError(types.ErrInvalidEnvironmentVariables, "failed to load CNI_ARGS", err.Error())
 	}
 
-	cniArgs := &cnirpc.CNIArgs{
-		ContainerId: args.ContainerID,
-		Netns:       args.Netns,
-		Ifname:      args.IfName,
-		Args:        env.Map(),
-		Path:        args.Path,
-		StdinData:   args.StdinData,
+	return &coildclient.Request{
+		ContainerID:      args.ContainerID,
+		Netns:            args.Netns,
+		Ifname:           args.IfName,
+		PodNamespace:     string(env.K8S_POD_NAMESPACE),
+		PodName:          string(env.K8S_POD_NAME),
+		InfraContainerID: string(env.K8S_POD_INFRA_CONTAINER_ID),
+		Path:             args.Path,
+		StdinData:        args.StdinData,
+	}, nil
+}
+
+// enqueueFree records the deleted container in the free queue.
+// If it fails, `rpcErr` is returned as a CNI error so that DEL will be retried.
+func enqueueFree(dir string, req *coildclient.Request, rpcErr error) error {
+	err := freequeue.Push(dir, freequeue.Entry{
+		ContainerID:  req.ContainerID,
+		Ifname:       req.Ifname,
+		PodNamespace: req.PodNamespace,
+		PodName:      req.PodName,
+		Queued:       time.Now().UTC(),
+	})
+	if err != nil {
+		return convertError(rpcErr)
 	}
-	return cniArgs, nil
+	return nil
 }
 
-// connect connects to coild
-func connect(sock string) (*grpc.ClientConn, error) {
-	dialer := &net.Dialer{}
-	dialFunc := func(ctx context.Context, a string) (net.Conn, error) {
-		return dialer.DialContext(ctx, "unix", a)
+// cachedResult returns the result of ADD cached in `dir` for the container
+// of `req`, or nil if none is cached for the same network namespace.
+// If `dir` is empty, the cache is disabled.
+func cachedResult(dir string, req *coildclient.Request) *current.Result {
+	if dir == "" {
+		return nil
 	}
-	conn, err := grpc.Dial(sock, grpc.WithInsecure(), grpc.WithContextDialer(dialFunc))
+	e, err := resultcache.Get(dir, req.ContainerID, req.Ifname)
+	if err != nil || e == nil || e.Netns != req.Netns {
+		return nil
+	}
+	result, err := current.NewResult(e.Result)
 	if err != nil {
-		return nil, types.NewError(types.ErrTryAgainLater, "failed to connect to "+sock, err.Error())
+		return nil
 	}
-	return conn, nil
+	return result.(*current.Result)
 }
 
-// convertError turns err returned from gRPC library into CNI's types.Error
-func convertError(err error) error {
-	st := status.Convert(err)
-	details := st.Details()
-	if len(details) != 1 {
-		return types.NewError(types.ErrInternal, st.Message(), err.Error())
+// cacheResult records `result` of ADD in `dir` for the container of `req`.
+// Failures are ignored because the cache is only an optimization.
+func cacheResult(dir string, req *coildclient.Request, result *current.Result) {
+	if dir == "" {
+		return
 	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	resultcache.Put(dir, resultcache.Entry{
+		ContainerID: req.ContainerID,
+		Ifname:      req.Ifname,
+		Netns:       req.Netns,
+		Result:      data,
+		Cached:      time.Now().UTC(),
+	})
+}
 
-	cniErr, ok := details[0].(*cnirpc.CNIError)
-	if !ok {
-		types.NewError(types.ErrInternal, st.Message(), err.Error())
+// forgetResult removes the result of ADD cached in `dir` for the container of `req`.
+func forgetResult(dir string, req *coildclient.Request) {
+	if dir == "" {
+		return
 	}
+	resultcache.Remove(dir, req.ContainerID, req.Ifname)
+}
 
-	return types.NewError(uint(cniErr.Code), cniErr.Msg, cniErr.Details)
+// convertError turns err returned from coildclient into CNI's types.Error
+func convertError(err error) error {
+	var e *coildclient.Error
+	if errors.As(err, &e) {
+		return e.CNIError()
+	}
+	return types.NewError(types.ErrInternal, err.Error(), "")
 }
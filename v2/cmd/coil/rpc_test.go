@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/cybozu-go/coil/v2/pkg/coildclient"
+	"github.com/cybozu-go/coil/v2/pkg/freequeue"
+	"github.com/cybozu-go/coil/v2/pkg/resultcache"
+	"google.golang.org/grpc/codes"
+)
+
+func TestMakeRequest(t *testing.T) {
+	req, err := makeRequest(&skel.CmdArgs{
+		ContainerID: "c1",
+		Netns:       "/run/netns/c1",
+		IfName:      "eth0",
+		Args:        "IgnoreUnknown=1;K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod1;K8S_POD_INFRA_CONTAINER_ID=c1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ContainerID != "c1" || req.Netns != "/run/netns/c1" || req.Ifname != "eth0" {
+		t.Error("unexpected request:", req)
+	}
+	if req.PodNamespace != "ns1" || req.PodName != "pod1" || req.InfraContainerID != "c1" {
+		t.Error("CNI_ARGS should be parsed:", req)
+	}
+
+	_, err = makeRequest(&skel.CmdArgs{ContainerID: "c1", Args: "K8S_POD_NAME"})
+	var cniErr *types.Error
+	if !errors.As(err, &cniErr) || cniErr.Code != types.ErrInvalidEnvironmentVariables {
+		t.Error("invalid CNI_ARGS should be rejected:", err)
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	err := convertError(&coildclient.Error{Status: codes.FailedPrecondition, Code: types.ErrTryAgainLater, Msg: "no pool matches the selector", Details: "foo=bar"})
+	var cniErr *types.Error
+	if !errors.As(err, &cniErr) || cniErr.Code != types.ErrTryAgainLater || cniErr.Msg != "no pool matches the selector" || cniErr.Details != "foo=bar" {
+		t.Error("unexpected error:", err)
+	}
+
+	err = convertError(errors.New("plain"))
+	if !errors.As(err, &cniErr) || cniErr.Code != types.ErrInternal || cniErr.Msg != "plain" {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestEnqueueFree(t *testing.T) {
+	dir := t.TempDir()
+	rpcErr := &coildclient.Error{Status: codes.Unavailable, Code: types.ErrTryAgainLater, Msg: "coild is not available"}
+
+	err := enqueueFree(dir, &coildclient.Request{ContainerID: "c1", Ifname: "eth0", PodNamespace: "ns1", PodName: "pod1"}, rpcErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := freequeue.List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ContainerID != "c1" || entries[0].Ifname != "eth0" || entries[0].PodNamespace != "ns1" || entries[0].PodName != "pod1" {
+		t.Error("unexpected entries:", entries)
+	}
+
+	err = enqueueFree(dir, &coildclient.Request{ContainerID: "c/2", Ifname: "eth0"}, rpcErr)
+	var cniErr *types.Error
+	if !errors.As(err, &cniErr) || cniErr.Code != types.ErrTryAgainLater {
+		t.Error("the original error should be returned:", err)
+	}
+}
+
+func TestCachedResult(t *testing.T) {
+	dir := t.TempDir()
+	req := &coildclient.Request{ContainerID: "c1", Netns: "/run/netns/c1", Ifname: "eth0"}
+
+	if result := cachedResult(dir, req); result != nil {
+		t.Error("nothing should be cached:", result)
+	}
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		IPs:        []*current.IPConfig{{Address: net.IPNet{IP: net.ParseIP("10.1.2.3"), Mask: net.CIDRMask(32, 32)}}},
+	}
+	cacheResult(dir, req, result)
+	cached := cachedResult(dir, req)
+	if cached == nil || len(cached.IPs) != 1 || cached.IPs[0].Address.String() != "10.1.2.3/32" {
+		t.Error("unexpected cached result:", cached)
+	}
+
+	recreated := &coildclient.Request{ContainerID: "c1", Netns: "/run/netns/c1-2", Ifname: "eth0"}
+	if result := cachedResult(dir, recreated); result != nil {
+		t.Error("the result for another netns should not be returned:", result)
+	}
+	if result := cachedResult("", req); result != nil {
+		t.Error("the cache should be disabled:", result)
+	}
+
+	forgetResult(dir, req)
+	if result := cachedResult(dir, req); result != nil {
+		t.Error("forgotten result should not be returned:", result)
+	}
+	e, err := resultcache.Get(dir, "c1", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Error("the entry should be removed:", e)
+	}
+}
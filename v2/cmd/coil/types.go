@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/version"
@@ -17,26 +19,52 @@ type PluginEnvArgs struct {
 	K8S_POD_INFRA_CONTAINER_ID types.UnmarshallableString
 }
 
-// Map returns a map[string]string
-func (e PluginEnvArgs) Map() map[string]string {
-	return map[string]string{
-		constants.PodNamespaceKey: string(e.K8S_POD_NAMESPACE),
-		constants.PodNameKey:      string(e.K8S_POD_NAME),
-		constants.PodContainerKey: string(e.K8S_POD_INFRA_CONTAINER_ID),
-	}
-}
-
 // PluginConf represents JSON netconf for Coil.
 type PluginConf struct {
 	types.NetConf
 
 	// Coil specific flags
 	Socket string `json:"socket"`
+
+	// FreeQueueDir is the directory to record deleted containers
+	// when coild is not available.
+	FreeQueueDir string `json:"free_queue_dir,omitempty"`
+
+	// ResultCacheDir is the directory to cache the results of ADD.
+	// If empty, the results are not cached.  The cache is disabled by default.
+	ResultCacheDir string `json:"result_cache_dir,omitempty"`
+
+	// TokenFile is the path to a file containing a bearer token for coild.
+	TokenFile string `json:"token_file,omitempty"`
+
+	// TimeoutSeconds is the deadline of a command in seconds.
+	// It is propagated to coild so that coild gives up the request as well.
+	// If zero, commands have no deadline.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// LogFile is the path to a file to log commands.
+	// If empty, commands are not logged.
+	LogFile string `json:"log_file,omitempty"`
+
+	// LogMaxSize is the size of the log file in megabytes to rotate it.
+	LogMaxSize int `json:"log_max_size,omitempty"`
+
+	// LogMaxBackups is the number of rotated log files to keep.
+	LogMaxBackups int `json:"log_max_backups,omitempty"`
 }
 
+// defaults of the parameters.
+const (
+	defaultLogMaxSize    = 10
+	defaultLogMaxBackups = 3
+)
+
 func parseConfig(stdin []byte) (*PluginConf, error) {
 	conf := &PluginConf{
-		Socket: constants.DefaultSocketPath,
+		Socket:        constants.DefaultSocketPath,
+		FreeQueueDir:  constants.DefaultFreeQueueDir,
+		LogMaxSize:    defaultLogMaxSize,
+		LogMaxBackups: defaultLogMaxBackups,
 	}
 
 	if err := json.Unmarshal(stdin, conf); err != nil {
@@ -47,5 +75,28 @@ func parseConfig(stdin []byte) (*PluginConf, error) {
 		return nil, fmt.Errorf("failed to parse prev result: %w", err)
 	}
 
+	if conf.TimeoutSeconds < 0 {
+		return nil, fmt.Errorf("timeout_seconds must not be negative: %d", conf.TimeoutSeconds)
+	}
+	if conf.LogMaxSize <= 0 {
+		return nil, fmt.Errorf("log_max_size must be positive: %d", conf.LogMaxSize)
+	}
+	if conf.LogMaxBackups < 0 {
+		return nil, fmt.Errorf("log_max_backups must not be negative: %d", conf.LogMaxBackups)
+	}
+
 	return conf, nil
 }
+
+// timeout returns the deadline of a command, or zero if there is none.
+func (c *PluginConf) timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// commandContext returns a context for a command that expires after timeout().
+func (c *PluginConf) commandContext() (context.Context, context.CancelFunc) {
+	if c.timeout() == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.timeout())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
@@ -56,13 +57,17 @@ func TestParseConfig(t *testing.T) {
 	if pc.Socket != constants.DefaultSocketPath {
 		t.Error(`pc.Socket != constants.DefaultSocketPath`)
 	}
+	if pc.ResultCacheDir != "" {
+		t.Error(`the result cache should be disabled by default`)
+	}
 
 	conf = []byte(`
 {
 	"cniVersion": "0.4.0",
 	"name": "k8s",
 	"type": "coil",
-	"socket": "/tmp/coild.sock"
+	"socket": "/tmp/coild.sock",
+	"result_cache_dir": "/var/lib/cni/coil/results"
 }
 `)
 	pc, err = parseConfig(conf)
@@ -72,6 +77,102 @@ func TestParseConfig(t *testing.T) {
 	if pc.Socket != "/tmp/coild.sock" {
 		t.Error(`pc.Socket != "/tmp/coild.sock"`)
 	}
+	if pc.TokenFile != "" {
+		t.Error(`pc.TokenFile should be empty`)
+	}
+	if pc.ResultCacheDir != "/var/lib/cni/coil/results" {
+		t.Error(`pc.ResultCacheDir != "/var/lib/cni/coil/results"`)
+	}
+
+	conf = []byte(`
+{
+	"cniVersion": "0.4.0",
+	"name": "k8s",
+	"type": "coil",
+	"token_file": "/etc/cni/net.d/coil-token"
+}
+`)
+	pc, err = parseConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.TokenFile != "/etc/cni/net.d/coil-token" {
+		t.Error(`pc.TokenFile != "/etc/cni/net.d/coil-token"`)
+	}
+	if pc.timeout() != 0 {
+		t.Error(`commands should have no deadline by default`, pc.timeout())
+	}
+	ctx, cancel := pc.commandContext()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error(`the context should have no deadline by default`)
+	}
+	cancel()
+	if pc.LogFile != "" || pc.LogMaxSize != defaultLogMaxSize || pc.LogMaxBackups != defaultLogMaxBackups {
+		t.Error(`log parameters should be the defaults`, pc.LogFile, pc.LogMaxSize, pc.LogMaxBackups)
+	}
+
+	conf = []byte(`
+{
+	"cniVersion": "0.4.0",
+	"name": "k8s",
+	"type": "coil",
+	"log_file": "/var/log/coil/cni.log",
+	"log_max_size": 1,
+	"log_max_backups": 0
+}
+`)
+	pc, err = parseConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.LogFile != "/var/log/coil/cni.log" || pc.LogMaxSize != 1 || pc.LogMaxBackups != 0 {
+		t.Error(`unexpected log parameters`, pc.LogFile, pc.LogMaxSize, pc.LogMaxBackups)
+	}
+
+	conf = []byte(`
+{
+	"cniVersion": "0.4.0",
+	"name": "k8s",
+	"type": "coil",
+	"log_max_size": 0
+}
+`)
+	if _, err := parseConfig(conf); err == nil {
+		t.Error(`log_max_size of 0 should be rejected`)
+	}
+
+	conf = []byte(`
+{
+	"cniVersion": "0.4.0",
+	"name": "k8s",
+	"type": "coil",
+	"timeout_seconds": 30
+}
+`)
+	pc, err = parseConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.timeout() != 30*time.Second {
+		t.Error(`pc.timeout() != 30*time.Second`, pc.timeout())
+	}
+	ctx, cancel = pc.commandContext()
+	if d, ok := ctx.Deadline(); !ok || time.Until(d) > 30*time.Second {
+		t.Error(`the context should expire in 30 seconds`, d, ok)
+	}
+	cancel()
+
+	conf = []byte(`
+{
+	"cniVersion": "0.4.0",
+	"name": "k8s",
+	"type": "coil",
+	"timeout_seconds": -1
+}
+`)
+	if _, err := parseConfig(conf); err == nil {
+		t.Error(`negative timeout_seconds should be rejected`)
+	}
 
 	conf = []byte(`
 {
@@ -0,0 +1,256 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var blockReleaseConfig changeConfig
+
+var blockShowConfig struct {
+	watch   bool
+	output  string
+	timeout time.Duration
+}
+
+var blockCmd = &cobra.Command{
+	Use:   "block",
+	Short: "manage address blocks",
+}
+
+var blockReleaseCmd = &cobra.Command{
+	Use:   "release NAME",
+	Short: "release an address block forcibly",
+	Long: `Release an AddressBlock forcibly by removing its finalizer and deleting it.
+
+The addresses in the block can be assigned to other Pods afterwards,
+so release only blocks that are no longer used, e.g. those of a node
+that has gone without coild freeing them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runChange(cmd, &blockReleaseConfig, args[0], planBlockRelease(args[0]))
+	},
+}
+
+var blockShowCmd = &cobra.Command{
+	Use:   "show NAME|SUBNET",
+	Short: "show an address block and the addresses allocated from it",
+	Long: `Show an AddressBlock specified by its name or its subnet such as 10.2.3.0/27.
+
+This prints the node owning the block, the time when the node acquired it,
+every allocated address with its Pod, and the number of free addresses.
+The allocated addresses are those of Pods running on the node.
+
+With --watch, the block is printed again whenever it or a Pod on the node
+changes until coilctl is interrupted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runBlockShow(cmd.OutOrStdout(), args[0])
+	},
+}
+
+func init() {
+	addChangeFlags(blockReleaseCmd.Flags(), &blockReleaseConfig)
+	blockCmd.AddCommand(blockReleaseCmd)
+
+	fs := blockShowCmd.Flags()
+	fs.BoolVarP(&blockShowConfig.watch, "watch", "w", false, "watch changes of the block")
+	fs.StringVarP(&blockShowConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&blockShowConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	addKubeFlags(fs)
+	blockCmd.AddCommand(blockShowCmd)
+	rootCmd.AddCommand(blockCmd)
+}
+
+func planBlockRelease(name string) changePlanner {
+	return func(ctx context.Context, r client.Reader) ([]objectChange, error) {
+		b := &coilv2.AddressBlock{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
+			return nil, fmt.Errorf("failed to get AddressBlock %s: %w", name, err)
+		}
+		return blockChanges(b), nil
+	}
+}
+
+func runBlockShow(w io.Writer, block string) error {
+	if blockShowConfig.output != "text" && blockShowConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", blockShowConfig.output)
+	}
+	if blockShowConfig.watch && config.revision != "" {
+		return errors.New("--watch cannot be used with --at-revision")
+	}
+
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	show := func(name string) (*coilv2.AddressBlock, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), blockShowConfig.timeout)
+		defer cancel()
+		b, err := ipam.FindBlock(ctx, c, name)
+		if err != nil {
+			return nil, err
+		}
+		d, err := ipam.InspectBlock(ctx, c, b)
+		if err != nil {
+			return nil, err
+		}
+		return b, writeBlockDetail(w, d, blockShowConfig.output)
+	}
+
+	b, err := show(block)
+	if err != nil || !blockShowConfig.watch {
+		return err
+	}
+
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return err
+	}
+	wc, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = watchBlock(ctx, wc, b.Name, b.Labels[constants.LabelNode], func() error {
+		if blockShowConfig.output == "text" {
+			fmt.Fprintln(w)
+		}
+		_, err := show(b.Name)
+		return err
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// watchBlock calls `changed` whenever the block named `name` or a Pod on `node` changes.
+//
+// Watches start from the resource versions read just before, so that only
+// changes are notified.  When kube-apiserver closes a watch, `changed` is
+// called to catch up before watching again.
+func watchBlock(ctx context.Context, c client.WithWatch, name, node string, changed func() error) error {
+	for first := true; ; first = false {
+		if !first {
+			if err := changed(); err != nil {
+				return err
+			}
+		}
+
+		b := &coilv2.AddressBlock{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
+			return fmt.Errorf("failed to get AddressBlock %s: %w", name, err)
+		}
+		pods := &corev1.PodList{}
+		podSelector := client.MatchingFields{"spec.nodeName": node}
+		if err := c.List(ctx, pods, podSelector); err != nil {
+			return fmt.Errorf("failed to list Pod: %w", err)
+		}
+
+		bw, err := c.Watch(ctx, &coilv2.AddressBlockList{},
+			client.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("metadata.name", name)},
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: b.ResourceVersion}})
+		if err != nil {
+			return fmt.Errorf("failed to watch AddressBlock %s: %w", name, err)
+		}
+		pw, err := c.Watch(ctx, &corev1.PodList{}, podSelector,
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: pods.ResourceVersion}})
+		if err != nil {
+			bw.Stop()
+			return fmt.Errorf("failed to watch Pod: %w", err)
+		}
+
+		err = func() error {
+			defer bw.Stop()
+			defer pw.Stop()
+			for {
+				var ev watch.Event
+				var ok bool
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case ev, ok = <-bw.ResultChan():
+				case ev, ok = <-pw.ResultChan():
+				}
+				if !ok || ev.Type == watch.Error {
+					return nil
+				}
+				if ev.Type == watch.Bookmark {
+					continue
+				}
+				if _, ok := ev.Object.(*coilv2.AddressBlock); ok && ev.Type == watch.Deleted {
+					return fmt.Errorf("AddressBlock %s has been deleted", name)
+				}
+				if err := changed(); err != nil {
+					return err
+				}
+			}
+		}()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeBlockDetail(w io.Writer, d *ipam.BlockDetail, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	var subnets []string
+	if d.IPv4 != "" {
+		subnets = append(subnets, d.IPv4)
+	}
+	if d.IPv6 != "" {
+		subnets = append(subnets, d.IPv6)
+	}
+	fmt.Fprintf(w, "Name:      %s\n", d.Name)
+	fmt.Fprintf(w, "Subnet:    %s\n", strings.Join(subnets, ", "))
+	fmt.Fprintf(w, "Pool:      %s\n", d.Pool)
+	fmt.Fprintf(w, "Node:      %s\n", d.Node)
+	fmt.Fprintf(w, "Acquired:  %s\n", d.Acquired.UTC().Format(time.RFC3339))
+	if d.Quarantined {
+		fmt.Fprintf(w, "Quarantined: %s\n", d.QuarantineReason)
+	}
+	fmt.Fprintf(w, "Allocated: %d\n", len(d.Addresses))
+	if len(d.Excluded) > 0 {
+		fmt.Fprintf(w, "Excluded:  %s\n", strings.Join(d.Excluded, ", "))
+	}
+	fmt.Fprintf(w, "Free:      %d/%d\n", d.Free, d.Capacity)
+	if len(d.Addresses) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tNAMESPACE\tPOD")
+	for _, a := range d.Addresses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.Join(a.IPs, ","), a.Namespace, a.Pod)
+	}
+	return tw.Flush()
+}
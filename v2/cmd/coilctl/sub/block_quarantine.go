@@ -0,0 +1,151 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var blockQuarantineConfig struct {
+	reason  string
+	timeout time.Duration
+}
+
+var blockQuarantineCmd = &cobra.Command{
+	Use:   "quarantine NAME",
+	Short: "quarantine an address block",
+	Long: `Quarantine an AddressBlock with a reason.
+
+The block is labeled as coild does when it cannot add the route of the block.
+coild withdraws the route of the block at the next sync, and stops allocating
+addresses from it after it is restarted on the node.  The node keeps the block
+even when it becomes empty.  Pods already running keep their addresses.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runBlockQuarantine(cmd.OutOrStdout(), args[0], true)
+	},
+}
+
+var blockUnquarantineCmd = &cobra.Command{
+	Use:   "unquarantine NAME",
+	Short: "release an address block from quarantine",
+	Long: `Release an AddressBlock from quarantine.
+
+Restart coild on the node afterwards so that it allocates addresses
+from the block again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runBlockQuarantine(cmd.OutOrStdout(), args[0], false)
+	},
+}
+
+func init() {
+	fs := blockQuarantineCmd.Flags()
+	fs.StringVar(&blockQuarantineConfig.reason, "reason", "", "reason of the quarantine, e.g. the problem found on the node")
+	fs.DurationVar(&blockQuarantineConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	blockQuarantineCmd.MarkFlagRequired("reason")
+	blockCmd.AddCommand(blockQuarantineCmd)
+
+	fs = blockUnquarantineCmd.Flags()
+	fs.DurationVar(&blockQuarantineConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	blockCmd.AddCommand(blockUnquarantineCmd)
+}
+
+func runBlockQuarantine(w io.Writer, name string, quarantine bool) error {
+	c, err := newKubeWriter()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), blockQuarantineConfig.timeout)
+	defer cancel()
+
+	var b *coilv2.AddressBlock
+	if quarantine {
+		b, err = quarantineBlock(ctx, c, name, blockQuarantineConfig.reason)
+	} else {
+		b, err = unquarantineBlock(ctx, c, name)
+	}
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		if quarantine {
+			fmt.Fprintf(w, "block %s is already quarantined\n", name)
+		} else {
+			fmt.Fprintf(w, "block %s is not quarantined\n", name)
+		}
+		return nil
+	}
+
+	if quarantine {
+		fmt.Fprintf(w, "block %s quarantined: %s\n", name, blockQuarantineConfig.reason)
+	} else {
+		fmt.Fprintf(w, "block %s released from quarantine; restart coild on node %s to use it\n", name, b.Labels[constants.LabelNode])
+	}
+	return nil
+}
+
+// quarantineBlock labels the block with `coil.cybozu.com/quarantined` and records
+// `reason` in `coil.cybozu.com/quarantine-reason` annotation.  It returns the
+// updated block, or nil if the block is already quarantined for the same reason.
+func quarantineBlock(ctx context.Context, c client.Client, name, reason string) (*coilv2.AddressBlock, error) {
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+
+	b := &coilv2.AddressBlock{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
+		return nil, fmt.Errorf("failed to get AddressBlock %s: %w", name, err)
+	}
+	if b.Labels[constants.LabelQuarantined] == "true" && b.Annotations[constants.AnnQuarantineReason] == reason {
+		return nil, nil
+	}
+
+	orig := b.DeepCopy()
+	if b.Labels == nil {
+		b.Labels = make(map[string]string)
+	}
+	if b.Annotations == nil {
+		b.Annotations = make(map[string]string)
+	}
+	b.Labels[constants.LabelQuarantined] = "true"
+	b.Annotations[constants.AnnQuarantineReason] = reason
+	if err := c.Patch(ctx, b, client.MergeFrom(orig)); err != nil {
+		return nil, fmt.Errorf("failed to quarantine AddressBlock %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// unquarantineBlock removes the label and annotation added by quarantineBlock.
+// It returns the updated block, or nil if the block is not quarantined.
+func unquarantineBlock(ctx context.Context, c client.Client, name string) (*coilv2.AddressBlock, error) {
+	b := &coilv2.AddressBlock{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
+		return nil, fmt.Errorf("failed to get AddressBlock %s: %w", name, err)
+	}
+	_, quarantined := b.Labels[constants.LabelQuarantined]
+	_, hasReason := b.Annotations[constants.AnnQuarantineReason]
+	if !quarantined && !hasReason {
+		return nil, nil
+	}
+
+	orig := b.DeepCopy()
+	delete(b.Labels, constants.LabelQuarantined)
+	delete(b.Annotations, constants.AnnQuarantineReason)
+	if err := c.Patch(ctx, b, client.MergeFrom(orig)); err != nil {
+		return nil, fmt.Errorf("failed to release AddressBlock %s from quarantine: %w", name, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,71 @@
+package sub
+
+import (
+	"context"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestQuarantineBlock(t *testing.T) {
+	t.Parallel()
+
+	b := &coilv2.AddressBlock{}
+	b.Name = "default-3"
+	b.Labels = map[string]string{constants.LabelPool: "default", constants.LabelNode: "node1"}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b).Build()
+	ctx := context.Background()
+
+	if _, err := quarantineBlock(ctx, c, "default-3", ""); err == nil {
+		t.Error("quarantining without a reason should fail")
+	}
+	if _, err := quarantineBlock(ctx, c, "default-4", "broken route"); err == nil {
+		t.Error("quarantining a missing block should fail")
+	}
+
+	quarantined, err := quarantineBlock(ctx, c, "default-3", "broken route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quarantined == nil {
+		t.Fatal("the block should be quarantined")
+	}
+	current := &coilv2.AddressBlock{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "default-3"}, current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Labels[constants.LabelQuarantined] != "true" || current.Annotations[constants.AnnQuarantineReason] != "broken route" {
+		t.Errorf("unexpected block: %+v", current.ObjectMeta)
+	}
+	if current.Labels[constants.LabelNode] != "node1" {
+		t.Error("other labels should be kept:", current.Labels)
+	}
+
+	quarantined, err = quarantineBlock(ctx, c, "default-3", "broken route")
+	if err != nil || quarantined != nil {
+		t.Error("quarantining again for the same reason should be a no-op", quarantined, err)
+	}
+
+	released, err := unquarantineBlock(ctx, c, "default-3")
+	if err != nil || released == nil {
+		t.Fatal("the block should be released", released, err)
+	}
+	current = &coilv2.AddressBlock{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "default-3"}, current); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := current.Labels[constants.LabelQuarantined]; ok {
+		t.Error("the label should be removed:", current.Labels)
+	}
+	if _, ok := current.Annotations[constants.AnnQuarantineReason]; ok {
+		t.Error("the reason should be removed:", current.Annotations)
+	}
+
+	released, err = unquarantineBlock(ctx, c, "default-3")
+	if err != nil || released != nil {
+		t.Error("releasing a block not quarantined should be a no-op", released, err)
+	}
+}
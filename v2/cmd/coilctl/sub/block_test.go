@@ -0,0 +1,64 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+)
+
+func TestWriteBlockDetail(t *testing.T) {
+	t.Parallel()
+
+	d := &ipam.BlockDetail{
+		Name:     "default-0",
+		Pool:     "default",
+		Node:     "node1",
+		IPv4:     "10.2.0.0/29",
+		IPv6:     "fd02::/125",
+		Acquired: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Capacity: 8,
+		Addresses: []ipam.BlockAddress{
+			{IPs: []string{"10.2.0.1", "fd02::1"}, Namespace: "ns1", Pod: "pod1"},
+		},
+		Excluded: []string{"10.2.0.5"},
+		Free:     6,
+	}
+	buf := &bytes.Buffer{}
+	if err := writeBlockDetail(buf, d, "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Name: default-0",
+		"Subnet: 10.2.0.0/29, fd02::/125",
+		"Pool: default",
+		"Node: node1",
+		"Acquired: 2021-01-01T00:00:00Z",
+		"Allocated: 1",
+		"Excluded: 10.2.0.5",
+		"Free: 6/8",
+		"",
+		"ADDRESS NAMESPACE POD",
+		"10.2.0.1,fd02::1 ns1 pod1",
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatal("unexpected output:", buf.String())
+	}
+	for i, l := range lines {
+		if f := strings.Join(strings.Fields(l), " "); f != expected[i] {
+			t.Errorf("unexpected line %d: %s", i, l)
+		}
+	}
+
+	buf.Reset()
+	if err := writeBlockDetail(buf, d, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"free": 6`) {
+		t.Error("unexpected JSON output:", buf.String())
+	}
+}
@@ -0,0 +1,337 @@
+package sub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// etcdPrefix is the default prefix of etcd keys under which kube-apiserver stores objects.
+const etcdPrefix = "/registry"
+
+// Actions of objectChange.
+const (
+	actionRemoveFinalizer = "remove-finalizer"
+	actionDelete          = "delete"
+)
+
+// objectChange is a change made to an object by a subcommand that modifies the cluster state.
+type objectChange struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+// changeImpact is the estimated impact of changes on Pods.
+type changeImpact struct {
+	// Pods is the number of Pods using addresses in the changed blocks and pools.
+	Pods int `json:"pods"`
+
+	// Namespaces are the namespaces of the Pods.
+	Namespaces []string `json:"namespaces"`
+}
+
+// changeResult is the output of subcommands that modify the cluster state.
+type changeResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Changes []objectChange `json:"changes"`
+	Impact  changeImpact   `json:"impact"`
+}
+
+// changeConfig is the common configuration of subcommands that modify the cluster state.
+type changeConfig struct {
+	dryRun  bool
+	yes     bool
+	output  string
+	timeout time.Duration
+}
+
+func addChangeFlags(fs *pflag.FlagSet, cfg *changeConfig) {
+	fs.BoolVar(&cfg.dryRun, "dry-run", false, "only print the objects that would be changed")
+	fs.BoolVarP(&cfg.yes, "yes", "y", false, "make the changes without confirmation")
+	fs.StringVarP(&cfg.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&cfg.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+}
+
+// changePlanner computes the changes to be made from the current cluster state.
+type changePlanner func(ctx context.Context, r client.Reader) ([]objectChange, error)
+
+// runChange computes the changes with `plan` and estimates their impact.
+// Unless --dry-run is given, it makes the changes after the user types `word`
+// to confirm them, or without confirmation if --yes is given.
+// The changes are written to the standard output of `cmd`.
+func runChange(cmd *cobra.Command, cfg *changeConfig, word string, plan changePlanner) error {
+	if cfg.output != "text" && cfg.output != "json" {
+		return fmt.Errorf("unknown output format: %s", cfg.output)
+	}
+
+	c, err := newKubeWriter()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	changes, err := plan(ctx, c)
+	if err != nil {
+		return err
+	}
+	impact, err := estimateImpact(ctx, c, changes)
+	if err != nil {
+		return err
+	}
+	result := changeResult{DryRun: cfg.dryRun, Changes: changes, Impact: impact}
+
+	if !cfg.dryRun && len(changes) > 0 {
+		if !cfg.yes {
+			// the timeout should not expire while waiting for the user.
+			cancel()
+			if err := confirmChanges(cmd.InOrStdin(), cmd.ErrOrStderr(), result, word); err != nil {
+				return err
+			}
+			ctx, cancel = context.WithTimeout(context.Background(), cfg.timeout)
+			defer cancel()
+		}
+		if err := applyChanges(ctx, c, changes); err != nil {
+			return err
+		}
+	}
+	return writeChanges(cmd.OutOrStdout(), cfg.output, result)
+}
+
+// confirmChanges shows `result` and asks the user to type `word` to continue.
+func confirmChanges(in io.Reader, out io.Writer, result changeResult, word string) error {
+	if err := writeChanges(out, "text", result); err != nil {
+		return err
+	}
+	return askConfirmation(in, out, word)
+}
+
+// askConfirmation asks the user to type `word` to continue.
+func askConfirmation(in io.Reader, out io.Writer, word string) error {
+	fmt.Fprintf(out, "\nType %q to make the changes: ", word)
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if strings.TrimSpace(line) != word {
+		return errors.New("aborted; specify --yes to make the changes without confirmation")
+	}
+	return nil
+}
+
+// estimateImpact counts Pods using addresses in the blocks deleted by `changes`,
+// and those in the blocks of the pools deleted by `changes`.
+func estimateImpact(ctx context.Context, r client.Reader, changes []objectChange) (changeImpact, error) {
+	impact := changeImpact{Namespaces: []string{}}
+
+	blocks := make(map[string]*coilv2.AddressBlock)
+	for _, ch := range changes {
+		if ch.Action != actionDelete {
+			continue
+		}
+		switch ch.Kind {
+		case "AddressBlock":
+			b := &coilv2.AddressBlock{}
+			if err := r.Get(ctx, client.ObjectKey{Name: ch.Name}, b); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return impact, fmt.Errorf("failed to get AddressBlock %s: %w", ch.Name, err)
+			}
+			blocks[b.Name] = b
+		case "AddressPool":
+			bl := &coilv2.AddressBlockList{}
+			if err := r.List(ctx, bl, client.MatchingLabels{constants.LabelPool: ch.Name}); err != nil {
+				return impact, fmt.Errorf("failed to list AddressBlocks: %w", err)
+			}
+			for i := range bl.Items {
+				blocks[bl.Items[i].Name] = &bl.Items[i]
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		return impact, nil
+	}
+
+	var subnets []*net.IPNet
+	for _, b := range blocks {
+		for _, cidr := range []*string{b.IPv4, b.IPv6} {
+			if cidr == nil {
+				continue
+			}
+			_, n, err := net.ParseCIDR(*cidr)
+			if err != nil {
+				return impact, fmt.Errorf("invalid subnet of AddressBlock %s: %w", b.Name, err)
+			}
+			subnets = append(subnets, n)
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods); err != nil {
+		return impact, fmt.Errorf("failed to list Pods: %w", err)
+	}
+	namespaces := make(map[string]bool)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.HostNetwork || !usesSubnets(pod, subnets) {
+			continue
+		}
+		impact.Pods++
+		namespaces[pod.Namespace] = true
+	}
+	for ns := range namespaces {
+		impact.Namespaces = append(impact.Namespaces, ns)
+	}
+	sort.Strings(impact.Namespaces)
+	return impact, nil
+}
+
+func usesSubnets(pod *corev1.Pod, subnets []*net.IPNet) bool {
+	for _, podIP := range pod.Status.PodIPs {
+		ip := net.ParseIP(podIP.IP)
+		if ip == nil {
+			continue
+		}
+		for _, n := range subnets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newKubeWriter creates a client to modify the cluster state.
+func newKubeWriter() (client.Client, error) {
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
+
+// etcdKey returns the etcd key of a cluster-scoped Coil object.
+func etcdKey(resource, name string) string {
+	return path.Join(etcdPrefix, coilv2.GroupVersion.Group, resource, name)
+}
+
+func poolChanges(ap *coilv2.AddressPool) []objectChange {
+	return []objectChange{{
+		Kind:   "AddressPool",
+		Name:   ap.Name,
+		Key:    etcdKey("addresspools", ap.Name),
+		Action: actionDelete,
+	}}
+}
+
+// blockChanges returns the changes to release `b` forcibly.
+func blockChanges(b *coilv2.AddressBlock) []objectChange {
+	var changes []objectChange
+	key := etcdKey("addressblocks", b.Name)
+	if controllerutil.ContainsFinalizer(b, constants.FinCoil) {
+		changes = append(changes, objectChange{Kind: "AddressBlock", Name: b.Name, Key: key, Action: actionRemoveFinalizer})
+	}
+	return append(changes, objectChange{Kind: "AddressBlock", Name: b.Name, Key: key, Action: actionDelete})
+}
+
+func newChangeObject(c objectChange) (client.Object, error) {
+	var obj client.Object
+	switch c.Kind {
+	case "AddressPool":
+		obj = &coilv2.AddressPool{}
+	case "AddressBlock":
+		obj = &coilv2.AddressBlock{}
+	default:
+		return nil, fmt.Errorf("unsupported kind: %s", c.Kind)
+	}
+	obj.SetName(c.Name)
+	return obj, nil
+}
+
+// applyChanges makes `changes` in order.  Objects already deleted are ignored.
+func applyChanges(ctx context.Context, c client.Client, changes []objectChange) error {
+	for _, ch := range changes {
+		obj, err := newChangeObject(ch)
+		if err != nil {
+			return err
+		}
+
+		switch ch.Action {
+		case actionRemoveFinalizer:
+			err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+					return client.IgnoreNotFound(err)
+				}
+				if !controllerutil.ContainsFinalizer(obj, constants.FinCoil) {
+					return nil
+				}
+				controllerutil.RemoveFinalizer(obj, constants.FinCoil)
+				return c.Update(ctx, obj)
+			})
+		case actionDelete:
+			err = client.IgnoreNotFound(c.Delete(ctx, obj))
+		default:
+			err = fmt.Errorf("unsupported action: %s", ch.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s %s %s: %w", ch.Action, ch.Kind, ch.Name, err)
+		}
+	}
+	return nil
+}
+
+func writeChanges(w io.Writer, output string, result changeResult) error {
+	if output == "json" {
+		if result.Changes == nil {
+			result.Changes = []objectChange{}
+		}
+		if result.Impact.Namespaces == nil {
+			result.Impact.Namespaces = []string{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tACTION\tKEY")
+	for _, c := range result.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Kind, c.Name, c.Action, c.Key)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if n := result.Impact.Pods; n > 0 {
+		fmt.Fprintf(w, "%d Pods use addresses in the changed blocks across namespaces: %s\n", n, strings.Join(result.Impact.Namespaces, ", "))
+	} else {
+		fmt.Fprintln(w, "no Pods use addresses in the changed blocks")
+	}
+	if result.DryRun {
+		fmt.Fprintln(w, "dry run: no changes were made")
+	}
+	return nil
+}
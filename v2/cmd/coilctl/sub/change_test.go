@@ -0,0 +1,359 @@
+package sub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testChangeBlock(name, node string) *coilv2.AddressBlock {
+	b := &coilv2.AddressBlock{}
+	b.Name = name
+	b.Labels = map[string]string{
+		constants.LabelPool: "default",
+		constants.LabelNode: node,
+	}
+	b.Finalizers = []string{constants.FinCoil}
+	return b
+}
+
+func TestPlanGC(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{}
+	node.Name = "node1"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		node,
+		testChangeBlock("default-0", "node1"),
+		testChangeBlock("default-1", "node2"),
+	).Build()
+	ctx := context.Background()
+
+	changes, err := planGC(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []objectChange{
+		{Kind: "AddressBlock", Name: "default-1", Key: "/registry/coil.cybozu.com/addressblocks/default-1", Action: actionRemoveFinalizer},
+		{Kind: "AddressBlock", Name: "default-1", Key: "/registry/coil.cybozu.com/addressblocks/default-1", Action: actionDelete},
+	}
+	if diff := cmp.Diff(expected, changes); diff != "" {
+		t.Errorf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	if err := applyChanges(ctx, c, changes); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Get(ctx, client.ObjectKey{Name: "default-1"}, &coilv2.AddressBlock{})
+	if !apierrors.IsNotFound(err) {
+		t.Error("the block of the deleted node should be released:", err)
+	}
+	err = c.Get(ctx, client.ObjectKey{Name: "default-0"}, &coilv2.AddressBlock{})
+	if err != nil {
+		t.Error("the block of the existing node should be kept:", err)
+	}
+
+	// applying the same changes again is a no-op.
+	if err := applyChanges(ctx, c, changes); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlanPoolDelete(t *testing.T) {
+	t.Parallel()
+
+	ap := &coilv2.AddressPool{}
+	ap.Name = "default"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ap).Build()
+
+	changes, err := planPoolDelete("default")(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []objectChange{
+		{Kind: "AddressPool", Name: "default", Key: "/registry/coil.cybozu.com/addresspools/default", Action: actionDelete},
+	}
+	if diff := cmp.Diff(expected, changes); diff != "" {
+		t.Errorf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	if _, err := planPoolDelete("global")(context.Background(), c); err == nil {
+		t.Error("deleting a missing pool should fail")
+	}
+}
+
+func TestPlanPoolCreate(t *testing.T) {
+	t.Parallel()
+
+	ap := &coilv2.AddressPool{}
+	ap.Name = "default"
+	ap.Spec.BlockSizeBits = 5
+	ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.100.0.0/20")}}
+	cc := &coilv2.CoilConfig{}
+	cc.Name = constants.CoilConfigName
+	cc.Spec.Supernets = []string{"10.100.0.0/16", "fd02::/48"}
+	cc.Spec.NodeNetworks = []string{"10.200.0.0/26"}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ap, cc).Build()
+	ctx := context.Background()
+
+	pool, err := planPoolCreate(ctx, c, "team-a", poolCreateOptions{prefixLen: 20, blockSizeBits: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := poolCreateResultOf(pool, false)
+	expected := poolCreateResult{
+		Name:     "team-a",
+		Key:      "/registry/coil.cybozu.com/addresspools/team-a",
+		Subnet:   "10.100.16.0/20",
+		Supernet: "10.100.0.0/16",
+	}
+	if diff := cmp.Diff(expected, result); diff != "" {
+		t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+	if pool.Spec.BlockSizeBits != 5 || pool.Annotations[constants.AnnSupernet] != "10.100.0.0/16" {
+		t.Error("unexpected pool:", pool)
+	}
+
+	pool, err = planPoolCreate(ctx, c, "team-b", poolCreateOptions{prefixLen: 64, ipv6: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := poolCreateResultOf(pool, true); result.Subnet != "fd02::/64" {
+		t.Error("unexpected IPv6 subnet:", result.Subnet)
+	}
+
+	_, n, _ := net.ParseCIDR("10.200.0.0/24")
+	pool, err = planPoolCreate(ctx, c, "team-c", poolCreateOptions{prefixLen: 26, supernets: []*net.IPNet{n}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := poolCreateResultOf(pool, true); result.Subnet != "10.200.0.64/26" || result.Supernet != "10.200.0.0/24" {
+		t.Error("--supernet should take precedence over CoilConfig, and node networks should be avoided:", result)
+	}
+
+	if _, err := planPoolCreate(ctx, c, "default", poolCreateOptions{prefixLen: 20}); err == nil {
+		t.Error("creating an existing pool should fail")
+	}
+	if _, err := planPoolCreate(ctx, c, "team-d", poolCreateOptions{prefixLen: 15}); err == nil {
+		t.Error("a subnet larger than the supernets should fail")
+	}
+	if _, err := planPoolCreate(ctx, c, "team-e", poolCreateOptions{prefixLen: 30, blockSizeBits: 5}); err == nil {
+		t.Error("a block larger than the subnet should fail")
+	}
+
+	empty := fake.NewClientBuilder().WithScheme(scheme).Build()
+	if _, err := planPoolCreate(ctx, empty, "team-a", poolCreateOptions{prefixLen: 20}); err == nil {
+		t.Error("creating a pool without supernets should fail")
+	}
+}
+
+func TestPoolExclusions(t *testing.T) {
+	t.Parallel()
+
+	input := `# leases of the legacy DHCP server
+10.200.0.1
+10.200.0.8/30
+
+10.200.0.60-10.200.0.70
+10.201.0.1
+fd02::1
+`
+	ranges, err := parseExclusions(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 5 {
+		t.Fatal("unexpected ranges:", ranges)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	_, n, _ := net.ParseCIDR("10.200.0.0/26")
+	pool, err := planPoolCreate(context.Background(), c, "legacy", poolCreateOptions{
+		prefixLen:     26,
+		blockSizeBits: 3,
+		supernets:     []*net.IPNet{n},
+		exclusions:    ranges,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.200.0.1", "10.200.0.8", "10.200.0.9", "10.200.0.10", "10.200.0.11", "10.200.0.60", "10.200.0.61", "10.200.0.62", "10.200.0.63"}
+	if diff := cmp.Diff(expected, pool.Spec.Quarantine); diff != "" {
+		t.Errorf("unexpected quarantine (-want +got):\n%s", diff)
+	}
+	if result := poolCreateResultOf(pool, true); result.Excluded != len(expected) {
+		t.Error("unexpected number of excluded addresses:", result.Excluded)
+	}
+
+	_, wide, _ := net.ParseCIDR("10.0.0.0/8")
+	if _, err := excludedAddresses(wide, []ipRange{{first: net.ParseIP("10.0.0.0"), last: net.ParseIP("10.1.0.0")}}); err == nil {
+		t.Error("too many exclusions should fail")
+	}
+
+	for _, line := range []string{"10.0.0.256", "10.0.0.0/33", "10.0.0.9-10.0.0.1", "10.0.0.1-fd02::1"} {
+		if _, err := parseExclusions(strings.NewReader(line)); err == nil {
+			t.Errorf("%s: should be invalid", line)
+		}
+	}
+}
+
+func TestParsePrefixSize(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"/20", "20"} {
+		n, err := parsePrefixSize(s)
+		if err != nil || n != 20 {
+			t.Errorf("%s: unexpected result: %d, %v", s, n, err)
+		}
+	}
+	for _, s := range []string{"", "/", "/0", "/129", "20/"} {
+		if _, err := parsePrefixSize(s); err == nil {
+			t.Errorf("%s: should be invalid", s)
+		}
+	}
+}
+
+func TestWriteChanges(t *testing.T) {
+	t.Parallel()
+
+	result := changeResult{
+		DryRun:  true,
+		Changes: blockChanges(testChangeBlock("default-0", "node1")),
+		Impact:  changeImpact{Pods: 2, Namespaces: []string{"app", "default"}},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeChanges(buf, "json", result); err != nil {
+		t.Fatal(err)
+	}
+	var decoded changeResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(result, decoded); diff != "" {
+		t.Errorf("unexpected JSON output (-want +got):\n%s", diff)
+	}
+
+	buf.Reset()
+	if err := writeChanges(buf, "json", changeResult{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"changes": []`) {
+		t.Error("no changes should be an empty array:", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeChanges(buf, "text", result); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "remove-finalizer") || !strings.HasSuffix(out, "dry run: no changes were made\n") {
+		t.Error("unexpected text output:", out)
+	}
+	if !strings.Contains(out, "2 Pods use addresses in the changed blocks across namespaces: app, default") {
+		t.Error("the impact should be shown:", out)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func testImpactPod(namespace, name, ip string, hostNetwork bool) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Namespace = namespace
+	pod.Name = name
+	pod.Spec.HostNetwork = hostNetwork
+	pod.Status.PodIPs = []corev1.PodIP{{IP: ip}}
+	return pod
+}
+
+func TestEstimateImpact(t *testing.T) {
+	t.Parallel()
+
+	b0 := testChangeBlock("default-0", "node1")
+	b0.IPv4 = strPtr("10.2.0.0/30")
+	b1 := testChangeBlock("default-1", "node2")
+	b1.IPv4 = strPtr("10.2.0.4/30")
+	b2 := testChangeBlock("global-0", "node1")
+	b2.Labels[constants.LabelPool] = "global"
+	b2.IPv6 = strPtr("fd02::/126")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		b0, b1, b2,
+		testImpactPod("app", "a1", "10.2.0.1", false),
+		testImpactPod("app", "a2", "10.2.0.5", false),
+		testImpactPod("default", "d1", "10.2.0.2", false),
+		testImpactPod("kube-system", "k1", "10.2.0.3", true),
+		testImpactPod("web", "w1", "fd02::1", false),
+	).Build()
+	ctx := context.Background()
+
+	impact, err := estimateImpact(ctx, c, blockChanges(b0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := changeImpact{Pods: 2, Namespaces: []string{"app", "default"}}
+	if diff := cmp.Diff(expected, impact); diff != "" {
+		t.Errorf("unexpected impact of releasing a block (-want +got):\n%s", diff)
+	}
+
+	impact, err = estimateImpact(ctx, c, poolChanges(&coilv2.AddressPool{ObjectMeta: metav1.ObjectMeta{Name: "default"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = changeImpact{Pods: 3, Namespaces: []string{"app", "default"}}
+	if diff := cmp.Diff(expected, impact); diff != "" {
+		t.Errorf("unexpected impact of deleting a pool (-want +got):\n%s", diff)
+	}
+
+	impact, err = estimateImpact(ctx, c, blockChanges(testChangeBlock("missing", "node1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impact.Pods != 0 {
+		t.Error("missing blocks should have no impact:", impact)
+	}
+}
+
+func TestConfirmChanges(t *testing.T) {
+	t.Parallel()
+
+	result := changeResult{Changes: blockChanges(testChangeBlock("default-0", "node1"))}
+	testCases := []struct {
+		input string
+		ok    bool
+	}{
+		{"default-0\n", true},
+		{"  default-0  \n", true},
+		{"default-0", true},
+		{"yes\n", false},
+		{"default-1\n", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+		err := confirmChanges(strings.NewReader(tc.input), out, result, "default-0")
+		if tc.ok && err != nil {
+			t.Errorf("input %q should be accepted: %v", tc.input, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("input %q should be rejected", tc.input)
+		}
+		if !strings.Contains(out.String(), `Type "default-0" to make the changes`) {
+			t.Error("unexpected prompt:", out.String())
+		}
+	}
+}
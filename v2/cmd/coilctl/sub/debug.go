@@ -0,0 +1,274 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Thresholds for the advice of `coilctl debug contention`.
+const (
+	// minAllocationsPerBlock is the number of allocations per block request
+	// under which blocks are considered too small for the churn of Pods.
+	minAllocationsPerBlock = 8
+
+	// maxConflictRatio is the ratio of conflicted updates to operations
+	// above which the pool is considered contended.
+	maxConflictRatio = 0.05
+
+	// maxAverageLockWait is the average wait for the pool lock per
+	// allocation or free above which the pool is considered contended.
+	maxAverageLockWait = 100 * time.Millisecond
+
+	// numHotBlocks is the number of blocks shown as hot blocks.
+	numHotBlocks = 5
+)
+
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "debug subcommand",
+	Long:  `Subcommands to inspect the internals of coild on this node.`,
+}
+
+var contentionConfig struct {
+	output  string
+	timeout time.Duration
+}
+
+var debugContentionCmd = &cobra.Command{
+	Use:   "contention",
+	Short: "show contention of address pools on this node",
+	Long: `Show how often the operations on address pools contended on this node.
+
+The statistics are counted by coild since it started.  Allocations and frees
+wait for each other and for block requests on the same pool.  Creating,
+deleting, and handing off blocks and quarantining addresses are optimistic
+updates that are retried when they conflict with others.
+
+Pools that request blocks too often or conflict frequently are reported with
+advice to tune blockSizeBits.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runContention(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	debugContentionCmd.Flags().StringVarP(&contentionConfig.output, "output", "o", "text", "output format: text or json")
+	debugContentionCmd.Flags().DurationVar(&contentionConfig.timeout, "timeout", 10*time.Second, "timeout of the request to coild")
+	debugCmd.AddCommand(debugContentionCmd)
+	rootCmd.AddCommand(debugCmd)
+}
+
+func runContention(w io.Writer) error {
+	if contentionConfig.output != "text" && contentionConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", contentionConfig.output)
+	}
+
+	conn, err := connectCoild()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), contentionConfig.timeout)
+	defer cancel()
+	ctx, err = coildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cnirpc.NewCNIClient(conn).Contention(ctx, &emptypb.Empty{})
+	if err != nil {
+		return fmt.Errorf("failed to get contention: %w", err)
+	}
+
+	if contentionConfig.output == "json" {
+		return writeContentionJSON(w, resp.Pools)
+	}
+	return writeContentionText(w, resp.Pools)
+}
+
+type hotBlockJSON struct {
+	Block       string `json:"block"`
+	Allocations uint64 `json:"allocations"`
+	Frees       uint64 `json:"frees"`
+	Conflicts   uint64 `json:"conflicts"`
+}
+
+type contentionJSON struct {
+	Pool                    string            `json:"pool"`
+	Allocations             uint64            `json:"allocations"`
+	Frees                   uint64            `json:"frees"`
+	BlockRequests           uint64            `json:"block_requests"`
+	BlockRequestWaitSeconds float64           `json:"block_request_wait_seconds"`
+	LockWaitSeconds         float64           `json:"lock_wait_seconds"`
+	Conflicts               map[string]uint64 `json:"conflicts"`
+	HotBlocks               []hotBlockJSON    `json:"hot_blocks"`
+	Advice                  []string          `json:"advice"`
+}
+
+func writeContentionJSON(w io.Writer, pools []*cnirpc.PoolContention) error {
+	l := make([]contentionJSON, 0, len(pools))
+	for _, p := range pools {
+		conflicts := p.Conflicts
+		if conflicts == nil {
+			conflicts = map[string]uint64{}
+		}
+		hot := make([]hotBlockJSON, 0, numHotBlocks)
+		for _, b := range hotBlocks(p.Blocks) {
+			hot = append(hot, hotBlockJSON{
+				Block:       b.Block,
+				Allocations: b.Allocations,
+				Frees:       b.Frees,
+				Conflicts:   b.Conflicts,
+			})
+		}
+		advice := contentionAdvice(p)
+		if advice == nil {
+			advice = []string{}
+		}
+		l = append(l, contentionJSON{
+			Pool:                    p.Pool,
+			Allocations:             p.Allocations,
+			Frees:                   p.Frees,
+			BlockRequests:           p.BlockRequests,
+			BlockRequestWaitSeconds: p.BlockRequestWaitSeconds,
+			LockWaitSeconds:         p.LockWaitSeconds,
+			Conflicts:               conflicts,
+			HotBlocks:               hot,
+			Advice:                  advice,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+func writeContentionText(w io.Writer, pools []*cnirpc.PoolContention) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POOL\tALLOCATIONS\tFREES\tBLOCK REQUESTS\tBLOCK WAIT\tLOCK WAIT\tCONFLICTS")
+	for _, p := range pools {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			p.Pool, p.Allocations, p.Frees, p.BlockRequests,
+			formatSeconds(p.BlockRequestWaitSeconds), formatSeconds(p.LockWaitSeconds),
+			formatConflicts(p.Conflicts))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	var hot []string
+	for _, p := range pools {
+		for _, b := range hotBlocks(p.Blocks) {
+			hot = append(hot, fmt.Sprintf("%s\t%s\t%d\t%d\t%d\n", p.Pool, b.Block, b.Allocations, b.Frees, b.Conflicts))
+		}
+	}
+	if len(hot) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "POOL\tHOT BLOCK\tALLOCATIONS\tFREES\tCONFLICTS")
+		for _, l := range hot {
+			fmt.Fprint(tw, l)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	first := true
+	for _, p := range pools {
+		for _, a := range contentionAdvice(p) {
+			if first {
+				fmt.Fprintln(w)
+				first = false
+			}
+			fmt.Fprintf(w, "%s: %s\n", p.Pool, a)
+		}
+	}
+	return nil
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+func formatConflicts(conflicts map[string]uint64) string {
+	if len(conflicts) == 0 {
+		return "-"
+	}
+	ops := make([]string, 0, len(conflicts))
+	for op := range conflicts {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	l := make([]string, 0, len(ops))
+	for _, op := range ops {
+		l = append(l, fmt.Sprintf("%s=%d", op, conflicts[op]))
+	}
+	return strings.Join(l, ",")
+}
+
+// hotBlocks returns up to numHotBlocks blocks ordered by conflicts and then
+// by the number of allocations and frees.  Blocks without operations are omitted.
+func hotBlocks(blocks []*cnirpc.BlockContention) []*cnirpc.BlockContention {
+	hot := make([]*cnirpc.BlockContention, 0, len(blocks))
+	for _, b := range blocks {
+		if b.Allocations+b.Frees+b.Conflicts > 0 {
+			hot = append(hot, b)
+		}
+	}
+	sort.SliceStable(hot, func(i, j int) bool {
+		if hot[i].Conflicts != hot[j].Conflicts {
+			return hot[i].Conflicts > hot[j].Conflicts
+		}
+		return hot[i].Allocations+hot[i].Frees > hot[j].Allocations+hot[j].Frees
+	})
+	if len(hot) > numHotBlocks {
+		hot = hot[:numHotBlocks]
+	}
+	return hot
+}
+
+// contentionAdvice returns the advice to reduce contention of the pool.
+func contentionAdvice(p *cnirpc.PoolContention) []string {
+	var advice []string
+
+	if p.BlockRequests > 0 && p.Allocations < p.BlockRequests*minAllocationsPerBlock {
+		advice = append(advice, fmt.Sprintf(
+			"a block was requested for every %.1f allocations; consider increasing blockSizeBits",
+			float64(p.Allocations)/float64(p.BlockRequests)))
+	}
+
+	var conflicts uint64
+	for _, n := range p.Conflicts {
+		conflicts += n
+	}
+	ops := p.Allocations + p.Frees + p.BlockRequests
+	if conflicts > 0 && (ops == 0 || float64(conflicts)/float64(ops) > maxConflictRatio) {
+		advice = append(advice, fmt.Sprintf(
+			"%d updates of blocks or the pool conflicted for %d operations; consider increasing blockSizeBits so that blocks are created and deleted less often",
+			conflicts, ops))
+	}
+
+	if n := p.Allocations + p.Frees; n > 0 {
+		avg := time.Duration(p.LockWaitSeconds / float64(n) * float64(time.Second))
+		if avg > maxAverageLockWait {
+			advice = append(advice, fmt.Sprintf(
+				"allocations and frees waited %s on average for block requests; consider increasing blockSizeBits or preallocating blocks",
+				avg.Round(time.Millisecond)))
+		}
+	}
+
+	return advice
+}
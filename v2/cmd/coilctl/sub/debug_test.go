@@ -0,0 +1,120 @@
+package sub
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+)
+
+var testContention = []*cnirpc.PoolContention{
+	{
+		Pool:                    "default",
+		Allocations:             120,
+		Frees:                   98,
+		BlockRequests:           40,
+		BlockRequestWaitSeconds: 6.2,
+		LockWaitSeconds:         4.9,
+		Conflicts:               map[string]uint64{"delete_block": 19, "add_quarantine": 1},
+		Blocks: []*cnirpc.BlockContention{
+			{Block: "default-0"},
+			{Block: "default-3", Allocations: 30, Frees: 25},
+			{Block: "default-12", Allocations: 4, Frees: 4, Conflicts: 3},
+		},
+	},
+	{
+		Pool:        "global",
+		Allocations: 10,
+		Frees:       2,
+	},
+}
+
+func TestContentionAdvice(t *testing.T) {
+	t.Parallel()
+
+	advice := contentionAdvice(testContention[0])
+	if len(advice) != 2 {
+		t.Fatalf("unexpected advice: %v", advice)
+	}
+	if !strings.HasPrefix(advice[0], "a block was requested for every 3.0 allocations") {
+		t.Error("unexpected advice:", advice[0])
+	}
+	if !strings.HasPrefix(advice[1], "20 updates of blocks or the pool conflicted for 258 operations") {
+		t.Error("unexpected advice:", advice[1])
+	}
+
+	if advice := contentionAdvice(testContention[1]); len(advice) != 0 {
+		t.Error("unexpected advice:", advice)
+	}
+
+	slow := &cnirpc.PoolContention{Pool: "slow", Allocations: 10, Frees: 10, LockWaitSeconds: 4}
+	advice = contentionAdvice(slow)
+	if len(advice) != 1 || !strings.Contains(advice[0], "waited 200ms on average") {
+		t.Errorf("unexpected advice: %v", advice)
+	}
+}
+
+func TestWriteContentionText(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	if err := writeContentionText(buf, testContention); err != nil {
+		t.Fatal(err)
+	}
+
+	sections := strings.Split(strings.TrimSpace(buf.String()), "\n\n")
+	if len(sections) != 3 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+
+	pools := strings.Split(sections[0], "\n")
+	if len(pools) != 3 {
+		t.Fatalf("unexpected pools: %s", sections[0])
+	}
+	if fields := strings.Join(strings.Fields(pools[1]), " "); fields != "default 120 98 40 6.2s 4.9s add_quarantine=1,delete_block=19" {
+		t.Error("unexpected line:", pools[1])
+	}
+	if fields := strings.Join(strings.Fields(pools[2]), " "); fields != "global 10 2 0 0s 0s -" {
+		t.Error("unexpected line:", pools[2])
+	}
+
+	hot := strings.Split(sections[1], "\n")
+	if len(hot) != 3 {
+		t.Fatalf("unexpected hot blocks: %s", sections[1])
+	}
+	if !strings.HasPrefix(strings.Join(strings.Fields(hot[1]), " "), "default default-12 4 4 3") {
+		t.Error("unexpected line:", hot[1])
+	}
+	if !strings.HasPrefix(strings.Join(strings.Fields(hot[2]), " "), "default default-3 30 25 0") {
+		t.Error("unexpected line:", hot[2])
+	}
+
+	if strings.Count(sections[2], "default: ") != 2 {
+		t.Error("unexpected advice:", sections[2])
+	}
+}
+
+func TestWriteContentionJSON(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	if err := writeContentionJSON(buf, testContention); err != nil {
+		t.Fatal(err)
+	}
+
+	var l []contentionJSON
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 2 {
+		t.Fatal("unexpected length:", len(l))
+	}
+	if l[0].Pool != "default" || l[0].Conflicts["delete_block"] != 19 || len(l[0].HotBlocks) != 2 || len(l[0].Advice) != 2 {
+		t.Errorf("unexpected entry: %+v", l[0])
+	}
+	if l[1].Conflicts == nil || l[1].HotBlocks == nil || l[1].Advice == nil {
+		t.Errorf("empty fields should be written as empty values: %+v", l[1])
+	}
+}
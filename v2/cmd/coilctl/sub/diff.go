@@ -0,0 +1,306 @@
+package sub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// revisionPrefix marks diff arguments that are revisions rather than files.
+const revisionPrefix = "@"
+
+var diffConfig struct {
+	output  string
+	timeout time.Duration
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff FROM TO",
+	Short: "show changes of pools, blocks, and Pod addresses between two snapshots",
+	Long: `Show AddressPools, AddressBlocks, and Pod addresses added, removed,
+or changed between two snapshots.
+
+A snapshot is a file of Kubernetes objects in YAML or JSON, such as the
+output of "kubectl get addresspools,addressblocks,pods -A -o yaml".
+Objects of other kinds in the file are ignored.
+
+A snapshot can also be the cluster state at a resource version given as
+"@REVISION", or the latest state given as "@".  Pod addresses are compared
+only when both snapshots contain Pods.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runDiff(cmd.OutOrStdout(), args[0], args[1])
+	},
+}
+
+func init() {
+	fs := diffCmd.Flags()
+	fs.StringVarP(&diffConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&diffConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(w io.Writer, from, to string) error {
+	if diffConfig.output != "text" && diffConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", diffConfig.output)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diffConfig.timeout)
+	defer cancel()
+	before, err := loadSnapshot(ctx, from)
+	if err != nil {
+		return err
+	}
+	after, err := loadSnapshot(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	changes := diffSnapshots(before, after)
+	if diffConfig.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	return writeDiffText(w, changes)
+}
+
+// snapshot is the state of address assignments.
+// Each map has a summary of objects keyed by their names.
+type snapshot struct {
+	pools  map[string]string
+	blocks map[string]string
+	pods   map[string]string
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		pools:  make(map[string]string),
+		blocks: make(map[string]string),
+	}
+}
+
+func (s *snapshot) addPool(p *coilv2.AddressPool) {
+	data, err := json.Marshal(p.Spec)
+	if err != nil {
+		panic(err)
+	}
+	s.pools[p.Name] = string(data)
+}
+
+func (s *snapshot) addBlock(b *coilv2.AddressBlock) {
+	fields := []string{
+		"pool=" + b.Labels[constants.LabelPool],
+		"node=" + b.Labels[constants.LabelNode],
+	}
+	if b.IPv4 != nil {
+		fields = append(fields, "ipv4="+*b.IPv4)
+	}
+	if b.IPv6 != nil {
+		fields = append(fields, "ipv6="+*b.IPv6)
+	}
+	s.blocks[b.Name] = strings.Join(fields, " ")
+}
+
+func (s *snapshot) addPod(p *corev1.Pod) {
+	if s.pods == nil {
+		s.pods = make(map[string]string)
+	}
+	if p.Spec.HostNetwork || len(p.Status.PodIPs) == 0 {
+		return
+	}
+	ips := make([]string, len(p.Status.PodIPs))
+	for i, ip := range p.Status.PodIPs {
+		ips[i] = ip.IP
+	}
+	s.pods[p.Namespace+"/"+p.Name] = strings.Join(ips, ",")
+}
+
+func loadSnapshot(ctx context.Context, source string) (*snapshot, error) {
+	if strings.HasPrefix(source, revisionPrefix) {
+		return readSnapshot(ctx, strings.TrimPrefix(source, revisionPrefix))
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	s, err := decodeSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", source, err)
+	}
+	return s, nil
+}
+
+// readSnapshot reads the cluster state as of `revision`.
+// If `revision` is empty, the latest state is read.
+func readSnapshot(ctx context.Context, revision string) (*snapshot, error) {
+	c, err := newKubeClientAt(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSnapshot()
+	pools := &coilv2.AddressPoolList{}
+	if err := c.List(ctx, pools); err != nil {
+		return nil, fmt.Errorf("failed to list AddressPools: %w", err)
+	}
+	for i := range pools.Items {
+		s.addPool(&pools.Items[i])
+	}
+	blocks := &coilv2.AddressBlockList{}
+	if err := c.List(ctx, blocks); err != nil {
+		return nil, fmt.Errorf("failed to list AddressBlocks: %w", err)
+	}
+	for i := range blocks.Items {
+		s.addBlock(&blocks.Items[i])
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods); err != nil {
+		return nil, fmt.Errorf("failed to list Pods: %w", err)
+	}
+	s.pods = make(map[string]string)
+	for i := range pods.Items {
+		s.addPod(&pods.Items[i])
+	}
+	return s, nil
+}
+
+// decodeSnapshot decodes YAML or JSON documents of Kubernetes objects.
+func decodeSnapshot(data []byte) (*snapshot, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	s := newSnapshot()
+
+	var add func(raw []byte) error
+	add = func(raw []byte) error {
+		obj, _, err := decoder.Decode(raw, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch o := obj.(type) {
+		case *corev1.List:
+			for _, item := range o.Items {
+				if err := add(item.Raw); err != nil {
+					return err
+				}
+			}
+		case *coilv2.AddressPool:
+			s.addPool(o)
+		case *coilv2.AddressPoolList:
+			for i := range o.Items {
+				s.addPool(&o.Items[i])
+			}
+		case *coilv2.AddressBlock:
+			s.addBlock(o)
+		case *coilv2.AddressBlockList:
+			for i := range o.Items {
+				s.addBlock(&o.Items[i])
+			}
+		case *corev1.Pod:
+			s.addPod(o)
+		case *corev1.PodList:
+			for i := range o.Items {
+				s.addPod(&o.Items[i])
+			}
+		}
+		return nil
+	}
+
+	r := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw runtime.RawExtension
+		err := r.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue
+		}
+		if err := add(raw.Raw); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// snapshotChange represents an object added, removed, or changed between snapshots.
+type snapshotChange struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func diffSnapshots(before, after *snapshot) []snapshotChange {
+	changes := []snapshotChange{}
+	changes = append(changes, diffObjects("AddressPool", before.pools, after.pools)...)
+	changes = append(changes, diffObjects("AddressBlock", before.blocks, after.blocks)...)
+	if before.pods != nil && after.pods != nil {
+		changes = append(changes, diffObjects("Pod", before.pods, after.pods)...)
+	}
+	return changes
+}
+
+func diffObjects(kind string, before, after map[string]string) []snapshotChange {
+	var changes []snapshotChange
+	for name, b := range before {
+		a, ok := after[name]
+		switch {
+		case !ok:
+			changes = append(changes, snapshotChange{Kind: kind, Name: name, Change: "removed", Before: b})
+		case a != b:
+			changes = append(changes, snapshotChange{Kind: kind, Name: name, Change: "changed", Before: b, After: a})
+		}
+	}
+	for name, a := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, snapshotChange{Kind: kind, Name: name, Change: "added", After: a})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func writeDiffText(w io.Writer, changes []snapshotChange) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tCHANGE\tBEFORE\tAFTER")
+	for _, c := range changes {
+		b, a := c.Before, c.After
+		if b == "" {
+			b = "-"
+		}
+		if a == "" {
+			a = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Kind, c.Name, c.Change, b, a)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,138 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testSnapshot1 = `apiVersion: v1
+kind: List
+items:
+- apiVersion: coil.cybozu.com/v2
+  kind: AddressPool
+  metadata:
+    name: default
+  spec:
+    blockSizeBits: 5
+    subnets:
+    - ipv4: 10.2.0.0/24
+- apiVersion: coil.cybozu.com/v2
+  kind: AddressBlock
+  metadata:
+    name: default-0
+    labels:
+      coil.cybozu.com/pool: default
+      coil.cybozu.com/node: node1
+  index: 0
+  ipv4: 10.2.0.0/27
+- apiVersion: coil.cybozu.com/v2
+  kind: AddressBlock
+  metadata:
+    name: default-1
+    labels:
+      coil.cybozu.com/pool: default
+      coil.cybozu.com/node: node2
+  index: 1
+  ipv4: 10.2.0.32/27
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo
+    namespace: default
+`
+
+const testSnapshot2 = `apiVersion: coil.cybozu.com/v2
+kind: AddressPool
+metadata:
+  name: default
+spec:
+  blockSizeBits: 5
+  subnets:
+  - ipv4: 10.2.0.0/24
+---
+apiVersion: coil.cybozu.com/v2
+kind: AddressBlock
+metadata:
+  name: default-0
+  labels:
+    coil.cybozu.com/pool: default
+    coil.cybozu.com/node: node3
+index: 0
+ipv4: 10.2.0.0/27
+---
+apiVersion: coil.cybozu.com/v2
+kind: AddressBlock
+metadata:
+  name: default-2
+  labels:
+    coil.cybozu.com/pool: default
+    coil.cybozu.com/node: node1
+index: 2
+ipv4: 10.2.0.64/27
+---
+apiVersion: v1
+kind: PodList
+items:
+- metadata:
+    name: pod1
+    namespace: default
+  spec:
+    containers:
+    - name: c1
+      image: nginx
+  status:
+    podIPs:
+    - ip: 10.2.0.65
+`
+
+func TestDiffSnapshots(t *testing.T) {
+	t.Parallel()
+
+	s1, err := decodeSnapshot([]byte(testSnapshot1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := decodeSnapshot([]byte(testSnapshot2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s1.pools) != 1 || len(s1.blocks) != 2 || s1.pods != nil {
+		t.Fatalf("unexpected snapshot: %+v", s1)
+	}
+	if s2.pods["default/pod1"] != "10.2.0.65" {
+		t.Errorf("unexpected pods: %+v", s2.pods)
+	}
+
+	changes := diffSnapshots(s1, s2)
+	expected := []snapshotChange{
+		{Kind: "AddressBlock", Name: "default-0", Change: "changed",
+			Before: "pool=default node=node1 ipv4=10.2.0.0/27", After: "pool=default node=node3 ipv4=10.2.0.0/27"},
+		{Kind: "AddressBlock", Name: "default-1", Change: "removed", Before: "pool=default node=node2 ipv4=10.2.0.32/27"},
+		{Kind: "AddressBlock", Name: "default-2", Change: "added", After: "pool=default node=node1 ipv4=10.2.0.64/27"},
+	}
+	if !cmp.Equal(changes, expected) {
+		t.Error("unexpected changes:", cmp.Diff(changes, expected))
+	}
+
+	s1.pods = map[string]string{"default/pod1": "10.2.0.1"}
+	changes = diffSnapshots(s1, s2)
+	if len(changes) != 4 || changes[3].Kind != "Pod" || changes[3].Change != "changed" {
+		t.Error("Pod addresses should be compared:", changes)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeDiffText(buf, changes); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "KIND") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	if _, err := decodeSnapshot([]byte("kind: AddressPool\napiVersion: coil.cybozu.com/v2\nspec: [")); err == nil {
+		t.Error("broken snapshot should be rejected")
+	}
+}
@@ -0,0 +1,144 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/routeaudit"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errProblemsFound is returned when doctor finds problems so that coilctl exits with non-zero status.
+var errProblemsFound = errors.New("problems found")
+
+var doctorConfig struct {
+	routes    bool
+	namespace string
+	port      int
+	output    string
+	timeout   time.Duration
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "diagnose Coil in the cluster",
+	Long: `Diagnose Coil in the cluster and report problems.
+
+With --routes, compare the routes of address blocks exported by coild on
+every node with AddressBlocks assigned to the node.  The routes are fetched
+from the metrics endpoint of coild through the proxy of kube-apiserver.
+
+coilctl exits with non-zero status if problems are found.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		if !doctorConfig.routes {
+			return errors.New("no check is specified; use --routes")
+		}
+		return runDoctorRoutes(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	fs := doctorCmd.Flags()
+	fs.BoolVar(&doctorConfig.routes, "routes", false, "check routes exported by coild on every node")
+	fs.StringVar(&doctorConfig.namespace, "namespace", "kube-system", "namespace where Coil is running")
+	fs.IntVar(&doctorConfig.port, "coild-metrics-port", 9384, "port number of the metrics endpoint of coild")
+	fs.StringVarP(&doctorConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&doctorConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctorRoutes(w io.Writer) error {
+	if doctorConfig.output != "text" && doctorConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", doctorConfig.output)
+	}
+
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorConfig.timeout)
+	defer cancel()
+	report, err := routeaudit.Audit(ctx, c, doctorConfig.namespace, proxyFetcher(cs, doctorConfig.port))
+	if err != nil {
+		return err
+	}
+
+	if doctorConfig.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := writeRouteReport(w, report); err != nil {
+		return err
+	}
+
+	for _, res := range report.Nodes {
+		if !res.OK() {
+			return errProblemsFound
+		}
+	}
+	return nil
+}
+
+// proxyFetcher returns a Fetcher that requests coild through the Pod proxy of kube-apiserver.
+func proxyFetcher(cs kubernetes.Interface, port int) routeaudit.Fetcher {
+	return func(ctx context.Context, pod *corev1.Pod) (*routeaudit.NodeRoutes, error) {
+		data, err := cs.CoreV1().Pods(pod.Namespace).
+			ProxyGet("http", pod.Name, strconv.Itoa(port), routeaudit.StatusPath, nil).
+			DoRaw(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nr := &routeaudit.NodeRoutes{}
+		if err := json.Unmarshal(data, nr); err != nil {
+			return nil, fmt.Errorf("failed to decode the response of %s: %w", pod.Name, err)
+		}
+		return nr, nil
+	}
+}
+
+func writeRouteReport(w io.Writer, report *routeaudit.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tSTATUS\tMISSING\tEXTRA")
+	for _, res := range report.Nodes {
+		status := "OK"
+		switch {
+		case res.Error != "":
+			status = "ERROR: " + res.Error
+		case !res.OK():
+			status = "INCONSISTENT"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Node, status, joinOrDash(res.Missing), joinOrDash(res.Extra))
+	}
+	return tw.Flush()
+}
+
+func joinOrDash(l []string) string {
+	if len(l) == 0 {
+		return "-"
+	}
+	return strings.Join(l, ",")
+}
@@ -0,0 +1,39 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/routeaudit"
+)
+
+func TestWriteRouteReport(t *testing.T) {
+	t.Parallel()
+
+	report := &routeaudit.Report{Nodes: []routeaudit.NodeResult{
+		{Node: "node1", Missing: []string{"10.2.0.2/31"}, Extra: []string{"10.2.0.6/31", "fd02::6/127"}},
+		{Node: "node2"},
+		{Node: "node3", Error: "connection refused"},
+	}}
+	buf := &bytes.Buffer{}
+	if err := writeRouteReport(buf, report); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatal("unexpected output:", buf.String())
+	}
+	expected := [][]string{
+		{"NODE", "STATUS", "MISSING", "EXTRA"},
+		{"node1", "INCONSISTENT", "10.2.0.2/31", "10.2.0.6/31,fd02::6/127"},
+		{"node2", "OK", "-", "-"},
+		{"node3", "ERROR:", "connection", "refused", "-", "-"},
+	}
+	for i, l := range lines {
+		if f := strings.Fields(l); strings.Join(f, " ") != strings.Join(expected[i], " ") {
+			t.Errorf("unexpected line %d: %s", i, l)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var gcConfig changeConfig
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "release address blocks of deleted nodes now",
+	Long: `Release AddressBlocks of deleted nodes now instead of waiting
+for the next garbage collection by coil-controller.
+
+Blocks of nodes that still exist are not released even if the nodes
+are dead.  They are reclaimed by coil-controller after approval.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runChange(cmd, &gcConfig, "gc", planGC)
+	},
+}
+
+func init() {
+	addChangeFlags(gcCmd.Flags(), &gcConfig)
+	rootCmd.AddCommand(gcCmd)
+}
+
+func planGC(ctx context.Context, r client.Reader) ([]objectChange, error) {
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodeNames := make(map[string]bool)
+	for _, n := range nodes.Items {
+		nodeNames[n.Name] = true
+	}
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.List(ctx, blocks); err != nil {
+		return nil, fmt.Errorf("failed to list AddressBlocks: %w", err)
+	}
+
+	var changes []objectChange
+	for i := range blocks.Items {
+		b := &blocks.Items[i]
+		if nodeNames[b.Labels[constants.LabelNode]] {
+			continue
+		}
+		changes = append(changes, blockChanges(b)...)
+	}
+	return changes, nil
+}
@@ -0,0 +1,213 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/spf13/cobra"
+)
+
+var ipFreeConfig struct {
+	namespace string
+	pod       string
+	ips       []string
+	force     bool
+	dryRun    bool
+	output    string
+	timeout   time.Duration
+}
+
+var ipFreeAllConfig struct {
+	namespace string
+	confirm   bool
+	output    string
+	timeout   time.Duration
+}
+
+var ipCmd = &cobra.Command{
+	Use:   "ip",
+	Short: "manage addresses of Pods on this node",
+}
+
+var ipFreeCmd = &cobra.Command{
+	Use:   "free",
+	Short: "free the addresses of a Pod on this node",
+	Long: `Free the addresses of a Pod on this node through coild.
+
+coild locates the addresses by --ip if given.  Otherwise, they are located
+by the Pod IP addresses if the Pod exists, or by the record of the Pod kept
+by coild since it started.  coild then destroys the Pod network including
+its routes, and returns the addresses to the pool.
+
+The addresses of an existing Pod are not freed unless --force is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runIPFree(cmd.OutOrStdout())
+	},
+}
+
+var ipFreeAllCmd = &cobra.Command{
+	Use:   "free-all",
+	Short: "free the addresses of all deleted Pods in a namespace on this node",
+	Long: `Free the addresses of all Pods in a namespace on this node through coild.
+
+This is useful after deleting a namespace whose Pods were removed forcibly
+without DEL from the container runtime.  coild verifies that each Pod has
+been deleted and skips existing Pods.  The addresses are located by the
+records of the Pods kept by coild since it started, so free the addresses
+of Pods deleted before the restart of coild by "coilctl ip free --ip".
+The addresses held for Pods in the namespace are also freed.
+
+Without --confirm, this only prints the addresses that would be freed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runIPFreeAll(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	fs := ipFreeCmd.Flags()
+	fs.StringVar(&ipFreeConfig.namespace, "namespace", "", "namespace of the Pod")
+	fs.StringVar(&ipFreeConfig.pod, "pod", "", "name of the Pod")
+	fs.StringSliceVar(&ipFreeConfig.ips, "ip", nil, "addresses of the Pod to locate its assignment")
+	fs.BoolVar(&ipFreeConfig.force, "force", false, "free the addresses even if the Pod exists")
+	fs.BoolVar(&ipFreeConfig.dryRun, "dry-run", false, "only print the addresses that would be freed")
+	fs.StringVarP(&ipFreeConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&ipFreeConfig.timeout, "timeout", 30*time.Second, "timeout of the request to coild")
+	ipCmd.AddCommand(ipFreeCmd)
+
+	fs = ipFreeAllCmd.Flags()
+	fs.StringVar(&ipFreeAllConfig.namespace, "namespace", "", "namespace of the Pods")
+	fs.BoolVar(&ipFreeAllConfig.confirm, "confirm", false, "free the addresses instead of only printing them")
+	fs.StringVarP(&ipFreeAllConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&ipFreeAllConfig.timeout, "timeout", 30*time.Second, "timeout of the request to coild")
+	ipCmd.AddCommand(ipFreeAllCmd)
+	rootCmd.AddCommand(ipCmd)
+}
+
+func runIPFree(w io.Writer) error {
+	if ipFreeConfig.namespace == "" || ipFreeConfig.pod == "" {
+		return errors.New("--namespace and --pod are required")
+	}
+	if ipFreeConfig.output != "text" && ipFreeConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", ipFreeConfig.output)
+	}
+
+	conn, err := connectCoild()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ipFreeConfig.timeout)
+	defer cancel()
+	ctx, err = coildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cnirpc.NewCNIClient(conn).ForceFree(ctx, &cnirpc.ForceFreeRequest{
+		PodNamespace: ipFreeConfig.namespace,
+		PodName:      ipFreeConfig.pod,
+		Ips:          ipFreeConfig.ips,
+		Force:        ipFreeConfig.force,
+		DryRun:       ipFreeConfig.dryRun,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to free the addresses: %w", err)
+	}
+
+	if ipFreeConfig.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	writeForceFree(w, ipFreeConfig.namespace+"/"+ipFreeConfig.pod, resp)
+	return nil
+}
+
+func writeForceFree(w io.Writer, pod string, resp *cnirpc.ForceFreeResponse) {
+	verb := "freed"
+	if !resp.Freed {
+		verb = "would free"
+	}
+	fmt.Fprintf(w, "%s %s of %s from pool %s (container %s, interface %s)\n",
+		verb, strings.Join(resp.Ips, ", "), pod, resp.Pool, resp.ContainerId, resp.Ifname)
+	if !resp.Freed {
+		fmt.Fprintln(w, "dry run: no changes were made")
+	}
+}
+
+func runIPFreeAll(w io.Writer) error {
+	if ipFreeAllConfig.namespace == "" {
+		return errors.New("--namespace is required")
+	}
+	if ipFreeAllConfig.output != "text" && ipFreeAllConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", ipFreeAllConfig.output)
+	}
+
+	conn, err := connectCoild()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ipFreeAllConfig.timeout)
+	defer cancel()
+	ctx, err = coildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cnirpc.NewCNIClient(conn).FreeNamespace(ctx, &cnirpc.FreeNamespaceRequest{
+		PodNamespace: ipFreeAllConfig.namespace,
+		DryRun:       !ipFreeAllConfig.confirm,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to free the addresses: %w", err)
+	}
+
+	if ipFreeAllConfig.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	writeFreeNamespace(w, ipFreeAllConfig.namespace, resp)
+	return nil
+}
+
+func writeFreeNamespace(w io.Writer, namespace string, resp *cnirpc.FreeNamespaceResponse) {
+	verb := "freed"
+	if !resp.Freed {
+		verb = "would free"
+	}
+	for _, p := range resp.Pods {
+		ips := strings.Join(p.Ips, ", ")
+		if ips == "" {
+			ips = "addresses"
+		}
+		// held addresses have no container.
+		if p.ContainerId == "" {
+			fmt.Fprintf(w, "%s %s held for %s/%s in pool %s\n", verb, ips, namespace, p.PodName, p.Pool)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s of %s/%s (container %s, interface %s)\n", verb, ips, namespace, p.PodName, p.ContainerId, p.Ifname)
+	}
+	if len(resp.Pods) == 0 {
+		fmt.Fprintf(w, "no addresses to free in namespace %s\n", namespace)
+	}
+	if len(resp.SkippedPods) > 0 {
+		fmt.Fprintf(w, "skipped existing Pods: %s\n", strings.Join(resp.SkippedPods, ", "))
+	}
+	if !resp.Freed {
+		fmt.Fprintln(w, "dry run: no changes were made; specify --confirm to free the addresses")
+	}
+}
@@ -0,0 +1,65 @@
+package sub
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+)
+
+func TestWriteForceFree(t *testing.T) {
+	t.Parallel()
+
+	resp := &cnirpc.ForceFreeResponse{
+		Pool:        "default",
+		ContainerId: "abc",
+		Ifname:      "eth0",
+		Ips:         []string{"10.2.0.1", "fd02::1"},
+	}
+	buf := &bytes.Buffer{}
+	writeForceFree(buf, "app/web-1", resp)
+	expected := `would free 10.2.0.1, fd02::1 of app/web-1 from pool default (container abc, interface eth0)
+dry run: no changes were made
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	resp.Freed = true
+	buf.Reset()
+	writeForceFree(buf, "app/web-1", resp)
+	expected = "freed 10.2.0.1, fd02::1 of app/web-1 from pool default (container abc, interface eth0)\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestWriteFreeNamespace(t *testing.T) {
+	t.Parallel()
+
+	resp := &cnirpc.FreeNamespaceResponse{
+		Pods: []*cnirpc.FreedPod{
+			{PodName: "web-1", Pool: "default", ContainerId: "abc", Ifname: "eth0", Ips: []string{"10.2.0.1"}},
+			{PodName: "web-2", ContainerId: "def", Ifname: "eth0"},
+			{PodName: "web-3", Pool: "default", Ifname: "hold", Ips: []string{"10.2.0.3"}},
+		},
+		SkippedPods: []string{"db-0"},
+	}
+	buf := &bytes.Buffer{}
+	writeFreeNamespace(buf, "test", resp)
+	expected := `would free 10.2.0.1 of test/web-1 (container abc, interface eth0)
+would free addresses of test/web-2 (container def, interface eth0)
+would free 10.2.0.3 held for test/web-3 in pool default
+skipped existing Pods: db-0
+dry run: no changes were made; specify --confirm to free the addresses
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	buf.Reset()
+	writeFreeNamespace(buf, "test", &cnirpc.FreeNamespaceResponse{Freed: true})
+	if buf.String() != "no addresses to free in namespace test\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
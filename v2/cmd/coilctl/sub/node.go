@@ -0,0 +1,82 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/loglevel"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var nodeLogLevelConfig struct {
+	timeout time.Duration
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "manage coild on this node",
+}
+
+var nodeLogLevelCmd = &cobra.Command{
+	Use:   "loglevel [LEVEL]",
+	Short: "show or change the log level of coild on this node",
+	Long: `Show or change the log level of coild on this node.
+
+LEVEL is one of debug, info, error, or an integer greater than 0
+for more verbose logs, as --zap-log-level of coild.  The change
+is lost when coild restarts.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		var level string
+		if len(args) == 1 {
+			level = args[0]
+		}
+		return runNodeLogLevel(cmd.OutOrStdout(), level)
+	},
+}
+
+func init() {
+	nodeLogLevelCmd.Flags().DurationVar(&nodeLogLevelConfig.timeout, "timeout", 10*time.Second, "timeout of the request to coild")
+	nodeCmd.AddCommand(nodeLogLevelCmd)
+	rootCmd.AddCommand(nodeCmd)
+}
+
+func runNodeLogLevel(w io.Writer, level string) error {
+	if level != "" {
+		if _, err := loglevel.Parse(level); err != nil {
+			return err
+		}
+	}
+
+	conn, err := connectCoild()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), nodeLogLevelConfig.timeout)
+	defer cancel()
+	ctx, err = coildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	client := cnirpc.NewCNIClient(conn)
+	var resp *cnirpc.LogLevel
+	if level == "" {
+		resp, err = client.GetLogLevel(ctx, &emptypb.Empty{})
+	} else {
+		resp, err = client.SetLogLevel(ctx, &cnirpc.LogLevel{Level: level})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to access the log level: %w", err)
+	}
+
+	fmt.Fprintf(w, "log level: %s\n", resp.Level)
+	return nil
+}
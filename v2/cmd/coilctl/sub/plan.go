@@ -0,0 +1,246 @@
+package sub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// maxPlanBlockSizeBits limits the candidates of block sizes.
+const maxPlanBlockSizeBits = 12
+
+var planConfig struct {
+	pool             string
+	percentile       float64
+	maxBlocksPerNode int
+	timeout          time.Duration
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "recommend the block size of an address pool",
+	Long: `Recommend the block size of an address pool from the observed number
+of addresses allocated on each node.
+
+The recommended size is the smallest one with which a node at the given
+percentile needs at most --max-blocks-per-node blocks.  Smaller blocks waste
+fewer addresses, while more blocks per node mean more routes and more
+block requests to coil-controller.
+
+Since blockSizeBits of an AddressPool cannot be changed, apply the proposed
+configuration to a new pool.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runPlan(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	fs := planCmd.Flags()
+	fs.StringVar(&planConfig.pool, "pool", constants.DefaultPool, "name of the address pool")
+	fs.Float64Var(&planConfig.percentile, "percentile", 95, "percentile of nodes by the number of addresses to fit in --max-blocks-per-node blocks")
+	fs.IntVar(&planConfig.maxBlocksPerNode, "max-blocks-per-node", 2, "acceptable number of blocks per node")
+	fs.DurationVar(&planConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	addKubeFlags(fs)
+	rootCmd.AddCommand(planCmd)
+}
+
+func runPlan(w io.Writer) error {
+	if planConfig.percentile <= 0 || planConfig.percentile > 100 {
+		return fmt.Errorf("--percentile must be in (0, 100]")
+	}
+	if planConfig.maxBlocksPerNode < 1 {
+		return fmt.Errorf("--max-blocks-per-node must be positive")
+	}
+
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), planConfig.timeout)
+	defer cancel()
+	ap := &coilv2.AddressPool{}
+	if err := c.Get(ctx, client.ObjectKey{Name: planConfig.pool}, ap); err != nil {
+		return fmt.Errorf("failed to get AddressPool %s: %w", planConfig.pool, err)
+	}
+	usages, err := ipam.ListBlockUsage(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	perNode := make(map[string]int)
+	for _, u := range usages {
+		if u.Pool == ap.Name {
+			perNode[u.Node] += u.Allocated
+		}
+	}
+	if len(perNode) == 0 {
+		return fmt.Errorf("no nodes have address blocks of %s", ap.Name)
+	}
+	demands := make([]int, 0, len(perNode))
+	for _, n := range perNode {
+		demands = append(demands, n)
+	}
+
+	maxBits := maxPlanBlockSizeBits
+	if hb := poolHostBits(ap); hb < maxBits {
+		maxBits = hb
+	}
+	candidates, recommended := planBlockSize(demands, maxBits, planConfig.percentile, planConfig.maxBlocksPerNode)
+	if err := writePlanText(w, ap, len(demands), candidates, recommended); err != nil {
+		return err
+	}
+	if recommended < 0 {
+		fmt.Fprintln(w, "\nNo block size satisfies the conditions.")
+		return nil
+	}
+	fmt.Fprintln(w)
+	return writePoolDiff(w, ap, int32(recommended))
+}
+
+// poolHostBits returns the number of host bits of the smallest subnet in the pool.
+func poolHostBits(ap *coilv2.AddressPool) int {
+	hostBits := math.MaxInt32
+	for _, ss := range ap.Spec.Subnets {
+		for _, s := range []*string{ss.IPv4, ss.IPv6} {
+			if s == nil {
+				continue
+			}
+			_, n, err := net.ParseCIDR(*s)
+			if err != nil {
+				continue
+			}
+			ones, bits := n.Mask.Size()
+			if bits-ones < hostBits {
+				hostBits = bits - ones
+			}
+		}
+	}
+	return hostBits
+}
+
+type blockSizeCandidate struct {
+	bits          int
+	blocks        int
+	reserved      int
+	allocated     int
+	maxBlocksNode int
+}
+
+// wasteRatio returns the ratio of addresses reserved in blocks but not allocated.
+func (c blockSizeCandidate) wasteRatio() float64 {
+	if c.reserved == 0 {
+		return 0
+	}
+	return float64(c.reserved-c.allocated) / float64(c.reserved)
+}
+
+// planBlockSize evaluates block sizes from 0 to `maxBits` bits for nodes
+// having `demands` addresses each.  It returns the candidates and the
+// smallest bits with which the node at `percentile` needs at most
+// `maxBlocks` blocks, or -1 if there is no such size.
+func planBlockSize(demands []int, maxBits int, percentile float64, maxBlocks int) ([]blockSizeCandidate, int) {
+	sorted := append([]int(nil), demands...)
+	sort.Ints(sorted)
+	idx := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	target := sorted[idx]
+
+	var candidates []blockSizeCandidate
+	recommended := -1
+	for bits := 0; bits <= maxBits; bits++ {
+		size := 1 << bits
+		c := blockSizeCandidate{bits: bits}
+		for _, n := range sorted {
+			blocks := (n + size - 1) / size
+			c.blocks += blocks
+			c.reserved += blocks * size
+			c.allocated += n
+			if blocks > c.maxBlocksNode {
+				c.maxBlocksNode = blocks
+			}
+		}
+		candidates = append(candidates, c)
+		if recommended < 0 && (target+size-1)/size <= maxBlocks {
+			recommended = bits
+		}
+	}
+	return candidates, recommended
+}
+
+func writePlanText(w io.Writer, ap *coilv2.AddressPool, nodes int, candidates []blockSizeCandidate, recommended int) error {
+	fmt.Fprintf(w, "Pool %s: %d nodes, current blockSizeBits %d\n\n", ap.Name, nodes, ap.Spec.BlockSizeBits)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BITS\tBLOCK SIZE\tBLOCKS\tMAX BLOCKS/NODE\tRESERVED\tWASTE\t")
+	for _, c := range candidates {
+		mark := ""
+		switch {
+		case c.bits == recommended:
+			mark = "recommended"
+		case c.bits == int(ap.Spec.BlockSizeBits):
+			mark = "current"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%.1f%%\t%s\n",
+			c.bits, 1<<c.bits, c.blocks, c.maxBlocksNode, c.reserved, c.wasteRatio()*100, mark)
+	}
+	return tw.Flush()
+}
+
+// writePoolDiff writes the difference between the current and proposed pool
+// specifications in the unified diff format.
+func writePoolDiff(w io.Writer, ap *coilv2.AddressPool, bits int32) error {
+	proposed := ap.Spec.DeepCopy()
+	proposed.BlockSizeBits = bits
+
+	oldData, err := yaml.Marshal(map[string]interface{}{"spec": ap.Spec})
+	if err != nil {
+		return err
+	}
+	newData, err := yaml.Marshal(map[string]interface{}{"spec": proposed})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "--- %s (current)\n+++ %s (proposed)\n", ap.Name, ap.Name)
+	oldLines := readLines(oldData)
+	newLines := readLines(newData)
+	// Only blockSizeBits changes, so the lines correspond one to one.
+	for i := range oldLines {
+		if i < len(newLines) && oldLines[i] == newLines[i] {
+			fmt.Fprintf(w, " %s\n", oldLines[i])
+			continue
+		}
+		fmt.Fprintf(w, "-%s\n", oldLines[i])
+		if i < len(newLines) {
+			fmt.Fprintf(w, "+%s\n", newLines[i])
+		}
+	}
+	return nil
+}
+
+func readLines(data []byte) []string {
+	var lines []string
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
@@ -0,0 +1,51 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPlanBlockSize(t *testing.T) {
+	t.Parallel()
+
+	demands := []int{10, 12, 14, 20, 30, 100}
+	candidates, recommended := planBlockSize(demands, 6, 80, 2)
+	if len(candidates) != 7 {
+		t.Fatalf("unexpected candidates: %+v", candidates)
+	}
+	// the 80th percentile is 30, which fits in 2 blocks of 16 addresses.
+	if recommended != 4 {
+		t.Error("unexpected recommendation:", recommended)
+	}
+
+	c := candidates[4]
+	if c.blocks != 1+1+1+2+2+7 || c.maxBlocksNode != 7 || c.allocated != 186 || c.reserved != 14*16 {
+		t.Errorf("unexpected candidate: %+v", c)
+	}
+	if candidates[0].wasteRatio() != 0 {
+		t.Error("blocks of one address should not waste addresses")
+	}
+
+	_, recommended = planBlockSize(demands, 3, 100, 1)
+	if recommended != -1 {
+		t.Error("no size should be recommended:", recommended)
+	}
+}
+
+func TestWritePoolDiff(t *testing.T) {
+	t.Parallel()
+
+	ap := testPool("10.0.0.0/16", 5)
+	buf := &bytes.Buffer{}
+	if err := writePoolDiff(buf, ap, 4); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "\n-  blockSizeBits: 5\n+  blockSizeBits: 4\n") {
+		t.Error("unexpected diff:", out)
+	}
+	if !strings.Contains(out, "\n   - ipv4: 10.0.0.0/16\n") {
+		t.Error("unchanged lines should be kept:", out)
+	}
+}
@@ -0,0 +1,418 @@
+package sub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var poolDeleteConfig changeConfig
+
+var poolCreateConfig struct {
+	changeConfig
+	size           string
+	ipv6           bool
+	blockSizeBits  int32
+	supernets      []string
+	exclusionsFile string
+}
+
+// maxExclusions limits the number of excluded addresses so that the
+// AddressPool stays well below the size limit of etcd.
+const maxExclusions = 16384
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "manage address pools",
+}
+
+var poolDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "delete an address pool",
+	Long: `Delete an AddressPool.
+
+coil-controller keeps the pool until all of its address blocks are
+released, so Pods using the pool are not affected immediately.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runChange(cmd, &poolDeleteConfig, args[0], planPoolDelete(args[0]))
+	},
+}
+
+var poolCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "create an address pool curved out of a supernet",
+	Long: `Create an AddressPool with a subnet of the size given by --size.
+
+The subnet is the first one in the supernets that overlaps no existing
+pools.  The supernets are read from spec.supernets of the CoilConfig
+named "default" unless --supernet is given.  The supernet is recorded
+in coil.cybozu.com/supernet annotation of the pool.
+
+--exclusions-file reads addresses in use by other systems, such as leases
+of a DHCP server.  Each line is an address, a CIDR, or a range like
+"10.0.0.10-10.0.0.20".  Empty lines and lines starting with "#" are
+ignored.  The addresses in the subnet are added to spec.quarantine of
+the pool so that they are never assigned to Pods.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runPoolCreate(cmd, args[0])
+	},
+}
+
+func init() {
+	fs := poolCreateCmd.Flags()
+	fs.StringVar(&poolCreateConfig.size, "size", "", "prefix length of the subnet, e.g. /20")
+	fs.BoolVar(&poolCreateConfig.ipv6, "ipv6", false, "curve an IPv6 subnet instead of IPv4")
+	fs.Int32Var(&poolCreateConfig.blockSizeBits, "block-size-bits", 5, "blockSizeBits of the pool")
+	fs.StringSliceVar(&poolCreateConfig.supernets, "supernet", nil, "supernets to curve the subnet out of instead of those of CoilConfig")
+	fs.StringVar(&poolCreateConfig.exclusionsFile, "exclusions-file", "", "file of addresses or ranges in use to be excluded from the pool")
+	addChangeFlags(fs, &poolCreateConfig.changeConfig)
+	poolCreateCmd.MarkFlagRequired("size")
+	poolCmd.AddCommand(poolCreateCmd)
+
+	addChangeFlags(poolDeleteCmd.Flags(), &poolDeleteConfig)
+	poolCmd.AddCommand(poolDeleteCmd)
+	rootCmd.AddCommand(poolCmd)
+}
+
+func planPoolDelete(name string) changePlanner {
+	return func(ctx context.Context, r client.Reader) ([]objectChange, error) {
+		ap := &coilv2.AddressPool{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name}, ap); err != nil {
+			return nil, fmt.Errorf("failed to get AddressPool %s: %w", name, err)
+		}
+		return poolChanges(ap), nil
+	}
+}
+
+// poolCreateResult is the output of `coilctl pool create`.
+type poolCreateResult struct {
+	DryRun   bool   `json:"dry_run"`
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	Subnet   string `json:"subnet"`
+	Supernet string `json:"supernet"`
+	Excluded int    `json:"excluded"`
+}
+
+// poolCreateOptions are the parameters of a pool to be created.
+type poolCreateOptions struct {
+	prefixLen     int
+	ipv6          bool
+	blockSizeBits int32
+
+	// supernets are read from CoilConfig if empty.
+	supernets []*net.IPNet
+
+	// exclusions are the ranges of addresses to be quarantined.
+	exclusions []ipRange
+}
+
+// ipRange is a range of IP addresses from first to last, inclusive.
+type ipRange struct {
+	first net.IP
+	last  net.IP
+}
+
+func runPoolCreate(cmd *cobra.Command, name string) error {
+	cfg := &poolCreateConfig
+	if cfg.output != "text" && cfg.output != "json" {
+		return fmt.Errorf("unknown output format: %s", cfg.output)
+	}
+	prefixLen, err := parsePrefixSize(cfg.size)
+	if err != nil {
+		return err
+	}
+	opts := poolCreateOptions{prefixLen: prefixLen, ipv6: cfg.ipv6, blockSizeBits: cfg.blockSizeBits}
+	for _, sn := range cfg.supernets {
+		_, n, err := net.ParseCIDR(sn)
+		if err != nil {
+			return fmt.Errorf("invalid supernet %s: %w", sn, err)
+		}
+		opts.supernets = append(opts.supernets, n)
+	}
+	if cfg.exclusionsFile != "" {
+		f, err := os.Open(cfg.exclusionsFile)
+		if err != nil {
+			return err
+		}
+		opts.exclusions, err = parseExclusions(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", cfg.exclusionsFile, err)
+		}
+	}
+
+	c, err := newKubeWriter()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	ap, err := planPoolCreate(ctx, c, name, opts)
+	if err != nil {
+		return err
+	}
+	result := poolCreateResultOf(ap, cfg.dryRun)
+
+	if !cfg.dryRun {
+		if !cfg.yes {
+			// the timeout should not expire while waiting for the user.
+			cancel()
+			if err := writePoolCreate(cmd.ErrOrStderr(), "text", result); err != nil {
+				return err
+			}
+			if err := askConfirmation(cmd.InOrStdin(), cmd.ErrOrStderr(), name); err != nil {
+				return err
+			}
+			ctx, cancel = context.WithTimeout(context.Background(), cfg.timeout)
+			defer cancel()
+		}
+		if err := c.Create(ctx, ap); err != nil {
+			return fmt.Errorf("failed to create AddressPool %s: %w", name, err)
+		}
+	}
+	return writePoolCreate(cmd.OutOrStdout(), cfg.output, result)
+}
+
+// parsePrefixSize parses the size of a subnet given as "/20" or "20".
+func parsePrefixSize(size string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(size, "/"))
+	if err != nil || n < 1 || n > 128 {
+		return 0, fmt.Errorf("invalid size: %q", size)
+	}
+	return n, nil
+}
+
+// planPoolCreate returns an AddressPool named `name` with a subnet curved
+// out of the supernets.  The pool is not created yet.
+func planPoolCreate(ctx context.Context, r client.Reader, name string, opts poolCreateOptions) (*coilv2.AddressPool, error) {
+	bits := 32
+	if opts.ipv6 {
+		bits = 128
+	}
+	if opts.prefixLen > bits {
+		return nil, fmt.Errorf("/%d is too long for the address family", opts.prefixLen)
+	}
+	if opts.blockSizeBits < 0 || int(opts.blockSizeBits) > bits-opts.prefixLen {
+		return nil, fmt.Errorf("block size bits %d is too large for /%d", opts.blockSizeBits, opts.prefixLen)
+	}
+
+	store := coilconfig.NewStore(coilconfig.Defaults{})
+	if _, err := store.Load(ctx, r); err != nil {
+		return nil, err
+	}
+	supernets := opts.supernets
+	if len(supernets) == 0 {
+		supernets = store.Supernets()
+	}
+	if len(supernets) == 0 {
+		return nil, fmt.Errorf("no supernets; set spec.supernets of CoilConfig %s or specify --supernet", constants.CoilConfigName)
+	}
+
+	err := r.Get(ctx, client.ObjectKey{Name: name}, &coilv2.AddressPool{})
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("AddressPool %s already exists", name)
+	case !apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("failed to get AddressPool %s: %w", name, err)
+	}
+
+	pools := &coilv2.AddressPoolList{}
+	if err := r.List(ctx, pools); err != nil {
+		return nil, fmt.Errorf("failed to list AddressPools: %w", err)
+	}
+	used := append(ipam.PoolSubnets(pools.Items), store.ServiceCIDRs()...)
+	used = append(used, store.NodeNetworks()...)
+	subnet, supernet, err := ipam.CarveSubnet(supernets, used, opts.prefixLen, opts.ipv6)
+	if errors.Is(err, ipam.ErrNoSpace) {
+		return nil, fmt.Errorf("no room for /%d in the supernets", opts.prefixLen)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cidr := subnet.String()
+	ap := &coilv2.AddressPool{}
+	ap.Name = name
+	ap.Annotations = map[string]string{constants.AnnSupernet: supernet.String()}
+	ap.Spec.BlockSizeBits = opts.blockSizeBits
+	if opts.ipv6 {
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv6: &cidr}}
+	} else {
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: &cidr}}
+	}
+	ap.Spec.Quarantine, err = excludedAddresses(subnet, opts.exclusions)
+	if err != nil {
+		return nil, err
+	}
+	return ap, nil
+}
+
+// parseExclusions reads addresses, CIDRs, and ranges like "10.0.0.10-10.0.0.20",
+// one per line.  Empty lines and lines starting with "#" are ignored.
+func parseExclusions(r io.Reader) ([]ipRange, error) {
+	var ranges []ipRange
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rng ipRange
+		switch {
+		case strings.Contains(line, "/"):
+			_, n, err := net.ParseCIDR(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid CIDR %q", lineno, line)
+			}
+			last := make(net.IP, len(n.IP))
+			for i := range n.IP {
+				last[i] = n.IP[i] | ^n.Mask[i]
+			}
+			rng = ipRange{first: n.IP, last: last}
+		case strings.Contains(line, "-"):
+			parts := strings.SplitN(line, "-", 2)
+			rng = ipRange{
+				first: net.ParseIP(strings.TrimSpace(parts[0])),
+				last:  net.ParseIP(strings.TrimSpace(parts[1])),
+			}
+			if rng.first == nil || rng.last == nil || (rng.first.To4() == nil) != (rng.last.To4() == nil) ||
+				ipToBig(rng.first).Cmp(ipToBig(rng.last)) > 0 {
+				return nil, fmt.Errorf("line %d: invalid range %q", lineno, line)
+			}
+		default:
+			ip := net.ParseIP(line)
+			if ip == nil {
+				return nil, fmt.Errorf("line %d: invalid address %q", lineno, line)
+			}
+			rng = ipRange{first: ip, last: ip}
+		}
+		ranges = append(ranges, rng)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// excludedAddresses returns the sorted addresses of `ranges` in `subnet`.
+// Addresses out of the subnet are ignored.
+func excludedAddresses(subnet *net.IPNet, ranges []ipRange) ([]string, error) {
+	ones, bits := subnet.Mask.Size()
+	start := ipToBig(subnet.IP)
+	end := new(big.Int).Add(start, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+	end.Sub(end, big.NewInt(1))
+
+	found := make(map[string]*big.Int)
+	for _, rng := range ranges {
+		if (rng.first.To4() == nil) != (bits == 128) {
+			continue
+		}
+		first, last := ipToBig(rng.first), ipToBig(rng.last)
+		if first.Cmp(start) < 0 {
+			first = start
+		}
+		if last.Cmp(end) > 0 {
+			last = end
+		}
+		for i := new(big.Int).Set(first); i.Cmp(last) <= 0; i.Add(i, big.NewInt(1)) {
+			ip := bigToIP(i, bits)
+			if _, ok := found[ip.String()]; ok {
+				continue
+			}
+			if len(found) >= maxExclusions {
+				return nil, fmt.Errorf("too many addresses to exclude; the limit is %d", maxExclusions)
+			}
+			found[ip.String()] = new(big.Int).Set(i)
+		}
+	}
+
+	addrs := make([]string, 0, len(found))
+	for a := range found {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return found[addrs[i]].Cmp(found[addrs[j]]) < 0
+	})
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	return addrs, nil
+}
+
+func ipToBig(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func bigToIP(n *big.Int, bits int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, bits/8)
+	copy(ip[len(ip)-len(b):], b)
+	return ip
+}
+
+func poolCreateResultOf(ap *coilv2.AddressPool, dryRun bool) poolCreateResult {
+	result := poolCreateResult{
+		DryRun:   dryRun,
+		Name:     ap.Name,
+		Key:      etcdKey("addresspools", ap.Name),
+		Supernet: ap.Annotations[constants.AnnSupernet],
+		Excluded: len(ap.Spec.Quarantine),
+	}
+	ss := ap.Spec.Subnets[0]
+	if ss.IPv4 != nil {
+		result.Subnet = *ss.IPv4
+	} else {
+		result.Subnet = *ss.IPv6
+	}
+	return result
+}
+
+func writePoolCreate(w io.Writer, output string, result poolCreateResult) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSUBNET\tSUPERNET\tKEY")
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Name, result.Subnet, result.Supernet, result.Key)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if result.Excluded > 0 {
+		fmt.Fprintf(w, "%d addresses in use are excluded\n", result.Excluded)
+	}
+	if result.DryRun {
+		fmt.Fprintln(w, "dry run: no changes were made")
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of Events recorded for AddressPools by `coilctl pool pause` and `coilctl pool resume`.
+const (
+	eventPoolPaused  = "PoolPaused"
+	eventPoolResumed = "PoolResumed"
+)
+
+var poolPauseConfig struct {
+	reason  string
+	timeout time.Duration
+}
+
+var poolPauseCmd = &cobra.Command{
+	Use:   "pause NAME",
+	Short: "pause allocations from an address pool",
+	Long: `Pause allocations from an AddressPool with a reason.
+
+While the pool is paused, coild refuses to allocate addresses from it
+and tells the reason in the error, which kubelet records in the events
+of the Pods.  coil-controller does not give blocks of the pool to nodes
+either.  Pods already running keep their addresses.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runPoolPause(cmd.OutOrStdout(), cmd.ErrOrStderr(), args[0], true)
+	},
+}
+
+var poolResumeCmd = &cobra.Command{
+	Use:   "resume NAME",
+	Short: "resume allocations from a paused address pool",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runPoolPause(cmd.OutOrStdout(), cmd.ErrOrStderr(), args[0], false)
+	},
+}
+
+func init() {
+	fs := poolPauseCmd.Flags()
+	fs.StringVar(&poolPauseConfig.reason, "reason", "", "reason of the pause shown to users, e.g. the maintenance window")
+	fs.DurationVar(&poolPauseConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	poolPauseCmd.MarkFlagRequired("reason")
+	poolCmd.AddCommand(poolPauseCmd)
+
+	fs = poolResumeCmd.Flags()
+	fs.DurationVar(&poolPauseConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	poolCmd.AddCommand(poolResumeCmd)
+}
+
+func runPoolPause(w, errw io.Writer, name string, pause bool) error {
+	c, err := newKubeWriter()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), poolPauseConfig.timeout)
+	defer cancel()
+
+	var ap *coilv2.AddressPool
+	if pause {
+		ap, err = pausePool(ctx, c, name, poolPauseConfig.reason)
+	} else {
+		ap, err = resumePool(ctx, c, name)
+	}
+	if err != nil {
+		return err
+	}
+	if ap == nil {
+		if pause {
+			fmt.Fprintf(w, "pool %s is already paused\n", name)
+		} else {
+			fmt.Fprintf(w, "pool %s is not paused\n", name)
+		}
+		return nil
+	}
+
+	reason, message := eventPoolResumed, "allocations resumed"
+	if pause {
+		reason, message = eventPoolPaused, poolPauseConfig.reason
+	}
+	// the pool has been changed anyway, so failing to record the event is not fatal.
+	if err := recordPoolEvent(ctx, c, ap, reason, message, time.Now()); err != nil {
+		fmt.Fprintf(errw, "warning: failed to record an event for pool %s: %v\n", name, err)
+	}
+
+	if pause {
+		fmt.Fprintf(w, "pool %s paused: %s\n", name, poolPauseConfig.reason)
+	} else {
+		fmt.Fprintf(w, "pool %s resumed\n", name)
+	}
+	return nil
+}
+
+// pausePool labels the pool with `coil.cybozu.com/paused` and records `reason`
+// in `coil.cybozu.com/pause-reason` annotation.  It returns the updated pool,
+// or nil if the pool is already paused for the same reason.
+func pausePool(ctx context.Context, c client.Client, name, reason string) (*coilv2.AddressPool, error) {
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+
+	ap := &coilv2.AddressPool{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, ap); err != nil {
+		return nil, fmt.Errorf("failed to get AddressPool %s: %w", name, err)
+	}
+	if ap.Labels[constants.LabelPaused] == "true" && ap.Annotations[constants.AnnPauseReason] == reason {
+		return nil, nil
+	}
+
+	orig := ap.DeepCopy()
+	if ap.Labels == nil {
+		ap.Labels = make(map[string]string)
+	}
+	if ap.Annotations == nil {
+		ap.Annotations = make(map[string]string)
+	}
+	ap.Labels[constants.LabelPaused] = "true"
+	ap.Annotations[constants.AnnPauseReason] = reason
+	if err := c.Patch(ctx, ap, client.MergeFrom(orig)); err != nil {
+		return nil, fmt.Errorf("failed to pause AddressPool %s: %w", name, err)
+	}
+	return ap, nil
+}
+
+// resumePool removes the label and annotation added by pausePool.
+// It returns the updated pool, or nil if the pool is not paused.
+func resumePool(ctx context.Context, c client.Client, name string) (*coilv2.AddressPool, error) {
+	ap := &coilv2.AddressPool{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, ap); err != nil {
+		return nil, fmt.Errorf("failed to get AddressPool %s: %w", name, err)
+	}
+	_, paused := ap.Labels[constants.LabelPaused]
+	_, hasReason := ap.Annotations[constants.AnnPauseReason]
+	if !paused && !hasReason {
+		return nil, nil
+	}
+
+	orig := ap.DeepCopy()
+	delete(ap.Labels, constants.LabelPaused)
+	delete(ap.Annotations, constants.AnnPauseReason)
+	if err := c.Patch(ctx, ap, client.MergeFrom(orig)); err != nil {
+		return nil, fmt.Errorf("failed to resume AddressPool %s: %w", name, err)
+	}
+	return ap, nil
+}
+
+// recordPoolEvent records a Normal Event for `ap`.  Events of cluster-scoped
+// objects are created in the default namespace as kubectl looks for them there.
+func recordPoolEvent(ctx context.Context, c client.Client, ap *coilv2.AddressPool, reason, message string, now time.Time) error {
+	t := metav1.NewTime(now)
+	ev := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ap.Name + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      coilv2.GroupVersion.String(),
+			Kind:            "AddressPool",
+			Name:            ap.Name,
+			UID:             ap.UID,
+			ResourceVersion: ap.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: "coilctl"},
+		FirstTimestamp: t,
+		LastTimestamp:  t,
+		Count:          1,
+	}
+	return c.Create(ctx, ev)
+}
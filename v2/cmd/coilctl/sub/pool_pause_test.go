@@ -0,0 +1,89 @@
+package sub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPausePool(t *testing.T) {
+	t.Parallel()
+
+	ap := &coilv2.AddressPool{}
+	ap.Name = "default"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ap).Build()
+	ctx := context.Background()
+
+	if _, err := pausePool(ctx, c, "default", ""); err == nil {
+		t.Error("pausing without a reason should fail")
+	}
+	if _, err := pausePool(ctx, c, "global", "maintenance"); err == nil {
+		t.Error("pausing a missing pool should fail")
+	}
+
+	paused, err := pausePool(ctx, c, "default", "maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paused == nil {
+		t.Fatal("the pool should be paused")
+	}
+	current := &coilv2.AddressPool{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "default"}, current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Labels[constants.LabelPaused] != "true" || current.Annotations[constants.AnnPauseReason] != "maintenance" {
+		t.Errorf("unexpected pool: %+v", current.ObjectMeta)
+	}
+
+	paused, err = pausePool(ctx, c, "default", "maintenance")
+	if err != nil || paused != nil {
+		t.Error("pausing again for the same reason should be a no-op", paused, err)
+	}
+	paused, err = pausePool(ctx, c, "default", "extended maintenance")
+	if err != nil || paused == nil || paused.Annotations[constants.AnnPauseReason] != "extended maintenance" {
+		t.Error("the reason should be updated", paused, err)
+	}
+
+	now := time.Date(2021, 10, 15, 3, 4, 5, 0, time.UTC)
+	if err := recordPoolEvent(ctx, c, paused, eventPoolPaused, "extended maintenance", now); err != nil {
+		t.Fatal(err)
+	}
+	events := &corev1.EventList{}
+	if err := c.List(ctx, events, client.InNamespace("default")); err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatal("an event should be recorded:", events.Items)
+	}
+	ev := events.Items[0]
+	if ev.InvolvedObject.Kind != "AddressPool" || ev.InvolvedObject.Name != "default" || ev.Reason != eventPoolPaused || ev.Message != "extended maintenance" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	resumed, err := resumePool(ctx, c, "default")
+	if err != nil || resumed == nil {
+		t.Fatal("the pool should be resumed", resumed, err)
+	}
+	current = &coilv2.AddressPool{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "default"}, current); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := current.Labels[constants.LabelPaused]; ok {
+		t.Error("the label should be removed:", current.Labels)
+	}
+	if _, ok := current.Annotations[constants.AnnPauseReason]; ok {
+		t.Error("the reason should be removed:", current.Annotations)
+	}
+
+	resumed, err = resumePool(ctx, c, "default")
+	if err != nil || resumed != nil {
+		t.Error("resuming a pool not paused should be a no-op", resumed, err)
+	}
+}
@@ -0,0 +1,203 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var poolQuarantineConfig struct {
+	timeout time.Duration
+}
+
+var poolQuarantineCmd = &cobra.Command{
+	Use:   "quarantine POOL IP...",
+	Short: "quarantine addresses of an address pool",
+	Long: `Add addresses to spec.quarantine of an AddressPool.
+
+Quarantined addresses are not assigned to Pods.  Every address must be
+in one of the subnets of the pool.  Pods already using the addresses
+keep them until they are deleted.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runPoolQuarantine(cmd.OutOrStdout(), args[0], args[1:], true)
+	},
+}
+
+var poolUnquarantineCmd = &cobra.Command{
+	Use:   "unquarantine POOL IP...",
+	Short: "make quarantined addresses of an address pool assignable again",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runPoolQuarantine(cmd.OutOrStdout(), args[0], args[1:], false)
+	},
+}
+
+func init() {
+	fs := poolQuarantineCmd.Flags()
+	fs.DurationVar(&poolQuarantineConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	poolCmd.AddCommand(poolQuarantineCmd)
+
+	fs = poolUnquarantineCmd.Flags()
+	fs.DurationVar(&poolQuarantineConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	config.clientOpts.AddFlags(fs)
+	poolCmd.AddCommand(poolUnquarantineCmd)
+}
+
+func runPoolQuarantine(w io.Writer, name string, args []string, quarantine bool) error {
+	c, err := newKubeWriter()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), poolQuarantineConfig.timeout)
+	defer cancel()
+
+	var changed []string
+	if quarantine {
+		changed, err = quarantineAddresses(ctx, c, name, args)
+	} else {
+		changed, err = unquarantineAddresses(ctx, c, name, args)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(changed) == 0 && quarantine:
+		fmt.Fprintf(w, "the addresses are already quarantined in pool %s\n", name)
+	case len(changed) == 0:
+		fmt.Fprintf(w, "the addresses are not quarantined in pool %s\n", name)
+	case quarantine:
+		fmt.Fprintf(w, "quarantined in pool %s: %s\n", name, strings.Join(changed, " "))
+	default:
+		fmt.Fprintf(w, "released from quarantine in pool %s: %s\n", name, strings.Join(changed, " "))
+	}
+	return nil
+}
+
+// parsePoolAddresses parses `args` as IP addresses in the subnets of `ap`.
+// The addresses are returned in their canonical form.
+func parsePoolAddresses(ap *coilv2.AddressPool, args []string) ([]string, error) {
+	var subnets []*net.IPNet
+	for _, ss := range ap.Spec.Subnets {
+		for _, s := range []*string{ss.IPv4, ss.IPv6} {
+			if s == nil {
+				continue
+			}
+			_, n, err := net.ParseCIDR(*s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subnet %s: %w", *s, err)
+			}
+			subnets = append(subnets, n)
+		}
+	}
+
+	addrs := make([]string, 0, len(args))
+	for _, a := range args {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", a)
+		}
+		found := false
+		for _, n := range subnets {
+			if n.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s is not in the subnets of the pool", a)
+		}
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, nil
+}
+
+// quarantineAddresses adds `args` to spec.quarantine of the pool.
+// It returns the addresses newly added to the list.
+func quarantineAddresses(ctx context.Context, c client.Client, name string, args []string) ([]string, error) {
+	return updateQuarantine(ctx, c, name, args, func(quarantine []string, addrs []string) ([]string, []string) {
+		listed := make(map[string]bool)
+		for _, a := range quarantine {
+			if ip := net.ParseIP(a); ip != nil {
+				listed[ip.String()] = true
+			}
+		}
+		var added []string
+		for _, a := range addrs {
+			if listed[a] {
+				continue
+			}
+			listed[a] = true
+			quarantine = append(quarantine, a)
+			added = append(added, a)
+		}
+		return quarantine, added
+	})
+}
+
+// unquarantineAddresses removes `args` from spec.quarantine of the pool.
+// It returns the addresses removed from the list.
+func unquarantineAddresses(ctx context.Context, c client.Client, name string, args []string) ([]string, error) {
+	return updateQuarantine(ctx, c, name, args, func(quarantine []string, addrs []string) ([]string, []string) {
+		release := make(map[string]bool)
+		for _, a := range addrs {
+			release[a] = true
+		}
+		var kept, removed []string
+		for _, a := range quarantine {
+			ip := net.ParseIP(a)
+			if ip != nil && release[ip.String()] {
+				removed = append(removed, a)
+				continue
+			}
+			kept = append(kept, a)
+		}
+		return kept, removed
+	})
+}
+
+// updateQuarantine replaces spec.quarantine of the pool with the list returned by `update`.
+// The pool is patched with optimistic locking so that addresses added by coild
+// in the meantime are not lost.
+func updateQuarantine(ctx context.Context, c client.Client, name string, args []string,
+	update func(quarantine []string, addrs []string) ([]string, []string)) ([]string, error) {
+
+	var changed []string
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		ap := &coilv2.AddressPool{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name}, ap); err != nil {
+			return err
+		}
+		addrs, err := parsePoolAddresses(ap, args)
+		if err != nil {
+			return err
+		}
+
+		orig := ap.DeepCopy()
+		ap.Spec.Quarantine, changed = update(ap.Spec.Quarantine, addrs)
+		if len(changed) == 0 {
+			return nil
+		}
+		if len(ap.Spec.Quarantine) > len(orig.Spec.Quarantine) && len(ap.Spec.Quarantine) > maxExclusions {
+			return fmt.Errorf("too many addresses to quarantine; the limit is %d", maxExclusions)
+		}
+		return c.Patch(ctx, ap, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{}))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update the quarantine of AddressPool %s: %w", name, err)
+	}
+	return changed, nil
+}
@@ -0,0 +1,80 @@
+package sub
+
+import (
+	"context"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestQuarantineAddresses(t *testing.T) {
+	t.Parallel()
+
+	v4, v6 := "10.2.0.0/16", "fd02::/112"
+	ap := &coilv2.AddressPool{}
+	ap.Name = "default"
+	ap.Spec.BlockSizeBits = 5
+	ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: &v4, IPv6: &v6}}
+	ap.Spec.Quarantine = []string{"10.2.0.10"}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ap).Build()
+	ctx := context.Background()
+
+	quarantine := func() []string {
+		t.Helper()
+		current := &coilv2.AddressPool{}
+		if err := c.Get(ctx, client.ObjectKey{Name: "default"}, current); err != nil {
+			t.Fatal(err)
+		}
+		return current.Spec.Quarantine
+	}
+
+	if _, err := quarantineAddresses(ctx, c, "global", []string{"10.2.0.11"}); err == nil {
+		t.Error("quarantining addresses of a missing pool should fail")
+	}
+	for _, a := range []string{"10.2.0.256", "10.3.0.1", "fd03::1"} {
+		if _, err := quarantineAddresses(ctx, c, "default", []string{"10.2.0.11", a}); err == nil {
+			t.Error("quarantining an address out of the subnets should fail:", a)
+		}
+	}
+	if diff := cmp.Diff([]string{"10.2.0.10"}, quarantine()); diff != "" {
+		t.Errorf("invalid addresses should not change the list (-want +got):\n%s", diff)
+	}
+
+	added, err := quarantineAddresses(ctx, c, "default", []string{"10.2.0.10", "10.2.0.11", "fd02:0::a", "10.2.0.11"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"10.2.0.11", "fd02::a"}, added); diff != "" {
+		t.Errorf("unexpected added addresses (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"10.2.0.10", "10.2.0.11", "fd02::a"}, quarantine()); diff != "" {
+		t.Errorf("unexpected quarantine (-want +got):\n%s", diff)
+	}
+
+	added, err = quarantineAddresses(ctx, c, "default", []string{"10.2.0.11"})
+	if err != nil || len(added) != 0 {
+		t.Error("quarantining a quarantined address should be a no-op", added, err)
+	}
+
+	removed, err := unquarantineAddresses(ctx, c, "default", []string{"fd02::0:a", "10.2.0.10", "10.2.0.12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"10.2.0.10", "fd02::a"}, removed); diff != "" {
+		t.Errorf("unexpected removed addresses (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"10.2.0.11"}, quarantine()); diff != "" {
+		t.Errorf("unexpected quarantine (-want +got):\n%s", diff)
+	}
+
+	removed, err = unquarantineAddresses(ctx, c, "default", []string{"10.2.0.12"})
+	if err != nil || len(removed) != 0 {
+		t.Error("releasing an address not quarantined should be a no-op", removed, err)
+	}
+	if _, err := unquarantineAddresses(ctx, c, "default", []string{"10.3.0.1"}); err == nil {
+		t.Error("releasing an address out of the subnets should fail")
+	}
+}
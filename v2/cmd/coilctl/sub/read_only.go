@@ -0,0 +1,96 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var readOnlyConfig struct {
+	timeout time.Duration
+}
+
+var readOnlyCmd = &cobra.Command{
+	Use:   "read-only [on|off]",
+	Short: "show or switch read-only mode of coild on this node",
+	Long: `Show or switch read-only mode of coild on this node.
+
+In read-only mode, coild refuses to allocate and free addresses
+so that the state does not change during maintenance, e.g. while
+restoring the cluster from a backup.  Pods cannot be created on
+the node until read-only mode is switched off.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		var arg string
+		if len(args) == 1 {
+			arg = args[0]
+		}
+		return runReadOnly(cmd.OutOrStdout(), arg)
+	},
+}
+
+func init() {
+	readOnlyCmd.Flags().DurationVar(&readOnlyConfig.timeout, "timeout", 10*time.Second, "timeout of the request to coild")
+	rootCmd.AddCommand(readOnlyCmd)
+}
+
+// parseSwitch parses the argument of read-only subcommand.
+// It returns nil if `arg` is empty.
+func parseSwitch(arg string) (*bool, error) {
+	var v bool
+	switch arg {
+	case "":
+		return nil, nil
+	case "on":
+		v = true
+	case "off":
+		v = false
+	default:
+		return nil, fmt.Errorf("argument must be on or off: %s", arg)
+	}
+	return &v, nil
+}
+
+func runReadOnly(w io.Writer, arg string) error {
+	enable, err := parseSwitch(arg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connectCoild()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), readOnlyConfig.timeout)
+	defer cancel()
+	ctx, err = coildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	client := cnirpc.NewCNIClient(conn)
+	var resp *cnirpc.ReadOnlyMode
+	if enable == nil {
+		resp, err = client.GetReadOnly(ctx, &emptypb.Empty{})
+	} else {
+		resp, err = client.SetReadOnly(ctx, &cnirpc.ReadOnlyMode{Enabled: *enable})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to access read-only mode: %w", err)
+	}
+
+	state := "off"
+	if resp.Enabled {
+		state = "on"
+	}
+	fmt.Fprintf(w, "read-only: %s\n", state)
+	return nil
+}
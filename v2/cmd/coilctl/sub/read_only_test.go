@@ -0,0 +1,23 @@
+package sub
+
+import "testing"
+
+func TestParseSwitch(t *testing.T) {
+	t.Parallel()
+
+	v, err := parseSwitch("")
+	if err != nil || v != nil {
+		t.Error("empty argument should show the mode", v, err)
+	}
+	v, err = parseSwitch("on")
+	if err != nil || v == nil || !*v {
+		t.Error("on should enable read-only mode", v, err)
+	}
+	v, err = parseSwitch("off")
+	if err != nil || v == nil || *v {
+		t.Error("off should disable read-only mode", v, err)
+	}
+	if _, err := parseSwitch("true"); err == nil {
+		t.Error("unknown argument should be rejected")
+	}
+}
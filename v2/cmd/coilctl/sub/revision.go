@@ -0,0 +1,90 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// atRevision is a client.ListOption to read objects at the exact resource version.
+type atRevision string
+
+func (r atRevision) ApplyToList(o *client.ListOptions) {
+	if o.Raw == nil {
+		o.Raw = &metav1.ListOptions{}
+	}
+	o.Raw.ResourceVersion = string(r)
+	o.Raw.ResourceVersionMatch = metav1.ResourceVersionMatchExact
+}
+
+// revisionReader is a client.Reader that reads objects as of `revision`.
+//
+// kube-apiserver serves such reads from the revision history of etcd,
+// so they fail once the revision has been compacted.
+type revisionReader struct {
+	reader   client.Reader
+	revision string
+}
+
+var _ client.Reader = revisionReader{}
+
+func (r revisionReader) wrapError(err error) error {
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+		return fmt.Errorf("revision %s is no longer available: %w", r.revision, err)
+	}
+	return err
+}
+
+func (r revisionReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	opts = append(opts, atRevision(r.revision))
+	return r.wrapError(r.reader.List(ctx, list, opts...))
+}
+
+// Get reads an object by listing objects with a field selector
+// because Get requests cannot specify the exact resource version.
+func (r revisionReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return err
+	}
+	o, err := scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return err
+	}
+	list, ok := o.(client.ObjectList)
+	if !ok {
+		return fmt.Errorf("%s is not a list", gvk.Kind+"List")
+	}
+
+	opts := []client.ListOption{
+		client.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("metadata.name", key.Name)},
+	}
+	if key.Namespace != "" {
+		opts = append(opts, client.InNamespace(key.Namespace))
+	}
+	if err := r.List(ctx, list, opts...); err != nil {
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		item, ok := item.(client.Object)
+		if !ok || item.GetName() != key.Name {
+			continue
+		}
+		reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(item).Elem())
+		return nil
+	}
+	return apierrors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, key.Name)
+}
@@ -0,0 +1,76 @@
+package sub
+
+import (
+	"context"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// listRecorder records the options of List and returns `pools`.
+type listRecorder struct {
+	client.Reader
+	opts  *client.ListOptions
+	pools []coilv2.AddressPool
+	err   error
+}
+
+func (r *listRecorder) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	r.opts = (&client.ListOptions{}).ApplyOptions(opts)
+	if r.err != nil {
+		return r.err
+	}
+	if pl, ok := list.(*coilv2.AddressPoolList); ok {
+		pl.Items = r.pools
+	}
+	return nil
+}
+
+func TestRevisionReader(t *testing.T) {
+	t.Parallel()
+
+	ap := coilv2.AddressPool{}
+	ap.Name = "default"
+	ap.Spec.BlockSizeBits = 5
+	rec := &listRecorder{pools: []coilv2.AddressPool{ap}}
+	r := revisionReader{reader: rec, revision: "12345"}
+
+	got := &coilv2.AddressPool{}
+	if err := r.Get(context.Background(), client.ObjectKey{Name: "default"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "default" || got.Spec.BlockSizeBits != 5 {
+		t.Error("unexpected pool:", got)
+	}
+	raw := rec.opts.AsListOptions()
+	if raw.ResourceVersion != "12345" || raw.ResourceVersionMatch != metav1.ResourceVersionMatchExact {
+		t.Error("should read at the exact revision:", raw)
+	}
+	if raw.FieldSelector != "metadata.name=default" {
+		t.Error("should select the object by name:", raw.FieldSelector)
+	}
+
+	err := r.Get(context.Background(), client.ObjectKey{Name: "global"}, got)
+	if !apierrors.IsNotFound(err) {
+		t.Error("missing object should not be found:", err)
+	}
+
+	rec.err = apierrors.NewResourceExpired("too old resource version")
+	err = r.List(context.Background(), &coilv2.AddressBlockList{})
+	if err == nil || !apierrors.IsResourceExpired(err) {
+		t.Error("compacted revision should be reported:", err)
+	}
+
+	rec.err = apierrors.NewNotFound(schema.GroupResource{}, "foo")
+	err = r.List(context.Background(), &coilv2.AddressBlockList{}, client.MatchingLabels{"foo": "bar"})
+	if !apierrors.IsNotFound(err) {
+		t.Error("other errors should be returned as is:", err)
+	}
+	if rec.opts.LabelSelector.String() != "foo=bar" {
+		t.Error("other options should be kept:", rec.opts.LabelSelector)
+	}
+}
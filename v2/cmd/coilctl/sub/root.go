@@ -0,0 +1,122 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/clientconfig"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(coilv2.AddToScheme(scheme))
+}
+
+var config struct {
+	socketPath string
+	tokenFile  string
+	revision   string
+	clientOpts clientconfig.Options
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "coilctl",
+	Short: "command-line tool to inspect Coil",
+	Long: `coilctl is a command-line tool to inspect Coil.
+
+Node-local subcommands talk to coild through its UNIX domain socket.
+Other subcommands read or modify the cluster state through kube-apiserver.`,
+	Version:       v2.Version(),
+	SilenceErrors: true,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	pf := rootCmd.PersistentFlags()
+	pf.StringVar(&config.socketPath, "socket", constants.DefaultSocketPath, "UNIX domain socket path of coild")
+	pf.StringVar(&config.tokenFile, "token-file", "", "file of a service account token sent to coild")
+}
+
+// addKubeFlags adds flags to connect to kube-apiserver to subcommands
+// that read the cluster state.
+func addKubeFlags(fs *pflag.FlagSet) {
+	config.clientOpts.AddFlags(fs)
+	fs.StringVar(&config.revision, "at-revision", "", "read the cluster state as of this resource version instead of the latest")
+}
+
+// newKubeClient creates a client to read the cluster state from kube-apiserver.
+// With --at-revision, the client reads objects as of the revision.
+func newKubeClient() (client.Reader, error) {
+	return newKubeClientAt(config.revision)
+}
+
+// newKubeClientAt creates a client to read the cluster state as of `revision`.
+// If `revision` is empty, the client reads the latest state.
+func newKubeClientAt(revision string) (client.Reader, error) {
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	if revision != "" {
+		return revisionReader{reader: c, revision: revision}, nil
+	}
+	return c, nil
+}
+
+// connectCoild connects to coild.
+func connectCoild() (*grpc.ClientConn, error) {
+	dialer := &net.Dialer{}
+	dialFunc := func(ctx context.Context, a string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", a)
+	}
+	conn, err := grpc.Dial(config.socketPath, grpc.WithInsecure(), grpc.WithContextDialer(dialFunc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.socketPath, err)
+	}
+	return conn, nil
+}
+
+// coildContext returns a context with the metadata required by coild.
+func coildContext(ctx context.Context) (context.Context, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, cnirpc.APIVersionKey, strconv.Itoa(cnirpc.APIVersion))
+	if config.tokenFile == "" {
+		return ctx, nil
+	}
+
+	data, err := os.ReadFile(config.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(data))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), nil
+}
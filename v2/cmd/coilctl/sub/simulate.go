@@ -0,0 +1,256 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"text/tabwriter"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var simulateConfig struct {
+	pool        string
+	nodes       int
+	podsPerNode int
+	fromEmpty   bool
+	output      string
+	timeout     time.Duration
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "simulate address allocation for capacity planning",
+	Long: `Simulate address allocation of an address pool for capacity planning.
+
+This reads the current AddressPool and AddressBlocks, and runs the block
+allocation algorithm of coil-controller in memory for the given number of
+new nodes running the given number of Pods.  Nothing is changed in the cluster.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runSimulate(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	fs := simulateCmd.Flags()
+	fs.StringVar(&simulateConfig.pool, "pool", constants.DefaultPool, "name of the address pool")
+	fs.IntVar(&simulateConfig.nodes, "nodes", 100, "number of nodes to add")
+	fs.IntVar(&simulateConfig.podsPerNode, "pods-per-node", 110, "number of Pods on each node")
+	fs.BoolVar(&simulateConfig.fromEmpty, "from-empty", false, "ignore the current address blocks of the pool")
+	fs.StringVarP(&simulateConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&simulateConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	addKubeFlags(fs)
+	rootCmd.AddCommand(simulateCmd)
+}
+
+func runSimulate(w io.Writer) error {
+	if simulateConfig.output != "text" && simulateConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", simulateConfig.output)
+	}
+	if simulateConfig.nodes < 1 || simulateConfig.podsPerNode < 1 {
+		return errors.New("--nodes and --pods-per-node must be positive")
+	}
+
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), simulateConfig.timeout)
+	defer cancel()
+	ap := &coilv2.AddressPool{}
+	if err := c.Get(ctx, client.ObjectKey{Name: simulateConfig.pool}, ap); err != nil {
+		return fmt.Errorf("failed to get AddressPool %s: %w", simulateConfig.pool, err)
+	}
+	var blocks []coilv2.AddressBlock
+	if !simulateConfig.fromEmpty {
+		bl := &coilv2.AddressBlockList{}
+		if err := c.List(ctx, bl, client.MatchingLabels{constants.LabelPool: ap.Name}); err != nil {
+			return fmt.Errorf("failed to list AddressBlocks: %w", err)
+		}
+		blocks = bl.Items
+	}
+
+	res, err := simulate(context.Background(), ap, blocks, simulateConfig.nodes, simulateConfig.podsPerNode)
+	if err != nil {
+		return err
+	}
+	if simulateConfig.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	return writeSimulationText(w, res)
+}
+
+type simulationResult struct {
+	Pool              string `json:"pool"`
+	BlockSize         int    `json:"block_size"`
+	TotalBlocks       uint64 `json:"total_blocks"`
+	CurrentBlocks     int    `json:"current_blocks"`
+	Nodes             int    `json:"nodes"`
+	PodsPerNode       int    `json:"pods_per_node"`
+	AllocatedNodes    int    `json:"allocated_nodes"`
+	ConsumedBlocks    int    `json:"consumed_blocks"`
+	ConsumedAddresses int    `json:"consumed_addresses"`
+	UsedAddresses     int    `json:"used_addresses"`
+	FreeBlocks        uint64 `json:"free_blocks"`
+
+	// ExhaustedAt is the number of the first node that could not get enough addresses.
+	ExhaustedAt int `json:"exhausted_at,omitempty"`
+
+	// RemainingNodes estimates how many more nodes can be added after the simulated ones.
+	RemainingNodes uint64 `json:"remaining_nodes,omitempty"`
+}
+
+// maxBlockCount caps the number of blocks in huge IPv6 pools.
+const maxBlockCount = uint64(1) << 62
+
+// poolBlocks returns the number of address blocks in the pool.
+func poolBlocks(ap *coilv2.AddressPool) uint64 {
+	var total uint64
+	for _, ss := range ap.Spec.Subnets {
+		var n *net.IPNet
+		if ss.IPv4 != nil {
+			_, n, _ = net.ParseCIDR(*ss.IPv4)
+		} else if ss.IPv6 != nil {
+			_, n, _ = net.ParseCIDR(*ss.IPv6)
+		}
+		if n == nil {
+			continue
+		}
+		ones, bits := n.Mask.Size()
+		shift := bits - ones - int(ap.Spec.BlockSizeBits)
+		if shift < 0 {
+			continue
+		}
+		if shift >= 62 || total+(uint64(1)<<shift) > maxBlockCount {
+			return maxBlockCount
+		}
+		total += uint64(1) << shift
+	}
+	return total
+}
+
+// blockCapacity returns the number of addresses in the block that can be assigned to Pods.
+func blockCapacity(b *coilv2.AddressBlock, blockSize int, quarantine []net.IP) int {
+	var n *net.IPNet
+	if b.IPv4 != nil {
+		_, n, _ = net.ParseCIDR(*b.IPv4)
+	} else if b.IPv6 != nil {
+		_, n, _ = net.ParseCIDR(*b.IPv6)
+	}
+	capacity := blockSize
+	if n == nil {
+		return capacity
+	}
+	for _, ip := range quarantine {
+		if n.Contains(ip) {
+			capacity--
+		}
+	}
+	return capacity
+}
+
+// simulate allocates address blocks of `ap` in memory for `nodes` new nodes
+// each running `podsPerNode` Pods.  `blocks` are the blocks already allocated.
+//
+// The node selector of the pool is ignored; all the simulated nodes are assumed
+// to be selected.
+func simulate(ctx context.Context, ap *coilv2.AddressPool, blocks []coilv2.AddressBlock, nodes, podsPerNode int) (*simulationResult, error) {
+	pool := ap.DeepCopy()
+	pool.ResourceVersion = ""
+	pool.Spec.NodeSelector = nil
+	objs := []client.Object{pool}
+	for i := range blocks {
+		b := blocks[i].DeepCopy()
+		b.ResourceVersion = ""
+		objs = append(objs, b)
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	pm := ipam.NewPoolManager(cl, cl, logr.Discard(), scheme, "", nil)
+
+	var quarantine []net.IP
+	for _, a := range ap.Spec.Quarantine {
+		if ip := net.ParseIP(a); ip != nil {
+			quarantine = append(quarantine, ip)
+		}
+	}
+
+	blockSize := ipam.BlockCapacity(int(ap.Spec.BlockSizeBits))
+	res := &simulationResult{
+		Pool:          ap.Name,
+		BlockSize:     blockSize,
+		TotalBlocks:   poolBlocks(ap),
+		CurrentBlocks: len(blocks),
+		Nodes:         nodes,
+		PodsPerNode:   podsPerNode,
+	}
+
+	for i := 1; i <= nodes && res.ExhaustedAt == 0; i++ {
+		nodeName := fmt.Sprintf("simulated-%d", i)
+		capacity := 0
+		for capacity < podsPerNode {
+			b, err := pm.AllocateBlock(ctx, ap.Name, nodeName, "")
+			if errors.Is(err, ipam.ErrNoBlock) {
+				res.ExhaustedAt = i
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			capacity += blockCapacity(b, blockSize, quarantine)
+			res.ConsumedBlocks++
+			res.ConsumedAddresses += blockSize
+		}
+		if res.ExhaustedAt == 0 {
+			res.AllocatedNodes++
+			res.UsedAddresses += podsPerNode
+		} else if capacity > 0 {
+			res.UsedAddresses += capacity
+		}
+	}
+
+	if used := uint64(res.CurrentBlocks + res.ConsumedBlocks); used < res.TotalBlocks {
+		res.FreeBlocks = res.TotalBlocks - used
+	}
+	if res.ExhaustedAt == 0 {
+		perNode := uint64((res.ConsumedBlocks + res.AllocatedNodes - 1) / res.AllocatedNodes)
+		res.RemainingNodes = res.FreeBlocks / perNode
+	}
+	return res, nil
+}
+
+func writeSimulationText(w io.Writer, res *simulationResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "Pool:\t%s\n", res.Pool)
+	fmt.Fprintf(tw, "Block size:\t%d addresses\n", res.BlockSize)
+	fmt.Fprintf(tw, "Total blocks:\t%d\n", res.TotalBlocks)
+	fmt.Fprintf(tw, "Current blocks:\t%d\n", res.CurrentBlocks)
+	fmt.Fprintf(tw, "Simulated nodes:\t%d x %d Pods\n", res.Nodes, res.PodsPerNode)
+	fmt.Fprintf(tw, "Consumed blocks:\t%d\n", res.ConsumedBlocks)
+	unused := 0.0
+	if res.ConsumedAddresses > 0 {
+		unused = float64(res.ConsumedAddresses-res.UsedAddresses) * 100 / float64(res.ConsumedAddresses)
+	}
+	fmt.Fprintf(tw, "Consumed addresses:\t%d (%d used by Pods, %.1f%% unused)\n", res.ConsumedAddresses, res.UsedAddresses, unused)
+	fmt.Fprintf(tw, "Free blocks after:\t%d\n", res.FreeBlocks)
+	if res.ExhaustedAt > 0 {
+		fmt.Fprintf(tw, "Exhaustion:\tat node %d of %d\n", res.ExhaustedAt, res.Nodes)
+	} else {
+		fmt.Fprintf(tw, "Exhaustion:\tafter about %d more nodes\n", res.RemainingNodes)
+	}
+	return tw.Flush()
+}
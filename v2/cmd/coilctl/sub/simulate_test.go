@@ -0,0 +1,109 @@
+package sub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPool(subnet string, sizeBits int32) *coilv2.AddressPool {
+	ap := &coilv2.AddressPool{}
+	ap.Name = "default"
+	ap.Spec.BlockSizeBits = sizeBits
+	ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: &subnet}}
+	return ap
+}
+
+func TestSimulate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// 10.0.0.0/24 has 8 blocks of 32 addresses.  Each node needs 2 blocks for 40 Pods.
+	ap := testPool("10.0.0.0/24", 5)
+	res, err := simulate(ctx, ap, nil, 3, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalBlocks != 8 || res.ConsumedBlocks != 6 || res.AllocatedNodes != 3 || res.ExhaustedAt != 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if res.ConsumedAddresses != 192 || res.UsedAddresses != 120 || res.FreeBlocks != 2 || res.RemainingNodes != 1 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	// existing blocks reduce the capacity, and the node selector is ignored.
+	ap.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}}
+	var blocks []coilv2.AddressBlock
+	for i := 0; i < 4; i++ {
+		b := coilv2.AddressBlock{}
+		b.Name = fmt.Sprintf("default-%d", i)
+		b.Labels = map[string]string{constants.LabelPool: "default", constants.LabelNode: "node1"}
+		b.Index = int32(i)
+		blocks = append(blocks, b)
+	}
+	res, err = simulate(ctx, ap, blocks, 3, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CurrentBlocks != 4 || res.AllocatedNodes != 2 || res.ExhaustedAt != 3 || res.FreeBlocks != 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	// quarantined addresses are not assigned.
+	ap = testPool("10.0.0.0/26", 5)
+	ap.Spec.Quarantine = []string{"10.0.0.1"}
+	res, err = simulate(ctx, ap, nil, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ConsumedBlocks != 2 || res.AllocatedNodes != 1 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	// delegated prefixes are as large as the addresses assigned from them.
+	subnet := "2001:db8::/48"
+	ap = &coilv2.AddressPool{}
+	ap.Name = "v6-pd"
+	ap.Spec.BlockSizeBits = 64
+	ap.Spec.PrefixDelegation = true
+	ap.Spec.Subnets = []coilv2.SubnetSet{{IPv6: &subnet}}
+	res, err = simulate(ctx, ap, nil, 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.BlockSize != 65535 || res.TotalBlocks != 65536 || res.ConsumedBlocks != 2 || res.AllocatedNodes != 2 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestWriteSimulationText(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	err := writeSimulationText(buf, &simulationResult{
+		Pool:              "default",
+		BlockSize:         32,
+		TotalBlocks:       8,
+		Nodes:             3,
+		PodsPerNode:       40,
+		ConsumedBlocks:    6,
+		ConsumedAddresses: 192,
+		UsedAddresses:     120,
+		FreeBlocks:        2,
+		ExhaustedAt:       3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "37.5% unused") || !strings.Contains(out, "at node 3 of 3") {
+		t.Error("unexpected output:", out)
+	}
+}
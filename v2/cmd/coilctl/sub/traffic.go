@@ -0,0 +1,113 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var trafficConfig struct {
+	output  string
+	timeout time.Duration
+}
+
+var trafficCmd = &cobra.Command{
+	Use:   "traffic",
+	Short: "show traffic counters of Pods on this node",
+	Long: `Show the traffic counters of Pod interfaces on this node.
+
+The counters are seen from Pods; TX is the traffic sent by Pods.
+Pods can be identified by their container IDs or addresses.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		return runTraffic(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	trafficCmd.Flags().StringVarP(&trafficConfig.output, "output", "o", "text", "output format: text or json")
+	trafficCmd.Flags().DurationVar(&trafficConfig.timeout, "timeout", 10*time.Second, "timeout of the request to coild")
+	rootCmd.AddCommand(trafficCmd)
+}
+
+func runTraffic(w io.Writer) error {
+	if trafficConfig.output != "text" && trafficConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", trafficConfig.output)
+	}
+
+	conn, err := connectCoild()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), trafficConfig.timeout)
+	defer cancel()
+	ctx, err = coildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cnirpc.NewCNIClient(conn).TrafficStats(ctx, &emptypb.Empty{})
+	if err != nil {
+		return fmt.Errorf("failed to get traffic stats: %w", err)
+	}
+
+	if trafficConfig.output == "json" {
+		return writeTrafficJSON(w, resp.Stats)
+	}
+	return writeTrafficText(w, resp.Stats)
+}
+
+type trafficJSON struct {
+	Pool        string   `json:"pool"`
+	ContainerId string   `json:"container_id"`
+	IFace       string   `json:"ifname"`
+	IPs         []string `json:"ips"`
+	TxPackets   uint64   `json:"tx_packets"`
+	TxBytes     uint64   `json:"tx_bytes"`
+	RxPackets   uint64   `json:"rx_packets"`
+	RxBytes     uint64   `json:"rx_bytes"`
+}
+
+func writeTrafficJSON(w io.Writer, stats []*cnirpc.PodTrafficStats) error {
+	l := make([]trafficJSON, 0, len(stats))
+	for _, st := range stats {
+		l = append(l, trafficJSON{
+			Pool:        st.Pool,
+			ContainerId: st.ContainerId,
+			IFace:       st.Ifname,
+			IPs:         st.Ips,
+			TxPackets:   st.TxPackets,
+			TxBytes:     st.TxBytes,
+			RxPackets:   st.RxPackets,
+			RxBytes:     st.RxBytes,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+func writeTrafficText(w io.Writer, stats []*cnirpc.PodTrafficStats) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tIFACE\tPOOL\tADDRESSES\tTX PACKETS\tTX BYTES\tRX PACKETS\tRX BYTES")
+	for _, st := range stats {
+		ips := strings.Join(st.Ips, ",")
+		if ips == "" {
+			ips = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			st.ContainerId, st.Ifname, st.Pool, ips, st.TxPackets, st.TxBytes, st.RxPackets, st.RxBytes)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,79 @@
+package sub
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+)
+
+var testTrafficStats = []*cnirpc.PodTrafficStats{
+	{
+		Pool:        "default",
+		ContainerId: "pod1",
+		Ifname:      "eth0",
+		Ips:         []string{"10.1.2.3", "fd02::1"},
+		TxPackets:   1,
+		TxBytes:     100,
+		RxPackets:   2,
+		RxBytes:     200,
+	},
+	{
+		Pool:        "global",
+		ContainerId: "pod2",
+		Ifname:      "eth0",
+	},
+}
+
+func TestWriteTrafficText(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	if err := writeTrafficText(buf, testTrafficStats); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "pod1 eth0 default 10.1.2.3,fd02::1 1 100 2 200" {
+		t.Error("unexpected line:", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "pod2 eth0 global - 0 0 0 0" {
+		t.Error("unexpected line:", lines[2])
+	}
+}
+
+func TestWriteTrafficJSON(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	if err := writeTrafficJSON(buf, testTrafficStats); err != nil {
+		t.Fatal(err)
+	}
+
+	var l []trafficJSON
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 2 {
+		t.Fatal("unexpected length:", len(l))
+	}
+	if l[0].ContainerId != "pod1" || l[0].RxBytes != 200 || len(l[0].IPs) != 2 {
+		t.Errorf("unexpected entry: %+v", l[0])
+	}
+	if l[1].Pool != "global" || l[1].TxPackets != 0 {
+		t.Errorf("unexpected entry: %+v", l[1])
+	}
+
+	buf.Reset()
+	if err := writeTrafficJSON(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Error("empty stats should be written as an empty array:", buf.String())
+	}
+}
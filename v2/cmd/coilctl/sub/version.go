@@ -0,0 +1,166 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const componentController = "coil-controller"
+
+var versionConfig struct {
+	cluster   bool
+	namespace string
+	output    string
+	timeout   time.Duration
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "show versions of Coil",
+	Long: `Show the version of coilctl.
+
+With --cluster, list the versions of Coil components running in the cluster
+published as annotations of their Pods.  The compatibility of each component
+is checked against the version of coil-controller.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		if !versionConfig.cluster {
+			fmt.Fprintf(cmd.OutOrStdout(), "Version: %s\nAPI versions: %s\n", v2.Version(), cnirpc.SupportedAPIVersions())
+			return nil
+		}
+		return runClusterVersion(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	fs := versionCmd.Flags()
+	fs.BoolVar(&versionConfig.cluster, "cluster", false, "list versions of Coil components in the cluster")
+	fs.StringVar(&versionConfig.namespace, "namespace", "kube-system", "namespace where Coil is running")
+	fs.StringVarP(&versionConfig.output, "output", "o", "text", "output format: text or json")
+	fs.DurationVar(&versionConfig.timeout, "timeout", 30*time.Second, "timeout of requests to kube-apiserver")
+	addKubeFlags(fs)
+	rootCmd.AddCommand(versionCmd)
+}
+
+func runClusterVersion(w io.Writer) error {
+	if versionConfig.output != "text" && versionConfig.output != "json" {
+		return fmt.Errorf("unknown output format: %s", versionConfig.output)
+	}
+
+	c, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionConfig.timeout)
+	defer cancel()
+	pods := &corev1.PodList{}
+	err = c.List(ctx, pods,
+		client.InNamespace(versionConfig.namespace),
+		client.MatchingLabels{constants.LabelAppName: "coil"},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list Pods: %w", err)
+	}
+
+	vers := componentVersions(pods.Items)
+	if versionConfig.output == "json" {
+		return writeVersionsJSON(w, vers)
+	}
+	return writeVersionsText(w, vers)
+}
+
+type componentVersion struct {
+	Component   string `json:"component"`
+	Node        string `json:"node"`
+	Pod         string `json:"pod"`
+	Version     string `json:"version"`
+	APIVersions string `json:"api_versions,omitempty"`
+	Compatible  bool   `json:"compatible"`
+}
+
+// componentVersions returns the versions of Coil components published in
+// annotations of `pods`.  The version of the CNI plugin reported by coild
+// is listed as component "coil".
+func componentVersions(pods []corev1.Pod) []componentVersion {
+	var vers []componentVersion
+	for _, pod := range pods {
+		v, ok := pod.Annotations[constants.AnnVersion]
+		if !ok {
+			continue
+		}
+		vers = append(vers, componentVersion{
+			Component:   pod.Labels[constants.LabelAppComponent],
+			Node:        pod.Spec.NodeName,
+			Pod:         pod.Name,
+			Version:     v,
+			APIVersions: pod.Annotations[constants.AnnAPIVersions],
+		})
+		if cni, ok := pod.Annotations[constants.AnnCNIVersion]; ok {
+			vers = append(vers, componentVersion{
+				Component: "coil",
+				Node:      pod.Spec.NodeName,
+				Pod:       pod.Name,
+				Version:   cni,
+			})
+		}
+	}
+
+	base := v2.Version()
+	for _, cv := range vers {
+		if cv.Component == componentController {
+			base = cv.Version
+			break
+		}
+	}
+	for i := range vers {
+		vers[i].Compatible = v2.Compatible(vers[i].Version, base)
+	}
+
+	sort.Slice(vers, func(i, j int) bool {
+		if vers[i].Component != vers[j].Component {
+			return vers[i].Component < vers[j].Component
+		}
+		if vers[i].Node != vers[j].Node {
+			return vers[i].Node < vers[j].Node
+		}
+		return vers[i].Pod < vers[j].Pod
+	})
+	return vers
+}
+
+func writeVersionsJSON(w io.Writer, vers []componentVersion) error {
+	if vers == nil {
+		vers = []componentVersion{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vers)
+}
+
+func writeVersionsText(w io.Writer, vers []componentVersion) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tNODE\tPOD\tVERSION\tAPI VERSIONS\tCOMPATIBLE")
+	for _, cv := range vers {
+		apiVersions := cv.APIVersions
+		if apiVersions == "" {
+			apiVersions = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\n",
+			cv.Component, cv.Node, cv.Pod, cv.Version, apiVersions, cv.Compatible)
+	}
+	return tw.Flush()
+}
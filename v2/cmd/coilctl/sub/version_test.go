@@ -0,0 +1,89 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod(name, component, node string, anns map[string]string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{constants.LabelAppComponent: component},
+			Annotations: anns,
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+	}
+}
+
+func TestComponentVersions(t *testing.T) {
+	t.Parallel()
+
+	pods := []corev1.Pod{
+		testPod("coild-b", "coild", "node2", map[string]string{
+			constants.AnnVersion:     "2.2.0",
+			constants.AnnAPIVersions: "1-2",
+		}),
+		testPod("coild-a", "coild", "node1", map[string]string{
+			constants.AnnVersion:     "2.0.14",
+			constants.AnnAPIVersions: "1-1",
+			constants.AnnCNIVersion:  "2.0.13",
+		}),
+		testPod("coil-controller-a", "coil-controller", "node1", map[string]string{
+			constants.AnnVersion: "2.1.0",
+		}),
+		testPod("coil-egress-a", "egress", "node2", nil),
+	}
+
+	vers := componentVersions(pods)
+	expected := []componentVersion{
+		{Component: "coil", Node: "node1", Pod: "coild-a", Version: "2.0.13", Compatible: true},
+		{Component: "coil-controller", Node: "node1", Pod: "coil-controller-a", Version: "2.1.0", Compatible: true},
+		{Component: "coild", Node: "node1", Pod: "coild-a", Version: "2.0.14", APIVersions: "1-1", Compatible: true},
+		{Component: "coild", Node: "node2", Pod: "coild-b", Version: "2.2.0", APIVersions: "1-2", Compatible: true},
+	}
+	if len(vers) != len(expected) {
+		t.Fatalf("unexpected versions: %+v", vers)
+	}
+	for i := range expected {
+		if vers[i] != expected[i] {
+			t.Errorf("unexpected version at %d: %+v", i, vers[i])
+		}
+	}
+
+	pods[2].Annotations[constants.AnnVersion] = "2.3.0"
+	for _, cv := range componentVersions(pods) {
+		if cv.Compatible != (cv.Version == "2.3.0" || cv.Version == "2.2.0") {
+			t.Errorf("unexpected compatibility: %+v", cv)
+		}
+	}
+}
+
+func TestWriteVersionsText(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	err := writeVersionsText(buf, []componentVersion{
+		{Component: "coil", Node: "node1", Pod: "coild-a", Version: "2.0.13", Compatible: true},
+		{Component: "coild", Node: "node1", Pod: "coild-a", Version: "2.0.14", APIVersions: "1-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "coil node1 coild-a 2.0.13 - true" {
+		t.Error("unexpected line:", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "coild node1 coild-a 2.0.14 1-1 false" {
+		t.Error("unexpected line:", lines[2])
+	}
+}
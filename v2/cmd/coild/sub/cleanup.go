@@ -0,0 +1,58 @@
+package sub
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+)
+
+// cleanup removes Coil from the node so that another CNI plugin can take over.
+func cleanup(ctx context.Context, podNet nodenet.PodNetwork, nodeIPAM ipam.NodeIPAM, exporter nodenet.RouteExporter, serviceRules nodenet.ServiceRules) error {
+	// Remove the CNI configuration first so that kubelet stops creating Pods with Coil.
+	if config.cniConfFile != "" {
+		if err := os.Remove(config.cniConfFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", config.cniConfFile, err)
+		}
+		setupLog.Info("removed CNI configuration", "file", config.cniConfFile)
+	}
+
+	confs, err := podNet.List()
+	if err != nil {
+		return err
+	}
+	if len(confs) > 0 {
+		for _, c := range confs {
+			setupLog.Info("found a Pod interface using Coil", "pool", c.PoolName, "container", c.ContainerId, "iface", c.IFace)
+		}
+		return fmt.Errorf("%d Pod interfaces still use Coil; delete or migrate the Pods first", len(confs))
+	}
+
+	if config.releaseBlocks {
+		// As no containers are registered, all address blocks of the node are freed.
+		if err := nodeIPAM.GC(ctx); err != nil {
+			return fmt.Errorf("failed to release address blocks: %w", err)
+		}
+		setupLog.Info("released address blocks")
+	}
+
+	if err := exporter.Sync(nil); err != nil {
+		return fmt.Errorf("failed to remove exported routes: %w", err)
+	}
+	if config.uplinkInterface != "" {
+		if err := nodenet.NewMasquerader(config.uplinkInterface, setupLog).Cleanup(); err != nil {
+			return fmt.Errorf("failed to remove masquerade rules: %w", err)
+		}
+	}
+	if err := serviceRules.Cleanup(); err != nil {
+		return fmt.Errorf("failed to remove service rules: %w", err)
+	}
+	if err := podNet.Cleanup(); err != nil {
+		return err
+	}
+
+	setupLog.Info("cleanup completed")
+	return nil
+}
@@ -0,0 +1,73 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cybozu-go/coil/v2/pkg/handoff"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// runWithHandoff runs mgr until a signal is received or a new coild requests
+// a handoff.  In the latter case, the listener `l` is handed off after mgr
+// stops, then this waits for a signal without serving anything.
+func runWithHandoff(ctx context.Context, mgr manager.Manager, l net.Listener) error {
+	ul, ok := l.(*net.UnixListener)
+	if !ok {
+		return errors.New("the listener is not a UNIX domain socket")
+	}
+	// keep the socket file for the next coild.
+	ul.SetUnlinkOnClose(false)
+
+	// The socket keeps listening with this duplicated descriptor
+	// after the gRPC server closes the listener.
+	f, err := ul.File()
+	if err != nil {
+		return fmt.Errorf("failed to duplicate the listener: %w", err)
+	}
+	defer f.Close()
+
+	s, err := handoff.Listen(config.handoffSocket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", config.handoffSocket, err)
+	}
+	defer s.Close()
+
+	mctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reqCh := make(chan *handoff.Request, 1)
+	go func() {
+		req, err := s.Accept(mctx)
+		if err != nil {
+			if mctx.Err() == nil {
+				setupLog.Error(err, "failed to accept a handoff request")
+			}
+			return
+		}
+		setupLog.Info("a new coild requested a handoff; stopping")
+		reqCh <- req
+		cancel()
+	}()
+
+	setupLog.Info("starting manager")
+	if err := mgr.Start(mctx); err != nil {
+		setupLog.Error(err, "problem running manager")
+		return err
+	}
+
+	var req *handoff.Request
+	select {
+	case req = <-reqCh:
+	default:
+		return nil
+	}
+	if err := req.Complete(f); err != nil {
+		return fmt.Errorf("failed to hand off the socket: %w", err)
+	}
+
+	setupLog.Info("handed off the socket; waiting for termination")
+	<-ctx.Done()
+	return nil
+}
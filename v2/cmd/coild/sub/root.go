@@ -4,9 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/clientconfig"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/cybozu-go/coil/v2/runners"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -18,11 +22,47 @@ var config struct {
 	podTableId       int
 	podRulePrio      int
 	exportTableId    int
+	serviceCIDRs     []string
+	serviceRulePrio  int
 	protocolId       int
 	socketPath       string
+	freeQueueDir     string
 	compatCalico     bool
 	egressPort       int
 	registerFromMain bool
+	uplinkInterface  string
+	enableFastPath   bool
+	clusterName      string
+	preallocBlocks   int
+	blockReqConcur   int
+	blockReqBudgets  map[string]int
+	apiUsers         []string
+	cleanup          bool
+	releaseBlocks    bool
+	cniConfFile      string
+	apiAudiences     []string
+	heartbeat        time.Duration
+	vethJanitor      time.Duration
+	readOnly         bool
+	addDedupWindow   time.Duration
+	readinessGate    bool
+	probePodNetwork  bool
+	probeTargets     []string
+	probeTimeout     time.Duration
+	selfTest         bool
+	selfTestIPv4     string
+	selfTestIPv6     string
+	podRoutes        []string
+	accountingLabels []string
+	policyCommand    string
+	policyURL        string
+	policyTimeout    time.Duration
+	policyFailOpen   bool
+	handoffSocket    string
+	allocationID     string
+	handoffTimeout   time.Duration
+	restrictCaps     bool
+	clientOpts       clientconfig.Options
 	zapOpts          zap.Options
 }
 
@@ -55,12 +95,49 @@ func init() {
 	pf.StringVar(&config.healthAddr, "health-addr", ":9385", "bind address of health/readiness probes")
 	pf.IntVar(&config.podTableId, "pod-table-id", 116, "routing table ID to which coild registers routes for Pods")
 	pf.IntVar(&config.podRulePrio, "pod-rule-prio", 2000, "priority with which the rule for Pod table is inserted")
+	pf.StringSliceVar(&config.serviceCIDRs, "service-cidrs", nil, "Service CIDRs of Kubernetes to route with the main table before the Pod table; this keeps address blocks of Coil from capturing Service traffic")
+	pf.IntVar(&config.serviceRulePrio, "service-rule-prio", 1999, "priority with which the rules for --service-cidrs are inserted; must be less than --pod-rule-prio")
 	pf.IntVar(&config.exportTableId, "export-table-id", 119, "routing table ID to which coild exports routes")
 	pf.IntVar(&config.protocolId, "protocol-id", 30, "route author ID")
 	pf.StringVar(&config.socketPath, "socket", constants.DefaultSocketPath, "UNIX domain socket path")
+	pf.StringVar(&config.freeQueueDir, "free-queue-dir", constants.DefaultFreeQueueDir, "directory where coil records deleted containers while coild is unavailable")
 	pf.BoolVar(&config.compatCalico, "compat-calico", false, "make veth name compatible with Calico")
 	pf.IntVar(&config.egressPort, "egress-port", 5555, "UDP port number for egress NAT")
 	pf.BoolVar(&config.registerFromMain, "register-from-main", false, "help migration from Coil 2.0.1")
+	pf.StringVar(&config.uplinkInterface, "uplink-interface", "", "uplink network interface to probe address conflicts, proxy ARP/NDP, masquerade Pod traffic, and attach macvlan Pods")
+	pf.BoolVar(&config.enableFastPath, "enable-fast-path", false, "forward packets between Pods on the node with eBPF and export their traffic counters")
+	pf.IntVar(&config.preallocBlocks, "prealloc-blocks", 0, "number of address blocks of the default pool to acquire in advance")
+	pf.IntVar(&config.blockReqConcur, "block-request-concurrency", 0, "number of address blocks requested at once across pools; 0 means no limit")
+	pf.StringToIntVar(&config.blockReqBudgets, "block-request-budget", nil, "maximum number of address blocks requested per minute for each pool, e.g. default=10")
+	pf.StringSliceVar(&config.apiUsers, "api-allowed-users", nil, "if given, require a token of these users verified by TokenReview on API calls")
+	pf.StringSliceVar(&config.apiAudiences, "api-token-audiences", nil, "audiences of tokens accepted with --api-allowed-users")
+	pf.StringVar(&config.clusterName, "cluster-name", "", "if given, address blocks labeled with other cluster names are ignored")
+	pf.DurationVar(&config.heartbeat, "heartbeat-interval", 0, "interval to renew the heartbeat lease of coild; 0 disables it")
+	pf.DurationVar(&config.vethJanitor, "veth-janitor-interval", 0, "interval to delete host-side veths left behind by crashed containers; 0 disables it")
+	pf.BoolVar(&config.readOnly, "read-only", false, "start in read-only mode to refuse allocating and freeing addresses")
+	pf.DurationVar(&config.addDedupWindow, "add-dedup-window", 0, "period to reuse the result of ADD for retries of the same container; 0 disables it")
+	pf.BoolVar(&config.readinessGate, "readiness-gate", false, "set the condition of "+constants.ConditionNetworkReady+" readiness gate of Pods on the node")
+	pf.BoolVar(&config.probePodNetwork, "probe-pod-network", false, "send ICMP echo requests from Pods after setting up their network and record the result as Events")
+	pf.StringSliceVar(&config.probeTargets, "probe-targets", nil, "addresses to probe with --probe-pod-network; defaults to the node addresses")
+	pf.DurationVar(&config.probeTimeout, "probe-timeout", nodenet.DefaultProbeTimeout, "timeout of each probe with --probe-pod-network")
+	pf.BoolVar(&config.selfTest, "self-test", false, "verify the datapath with a scratch network namespace on startup, and become ready only if it passes")
+	pf.StringVar(&config.selfTestIPv4, "self-test-ipv4", nodenet.DefaultSelfTestIPv4.String(), "IPv4 address of the scratch network namespace for --self-test")
+	pf.StringVar(&config.selfTestIPv6, "self-test-ipv6", nodenet.DefaultSelfTestIPv6.String(), "IPv6 address of the scratch network namespace for --self-test")
+	pf.StringSliceVar(&config.accountingLabels, "pod-accounting-labels", nil, "label keys of Pods to report in /status/pods along with their owner workloads, e.g. app.kubernetes.io/name")
+	pf.StringSliceVar(&config.podRoutes, "pod-routes", nil, "additional destinations in CIDR notation routed via the gateway in every Pod, e.g. a node-local DNS cache")
+	pf.StringVar(&config.policyCommand, "allocation-policy-command", "", "command to review allocations of addresses; it reads a review from stdin and writes a decision to stdout in JSON")
+	pf.StringVar(&config.policyURL, "allocation-policy-url", "", "URL of an Open Policy Agent compatible Data API to review allocations of addresses")
+	pf.DurationVar(&config.policyTimeout, "allocation-policy-timeout", 5*time.Second, "timeout of each review with --allocation-policy-command or --allocation-policy-url")
+	pf.BoolVar(&config.policyFailOpen, "allocation-policy-fail-open", false, "allow allocations when the allocation policy fails")
+	pf.StringVar(&config.handoffSocket, "handoff-socket", "", "if given, take over the socket from the running coild and hand it off to the next coild through this UNIX domain socket")
+	pf.DurationVar(&config.handoffTimeout, "handoff-timeout", 30*time.Second, "timeout to wait for the running coild to hand off the socket")
+	pf.StringVar(&config.allocationID, "allocation-id", runners.AllocationIDContainer, "ID to allocate addresses for: \"container\" for each container ID, or \"pod\" for each Pod to keep addresses across sandbox restarts")
+	pf.BoolVar(&config.restrictCaps, "restrict-capabilities", false, "drop the capabilities that coild does not use after starting")
+	pf.BoolVar(&config.cleanup, "cleanup", false, "remove routes, rules, and files of Coil from the node and exit")
+	pf.BoolVar(&config.releaseBlocks, "cleanup-release-blocks", false, "return address blocks of the node to the pools with --cleanup")
+	pf.StringVar(&config.cniConfFile, "cleanup-cni-conf", "", "CNI configuration file to remove with --cleanup")
+
+	config.clientOpts.AddFlags(pf)
 
 	goflags := flag.NewFlagSet("klog", flag.ExitOnError)
 	klog.InitFlags(goflags)
@@ -3,27 +3,45 @@ package sub
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"time"
 
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/controllers"
+	"github.com/cybozu-go/coil/v2/pkg/capability"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/handoff"
 	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/loglevel"
 	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/cybozu-go/coil/v2/pkg/routeaudit"
 	"github.com/cybozu-go/coil/v2/runners"
 	"github.com/go-logr/zapr"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const (
-	gracefulTimeout = 20 * time.Second
+	gracefulTimeout    = 20 * time.Second
+	freeQueueInterval  = 1 * time.Minute
+	neighProxyInterval = 1 * time.Minute
+	masqueradeInterval = 1 * time.Minute
 )
 
 var (
@@ -31,6 +49,17 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// capabilities are the capabilities that coild keeps with --restrict-capabilities.
+// See "Required privileges" in docs/cmd-coild.md for what they are used for.
+var capabilities = []int{
+	unix.CAP_NET_ADMIN,
+	unix.CAP_NET_RAW,
+	unix.CAP_SYS_ADMIN,
+	unix.CAP_SYS_PTRACE,
+	unix.CAP_SYS_MODULE,
+	unix.CAP_BPF,
+}
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(coilv2.AddToScheme(scheme))
@@ -39,25 +68,50 @@ func init() {
 }
 
 func subMain() error {
+	// this re-executes coild, so it must come before anything else.
+	if config.restrictCaps {
+		if err := capability.Restrict(capabilities); err != nil {
+			return err
+		}
+	}
+
+	logLevel := loglevel.Setup(&config.zapOpts)
 	// coild needs a raw zap logger for grpc_zip.
 	zapLogger := zap.NewRaw(zap.UseFlagOptions(&config.zapOpts))
 	defer zapLogger.Sync()
 
 	grpcLogger := zapLogger.Named("grpc")
 	ctrl.SetLogger(zapr.NewLogger(zapLogger))
+	if config.restrictCaps {
+		setupLog.Info("restricted capabilities")
+	}
 
 	nodeName := os.Getenv(constants.EnvNode)
 	if nodeName == "" {
 		return errors.New(constants.EnvNode + " environment variable should be set")
 	}
+	if err := runners.ValidateAllocationIDKind(config.allocationID); err != nil {
+		return err
+	}
+
+	cfg, err := config.clientOpts.Config()
+	if err != nil {
+		return err
+	}
 
 	timeout := gracefulTimeout
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                  scheme,
 		LeaderElection:          false,
 		MetricsBindAddress:      config.metricsAddr,
 		GracefulShutdownTimeout: &timeout,
 		HealthProbeBindAddress:  config.healthAddr,
+		// coild watches only Pods on the node.
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Pod{}: {Field: fields.OneTermEqualSelector("spec.nodeName", nodeName)},
+			},
+		}),
 	})
 	if err != nil {
 		return err
@@ -69,9 +123,23 @@ func subMain() error {
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		return err
 	}
+	if err := mgr.AddMetricsExtraHandler("/debug/loglevel", loglevel.Handler(logLevel)); err != nil {
+		return err
+	}
 
 	exporter := nodenet.NewRouteExporter(config.exportTableId, config.protocolId, ctrl.Log.WithName("route-exporter"))
-	nodeIPAM := ipam.NewNodeIPAM(nodeName, ctrl.Log.WithName("node-ipam"), mgr, exporter)
+	var prober nodenet.ConflictProber
+	if config.uplinkInterface != "" {
+		prober = nodenet.NewConflictProber(config.uplinkInterface, nodenet.DefaultProbeTimeout)
+	}
+	var limiter *ipam.BlockRequestLimiter
+	if config.blockReqConcur != 0 || len(config.blockReqBudgets) > 0 {
+		limiter, err = ipam.NewBlockRequestLimiter(config.blockReqConcur, config.blockReqBudgets)
+		if err != nil {
+			return err
+		}
+	}
+	nodeIPAM := ipam.NewNodeIPAM(nodeName, config.clusterName, ctrl.Log.WithName("node-ipam"), mgr, exporter, prober, limiter)
 	watcher := &controllers.BlockRequestWatcher{
 		Client:   mgr.GetClient(),
 		NodeIPAM: nodeIPAM,
@@ -80,14 +148,35 @@ func subMain() error {
 	if err := watcher.SetupWithManager(mgr); err != nil {
 		return err
 	}
+	handoffWatcher := &controllers.BlockHandoffWatcher{
+		Client:   mgr.GetClient(),
+		NodeIPAM: nodeIPAM,
+		NodeName: nodeName,
+	}
+	if err := handoffWatcher.SetupWithManager(mgr); err != nil {
+		return err
+	}
 
 	ctx := context.Background()
+	coilCfg := coilconfig.NewStore(coilconfig.Defaults{DefaultPool: constants.DefaultPool})
+	if _, err := coilCfg.Load(ctx, mgr.GetAPIReader()); err != nil {
+		// the watcher applies the config once it is fixed.
+		setupLog.Error(err, "failed to load the config; using the defaults")
+	}
+	cfgWatcher := &controllers.CoilConfigWatcher{
+		Client: mgr.GetClient(),
+		Store:  coilCfg,
+	}
+	if err := cfgWatcher.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
 	ipv4, ipv6, err := nodeIPAM.NodeInternalIP(ctx)
 	if err != nil {
 		return err
 	}
 
-	podNet := nodenet.NewPodNetwork(
+	var datapath nodenet.Datapath = nodenet.NewRoutedDatapath(
 		config.podTableId,
 		config.podRulePrio,
 		config.protocolId,
@@ -96,9 +185,91 @@ func subMain() error {
 		config.compatCalico,
 		config.registerFromMain,
 		ctrl.Log.WithName("pod-network"))
+	if config.enableFastPath {
+		fastPath := nodenet.NewFastPath(datapath, ctrl.Log.WithName("fast-path"))
+		if err := metrics.Registry.Register(nodenet.NewTrafficCollector(fastPath, ctrl.Log.WithName("traffic-metrics"))); err != nil {
+			return err
+		}
+		datapath = fastPath
+	}
+	datapaths := []nodenet.Datapath{datapath}
+	if config.uplinkInterface != "" {
+		datapaths = append(datapaths, nodenet.NewMACVLANDatapath(config.uplinkInterface, constants.DefaultMACVLANStateDir, ctrl.Log.WithName("macvlan")))
+	}
+	podNet := nodenet.NewPodNetworkWithDatapaths(datapaths, ctrl.Log.WithName("pod-network"))
+	serviceCIDRs, err := parseCIDRs("service-cidrs", config.serviceCIDRs)
+	if err != nil {
+		return err
+	}
+	if len(serviceCIDRs) > 0 && config.serviceRulePrio >= config.podRulePrio {
+		return errors.New("--service-rule-prio should be less than --pod-rule-prio")
+	}
+	serviceRules := nodenet.NewServiceRules(serviceCIDRs, config.serviceRulePrio, ctrl.Log.WithName("service-rules"))
+	if config.cleanup {
+		return cleanup(ctx, podNet, nodeIPAM, exporter, serviceRules)
+	}
+	// Take over the socket before changing or reading the state of the node
+	// so that the running coild no longer changes it.
+	var l net.Listener
+	if config.handoffSocket != "" {
+		l, err = handoff.Receive(config.handoffSocket, config.handoffTimeout)
+		switch {
+		case errors.Is(err, handoff.ErrNoPeer):
+		case err != nil:
+			return fmt.Errorf("failed to take over the socket from the running coild: %w", err)
+		default:
+			setupLog.Info("took over the socket from the running coild")
+		}
+	}
+
 	if err := podNet.Init(); err != nil {
 		return err
 	}
+	// Init also removes the rules when --service-cidrs is no longer given.
+	if err := serviceRules.Init(); err != nil {
+		return err
+	}
+	if config.selfTest {
+		if err := selfTest(mgr, podNet, ipv4, ipv6); err != nil {
+			return err
+		}
+	}
+	if config.uplinkInterface != "" {
+		proxy := nodenet.NewNeighborProxy(config.uplinkInterface, ctrl.Log.WithName("neighbor-proxy"))
+		syncer := runners.NewNeighborProxySyncer(mgr.GetClient(), podNet, proxy, neighProxyInterval, ctrl.Log.WithName("neighbor-proxy-syncer"))
+		if err := mgr.Add(syncer); err != nil {
+			return err
+		}
+		podNet = syncer.PodNetwork(podNet)
+
+		masq := nodenet.NewMasquerader(config.uplinkInterface, ctrl.Log.WithName("masquerade"))
+		if err := mgr.Add(runners.NewMasqueradeSyncer(mgr.GetClient(), masq, masqueradeInterval, ctrl.Log.WithName("masquerade-syncer"))); err != nil {
+			return err
+		}
+	}
+	if config.readinessGate {
+		readiness := &controllers.NetworkReadinessWatcher{
+			Client:     mgr.GetClient(),
+			PodNetwork: podNet,
+			NodeName:   nodeName,
+		}
+		if err := readiness.SetupWithManager(mgr); err != nil {
+			return err
+		}
+	}
+	accounting := runners.NewPodAccountingHandler(mgr.GetAPIReader(), podNet, nodeName, config.accountingLabels, ctrl.Log.WithName("pod-accounting"))
+	if err := mgr.AddMetricsExtraHandler("/status/pods", accounting); err != nil {
+		return err
+	}
+	routeStatus := runners.NewRouteStatusHandler(exporter, nodeName, ctrl.Log.WithName("route-status"))
+	if err := mgr.AddMetricsExtraHandler(routeaudit.StatusPath, routeStatus); err != nil {
+		return err
+	}
+	churn := runners.NewChurnTracker(nodeName)
+	if err := mgr.AddMetricsExtraHandler("/status/churn", churn); err != nil {
+		return err
+	}
+
 	podConfigs, err := podNet.List()
 	if err != nil {
 		return err
@@ -108,20 +279,124 @@ func subMain() error {
 		if err := nodeIPAM.Register(ctx, c.PoolName, c.ContainerId, c.IFace, c.IPv4, c.IPv6); err != nil {
 			return err
 		}
+		for i, e := range c.Extra {
+			if err := nodeIPAM.Register(ctx, e.PoolName, c.ContainerId, ipam.ExtraIFace(c.IFace, i+1), e.IPv4, e.IPv6); err != nil {
+				return err
+			}
+		}
 	}
-	if err := nodeIPAM.GC(ctx); err != nil {
+	readOnly := runners.NewReadOnlyMode(config.readOnly, ctrl.Log.WithName("read-only"))
+	if readOnly.Enabled() {
+		setupLog.Info("skipped garbage collection of addresses in read-only mode")
+	} else if err := nodeIPAM.GC(ctx); err != nil {
 		return err
 	}
 
-	os.Remove(config.socketPath)
-	l, err := net.Listen("unix", config.socketPath)
+	if l == nil {
+		os.Remove(config.socketPath)
+		l, err = net.Listen("unix", config.socketPath)
+		if err != nil {
+			return err
+		}
+	}
+	var verifier runners.TokenVerifier
+	if len(config.apiUsers) > 0 {
+		verifier = runners.NewTokenVerifier(mgr.GetClient(), config.apiUsers, config.apiAudiences)
+	}
+	podNS, podName := os.Getenv(constants.EnvPodNamespace), os.Getenv(constants.EnvPodName)
+	var versions runners.VersionPublisher
+	if podNS != "" && podName != "" {
+		versions = runners.NewVersionPublisher(mgr.GetClient(), client.ObjectKey{Namespace: podNS, Name: podName},
+			cnirpc.SupportedAPIVersions(), ctrl.Log.WithName("version-publisher"))
+		if err := mgr.Add(versions); err != nil {
+			return err
+		}
+	}
+	if podNS != "" && config.heartbeat > 0 {
+		hb := runners.NewHeartbeat(mgr.GetClient(), podNS, nodeName, config.heartbeat, ctrl.Log.WithName("heartbeat"))
+		if err := mgr.Add(hb); err != nil {
+			return err
+		}
+	}
+	var netProber runners.NetworkProber
+	if config.probePodNetwork {
+		targets, err := probeTargets(config.probeTargets, ipv4, ipv6)
+		if err != nil {
+			return err
+		}
+		netProber = runners.NewNetworkProber(mgr.GetEventRecorderFor("coild"), targets, config.probeTimeout, ctrl.Log.WithName("network-prober"))
+	}
+	var policy runners.AllocationPolicy
+	switch {
+	case config.policyCommand != "" && config.policyURL != "":
+		return errors.New("--allocation-policy-command and --allocation-policy-url are exclusive")
+	case config.policyCommand != "":
+		policy = runners.NewExecAllocationPolicy(config.policyCommand, config.policyTimeout, config.policyFailOpen, ctrl.Log.WithName("allocation-policy"))
+	case config.policyURL != "":
+		policy = runners.NewHTTPAllocationPolicy(config.policyURL, config.policyTimeout, config.policyFailOpen, ctrl.Log.WithName("allocation-policy"))
+	}
+	podRoutes, err := parseCIDRs("pod-routes", config.podRoutes)
 	if err != nil {
 		return err
 	}
-	server := runners.NewCoildServer(l, mgr, nodeIPAM, podNet, runners.NewNATSetup(config.egressPort), grpcLogger)
+	nodeStatus := runners.NewNodeStatusReporter(mgr.GetAPIReader(), podNet, exporter, nodeName)
+	server := runners.NewCoildServer(l, mgr, nodeIPAM, podNet, runners.NewNATSetup(config.egressPort), runners.CoildServerOptions{
+		Verifier:         verifier,
+		Versions:         versions,
+		ReadOnly:         readOnly,
+		Prober:           netProber,
+		Policy:           policy,
+		Churn:            churn,
+		Config:           coilCfg,
+		PodRoutes:        podRoutes,
+		AllocationIDKind: config.allocationID,
+		LogLevel:         &logLevel,
+		Status:           nodeStatus,
+		AddDedupWindow:   config.addDedupWindow,
+	}, grpcLogger)
 	if err := mgr.Add(server); err != nil {
 		return err
 	}
+	nsWatcher := &controllers.NamespaceWatcher{
+		Client:  mgr.GetClient(),
+		Sweeper: server,
+	}
+	if err := nsWatcher.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	drainer := runners.NewFreeQueueDrainer(config.freeQueueDir, nodeIPAM, podNet, readOnly, config.allocationID, freeQueueInterval, ctrl.Log.WithName("free-queue"))
+	if err := mgr.Add(drainer); err != nil {
+		return err
+	}
+
+	if config.vethJanitor > 0 {
+		janitor := runners.NewVethJanitor(nodeIPAM, podNet, readOnly, config.vethJanitor, ctrl.Log.WithName("veth-janitor"))
+		if err := mgr.Add(janitor); err != nil {
+			return err
+		}
+	}
+
+	if config.preallocBlocks > 0 {
+		err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			if readOnly.Enabled() {
+				setupLog.Info("skipped preallocation of address blocks in read-only mode")
+				return nil
+			}
+			// failures are not fatal because blocks are acquired on demand anyway.
+			if err := nodeIPAM.Preallocate(ctx, coilCfg.DefaultPool(), config.preallocBlocks); err != nil {
+				setupLog.Error(err, "failed to preallocate address blocks")
+			}
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.handoffSocket != "" {
+		return runWithHandoff(ctrl.SetupSignalHandler(), mgr, l)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -131,3 +406,72 @@ func subMain() error {
 
 	return nil
 }
+
+// probeTargets parses the addresses given by --probe-targets.
+// If none are given, the node addresses are returned.
+func probeTargets(addrs []string, nodeIPv4, nodeIPv6 net.IP) ([]net.IP, error) {
+	if len(addrs) == 0 {
+		var targets []net.IP
+		for _, ip := range []net.IP{nodeIPv4, nodeIPv6} {
+			if ip != nil {
+				targets = append(targets, ip)
+			}
+		}
+		return targets, nil
+	}
+
+	targets := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address in --probe-targets: %s", a)
+		}
+		targets = append(targets, ip)
+	}
+	return targets, nil
+}
+
+// selfTest runs nodenet.SelfTest with the addresses of the families the node has.
+// If the test fails, coild keeps running for investigation but never becomes ready.
+func selfTest(mgr manager.Manager, podNet nodenet.PodNetwork, nodeIPv4, nodeIPv6 net.IP) error {
+	var testIPv4, testIPv6 net.IP
+	var targets []net.IP
+	if nodeIPv4 != nil {
+		testIPv4 = net.ParseIP(config.selfTestIPv4).To4()
+		if testIPv4 == nil {
+			return fmt.Errorf("invalid IPv4 address in --self-test-ipv4: %s", config.selfTestIPv4)
+		}
+		targets = append(targets, nodeIPv4)
+	}
+	if nodeIPv6 != nil {
+		testIPv6 = net.ParseIP(config.selfTestIPv6)
+		if testIPv6 == nil || testIPv6.To4() != nil {
+			return fmt.Errorf("invalid IPv6 address in --self-test-ipv6: %s", config.selfTestIPv6)
+		}
+		targets = append(targets, nodeIPv6)
+	}
+
+	testErr := nodenet.SelfTest(podNet, testIPv4, testIPv6, targets, nodenet.DefaultProbeTimeout)
+	if testErr != nil {
+		setupLog.Error(testErr, "self-test failed; coild will not become ready")
+		testErr = fmt.Errorf("self-test failed: %w", testErr)
+	} else {
+		setupLog.Info("self-test passed")
+	}
+	return mgr.AddReadyzCheck("self-test", func(*http.Request) error {
+		return testErr
+	})
+}
+
+// parseCIDRs parses the CIDRs given by the flag `name`.
+func parseCIDRs(name string, cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR in --%s: %s", name, c)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
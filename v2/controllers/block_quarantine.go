@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// EventBlockQuarantined is the reason of Events recorded for quarantined blocks.
+const EventBlockQuarantined = "BlockQuarantined"
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch
+
+// SetupBlockQuarantineNotifier registers a reconciler to record Warning
+// Events for AddressBlocks quarantined by coild.  The Events are recorded
+// for both the block and its node.
+func SetupBlockQuarantineNotifier(mgr ctrl.Manager) error {
+	r := &blockQuarantineNotifier{
+		client:   mgr.GetClient(),
+		recorder: mgr.GetEventRecorderFor("coil-controller"),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&coilv2.AddressBlock{}, builder.WithPredicates(predicate.Funcs{
+			// predicate.Funcs returns true by default
+			CreateFunc: func(ev event.CreateEvent) bool {
+				return isQuarantined(ev.Object)
+			},
+			UpdateFunc: func(ev event.UpdateEvent) bool {
+				return isQuarantined(ev.ObjectNew) && !isQuarantined(ev.ObjectOld)
+			},
+			DeleteFunc: func(event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		})).
+		Named("block-quarantine").
+		Complete(r)
+}
+
+func isQuarantined(o client.Object) bool {
+	return o.GetLabels()[constants.LabelQuarantined] == "true"
+}
+
+type blockQuarantineNotifier struct {
+	client   client.Client
+	recorder record.EventRecorder
+}
+
+func (r *blockQuarantineNotifier) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	block := &coilv2.AddressBlock{}
+	if err := r.client.Get(ctx, req.NamespacedName, block); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !isQuarantined(block) {
+		return ctrl.Result{}, nil
+	}
+
+	nodeName := block.Labels[constants.LabelNode]
+	reason := block.Annotations[constants.AnnQuarantineReason]
+	logger.Info("block is quarantined", "node", nodeName, "reason", reason)
+	r.recorder.Eventf(block, corev1.EventTypeWarning, EventBlockQuarantined,
+		"quarantined on node %s: %s", nodeName, reason)
+
+	node := &corev1.Node{}
+	err := r.client.Get(ctx, client.ObjectKey{Name: nodeName}, node)
+	if apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.recorder.Eventf(node, corev1.EventTypeWarning, EventBlockQuarantined,
+		"address block %s of pool %s is quarantined: %s", block.Name, block.Labels[constants.LabelPool], reason)
+	return ctrl.Result{}, nil
+}
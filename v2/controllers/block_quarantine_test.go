@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("BlockQuarantineNotifier", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.TODO())
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = SetupBlockQuarantineNotifier(mgr)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &coilv2.AddressBlock{}, client.MatchingLabels{constants.LabelNode: "node1"})
+		Expect(err).ShouldNot(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should record Events for quarantined blocks", func() {
+		block := &coilv2.AddressBlock{}
+		block.Name = "quarantine-0"
+		block.Labels = map[string]string{
+			constants.LabelPool: "default",
+			constants.LabelNode: "node1",
+		}
+		block.IPv4 = strPtr("10.50.0.0/30")
+		err := k8sClient.Create(ctx, block)
+		Expect(err).ToNot(HaveOccurred())
+
+		block.Labels[constants.LabelQuarantined] = "true"
+		block.Annotations = map[string]string{constants.AnnQuarantineReason: "file exists"}
+		err = k8sClient.Update(ctx, block)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() []string {
+			events := &corev1.EventList{}
+			if err := k8sClient.List(ctx, events); err != nil {
+				return nil
+			}
+			var kinds []string
+			for _, ev := range events.Items {
+				if ev.Reason != EventBlockQuarantined {
+					continue
+				}
+				kinds = append(kinds, ev.InvolvedObject.Kind+"/"+ev.InvolvedObject.Name)
+			}
+			return kinds
+		}).Should(ConsistOf("AddressBlock/quarantine-0", "Node/node1"))
+	})
+})
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+)
+
+// handoffRetryInterval is the interval to retry handoff of a block in use.
+const handoffRetryInterval = 1 * time.Minute
+
+// BlockHandoffWatcher watches AddressBlocks of a node annotated to be
+// handed off to another node.
+type BlockHandoffWatcher struct {
+	client.Client
+	NodeIPAM ipam.NodeIPAM
+	NodeName string
+}
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch
+
+// Reconcile implements Reconcile interface.
+func (r *BlockHandoffWatcher) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := logr.FromContext(ctx)
+
+	block := &coilv2.AddressBlock{}
+	if err := r.Client.Get(ctx, req.NamespacedName, block); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The following conditions have been checked in the event filter.
+	// These are just safeguards.
+	if !r.isTarget(block) {
+		return ctrl.Result{}, nil
+	}
+
+	to := block.Annotations[constants.AnnHandoffTo]
+	err := r.NodeIPAM.Handoff(ctx, block.Name, to)
+	if errors.Is(err, ipam.ErrBlockInUse) {
+		logger.Info("block is in use; will retry later", "to", to)
+		return ctrl.Result{RequeueAfter: handoffRetryInterval}, nil
+	}
+	if err != nil {
+		logger.Error(err, "failed to hand off block", "to", to)
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("handed off", "to", to)
+	return ctrl.Result{}, nil
+}
+
+func (r *BlockHandoffWatcher) isTarget(block *coilv2.AddressBlock) bool {
+	if block.Labels[constants.LabelNode] != r.NodeName {
+		return false
+	}
+	to, ok := block.Annotations[constants.AnnHandoffTo]
+	return ok && to != "" && to != r.NodeName
+}
+
+// SetupWithManager registers this with the manager.
+func (r *BlockHandoffWatcher) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&coilv2.AddressBlock{}, builder.WithPredicates(predicate.Funcs{
+			// predicate.Funcs returns true by default
+			CreateFunc: func(ev event.CreateEvent) bool {
+				return r.isTarget(ev.Object.(*coilv2.AddressBlock))
+			},
+			UpdateFunc: func(ev event.UpdateEvent) bool {
+				return r.isTarget(ev.ObjectNew.(*coilv2.AddressBlock))
+			},
+			DeleteFunc: func(event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		})).
+		Complete(r)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("BlockHandoff watcher", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	var nodeIPAM *mockNodeIPAM
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.TODO())
+		nodeIPAM = &mockNodeIPAM{}
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		bhw := &BlockHandoffWatcher{
+			Client:   mgr.GetClient(),
+			NodeIPAM: nodeIPAM,
+			NodeName: "node1",
+		}
+		err = bhw.SetupWithManager(mgr)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &coilv2.AddressBlock{})
+		Expect(err).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should hand off annotated blocks of the node", func() {
+		By("creating blocks")
+		for _, node := range []string{"node1", "node2"} {
+			b := &coilv2.AddressBlock{}
+			b.Name = "default-" + node
+			b.Labels = map[string]string{
+				constants.LabelPool: "default",
+				constants.LabelNode: node,
+			}
+			err := k8sClient.Create(ctx, b)
+			Expect(err).To(Succeed())
+		}
+		time.Sleep(10 * time.Millisecond)
+		Expect(nodeIPAM.GetHandoffs()).To(BeEmpty())
+
+		By("annotating the blocks")
+		for _, node := range []string{"node1", "node2"} {
+			b := &coilv2.AddressBlock{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "default-" + node}, b)
+			Expect(err).To(Succeed())
+			b.Annotations = map[string]string{constants.AnnHandoffTo: "node3"}
+			err = k8sClient.Update(ctx, b)
+			Expect(err).To(Succeed())
+		}
+
+		Eventually(func() map[string]string {
+			return nodeIPAM.GetHandoffs()
+		}).Should(Equal(map[string]string{"default-node1": "node3"}))
+	})
+})
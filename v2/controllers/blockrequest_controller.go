@@ -8,6 +8,7 @@ import (
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
 	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/notify"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -24,6 +25,9 @@ type BlockRequestReconciler struct {
 	client.Client
 	Scheme  *runtime.Scheme
 	Manager ipam.PoolManager
+
+	// Notifier is optional.  If set, pool exhaustion is notified through it.
+	Notifier notify.Notifier
 }
 
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=blockrequests,verbs=get;list;watch
@@ -63,31 +67,75 @@ func (r *BlockRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
-	block, err := r.Manager.AllocateBlock(ctx, br.Spec.PoolName, br.Spec.NodeName, string(br.UID))
+	allocCtx := ctx
+	if br.Spec.Critical {
+		allocCtx = ipam.WithCritical(ctx)
+	}
+	block, err := r.Manager.AllocateBlock(allocCtx, br.Spec.PoolName, br.Spec.NodeName, string(br.UID))
 	if errors.Is(err, ipam.ErrNoBlock) {
 		logger.Error(err, "out of blocks", "pool", br.Spec.PoolName)
+		msg := fmt.Sprintf("pool %s does not have free blocks", br.Spec.PoolName)
+		if r.Notifier != nil {
+			r.Notifier.Notify(notify.Event{
+				Type:    notify.EventPoolExhausted,
+				Pool:    br.Spec.PoolName,
+				Node:    br.Spec.NodeName,
+				Message: msg,
+			})
+		}
 
-		now := metav1.Now()
-		br.Status.Conditions = []coilv2.BlockRequestCondition{
-			{
-				Type:               coilv2.BlockRequestComplete,
-				Status:             corev1.ConditionTrue,
-				Reason:             "completed with failure",
-				Message:            "completed with failure",
-				LastProbeTime:      now,
-				LastTransitionTime: now,
-			},
-			{
-				Type:               coilv2.BlockRequestFailed,
-				Status:             corev1.ConditionTrue,
-				Reason:             "out of blocks",
-				Message:            fmt.Sprintf("pool %s does not have free blocks", br.Spec.PoolName),
-				LastProbeTime:      now,
-				LastTransitionTime: now,
-			},
+		if err := r.updateFailure(ctx, br, "out of blocks", msg); err != nil {
+			logger.Error(err, "failed to update status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if errors.Is(err, ipam.ErrNodeNotSelected) {
+		logger.Error(err, "node not selected", "pool", br.Spec.PoolName, "node", br.Spec.NodeName)
+
+		msg := fmt.Sprintf("node %s is not selected by pool %s", br.Spec.NodeName, br.Spec.PoolName)
+		if err := r.updateFailure(ctx, br, "node not selected", msg); err != nil {
+			logger.Error(err, "failed to update status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if errors.Is(err, ipam.ErrNodeBlockLimit) {
+		logger.Error(err, "node block limit", "pool", br.Spec.PoolName, "node", br.Spec.NodeName)
+
+		msg := fmt.Sprintf("node %s has the maximum number of blocks of pool %s", br.Spec.NodeName, br.Spec.PoolName)
+		if err := r.updateFailure(ctx, br, "node block limit", msg); err != nil {
+			logger.Error(err, "failed to update status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if errors.Is(err, ipam.ErrPoolReserved) {
+		logger.Error(err, "blocks reserved", "pool", br.Spec.PoolName)
+
+		msg := fmt.Sprintf("the remaining blocks of pool %s are reserved for critical pods", br.Spec.PoolName)
+		if err := r.updateFailure(ctx, br, "reserved for critical pods", msg); err != nil {
+			logger.Error(err, "failed to update status")
+			return ctrl.Result{}, err
 		}
-		err = r.Client.Status().Update(ctx, br)
-		if err != nil {
+		return ctrl.Result{}, nil
+	}
+	var pauseErr *ipam.PauseError
+	if errors.As(err, &pauseErr) {
+		logger.Error(err, "pool paused", "pool", br.Spec.PoolName)
+
+		msg := fmt.Sprintf("pool %s is paused: %s", br.Spec.PoolName, pauseErr.Reason)
+		if err := r.updateFailure(ctx, br, "pool paused", msg); err != nil {
+			logger.Error(err, "failed to update status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if errors.Is(err, ipam.ErrPoolCordoned) {
+		logger.Error(err, "pool cordoned", "pool", br.Spec.PoolName)
+
+		msg := fmt.Sprintf("pool %s is cordoned", br.Spec.PoolName)
+		if err := r.updateFailure(ctx, br, "pool cordoned", msg); err != nil {
 			logger.Error(err, "failed to update status")
 			return ctrl.Result{}, err
 		}
@@ -129,6 +177,29 @@ func (r *BlockRequestReconciler) updateStatus(ctx context.Context, br *coilv2.Bl
 	return nil
 }
 
+func (r *BlockRequestReconciler) updateFailure(ctx context.Context, br *coilv2.BlockRequest, reason, message string) error {
+	now := metav1.Now()
+	br.Status.Conditions = []coilv2.BlockRequestCondition{
+		{
+			Type:               coilv2.BlockRequestComplete,
+			Status:             corev1.ConditionTrue,
+			Reason:             "completed with failure",
+			Message:            "completed with failure",
+			LastProbeTime:      now,
+			LastTransitionTime: now,
+		},
+		{
+			Type:               coilv2.BlockRequestFailed,
+			Status:             corev1.ConditionTrue,
+			Reason:             reason,
+			Message:            message,
+			LastProbeTime:      now,
+			LastTransitionTime: now,
+		},
+	}
+	return r.Client.Status().Update(ctx, br)
+}
+
 // SetupWithManager registers this with the manager.
 func (r *BlockRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
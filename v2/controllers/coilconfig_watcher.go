@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+)
+
+// CoilConfigWatcher watches the CoilConfig and applies it to Store.
+type CoilConfigWatcher struct {
+	client.Client
+	Store *coilconfig.Store
+}
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=coilconfigs,verbs=get;list;watch
+
+// Reconcile implements Reconcile interface.
+func (r *CoilConfigWatcher) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := logr.FromContext(ctx)
+
+	changed, err := r.Store.Load(ctx, r.Client)
+	if err != nil {
+		// An invalid config is kept until it is fixed, so do not retry.
+		logger.Error(err, "failed to load the config")
+		return ctrl.Result{}, nil
+	}
+	if changed {
+		logger.Info("config updated",
+			"default_pool", r.Store.DefaultPool(),
+			"gc_interval", r.Store.GCInterval().String(),
+			"request_ttl", r.Store.RequestTTL().String(),
+			"renumber_interval", r.Store.RenumberInterval().String())
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager registers this with the manager.
+func (r *CoilConfigWatcher) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&coilv2.CoilConfig{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return o.GetName() == constants.CoilConfigName
+		}))).
+		Complete(r)
+}
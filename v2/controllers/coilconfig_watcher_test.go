@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("CoilConfig watcher", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	var store *coilconfig.Store
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.TODO())
+		store = coilconfig.NewStore(coilconfig.Defaults{GCInterval: time.Hour})
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		w := &CoilConfigWatcher{
+			Client: mgr.GetClient(),
+			Store:  store,
+		}
+		err = w.SetupWithManager(mgr)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &coilv2.CoilConfig{})
+		Expect(err).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should apply the config", func() {
+		By("creating the config")
+		cc := &coilv2.CoilConfig{}
+		cc.Name = constants.CoilConfigName
+		cc.Spec.DefaultPool = "global"
+		cc.Spec.GCInterval = &metav1.Duration{Duration: 10 * time.Minute}
+		err := k8sClient.Create(ctx, cc)
+		Expect(err).To(Succeed())
+
+		Eventually(store.DefaultPool).Should(Equal("global"))
+		Expect(store.GCInterval()).To(Equal(10 * time.Minute))
+
+		By("ignoring an invalid update")
+		cc.Spec.DefaultPool = "invalid"
+		cc.Spec.GCInterval = &metav1.Duration{Duration: -time.Minute}
+		err = k8sClient.Update(ctx, cc)
+		Expect(err).To(Succeed())
+
+		Consistently(store.DefaultPool).Should(Equal("global"))
+
+		By("ignoring configs of other names")
+		other := &coilv2.CoilConfig{}
+		other.Name = "other"
+		other.Spec.DefaultPool = "other"
+		err = k8sClient.Create(ctx, other)
+		Expect(err).To(Succeed())
+
+		Consistently(store.DefaultPool).Should(Equal("global"))
+
+		By("deleting the config")
+		err = k8sClient.Delete(ctx, cc)
+		Expect(err).To(Succeed())
+
+		Eventually(store.DefaultPool).Should(Equal(constants.DefaultPool))
+		Expect(store.GCInterval()).To(Equal(time.Hour))
+	})
+})
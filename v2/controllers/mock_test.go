@@ -99,6 +99,8 @@ func (pm *mockPoolManager) SetUsed(used bool) {
 type mockNodeIPAM struct {
 	mu       sync.Mutex
 	notified int
+	handoffs map[string]string
+	inUse    bool
 }
 
 var _ ipam.NodeIPAM = &mockNodeIPAM{}
@@ -116,10 +118,58 @@ func (n *mockNodeIPAM) Allocate(ctx context.Context, poolName, containerID, ifac
 	panic("not implemented")
 }
 
+func (n *mockNodeIPAM) AllocateSpread(ctx context.Context, poolName, containerID, iface, group string) (ipv4, ipv6 net.IP, err error) {
+	panic("not implemented")
+}
+
 func (n *mockNodeIPAM) Free(ctx context.Context, containerID, iface string) error {
 	panic("not implemented")
 }
 
+func (n *mockNodeIPAM) Transfer(fromID, fromIface, toID, toIface string) (net.IP, net.IP, bool) {
+	panic("not implemented")
+}
+
+func (n *mockNodeIPAM) Lookup(containerID, iface string) (net.IP, net.IP, bool) {
+	panic("not implemented")
+}
+
+func (n *mockNodeIPAM) Preallocate(ctx context.Context, poolName string, num int) error {
+	panic("not implemented")
+}
+
+func (n *mockNodeIPAM) Handoff(ctx context.Context, blockName, nodeName string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.inUse {
+		return ipam.ErrBlockInUse
+	}
+	if n.handoffs == nil {
+		n.handoffs = make(map[string]string)
+	}
+	n.handoffs[blockName] = nodeName
+	return nil
+}
+
+func (n *mockNodeIPAM) GetHandoffs() map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	handoffs := make(map[string]string)
+	for k, v := range n.handoffs {
+		handoffs[k] = v
+	}
+	return handoffs
+}
+
+func (n *mockNodeIPAM) SetInUse(inUse bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.inUse = inUse
+}
+
 func (n *mockNodeIPAM) Notify(req *coilv2.BlockRequest) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
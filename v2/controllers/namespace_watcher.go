@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// DefaultSweepDelay is the default of NamespaceWatcher.Delay.
+// It is longer than the time coild waits in DEL before destroying Pod networks.
+const DefaultSweepDelay = 1 * time.Minute
+
+// NamespaceSweeper frees the addresses that remain for Pods in a deleted namespace.
+type NamespaceSweeper interface {
+	SweepNamespace(ctx context.Context, namespace string) (int, error)
+}
+
+// NamespaceWatcher watches deletion of namespaces, and has Sweeper free
+// the addresses that remain for their Pods, e.g. because DEL never reached coild.
+type NamespaceWatcher struct {
+	client.Client
+	Sweeper NamespaceSweeper
+
+	// Delay is the time to wait for DEL of the Pods after the namespace is deleted.
+	// If zero, DefaultSweepDelay is used.
+	Delay time.Duration
+
+	mu      sync.Mutex
+	deleted map[string]time.Time
+}
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Reconcile implements Reconcile interface.
+func (r *NamespaceWatcher) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := logr.FromContext(ctx)
+
+	err := r.Client.Get(ctx, req.NamespacedName, &corev1.Namespace{})
+	switch {
+	case err == nil:
+		// re-created in the meantime.
+		r.forget(req.Name)
+		return ctrl.Result{}, nil
+	case !apierrors.IsNotFound(err):
+		return ctrl.Result{}, err
+	}
+
+	if wait := r.wait(req.Name); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	n, err := r.Sweeper.SweepNamespace(ctx, req.Name)
+	if err != nil {
+		logger.Error(err, "failed to sweep addresses of the deleted namespace", "freed", n)
+		return ctrl.Result{}, err
+	}
+	r.forget(req.Name)
+	if n > 0 {
+		logger.Info("freed addresses remaining for pods in the deleted namespace", "freed", n)
+	}
+	return ctrl.Result{}, nil
+}
+
+// wait returns the time to wait before sweeping the namespace.
+func (r *NamespaceWatcher) wait(name string) time.Duration {
+	delay := r.Delay
+	if delay == 0 {
+		delay = DefaultSweepDelay
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deleted == nil {
+		r.deleted = make(map[string]time.Time)
+	}
+	at, ok := r.deleted[name]
+	if !ok {
+		r.deleted[name] = time.Now()
+		return delay
+	}
+	return delay - time.Since(at)
+}
+
+func (r *NamespaceWatcher) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.deleted, name)
+}
+
+// SetupWithManager registers this with the manager.
+func (r *NamespaceWatcher) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("namespace-sweeper").
+		For(&corev1.Namespace{}, builder.WithPredicates(predicate.Funcs{
+			// predicate.Funcs returns true by default
+			CreateFunc: func(event.CreateEvent) bool {
+				return false
+			},
+			UpdateFunc: func(event.UpdateEvent) bool {
+				return false
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		})).
+		Complete(r)
+}
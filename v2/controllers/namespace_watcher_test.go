@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type mockSweeper struct {
+	swept []string
+}
+
+func (s *mockSweeper) SweepNamespace(ctx context.Context, namespace string) (int, error) {
+	s.swept = append(s.swept, namespace)
+	return 1, nil
+}
+
+var _ = Describe("Namespace watcher", func() {
+	ctx := context.Background()
+
+	It("should sweep deleted namespaces after the delay", func() {
+		sweeper := &mockSweeper{}
+		w := &NamespaceWatcher{
+			Client:  k8sClient,
+			Sweeper: sweeper,
+			Delay:   100 * time.Millisecond,
+		}
+
+		ns := &corev1.Namespace{}
+		ns.Name = "sweep-alive"
+		err := k8sClient.Create(ctx, ns)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("reconciling an existing namespace")
+		res, err := w.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "sweep-alive"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(sweeper.swept).To(BeEmpty())
+
+		By("reconciling a deleted namespace")
+		req := ctrl.Request{NamespacedName: client.ObjectKey{Name: "sweep-deleted"}}
+		res, err = w.Reconcile(ctx, req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(100 * time.Millisecond))
+		Expect(sweeper.swept).To(BeEmpty())
+
+		time.Sleep(100 * time.Millisecond)
+		res, err = w.Reconcile(ctx, req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(sweeper.swept).To(Equal([]string{"sweep-deleted"}))
+	})
+})
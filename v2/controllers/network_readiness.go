@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+)
+
+// networkReadyRetryInterval is the interval to check again the network
+// of a Pod that is not ready yet.
+const networkReadyRetryInterval = 5 * time.Second
+
+// NetworkReadinessWatcher sets the condition of the readiness gate
+// `coil.cybozu.com/network-ready` of Pods on the node.
+//
+// The condition becomes true when one of the Pod IP addresses is found in
+// the pod network of the node, i.e. the route to the Pod is programmed.
+// The route of the address block has been exported by then because blocks
+// are exported before their addresses are assigned.
+type NetworkReadinessWatcher struct {
+	client.Client
+	PodNetwork nodenet.PodNetwork
+	NodeName   string
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/status,verbs=get;patch
+
+// Reconcile implements Reconcile interface.
+func (r *NetworkReadinessWatcher) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := logr.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Client.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The following conditions have been checked in the event filter.
+	// These are just safeguards.
+	if !r.isTarget(pod) || pod.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	// kubelet sets the Pod IP addresses after the network is set up.
+	if len(pod.Status.PodIPs) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	confs, err := r.PodNetwork.List()
+	if err != nil {
+		logger.Error(err, "failed to list pod networks")
+		return ctrl.Result{}, err
+	}
+	if !podIPConfigured(pod, confs) {
+		logger.V(1).Info("network is not ready yet", "ips", pod.Status.PodIPs)
+		return ctrl.Result{RequeueAfter: networkReadyRetryInterval}, nil
+	}
+
+	orig := pod.DeepCopy()
+	setNetworkReady(pod, metav1.Now())
+	if err := r.Client.Status().Patch(ctx, pod, client.MergeFrom(orig)); err != nil {
+		logger.Error(err, "failed to set the network-ready condition")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("network is ready")
+	return ctrl.Result{}, nil
+}
+
+// podIPConfigured returns true if one of the Pod IP addresses is in `confs`.
+func podIPConfigured(pod *corev1.Pod, confs []*nodenet.PodNetConf) bool {
+	for _, podIP := range pod.Status.PodIPs {
+		ip := net.ParseIP(podIP.IP)
+		if ip == nil {
+			continue
+		}
+		for _, c := range confs {
+			if ip.Equal(c.IPv4) || ip.Equal(c.IPv6) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setNetworkReady sets the network-ready condition of `pod` to true.
+func setNetworkReady(pod *corev1.Pod, now metav1.Time) {
+	cond := corev1.PodCondition{
+		Type:               corev1.PodConditionType(constants.ConditionNetworkReady),
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: now,
+	}
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == cond.Type {
+			pod.Status.Conditions[i] = cond
+			return
+		}
+	}
+	pod.Status.Conditions = append(pod.Status.Conditions, cond)
+}
+
+// hasNetworkReadinessGate returns true if `pod` has the readiness gate of Coil.
+func hasNetworkReadinessGate(pod *corev1.Pod) bool {
+	for _, g := range pod.Spec.ReadinessGates {
+		if g.ConditionType == constants.ConditionNetworkReady {
+			return true
+		}
+	}
+	return false
+}
+
+// networkReady returns true if the network-ready condition of `pod` is true.
+func networkReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == constants.ConditionNetworkReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (r *NetworkReadinessWatcher) isTarget(pod *corev1.Pod) bool {
+	return pod.Spec.NodeName == r.NodeName && !pod.Spec.HostNetwork &&
+		hasNetworkReadinessGate(pod) && !networkReady(pod)
+}
+
+// SetupWithManager registers this with the manager.
+//
+// The cache of the manager should be restricted to Pods on the node
+// because coild runs on every node.
+func (r *NetworkReadinessWatcher) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return r.isTarget(o.(*corev1.Pod))
+		}))).
+		Complete(r)
+}
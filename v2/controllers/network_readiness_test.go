@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type mockPodNetwork struct {
+	nodenet.PodNetwork
+
+	mu    sync.Mutex
+	confs []*nodenet.PodNetConf
+}
+
+func (p *mockPodNetwork) Setup(nsPath, podName, podNS string, conf *nodenet.PodNetConf, hook nodenet.SetupHook) (*current.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.confs = append(p.confs, conf)
+	return &current.Result{}, nil
+}
+
+func (p *mockPodNetwork) List() ([]*nodenet.PodNetConf, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*nodenet.PodNetConf(nil), p.confs...), nil
+}
+
+func makeGatedPod(name, node string, ips []string) {
+	pod := &corev1.Pod{}
+	pod.Name = name
+	pod.Namespace = "default"
+	pod.Spec.NodeName = node
+	var graceSeconds int64
+	pod.Spec.TerminationGracePeriodSeconds = &graceSeconds
+	pod.Spec.Containers = []corev1.Container{{Name: "c1", Image: "nginx"}}
+	pod.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: constants.ConditionNetworkReady}}
+	err := k8sClient.Create(context.Background(), pod)
+	ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
+
+	for _, ip := range ips {
+		pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+	}
+	err = k8sClient.Status().Update(context.Background(), pod)
+	ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
+}
+
+var _ = Describe("Network readiness watcher", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	var podNet *mockPodNetwork
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.TODO())
+		podNet = &mockPodNetwork{}
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		nrw := &NetworkReadinessWatcher{
+			Client:     mgr.GetClient(),
+			PodNetwork: podNet,
+			NodeName:   "readiness-node",
+		}
+		err = nrw.SetupWithManager(mgr)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &corev1.Pod{}, client.InNamespace("default"))
+		Expect(err).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should set the condition after the network is programmed", func() {
+		makeGatedPod("gated1", "readiness-node", []string{"10.30.0.1"})
+		makeGatedPod("gated2", "other-node", []string{"10.30.0.2"})
+		makeScheduledPod("ungated", "readiness-node", []string{"10.30.0.3"})
+
+		getCondition := func(name string) corev1.ConditionStatus {
+			pod := &corev1.Pod{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, pod)
+			if err != nil {
+				return ""
+			}
+			for _, c := range pod.Status.Conditions {
+				if c.Type == constants.ConditionNetworkReady {
+					return c.Status
+				}
+			}
+			return ""
+		}
+		Consistently(func() corev1.ConditionStatus { return getCondition("gated1") }).Should(BeEmpty())
+
+		By("programming the network")
+		for _, ip := range []string{"10.30.0.1", "10.30.0.2", "10.30.0.3"} {
+			podNet.Setup("", "", "", &nodenet.PodNetConf{PoolName: "default", IPv4: net.ParseIP(ip)}, nil)
+		}
+		Eventually(func() corev1.ConditionStatus { return getCondition("gated1") }, 10*time.Second).Should(Equal(corev1.ConditionTrue))
+		Expect(getCondition("gated2")).To(BeEmpty())
+		Expect(getCondition("ungated")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
+
+// SetupPodAnnotator registers a reconciler to annotate Pods with
+// the address pool and the address block of their IP addresses.
+func SetupPodAnnotator(mgr ctrl.Manager) error {
+	r := &podAnnotator{
+		client: mgr.GetClient(),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			pod, ok := object.(*corev1.Pod)
+			if !ok {
+				return false
+			}
+			return !pod.Spec.HostNetwork && pod.Spec.NodeName != "" && len(pod.Status.PodIPs) > 0
+		}))).
+		Watches(&source.Kind{Type: &coilv2.AddressPool{}}, handler.EnqueueRequestsFromMapFunc(r.podsOfPool)).
+		Named("pod-annotator").
+		Complete(r)
+}
+
+// podAnnotator annotates Pods with `coil.cybozu.com/pool` and `coil.cybozu.com/block`.
+//
+// The block annotation has the CIDRs of the address block separated by commas.
+// If the pool has InternetEgress, it is copied to `coil.cybozu.com/internet-egress`.
+type podAnnotator struct {
+	client client.Client
+}
+
+func (r *podAnnotator) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.client.Get(ctx, req.NamespacedName, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to get pod")
+		return ctrl.Result{}, err
+	}
+	if pod.DeletionTimestamp != nil || pod.Spec.HostNetwork || pod.Spec.NodeName == "" {
+		return ctrl.Result{}, nil
+	}
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.client.List(ctx, blocks, client.MatchingLabels{constants.LabelNode: pod.Spec.NodeName}); err != nil {
+		logger.Error(err, "failed to list address blocks")
+		return ctrl.Result{}, err
+	}
+
+	block := findBlock(blocks.Items, pod.Status.PodIPs)
+	if block == nil {
+		return ctrl.Result{}, nil
+	}
+
+	poolName := block.Labels[constants.LabelPool]
+	var cidrs []string
+	if block.IPv4 != nil {
+		cidrs = append(cidrs, *block.IPv4)
+	}
+	if block.IPv6 != nil {
+		cidrs = append(cidrs, *block.IPv6)
+	}
+	blockValue := strings.Join(cidrs, ",")
+
+	pool := &coilv2.AddressPool{}
+	var egressValue string
+	if err := r.client.Get(ctx, client.ObjectKey{Name: poolName}, pool); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to get address pool", "pool", poolName)
+			return ctrl.Result{}, err
+		}
+	} else if pool.Spec.InternetEgress != nil {
+		egressValue = strconv.FormatBool(*pool.Spec.InternetEgress)
+	}
+
+	if pod.Annotations[constants.AnnPool] == poolName && pod.Annotations[constants.AnnBlock] == blockValue &&
+		pod.Annotations[constants.AnnInternetEgress] == egressValue {
+		return ctrl.Result{}, nil
+	}
+
+	orig := pod.DeepCopy()
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[constants.AnnPool] = poolName
+	pod.Annotations[constants.AnnBlock] = blockValue
+	if egressValue != "" {
+		pod.Annotations[constants.AnnInternetEgress] = egressValue
+	} else {
+		delete(pod.Annotations, constants.AnnInternetEgress)
+	}
+	if err := r.client.Patch(ctx, pod, client.MergeFrom(orig)); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to annotate pod")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("annotated pod", "pool", poolName, "block", blockValue, "internet_egress", egressValue)
+	return ctrl.Result{}, nil
+}
+
+// podsOfPool returns requests for the Pods annotated with the pool
+// so that changes of the pool are reflected to them.
+func (r *podAnnotator) podsOfPool(o client.Object) []reconcile.Request {
+	pods := &corev1.PodList{}
+	if err := r.client.List(context.Background(), pods); err != nil {
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, pod := range pods.Items {
+		if pod.Annotations[constants.AnnPool] != o.GetName() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pod)})
+	}
+	return reqs
+}
+
+// findBlock returns the block that contains one of `podIPs`, or nil.
+func findBlock(blocks []coilv2.AddressBlock, podIPs []corev1.PodIP) *coilv2.AddressBlock {
+	for _, podIP := range podIPs {
+		ip := net.ParseIP(podIP.IP)
+		if ip == nil {
+			continue
+		}
+
+		for i := range blocks {
+			b := &blocks[i]
+			for _, cidr := range []*string{b.IPv4, b.IPv6} {
+				if cidr == nil {
+					continue
+				}
+				_, n, err := net.ParseCIDR(*cidr)
+				if err != nil {
+					continue
+				}
+				if n.Contains(ip) {
+					return b
+				}
+			}
+		}
+	}
+	return nil
+}
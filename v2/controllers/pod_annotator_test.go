@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func makeScheduledPod(name, node string, ips []string) {
+	pod := &corev1.Pod{}
+	pod.Name = name
+	pod.Namespace = "default"
+	pod.Spec.NodeName = node
+	var graceSeconds int64
+	pod.Spec.TerminationGracePeriodSeconds = &graceSeconds
+	pod.Spec.Containers = []corev1.Container{{Name: "c1", Image: "nginx"}}
+	err := k8sClient.Create(context.Background(), pod)
+	ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
+
+	pod.Status.PodIP = ips[0]
+	podIPs := make([]corev1.PodIP, len(ips))
+	for i, ip := range ips {
+		podIPs[i] = corev1.PodIP{IP: ip}
+	}
+	pod.Status.PodIPs = podIPs
+	err = k8sClient.Status().Update(context.Background(), pod)
+	ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
+}
+
+var _ = Describe("Pod annotator", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		b := &coilv2.AddressBlock{}
+		b.Name = "annotator-0"
+		b.Labels = map[string]string{
+			constants.LabelPool: "default",
+			constants.LabelNode: "annotator-node",
+		}
+		b.IPv4 = strPtr("10.20.0.0/30")
+		b.IPv6 = strPtr("fd20::/126")
+		err := k8sClient.Create(ctx, b)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel = context.WithCancel(context.TODO())
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = SetupPodAnnotator(mgr)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &corev1.Pod{}, client.InNamespace("default"))
+		Expect(err).ShouldNot(HaveOccurred())
+		b := &coilv2.AddressBlock{}
+		b.Name = "annotator-0"
+		err = k8sClient.Delete(context.Background(), b)
+		Expect(err).ShouldNot(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should annotate Pods with their pool and block", func() {
+		makeScheduledPod("annotated1", "annotator-node", []string{"10.20.0.1", "fd20::1"})
+		makeScheduledPod("annotated2", "other-node", []string{"10.20.0.2", "fd20::2"})
+		makeScheduledPod("annotated3", "annotator-node", []string{"10.99.0.1"})
+
+		Eventually(func() map[string]string {
+			pod := &corev1.Pod{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "annotated1"}, pod)
+			if err != nil {
+				return nil
+			}
+			return pod.Annotations
+		}).Should(And(
+			HaveKeyWithValue(constants.AnnPool, "default"),
+			HaveKeyWithValue(constants.AnnBlock, "10.20.0.0/30,fd20::/126"),
+		))
+
+		Consistently(func() map[string]string {
+			pod := &corev1.Pod{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "annotated2"}, pod)
+			if err != nil {
+				return nil
+			}
+			return pod.Annotations
+		}, 2*time.Second).ShouldNot(HaveKey(constants.AnnBlock))
+
+		pod := &corev1.Pod{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "annotated3"}, pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Annotations).NotTo(HaveKey(constants.AnnBlock))
+	})
+
+	It("should annotate Pods with the Internet egress of their pool", func() {
+		ap := &coilv2.AddressPool{}
+		ap.Name = "annotator-egress"
+		ap.Spec.BlockSizeBits = 2
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.21.0.0/24")}}
+		egress := false
+		ap.Spec.InternetEgress = &egress
+		err := k8sClient.Create(ctx, ap)
+		Expect(err).ToNot(HaveOccurred())
+		defer k8sClient.Delete(context.Background(), ap)
+
+		b := &coilv2.AddressBlock{}
+		b.Name = "annotator-egress-0"
+		b.Labels = map[string]string{
+			constants.LabelPool: "annotator-egress",
+			constants.LabelNode: "annotator-node",
+		}
+		b.IPv4 = strPtr("10.21.0.0/30")
+		err = k8sClient.Create(ctx, b)
+		Expect(err).ToNot(HaveOccurred())
+		defer k8sClient.Delete(context.Background(), b)
+
+		makeScheduledPod("egress1", "annotator-node", []string{"10.21.0.1"})
+		getAnnotations := func() map[string]string {
+			pod := &corev1.Pod{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "egress1"}, pod)
+			if err != nil {
+				return nil
+			}
+			return pod.Annotations
+		}
+		Eventually(getAnnotations).Should(And(
+			HaveKeyWithValue(constants.AnnPool, "annotator-egress"),
+			HaveKeyWithValue(constants.AnnInternetEgress, "false"),
+		))
+
+		By("changing the pool")
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: "annotator-egress"}, ap)
+		Expect(err).ToNot(HaveOccurred())
+		egress = true
+		ap.Spec.InternetEgress = &egress
+		err = k8sClient.Update(ctx, ap)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(getAnnotations).Should(HaveKeyWithValue(constants.AnnInternetEgress, "true"))
+
+		By("removing the flag")
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: "annotator-egress"}, ap)
+		Expect(err).ToNot(HaveOccurred())
+		ap.Spec.InternetEgress = nil
+		err = k8sClient.Update(ctx, ap)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(getAnnotations).ShouldNot(HaveKey(constants.AnnInternetEgress))
+	})
+})
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// EventPoolCordoned is the reason of Events recorded for cordoned pools.
+const EventPoolCordoned = "PoolCordoned"
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch;update;patch
+
+// SetupPoolCordoner registers a reconciler to cordon the pool dedicated to
+// a namespace annotated with `coil.cybozu.com/cordon-pool-on-delete` when
+// the namespace is deleted.  The pool is decided by `coil.cybozu.com/pool`
+// or `coil.cybozu.com/pool-selector` of the namespace.
+func SetupPoolCordoner(mgr ctrl.Manager, config *coilconfig.Store) error {
+	r := &poolCordoner{
+		client:   mgr.GetClient(),
+		recorder: mgr.GetEventRecorderFor("coil-controller"),
+		config:   config,
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}).
+		Named("pool-cordoner").
+		WithEventFilter(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetDeletionTimestamp() != nil && object.GetAnnotations()[constants.AnnCordonPoolOnDelete] == "true"
+		})).
+		Complete(r)
+}
+
+// poolCordoner labels the pool of a deleted namespace with `coil.cybozu.com/cordoned`
+// so that no more address blocks are curved out of it.
+//
+// The pool is cordoned only if no other namespace may use it, that is, it is
+// not the default pool and not selected by the annotations of other namespaces
+// including those being renumbered.
+// Blocks already allocated are kept until they become unused.
+type poolCordoner struct {
+	client   client.Client
+	recorder record.EventRecorder
+	config   *coilconfig.Store
+}
+
+func (r *poolCordoner) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ns := &corev1.Namespace{}
+	if err := r.client.Get(ctx, req.NamespacedName, ns); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ns.DeletionTimestamp == nil || ns.Annotations[constants.AnnCordonPoolOnDelete] != "true" {
+		return ctrl.Result{}, nil
+	}
+	name, err := r.poolName(ctx, ns)
+	if err != nil {
+		logger.Error(err, "failed to decide the pool of the namespace")
+		return ctrl.Result{}, err
+	}
+	if name == "" {
+		logger.Info("not cordoning pools of a namespace without its own pool")
+		return ctrl.Result{}, nil
+	}
+
+	pool := &coilv2.AddressPool{}
+	if err := r.client.Get(ctx, client.ObjectKey{Name: name}, pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to get pool", "pool", name)
+		return ctrl.Result{}, err
+	}
+	if pool.Labels[constants.LabelCordoned] == "true" {
+		return ctrl.Result{}, nil
+	}
+
+	user, err := r.findUser(ctx, pool, ns.Name)
+	if err != nil {
+		logger.Error(err, "failed to find other users of the pool", "pool", name)
+		return ctrl.Result{}, err
+	}
+	if user != "" {
+		logger.Info("not cordoning a pool used by others", "pool", name, "user", user)
+		return ctrl.Result{}, nil
+	}
+
+	orig := pool.DeepCopy()
+	if pool.Labels == nil {
+		pool.Labels = make(map[string]string)
+	}
+	if pool.Annotations == nil {
+		pool.Annotations = make(map[string]string)
+	}
+	reason := fmt.Sprintf("namespace %s was deleted", ns.Name)
+	pool.Labels[constants.LabelCordoned] = "true"
+	pool.Annotations[constants.AnnCordonReason] = reason
+	if err := r.client.Patch(ctx, pool, client.MergeFrom(orig)); err != nil {
+		logger.Error(err, "failed to cordon pool", "pool", name)
+		return ctrl.Result{}, err
+	}
+	r.recorder.Event(pool, corev1.EventTypeNormal, EventPoolCordoned, reason)
+	logger.Info("cordoned pool", "pool", name)
+	return ctrl.Result{}, nil
+}
+
+// poolName returns the name of the pool used by `ns` in the same way as coild,
+// or an empty string if `ns` uses the default pool or no pool matches its selector.
+func (r *poolCordoner) poolName(ctx context.Context, ns *corev1.Namespace) (string, error) {
+	if v, ok := ns.Annotations[constants.AnnPool]; ok {
+		return v, nil
+	}
+
+	v, ok := ns.Annotations[constants.AnnPoolSelector]
+	if !ok {
+		return "", nil
+	}
+	sel, err := labels.Parse(v)
+	if err != nil {
+		// coild cannot have allocated addresses for the namespace.
+		return "", nil
+	}
+
+	pools := &coilv2.AddressPoolList{}
+	if err := r.client.List(ctx, pools, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return "", err
+	}
+	var names []string
+	for _, p := range pools.Items {
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// findUser returns a description of something other than namespace `self`
+// that may use `pool`, or an empty string if there is none.
+func (r *poolCordoner) findUser(ctx context.Context, pool *coilv2.AddressPool, self string) (string, error) {
+	if pool.Name == r.config.DefaultPool() {
+		return "the default pool", nil
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.client.List(ctx, namespaces); err != nil {
+		return "", err
+	}
+	for _, ns := range namespaces.Items {
+		if ns.Name == self {
+			continue
+		}
+		if ns.Annotations[constants.AnnPool] == pool.Name || ns.Annotations[constants.AnnRenumberTo] == pool.Name {
+			return "namespace " + ns.Name, nil
+		}
+		if _, ok := ns.Annotations[constants.AnnPool]; ok {
+			continue
+		}
+		v, ok := ns.Annotations[constants.AnnPoolSelector]
+		if !ok {
+			continue
+		}
+		sel, err := labels.Parse(v)
+		if err != nil {
+			continue
+		}
+		if sel.Matches(labels.Set(pool.Labels)) {
+			return "namespace " + ns.Name, nil
+		}
+	}
+	return "", nil
+}
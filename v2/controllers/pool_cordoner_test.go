@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Pool cordoner", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		for _, name := range []string{"dedicated", "shared"} {
+			ap := &coilv2.AddressPool{}
+			ap.Name = name
+			ap.Labels = map[string]string{"team": name}
+			ap.Spec.BlockSizeBits = 2
+			ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.50.0.0/24")}}
+			err := k8sClient.Create(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		ctx, cancel = context.WithCancel(context.TODO())
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = SetupPoolCordoner(mgr, coilconfig.NewStore(coilconfig.Defaults{}))
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		for _, name := range []string{"dedicated", "shared"} {
+			ap := &coilv2.AddressPool{}
+			ap.Name = name
+			err := k8sClient.Delete(context.Background(), ap)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should cordon the pool dedicated to a deleted namespace", func() {
+		for _, x := range []struct{ name, key, value string }{
+			{"cordon-dedicated", constants.AnnPool, "dedicated"},
+			{"cordon-shared1", constants.AnnPool, "shared"},
+			{"cordon-shared2", constants.AnnPoolSelector, "team=shared"},
+		} {
+			ns := &corev1.Namespace{}
+			ns.Name = x.name
+			ns.Annotations = map[string]string{
+				x.key:                           x.value,
+				constants.AnnCordonPoolOnDelete: "true",
+			}
+			err := k8sClient.Create(ctx, ns)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		By("deleting the namespaces")
+		for _, name := range []string{"cordon-dedicated", "cordon-shared1"} {
+			ns := &corev1.Namespace{}
+			ns.Name = name
+			err := k8sClient.Delete(ctx, ns)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		By("checking the dedicated pool is cordoned")
+		Eventually(func() map[string]string {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "dedicated"}, ap)
+			if err != nil {
+				return nil
+			}
+			return ap.Labels
+		}).Should(HaveKeyWithValue(constants.LabelCordoned, "true"))
+
+		ap := &coilv2.AddressPool{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: "dedicated"}, ap)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ap.Annotations).To(HaveKeyWithValue(constants.AnnCordonReason, "namespace cordon-dedicated was deleted"))
+
+		By("checking the shared pool is not cordoned")
+		Consistently(func() map[string]string {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "shared"}, ap)
+			if err != nil {
+				return nil
+			}
+			return ap.Labels
+		}).ShouldNot(HaveKey(constants.LabelCordoned))
+	})
+
+	It("should cordon the pool selected by a deleted namespace", func() {
+		ap := &coilv2.AddressPool{}
+		ap.Name = "selected"
+		ap.Labels = map[string]string{"team": "selected"}
+		ap.Spec.BlockSizeBits = 2
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.51.0.0/24")}}
+		err := k8sClient.Create(ctx, ap)
+		Expect(err).ToNot(HaveOccurred())
+		defer k8sClient.Delete(context.Background(), ap)
+
+		ns := &corev1.Namespace{}
+		ns.Name = "cordon-selector"
+		ns.Annotations = map[string]string{
+			constants.AnnPoolSelector:       "team=selected",
+			constants.AnnCordonPoolOnDelete: "true",
+		}
+		err = k8sClient.Create(ctx, ns)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("deleting the namespace")
+		err = k8sClient.Delete(ctx, ns)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("checking the selected pool is cordoned")
+		Eventually(func() map[string]string {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "selected"}, ap)
+			if err != nil {
+				return nil
+			}
+			return ap.Annotations
+		}).Should(HaveKeyWithValue(constants.AnnCordonReason, "namespace cordon-selector was deleted"))
+	})
+})
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PoolOverlapWebhookPath is the path of the webhook to reject pools overlapping other networks.
+const PoolOverlapWebhookPath = "/validate-pool-overlap"
+
+// The failure policy is Ignore because PoolOverlapChecker reports the
+// overlaps of pools created while coil-controller is unavailable.
+// +kubebuilder:webhook:path=/validate-pool-overlap,mutating=false,failurePolicy=ignore,sideEffects=None,groups=coil.cybozu.com,resources=addresspools,verbs=create,versions=v2,name=vaddresspool-overlap.coil.cybozu.com,admissionReviewVersions={v1,v1beta1}
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
+
+// SetupPoolOverlapWebhook registers a validating webhook for new AddressPools.
+func SetupPoolOverlapWebhook(mgr ctrl.Manager, config *coilconfig.Store) {
+	mgr.GetWebhookServer().Register(PoolOverlapWebhookPath, &webhook.Admission{
+		Handler: &PoolOverlapValidator{Client: mgr.GetClient(), Config: config},
+	})
+}
+
+// PoolOverlapValidator rejects AddressPools whose subnets overlap those of
+// other pools, the Service CIDRs or the node networks in CoilConfig, or the
+// addresses of nodes.
+type PoolOverlapValidator struct {
+	Client  client.Client
+	Config  *coilconfig.Store
+	decoder *admission.Decoder
+}
+
+var _ admission.DecoderInjector = &PoolOverlapValidator{}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (h *PoolOverlapValidator) InjectDecoder(d *admission.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (h *PoolOverlapValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.FromContext(ctx)
+
+	ap := &coilv2.AddressPool{}
+	if err := h.decoder.Decode(req, ap); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	overlaps, err := findPoolOverlaps(ctx, h.Client, h.Config, ap)
+	if err != nil {
+		logger.Error(err, "failed to find overlaps", "pool", ap.Name)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(overlaps) == 0 {
+		return admission.Allowed("")
+	}
+
+	desc := make([]string, len(overlaps))
+	for i, o := range overlaps {
+		desc[i] = o.String()
+	}
+	return admission.Denied(fmt.Sprintf("subnets overlap other networks: %s", strings.Join(desc, "; ")))
+}
+
+// findPoolOverlaps lists pools and nodes with `r` to find the overlaps of `ap`.
+func findPoolOverlaps(ctx context.Context, r client.Reader, config *coilconfig.Store, ap *coilv2.AddressPool) ([]ipam.Overlap, error) {
+	pools := &coilv2.AddressPoolList{}
+	if err := r.List(ctx, pools); err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	return ipam.FindOverlaps(ap, pools.Items, ipam.Networks{
+		ServiceCIDRs: config.ServiceCIDRs(),
+		NodeNetworks: config.NodeNetworks(),
+		Nodes:        nodes.Items,
+	}), nil
+}
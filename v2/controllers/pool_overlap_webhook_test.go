@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Pool overlap validator", func() {
+	ctx := context.Background()
+
+	var validator *PoolOverlapValidator
+
+	newRequest := func(name, ipv4 string) admission.Request {
+		ap := &coilv2.AddressPool{}
+		ap.Name = name
+		ap.Spec.BlockSizeBits = 2
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr(ipv4)}}
+		data, err := json.Marshal(ap)
+		Expect(err).ToNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Name:      name,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: data},
+		}}
+	}
+
+	BeforeEach(func() {
+		cc := &coilv2.CoilConfig{}
+		cc.Name = constants.CoilConfigName
+		cc.Spec.ServiceCIDRs = []string{"172.31.0.0/16"}
+		cc.Spec.NodeNetworks = []string{"172.29.0.0/16"}
+		store := coilconfig.NewStore(coilconfig.Defaults{})
+		_, err := store.Load(ctx, fake.NewClientBuilder().WithScheme(scheme).WithObjects(cc).Build())
+		Expect(err).ToNot(HaveOccurred())
+
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).ToNot(HaveOccurred())
+		validator = &PoolOverlapValidator{Client: k8sClient, Config: store}
+		err = validator.InjectDecoder(decoder)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject pools overlapping other networks", func() {
+		ap := &coilv2.AddressPool{}
+		ap.Name = "overlap-existing"
+		ap.Spec.BlockSizeBits = 2
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("172.28.0.0/24")}}
+		err := k8sClient.Create(ctx, ap)
+		Expect(err).ToNot(HaveOccurred())
+
+		node := &corev1.Node{}
+		node.Name = "overlap-node"
+		err = k8sClient.Create(ctx, node)
+		Expect(err).ToNot(HaveOccurred())
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "172.27.0.10"}}
+		err = k8sClient.Status().Update(ctx, node)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("admitting a pool overlapping nothing")
+		resp := validator.Handle(ctx, newRequest("overlap-free", "172.26.0.0/24"))
+		Expect(resp.Allowed).To(BeTrue())
+
+		By("rejecting pools overlapping other pools")
+		resp = validator.Handle(ctx, newRequest("overlap-pool", "172.28.0.0/16"))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("172.28.0.0/24 of AddressPool overlap-existing"))
+
+		By("rejecting pools overlapping the Service CIDRs")
+		resp = validator.Handle(ctx, newRequest("overlap-service", "172.31.3.0/24"))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("ServiceCIDR 172.31.0.0/16"))
+
+		By("rejecting pools overlapping the node networks")
+		resp = validator.Handle(ctx, newRequest("overlap-node-network", "172.29.3.0/24"))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("NodeNetwork 172.29.0.0/16"))
+
+		By("rejecting pools containing addresses of nodes")
+		resp = validator.Handle(ctx, newRequest("overlap-node-address", "172.27.0.0/24"))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("172.27.0.10 of Node overlap-node"))
+	})
+})
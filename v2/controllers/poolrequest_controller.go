@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// poolRequestRetryInterval is the interval to retry approved PoolRequests
+// that cannot be fulfilled due to lack of supernets.
+const poolRequestRetryInterval = 1 * time.Minute
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=poolrequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=poolrequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch;create
+
+// SetupPoolRequestReconciler registers a reconciler to create AddressPools
+// for approved PoolRequests.
+//
+// `apiReader` is used to list pools so that a new subnet never overlaps
+// pools created just before.
+func SetupPoolRequestReconciler(mgr ctrl.Manager, config *coilconfig.Store) error {
+	r := &poolRequestReconciler{
+		client:    mgr.GetClient(),
+		apiReader: mgr.GetAPIReader(),
+		config:    config,
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&coilv2.PoolRequest{}).
+		Complete(r)
+}
+
+// poolRequestReconciler curves a subnet out of the supernets of CoilConfig
+// for an approved PoolRequest, and creates an AddressPool of the subnet.
+//
+// Requests are validated against the quota of CoilConfig before the pool
+// is created.  Invalid requests and those exceeding the quota are denied.
+type poolRequestReconciler struct {
+	client    client.Client
+	apiReader client.Reader
+	config    *coilconfig.Store
+}
+
+func (r *poolRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pr := &coilv2.PoolRequest{}
+	if err := r.client.Get(ctx, req.NamespacedName, pr); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pr.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+	if pr.Status.Phase == coilv2.PoolRequestReady || pr.Status.Phase == coilv2.PoolRequestDenied {
+		return ctrl.Result{}, nil
+	}
+
+	if err := pr.Spec.Validate(); err != nil {
+		return ctrl.Result{}, r.setPhase(ctx, pr, coilv2.PoolRequestDenied, err.Error())
+	}
+	if pr.Annotations[constants.AnnApproved] != "true" {
+		return ctrl.Result{}, r.setPhase(ctx, pr, coilv2.PoolRequestPending, "waiting for approval")
+	}
+
+	pools := &coilv2.AddressPoolList{}
+	if err := r.apiReader.List(ctx, pools); err != nil {
+		logger.Error(err, "failed to list pools")
+		return ctrl.Result{}, err
+	}
+
+	// the pool may have been created without updating the status.
+	for i := range pools.Items {
+		p := &pools.Items[i]
+		if p.Labels[constants.LabelPoolRequestNamespace] == pr.Namespace && p.Labels[constants.LabelPoolRequestName] == pr.Name {
+			return ctrl.Result{}, r.setReady(ctx, pr, p)
+		}
+	}
+
+	name := pr.Namespace + "-" + pr.Name
+	if len(name) > validation.LabelValueMaxLength {
+		return ctrl.Result{}, r.setPhase(ctx, pr, coilv2.PoolRequestDenied,
+			fmt.Sprintf("pool name %s is longer than %d characters", name, validation.LabelValueMaxLength))
+	}
+	if msg := checkQuota(r.config.PoolRequestQuota(), pools.Items, pr); msg != "" {
+		return ctrl.Result{}, r.setPhase(ctx, pr, coilv2.PoolRequestDenied, msg)
+	}
+
+	used := append(ipam.PoolSubnets(pools.Items), r.config.ServiceCIDRs()...)
+	used = append(used, r.config.NodeNetworks()...)
+	subnet, supernet, err := ipam.CarveSubnet(r.config.Supernets(), used, int(pr.Spec.PrefixLength), pr.Spec.IsIPv6())
+	if errors.Is(err, ipam.ErrNoSpace) {
+		msg := fmt.Sprintf("no room for /%d in the supernets", pr.Spec.PrefixLength)
+		if err := r.setPhase(ctx, pr, coilv2.PoolRequestPending, msg); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: poolRequestRetryInterval}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	cidr := subnet.String()
+	pool := &coilv2.AddressPool{}
+	pool.Name = name
+	pool.Labels = map[string]string{
+		constants.LabelPoolRequestNamespace: pr.Namespace,
+		constants.LabelPoolRequestName:      pr.Name,
+	}
+	pool.Annotations = map[string]string{constants.AnnSupernet: supernet.String()}
+	pool.Spec.BlockSizeBits = pr.Spec.BlockSizeBits
+	if pr.Spec.IsIPv6() {
+		pool.Spec.Subnets = []coilv2.SubnetSet{{IPv6: &cidr}}
+	} else {
+		pool.Spec.Subnets = []coilv2.SubnetSet{{IPv4: &cidr}}
+	}
+	if err := r.client.Create(ctx, pool); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, r.setPhase(ctx, pr, coilv2.PoolRequestDenied, fmt.Sprintf("pool %s already exists", name))
+		}
+		logger.Error(err, "failed to create pool", "pool", name)
+		return ctrl.Result{}, err
+	}
+	logger.Info("created pool", "pool", name, "subnet", cidr, "supernet", supernet.String())
+	return ctrl.Result{}, r.setReady(ctx, pr, pool)
+}
+
+// checkQuota returns a message if creating a pool for `pr` exceeds `quota`.
+func checkQuota(quota coilv2.PoolRequestQuota, pools []coilv2.AddressPool, pr *coilv2.PoolRequest) string {
+	var numPools int32
+	var ipv4Addrs int64
+	for _, p := range pools {
+		if p.Labels[constants.LabelPoolRequestNamespace] != pr.Namespace {
+			continue
+		}
+		numPools++
+		for _, ss := range p.Spec.Subnets {
+			if ss.IPv4 == nil {
+				continue
+			}
+			if _, n, err := net.ParseCIDR(*ss.IPv4); err == nil {
+				ones, bits := n.Mask.Size()
+				ipv4Addrs += int64(1) << (bits - ones)
+			}
+		}
+	}
+
+	if quota.MaxPools != nil && numPools+1 > *quota.MaxPools {
+		return fmt.Sprintf("namespace %s already has %d pools; the quota is %d", pr.Namespace, numPools, *quota.MaxPools)
+	}
+	if quota.MaxIPv4Addresses != nil && !pr.Spec.IsIPv6() {
+		requested := int64(1) << (32 - pr.Spec.PrefixLength)
+		if ipv4Addrs+requested > *quota.MaxIPv4Addresses {
+			return fmt.Sprintf("namespace %s would have %d IPv4 addresses; the quota is %d", pr.Namespace, ipv4Addrs+requested, *quota.MaxIPv4Addresses)
+		}
+	}
+	return ""
+}
+
+func (r *poolRequestReconciler) setPhase(ctx context.Context, pr *coilv2.PoolRequest, phase coilv2.PoolRequestPhase, msg string) error {
+	if pr.Status.Phase == phase && pr.Status.Message == msg {
+		return nil
+	}
+	pr.Status.Phase = phase
+	pr.Status.Message = msg
+	return r.client.Status().Update(ctx, pr)
+}
+
+func (r *poolRequestReconciler) setReady(ctx context.Context, pr *coilv2.PoolRequest, pool *coilv2.AddressPool) error {
+	pr.Status.Phase = coilv2.PoolRequestReady
+	pr.Status.Message = ""
+	pr.Status.Pool = pool.Name
+	pr.Status.Supernet = pool.Annotations[constants.AnnSupernet]
+	if len(pool.Spec.Subnets) > 0 {
+		ss := pool.Spec.Subnets[0]
+		if ss.IPv4 != nil {
+			pr.Status.Subnet = *ss.IPv4
+		} else if ss.IPv6 != nil {
+			pr.Status.Subnet = *ss.IPv6
+		}
+	}
+	return r.client.Status().Update(ctx, pr)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("PoolRequest reconciler", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		cc := &coilv2.CoilConfig{}
+		cc.Name = constants.CoilConfigName
+		cc.Spec.Supernets = []string{"10.90.0.0/25"}
+		cc.Spec.PoolRequestQuota = &coilv2.PoolRequestQuota{MaxPools: pointer.Int32Ptr(1)}
+		store := coilconfig.NewStore(coilconfig.Defaults{})
+		_, err := store.Load(ctx, fake.NewClientBuilder().WithScheme(scheme).WithObjects(cc).Build())
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel = context.WithCancel(context.TODO())
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = SetupPoolRequestReconciler(mgr, store)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &coilv2.AddressPool{}, client.MatchingLabels{constants.LabelPoolRequestNamespace: "default"})
+		Expect(err).ToNot(HaveOccurred())
+		err = k8sClient.DeleteAllOf(context.Background(), &coilv2.PoolRequest{}, client.InNamespace("default"))
+		Expect(err).ToNot(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	getPhase := func(name string) func() coilv2.PoolRequestPhase {
+		return func() coilv2.PoolRequestPhase {
+			pr := &coilv2.PoolRequest{}
+			if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, pr); err != nil {
+				return ""
+			}
+			return pr.Status.Phase
+		}
+	}
+
+	It("should create a pool for an approved request", func() {
+		pr := &coilv2.PoolRequest{}
+		pr.Namespace = "default"
+		pr.Name = "team-a"
+		pr.Spec.PrefixLength = 26
+		pr.Spec.BlockSizeBits = 2
+		pr.Spec.Justification = "for testing"
+		err := k8sClient.Create(ctx, pr)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("waiting for approval")
+		Eventually(getPhase("team-a")).Should(Equal(coilv2.PoolRequestPending))
+		Consistently(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Name: "default-team-a"}, &coilv2.AddressPool{})
+		}).Should(HaveOccurred())
+
+		By("approving the request")
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "team-a"}, pr)
+		Expect(err).ToNot(HaveOccurred())
+		pr.Annotations = map[string]string{constants.AnnApproved: "true"}
+		err = k8sClient.Update(ctx, pr)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(getPhase("team-a")).Should(Equal(coilv2.PoolRequestReady))
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "team-a"}, pr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pr.Status.Pool).To(Equal("default-team-a"))
+		Expect(pr.Status.Subnet).To(Equal("10.90.0.0/26"))
+		Expect(pr.Status.Supernet).To(Equal("10.90.0.0/25"))
+
+		ap := &coilv2.AddressPool{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: "default-team-a"}, ap)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ap.Spec.BlockSizeBits).To(BeNumerically("==", 2))
+		Expect(ap.Spec.Subnets).To(HaveLen(1))
+		Expect(*ap.Spec.Subnets[0].IPv4).To(Equal("10.90.0.0/26"))
+		Expect(ap.Annotations).To(HaveKeyWithValue(constants.AnnSupernet, "10.90.0.0/25"))
+
+		By("denying a request exceeding the quota")
+		pr2 := &coilv2.PoolRequest{}
+		pr2.Namespace = "default"
+		pr2.Name = "team-b"
+		pr2.Annotations = map[string]string{constants.AnnApproved: "true"}
+		pr2.Spec.PrefixLength = 26
+		pr2.Spec.BlockSizeBits = 2
+		pr2.Spec.Justification = "for testing"
+		err = k8sClient.Create(ctx, pr2)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(getPhase("team-b")).Should(Equal(coilv2.PoolRequestDenied))
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "team-b"}, pr2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pr2.Status.Message).To(ContainSubstring("quota"))
+	})
+})
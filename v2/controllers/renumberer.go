@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Reasons of Events recorded for namespaces being renumbered.
+const (
+	EventRenumberStarted   = "RenumberStarted"
+	EventRenumberFailed    = "RenumberFailed"
+	EventRenumberEvicted   = "RenumberEvicted"
+	EventRenumberCompleted = "RenumberCompleted"
+)
+
+var renumberRemainingPods = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "renumber_remaining_pods",
+		Help:      "the number of Pods having addresses of pools other than the target of renumbering",
+	},
+	[]string{"namespace", "pool"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(renumberRemainingPods)
+}
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch
+
+// SetupRenumberer registers a reconciler to migrate Pods in namespaces
+// annotated with `coil.cybozu.com/renumber-to` to the annotated pool.
+//
+// At most one Pod is evicted in each namespace every RenumberInterval of `config`.
+func SetupRenumberer(mgr ctrl.Manager, config *coilconfig.Store) error {
+	cs, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+
+	r := &renumberer{
+		client:    mgr.GetClient(),
+		clientset: cs,
+		recorder:  mgr.GetEventRecorderFor("coil-controller"),
+		config:    config,
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}).
+		Named("renumberer").
+		WithEventFilter(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			_, ok := object.GetAnnotations()[constants.AnnRenumberTo]
+			return ok
+		})).
+		Complete(r)
+}
+
+// renumberer moves Pods in a namespace from the current pools to another pool.
+//
+// It first cordons the old pools by pointing `coil.cybozu.com/pool` of the
+// namespace to the new pool, so that new Pods are assigned addresses from it.
+// Then it evicts Pods having addresses of other pools one by one.  Evictions
+// respect PodDisruptionBudgets, and the replacements created by the controllers
+// of the Pods get addresses from the new pool.
+//
+// The progress is recorded in `coil.cybozu.com/renumber-status` of the namespace.
+// When no Pods have addresses of other pools, `coil.cybozu.com/renumber-to` is removed.
+type renumberer struct {
+	client    client.Client
+	clientset kubernetes.Interface
+	recorder  record.EventRecorder
+	config    *coilconfig.Store
+}
+
+func (r *renumberer) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ns := &corev1.Namespace{}
+	if err := r.client.Get(ctx, req.NamespacedName, ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to get namespace")
+		return ctrl.Result{}, err
+	}
+	target, ok := ns.Annotations[constants.AnnRenumberTo]
+	if !ok || ns.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	pool := &coilv2.AddressPool{}
+	if err := r.client.Get(ctx, client.ObjectKey{Name: target}, pool); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to get pool", "pool", target)
+			return ctrl.Result{}, err
+		}
+		r.recorder.Eventf(ns, corev1.EventTypeWarning, EventRenumberFailed, "address pool %s is not found", target)
+		if err := r.setStatus(ctx, ns, fmt.Sprintf("pool %s is not found", target)); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: r.config.RenumberInterval()}, nil
+	}
+
+	if err := r.cordon(ctx, ns, target); err != nil {
+		logger.Error(err, "failed to cordon old pools")
+		return ctrl.Result{}, err
+	}
+
+	remaining, terminating, err := r.listRemaining(ctx, ns.Name, target)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return ctrl.Result{}, err
+	}
+	renumberRemainingPods.WithLabelValues(ns.Name, target).Set(float64(len(remaining)))
+
+	if len(remaining) == 0 {
+		orig := ns.DeepCopy()
+		delete(ns.Annotations, constants.AnnRenumberTo)
+		ns.Annotations[constants.AnnRenumberStatus] = "completed"
+		if err := r.client.Patch(ctx, ns, client.MergeFrom(orig)); err != nil {
+			logger.Error(err, "failed to complete renumbering")
+			return ctrl.Result{}, err
+		}
+		renumberRemainingPods.DeleteLabelValues(ns.Name, target)
+		r.recorder.Eventf(ns, corev1.EventTypeNormal, EventRenumberCompleted, "no Pods have addresses of pools other than %s", target)
+		logger.Info("completed renumbering", "pool", target)
+		return ctrl.Result{}, nil
+	}
+
+	status := fmt.Sprintf("%d Pods remaining", len(remaining))
+	switch {
+	case terminating > 0:
+		// wait for the previous eviction to finish.
+		status += fmt.Sprintf("; waiting for %d Pods to terminate", terminating)
+	default:
+		pod := pickEvictable(remaining)
+		if pod == nil {
+			status += "; Pods without controllers need to be deleted manually"
+			break
+		}
+		evicted, err := r.evict(ctx, pod)
+		if err != nil {
+			logger.Error(err, "failed to evict pod", "pod", pod.Name)
+			return ctrl.Result{}, err
+		}
+		if !evicted {
+			status += fmt.Sprintf("; eviction of %s is blocked by PodDisruptionBudget", pod.Name)
+			break
+		}
+		r.recorder.Eventf(ns, corev1.EventTypeNormal, EventRenumberEvicted, "evicted Pod %s to move it to pool %s", pod.Name, target)
+		logger.Info("evicted pod", "pod", pod.Name, "pool", target)
+	}
+
+	if err := r.setStatus(ctx, ns, status); err != nil {
+		logger.Error(err, "failed to update renumbering status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.config.RenumberInterval()}, nil
+}
+
+// cordon makes new Pods in the namespace use the target pool.
+func (r *renumberer) cordon(ctx context.Context, ns *corev1.Namespace, target string) error {
+	_, hasSelector := ns.Annotations[constants.AnnPoolSelector]
+	if ns.Annotations[constants.AnnPool] == target && !hasSelector {
+		return nil
+	}
+
+	orig := ns.DeepCopy()
+	ns.Annotations[constants.AnnPool] = target
+	delete(ns.Annotations, constants.AnnPoolSelector)
+	if err := r.client.Patch(ctx, ns, client.MergeFrom(orig)); err != nil {
+		return err
+	}
+	r.recorder.Eventf(ns, corev1.EventTypeNormal, EventRenumberStarted, "new Pods are assigned addresses from pool %s", target)
+	log.FromContext(ctx).Info("cordoned old pools", "pool", target)
+	return nil
+}
+
+// listRemaining returns Pods having addresses of pools other than `target`,
+// and the number of terminating Pods in the namespace.
+func (r *renumberer) listRemaining(ctx context.Context, ns, target string) ([]*corev1.Pod, int, error) {
+	pods := &corev1.PodList{}
+	if err := r.client.List(ctx, pods, client.InNamespace(ns)); err != nil {
+		return nil, 0, err
+	}
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.client.List(ctx, blocks); err != nil {
+		return nil, 0, err
+	}
+
+	var remaining []*corev1.Pod
+	var terminating int
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.HostNetwork {
+			continue
+		}
+		if pod.DeletionTimestamp != nil {
+			terminating++
+		}
+		block := findBlock(blocks.Items, pod.Status.PodIPs)
+		if block == nil || block.Labels[constants.LabelPool] == target {
+			continue
+		}
+		remaining = append(remaining, pod)
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		return remaining[i].Name < remaining[j].Name
+	})
+	return remaining, terminating, nil
+}
+
+// pickEvictable returns the first Pod that will be re-created by its controller.
+func pickEvictable(pods []*corev1.Pod) *corev1.Pod {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && metav1.GetControllerOf(pod) != nil {
+			return pod
+		}
+	}
+	return nil
+}
+
+// evict evicts `pod` through the Eviction API.
+// It returns false if the eviction is rejected by a PodDisruptionBudget.
+func (r *renumberer) evict(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	ev := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: metav1.NewUIDPreconditions(string(pod.UID)),
+		},
+	}
+	err := r.clientset.CoreV1().Pods(pod.Namespace).EvictV1beta1(ctx, ev)
+	switch {
+	case err == nil:
+		return true, nil
+	case apierrors.IsTooManyRequests(err):
+		return false, nil
+	case apierrors.IsNotFound(err), apierrors.IsConflict(err):
+		// the pod has been deleted or replaced concurrently.
+		return true, nil
+	}
+	return false, err
+}
+
+func (r *renumberer) setStatus(ctx context.Context, ns *corev1.Namespace, status string) error {
+	if ns.Annotations[constants.AnnRenumberStatus] == status {
+		return nil
+	}
+	orig := ns.DeepCopy()
+	ns.Annotations[constants.AnnRenumberStatus] = status
+	return r.client.Patch(ctx, ns, client.MergeFrom(orig))
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func makeRenumberPod(name, ip string, owned bool) {
+	pod := &corev1.Pod{}
+	pod.Name = name
+	pod.Namespace = "renumber"
+	if owned {
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       "ReplicaSet",
+			Name:       "rs",
+			UID:        types.UID("a3b5e0c2-4ac6-4a0c-9d6b-5b3c0b3c1f27"),
+			Controller: &controller,
+		}}
+	}
+	pod.Spec.Containers = []corev1.Container{{Name: "c1", Image: "nginx"}}
+	err := k8sClient.Create(context.Background(), pod)
+	ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
+
+	pod.Status.PodIP = ip
+	pod.Status.PodIPs = []corev1.PodIP{{IP: ip}}
+	err = k8sClient.Status().Update(context.Background(), pod)
+	ExpectWithOffset(1, err).ShouldNot(HaveOccurred())
+}
+
+var _ = Describe("Renumberer", func() {
+	ctx := context.Background()
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		for _, b := range []struct{ name, pool, cidr string }{
+			{"renumber-old", "default", "10.30.0.0/30"},
+			{"renumber-new", "v4", "10.40.0.0/30"},
+		} {
+			block := &coilv2.AddressBlock{}
+			block.Name = b.name
+			block.Labels = map[string]string{
+				constants.LabelPool: b.pool,
+				constants.LabelNode: "node1",
+			}
+			block.IPv4 = strPtr(b.cidr)
+			err := k8sClient.Create(ctx, block)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		ns := &corev1.Namespace{}
+		ns.Name = "renumber"
+		ns.Annotations = map[string]string{constants.AnnPoolSelector: `{"matchLabels":{"foo":"bar"}}`}
+		err := k8sClient.Create(ctx, ns)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel = context.WithCancel(context.TODO())
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = SetupRenumberer(mgr, coilconfig.NewStore(coilconfig.Defaults{RenumberInterval: 100 * time.Millisecond}))
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+		err := k8sClient.DeleteAllOf(context.Background(), &corev1.Pod{}, client.InNamespace("renumber"))
+		Expect(err).ShouldNot(HaveOccurred())
+		err = k8sClient.DeleteAllOf(context.Background(), &coilv2.AddressBlock{}, client.MatchingLabels{constants.LabelNode: "node1"})
+		Expect(err).ShouldNot(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	It("should move Pods to the annotated pool", func() {
+		makeRenumberPod("old1", "10.30.0.1", true)
+		makeRenumberPod("old2", "10.30.0.2", true)
+		makeRenumberPod("new1", "10.40.0.1", true)
+		makeRenumberPod("bare1", "10.30.0.3", false)
+
+		By("annotating the namespace")
+		ns := &corev1.Namespace{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: "renumber"}, ns)
+		Expect(err).ToNot(HaveOccurred())
+		ns.Annotations[constants.AnnRenumberTo] = "v4"
+		err = k8sClient.Update(ctx, ns)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("checking the old pool is cordoned")
+		Eventually(func() map[string]string {
+			ns := &corev1.Namespace{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "renumber"}, ns)
+			if err != nil {
+				return nil
+			}
+			return ns.Annotations
+		}).Should(And(
+			HaveKeyWithValue(constants.AnnPool, "v4"),
+			Not(HaveKey(constants.AnnPoolSelector)),
+		))
+
+		By("checking Pods in the old pool are evicted")
+		Eventually(func() bool {
+			for _, name := range []string{"old1", "old2"} {
+				pod := &corev1.Pod{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "renumber", Name: name}, pod)
+				if !apierrors.IsNotFound(err) {
+					return false
+				}
+			}
+			return true
+		}).Should(BeTrue())
+
+		pod := &corev1.Pod{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "renumber", Name: "new1"}, pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("checking the Pod without controllers is reported")
+		Eventually(func() string {
+			ns := &corev1.Namespace{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "renumber"}, ns)
+			if err != nil {
+				return ""
+			}
+			return ns.Annotations[constants.AnnRenumberStatus]
+		}).Should(ContainSubstring("1 Pods remaining"))
+
+		Consistently(func() error {
+			pod := &corev1.Pod{}
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: "renumber", Name: "bare1"}, pod)
+		}).Should(Succeed())
+
+		By("deleting the Pod manually")
+		pod = &corev1.Pod{}
+		pod.Namespace = "renumber"
+		pod.Name = "bare1"
+		err = k8sClient.Delete(ctx, pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() map[string]string {
+			ns := &corev1.Namespace{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "renumber"}, ns)
+			if err != nil {
+				return nil
+			}
+			return ns.Annotations
+		}).Should(And(
+			HaveKeyWithValue(constants.AnnRenumberStatus, "completed"),
+			Not(HaveKey(constants.AnnRenumberTo)),
+		))
+	})
+})
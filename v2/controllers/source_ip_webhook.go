@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SourceIPWebhookPath is the path of the webhook to assign pools to Pods.
+const SourceIPWebhookPath = "/mutate-pod-source-ip"
+
+// +kubebuilder:webhook:path=/mutate-pod-source-ip,mutating=true,failurePolicy=fail,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpod.coil.cybozu.com,admissionReviewVersions={v1,v1beta1}
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
+
+// SetupSourceIPWebhook registers a mutating webhook for Pods backing Services
+// annotated with `coil.cybozu.com/source-ip-pool`.
+func SetupSourceIPWebhook(mgr ctrl.Manager) {
+	mgr.GetWebhookServer().Register(SourceIPWebhookPath, &webhook.Admission{
+		Handler: &SourceIPPoolInjector{Client: mgr.GetClient()},
+	})
+}
+
+// SourceIPPoolInjector copies `coil.cybozu.com/source-ip-pool` annotation of
+// Services to the Pods selected by them so that coild allocates the addresses
+// of the Pods from the designated pool instead of the pool of the namespace.
+//
+// The pool must exist and must not masquerade traffic, otherwise the Pod is
+// rejected.  Pods selected by Services designating different pools are also
+// rejected.  The annotation of Pods not selected by such Services is removed
+// because it is reserved for this webhook.
+type SourceIPPoolInjector struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.DecoderInjector = &SourceIPPoolInjector{}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (h *SourceIPPoolInjector) InjectDecoder(d *admission.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (h *SourceIPPoolInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := h.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	pools, err := h.designatedPools(ctx, req.Namespace, pod)
+	if err != nil {
+		logger.Error(err, "failed to list services", "namespace", req.Namespace)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	var poolName string
+	switch len(pools) {
+	case 0:
+		if _, ok := pod.Annotations[constants.AnnSourceIPPool]; !ok {
+			return admission.Allowed("")
+		}
+		delete(pod.Annotations, constants.AnnSourceIPPool)
+	case 1:
+		for name := range pools {
+			poolName = name
+		}
+	default:
+		var desc []string
+		for name, svc := range pools {
+			desc = append(desc, fmt.Sprintf("%s (service %s)", name, svc))
+		}
+		sort.Strings(desc)
+		return admission.Denied(fmt.Sprintf("services designate different pools: %v", desc))
+	}
+
+	if poolName != "" {
+		pool := &coilv2.AddressPool{}
+		if err := h.Client.Get(ctx, client.ObjectKey{Name: poolName}, pool); err != nil {
+			if apierrors.IsNotFound(err) {
+				return admission.Denied(fmt.Sprintf("pool %s designated by service %s is not found", poolName, pools[poolName]))
+			}
+			logger.Error(err, "failed to get pool", "pool", poolName)
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if pool.Spec.Masquerade {
+			return admission.Denied(fmt.Sprintf("pool %s designated by service %s masquerades source addresses", poolName, pools[poolName]))
+		}
+
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		pod.Annotations[constants.AnnSourceIPPool] = poolName
+	}
+
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, data)
+}
+
+// designatedPools returns the pools designated by Services selecting `pod`.
+// The keys are the pool names and the values are the names of the Services.
+func (h *SourceIPPoolInjector) designatedPools(ctx context.Context, namespace string, pod *corev1.Pod) (map[string]string, error) {
+	services := &corev1.ServiceList{}
+	if err := h.Client.List(ctx, services, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	pools := make(map[string]string)
+	for _, svc := range services.Items {
+		name, ok := svc.Annotations[constants.AnnSourceIPPool]
+		if !ok || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		if !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		pools[name] = svc.Name
+	}
+	return pools, nil
+}
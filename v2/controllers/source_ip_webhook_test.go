@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Source IP pool injector", func() {
+	ctx := context.Background()
+	const namespace = "source-ip"
+
+	var injector *SourceIPPoolInjector
+
+	newRequest := func(labels, annotations map[string]string) admission.Request {
+		pod := &corev1.Pod{}
+		pod.Name = "pod1"
+		pod.Labels = labels
+		pod.Annotations = annotations
+		data, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: data},
+		}}
+	}
+
+	createService := func(name, app, pool string) {
+		svc := &corev1.Service{}
+		svc.Namespace = namespace
+		svc.Name = name
+		svc.Annotations = map[string]string{constants.AnnSourceIPPool: pool}
+		svc.Spec.Selector = map[string]string{"app": app}
+		svc.Spec.Ports = []corev1.ServicePort{{Port: 80}}
+		err := k8sClient.Create(ctx, svc)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).ToNot(HaveOccurred())
+		injector = &SourceIPPoolInjector{Client: k8sClient}
+		err = injector.InjectDecoder(decoder)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should assign pools designated by Services", func() {
+		ns := &corev1.Namespace{}
+		ns.Name = namespace
+		err := k8sClient.Create(ctx, ns)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, x := range []struct {
+			name       string
+			masquerade bool
+		}{
+			{"routable", false},
+			{"private", true},
+		} {
+			ap := &coilv2.AddressPool{}
+			ap.Name = x.name
+			ap.Spec.BlockSizeBits = 2
+			ap.Spec.Masquerade = x.masquerade
+			ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.60.0.0/24")}}
+			err := k8sClient.Create(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		createService("web", "web", "routable")
+		createService("web-private", "web-private", "private")
+		createService("web-missing", "web-missing", "missing")
+		createService("web-other", "web-other", "routable")
+		createService("web-other2", "web-other", "another")
+
+		By("admitting a Pod not selected by the Services")
+		resp := injector.Handle(ctx, newRequest(map[string]string{"app": "db"}, nil))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(BeEmpty())
+
+		By("admitting a Pod selected by a Service")
+		resp = injector.Handle(ctx, newRequest(map[string]string{"app": "web"}, nil))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Path).To(Equal("/metadata/annotations"))
+		Expect(resp.Patches[0].Value).To(HaveKeyWithValue(constants.AnnSourceIPPool, "routable"))
+
+		By("removing the annotation from a Pod not selected by the Services")
+		resp = injector.Handle(ctx, newRequest(map[string]string{"app": "db"}, map[string]string{constants.AnnSourceIPPool: "routable"}))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Operation).To(Equal("remove"))
+
+		By("rejecting Pods whose pools cannot preserve source addresses")
+		resp = injector.Handle(ctx, newRequest(map[string]string{"app": "web-private"}, nil))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("masquerades"))
+
+		resp = injector.Handle(ctx, newRequest(map[string]string{"app": "web-missing"}, nil))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("not found"))
+
+		By("rejecting Pods selected by Services designating different pools")
+		resp = injector.Handle(ctx, newRequest(map[string]string{"app": "web-other"}, nil))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("different pools"))
+	})
+})
@@ -0,0 +1,122 @@
+// Package capability restricts the Linux capabilities of Coil programs.
+package capability
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Restrict limits the capabilities of the process to `keep`.
+//
+// Capabilities are attributes of each thread, and the Go runtime has started
+// threads by the time this is called.  Restrict therefore drops the other
+// capabilities from the bounding, inheritable, and ambient sets of the calling
+// thread and re-executes the program from it, so that every thread of the new
+// process starts with `keep` only.  In the new process, the bounding set has
+// nothing to drop and Restrict returns nil.
+//
+// This must be called before the program opens files or sockets to be used
+// afterwards.  Capabilities in `keep` that the process does not have are
+// ignored.  CAP_SETPCAP is required unless it is already restricted.
+func Restrict(keep []int) error {
+	last, err := lastCap()
+	if err != nil {
+		return err
+	}
+	drop, err := toDrop(keep, last, inBounding)
+	if err != nil {
+		return err
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+
+	// the thread is never unlocked because it replaces the process.
+	runtime.LockOSThread()
+	for _, c := range drop {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to drop capability %d from the bounding set: %w", c, err)
+		}
+	}
+	// kernels older than 4.3 have no ambient set.
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && err != unix.EINVAL {
+		return fmt.Errorf("failed to clear the ambient capabilities: %w", err)
+	}
+
+	hdr := &unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to get capabilities: %w", err)
+	}
+	m := mask(keep)
+	for i := range data {
+		data[i].Effective &= m[i]
+		data[i].Permitted &= m[i]
+		data[i].Inheritable &= m[i]
+	}
+	if err := unix.Capset(hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to set capabilities: %w", err)
+	}
+
+	if err := syscall.Exec("/proc/self/exe", os.Args, os.Environ()); err != nil {
+		return fmt.Errorf("failed to re-execute %s: %w", os.Args[0], err)
+	}
+	return nil
+}
+
+// lastCap returns the highest capability number supported by the kernel.
+func lastCap() (int, error) {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func inBounding(c int) (bool, error) {
+	ret, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, uintptr(c), 0, 0, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to read capability %d of the bounding set: %w", c, err)
+	}
+	return ret == 1, nil
+}
+
+// toDrop returns the capabilities up to `last` in the bounding set that are not in `keep`.
+func toDrop(keep []int, last int, bounding func(int) (bool, error)) ([]int, error) {
+	kept := make(map[int]bool)
+	for _, c := range keep {
+		kept[c] = true
+	}
+
+	var drop []int
+	for c := 0; c <= last; c++ {
+		if kept[c] {
+			continue
+		}
+		ok, err := bounding(c)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			drop = append(drop, c)
+		}
+	}
+	return drop, nil
+}
+
+// mask returns the bitmasks of `keep` for the two 32-bit words of CapUserData.
+func mask(keep []int) [2]uint32 {
+	var m [2]uint32
+	for _, c := range keep {
+		if c >= 0 && c < 64 {
+			m[c/32] |= 1 << (c % 32)
+		}
+	}
+	return m
+}
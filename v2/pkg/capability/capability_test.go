@@ -0,0 +1,101 @@
+package capability
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+func TestToDrop(t *testing.T) {
+	t.Parallel()
+
+	bounding := func(c int) (bool, error) { return c != 3, nil }
+	drop, err := toDrop([]int{1, 4}, 5, bounding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{0, 2, 5}, drop); diff != "" {
+		t.Errorf("unexpected capabilities to drop (-want +got):\n%s", diff)
+	}
+
+	drop, err = toDrop([]int{0, 1, 2}, 2, bounding)
+	if err != nil || len(drop) != 0 {
+		t.Error("nothing should be dropped:", drop, err)
+	}
+
+	if _, err := toDrop(nil, 2, func(int) (bool, error) { return false, errors.New("fail") }); err == nil {
+		t.Error("errors should be returned")
+	}
+}
+
+func TestMask(t *testing.T) {
+	t.Parallel()
+
+	m := mask([]int{unix.CAP_NET_ADMIN, unix.CAP_SYS_ADMIN, unix.CAP_BPF, 64})
+	if m[0] != 1<<12|1<<21 || m[1] != 1<<7 {
+		t.Errorf("unexpected mask: %#x %#x", m[0], m[1])
+	}
+}
+
+// capabilities returns the capability sets in /proc/self/status.
+func capabilities() (map[string]string, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return nil, err
+	}
+	caps := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && strings.HasPrefix(fields[0], "Cap") {
+			caps[strings.TrimSuffix(fields[0], ":")] = fields[1]
+		}
+	}
+	return caps, nil
+}
+
+const envRestrictHelper = "COIL_TEST_RESTRICT_HELPER"
+
+// TestRestrictHelper is run in a child process by TestRestrict.
+func TestRestrictHelper(t *testing.T) {
+	if os.Getenv(envRestrictHelper) == "" {
+		t.Skip("run by TestRestrict")
+	}
+
+	if err := Restrict([]int{unix.CAP_NET_ADMIN, unix.CAP_NET_RAW}); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("CapEff=%s CapPrm=%s CapInh=%s CapBnd=%s\n", caps["CapEff"], caps["CapPrm"], caps["CapInh"], caps["CapBnd"])
+}
+
+func TestRestrict(t *testing.T) {
+	t.Parallel()
+
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+	if ok, err := inBounding(unix.CAP_SETPCAP); err != nil || !ok {
+		t.Skip("need CAP_SETPCAP")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestrictHelper$", "-test.v")
+	cmd.Env = append(os.Environ(), envRestrictHelper+"=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	// the helper process is re-executed with CAP_NET_ADMIN and CAP_NET_RAW only.
+	const want = "CapEff=0000000000003000 CapPrm=0000000000003000 CapInh=0000000000000000 CapBnd=0000000000003000"
+	if !strings.Contains(string(out), want) {
+		t.Errorf("capabilities are not restricted: %s", out)
+	}
+}
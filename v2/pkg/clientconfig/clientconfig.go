@@ -0,0 +1,81 @@
+// Package clientconfig provides the common options for Coil programs
+// to connect to kube-apiserver.
+package clientconfig
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// Options is a set of options to create a client for kube-apiserver.
+//
+// The zero values mean the defaults of client-go.
+type Options struct {
+	// Kubeconfig is the path to a kubeconfig file.
+	// If empty, the file given by KUBECONFIG environment variable,
+	// the in-cluster configuration, or $HOME/.kube/config is used in this order.
+	//
+	// Client certificates referenced by file paths in the kubeconfig are
+	// reloaded by client-go within 5 minutes after they are updated,
+	// so they can be rotated without restart.
+	Kubeconfig string
+
+	// QPS is the maximum queries per second to kube-apiserver.
+	QPS float32
+
+	// Burst is the maximum burst of queries to kube-apiserver.
+	Burst int
+
+	// Timeout is the timeout for a single request to kube-apiserver.
+	Timeout time.Duration
+}
+
+// AddFlags adds command-line flags for the options to `fs`.
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file to connect to kube-apiserver")
+	fs.Float32Var(&o.QPS, "kube-api-qps", 0, "maximum queries per second to kube-apiserver (0 means the client-go default)")
+	fs.IntVar(&o.Burst, "kube-api-burst", 0, "maximum burst of queries to kube-apiserver (0 means the client-go default)")
+	fs.DurationVar(&o.Timeout, "kube-api-timeout", 0, "timeout for a request to kube-apiserver (0 means no timeout)")
+}
+
+// Config returns a *rest.Config for the cluster where the program runs.
+func (o *Options) Config() (*rest.Config, error) {
+	if o.Kubeconfig != "" {
+		return o.ConfigFromFile(o.Kubeconfig)
+	}
+
+	cfg, err := ctrlconfig.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client configuration: %w", err)
+	}
+	o.apply(cfg)
+	return cfg, nil
+}
+
+// ConfigFromFile returns a *rest.Config loaded from the kubeconfig file at `path`.
+// The other options are applied to the returned config.
+func (o *Options) ConfigFromFile(path string) (*rest.Config, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+	}
+	o.apply(cfg)
+	return cfg, nil
+}
+
+func (o *Options) apply(cfg *rest.Config) {
+	if o.QPS > 0 {
+		cfg.QPS = o.QPS
+	}
+	if o.Burst > 0 {
+		cfg.Burst = o.Burst
+	}
+	if o.Timeout > 0 {
+		cfg.Timeout = o.Timeout
+	}
+}
@@ -0,0 +1,219 @@
+package clientconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://10.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: abc
+`
+
+func TestConfigFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Options{Kubeconfig: path, QPS: 50, Burst: 100, Timeout: 30 * time.Second}
+	cfg, err := o.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "https://10.0.0.1:6443" {
+		t.Error("unexpected host:", cfg.Host)
+	}
+	if cfg.BearerToken != "abc" {
+		t.Error("unexpected token:", cfg.BearerToken)
+	}
+	if cfg.QPS != 50 || cfg.Burst != 100 || cfg.Timeout != 30*time.Second {
+		t.Errorf("options are not applied: qps=%v, burst=%v, timeout=%v", cfg.QPS, cfg.Burst, cfg.Timeout)
+	}
+
+	o = &Options{}
+	cfg, err = o.ConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.QPS != 0 || cfg.Burst != 0 || cfg.Timeout != 0 {
+		t.Errorf("defaults are overwritten: qps=%v, burst=%v, timeout=%v", cfg.QPS, cfg.Burst, cfg.Timeout)
+	}
+
+	if _, err := o.ConfigFromFile(filepath.Join(dir, "none")); err == nil {
+		t.Error("loading a non-existent file should fail")
+	}
+}
+
+// writeClientCert writes a client certificate for `cn` signed by `ca` to `certFile` and `keyFile`.
+func writeClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, cn, certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are replaced by renaming as kubelet updates Secret volumes.
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path+".tmp", pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClientCertRotation(t *testing.T) {
+	// check the rotation quickly.
+	transport.CertCallbackRefreshDuration = 100 * time.Millisecond
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server responds with the common name of the client certificate.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeClientCert(t, ca, caKey, "old", certFile, keyFile)
+
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    client-certificate: %s
+    client-key: %s
+`, srv.URL, certFile, keyFile)
+	path := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Options{}
+	cfg, err := o.ConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := rest.TransportFor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := &http.Client{Transport: rt}
+	get := func() string {
+		t.Helper()
+		resp, err := hc.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if cn := get(); cn != "old" {
+		t.Fatal("unexpected client certificate:", cn)
+	}
+
+	writeClientCert(t, ca, caKey, "new", certFile, keyFile)
+	deadline := time.Now().Add(10 * time.Second)
+	for get() != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("the rotated client certificate is not used")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
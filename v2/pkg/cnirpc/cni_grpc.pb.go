@@ -22,6 +22,19 @@ type CNIClient interface {
 	Add(ctx context.Context, in *CNIArgs, opts ...grpc.CallOption) (*AddResponse, error)
 	Del(ctx context.Context, in *CNIArgs, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	Check(ctx context.Context, in *CNIArgs, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*VersionResponse, error)
+	TrafficStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TrafficStatsResponse, error)
+	GetReadOnly(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ReadOnlyMode, error)
+	SetReadOnly(ctx context.Context, in *ReadOnlyMode, opts ...grpc.CallOption) (*ReadOnlyMode, error)
+	GetLogLevel(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LogLevel, error)
+	SetLogLevel(ctx context.Context, in *LogLevel, opts ...grpc.CallOption) (*LogLevel, error)
+	Recover(ctx context.Context, in *CNIArgs, opts ...grpc.CallOption) (*RecoverResponse, error)
+	ForceFree(ctx context.Context, in *ForceFreeRequest, opts ...grpc.CallOption) (*ForceFreeResponse, error)
+	Hold(ctx context.Context, in *HoldRequest, opts ...grpc.CallOption) (*HoldResponse, error)
+	ReleaseHold(ctx context.Context, in *ReleaseHoldRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	FreeNamespace(ctx context.Context, in *FreeNamespaceRequest, opts ...grpc.CallOption) (*FreeNamespaceResponse, error)
+	Contention(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ContentionResponse, error)
+	NodeStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NodeStatusResponse, error)
 }
 
 type cNIClient struct {
@@ -59,6 +72,123 @@ func (c *cNIClient) Check(ctx context.Context, in *CNIArgs, opts ...grpc.CallOpt
 	return out, nil
 }
 
+func (c *cNIClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*VersionResponse, error) {
+	out := new(VersionResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) TrafficStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TrafficStatsResponse, error) {
+	out := new(TrafficStatsResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/TrafficStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) GetReadOnly(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ReadOnlyMode, error) {
+	out := new(ReadOnlyMode)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/GetReadOnly", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) SetReadOnly(ctx context.Context, in *ReadOnlyMode, opts ...grpc.CallOption) (*ReadOnlyMode, error) {
+	out := new(ReadOnlyMode)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/SetReadOnly", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) GetLogLevel(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LogLevel, error) {
+	out := new(LogLevel)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/GetLogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) SetLogLevel(ctx context.Context, in *LogLevel, opts ...grpc.CallOption) (*LogLevel, error) {
+	out := new(LogLevel)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/SetLogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) Recover(ctx context.Context, in *CNIArgs, opts ...grpc.CallOption) (*RecoverResponse, error) {
+	out := new(RecoverResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/Recover", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) ForceFree(ctx context.Context, in *ForceFreeRequest, opts ...grpc.CallOption) (*ForceFreeResponse, error) {
+	out := new(ForceFreeResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/ForceFree", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) Hold(ctx context.Context, in *HoldRequest, opts ...grpc.CallOption) (*HoldResponse, error) {
+	out := new(HoldResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/Hold", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) ReleaseHold(ctx context.Context, in *ReleaseHoldRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/ReleaseHold", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) FreeNamespace(ctx context.Context, in *FreeNamespaceRequest, opts ...grpc.CallOption) (*FreeNamespaceResponse, error) {
+	out := new(FreeNamespaceResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/FreeNamespace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) Contention(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ContentionResponse, error) {
+	out := new(ContentionResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/Contention", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) NodeStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NodeStatusResponse, error) {
+	out := new(NodeStatusResponse)
+	err := c.cc.Invoke(ctx, "/pkg.cnirpc.CNI/NodeStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CNIServer is the server API for CNI service.
 // All implementations must embed UnimplementedCNIServer
 // for forward compatibility
@@ -66,6 +196,19 @@ type CNIServer interface {
 	Add(context.Context, *CNIArgs) (*AddResponse, error)
 	Del(context.Context, *CNIArgs) (*emptypb.Empty, error)
 	Check(context.Context, *CNIArgs) (*emptypb.Empty, error)
+	Version(context.Context, *emptypb.Empty) (*VersionResponse, error)
+	TrafficStats(context.Context, *emptypb.Empty) (*TrafficStatsResponse, error)
+	GetReadOnly(context.Context, *emptypb.Empty) (*ReadOnlyMode, error)
+	SetReadOnly(context.Context, *ReadOnlyMode) (*ReadOnlyMode, error)
+	GetLogLevel(context.Context, *emptypb.Empty) (*LogLevel, error)
+	SetLogLevel(context.Context, *LogLevel) (*LogLevel, error)
+	Recover(context.Context, *CNIArgs) (*RecoverResponse, error)
+	ForceFree(context.Context, *ForceFreeRequest) (*ForceFreeResponse, error)
+	Hold(context.Context, *HoldRequest) (*HoldResponse, error)
+	ReleaseHold(context.Context, *ReleaseHoldRequest) (*emptypb.Empty, error)
+	FreeNamespace(context.Context, *FreeNamespaceRequest) (*FreeNamespaceResponse, error)
+	Contention(context.Context, *emptypb.Empty) (*ContentionResponse, error)
+	NodeStatus(context.Context, *emptypb.Empty) (*NodeStatusResponse, error)
 	mustEmbedUnimplementedCNIServer()
 }
 
@@ -82,6 +225,45 @@ func (UnimplementedCNIServer) Del(context.Context, *CNIArgs) (*emptypb.Empty, er
 func (UnimplementedCNIServer) Check(context.Context, *CNIArgs) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
 }
+func (UnimplementedCNIServer) Version(context.Context, *emptypb.Empty) (*VersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (UnimplementedCNIServer) TrafficStats(context.Context, *emptypb.Empty) (*TrafficStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TrafficStats not implemented")
+}
+func (UnimplementedCNIServer) GetReadOnly(context.Context, *emptypb.Empty) (*ReadOnlyMode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReadOnly not implemented")
+}
+func (UnimplementedCNIServer) SetReadOnly(context.Context, *ReadOnlyMode) (*ReadOnlyMode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetReadOnly not implemented")
+}
+func (UnimplementedCNIServer) GetLogLevel(context.Context, *emptypb.Empty) (*LogLevel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLogLevel not implemented")
+}
+func (UnimplementedCNIServer) SetLogLevel(context.Context, *LogLevel) (*LogLevel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
+}
+func (UnimplementedCNIServer) Recover(context.Context, *CNIArgs) (*RecoverResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Recover not implemented")
+}
+func (UnimplementedCNIServer) ForceFree(context.Context, *ForceFreeRequest) (*ForceFreeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForceFree not implemented")
+}
+func (UnimplementedCNIServer) Hold(context.Context, *HoldRequest) (*HoldResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Hold not implemented")
+}
+func (UnimplementedCNIServer) ReleaseHold(context.Context, *ReleaseHoldRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseHold not implemented")
+}
+func (UnimplementedCNIServer) FreeNamespace(context.Context, *FreeNamespaceRequest) (*FreeNamespaceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FreeNamespace not implemented")
+}
+func (UnimplementedCNIServer) Contention(context.Context, *emptypb.Empty) (*ContentionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Contention not implemented")
+}
+func (UnimplementedCNIServer) NodeStatus(context.Context, *emptypb.Empty) (*NodeStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NodeStatus not implemented")
+}
 func (UnimplementedCNIServer) mustEmbedUnimplementedCNIServer() {}
 
 // UnsafeCNIServer may be embedded to opt out of forward compatibility for this service.
@@ -149,6 +331,240 @@ func _CNI_Check_Handler(srv interface{}, ctx context.Context, dec func(interface
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CNI_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Version(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_TrafficStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).TrafficStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/TrafficStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).TrafficStats(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_GetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).GetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/GetReadOnly",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).GetReadOnly(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_SetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadOnlyMode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).SetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/SetReadOnly",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).SetReadOnly(ctx, req.(*ReadOnlyMode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_GetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).GetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/GetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).GetLogLevel(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogLevel)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).SetLogLevel(ctx, req.(*LogLevel))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_Recover_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CNIArgs)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Recover(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/Recover",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Recover(ctx, req.(*CNIArgs))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_ForceFree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForceFreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).ForceFree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/ForceFree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).ForceFree(ctx, req.(*ForceFreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_Hold_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HoldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Hold(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/Hold",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Hold(ctx, req.(*HoldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_ReleaseHold_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseHoldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).ReleaseHold(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/ReleaseHold",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).ReleaseHold(ctx, req.(*ReleaseHoldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_FreeNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreeNamespaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).FreeNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/FreeNamespace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).FreeNamespace(ctx, req.(*FreeNamespaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_Contention_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Contention(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/Contention",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Contention(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_NodeStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).NodeStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pkg.cnirpc.CNI/NodeStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).NodeStatus(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // CNI_ServiceDesc is the grpc.ServiceDesc for CNI service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -168,6 +584,58 @@ var CNI_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Check",
 			Handler:    _CNI_Check_Handler,
 		},
+		{
+			MethodName: "Version",
+			Handler:    _CNI_Version_Handler,
+		},
+		{
+			MethodName: "TrafficStats",
+			Handler:    _CNI_TrafficStats_Handler,
+		},
+		{
+			MethodName: "GetReadOnly",
+			Handler:    _CNI_GetReadOnly_Handler,
+		},
+		{
+			MethodName: "SetReadOnly",
+			Handler:    _CNI_SetReadOnly_Handler,
+		},
+		{
+			MethodName: "GetLogLevel",
+			Handler:    _CNI_GetLogLevel_Handler,
+		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _CNI_SetLogLevel_Handler,
+		},
+		{
+			MethodName: "Recover",
+			Handler:    _CNI_Recover_Handler,
+		},
+		{
+			MethodName: "ForceFree",
+			Handler:    _CNI_ForceFree_Handler,
+		},
+		{
+			MethodName: "Hold",
+			Handler:    _CNI_Hold_Handler,
+		},
+		{
+			MethodName: "ReleaseHold",
+			Handler:    _CNI_ReleaseHold_Handler,
+		},
+		{
+			MethodName: "FreeNamespace",
+			Handler:    _CNI_FreeNamespace_Handler,
+		},
+		{
+			MethodName: "Contention",
+			Handler:    _CNI_Contention_Handler,
+		},
+		{
+			MethodName: "NodeStatus",
+			Handler:    _CNI_NodeStatus_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "pkg/cnirpc/cni.proto",
@@ -0,0 +1,79 @@
+package cnirpc
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Schema returns the wire-level surface of the CNI service as sorted lines.
+//
+// Each line is a message field with its number and type, an enum value with
+// its number, or a method with its request and response types.  Compatible
+// changes only add lines; removing or changing a line breaks older clients
+// or servers.
+func Schema() []string {
+	fd := File_pkg_cnirpc_cni_proto
+	var lines []string
+
+	var addMessages func(msgs protoreflect.MessageDescriptors)
+	addMessages = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			md := msgs.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			fields := md.Fields()
+			for j := 0; j < fields.Len(); j++ {
+				f := fields.Get(j)
+				lines = append(lines, fmt.Sprintf("message %s field %d %s %s", md.FullName(), f.Number(), f.Name(), fieldType(f)))
+			}
+			addMessages(md.Messages())
+		}
+	}
+	addMessages(fd.Messages())
+
+	enums := fd.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		ed := enums.Get(i)
+		values := ed.Values()
+		for j := 0; j < values.Len(); j++ {
+			v := values.Get(j)
+			lines = append(lines, fmt.Sprintf("enum %s value %d %s", ed.FullName(), v.Number(), v.Name()))
+		}
+	}
+
+	services := fd.Services()
+	for i := 0; i < services.Len(); i++ {
+		sd := services.Get(i)
+		methods := sd.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			m := methods.Get(j)
+			lines = append(lines, fmt.Sprintf("service %s method %s %s %s", sd.FullName(), m.Name(), m.Input().FullName(), m.Output().FullName()))
+		}
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+func fieldType(f protoreflect.FieldDescriptor) string {
+	switch {
+	case f.IsMap():
+		return fmt.Sprintf("map<%s,%s>", fieldType(f.MapKey()), fieldType(f.MapValue()))
+	case f.IsList():
+		return "repeated " + kindName(f)
+	}
+	return kindName(f)
+}
+
+func kindName(f protoreflect.FieldDescriptor) string {
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(f.Enum().FullName())
+	}
+	return f.Kind().String()
+}
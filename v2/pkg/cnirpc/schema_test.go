@@ -0,0 +1,43 @@
+package cnirpc
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "update testdata/schema.txt with the current schema")
+
+const schemaFile = "testdata/schema.txt"
+
+// TestSchemaCompatibility fails if the schema lost any line recorded in
+// testdata/schema.txt.  Run `go test ./pkg/cnirpc -update-schema` after
+// adding methods, fields, or enum values.
+func TestSchemaCompatibility(t *testing.T) {
+	current := Schema()
+	if *updateSchema {
+		if err := os.WriteFile(schemaFile, []byte(strings.Join(current, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	lines := make(map[string]bool)
+	for _, l := range current {
+		lines[l] = true
+	}
+	for _, l := range recorded {
+		if !lines[l] {
+			t.Errorf("incompatible change: %q is removed or changed", l)
+		}
+	}
+	if len(current) != len(recorded) {
+		t.Errorf("the schema has changed; run go test ./pkg/cnirpc -update-schema")
+	}
+}
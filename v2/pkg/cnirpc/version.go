@@ -0,0 +1,29 @@
+package cnirpc
+
+import "fmt"
+
+// API versions of the CNI service.
+//
+// APIVersion is incremented when the semantics of existing methods or fields
+// change incompatibly.  Adding methods, fields, or enum values does not change
+// the version.  coild keeps supporting at least one previous version so that
+// coil and coild can be upgraded independently.
+const (
+	// APIVersion is the API version implemented by this package.
+	APIVersion = 1
+
+	// MinAPIVersion is the oldest API version supported by this package.
+	MinAPIVersion = 1
+)
+
+// APIVersionKey is the gRPC metadata key to send the API version of clients.
+const APIVersionKey = "coil-api-version"
+
+// VersionKey is the gRPC metadata key for the CNI plugin to send its Coil version.
+const VersionKey = "coil-version"
+
+// SupportedAPIVersions returns the range of the supported API versions
+// in the form of "MIN-MAX".
+func SupportedAPIVersions() string {
+	return fmt.Sprintf("%d-%d", MinAPIVersion, APIVersion)
+}
@@ -0,0 +1,145 @@
+package coilconfig
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Defaults are the values used for the fields not set in CoilConfig.
+// They are given by command-line flags.
+type Defaults struct {
+	DefaultPool      string
+	GCInterval       time.Duration
+	RequestTTL       time.Duration
+	RenumberInterval time.Duration
+}
+
+// Store keeps the CoilConfig of the cluster.  It is safe for concurrent use.
+type Store struct {
+	defaults Defaults
+
+	mu   sync.RWMutex
+	spec coilv2.CoilConfigSpec
+}
+
+// NewStore creates a Store.  Until a CoilConfig is loaded, `defaults` are used.
+func NewStore(defaults Defaults) *Store {
+	if defaults.DefaultPool == "" {
+		defaults.DefaultPool = constants.DefaultPool
+	}
+	return &Store{defaults: defaults}
+}
+
+// Load reads the CoilConfig named constants.CoilConfigName with `r` and applies it.
+// If it does not exist, the defaults are used.  If it is invalid, the current
+// values are kept and an error is returned.
+//
+// The returned bool is true if the values have changed.
+func (s *Store) Load(ctx context.Context, r client.Reader) (bool, error) {
+	cc := &coilv2.CoilConfig{}
+	err := r.Get(ctx, client.ObjectKey{Name: constants.CoilConfigName}, cc)
+	switch {
+	case apierrors.IsNotFound(err):
+		return s.set(coilv2.CoilConfigSpec{}), nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get CoilConfig %s: %w", constants.CoilConfigName, err)
+	}
+
+	if err := cc.Spec.Validate(); err != nil {
+		return false, fmt.Errorf("invalid CoilConfig %s: %w", constants.CoilConfigName, err)
+	}
+	return s.set(cc.Spec), nil
+}
+
+func (s *Store) set(spec coilv2.CoilConfigSpec) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if reflect.DeepEqual(s.spec, spec) {
+		return false
+	}
+	s.spec = *spec.DeepCopy()
+	return true
+}
+
+// current returns the current spec.  Since the spec is replaced as a whole
+// by set, pointers in the returned spec are never modified.
+func (s *Store) current() coilv2.CoilConfigSpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.spec
+}
+
+// DefaultPool returns the name of the AddressPool for namespaces without pool annotations.
+func (s *Store) DefaultPool() string {
+	if p := s.current().DefaultPool; p != "" {
+		return p
+	}
+	return s.defaults.DefaultPool
+}
+
+// GCInterval returns the interval of garbage collection.
+func (s *Store) GCInterval() time.Duration {
+	return durationOr(s.current().GCInterval, s.defaults.GCInterval)
+}
+
+// RequestTTL returns the retention period of completed or failed BlockRequests.
+func (s *Store) RequestTTL() time.Duration {
+	return durationOr(s.current().RequestTTL, s.defaults.RequestTTL)
+}
+
+// RenumberInterval returns the interval between Pod evictions to move a namespace to another pool.
+func (s *Store) RenumberInterval() time.Duration {
+	return durationOr(s.current().RenumberInterval, s.defaults.RenumberInterval)
+}
+
+// Supernets returns the subnets out of which new pools are curved.
+// Invalid ones are ignored as Load rejects them.
+func (s *Store) Supernets() []*net.IPNet {
+	return parseSubnets(s.current().Supernets)
+}
+
+// ServiceCIDRs returns the subnets of Service ClusterIPs.
+func (s *Store) ServiceCIDRs() []*net.IPNet {
+	return parseSubnets(s.current().ServiceCIDRs)
+}
+
+// NodeNetworks returns the subnets of the primary networks of nodes.
+func (s *Store) NodeNetworks() []*net.IPNet {
+	return parseSubnets(s.current().NodeNetworks)
+}
+
+func parseSubnets(cidrs []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, sn := range cidrs {
+		if _, n, err := net.ParseCIDR(sn); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// PoolRequestQuota returns the limits of pools requested by each namespace.
+func (s *Store) PoolRequestQuota() coilv2.PoolRequestQuota {
+	if q := s.current().PoolRequestQuota; q != nil {
+		return *q
+	}
+	return coilv2.PoolRequestQuota{}
+}
+
+func durationOr(d *metav1.Duration, fallback time.Duration) time.Duration {
+	if d == nil {
+		return fallback
+	}
+	return d.Duration
+}
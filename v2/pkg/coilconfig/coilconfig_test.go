@@ -0,0 +1,104 @@
+package coilconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).Build()
+	ctx := context.Background()
+
+	store := NewStore(Defaults{GCInterval: time.Hour, RequestTTL: 2 * time.Hour, RenumberInterval: 30 * time.Second})
+	changed, err := store.Load(ctx, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("nothing should change without CoilConfig")
+	}
+	if store.DefaultPool() != constants.DefaultPool || store.GCInterval() != time.Hour ||
+		store.RequestTTL() != 2*time.Hour || store.RenumberInterval() != 30*time.Second {
+		t.Error("the defaults should be used")
+	}
+
+	cc := &coilv2.CoilConfig{}
+	cc.Name = constants.CoilConfigName
+	cc.Spec.DefaultPool = "global"
+	cc.Spec.GCInterval = &metav1.Duration{Duration: 10 * time.Minute}
+	cc.Spec.Supernets = []string{"10.0.0.0/8"}
+	cc.Spec.ServiceCIDRs = []string{"10.96.0.0/12"}
+	cc.Spec.NodeNetworks = []string{"192.168.0.0/16", "fd10::/64"}
+	cc.Spec.PoolRequestQuota = &coilv2.PoolRequestQuota{MaxPools: pointer.Int32Ptr(2)}
+	if err := cl.Create(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = store.Load(ctx, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("the config should change")
+	}
+	if store.DefaultPool() != "global" || store.GCInterval() != 10*time.Minute || store.RequestTTL() != 2*time.Hour {
+		t.Error("the config should be applied")
+	}
+	if sn := store.Supernets(); len(sn) != 1 || sn[0].String() != "10.0.0.0/8" {
+		t.Error("unexpected supernets:", sn)
+	}
+	if sn := store.ServiceCIDRs(); len(sn) != 1 || sn[0].String() != "10.96.0.0/12" {
+		t.Error("unexpected service CIDRs:", sn)
+	}
+	if sn := store.NodeNetworks(); len(sn) != 2 || sn[1].String() != "fd10::/64" {
+		t.Error("unexpected node networks:", sn)
+	}
+	if q := store.PoolRequestQuota(); q.MaxPools == nil || *q.MaxPools != 2 || q.MaxIPv4Addresses != nil {
+		t.Errorf("unexpected quota: %+v", q)
+	}
+	if changed, _ := store.Load(ctx, cl); changed {
+		t.Error("loading the same config should not change anything")
+	}
+
+	// an invalid config is not applied.
+	cc.Spec.GCInterval.Duration = 0
+	if err := cl.Update(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, cl); err == nil {
+		t.Error("an invalid config should be rejected")
+	}
+	if store.GCInterval() != 10*time.Minute {
+		t.Error("the current config should be kept")
+	}
+
+	// other CoilConfigs are ignored, and the defaults are restored by deletion.
+	other := &coilv2.CoilConfig{}
+	other.Name = "other"
+	other.Spec.DefaultPool = "other"
+	if err := cl.Create(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Delete(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, cl); err != nil {
+		t.Fatal(err)
+	}
+	if store.DefaultPool() != constants.DefaultPool || store.GCInterval() != time.Hour {
+		t.Error("the defaults should be restored")
+	}
+}
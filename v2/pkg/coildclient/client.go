@@ -0,0 +1,363 @@
+// Package coildclient provides a typed client of the gRPC API of coild.
+//
+// The client is used by the CNI plugin of Coil, and can be used by other
+// programs on the node that need addresses from Coil, e.g. virtualization
+// platforms attaching VMs to the Pod network.
+package coildclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// parameters to retry calls to coild.
+const (
+	retryInitialInterval = 100 * time.Millisecond
+	retryMaxInterval     = 2 * time.Second
+	maxRetries           = 15
+)
+
+// RecoverTimeout is the timeout to ask coild for the outcome of NewIP.
+const RecoverTimeout = 10 * time.Second
+
+// ErrNotFound is returned by GetIP if no address is allocated, and by
+// ReleaseHold if no address is held.
+var ErrNotFound = errors.New("not found")
+
+// Request identifies a network interface of a container.
+type Request struct {
+	ContainerID  string
+	Netns        string
+	Ifname       string
+	PodNamespace string
+	PodName      string
+
+	// InfraContainerID is the ID of the Pod sandbox, if any.
+	InfraContainerID string
+
+	// Path and StdinData are CNI_PATH and the network configuration
+	// given to the CNI plugin, if any.
+	Path      string
+	StdinData []byte
+}
+
+func (r *Request) args() *cnirpc.CNIArgs {
+	return &cnirpc.CNIArgs{
+		ContainerId: r.ContainerID,
+		Netns:       r.Netns,
+		Ifname:      r.Ifname,
+		Args: map[string]string{
+			constants.PodNamespaceKey: r.PodNamespace,
+			constants.PodNameKey:      r.PodName,
+			constants.PodContainerKey: r.InfraContainerID,
+		},
+		Path:      r.Path,
+		StdinData: r.StdinData,
+	}
+}
+
+// Address represents the addresses allocated to a network interface of a container.
+type Address struct {
+	Pool        string
+	ContainerID string
+	Ifname      string
+	IPs         []net.IP
+}
+
+// Allocation is the result of NewIP.
+type Allocation struct {
+	// Result is the CNI result of the network interface.
+	Result *current.Result
+
+	// Recovered is true if the result was obtained from coild after
+	// the request had failed.
+	Recovered bool
+}
+
+// Status represents the status of coild.
+type Status struct {
+	CoildVersion  string
+	MinAPIVersion int
+	MaxAPIVersion int
+	ReadOnly      bool
+}
+
+// Hold represents the addresses held for a Pod to be created.
+type Hold struct {
+	Pool    string
+	IPs     []net.IP
+	Expires time.Time
+}
+
+// Client is a client of coild.
+type Client struct {
+	conn      *grpc.ClientConn
+	cni       cnirpc.CNIClient
+	tokenFile string
+}
+
+// New connects to coild listening on the UNIX domain socket at `socket`.
+// If `tokenFile` is not empty, the bearer token in the file is sent with
+// every request.  The file is read for every request because the token
+// may be rotated.
+func New(socket, tokenFile string) (*Client, error) {
+	dialer := &net.Dialer{}
+	dialFunc := func(ctx context.Context, a string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", a)
+	}
+	conn, err := grpc.Dial(socket, grpc.WithInsecure(), grpc.WithContextDialer(dialFunc), grpc.WithUnaryInterceptor(apiVersionInterceptor))
+	if err != nil {
+		return nil, &Error{Status: codes.Unavailable, Code: types.ErrTryAgainLater, Msg: "failed to connect to " + socket, Details: err.Error(), err: err}
+	}
+	return &Client{
+		conn:      conn,
+		cni:       cnirpc.NewCNIClient(conn),
+		tokenFile: tokenFile,
+	}, nil
+}
+
+// Close closes the connection to coild.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// apiVersionInterceptor sends the API version and the Coil version of this client to coild.
+func apiVersionInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		cnirpc.APIVersionKey, strconv.Itoa(cnirpc.APIVersion),
+		cnirpc.VersionKey, v2.Version())
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// withToken attaches the bearer token to ctx.
+func (c *Client) withToken(ctx context.Context) (context.Context, error) {
+	if c.tokenFile == "" {
+		return ctx, nil
+	}
+
+	data, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, &Error{Status: codes.Unknown, Code: types.ErrIOFailure, Msg: "failed to read token file", Details: err.Error(), err: err}
+	}
+	token := strings.TrimSpace(string(data))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), nil
+}
+
+// call calls f until it succeeds, returns a non-transient error, or ctx is done.
+// The interval between calls is doubled up to retryMaxInterval.
+func (c *Client) call(ctx context.Context, f func(context.Context) error) error {
+	ctx, err := c.withToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	interval := retryInitialInterval
+	for i := 0; ; i++ {
+		err := f(ctx)
+		if err == nil {
+			return nil
+		}
+		if !IsTransient(err) || i >= maxRetries {
+			return newError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return newError(err)
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > retryMaxInterval {
+			interval = retryMaxInterval
+		}
+	}
+}
+
+// NewIP allocates addresses and sets up the network interface for `req`.
+//
+// If coild does not respond in time or becomes unavailable, NewIP asks coild
+// for the outcome with the timeout of RecoverTimeout.  If coild has set up
+// the interface, its addresses are returned.  Otherwise, coild cleans it up
+// and the original error is returned.
+func (c *Client) NewIP(ctx context.Context, req *Request) (*Allocation, error) {
+	args := req.args()
+	var resp *cnirpc.AddResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.cni.Add(ctx, args)
+		return err
+	})
+	var recovered bool
+	if err != nil && IsAmbiguous(err) {
+		resp, err = c.recover(args, err)
+		recovered = err == nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := current.NewResult(resp.Result)
+	if err != nil {
+		return nil, &Error{Status: codes.Unknown, Code: types.ErrDecodingFailure, Msg: "failed to unmarshal result", Details: err.Error(), err: err}
+	}
+	return &Allocation{Result: result.(*current.Result), Recovered: recovered}, nil
+}
+
+// recover asks coild for the outcome of Add that failed with `addErr`.
+// `addErr` is returned if the interface has not been set up, or coild
+// cannot tell the outcome, e.g. because it does not implement Recover.
+func (c *Client) recover(args *cnirpc.CNIArgs, addErr error) (*cnirpc.AddResponse, error) {
+	// the deadline of Add may have been exceeded.
+	ctx, cancel := context.WithTimeout(context.Background(), RecoverTimeout)
+	defer cancel()
+
+	var resp *cnirpc.RecoverResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.cni.Recover(ctx, args)
+		return err
+	})
+	if err != nil || !resp.Committed {
+		return nil, addErr
+	}
+	return &cnirpc.AddResponse{Result: resp.Result}, nil
+}
+
+// GetIP returns the addresses allocated to the network interface.
+// If none is allocated, ErrNotFound is returned.
+func (c *Client) GetIP(ctx context.Context, containerID, ifname string) (*Address, error) {
+	var resp *cnirpc.TrafficStatsResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.cni.TrafficStats(ctx, &emptypb.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, st := range resp.Stats {
+		if st.ContainerId != containerID || st.Ifname != ifname {
+			continue
+		}
+		addr := &Address{
+			Pool:        st.Pool,
+			ContainerID: st.ContainerId,
+			Ifname:      st.Ifname,
+		}
+		for _, s := range st.Ips {
+			if ip := net.ParseIP(s); ip != nil {
+				addr.IPs = append(addr.IPs, ip)
+			}
+		}
+		return addr, nil
+	}
+	return nil, ErrNotFound
+}
+
+// FreeIP destroys the network interface for `req` and frees its addresses.
+// It is not an error if no address is allocated.
+func (c *Client) FreeIP(ctx context.Context, req *Request) error {
+	args := req.args()
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.cni.Del(ctx, args)
+		return err
+	})
+}
+
+// Check checks the network interface for `req`.
+func (c *Client) Check(ctx context.Context, req *Request) error {
+	args := req.args()
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.cni.Check(ctx, args)
+		return err
+	})
+}
+
+// Status returns the status of coild.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var version *cnirpc.VersionResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		version, err = c.cni.Version(ctx, &emptypb.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var readOnly *cnirpc.ReadOnlyMode
+	err = c.call(ctx, func(ctx context.Context) error {
+		var err error
+		readOnly, err = c.cni.GetReadOnly(ctx, &emptypb.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		CoildVersion:  version.CoildVersion,
+		MinAPIVersion: int(version.MinApiVersion),
+		MaxAPIVersion: int(version.MaxApiVersion),
+		ReadOnly:      readOnly.Enabled,
+	}, nil
+}
+
+// HoldIP holds addresses for a Pod to be created on the node for `ttl`.
+// When the Pod is set up on the node before the hold expires, the held
+// addresses are assigned to it.  If `ttl` is zero, coild decides it.
+func (c *Client) HoldIP(ctx context.Context, namespace, name string, ttl time.Duration) (*Hold, error) {
+	req := &cnirpc.HoldRequest{
+		PodNamespace: namespace,
+		PodName:      name,
+		TtlSeconds:   int64(ttl / time.Second),
+	}
+	var resp *cnirpc.HoldResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.cni.Hold(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hold{Pool: resp.Pool, Expires: resp.Expires.AsTime()}
+	for _, s := range resp.Ips {
+		if ip := net.ParseIP(s); ip != nil {
+			h.IPs = append(h.IPs, ip)
+		}
+	}
+	return h, nil
+}
+
+// ReleaseHold frees the addresses held for a Pod.
+// If none is held, ErrNotFound is returned.
+func (c *Client) ReleaseHold(ctx context.Context, namespace, name string) error {
+	req := &cnirpc.ReleaseHoldRequest{PodNamespace: namespace, PodName: name}
+	err := c.call(ctx, func(ctx context.Context) error {
+		_, err := c.cni.ReleaseHold(ctx, req)
+		return err
+	})
+	if statusCode(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,289 @@
+package coildclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type mockCNI struct {
+	cnirpc.CNIClient
+
+	addErr     error
+	recoverRes *cnirpc.RecoverResponse
+	recoverErr error
+	nAdd       int
+	nRecover   int
+	lastArgs   *cnirpc.CNIArgs
+	lastHold   *cnirpc.HoldRequest
+	lastMD     metadata.MD
+}
+
+func (m *mockCNI) Add(ctx context.Context, in *cnirpc.CNIArgs, opts ...grpc.CallOption) (*cnirpc.AddResponse, error) {
+	m.nAdd++
+	m.lastArgs = in
+	m.lastMD, _ = metadata.FromOutgoingContext(ctx)
+	if m.addErr != nil {
+		return nil, m.addErr
+	}
+	return &cnirpc.AddResponse{Result: []byte(`{"cniVersion":"1.0.0","ips":[{"address":"10.1.2.3/32"}]}`)}, nil
+}
+
+func (m *mockCNI) Recover(ctx context.Context, in *cnirpc.CNIArgs, opts ...grpc.CallOption) (*cnirpc.RecoverResponse, error) {
+	m.nRecover++
+	return m.recoverRes, m.recoverErr
+}
+
+func (m *mockCNI) TrafficStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*cnirpc.TrafficStatsResponse, error) {
+	return &cnirpc.TrafficStatsResponse{Stats: []*cnirpc.PodTrafficStats{
+		{Pool: "default", ContainerId: "c1", Ifname: "eth0", Ips: []string{"10.1.2.3", "fd02::1"}},
+	}}, nil
+}
+
+func (m *mockCNI) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*cnirpc.VersionResponse, error) {
+	return &cnirpc.VersionResponse{MinApiVersion: 1, MaxApiVersion: 1, CoildVersion: "2.0.14"}, nil
+}
+
+func (m *mockCNI) GetReadOnly(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*cnirpc.ReadOnlyMode, error) {
+	return &cnirpc.ReadOnlyMode{Enabled: true}, nil
+}
+
+func (m *mockCNI) Hold(ctx context.Context, in *cnirpc.HoldRequest, opts ...grpc.CallOption) (*cnirpc.HoldResponse, error) {
+	m.lastHold = in
+	return &cnirpc.HoldResponse{
+		Pool:    "default",
+		Ips:     []string{"10.1.2.4"},
+		Expires: timestamppb.New(time.Unix(1600000000, 0)),
+	}, nil
+}
+
+func (m *mockCNI) ReleaseHold(ctx context.Context, in *cnirpc.ReleaseHoldRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	if in.PodName != "held" {
+		return nil, status.Error(codes.NotFound, "no addresses are held for the pod")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func TestCall(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{}
+	count := 0
+	err := c.call(context.Background(), func(ctx context.Context) error {
+		count++
+		if count < 3 {
+			return status.Error(codes.Unavailable, "connection refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Error("should be called 3 times, but", count)
+	}
+
+	count = 0
+	err = c.call(context.Background(), func(ctx context.Context) error {
+		count++
+		return status.Error(codes.Internal, "failed")
+	})
+	var e *Error
+	if !errors.As(err, &e) || e.Status != codes.Internal {
+		t.Error("unexpected error:", err)
+	}
+	if count != 1 {
+		t.Error("non-transient errors should not be retried, but called", count, "times")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count = 0
+	err = c.call(ctx, func(ctx context.Context) error {
+		count++
+		return status.Error(codes.Unavailable, "connection refused")
+	})
+	if !IsTransient(err) {
+		t.Error("unexpected error:", err)
+	}
+	if count != 1 {
+		t.Error("should not retry after the context is done, but called", count, "times")
+	}
+}
+
+func TestNewError(t *testing.T) {
+	t.Parallel()
+
+	st, err := status.New(codes.FailedPrecondition, "no pool").WithDetails(&cnirpc.CNIError{
+		Code:    cnirpc.ErrorCode_TRY_AGAIN_LATER,
+		Msg:     "no pool matches the selector",
+		Details: "foo=bar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		code uint
+		msg  string
+	}{
+		{"CNIError", st.Err(), types.ErrTryAgainLater, "no pool matches the selector"},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), types.ErrTryAgainLater, "coild is not available"},
+		{"deadline", status.Error(codes.DeadlineExceeded, "timeout"), types.ErrTryAgainLater, "coild is not available"},
+		{"invalid", status.Error(codes.InvalidArgument, "bad"), types.ErrInvalidNetworkConfig, "bad"},
+		{"other", status.Error(codes.Internal, "oops"), types.ErrInternal, "oops"},
+		{"non-grpc", errors.New("plain"), types.ErrInternal, "plain"},
+	}
+
+	for _, tc := range testCases {
+		e := newError(tc.err)
+		if e.Code != tc.code || e.Msg != tc.msg {
+			t.Errorf("%s: unexpected error: %+v", tc.name, e)
+		}
+		if e.CNIError().Code != tc.code {
+			t.Errorf("%s: unexpected CNI error: %+v", tc.name, e.CNIError())
+		}
+	}
+	if e := newError(st.Err()); e.Status != codes.FailedPrecondition || e.Details != "foo=bar" {
+		t.Error("unexpected error:", e)
+	}
+}
+
+func TestNewIP(t *testing.T) {
+	t.Parallel()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &mockCNI{}
+	c := &Client{cni: m, tokenFile: tokenFile}
+	req := &Request{ContainerID: "c1", Netns: "/run/netns/c1", Ifname: "eth0", PodNamespace: "ns1", PodName: "pod1"}
+
+	alloc, err := c.NewIP(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alloc.Recovered || len(alloc.Result.IPs) != 1 || alloc.Result.IPs[0].Address.String() != "10.1.2.3/32" {
+		t.Error("unexpected allocation:", alloc)
+	}
+	if m.lastArgs.ContainerId != "c1" || m.lastArgs.Args["K8S_POD_NAMESPACE"] != "ns1" || m.lastArgs.Args["K8S_POD_NAME"] != "pod1" {
+		t.Error("unexpected arguments:", m.lastArgs)
+	}
+	if auth := m.lastMD.Get("authorization"); len(auth) != 1 || auth[0] != "Bearer abc" {
+		t.Error("the token should be sent:", auth)
+	}
+
+	newIP := func(m *mockCNI) (*Allocation, error) {
+		return (&Client{cni: m}).NewIP(context.Background(), req)
+	}
+
+	// the outcome is recovered after ambiguous failures.
+	m = &mockCNI{
+		addErr:     status.Error(codes.DeadlineExceeded, "timeout"),
+		recoverRes: &cnirpc.RecoverResponse{Committed: true, Result: []byte(`{"cniVersion":"1.0.0"}`)},
+	}
+	alloc, err = newIP(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alloc.Recovered {
+		t.Error("the allocation should be recovered")
+	}
+
+	m = &mockCNI{addErr: status.Error(codes.DeadlineExceeded, "timeout"), recoverRes: &cnirpc.RecoverResponse{}}
+	if _, err := newIP(m); !IsAmbiguous(err) {
+		t.Error("the original error should be returned if not committed:", err)
+	}
+
+	m = &mockCNI{addErr: status.Error(codes.DeadlineExceeded, "timeout"), recoverErr: status.Error(codes.Unimplemented, "unknown method")}
+	if _, err := newIP(m); !IsAmbiguous(err) {
+		t.Error("the original error should be returned if Recover fails:", err)
+	}
+	if m.nRecover != 1 {
+		t.Error("non-transient errors should not be retried, but called", m.nRecover, "times")
+	}
+
+	// other errors are not recovered.
+	m = &mockCNI{addErr: status.Error(codes.Internal, "failed")}
+	if _, err := newIP(m); err == nil || m.nRecover != 0 {
+		t.Error("internal errors should not be recovered:", err, m.nRecover)
+	}
+
+	// token errors.
+	_, err = (&Client{cni: &mockCNI{}, tokenFile: filepath.Join(t.TempDir(), "none")}).NewIP(context.Background(), req)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != types.ErrIOFailure {
+		t.Error("missing token file should be an I/O failure:", err)
+	}
+}
+
+func TestGetIP(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{cni: &mockCNI{}}
+	addr, err := c.GetIP(context.Background(), "c1", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Pool != "default" || len(addr.IPs) != 2 || !addr.IPs[0].Equal(net.ParseIP("10.1.2.3")) || !addr.IPs[1].Equal(net.ParseIP("fd02::1")) {
+		t.Error("unexpected address:", addr)
+	}
+
+	if _, err := c.GetIP(context.Background(), "c1", "eth1"); err != ErrNotFound {
+		t.Error("missing interfaces should not be found:", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{cni: &mockCNI{}}
+	st, err := c.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Status{CoildVersion: "2.0.14", MinAPIVersion: 1, MaxAPIVersion: 1, ReadOnly: true}
+	if *st != expected {
+		t.Error("unexpected status:", st)
+	}
+}
+
+func TestHold(t *testing.T) {
+	t.Parallel()
+
+	m := &mockCNI{}
+	c := &Client{cni: m}
+	h, err := c.HoldIP(context.Background(), "ns1", "pod1", 90*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.lastHold.PodNamespace != "ns1" || m.lastHold.PodName != "pod1" || m.lastHold.TtlSeconds != 90 {
+		t.Error("unexpected request:", m.lastHold)
+	}
+	if h.Pool != "default" || len(h.IPs) != 1 || !h.IPs[0].Equal(net.ParseIP("10.1.2.4")) || !h.Expires.Equal(time.Unix(1600000000, 0)) {
+		t.Error("unexpected hold:", h)
+	}
+
+	if err := c.ReleaseHold(context.Background(), "ns1", "held"); err != nil {
+		t.Error(err)
+	}
+	if err := c.ReleaseHold(context.Background(), "ns1", "pod1"); err != ErrNotFound {
+		t.Error("releasing a missing hold should not be found:", err)
+	}
+}
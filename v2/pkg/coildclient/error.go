@@ -0,0 +1,93 @@
+package coildclient
+
+import (
+	"errors"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is the error returned by the methods of Client.
+//
+// Code, Msg, and Details are the CNI error given by coild, or decided
+// from the gRPC status if coild has not given one.
+type Error struct {
+	// Status is the gRPC status code.  It is codes.Unknown for errors
+	// occurred in the client.
+	Status codes.Code
+
+	Code    uint
+	Msg     string
+	Details string
+
+	err error
+}
+
+func newError(err error) *Error {
+	st := status.Convert(err)
+	e := &Error{Status: st.Code(), Msg: st.Message(), Details: err.Error(), err: err}
+
+	details := st.Details()
+	if len(details) == 1 {
+		if cniErr, ok := details[0].(*cnirpc.CNIError); ok {
+			e.Code = uint(cniErr.Code)
+			e.Msg = cniErr.Msg
+			e.Details = cniErr.Details
+			return e
+		}
+	}
+
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		e.Code = types.ErrTryAgainLater
+		e.Msg = "coild is not available"
+	case codes.InvalidArgument:
+		e.Code = types.ErrInvalidNetworkConfig
+	default:
+		e.Code = types.ErrInternal
+	}
+	return e
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Details == "" {
+		return e.Msg
+	}
+	return e.Msg + ": " + e.Details
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// CNIError returns the error as a CNI error.
+func (e *Error) CNIError() *types.Error {
+	return types.NewError(e.Code, e.Msg, e.Details)
+}
+
+func statusCode(err error) codes.Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return status.Code(err)
+}
+
+// IsTransient returns true if err is likely to be resolved by retrying.
+// Unavailable is returned when coild is not running, e.g. during its restart.
+func IsTransient(err error) bool {
+	return statusCode(err) == codes.Unavailable
+}
+
+// IsAmbiguous returns true if NewIP failing with err may have been committed by coild.
+func IsAmbiguous(err error) bool {
+	switch statusCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
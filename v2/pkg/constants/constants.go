@@ -3,7 +3,80 @@ package constants
 // annotation keys
 const (
 	AnnPool         = "coil.cybozu.com/pool"
+	AnnPoolSelector = "coil.cybozu.com/pool-selector"
+	AnnHandoffTo    = "coil.cybozu.com/handoff-to"
+	AnnBlock        = "coil.cybozu.com/block"
 	AnnEgressPrefix = "egress.coil.cybozu.com/"
+
+	AnnInternetEgress = "coil.cybozu.com/internet-egress"
+
+	// annotation of Pods to request extra addresses from the listed pools
+	AnnExtraPools = "coil.cybozu.com/extra-pools"
+
+	// annotation of Pods to spread addresses of the same owner over address blocks
+	AnnBlockAntiAffinity = "coil.cybozu.com/block-anti-affinity"
+
+	// annotations of Coil Pods to report component versions
+	AnnVersion     = "coil.cybozu.com/version"
+	AnnAPIVersions = "coil.cybozu.com/api-versions"
+	AnnCNIVersion  = "coil.cybozu.com/cni-version"
+
+	// annotations of address blocks of dead nodes
+	AnnReclaimable     = "coil.cybozu.com/reclaimable"
+	AnnReclaimApproved = "coil.cybozu.com/reclaim-approved"
+
+	// annotations of namespaces to migrate Pods to another pool
+	AnnRenumberTo     = "coil.cybozu.com/renumber-to"
+	AnnRenumberStatus = "coil.cybozu.com/renumber-status"
+
+	// annotation of namespaces to override the default route of Pods
+	AnnDefaultRoute = "coil.cybozu.com/default-route"
+
+	// annotation of quarantined address blocks to tell why
+	AnnQuarantineReason = "coil.cybozu.com/quarantine-reason"
+
+	// annotation of namespaces to cordon their dedicated pools when they are deleted
+	AnnCordonPoolOnDelete = "coil.cybozu.com/cordon-pool-on-delete"
+
+	// annotation of cordoned address pools to tell why
+	AnnCordonReason = "coil.cybozu.com/cordon-reason"
+
+	// annotation of paused address pools to tell why
+	AnnPauseReason = "coil.cybozu.com/pause-reason"
+
+	// annotation of Services to allocate addresses of their backing Pods
+	// from a routable pool so that the source addresses are preserved.
+	// The admission webhook copies it to the Pods.
+	AnnSourceIPPool = "coil.cybozu.com/source-ip-pool"
+
+	// annotation of PoolRequests to approve them
+	AnnApproved = "coil.cybozu.com/approved"
+
+	// annotation of address pools to record the supernet out of which they were curved
+	AnnSupernet = "coil.cybozu.com/supernet"
+
+	// annotations of nodes and canary Pods to record the canary checks of coild
+	AnnCanaryVersion = "coil.cybozu.com/canary-version"
+	AnnCanaryResult  = "coil.cybozu.com/canary-result"
+)
+
+// values of AnnCanaryResult
+const (
+	CanaryPassed = "passed"
+	CanaryFailed = "failed"
+)
+
+// values of AnnDefaultRoute other than a list of prefixes
+const (
+	DefaultRouteGateway = "gateway"
+	DefaultRouteNone    = "none"
+)
+
+// Pod condition types
+const (
+	// ConditionNetworkReady is the condition type of the readiness gate of Pods
+	// to wait for the network to be programmed.
+	ConditionNetworkReady = "coil.cybozu.com/network-ready"
 )
 
 // Label keys
@@ -12,6 +85,22 @@ const (
 	LabelNode     = "coil.cybozu.com/node"
 	LabelRequest  = "coil.cybozu.com/request"
 	LabelReserved = "coil.cybozu.com/reserved"
+	LabelCluster  = "coil.cybozu.com/cluster"
+
+	// label of address blocks whose routes cannot be added by coild
+	LabelQuarantined = "coil.cybozu.com/quarantined"
+
+	// label of address pools from which no more blocks are curved out
+	LabelCordoned = "coil.cybozu.com/cordoned"
+
+	// label of address pools from which no addresses are allocated during maintenance
+	LabelPaused = "coil.cybozu.com/paused"
+
+	// labels of address pools created for PoolRequests
+	LabelPoolRequestNamespace = "coil.cybozu.com/pool-request-namespace"
+	LabelPoolRequestName      = "coil.cybozu.com/pool-request-name"
+
+	LabelFederation = "coil.cybozu.com/federation"
 
 	LabelAppName      = "app.kubernetes.io/name"
 	LabelAppInstance  = "app.kubernetes.io/instance"
@@ -62,4 +151,7 @@ const MetricsNS = "coil"
 // Misc
 const (
 	DefaultPool = "default"
+
+	// CoilConfigName is the name of the CoilConfig read by Coil.
+	CoilConfigName = "default"
 )
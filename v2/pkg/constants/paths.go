@@ -3,3 +3,11 @@ package constants
 // DefaultSocketPath is the default UNIX domain socket filename
 // for gRPC between coil and coild.
 const DefaultSocketPath = "/run/coild.sock"
+
+// DefaultFreeQueueDir is the default directory where coil records
+// deleted containers whose addresses could not be freed by coild.
+const DefaultFreeQueueDir = "/run/coil/free-queue"
+
+// DefaultMACVLANStateDir is the default directory where coild records
+// containers attached to the uplink interface with macvlan.
+const DefaultMACVLANStateDir = "/run/coil/macvlan"
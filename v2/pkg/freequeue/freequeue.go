@@ -0,0 +1,126 @@
+// Package freequeue implements a node-local queue of containers
+// whose addresses are to be freed.
+//
+// coil records DEL requests that cannot be delivered to coild in the queue,
+// and coild replays them later.  Each entry is stored in a separate file,
+// so the queue can be written and read concurrently by different processes.
+package freequeue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const fileSuffix = ".json"
+
+// Entry represents a deleted container whose addresses are to be freed.
+type Entry struct {
+	ContainerID  string    `json:"container_id"`
+	Ifname       string    `json:"ifname"`
+	PodNamespace string    `json:"pod_namespace,omitempty"`
+	PodName      string    `json:"pod_name,omitempty"`
+	Queued       time.Time `json:"queued"`
+}
+
+func (e Entry) fileName() (string, error) {
+	if e.ContainerID == "" || e.Ifname == "" {
+		return "", errors.New("container ID and interface name are required")
+	}
+	// container IDs and interface names never contain colons.
+	if strings.ContainsAny(e.ContainerID+e.Ifname, "/:") || strings.HasPrefix(e.ContainerID, ".") {
+		return "", fmt.Errorf("invalid entry: %s %s", e.ContainerID, e.Ifname)
+	}
+	return e.ContainerID + ":" + e.Ifname + fileSuffix, nil
+}
+
+// Push adds an entry to the queue in `dir`.
+// Pushing the same container and interface twice results in a single entry.
+func Push(dir string, e Entry) error {
+	name, err := e.fileName()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file then rename it to make the update atomic.
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
+
+// List returns the entries in the queue in `dir`.
+// Broken entries are ignored.  If `dir` does not exist, List returns nil.
+func List(dir string) ([]Entry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), fileSuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			continue
+		}
+		if name, err := e.fileName(); err != nil || name != fi.Name() {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Remove removes an entry from the queue in `dir`.
+// Removing a non-existing entry is not an error.
+func Remove(dir string, e Entry) error {
+	name, err := e.fileName()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package freequeue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "queue")
+
+	entries, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Error("queue should be empty:", entries)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	e1 := Entry{ContainerID: "c1", Ifname: "eth0", Queued: now}
+	e2 := Entry{ContainerID: "c_2", Ifname: "eth0", Queued: now}
+	for _, e := range []Entry{e1, e2, e1} {
+		if err := Push(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Push(dir, Entry{ContainerID: "../c3", Ifname: "eth0"}); err == nil {
+		t.Error("invalid entry should be rejected")
+	}
+
+	// broken or unrelated files are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "broken:eth0.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("unexpected entries:", entries)
+	}
+	for _, e := range entries {
+		if !e.Queued.Equal(now) || e.Ifname != "eth0" {
+			t.Error("unexpected entry:", e)
+		}
+	}
+
+	if err := Remove(dir, e1); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(dir, e1); err != nil {
+		t.Error("removing a removed entry should succeed:", err)
+	}
+
+	entries, err = List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ContainerID != "c_2" {
+		t.Error("unexpected entries:", entries)
+	}
+}
@@ -0,0 +1,125 @@
+// Package handoff implements the handoff of the listening socket of coild
+// from a running instance to a new instance on the same node.
+//
+// The new instance connects to the handoff socket of the running instance.
+// The running instance then stops serving, and passes the file descriptor
+// of its listening socket to the new instance with SCM_RIGHTS.  Since the
+// socket keeps listening during the handoff, connections made in the
+// meantime wait in the backlog for the new instance instead of failing.
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrNoPeer is returned by Receive when no instance is running.
+var ErrNoPeer = errors.New("no coild to take over from")
+
+// handoffMessage is sent along with the file descriptor.
+var handoffMessage = []byte("handoff")
+
+// Server accepts handoff requests from new instances.
+type Server struct {
+	l *net.UnixListener
+}
+
+// Listen creates a Server at `path`.  An existing file at `path` is removed.
+func Listen(path string) (*Server, error) {
+	os.Remove(path)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the next instance re-creates the socket after taking over.
+	l.SetUnlinkOnClose(false)
+	return &Server{l: l}, nil
+}
+
+// Accept waits for a new instance to request a handoff.
+func (s *Server) Accept(ctx context.Context) (*Request, error) {
+	go func() {
+		<-ctx.Done()
+		s.l.SetDeadline(time.Now())
+	}()
+
+	conn, err := s.l.AcceptUnix()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return &Request{conn: conn}, nil
+}
+
+// Close closes the Server.
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// Request is a handoff request from a new instance.
+type Request struct {
+	conn *net.UnixConn
+}
+
+// Complete passes the listening socket `f` to the new instance.
+func (r *Request) Complete(f *os.File) error {
+	defer r.conn.Close()
+
+	_, _, err := r.conn.WriteMsgUnix(handoffMessage, syscall.UnixRights(int(f.Fd())), nil)
+	return err
+}
+
+// Receive takes over the listening socket from the instance serving the
+// handoff socket at `path`.  If no instance serves it, ErrNoPeer is returned.
+//
+// The running instance stops serving before passing the socket, which may
+// take up to `timeout`.
+func Receive(path string, timeout time.Duration) (net.Listener, error) {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, ErrNoPeer
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, len(handoffMessage))
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive the socket: %w", err)
+	}
+	if string(buf[:n]) != string(handoffMessage) {
+		return nil, errors.New("invalid handoff message")
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse control message: %w", err)
+	}
+	if len(msgs) != 1 {
+		return nil, errors.New("no socket was passed")
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse control message: %w", err)
+	}
+	if len(fds) != 1 {
+		return nil, errors.New("no socket was passed")
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "coild-listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
@@ -0,0 +1,108 @@
+package handoff
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandoff(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	handoffPath := filepath.Join(dir, "handoff.sock")
+	socketPath := filepath.Join(dir, "coild.sock")
+
+	if _, err := Receive(handoffPath, time.Second); !errors.Is(err, ErrNoPeer) {
+		t.Fatal("Receive should return ErrNoPeer without the socket:", err)
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetUnlinkOnClose(false)
+	f, err := l.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s, err := Listen(handoffPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		req, err := s.Accept(context.Background())
+		if err != nil {
+			errCh <- err
+			return
+		}
+		// stop serving before handing off like coild does.
+		l.Close()
+		errCh <- req.Complete(f)
+	}()
+
+	nl, err := Receive(handoffPath, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nl.Close()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// the socket should be served by the new listener at the same path.
+	go func() {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		errCh <- err
+	}()
+	conn, err := nl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Error("unexpected data:", string(buf))
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	// the handoff socket left by the closed server is stale.
+	if _, err := Receive(handoffPath, time.Second); !errors.Is(err, ErrNoPeer) {
+		t.Error("Receive should return ErrNoPeer for a stale socket:", err)
+	}
+}
+
+func TestAcceptCancel(t *testing.T) {
+	t.Parallel()
+
+	s, err := Listen(filepath.Join(t.TempDir(), "handoff.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.Accept(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Accept should return the error of the context:", err)
+	}
+}
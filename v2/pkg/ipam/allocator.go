@@ -2,19 +2,40 @@ package ipam
 
 import (
 	"fmt"
+	"math/big"
 	"net"
 
 	"github.com/bits-and-blooms/bitset"
 	"github.com/cybozu-go/netutil"
 )
 
+// maxAllocatorBits limits the number of addresses allocated from a block.
+// Blocks of delegated IPv6 prefixes, such as /64, are too large to track
+// every address, so only the first 2^maxAllocatorBits addresses are used.
+const maxAllocatorBits = 16
+
+// BlockCapacity returns the number of addresses that can be allocated from
+// a block of 2^sizeBits addresses.
+func BlockCapacity(sizeBits int) int {
+	if sizeBits > maxAllocatorBits {
+		// the first address of a prefix is the Subnet-Router anycast address
+		return 1<<maxAllocatorBits - 1
+	}
+	return 1 << sizeBits
+}
+
 type allocator struct {
-	ipv4  *net.IPNet
-	ipv6  *net.IPNet
-	usage *bitset.BitSet
+	ipv4        *net.IPNet
+	ipv6        *net.IPNet
+	usage       *bitset.BitSet
+	quarantined *bitset.BitSet
+
+	// first is the lowest index that can be allocated.
+	first uint
 }
 
 func newAllocator(ipv4, ipv6 *string) (a allocator) {
+	var sizeBits int
 	if ipv4 != nil {
 		ip, n, _ := net.ParseCIDR(*ipv4)
 		if ip.To4() == nil {
@@ -22,55 +43,80 @@ func newAllocator(ipv4, ipv6 *string) (a allocator) {
 		}
 		a.ipv4 = n
 		ones, bits := n.Mask.Size()
-		a.usage = bitset.New(uint(1) << (bits - ones))
+		sizeBits = bits - ones
 	}
 	if ipv6 != nil {
 		_, n, _ := net.ParseCIDR(*ipv6)
 		a.ipv6 = n
-		if a.usage == nil {
+		if a.ipv4 == nil {
 			ones, bits := n.Mask.Size()
-			a.usage = bitset.New(uint(1) << (bits - ones))
+			sizeBits = bits - ones
 		}
 	}
+	if sizeBits > maxAllocatorBits {
+		sizeBits = maxAllocatorBits
+		a.first = 1
+	}
+	a.usage = bitset.New(uint(1) << sizeBits)
+	a.quarantined = bitset.New(a.usage.Len())
 	return
 }
 
 func (a allocator) isFull() bool {
-	return a.usage.All()
+	_, ok := a.usage.Union(a.quarantined).NextClear(a.first)
+	return !ok
 }
 
+// isEmpty returns true if no addresses are used.  Quarantined addresses are not counted.
 func (a allocator) isEmpty() bool {
 	return a.usage.None()
 }
 
 func (a allocator) fill() {
-	for i := uint(0); i < a.usage.Len(); i++ {
+	for i := a.first; i < a.usage.Len(); i++ {
 		a.usage.Set(i)
 	}
 }
 
-func (a allocator) register(ipv4, ipv6 net.IP) (uint, bool) {
+// index returns the index of the address in the block.
+// Addresses beyond the allocatable range of a large block are not indexed.
+func (a allocator) index(ipv4, ipv6 net.IP) (uint, bool) {
 	if a.ipv4 != nil && a.ipv4.Contains(ipv4) {
-		offset := netutil.IPDiff(a.ipv4.IP, ipv4)
-		if offset < 0 {
-			panic(fmt.Sprintf("ip: %v, base: %v, offset: %v", ipv4, a.ipv4.IP, offset))
-		}
-		a.usage.Set(uint(offset))
-		return uint(offset), true
+		return a.offset(a.ipv4, ipv4)
 	}
 	if a.ipv6 != nil && a.ipv6.Contains(ipv6) {
-		offset := netutil.IPDiff(a.ipv6.IP, ipv6)
-		if offset < 0 {
-			panic(fmt.Sprintf("ip: %v, base: %v, offset: %v", ipv6, a.ipv6.IP, offset))
-		}
-		a.usage.Set(uint(offset))
-		return uint(offset), true
+		return a.offset(a.ipv6, ipv6)
 	}
 	return 0, false
 }
 
+func (a allocator) offset(n *net.IPNet, ip net.IP) (uint, bool) {
+	base := n.IP
+	if v4 := ip.To4(); v4 != nil {
+		base, ip = base.To4(), v4
+	}
+	// the offset in a delegated prefix may not fit in int64
+	offset := new(big.Int).Sub(new(big.Int).SetBytes(ip), new(big.Int).SetBytes(base))
+	if offset.Sign() < 0 {
+		panic(fmt.Sprintf("ip: %v, base: %v, offset: %v", ip, n.IP, offset))
+	}
+	if !offset.IsUint64() || offset.Uint64() >= uint64(a.usage.Len()) {
+		return 0, false
+	}
+	return uint(offset.Uint64()), true
+}
+
+func (a allocator) register(ipv4, ipv6 net.IP) (uint, bool) {
+	idx, ok := a.index(ipv4, ipv6)
+	if !ok {
+		return 0, false
+	}
+	a.usage.Set(idx)
+	return idx, true
+}
+
 func (a allocator) allocate() (ipv4, ipv6 net.IP, idx uint, ok bool) {
-	idx, ok = a.usage.NextClear(0)
+	idx, ok = a.usage.Union(a.quarantined).NextClear(a.first)
 	if !ok {
 		return nil, nil, 0, false
 	}
@@ -88,3 +134,24 @@ func (a allocator) allocate() (ipv4, ipv6 net.IP, idx uint, ok bool) {
 func (a allocator) free(idx uint) {
 	a.usage.Clear(idx)
 }
+
+// quarantine marks the address at `idx` as unusable.
+// A quarantined address is never allocated.
+func (a allocator) quarantine(idx uint) {
+	a.quarantined.Set(idx)
+}
+
+// setQuarantine replaces the quarantined addresses with `ips`.
+// Addresses out of the block are ignored.
+func (a allocator) setQuarantine(ips []net.IP) {
+	a.quarantined.ClearAll()
+	for _, ip := range ips {
+		if idx, ok := a.index(ip, ip); ok {
+			a.quarantined.Set(idx)
+		}
+	}
+}
+
+func (a allocator) isQuarantined(idx uint) bool {
+	return a.quarantined.Test(idx)
+}
@@ -10,6 +10,8 @@ func TestAllocator(t *testing.T) {
 	t.Run("v6", testAllocatorV6)
 	t.Run("dual", testAllocatorDual)
 	t.Run("fill", testAllocatorFill)
+	t.Run("quarantine", testAllocatorQuarantine)
+	t.Run("delegated", testAllocatorDelegated)
 }
 
 func testAllocatorV4(t *testing.T) {
@@ -255,3 +257,90 @@ func testAllocatorFill(t *testing.T) {
 		t.Error("fill changed the length")
 	}
 }
+
+func testAllocatorQuarantine(t *testing.T) {
+	t.Parallel()
+
+	ipv4 := "10.2.3.0/30"
+	a := newAllocator(&ipv4, nil)
+
+	a.quarantine(0)
+	if !a.isEmpty() {
+		t.Error("quarantined addresses should not be counted as used")
+	}
+	if !a.isQuarantined(0) || a.isQuarantined(1) {
+		t.Error("isQuarantined returned a wrong result")
+	}
+
+	ip, _, idx, ok := a.allocate()
+	if !ok {
+		t.Fatal("should allocate an address")
+	}
+	if idx != 1 || !ip.Equal(net.ParseIP("10.2.3.1")) {
+		t.Error("should skip the quarantined address:", ip)
+	}
+	if a.isEmpty() {
+		t.Error("should not be empty")
+	}
+
+	a.free(1)
+	if !a.isEmpty() {
+		t.Error("should be empty")
+	}
+	if !a.isQuarantined(0) {
+		t.Error("quarantine should be kept")
+	}
+
+	a.quarantine(1)
+	a.quarantine(2)
+	a.quarantine(3)
+	if !a.isFull() {
+		t.Error("should be full")
+	}
+
+	a.setQuarantine([]net.IP{net.ParseIP("10.2.3.2"), net.ParseIP("192.168.0.1")})
+	if a.isFull() {
+		t.Error("should not be full")
+	}
+	for i := uint(0); i < 4; i++ {
+		if a.isQuarantined(i) != (i == 2) {
+			t.Error("unexpected quarantine for", i)
+		}
+	}
+	if _, _, idx, _ := a.allocate(); idx != 0 {
+		t.Error("idx should be 0, but", idx)
+	}
+}
+
+func testAllocatorDelegated(t *testing.T) {
+	t.Parallel()
+
+	ipv6 := "2001:db8:0:3::/64"
+	a := newAllocator(nil, &ipv6)
+	if a.usage.Len() != 1<<maxAllocatorBits {
+		t.Error("unexpected size:", a.usage.Len())
+	}
+
+	ip1, ip2, idx, ok := a.allocate()
+	if !ok {
+		t.Fatal("should allocate addresses")
+	}
+	if ip1 != nil || !ip2.Equal(net.ParseIP("2001:db8:0:3::1")) || idx != 1 {
+		t.Error("the Subnet-Router anycast address should be skipped:", ip1, ip2, idx)
+	}
+
+	if idx, ok := a.register(nil, net.ParseIP("2001:db8:0:3::ffff")); !ok || idx != 0xffff {
+		t.Error("should register an address in the range:", idx, ok)
+	}
+	if _, ok := a.register(nil, net.ParseIP("2001:db8:0:3:8000::1")); ok {
+		t.Error("should ignore an address beyond the range")
+	}
+
+	a.fill()
+	if !a.isFull() {
+		t.Error("should be full")
+	}
+	if BlockCapacity(64) != 1<<maxAllocatorBits-1 || BlockCapacity(5) != 32 {
+		t.Error("unexpected capacities:", BlockCapacity(64), BlockCapacity(5))
+	}
+}
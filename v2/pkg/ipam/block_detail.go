@@ -0,0 +1,202 @@
+package ipam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrBlockNotFound is returned by FindBlock when no AddressBlock matches.
+var ErrBlockNotFound = errors.New("address block not found")
+
+// BlockAddress represents the addresses in an AddressBlock assigned to a Pod.
+type BlockAddress struct {
+	IPs       []string `json:"ips"`
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+}
+
+// BlockDetail represents an AddressBlock and the addresses allocated from it.
+type BlockDetail struct {
+	Name             string         `json:"name"`
+	Pool             string         `json:"pool"`
+	Node             string         `json:"node"`
+	IPv4             string         `json:"ipv4,omitempty"`
+	IPv6             string         `json:"ipv6,omitempty"`
+	Acquired         time.Time      `json:"acquired"`
+	Quarantined      bool           `json:"quarantined,omitempty"`
+	QuarantineReason string         `json:"quarantine_reason,omitempty"`
+	Capacity         int            `json:"capacity"`
+	Addresses        []BlockAddress `json:"addresses"`
+	Excluded         []string       `json:"excluded,omitempty"`
+	Free             int            `json:"free"`
+}
+
+// FindBlock returns the AddressBlock named `nameOrSubnet`, or the one whose
+// IPv4 or IPv6 subnet is `nameOrSubnet`.
+func FindBlock(ctx context.Context, r client.Reader, nameOrSubnet string) (*coilv2.AddressBlock, error) {
+	_, subnet, err := net.ParseCIDR(nameOrSubnet)
+	if err != nil {
+		b := &coilv2.AddressBlock{}
+		err := r.Get(ctx, client.ObjectKey{Name: nameOrSubnet}, b)
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrBlockNotFound, nameOrSubnet)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get AddressBlock %s: %w", nameOrSubnet, err)
+		}
+		return b, nil
+	}
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.List(ctx, blocks); err != nil {
+		return nil, fmt.Errorf("failed to list AddressBlock: %w", err)
+	}
+	key := subnet.String()
+	for i := range blocks.Items {
+		b := &blocks.Items[i]
+		if (b.IPv4 != nil && *b.IPv4 == key) || (b.IPv6 != nil && *b.IPv6 == key) {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrBlockNotFound, nameOrSubnet)
+}
+
+// InspectBlock returns the detail of `b`.
+//
+// As in ListBlockUsage, the allocated addresses are computed from the IP
+// addresses of Pods on the node of the block.  Addresses in the quarantine
+// list of the pool are excluded from the free addresses.
+func InspectBlock(ctx context.Context, r client.Reader, b *coilv2.AddressBlock) (*BlockDetail, error) {
+	d := &BlockDetail{
+		Name:             b.Name,
+		Pool:             b.Labels[constants.LabelPool],
+		Node:             b.Labels[constants.LabelNode],
+		Acquired:         b.CreationTimestamp.Time,
+		Quarantined:      b.Labels[constants.LabelQuarantined] == "true",
+		QuarantineReason: b.Annotations[constants.AnnQuarantineReason],
+		Addresses:        []BlockAddress{},
+	}
+
+	var nets []*net.IPNet
+	if b.IPv4 != nil {
+		d.IPv4 = *b.IPv4
+		_, n, err := net.ParseCIDR(*b.IPv4)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPv4 subnet of %s: %w", b.Name, err)
+		}
+		nets = append(nets, n)
+	}
+	if b.IPv6 != nil {
+		d.IPv6 = *b.IPv6
+		_, n, err := net.ParseCIDR(*b.IPv6)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPv6 subnet of %s: %w", b.Name, err)
+		}
+		nets = append(nets, n)
+	}
+	if len(nets) == 0 {
+		return nil, fmt.Errorf("AddressBlock %s has no subnet", b.Name)
+	}
+	ones, bits := nets[0].Mask.Size()
+	d.Capacity = BlockCapacity(bits - ones)
+
+	// In a dual-stack block, the IPv4 and IPv6 addresses at the same
+	// offset share an index, so the indices in use are counted.
+	used := make(map[uint64]bool)
+	index := func(ip net.IP) (uint64, bool) {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return ipOffset(n, ip), true
+			}
+		}
+		return 0, false
+	}
+
+	ap := &coilv2.AddressPool{}
+	err := r.Get(ctx, client.ObjectKey{Name: d.Pool}, ap)
+	switch {
+	case err == nil:
+		for _, a := range ap.Spec.Quarantine {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				continue
+			}
+			if idx, ok := index(ip); ok {
+				d.Excluded = append(d.Excluded, ip.String())
+				used[idx] = true
+			}
+		}
+	case !apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("failed to get AddressPool %s: %w", d.Pool, err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.MatchingFields{"spec.nodeName": d.Node}); err != nil {
+		return nil, fmt.Errorf("failed to list Pod: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != d.Node || pod.Spec.HostNetwork {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		var ips []string
+		for _, podIP := range pod.Status.PodIPs {
+			ip := net.ParseIP(podIP.IP)
+			if ip == nil {
+				continue
+			}
+			if idx, ok := index(ip); ok {
+				ips = append(ips, ip.String())
+				used[idx] = true
+			}
+		}
+		if len(ips) == 0 {
+			continue
+		}
+		d.Addresses = append(d.Addresses, BlockAddress{IPs: ips, Namespace: pod.Namespace, Pod: pod.Name})
+	}
+	sort.Slice(d.Addresses, func(i, j int) bool {
+		return compareIPs(d.Addresses[i].IPs[0], d.Addresses[j].IPs[0]) < 0
+	})
+
+	d.Free = d.Capacity - len(used)
+	return d, nil
+}
+
+// ipOffset returns the offset of `ip` from the network address of `n`.
+// Blocks are small enough for the offset to fit in uint64.
+func ipOffset(n *net.IPNet, ip net.IP) uint64 {
+	base := n.IP.To16()
+	ip = ip.To16()
+	var offset uint64
+	for i := 8; i < 16; i++ {
+		offset = offset<<8 | uint64(ip[i]-base[i])
+	}
+	return offset
+}
+
+// compareIPs compares two IP addresses of the same family numerically.
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a).To16(), net.ParseIP(b).To16()
+	for i := range ipA {
+		switch {
+		case ipA[i] < ipB[i]:
+			return -1
+		case ipA[i] > ipB[i]:
+			return 1
+		}
+	}
+	return 0
+}
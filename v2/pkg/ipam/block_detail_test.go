@@ -0,0 +1,113 @@
+package ipam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInspectBlock(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ipv4 := "10.2.0.0/29"
+	ipv6 := "fd02::/125"
+
+	pool := &coilv2.AddressPool{}
+	pool.Name = "default"
+	pool.Spec.BlockSizeBits = 3
+	pool.Spec.Quarantine = []string{"10.2.0.5", "fd02::5", "10.2.1.1"}
+
+	block := &coilv2.AddressBlock{}
+	block.Name = "default-0"
+	block.CreationTimestamp = metav1.NewTime(created)
+	block.Labels = map[string]string{
+		constants.LabelPool: "default",
+		constants.LabelNode: "node1",
+	}
+	block.IPv4 = &ipv4
+	block.IPv6 = &ipv6
+
+	newPod := func(name, node string, phase corev1.PodPhase, ips ...string) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = name
+		pod.Spec.NodeName = node
+		pod.Status.Phase = phase
+		for _, ip := range ips {
+			pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+		}
+		return pod
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		pool,
+		block,
+		newPod("pod1", "node1", corev1.PodRunning, "10.2.0.3", "fd02::3"),
+		newPod("pod2", "node1", corev1.PodPending, "10.2.0.1", "fd02::1"),
+		newPod("pod3", "node1", corev1.PodSucceeded, "10.2.0.2", "fd02::2"),
+		newPod("pod4", "node2", corev1.PodRunning, "10.2.0.4", "fd02::4"),
+		newPod("pod5", "node1", corev1.PodRunning, "10.2.0.8", "fd02::8"),
+	).Build()
+
+	ctx := context.Background()
+	for _, key := range []string{"default-0", "10.2.0.0/29", "fd02::/125"} {
+		b, err := FindBlock(ctx, cl, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Name != "default-0" {
+			t.Error("unexpected block for", key, b.Name)
+		}
+	}
+	for _, key := range []string{"default-1", "10.2.0.8/29"} {
+		if _, err := FindBlock(ctx, cl, key); !errors.Is(err, ErrBlockNotFound) {
+			t.Error("block should not be found for", key, err)
+		}
+	}
+
+	d, err := InspectBlock(ctx, cl, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &BlockDetail{
+		Name:     "default-0",
+		Pool:     "default",
+		Node:     "node1",
+		IPv4:     ipv4,
+		IPv6:     ipv6,
+		Acquired: created,
+		Capacity: 8,
+		Addresses: []BlockAddress{
+			{IPs: []string{"10.2.0.1", "fd02::1"}, Namespace: "ns1", Pod: "pod2"},
+			{IPs: []string{"10.2.0.3", "fd02::3"}, Namespace: "ns1", Pod: "pod1"},
+		},
+		Excluded: []string{"10.2.0.5", "fd02::5"},
+		Free:     5,
+	}
+	if !d.Acquired.Equal(created) {
+		t.Error("unexpected acquired time:", d.Acquired)
+	}
+	d.Acquired = created
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("unexpected detail: %+v", d)
+	}
+}
@@ -0,0 +1,81 @@
+package ipam
+
+import (
+	"context"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const blockMetricsTimeout = 10 * time.Second
+
+var (
+	blockCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "controller", "block_capacity"),
+		"the number of addresses in the address block",
+		[]string{"pool", "node", "block"}, nil,
+	)
+
+	blockAllocatedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "controller", "block_allocated"),
+		"the number of addresses used by Pods in the address block",
+		[]string{"pool", "node", "block"}, nil,
+	)
+
+	blockAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "controller", "block_age_seconds"),
+		"the elapsed time since the address block was created",
+		[]string{"pool", "node", "block"}, nil,
+	)
+)
+
+// NewBlockCollector creates a prometheus.Collector that exports
+// the utilization of every AddressBlock in the cluster.
+//
+// The number of allocated addresses is computed from the IP addresses of
+// Pods, so the metrics are available even if coild on the node is down.
+func NewBlockCollector(r client.Reader, log logr.Logger) prometheus.Collector {
+	return &blockCollector{
+		reader: r,
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+type blockCollector struct {
+	reader client.Reader
+	log    logr.Logger
+	now    func() time.Time
+}
+
+// Describe implements prometheus.Collector.
+func (c *blockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- blockCapacityDesc
+	ch <- blockAllocatedDesc
+	ch <- blockAgeDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *blockCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), blockMetricsTimeout)
+	defer cancel()
+
+	usages, err := ListBlockUsage(ctx, c.reader)
+	if err != nil {
+		c.log.Error(err, "failed to compute block usage")
+		return
+	}
+
+	now := c.now()
+	for _, u := range usages {
+		ch <- prometheus.MustNewConstMetric(blockCapacityDesc, prometheus.GaugeValue,
+			float64(u.Capacity), u.Pool, u.Node, u.Block.Name)
+		ch <- prometheus.MustNewConstMetric(blockAllocatedDesc, prometheus.GaugeValue,
+			float64(u.Allocated), u.Pool, u.Node, u.Block.Name)
+		ch <- prometheus.MustNewConstMetric(blockAgeDesc, prometheus.GaugeValue,
+			now.Sub(u.Block.CreationTimestamp.Time).Seconds(), u.Pool, u.Node, u.Block.Name)
+	}
+}
@@ -0,0 +1,86 @@
+package ipam
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBlockCollector(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ipv4 := "10.2.0.0/29"
+	ipv6 := "fd02::/125"
+
+	pool := &coilv2.AddressPool{}
+	pool.Name = "default"
+	pool.Spec.BlockSizeBits = 3
+
+	block := &coilv2.AddressBlock{}
+	block.Name = "default-0"
+	block.CreationTimestamp = metav1.NewTime(created)
+	block.Labels = map[string]string{
+		constants.LabelPool: "default",
+		constants.LabelNode: "node1",
+	}
+	block.IPv4 = &ipv4
+	block.IPv6 = &ipv6
+
+	newPod := func(name, node string, phase corev1.PodPhase, ips ...string) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = name
+		pod.Spec.NodeName = node
+		pod.Status.Phase = phase
+		for _, ip := range ips {
+			pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+		}
+		return pod
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		pool,
+		block,
+		newPod("pod1", "node1", corev1.PodRunning, "10.2.0.1", "fd02::1"),
+		newPod("pod2", "node1", corev1.PodPending, "10.2.0.2", "fd02::2"),
+		newPod("pod3", "node1", corev1.PodSucceeded, "10.2.0.3", "fd02::3"),
+		newPod("pod4", "node2", corev1.PodRunning, "10.2.0.4", "fd02::4"),
+	).Build()
+
+	c := NewBlockCollector(cl, logr.Discard()).(*blockCollector)
+	c.now = func() time.Time { return created.Add(90 * time.Second) }
+
+	expected := `
+# HELP coil_controller_block_age_seconds the elapsed time since the address block was created
+# TYPE coil_controller_block_age_seconds gauge
+coil_controller_block_age_seconds{block="default-0",node="node1",pool="default"} 90
+# HELP coil_controller_block_allocated the number of addresses used by Pods in the address block
+# TYPE coil_controller_block_allocated gauge
+coil_controller_block_allocated{block="default-0",node="node1",pool="default"} 2
+# HELP coil_controller_block_capacity the number of addresses in the address block
+# TYPE coil_controller_block_capacity gauge
+coil_controller_block_capacity{block="default-0",node="node1",pool="default"} 8
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
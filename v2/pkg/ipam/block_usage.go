@@ -0,0 +1,105 @@
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+// BlockUsage represents the utilization of an AddressBlock.
+type BlockUsage struct {
+	Block     *coilv2.AddressBlock
+	Pool      string
+	Node      string
+	Capacity  int
+	Allocated int
+}
+
+// ListBlockUsage returns the utilization of every AddressBlock in the cluster.
+//
+// The number of allocated addresses is computed from the IP addresses of
+// Pods on the node of each block.  Blocks of unknown pools are omitted.
+func ListBlockUsage(ctx context.Context, r client.Reader) ([]BlockUsage, error) {
+	pools := &coilv2.AddressPoolList{}
+	if err := r.List(ctx, pools); err != nil {
+		return nil, fmt.Errorf("failed to list AddressPool: %w", err)
+	}
+	blockSizes := make(map[string]int32)
+	for _, p := range pools.Items {
+		blockSizes[p.Name] = p.Spec.BlockSizeBits
+	}
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.List(ctx, blocks); err != nil {
+		return nil, fmt.Errorf("failed to list AddressBlock: %w", err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods); err != nil {
+		return nil, fmt.Errorf("failed to list Pod: %w", err)
+	}
+	podIPs := make(map[string][]net.IP)
+	for _, pod := range pods.Items {
+		if pod.Spec.HostNetwork {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			ip := net.ParseIP(podIP.IP)
+			if ip == nil {
+				continue
+			}
+			podIPs[pod.Spec.NodeName] = append(podIPs[pod.Spec.NodeName], ip)
+		}
+	}
+
+	usages := make([]BlockUsage, 0, len(blocks.Items))
+	for i := range blocks.Items {
+		b := &blocks.Items[i]
+		poolName := b.Labels[constants.LabelPool]
+		nodeName := b.Labels[constants.LabelNode]
+		bits, ok := blockSizes[poolName]
+		if !ok {
+			continue
+		}
+
+		// In a dual-stack block, an index is shared by the IPv4 and IPv6
+		// addresses of a Pod, so counting one of the families is enough.
+		var blockNet *net.IPNet
+		if b.IPv4 != nil {
+			_, blockNet, _ = net.ParseCIDR(*b.IPv4)
+		} else if b.IPv6 != nil {
+			_, blockNet, _ = net.ParseCIDR(*b.IPv6)
+		}
+		if blockNet == nil {
+			continue
+		}
+
+		var allocated int
+		for _, ip := range podIPs[nodeName] {
+			if blockNet.Contains(ip) {
+				allocated++
+			}
+		}
+
+		usages = append(usages, BlockUsage{
+			Block:     b,
+			Pool:      poolName,
+			Node:      nodeName,
+			Capacity:  BlockCapacity(int(bits)),
+			Allocated: allocated,
+		})
+	}
+	return usages, nil
+}
@@ -0,0 +1,106 @@
+package ipam
+
+import (
+	"errors"
+	"math/big"
+	"net"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+)
+
+// ErrNoSpace is returned by CarveSubnet when no supernet has room for the subnet.
+var ErrNoSpace = errors.New("no space left in supernets")
+
+// CarveSubnet finds the first subnet with `prefixLen` in `supernets` that
+// overlaps none of `used`.  It returns the subnet and the supernet containing it.
+//
+// Only the supernets of the same address family as `ipv6` are considered.
+// If none has room for the subnet, this returns ErrNoSpace.
+func CarveSubnet(supernets, used []*net.IPNet, prefixLen int, ipv6 bool) (*net.IPNet, *net.IPNet, error) {
+	for _, super := range supernets {
+		if (super.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		if n := carveFrom(super, used, prefixLen); n != nil {
+			return n, super, nil
+		}
+	}
+	return nil, nil, ErrNoSpace
+}
+
+// PoolSubnets returns the subnets of `pools` to be passed to CarveSubnet as `used`.
+// Invalid subnets are ignored.
+func PoolSubnets(pools []coilv2.AddressPool) []*net.IPNet {
+	var used []*net.IPNet
+	for _, p := range pools {
+		for _, ss := range p.Spec.Subnets {
+			for _, cidr := range []*string{ss.IPv4, ss.IPv6} {
+				if cidr == nil {
+					continue
+				}
+				if _, n, err := net.ParseCIDR(*cidr); err == nil {
+					used = append(used, n)
+				}
+			}
+		}
+	}
+	return used
+}
+
+func carveFrom(super *net.IPNet, used []*net.IPNet, prefixLen int) *net.IPNet {
+	ones, bits := super.Mask.Size()
+	if prefixLen < ones || prefixLen > bits {
+		return nil
+	}
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLen))
+	start := ipToInt(super.IP)
+	end := new(big.Int).Add(start, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+	mask := net.CIDRMask(prefixLen, bits)
+
+	cand := new(big.Int).Set(start)
+	for {
+		candEnd := new(big.Int).Add(cand, size)
+		if candEnd.Cmp(end) > 0 {
+			return nil
+		}
+		n := &net.IPNet{IP: intToIP(cand, bits), Mask: mask}
+
+		var overlapped *net.IPNet
+		for _, u := range used {
+			if subnetsOverlap(u, n) {
+				overlapped = u
+				break
+			}
+		}
+		if overlapped == nil {
+			return n
+		}
+
+		// skip to the first aligned candidate after the overlapped subnet.
+		uOnes, uBits := overlapped.Mask.Size()
+		uEnd := new(big.Int).Add(ipToInt(overlapped.IP.Mask(overlapped.Mask)), new(big.Int).Lsh(big.NewInt(1), uint(uBits-uOnes)))
+		if uEnd.Cmp(candEnd) < 0 {
+			uEnd = candEnd
+		}
+		rem := new(big.Int).Mod(new(big.Int).Sub(uEnd, start), size)
+		if rem.Sign() != 0 {
+			uEnd.Add(uEnd, new(big.Int).Sub(size, rem))
+		}
+		cand = uEnd
+	}
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func intToIP(n *big.Int, bits int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, bits/8)
+	copy(ip[len(ip)-len(b):], b)
+	return ip
+}
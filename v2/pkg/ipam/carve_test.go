@@ -0,0 +1,61 @@
+package ipam
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func parseNets(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func TestCarveSubnet(t *testing.T) {
+	t.Parallel()
+
+	supernets := parseNets(t, "10.0.0.0/16", "10.1.0.0/16", "fd00::/48")
+
+	testCases := []struct {
+		name      string
+		used      []string
+		prefixLen int
+		ipv6      bool
+		subnet    string
+		supernet  string
+	}{
+		{"empty", nil, 20, false, "10.0.0.0/20", "10.0.0.0/16"},
+		{"skip used", []string{"10.0.0.0/24"}, 20, false, "10.0.16.0/20", "10.0.0.0/16"},
+		{"skip larger", []string{"10.0.0.0/18", "10.0.64.0/24"}, 22, false, "10.0.68.0/22", "10.0.0.0/16"},
+		{"outside used", []string{"192.168.0.0/16", "10.0.0.0/8"}, 24, false, "", ""},
+		{"next supernet", []string{"10.0.0.0/17", "10.0.128.0/17"}, 24, false, "10.1.0.0/24", "10.1.0.0/16"},
+		{"too large", nil, 15, false, "", ""},
+		{"ipv6", []string{"fd00::/64"}, 64, true, "fd00:0:0:1::/64", "fd00::/48"},
+		{"ipv6 after unaligned", []string{"fd00::/56", "fd00:0:0:100::/60"}, 56, true, "fd00:0:0:200::/56", "fd00::/48"},
+	}
+
+	for _, tc := range testCases {
+		subnet, super, err := CarveSubnet(supernets, parseNets(t, tc.used...), tc.prefixLen, tc.ipv6)
+		if tc.subnet == "" {
+			if !errors.Is(err, ErrNoSpace) {
+				t.Errorf("%s: expected ErrNoSpace, got %v, %v", tc.name, subnet, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if subnet.String() != tc.subnet || super.String() != tc.supernet {
+			t.Errorf("%s: unexpected result: %s in %s", tc.name, subnet, super)
+		}
+	}
+}
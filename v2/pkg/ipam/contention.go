@@ -0,0 +1,226 @@
+package ipam
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Operations that update AddressBlocks or AddressPools optimistically.
+const (
+	OpCreateBlock     = "create_block"
+	OpDeleteBlock     = "delete_block"
+	OpHandoffBlock    = "handoff_block"
+	OpQuarantineBlock = "quarantine_block"
+	OpAddQuarantine   = "add_quarantine"
+)
+
+var (
+	updateConflicts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "ipam",
+			Name:      "update_conflicts_total",
+			Help:      "the number of conflicts of optimistic updates of address blocks and pools",
+		},
+		[]string{"pool", "operation"},
+	)
+
+	lockWaitSeconds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "ipam",
+			Name:      "lock_wait_seconds_total",
+			Help:      "the total time allocations and frees waited for other operations on the pool",
+		},
+		[]string{"pool"},
+	)
+
+	blockRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "ipam",
+			Name:      "block_requests_total",
+			Help:      "the number of address blocks acquired by this node",
+		},
+		[]string{"pool"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(updateConflicts)
+	metrics.Registry.MustRegister(lockWaitSeconds)
+	metrics.Registry.MustRegister(blockRequests)
+}
+
+// PoolContention is the contention statistics of a pool in this process
+// since it started.
+type PoolContention struct {
+	Pool          string
+	Allocations   uint64
+	Frees         uint64
+	BlockRequests uint64
+
+	// BlockRequestWait is the total time spent acquiring blocks.
+	BlockRequestWait time.Duration
+
+	// LockWait is the total time allocations and frees waited for other
+	// operations on the pool, including block requests.
+	LockWait time.Duration
+
+	// Conflicts is the number of conflicts by operation.
+	Conflicts map[string]uint64
+
+	// Blocks are the statistics of the blocks of the pool sorted by name.
+	Blocks []BlockContention
+}
+
+// TotalConflicts returns the sum of Conflicts.
+func (c PoolContention) TotalConflicts() uint64 {
+	var total uint64
+	for _, n := range c.Conflicts {
+		total += n
+	}
+	return total
+}
+
+// BlockContention is the contention statistics of an address block.
+type BlockContention struct {
+	Block       string
+	Allocations uint64
+	Frees       uint64
+	Conflicts   uint64
+}
+
+type contentionTracker struct {
+	mu     sync.Mutex
+	pools  map[string]*PoolContention
+	blocks map[string]map[string]*BlockContention
+}
+
+var contention = &contentionTracker{
+	pools:  make(map[string]*PoolContention),
+	blocks: make(map[string]map[string]*BlockContention),
+}
+
+// ContentionReport returns the contention statistics of the pools in this
+// process sorted by name.
+func ContentionReport() []PoolContention {
+	return contention.report()
+}
+
+// get returns the statistics of `pool` and `block`.  block is nil if `block` is empty.
+// c.mu must be held.
+func (c *contentionTracker) get(pool, block string) (*PoolContention, *BlockContention) {
+	pc, ok := c.pools[pool]
+	if !ok {
+		pc = &PoolContention{Pool: pool, Conflicts: make(map[string]uint64)}
+		c.pools[pool] = pc
+		c.blocks[pool] = make(map[string]*BlockContention)
+	}
+	if block == "" {
+		return pc, nil
+	}
+	bc, ok := c.blocks[pool][block]
+	if !ok {
+		bc = &BlockContention{Block: block}
+		c.blocks[pool][block] = bc
+	}
+	return pc, bc
+}
+
+func (c *contentionTracker) allocated(pool, block string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, bc := c.get(pool, block)
+	pc.Allocations++
+	bc.Allocations++
+}
+
+func (c *contentionTracker) freed(pool, block string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, bc := c.get(pool, block)
+	pc.Frees++
+	bc.Frees++
+}
+
+func (c *contentionTracker) blockRequested(pool string, wait time.Duration) {
+	blockRequests.WithLabelValues(pool).Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, _ := c.get(pool, "")
+	pc.BlockRequests++
+	pc.BlockRequestWait += wait
+}
+
+func (c *contentionTracker) waited(pool string, wait time.Duration) {
+	lockWaitSeconds.WithLabelValues(pool).Add(wait.Seconds())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, _ := c.get(pool, "")
+	pc.LockWait += wait
+}
+
+func (c *contentionTracker) conflicted(pool, block, op string) {
+	updateConflicts.WithLabelValues(pool, op).Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pc, bc := c.get(pool, block)
+	pc.Conflicts[op]++
+	if bc != nil {
+		bc.Conflicts++
+	}
+}
+
+// forget removes the statistics of a block no longer used by this node.
+func (c *contentionTracker) forget(pool, block string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if blocks, ok := c.blocks[pool]; ok {
+		delete(blocks, block)
+	}
+}
+
+func (c *contentionTracker) report() []PoolContention {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := make([]PoolContention, 0, len(c.pools))
+	for name, pc := range c.pools {
+		r := *pc
+		r.Conflicts = make(map[string]uint64, len(pc.Conflicts))
+		for op, n := range pc.Conflicts {
+			r.Conflicts[op] = n
+		}
+		r.Blocks = make([]BlockContention, 0, len(c.blocks[name]))
+		for _, bc := range c.blocks[name] {
+			r.Blocks = append(r.Blocks, *bc)
+		}
+		sort.Slice(r.Blocks, func(i, j int) bool { return r.Blocks[i].Block < r.Blocks[j].Block })
+		report = append(report, r)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Pool < report[j].Pool })
+	return report
+}
+
+// retryOnConflict is retry.RetryOnConflict that records conflicts of `op`
+// on `block` of `pool`.  `block` may be empty for updates of the pool.
+func retryOnConflict(pool, block, op string, fn func() error) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		err := fn()
+		if apierrors.IsConflict(err) {
+			contention.conflicted(pool, block, op)
+		}
+		return err
+	})
+}
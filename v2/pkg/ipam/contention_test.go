@@ -0,0 +1,117 @@
+package ipam
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestContentionTracker(t *testing.T) {
+	t.Parallel()
+
+	c := &contentionTracker{
+		pools:  make(map[string]*PoolContention),
+		blocks: make(map[string]map[string]*BlockContention),
+	}
+	c.allocated("default", "default-0")
+	c.allocated("default", "default-1")
+	c.allocated("default", "default-1")
+	c.freed("default", "default-1")
+	c.blockRequested("default", time.Second)
+	c.waited("default", 2*time.Second)
+	c.conflicted("default", "default-1", OpDeleteBlock)
+	c.conflicted("default", "", OpAddQuarantine)
+	c.allocated("global", "global-0")
+
+	report := c.report()
+	if len(report) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	def := report[0]
+	if def.Pool != "default" || def.Allocations != 3 || def.Frees != 1 || def.BlockRequests != 1 {
+		t.Errorf("unexpected pool: %+v", def)
+	}
+	if def.BlockRequestWait != time.Second || def.LockWait != 2*time.Second {
+		t.Errorf("unexpected wait: %+v", def)
+	}
+	if def.Conflicts[OpDeleteBlock] != 1 || def.Conflicts[OpAddQuarantine] != 1 || def.TotalConflicts() != 2 {
+		t.Errorf("unexpected conflicts: %+v", def.Conflicts)
+	}
+	if len(def.Blocks) != 2 || def.Blocks[0].Block != "default-0" || def.Blocks[1].Block != "default-1" {
+		t.Fatalf("unexpected blocks: %+v", def.Blocks)
+	}
+	if b := def.Blocks[1]; b.Allocations != 2 || b.Frees != 1 || b.Conflicts != 1 {
+		t.Errorf("unexpected block: %+v", b)
+	}
+	if report[1].Pool != "global" || report[1].Allocations != 1 {
+		t.Errorf("unexpected pool: %+v", report[1])
+	}
+
+	// the report is a copy
+	report[0].Conflicts[OpDeleteBlock] = 100
+	if c.report()[0].Conflicts[OpDeleteBlock] != 1 {
+		t.Error("report shares the conflicts with the tracker")
+	}
+
+	c.forget("default", "default-1")
+	if blocks := c.report()[0].Blocks; len(blocks) != 1 || blocks[0].Block != "default-0" {
+		t.Errorf("block was not forgotten: %+v", blocks)
+	}
+	if c.report()[0].Allocations != 3 {
+		t.Error("forgetting a block should not change the pool statistics")
+	}
+}
+
+func TestRetryOnConflict(t *testing.T) {
+	t.Parallel()
+
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "addressblocks"}, "retry-0", errors.New("modified"))
+
+	count := 0
+	err := retryOnConflict("retry-test", "retry-0", OpHandoffBlock, func() error {
+		count++
+		if count < 3 {
+			return conflict
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Error("unexpected number of attempts:", count)
+	}
+
+	var pc *PoolContention
+	for _, r := range ContentionReport() {
+		if r.Pool == "retry-test" {
+			r := r
+			pc = &r
+		}
+	}
+	if pc == nil {
+		t.Fatal("no report for the pool")
+	}
+	if pc.Conflicts[OpHandoffBlock] != 2 {
+		t.Errorf("unexpected conflicts: %+v", pc.Conflicts)
+	}
+	if len(pc.Blocks) != 1 || pc.Blocks[0].Conflicts != 2 {
+		t.Errorf("unexpected blocks: %+v", pc.Blocks)
+	}
+
+	other := errors.New("other")
+	err = retryOnConflict("retry-test", "", OpAddQuarantine, func() error {
+		return other
+	})
+	if !errors.Is(err, other) {
+		t.Error("unexpected error:", err)
+	}
+	for _, r := range ContentionReport() {
+		if r.Pool == "retry-test" && r.Conflicts[OpAddQuarantine] != 0 {
+			t.Error("errors other than conflicts should not be counted")
+		}
+	}
+}
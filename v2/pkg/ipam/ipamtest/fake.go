@@ -0,0 +1,365 @@
+// Package ipamtest provides an in-memory implementation of ipam.NodeIPAM
+// for unit tests of coild and of programs built on Coil.
+//
+// The fake keeps allocations in memory without AddressBlocks, so tests
+// need neither kube-apiserver nor etcd.  Latencies and failures can be
+// injected for each method to test timeouts and error handling.
+package ipamtest
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+)
+
+// Names of the methods of ipam.NodeIPAM for SetLatency and SetFailure.
+const (
+	MethodRegister       = "Register"
+	MethodGC             = "GC"
+	MethodAllocate       = "Allocate"
+	MethodFree           = "Free"
+	MethodTransfer       = "Transfer"
+	MethodPreallocate    = "Preallocate"
+	MethodHandoff        = "Handoff"
+	MethodNodeInternalIP = "NodeInternalIP"
+)
+
+type allocKey struct {
+	id    string
+	iface string
+}
+
+type allocation struct {
+	pool string
+	ipv4 net.IP
+	ipv6 net.IP
+}
+
+type fakePool struct {
+	ipv4 *net.IPNet
+	ipv6 *net.IPNet
+}
+
+type failure struct {
+	err error
+
+	// remaining is the number of calls to fail.  Negative means forever.
+	remaining int
+}
+
+// FakeNodeIPAM is an in-memory ipam.NodeIPAM.
+//
+// Addresses are allocated from the lowest free one of the subnets given by
+// AddPool.  AllocateSpread ignores the group because the fake has no blocks.
+// GC, Preallocate, Handoff, and Notify do nothing but return injected failures.
+// Allocate returns ipam.ErrNoBlock when the pool is exhausted.
+type FakeNodeIPAM struct {
+	// NodeIPv4 and NodeIPv6 are returned by NodeInternalIP.
+	NodeIPv4 net.IP
+	NodeIPv6 net.IP
+
+	mu        sync.Mutex
+	pools     map[string]*fakePool
+	allocs    map[allocKey]*allocation
+	latencies map[string]time.Duration
+	failures  map[string]*failure
+	calls     map[string]int
+}
+
+var _ ipam.NodeIPAM = &FakeNodeIPAM{}
+
+// NewFakeNodeIPAM creates a FakeNodeIPAM without pools.
+func NewFakeNodeIPAM() *FakeNodeIPAM {
+	return &FakeNodeIPAM{
+		pools:     make(map[string]*fakePool),
+		allocs:    make(map[allocKey]*allocation),
+		latencies: make(map[string]time.Duration),
+		failures:  make(map[string]*failure),
+		calls:     make(map[string]int),
+	}
+}
+
+// AddPool adds a pool with an IPv4 subnet, an IPv6 subnet, or both.
+// An empty string means the pool has no subnet of the family.
+func (f *FakeNodeIPAM) AddPool(name, ipv4, ipv6 string) error {
+	p := &fakePool{}
+	for _, x := range []struct {
+		cidr string
+		dst  **net.IPNet
+	}{
+		{ipv4, &p.ipv4},
+		{ipv6, &p.ipv6},
+	} {
+		if x.cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(x.cidr)
+		if err != nil {
+			return fmt.Errorf("invalid subnet of pool %s: %w", name, err)
+		}
+		*x.dst = n
+	}
+	if p.ipv4 == nil && p.ipv6 == nil {
+		return fmt.Errorf("pool %s has no subnets", name)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pools[name] = p
+	return nil
+}
+
+// SetLatency makes `method` wait for `d` before doing anything.
+// The wait is cut short when the context of the call is done.
+func (f *FakeNodeIPAM) SetLatency(method string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latencies[method] = d
+}
+
+// SetFailure makes the next `n` calls of `method` fail with `err` without
+// doing anything.  If `n` is negative, all the calls fail.  If `err` is nil,
+// the failure is removed.  Transfer returns false instead of `err`.
+func (f *FakeNodeIPAM) SetFailure(method string, err error, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.failures, method)
+		return
+	}
+	f.failures[method] = &failure{err: err, remaining: n}
+}
+
+// Calls returns the number of calls of `method`, including failed ones.
+func (f *FakeNodeIPAM) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// Allocated returns the addresses allocated for `(containerID, iface)`,
+// or nil if nothing is allocated.
+func (f *FakeNodeIPAM) Allocated(containerID, iface string) (ipv4, ipv6 net.IP) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.allocs[allocKey{containerID, iface}]
+	if !ok {
+		return nil, nil
+	}
+	return a.ipv4, a.ipv6
+}
+
+// NumAllocated returns the number of interfaces having allocated addresses.
+func (f *FakeNodeIPAM) NumAllocated() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.allocs)
+}
+
+// enter counts the call of `method`, waits for its latency, and returns
+// the injected failure if any.
+func (f *FakeNodeIPAM) enter(ctx context.Context, method string) error {
+	f.mu.Lock()
+	f.calls[method]++
+	d := f.latencies[method]
+	var err error
+	if fl, ok := f.failures[method]; ok {
+		err = fl.err
+		if fl.remaining > 0 {
+			fl.remaining--
+			if fl.remaining == 0 {
+				delete(f.failures, method)
+			}
+		}
+	}
+	f.mu.Unlock()
+
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (f *FakeNodeIPAM) Register(ctx context.Context, poolName, containerID, iface string, ipv4, ipv6 net.IP) error {
+	if err := f.enter(ctx, MethodRegister); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if poolName == "" {
+		for name, p := range f.pools {
+			if p.contains(ipv4) || p.contains(ipv6) {
+				poolName = name
+				break
+			}
+		}
+	}
+	p, ok := f.pools[poolName]
+	if !ok {
+		return fmt.Errorf("no pool for %s, %s", ipv4, ipv6)
+	}
+	if (ipv4 != nil && !p.contains(ipv4)) || (ipv6 != nil && !p.contains(ipv6)) {
+		return fmt.Errorf("addresses %s, %s are not in pool %s", ipv4, ipv6, poolName)
+	}
+	f.allocs[allocKey{containerID, iface}] = &allocation{pool: poolName, ipv4: ipv4, ipv6: ipv6}
+	return nil
+}
+
+func (f *FakeNodeIPAM) GC(ctx context.Context) error {
+	return f.enter(ctx, MethodGC)
+}
+
+func (f *FakeNodeIPAM) Allocate(ctx context.Context, poolName, containerID, iface string) (net.IP, net.IP, error) {
+	if err := f.enter(ctx, MethodAllocate); err != nil {
+		return nil, nil, err
+	}
+
+	return f.allocate(poolName, containerID, iface)
+}
+
+func (f *FakeNodeIPAM) AllocateSpread(ctx context.Context, poolName, containerID, iface, group string) (net.IP, net.IP, error) {
+	return f.Allocate(ctx, poolName, containerID, iface)
+}
+
+func (f *FakeNodeIPAM) allocate(poolName, containerID, iface string) (net.IP, net.IP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.pools[poolName]
+	if !ok {
+		return nil, nil, fmt.Errorf("pool %s not found", poolName)
+	}
+	key := allocKey{containerID, iface}
+	if a, ok := f.allocs[key]; ok {
+		return a.ipv4, a.ipv6, nil
+	}
+
+	a := &allocation{pool: poolName}
+	if p.ipv4 != nil {
+		a.ipv4 = f.lowestFree(p.ipv4, func(a *allocation) net.IP { return a.ipv4 })
+		if a.ipv4 == nil {
+			return nil, nil, ipam.ErrNoBlock
+		}
+	}
+	if p.ipv6 != nil {
+		a.ipv6 = f.lowestFree(p.ipv6, func(a *allocation) net.IP { return a.ipv6 })
+		if a.ipv6 == nil {
+			return nil, nil, ipam.ErrNoBlock
+		}
+	}
+	f.allocs[key] = a
+	return a.ipv4, a.ipv6, nil
+}
+
+// lowestFree returns the lowest address in `n` not allocated, or nil.
+func (f *FakeNodeIPAM) lowestFree(n *net.IPNet, get func(*allocation) net.IP) net.IP {
+	used := make(map[string]bool)
+	for _, a := range f.allocs {
+		if ip := get(a); ip != nil {
+			used[ip.String()] = true
+		}
+	}
+
+	ones, bits := n.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	base := n.IP.Mask(n.Mask)
+	if bits == 32 {
+		base = base.To4()
+	}
+	start := new(big.Int).SetBytes(base)
+	for i := big.NewInt(0); i.Cmp(size) < 0; i.Add(i, big.NewInt(1)) {
+		b := new(big.Int).Add(start, i).Bytes()
+		ip := make(net.IP, len(base))
+		copy(ip[len(ip)-len(b):], b)
+		if !used[ip.String()] {
+			return ip
+		}
+	}
+	return nil
+}
+
+func (f *FakeNodeIPAM) Free(ctx context.Context, containerID, iface string) error {
+	if err := f.enter(ctx, MethodFree); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.allocs, allocKey{containerID, iface})
+	for n := 0; ; n++ {
+		key := allocKey{containerID, ipam.ExtraIFace(iface, n)}
+		if _, ok := f.allocs[key]; !ok {
+			break
+		}
+		delete(f.allocs, key)
+	}
+	return nil
+}
+
+func (f *FakeNodeIPAM) Transfer(fromID, fromIface, toID, toIface string) (net.IP, net.IP, bool) {
+	if err := f.enter(context.Background(), MethodTransfer); err != nil {
+		return nil, nil, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	from := allocKey{fromID, fromIface}
+	to := allocKey{toID, toIface}
+	a, ok := f.allocs[from]
+	if !ok {
+		return nil, nil, false
+	}
+	if _, ok := f.allocs[to]; ok {
+		return nil, nil, false
+	}
+	delete(f.allocs, from)
+	f.allocs[to] = a
+	return a.ipv4, a.ipv6, true
+}
+
+func (f *FakeNodeIPAM) Lookup(containerID, iface string) (net.IP, net.IP, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.allocs[allocKey{containerID, iface}]
+	if !ok {
+		return nil, nil, false
+	}
+	return a.ipv4, a.ipv6, true
+}
+
+func (f *FakeNodeIPAM) Preallocate(ctx context.Context, poolName string, n int) error {
+	return f.enter(ctx, MethodPreallocate)
+}
+
+func (f *FakeNodeIPAM) Handoff(ctx context.Context, blockName, nodeName string) error {
+	return f.enter(ctx, MethodHandoff)
+}
+
+func (f *FakeNodeIPAM) Notify(req *coilv2.BlockRequest) {}
+
+func (f *FakeNodeIPAM) NodeInternalIP(ctx context.Context) (net.IP, net.IP, error) {
+	if err := f.enter(ctx, MethodNodeInternalIP); err != nil {
+		return nil, nil, err
+	}
+	return f.NodeIPv4, f.NodeIPv6, nil
+}
+
+func (p *fakePool) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	return (p.ipv4 != nil && p.ipv4.Contains(ip)) || (p.ipv6 != nil && p.ipv6.Contains(ip))
+}
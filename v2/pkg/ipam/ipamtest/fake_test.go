@@ -0,0 +1,152 @@
+package ipamtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+)
+
+func TestFakeNodeIPAM(t *testing.T) {
+	t.Parallel()
+
+	f := NewFakeNodeIPAM()
+	if err := f.AddPool("default", "10.2.0.0/30", "fd02::/126"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddPool("v4", "10.3.0.0/31", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddPool("empty", "", ""); err == nil {
+		t.Error("a pool without subnets should be refused")
+	}
+	ctx := context.Background()
+
+	ipv4, ipv6, err := f.Allocate(ctx, "default", "c1", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ipv4.Equal(net.ParseIP("10.2.0.0")) || !ipv6.Equal(net.ParseIP("fd02::")) {
+		t.Error("unexpected addresses:", ipv4, ipv6)
+	}
+	ipv4, _, err = f.Allocate(ctx, "default", "c1", "eth0")
+	if err != nil || !ipv4.Equal(net.ParseIP("10.2.0.0")) {
+		t.Error("allocating for the same interface should return the same addresses:", ipv4, err)
+	}
+	ipv4, ipv6, err = f.AllocateSpread(ctx, "default", "c2", "eth0", "app")
+	if err != nil || !ipv4.Equal(net.ParseIP("10.2.0.1")) || !ipv6.Equal(net.ParseIP("fd02::1")) {
+		t.Error("unexpected addresses:", ipv4, ipv6, err)
+	}
+	if _, _, err := f.Allocate(ctx, "missing", "c3", "eth0"); err == nil {
+		t.Error("allocating from a missing pool should fail")
+	}
+
+	if _, _, err := f.Allocate(ctx, "v4", "c3", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.Allocate(ctx, "v4", "c3", ipam.ExtraIFace("eth0", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.Allocate(ctx, "v4", "c4", "eth0"); !errors.Is(err, ipam.ErrNoBlock) {
+		t.Error("allocating from an exhausted pool should return ErrNoBlock:", err)
+	}
+
+	if err := f.Free(ctx, "c1", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if ipv4, _ := f.Allocated("c1", "eth0"); ipv4 != nil {
+		t.Error("freed addresses should be gone:", ipv4)
+	}
+	ipv4, _, _ = f.Allocate(ctx, "default", "c5", "eth0")
+	if !ipv4.Equal(net.ParseIP("10.2.0.0")) {
+		t.Error("freed address should be reused:", ipv4)
+	}
+
+	if err := f.Register(ctx, "", "c6", "eth0", net.ParseIP("10.2.0.3"), nil); err != nil {
+		t.Error("registering an address of a pool should succeed:", err)
+	}
+	if err := f.Register(ctx, "", "c7", "eth0", net.ParseIP("192.168.0.1"), nil); err == nil {
+		t.Error("registering an address of no pool should fail")
+	}
+	if err := f.Register(ctx, "v4", "c7", "eth0", net.ParseIP("10.2.0.2"), nil); err == nil {
+		t.Error("registering an address of another pool should fail")
+	}
+
+	ipv4, _, ok := f.Transfer("c6", "eth0", "c8", "eth0")
+	if !ok || !ipv4.Equal(net.ParseIP("10.2.0.3")) {
+		t.Error("transfer failed:", ipv4, ok)
+	}
+	if _, _, ok := f.Transfer("c6", "eth0", "c9", "eth0"); ok {
+		t.Error("transferring nothing should fail")
+	}
+	if n := f.NumAllocated(); n != 5 {
+		t.Error("unexpected number of allocations:", n)
+	}
+	if err := f.Free(ctx, "c3", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if ipv4, _ := f.Allocated("c3", ipam.ExtraIFace("eth0", 0)); ipv4 != nil {
+		t.Error("extra addresses should be freed with the interface:", ipv4)
+	}
+	if n := f.Calls(MethodAllocate); n != 8 {
+		t.Error("unexpected number of calls:", n)
+	}
+}
+
+func TestFakeNodeIPAMInjection(t *testing.T) {
+	t.Parallel()
+
+	f := NewFakeNodeIPAM()
+	if err := f.AddPool("default", "10.2.0.0/24", ""); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	errInjected := errors.New("injected")
+	f.SetFailure(MethodAllocate, errInjected, 2)
+	for i := 0; i < 2; i++ {
+		if _, _, err := f.Allocate(ctx, "default", "c1", "eth0"); err != errInjected {
+			t.Error("injected failure should be returned:", err)
+		}
+	}
+	if _, _, err := f.Allocate(ctx, "default", "c1", "eth0"); err != nil {
+		t.Error("failure should be removed after the given number of calls:", err)
+	}
+
+	f.SetFailure(MethodTransfer, errInjected, -1)
+	if _, _, ok := f.Transfer("c1", "eth0", "c2", "eth0"); ok {
+		t.Error("transfer should fail")
+	}
+	f.SetFailure(MethodTransfer, nil, 0)
+	if _, _, ok := f.Transfer("c1", "eth0", "c2", "eth0"); !ok {
+		t.Error("transfer should succeed after the failure is removed")
+	}
+
+	f.SetLatency(MethodFree, 100*time.Millisecond)
+	start := time.Now()
+	if err := f.Free(ctx, "c2", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("latency should be injected")
+	}
+
+	f.SetLatency(MethodAllocate, time.Hour)
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := f.Allocate(tctx, "default", "c3", "eth0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("latency should be cut short by the deadline:", err)
+	}
+
+	f.NodeIPv4 = net.ParseIP("192.168.0.1")
+	f.SetFailure(MethodNodeInternalIP, errInjected, 1)
+	if _, _, err := f.NodeInternalIP(ctx); err != errInjected {
+		t.Error("injected failure should be returned:", err)
+	}
+	if ipv4, _, err := f.NodeInternalIP(ctx); err != nil || !ipv4.Equal(f.NodeIPv4) {
+		t.Error("unexpected node address:", ipv4, err)
+	}
+}
@@ -0,0 +1,200 @@
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// BlockRequestBudgetWindow is the period in which the block requests of a
+// pool are counted against its budget.
+const BlockRequestBudgetWindow = time.Minute
+
+var blockRequestsThrottled = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "ipam",
+		Name:      "block_requests_throttled_total",
+		Help:      "the number of block requests that waited for other pools or for the budget of the pool",
+	},
+	[]string{"pool", "reason"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(blockRequestsThrottled)
+}
+
+// BlockRequestLimiter schedules block requests of the pools on a node so that
+// no pool starves the others.
+//
+// At most `concurrency` requests run at once.  Waiting requests for allocations
+// go ahead of those for preallocation, and are served in arrival order otherwise.
+// A pool in `budgets` may request at most that many blocks in
+// BlockRequestBudgetWindow; more requests wait for the budget to recover.
+//
+// A nil *BlockRequestLimiter does not limit anything.
+type BlockRequestLimiter struct {
+	concurrency int
+	budgets     map[string]int
+	now         func() time.Time
+
+	mu      sync.Mutex
+	running int
+	queue   []*blockRequestWaiter
+	history map[string][]time.Time
+}
+
+type blockRequestWaiter struct {
+	pool    string
+	refill  bool
+	granted chan struct{}
+}
+
+// NewBlockRequestLimiter creates a BlockRequestLimiter.
+// If `concurrency` is 0, the number of running requests is not limited.
+func NewBlockRequestLimiter(concurrency int, budgets map[string]int) (*BlockRequestLimiter, error) {
+	if concurrency < 0 {
+		return nil, fmt.Errorf("invalid concurrency of block requests: %d", concurrency)
+	}
+	for pool, n := range budgets {
+		if n < 1 {
+			return nil, fmt.Errorf("invalid budget of block requests for pool %s: %d", pool, n)
+		}
+	}
+	return &BlockRequestLimiter{
+		concurrency: concurrency,
+		budgets:     budgets,
+		now:         time.Now,
+		history:     make(map[string][]time.Time),
+	}, nil
+}
+
+// acquire waits until a block request of `pool` may run and returns the
+// function to call when the request finishes.  `refill` should be true
+// for requests to preallocate blocks.
+func (l *BlockRequestLimiter) acquire(ctx context.Context, pool string, refill bool) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if err := l.waitBudget(ctx, pool); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	w := &blockRequestWaiter{pool: pool, refill: refill, granted: make(chan struct{})}
+	l.enqueue(w)
+	l.dispatch()
+	select {
+	case <-w.granted:
+	default:
+		blockRequestsThrottled.WithLabelValues(pool, "concurrency").Inc()
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-w.granted:
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.granted:
+			// granted just before cancellation
+			l.running--
+			l.dispatch()
+		default:
+			l.dequeue(w)
+		}
+		return nil, fmt.Errorf("aborting block request waiting for other pools: %w", ctx.Err())
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.running--
+			l.dispatch()
+		})
+	}, nil
+}
+
+// waitBudget waits until `pool` has budget for a block request, and uses it.
+func (l *BlockRequestLimiter) waitBudget(ctx context.Context, pool string) error {
+	budget, ok := l.budgets[pool]
+	if !ok {
+		return nil
+	}
+
+	throttled := false
+	for {
+		l.mu.Lock()
+		now := l.now()
+		used := l.history[pool]
+		for len(used) > 0 && !used[0].Add(BlockRequestBudgetWindow).After(now) {
+			used = used[1:]
+		}
+		if len(used) < budget {
+			l.history[pool] = append(used, now)
+			l.mu.Unlock()
+			return nil
+		}
+		l.history[pool] = used
+		wait := used[0].Add(BlockRequestBudgetWindow).Sub(now)
+		l.mu.Unlock()
+
+		if !throttled {
+			blockRequestsThrottled.WithLabelValues(pool, "budget").Inc()
+			throttled = true
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("pool %s used up its budget of %d block requests per %s: %w", pool, budget, BlockRequestBudgetWindow, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// enqueue puts `w` after the other waiters of the same priority.
+// l.mu must be held.
+func (l *BlockRequestLimiter) enqueue(w *blockRequestWaiter) {
+	i := len(l.queue)
+	if !w.refill {
+		for i > 0 && l.queue[i-1].refill {
+			i--
+		}
+	}
+	l.queue = append(l.queue, nil)
+	copy(l.queue[i+1:], l.queue[i:])
+	l.queue[i] = w
+}
+
+// dequeue removes `w` from the queue.
+// l.mu must be held.
+func (l *BlockRequestLimiter) dequeue(w *blockRequestWaiter) {
+	for i, q := range l.queue {
+		if q == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch lets the waiters at the head of the queue run while slots are available.
+// l.mu must be held.
+func (l *BlockRequestLimiter) dispatch() {
+	for len(l.queue) > 0 && (l.concurrency == 0 || l.running < l.concurrency) {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		l.running++
+		close(w.granted)
+	}
+}
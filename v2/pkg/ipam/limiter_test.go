@@ -0,0 +1,166 @@
+package ipam
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBlockRequestLimiterConcurrency(t *testing.T) {
+	t.Parallel()
+
+	l, err := NewBlockRequestLimiter(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 3)
+	start := func(pool string, refill bool) {
+		go func() {
+			release, err := l.acquire(ctx, pool, refill)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- pool
+			release()
+		}()
+	}
+	waitQueued := func(n int) {
+		for i := 0; i < 100; i++ {
+			l.mu.Lock()
+			queued := len(l.queue)
+			l.mu.Unlock()
+			if queued == n {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("requests were not queued")
+	}
+
+	// requests for allocations go ahead of refills, and are served in arrival order.
+	start("refill", true)
+	waitQueued(1)
+	start("b", false)
+	waitQueued(2)
+	start("c", false)
+	waitQueued(3)
+
+	select {
+	case pool := <-order:
+		t.Fatal("a request ran beyond the concurrency:", pool)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	release() // releasing twice is harmless
+	for _, expected := range []string{"b", "c", "refill"} {
+		if pool := <-order; pool != expected {
+			t.Errorf("expected %s, got %s", expected, pool)
+		}
+	}
+
+	l.mu.Lock()
+	running := l.running
+	l.mu.Unlock()
+	if running != 0 {
+		t.Error("slots were not released:", running)
+	}
+}
+
+func TestBlockRequestLimiterCancel(t *testing.T) {
+	t.Parallel()
+
+	l, err := NewBlockRequestLimiter(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := l.acquire(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, "b", false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(l.queue) != 0 {
+		t.Error("canceled request remains in the queue")
+	}
+
+	release()
+	release, err = l.acquire(context.Background(), "b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestBlockRequestLimiterBudget(t *testing.T) {
+	t.Parallel()
+
+	l, err := NewBlockRequestLimiter(0, map[string]int{"a": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(context.Background(), "a", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "a", false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("budget was not enforced:", err)
+	}
+
+	// other pools are not limited
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(context.Background(), "b", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	// the budget recovers after the window
+	l.mu.Lock()
+	now = now.Add(BlockRequestBudgetWindow)
+	l.mu.Unlock()
+	release, err := l.acquire(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if _, err := NewBlockRequestLimiter(-1, nil); err == nil {
+		t.Error("negative concurrency should be rejected")
+	}
+	if _, err := NewBlockRequestLimiter(0, map[string]int{"a": 0}); err == nil {
+		t.Error("zero budget should be rejected")
+	}
+
+	var nilLimiter *BlockRequestLimiter
+	release, err = nilLimiter.acquire(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
@@ -2,6 +2,7 @@ package ipam
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -14,7 +15,6 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -23,21 +23,53 @@ import (
 // DefaultAllocTimeout is the default timeout duration for NodeIPAM.Allocate
 const DefaultAllocTimeout = 10 * time.Second
 
+// ErrBlockInUse is an error indicating an address block has allocated addresses.
+var ErrBlockInUse = errors.New("block is in use")
+
+// BlockConflictError is returned when an address block has been changed by
+// others while this node is about to delete it, for example when the block
+// was reclaimed and then acquired by another node with the same name.
+type BlockConflictError struct {
+	Block string
+	Pool  string
+	Node  string
+}
+
+func (e *BlockConflictError) Error() string {
+	return fmt.Sprintf("block %s is now owned by pool %s node %s", e.Block, e.Pool, e.Node)
+}
+
 type allocInfo struct {
 	IPv4      net.IP
 	IPv6      net.IP
 	Pool      *nodePool
 	BlockName string
 	Index     uint
+	Group     string
 }
 
 func allocKey(containerID, iface string) string {
 	return fmt.Sprintf("%s:%s", containerID, iface)
 }
 
+// MaxExtraAddresses is the maximum number of extra addresses of an interface.
+const MaxExtraAddresses = 8
+
+// MaxRouteFailures is the number of consecutive failures to add the route
+// of an address block before the block is quarantined.
+const MaxRouteFailures = 3
+
+// ExtraIFace returns the name to allocate the n-th extra addresses of `iface`.
+// `n` starts from 1.
+func ExtraIFace(iface string, n int) string {
+	return fmt.Sprintf("%s/%d", iface, n)
+}
+
 // NodeIPAM manages IP address assignments to Pods on each node.
 type NodeIPAM interface {
 	// Register registers previously allocated IP addresses.
+	// If `poolName` is empty, the pool is looked up from the address blocks
+	// of the node that include the addresses.
 	Register(ctx context.Context, poolName, containerID, iface string, ipv4, ipv6 net.IP) error
 
 	// GC returns unused address blocks to the pool.
@@ -56,7 +88,18 @@ type NodeIPAM interface {
 	// `errors.Is(err, context.DeadlineExceeded)`.
 	Allocate(ctx context.Context, poolName, containerID, iface string) (ipv4, ipv6 net.IP, err error)
 
+	// AllocateSpread is like Allocate, but avoids the address blocks having
+	// addresses allocated for other containers of the same `group` so that
+	// the group does not depend on a single block.  A new block is acquired
+	// for that if necessary.  If the pool has no more blocks, addresses are
+	// allocated from any block.  If `group` is empty, this is the same as Allocate.
+	//
+	// Groups are not recovered by Register.
+	AllocateSpread(ctx context.Context, poolName, containerID, iface, group string) (ipv4, ipv6 net.IP, err error)
+
 	// Free frees the addresses allocated for `(containerID, iface)`.
+	// The extra addresses allocated for `(containerID, ExtraIFace(iface, n))`
+	// are also freed.
 	//
 	// If no IP address has been allocated, this returns `nil`.
 	//
@@ -64,6 +107,29 @@ type NodeIPAM interface {
 	// AddressBlock to the pool.
 	Free(ctx context.Context, containerID, iface string) error
 
+	// Transfer moves the addresses allocated for `(fromID, fromIface)` to
+	// `(toID, toIface)` without freeing them, and returns the addresses.
+	//
+	// If nothing is allocated for `(fromID, fromIface)` or something is
+	// already allocated for `(toID, toIface)`, this returns false and
+	// nothing is moved.  Extra addresses are not moved.
+	Transfer(fromID, fromIface, toID, toIface string) (ipv4, ipv6 net.IP, ok bool)
+
+	// Lookup returns the addresses allocated for `(containerID, iface)`.
+	// If nothing is allocated, this returns false.
+	Lookup(containerID, iface string) (ipv4, ipv6 net.IP, ok bool)
+
+	// Preallocate acquires address blocks from the pool until the node
+	// has at least `n` blocks of the pool.  The blocks are kept even when
+	// they become empty, so that Allocate can return addresses quickly.
+	Preallocate(ctx context.Context, poolName string, n int) error
+
+	// Handoff transfers an address block of this node to another node.
+	// The block is relabeled without renumbering.
+	//
+	// If the block has allocated addresses, this returns ErrBlockInUse.
+	Handoff(ctx context.Context, blockName, nodeName string) error
+
 	// Notify notifies a goroutine waiting for BlockRequest completion
 	Notify(req *coilv2.BlockRequest)
 
@@ -71,39 +137,58 @@ type NodeIPAM interface {
 	NodeInternalIP(ctx context.Context) (ipv4, ipv6 net.IP, err error)
 }
 
-// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;update;patch;delete
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch;update;patch;delete
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=blockrequests,verbs=get;list;watch;create;delete
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=blockrequests/status,verbs=get
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get
 
 type nodeIPAM struct {
-	nodeName  string
-	log       logr.Logger
-	client    client.Client
-	apiReader client.Reader
-	scheme    *runtime.Scheme
-	exporter  nodenet.RouteExporter
+	nodeName    string
+	clusterName string
+	log         logr.Logger
+	client      client.Client
+	apiReader   client.Reader
+	scheme      *runtime.Scheme
+	exporter    nodenet.RouteExporter
+	prober      nodenet.ConflictProber
+	limiter     *BlockRequestLimiter
 
 	mu    sync.Mutex
 	pools map[string]*nodePool
 	node  *corev1.Node
 
 	allocInfoMap sync.Map
+
+	syncMu        sync.Mutex
+	routeFailures map[string]int
 }
 
 // NewNodeIPAM creates a new NodeIPAM object.
 //
 // If `exporter` is non-nil, this calls `exporter.Sync` to
 // add or delete routes when it allocate or delete AddressBlocks.
-func NewNodeIPAM(nodeName string, l logr.Logger, mgr manager.Manager, exporter nodenet.RouteExporter) NodeIPAM {
+// A block whose route fails to be added MaxRouteFailures times in a row
+// is labeled as quarantined and no longer used for allocation.
+//
+// If `clusterName` is not empty, AddressBlocks labeled with other cluster names are ignored.
+//
+// If `prober` is non-nil, addresses from pools with conflict detection
+// enabled are probed before allocation.
+//
+// If `limiter` is non-nil, block requests of the pools are scheduled by it.
+func NewNodeIPAM(nodeName, clusterName string, l logr.Logger, mgr manager.Manager, exporter nodenet.RouteExporter, prober nodenet.ConflictProber, limiter *BlockRequestLimiter) NodeIPAM {
 	return &nodeIPAM{
-		nodeName:  nodeName,
-		log:       l,
-		client:    mgr.GetClient(),
-		apiReader: mgr.GetAPIReader(),
-		scheme:    mgr.GetScheme(),
-		exporter:  exporter,
-		pools:     make(map[string]*nodePool),
+		nodeName:    nodeName,
+		clusterName: clusterName,
+		log:         l,
+		client:      mgr.GetClient(),
+		apiReader:   mgr.GetAPIReader(),
+		scheme:      mgr.GetScheme(),
+		exporter:    exporter,
+		prober:      prober,
+		limiter:     limiter,
+		pools:       make(map[string]*nodePool),
 	}
 }
 
@@ -112,29 +197,113 @@ func (n *nodeIPAM) sync(ctx context.Context) error {
 		return nil
 	}
 
-	blocks := &coilv2.AddressBlockList{}
-	if err := n.apiReader.List(ctx, blocks, client.MatchingLabels{
-		constants.LabelNode: n.nodeName,
-	}); err != nil {
-		return err
+	n.syncMu.Lock()
+	defer n.syncMu.Unlock()
+
+	// After quarantining a block, try again to export the routes of the others.
+	for {
+		blocks := &coilv2.AddressBlockList{}
+		if err := n.apiReader.List(ctx, blocks, client.MatchingLabels{
+			constants.LabelNode: n.nodeName,
+		}); err != nil {
+			return err
+		}
+
+		var subnets []*net.IPNet
+		owners := make(map[string]*coilv2.AddressBlock)
+		for i := range blocks.Items {
+			block := &blocks.Items[i]
+			if block.Labels[constants.LabelQuarantined] == "true" {
+				continue
+			}
+			for _, s := range []*string{block.IPv4, block.IPv6} {
+				if s == nil {
+					continue
+				}
+				_, n, _ := net.ParseCIDR(*s)
+				subnets = append(subnets, n)
+				owners[n.String()] = block
+			}
+		}
+
+		err := n.exporter.Sync(subnets)
+		if err == nil {
+			n.routeFailures = nil
+			return nil
+		}
+
+		var addErr *nodenet.RouteAddError
+		if !errors.As(err, &addErr) {
+			return err
+		}
+		block, ok := owners[addErr.Network.String()]
+		if !ok {
+			return err
+		}
+		if n.routeFailures == nil {
+			n.routeFailures = make(map[string]int)
+		}
+		n.routeFailures[block.Name]++
+		if n.routeFailures[block.Name] < MaxRouteFailures {
+			return err
+		}
+
+		if err := n.quarantineBlock(ctx, block, addErr); err != nil {
+			return err
+		}
+		delete(n.routeFailures, block.Name)
 	}
+}
 
-	var subnets []*net.IPNet
-	for _, block := range blocks.Items {
-		if block.IPv4 != nil {
-			_, n, _ := net.ParseCIDR(*block.IPv4)
-			subnets = append(subnets, n)
+// routesPending returns true if the last sync failed to add routes.
+func (n *nodeIPAM) routesPending() bool {
+	n.syncMu.Lock()
+	defer n.syncMu.Unlock()
+	return len(n.routeFailures) > 0
+}
+
+// quarantineBlock labels the block as quarantined so that it is skipped by
+// the allocator and its route is not exported any longer.  The block is
+// kept by this node until the label is removed and coild is restarted.
+func (n *nodeIPAM) quarantineBlock(ctx context.Context, block *coilv2.AddressBlock, reason error) error {
+	err := retryOnConflict(block.Labels[constants.LabelPool], block.Name, OpQuarantineBlock, func() error {
+		b := &coilv2.AddressBlock{}
+		if err := n.apiReader.Get(ctx, client.ObjectKey{Name: block.Name}, b); err != nil {
+			return err
+		}
+		if b.Labels[constants.LabelNode] != n.nodeName {
+			return fmt.Errorf("block %s is not owned by this node", block.Name)
 		}
-		if block.IPv6 != nil {
-			_, n, _ := net.ParseCIDR(*block.IPv6)
-			subnets = append(subnets, n)
+		b.Labels[constants.LabelQuarantined] = "true"
+		if b.Annotations == nil {
+			b.Annotations = make(map[string]string)
 		}
+		b.Annotations[constants.AnnQuarantineReason] = reason.Error()
+		return n.client.Update(ctx, b)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine block %s: %w", block.Name, err)
 	}
-	return n.exporter.Sync(subnets)
+	n.log.Error(reason, "quarantined a block as its route cannot be added", "block", block.Name)
 
+	n.mu.Lock()
+	p, ok := n.pools[block.Labels[constants.LabelPool]]
+	n.mu.Unlock()
+	if ok {
+		p.quarantineBlock(block.Name)
+	}
+	return nil
 }
 
 func (n *nodeIPAM) Register(ctx context.Context, poolName, containerID, iface string, ipv4, ipv6 net.IP) error {
+	if poolName == "" {
+		name, err := n.lookupPool(ctx, ipv4, ipv6)
+		if err != nil {
+			return err
+		}
+		poolName = name
+	}
+
 	p, err := n.getPool(ctx, poolName)
 	if err != nil {
 		return err
@@ -147,6 +316,30 @@ func (n *nodeIPAM) Register(ctx context.Context, poolName, containerID, iface st
 	return nil
 }
 
+// lookupPool returns the pool of the address block of the node including the addresses.
+func (n *nodeIPAM) lookupPool(ctx context.Context, ipv4, ipv6 net.IP) (string, error) {
+	blocks := &coilv2.AddressBlockList{}
+	if err := n.apiReader.List(ctx, blocks, client.MatchingLabels{
+		constants.LabelNode: n.nodeName,
+	}); err != nil {
+		return "", err
+	}
+
+	for _, block := range blocks.Items {
+		if block.IPv4 != nil && ipv4 != nil {
+			if _, subnet, err := net.ParseCIDR(*block.IPv4); err == nil && subnet.Contains(ipv4) {
+				return block.Labels[constants.LabelPool], nil
+			}
+		}
+		if block.IPv6 != nil && ipv6 != nil {
+			if _, subnet, err := net.ParseCIDR(*block.IPv6); err == nil && subnet.Contains(ipv6) {
+				return block.Labels[constants.LabelPool], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no address block of the node includes %v and %v", ipv4, ipv6)
+}
+
 func (n *nodeIPAM) GC(ctx context.Context) error {
 	if err := n.syncUnregisteredPool(ctx); err != nil {
 		return err
@@ -157,13 +350,15 @@ func (n *nodeIPAM) GC(ctx context.Context) error {
 
 func (n *nodeIPAM) gc(ctx context.Context) error {
 	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	for _, np := range n.pools {
 		if err := np.gc(ctx); err != nil {
+			n.mu.Unlock()
 			return err
 		}
 	}
+	n.mu.Unlock()
+
+	// sync may quarantine blocks, which locks n.mu.
 	return n.sync(ctx)
 }
 
@@ -188,6 +383,10 @@ func (n *nodeIPAM) syncUnregisteredPool(ctx context.Context) error {
 }
 
 func (n *nodeIPAM) Allocate(ctx context.Context, poolName, containerID, iface string) (ipv4, ipv6 net.IP, err error) {
+	return n.AllocateSpread(ctx, poolName, containerID, iface, "")
+}
+
+func (n *nodeIPAM) AllocateSpread(ctx context.Context, poolName, containerID, iface, group string) (ipv4, ipv6 net.IP, err error) {
 	key := allocKey(containerID, iface)
 	if val, ok := n.allocInfoMap.Load(key); ok {
 		val := val.(*allocInfo)
@@ -198,20 +397,60 @@ func (n *nodeIPAM) Allocate(ctx context.Context, poolName, containerID, iface st
 	if err != nil {
 		return nil, nil, err
 	}
-	ai, toSync, err := p.allocate(ctx)
+	ai, toSync, err := p.allocate(ctx, n.groupBlocks(p, group))
 	if err != nil {
 		return nil, nil, err
 	}
-	if toSync {
+	ai.Group = group
+	if toSync || n.routesPending() {
 		if err := n.sync(ctx); err != nil {
+			n.release(ctx, ai)
 			return nil, nil, err
 		}
+		if p.isQuarantined(ai.BlockName) {
+			n.release(ctx, ai)
+			return nil, nil, fmt.Errorf("block %s has been quarantined", ai.BlockName)
+		}
 	}
 	n.allocInfoMap.Store(key, ai)
 	return ai.IPv4, ai.IPv6, nil
 }
 
+// release frees the address of `ai` that is not handed to the container
+// because the allocation failed after it was taken.
+func (n *nodeIPAM) release(ctx context.Context, ai *allocInfo) {
+	if _, err := ai.Pool.free(ctx, ai.BlockName, ai.Index); err != nil {
+		n.log.Error(err, "failed to release an address", "block", ai.BlockName, "index", ai.Index)
+	}
+}
+
+// groupBlocks returns the set of the blocks of `p` having addresses allocated for `group`.
+func (n *nodeIPAM) groupBlocks(p *nodePool, group string) map[string]bool {
+	if group == "" {
+		return nil
+	}
+
+	blocks := make(map[string]bool)
+	n.allocInfoMap.Range(func(_, val interface{}) bool {
+		ai := val.(*allocInfo)
+		if ai.Pool == p && ai.Group == group {
+			blocks[ai.BlockName] = true
+		}
+		return true
+	})
+	return blocks
+}
+
 func (n *nodeIPAM) Free(ctx context.Context, containerID, iface string) error {
+	for i := MaxExtraAddresses; i > 0; i-- {
+		if err := n.free(ctx, containerID, ExtraIFace(iface, i)); err != nil {
+			return err
+		}
+	}
+	return n.free(ctx, containerID, iface)
+}
+
+func (n *nodeIPAM) free(ctx context.Context, containerID, iface string) error {
 	key := allocKey(containerID, iface)
 	val, ok := n.allocInfoMap.Load(key)
 	if !ok {
@@ -223,15 +462,85 @@ func (n *nodeIPAM) Free(ctx context.Context, containerID, iface string) error {
 	if err != nil {
 		return err
 	}
+
+	// Forget the allocation before syncing routes so that
+	// retrying Free after a sync failure will not free it twice.
+	n.allocInfoMap.Delete(key)
 	if toSync {
 		if err := n.sync(ctx); err != nil {
 			return err
 		}
 	}
-	n.allocInfoMap.Delete(key)
 	return nil
 }
 
+func (n *nodeIPAM) Transfer(fromID, fromIface, toID, toIface string) (net.IP, net.IP, bool) {
+	toKey := allocKey(toID, toIface)
+	if _, ok := n.allocInfoMap.Load(toKey); ok {
+		return nil, nil, false
+	}
+	val, ok := n.allocInfoMap.LoadAndDelete(allocKey(fromID, fromIface))
+	if !ok {
+		return nil, nil, false
+	}
+	ai := val.(*allocInfo)
+	if _, loaded := n.allocInfoMap.LoadOrStore(toKey, ai); loaded {
+		// lost the race with Allocate for `(toID, toIface)`.
+		n.allocInfoMap.Store(allocKey(fromID, fromIface), ai)
+		return nil, nil, false
+	}
+	return ai.IPv4, ai.IPv6, true
+}
+
+func (n *nodeIPAM) Lookup(containerID, iface string) (net.IP, net.IP, bool) {
+	val, ok := n.allocInfoMap.Load(allocKey(containerID, iface))
+	if !ok {
+		return nil, nil, false
+	}
+	ai := val.(*allocInfo)
+	return ai.IPv4, ai.IPv6, true
+}
+
+func (n *nodeIPAM) Preallocate(ctx context.Context, poolName string, num int) error {
+	p, err := n.getPool(ctx, poolName)
+	if err != nil {
+		return err
+	}
+
+	// routes for acquired blocks need to be exported even if some requests failed.
+	toSync, err := p.preallocate(ctx, num)
+	if toSync {
+		if err := n.sync(ctx); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (n *nodeIPAM) Handoff(ctx context.Context, blockName, nodeName string) error {
+	block := &coilv2.AddressBlock{}
+	if err := n.apiReader.Get(ctx, client.ObjectKey{Name: blockName}, block); err != nil {
+		return fmt.Errorf("failed to get AddressBlock %s: %w", blockName, err)
+	}
+	if block.Labels[constants.LabelNode] != n.nodeName {
+		return fmt.Errorf("block %s is not owned by this node", blockName)
+	}
+
+	node := &corev1.Node{}
+	if err := n.apiReader.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get the destination node %s: %w", nodeName, err)
+	}
+
+	p, err := n.getPool(ctx, block.Labels[constants.LabelPool])
+	if err != nil {
+		return err
+	}
+	if err := p.handoff(ctx, blockName, nodeName); err != nil {
+		return err
+	}
+	return n.sync(ctx)
+}
+
 func (n *nodeIPAM) Notify(req *coilv2.BlockRequest) {
 	n.mu.Lock()
 	p, ok := n.pools[req.Spec.PoolName]
@@ -255,13 +564,17 @@ func (n *nodeIPAM) getPool(ctx context.Context, name string) (*nodePool, error)
 		p = &nodePool{
 			poolName:            name,
 			nodeName:            n.nodeName,
+			clusterName:         n.clusterName,
 			node:                n.node,
 			log:                 n.log.WithValues("pool", name),
 			client:              n.client,
 			apiReader:           n.apiReader,
 			scheme:              n.scheme,
+			prober:              n.prober,
+			limiter:             n.limiter,
 			requestCompletionCh: make(chan *coilv2.BlockRequest),
 			blockAlloc:          make(map[string]allocator),
+			quarantined:         make(map[string]bool),
 		}
 		if err := p.syncBlock(ctx); err != nil {
 			return nil, err
@@ -313,18 +626,26 @@ func (n *nodeIPAM) NodeInternalIP(ctx context.Context) (net.IP, net.IP, error) {
 }
 
 type nodePool struct {
-	poolName  string
-	nodeName  string
-	node      *corev1.Node
-	log       logr.Logger
-	client    client.Client
-	apiReader client.Reader
-	scheme    *runtime.Scheme
+	poolName    string
+	nodeName    string
+	clusterName string
+	node        *corev1.Node
+	log         logr.Logger
+	client      client.Client
+	apiReader   client.Reader
+	scheme      *runtime.Scheme
+	prober      nodenet.ConflictProber
+	limiter     *BlockRequestLimiter
 
 	requestCompletionCh chan *coilv2.BlockRequest
 
-	mu         sync.Mutex
-	blockAlloc map[string]allocator
+	mu          sync.Mutex
+	blockAlloc  map[string]allocator
+	quarantined map[string]bool
+	minBlocks   int
+
+	// addresses quarantined by this node but not yet seen in the cache
+	pendingQuarantine map[string]net.IP
 }
 
 // syncBlock synchronizes address block information.
@@ -342,6 +663,10 @@ func (p *nodePool) syncBlock(ctx context.Context) error {
 		if _, ok := p.blockAlloc[block.Name]; ok {
 			continue
 		}
+		if c, ok := block.Labels[constants.LabelCluster]; ok && p.clusterName != "" && c != p.clusterName {
+			p.log.Error(nil, "ignoring a block of another cluster", "name", block.Name, "cluster", c)
+			continue
+		}
 
 		p.log.Info("adding a new block",
 			"name", block.Name,
@@ -353,32 +678,79 @@ func (p *nodePool) syncBlock(ctx context.Context) error {
 			a.fill()
 		}
 		p.blockAlloc[block.Name] = a
+		if block.Labels[constants.LabelQuarantined] == "true" {
+			p.log.Info("the block is quarantined", "name", block.Name)
+			p.quarantined[block.Name] = true
+		}
 	}
 	return nil
 }
 
+// deleteBlock deletes the block of this node.
+//
+// The block is re-read on every attempt and deleted only if it still belongs
+// to this node.  Otherwise, *BlockConflictError is returned.  The deletion is
+// conditioned on the version of the block that was checked, so the block is
+// never deleted after it is changed by others.  The finalizer is removed after
+// the block is marked for deletion, when no one can take it over.
 func (p *nodePool) deleteBlock(ctx context.Context, name string) error {
-	// remove finalizer
-	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+	err := retryOnConflict(p.poolName, name, OpDeleteBlock, func() error {
 		b := &coilv2.AddressBlock{}
-		err := p.apiReader.Get(ctx, client.ObjectKey{Name: name}, b)
-		if err != nil {
+		if err := p.apiReader.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
 			return client.IgnoreNotFound(err)
 		}
+		if b.Labels[constants.LabelPool] != p.poolName || b.Labels[constants.LabelNode] != p.nodeName {
+			return &BlockConflictError{Block: name, Pool: b.Labels[constants.LabelPool], Node: b.Labels[constants.LabelNode]}
+		}
+
+		if b.DeletionTimestamp == nil {
+			err := p.client.Delete(ctx, b, client.Preconditions{UID: &b.UID, ResourceVersion: &b.ResourceVersion})
+			if err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			if err := p.apiReader.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+		}
+
 		if !controllerutil.ContainsFinalizer(b, constants.FinCoil) {
 			return nil
 		}
 		controllerutil.RemoveFinalizer(b, constants.FinCoil)
-		return p.client.Update(ctx, b)
+		return client.IgnoreNotFound(p.client.Update(ctx, b))
 	})
 	if err != nil {
-		return fmt.Errorf("failed to remove finalizer from %s: %w", name, err)
+		return fmt.Errorf("failed to delete block %s: %w", name, err)
 	}
+	return nil
+}
 
-	// delete ignoring notfound error.
-	b := &coilv2.AddressBlock{}
-	b.Name = name
-	return client.IgnoreNotFound(p.client.Delete(ctx, b))
+// quarantineBlock stops allocating addresses from the block and keeps it.
+func (p *nodePool) quarantineBlock(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.quarantined[name] = true
+}
+
+func (p *nodePool) isQuarantined(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.quarantined[name]
+}
+
+// forgetConflictedBlock forgets the block if `err` is *BlockConflictError
+// and returns true.  The addresses allocated from the block are lost, but
+// the block no longer belongs to this node anyway.
+func (p *nodePool) forgetConflictedBlock(name string, err error) bool {
+	var conflict *BlockConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	p.log.Error(err, "forgetting a block changed by others", "block", name, "owner-pool", conflict.Pool, "owner-node", conflict.Node)
+	delete(p.blockAlloc, name)
+	delete(p.quarantined, name)
+	contention.forget(p.poolName, name)
+	return true
 }
 
 func (p *nodePool) gc(ctx context.Context) error {
@@ -390,15 +762,19 @@ func (p *nodePool) gc(ctx context.Context) error {
 	}
 
 	for name, alloc := range p.blockAlloc {
-		if !alloc.isEmpty() {
+		if !alloc.isEmpty() || len(p.blockAlloc) <= p.minBlocks || p.quarantined[name] {
 			continue
 		}
 
 		p.log.Info("freeing an unused block", "block", name)
 		if err := p.deleteBlock(ctx, name); err != nil {
+			if p.forgetConflictedBlock(name, err) {
+				continue
+			}
 			return err
 		}
 		delete(p.blockAlloc, name)
+		contention.forget(p.poolName, name)
 	}
 
 	return nil
@@ -442,102 +818,367 @@ func (p *nodePool) register(containerID, iface string, ipv4, ipv6 net.IP) *alloc
 	return nil
 }
 
-func (p *nodePool) allocateFrom(alloc allocator, block string, toSync bool) (*allocInfo, bool, error) {
-	ipv4, ipv6, idx, ok := alloc.allocate()
-	if !ok {
-		panic("bug")
+// allocateFrom allocates addresses from a block.
+// If `probe` is true, addresses used by other hosts are quarantined and skipped.
+// This returns nil if no addresses are available in the block.
+//
+// The caller must hold p.mu.  While probing, p.mu is released so that a slow
+// probe does not block other allocations and frees in the pool.  The reserved
+// address keeps the block from being freed in the meantime.
+func (p *nodePool) allocateFrom(ctx context.Context, alloc allocator, block string, probe bool) *allocInfo {
+	for {
+		ipv4, ipv6, idx, ok := alloc.allocate()
+		if !ok {
+			return nil
+		}
+
+		if probe && p.probeUnlocked(ctx, ipv4, ipv6) {
+			p.log.Info("quarantined a conflicting address",
+				"block", block,
+				"ipv4", ipv4, "ipv6", ipv6,
+			)
+			alloc.free(idx)
+			alloc.quarantine(idx)
+			continue
+		}
+
+		p.log.Info("allocated",
+			"block", block,
+			"ipv4", ipv4, "ipv6", ipv6,
+		)
+		contention.allocated(p.poolName, block)
+		return &allocInfo{
+			IPv4:      ipv4,
+			IPv6:      ipv6,
+			BlockName: block,
+			Index:     idx,
+			Pool:      p,
+		}
 	}
+}
 
-	p.log.Info("allocated",
-		"block", block,
-		"ipv4", ipv4, "ipv6", ipv6,
-	)
-	return &allocInfo{
-		IPv4:      ipv4,
-		IPv6:      ipv6,
-		BlockName: block,
-		Index:     idx,
-		Pool:      p,
-	}, toSync, nil
+// syncQuarantine reads the AddressPool and applies its quarantine list to the blocks.
+// This returns true if the addresses of the pool should be probed before allocation.
+//
+// The AddressPool is read from the cache of the manager, which is kept
+// up to date by watching, so as not to query the API server for every allocation.
+// Addresses quarantined by this node are kept until the cache catches up.
+func (p *nodePool) syncQuarantine(ctx context.Context) (bool, error) {
+	ap := &coilv2.AddressPool{}
+	if err := p.client.Get(ctx, client.ObjectKey{Name: p.poolName}, ap); err != nil {
+		return false, fmt.Errorf("failed to get AddressPool: %w", err)
+	}
+
+	ips := make([]net.IP, 0, len(ap.Spec.Quarantine)+len(p.pendingQuarantine))
+	for _, a := range ap.Spec.Quarantine {
+		if ip := net.ParseIP(a); ip != nil {
+			ips = append(ips, ip)
+		}
+		delete(p.pendingQuarantine, a)
+	}
+	for _, ip := range p.pendingQuarantine {
+		ips = append(ips, ip)
+	}
+	for _, alloc := range p.blockAlloc {
+		alloc.setQuarantine(ips)
+	}
+
+	return p.prober != nil && ap.Spec.ConflictDetection, nil
 }
 
-func (p *nodePool) allocate(ctx context.Context) (*allocInfo, bool, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// addQuarantine adds addresses to the quarantine list of the AddressPool.
+func (p *nodePool) addQuarantine(ctx context.Context, ips ...net.IP) error {
+	return retryOnConflict(p.poolName, "", OpAddQuarantine, func() error {
+		ap := &coilv2.AddressPool{}
+		if err := p.apiReader.Get(ctx, client.ObjectKey{Name: p.poolName}, ap); err != nil {
+			return err
+		}
+
+		current := make(map[string]bool)
+		for _, a := range ap.Spec.Quarantine {
+			current[a] = true
+		}
+		updated := false
+		for _, ip := range ips {
+			if ip == nil || current[ip.String()] {
+				continue
+			}
+			ap.Spec.Quarantine = append(ap.Spec.Quarantine, ip.String())
+			updated = true
+		}
+		if !updated {
+			return nil
+		}
+		return p.client.Update(ctx, ap)
+	})
+}
 
+// probeUnlocked probes ipv4 and ipv6 with p.mu released, and adds them to
+// the quarantine list of the AddressPool if they are used by other hosts.
+// This returns true if they conflict.  The caller must hold p.mu.
+func (p *nodePool) probeUnlocked(ctx context.Context, ipv4, ipv6 net.IP) bool {
+	p.mu.Unlock()
+	conflict := p.conflicts(ipv4, ipv6)
+	var err error
+	if conflict {
+		err = p.addQuarantine(ctx, ipv4, ipv6)
+	}
+	p.lockMeasured()
+
+	if !conflict {
+		return false
+	}
+	if err != nil {
+		p.log.Error(err, "failed to add addresses to quarantine")
+		return true
+	}
+	if p.pendingQuarantine == nil {
+		p.pendingQuarantine = make(map[string]net.IP)
+	}
+	for _, ip := range []net.IP{ipv4, ipv6} {
+		if ip != nil {
+			p.pendingQuarantine[ip.String()] = ip
+		}
+	}
+	return true
+}
+
+// conflicts returns true if some other host uses ipv4 or ipv6.
+// Errors during probing are logged and ignored.
+func (p *nodePool) conflicts(ipv4, ipv6 net.IP) bool {
+	for _, ip := range []net.IP{ipv4, ipv6} {
+		if ip == nil {
+			continue
+		}
+		conflict, err := p.prober.Probe(ip)
+		if err != nil {
+			p.log.Error(err, "failed to probe an address", "ip", ip.String())
+			continue
+		}
+		if conflict {
+			return true
+		}
+	}
+	return false
+}
+
+// allocateFromAny allocates addresses from one of the current blocks
+// except for those in `avoid` and quarantined ones.
+// This returns nil if no addresses are available.
+func (p *nodePool) allocateFromAny(ctx context.Context, probe bool, avoid map[string]bool) *allocInfo {
 	for block, alloc := range p.blockAlloc {
-		if alloc.isFull() {
+		if alloc.isFull() || avoid[block] || p.quarantined[block] {
 			continue
 		}
 
-		return p.allocateFrom(alloc, block, false)
+		if ai := p.allocateFrom(ctx, alloc, block, probe); ai != nil {
+			return ai
+		}
+	}
+	return nil
+}
+
+// allocate allocates addresses from the blocks other than those in `avoid`.
+// A new block is requested if necessary.  If no more blocks are available,
+// addresses are allocated from the blocks in `avoid`.
+func (p *nodePool) allocate(ctx context.Context, avoid map[string]bool) (*allocInfo, bool, error) {
+	p.lockMeasured()
+	defer p.mu.Unlock()
+
+	probe, err := p.syncQuarantine(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if ai := p.allocateFromAny(ctx, probe, avoid); ai != nil {
+		return ai, false, nil
+	}
+
+	// Blocks may have been handed off from other nodes.
+	numBlocks := len(p.blockAlloc)
+	if err := p.syncBlock(ctx); err != nil {
+		return nil, false, err
+	}
+	if len(p.blockAlloc) > numBlocks {
+		if _, err := p.syncQuarantine(ctx); err != nil {
+			return nil, false, err
+		}
+		if ai := p.allocateFromAny(ctx, probe, avoid); ai != nil {
+			return ai, true, nil
+		}
+	}
+
+	// All addresses in a new block may be quarantined.
+	// In that case, request another block until the pool runs out of blocks.
+	for {
+		block, err := p.requestBlock(ctx, false)
+		if err != nil {
+			if len(avoid) == 0 {
+				return nil, false, err
+			}
+			if ai := p.allocateFromAny(ctx, probe, nil); ai != nil {
+				p.log.Info("failed to spread addresses over blocks", "error", err.Error())
+				return ai, len(p.blockAlloc) > numBlocks, nil
+			}
+			return nil, false, err
+		}
+
+		if _, err := p.syncQuarantine(ctx); err != nil {
+			return nil, false, err
+		}
+		alloc, ok := p.blockAlloc[block]
+		if !ok {
+			panic("bug: " + block)
+		}
+		if ai := p.allocateFrom(ctx, alloc, block, probe); ai != nil {
+			return ai, true, nil
+		}
+		p.log.Info("no available addresses in the new block", "block", block)
+	}
+}
+
+// handoff relabels an unused block with another node name and forgets it.
+func (p *nodePool) handoff(ctx context.Context, blockName, nodeName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	alloc, ok := p.blockAlloc[blockName]
+	if !ok {
+		return fmt.Errorf("block %s is not managed by this node", blockName)
+	}
+	if !alloc.isEmpty() {
+		return ErrBlockInUse
+	}
+
+	err := retryOnConflict(p.poolName, blockName, OpHandoffBlock, func() error {
+		b := &coilv2.AddressBlock{}
+		if err := p.apiReader.Get(ctx, client.ObjectKey{Name: blockName}, b); err != nil {
+			return err
+		}
+		if b.Labels[constants.LabelNode] != p.nodeName {
+			return fmt.Errorf("block %s is not owned by this node", blockName)
+		}
+		b.Labels[constants.LabelNode] = nodeName
+		delete(b.Annotations, constants.AnnHandoffTo)
+		return p.client.Update(ctx, b)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hand off block %s: %w", blockName, err)
+	}
+
+	p.log.Info("handed off a block", "block", blockName, "to", nodeName)
+	delete(p.blockAlloc, blockName)
+	contention.forget(p.poolName, blockName)
+	return nil
+}
+
+// preallocate requests blocks until the pool has `num` blocks for the node,
+// and keeps them from being freed.
+func (p *nodePool) preallocate(ctx context.Context, num int) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.minBlocks = num
+	toSync := false
+	for len(p.blockAlloc) < num {
+		if _, err := p.requestBlock(ctx, true); err != nil {
+			return toSync, err
+		}
+		toSync = true
 	}
+	return toSync, nil
+}
 
+// requestBlock creates a BlockRequest and waits for its completion.
+// This returns the name of the acquired block.
+// `refill` should be true when the block is requested for preallocation.
+func (p *nodePool) requestBlock(ctx context.Context, refill bool) (string, error) {
 	p.log.Info("requesting a new block")
+	start := time.Now()
 	ctx, cancel := context.WithTimeout(ctx, DefaultAllocTimeout)
 	defer cancel()
 
+	release, err := p.limiter.acquire(ctx, p.poolName, refill)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
 	reqName := fmt.Sprintf("req-%s-%s", p.poolName, p.nodeName)
 
 	// delete existing request, if any
 	req := &coilv2.BlockRequest{}
 	req.Name = reqName
-	err := p.client.Delete(ctx, req)
+	err = p.client.Delete(ctx, req)
 	if err != nil && !apierrors.IsNotFound(err) {
-		return nil, false, fmt.Errorf("failed to delete existing BlockRequest: %w", err)
+		return "", fmt.Errorf("failed to delete existing BlockRequest: %w", err)
 	}
 
 	req = &coilv2.BlockRequest{}
 	req.Name = reqName
 	if err := controllerutil.SetOwnerReference(p.node, req, p.scheme); err != nil {
-		return nil, false, fmt.Errorf("failed to set owner reference: %w", err)
+		return "", fmt.Errorf("failed to set owner reference: %w", err)
 	}
 	req.Spec.NodeName = p.nodeName
 	req.Spec.PoolName = p.poolName
+	req.Spec.Critical = IsCritical(ctx)
 	if err := p.client.Create(ctx, req); err != nil {
-		return nil, false, fmt.Errorf("failed to create BlockRequest: %w", err)
+		return "", fmt.Errorf("failed to create BlockRequest: %w", err)
 	}
 
 	p.log.Info("waiting for request completion")
 	select {
 	case <-ctx.Done():
-		return nil, false, fmt.Errorf("aborting new block request: %w", ctx.Err())
+		return "", fmt.Errorf("aborting new block request: %w", ctx.Err())
 	case req = <-p.requestCompletionCh:
 	}
 
 	block, err := req.GetResult()
 	if err != nil {
 		p.log.Error(err, "request failed", "conditions", fmt.Sprintf("%+v", req.Status.Conditions))
-		return nil, false, err
+		return "", err
 	}
 
 	if err := p.syncBlock(ctx); err != nil {
-		return nil, false, fmt.Errorf("failed to sync blocks: %w", err)
+		return "", fmt.Errorf("failed to sync blocks: %w", err)
 	}
-	alloc, ok := p.blockAlloc[block]
-	if !ok {
-		panic("bug: " + block)
-	}
-	return p.allocateFrom(alloc, block, true)
+	contention.blockRequested(p.poolName, time.Since(start))
+	return block, nil
 }
 
-func (p *nodePool) free(ctx context.Context, blockName string, idx uint) (bool, error) {
+// lockMeasured locks p.mu and records the time spent waiting for the lock.
+// Allocations and frees on a node are serialized by the lock, so the wait
+// grows when they contend with each other or with block requests.
+func (p *nodePool) lockMeasured() {
+	start := time.Now()
 	p.mu.Lock()
+	contention.waited(p.poolName, time.Since(start))
+}
+
+func (p *nodePool) free(ctx context.Context, blockName string, idx uint) (bool, error) {
+	p.lockMeasured()
 	defer p.mu.Unlock()
 
 	alloc, ok := p.blockAlloc[blockName]
 	if !ok {
-		panic("bug: " + blockName)
+		// the block has already been released.
+		p.log.Info("freeing an address of unknown block", "block", blockName, "index", idx)
+		return false, nil
 	}
 	alloc.free(idx)
-	if !alloc.isEmpty() {
+	contention.freed(p.poolName, blockName)
+	if !alloc.isEmpty() || len(p.blockAlloc) <= p.minBlocks || p.quarantined[blockName] {
 		return false, nil
 	}
 
 	p.log.Info("freeing an empty block", "block", blockName)
 	if err := p.deleteBlock(ctx, blockName); err != nil {
+		if p.forgetConflictedBlock(blockName, err) {
+			return true, nil
+		}
 		return false, fmt.Errorf("failed to free block %s: %w", blockName, err)
 	}
 	delete(p.blockAlloc, blockName)
+	contention.forget(p.poolName, blockName)
 	return true, nil
 }
@@ -2,6 +2,7 @@ package ipam
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -9,6 +10,7 @@ import (
 
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
 	. "github.com/cybozu-go/coil/v2/pkg/test"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -17,6 +19,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -146,16 +149,29 @@ func testController(ctx context.Context, npMap map[string]NodeIPAM) {
 
 type mockExporter struct {
 	subnets map[string]struct{}
+	broken  map[string]bool
 }
 
 func (m *mockExporter) Sync(subnets []*net.IPNet) error {
 	m.subnets = make(map[string]struct{})
 	for _, n := range subnets {
+		if m.broken[n.String()] {
+			return &nodenet.RouteAddError{Network: n, Err: errors.New("file exists")}
+		}
 		m.subnets[n.String()] = struct{}{}
 	}
 	return nil
 }
 
+func (m *mockExporter) List() ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for k := range m.subnets {
+		_, n, _ := net.ParseCIDR(k)
+		subnets = append(subnets, n)
+	}
+	return subnets, nil
+}
+
 func (m *mockExporter) Equal(subnets []string) bool {
 	t := make(map[string]struct{})
 	for _, n := range subnets {
@@ -164,6 +180,22 @@ func (m *mockExporter) Equal(subnets []string) bool {
 	return reflect.DeepEqual(m.subnets, t)
 }
 
+type mockProber struct {
+	conflicts map[string]bool
+
+	// if entered is not nil, Probe notifies it and waits for release to be closed.
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (m *mockProber) Probe(ip net.IP) (bool, error) {
+	if m.entered != nil {
+		m.entered <- struct{}{}
+		<-m.release
+	}
+	return m.conflicts[ip.String()], nil
+}
+
 var _ = Describe("NodeIPAM", func() {
 	ctx := context.Background()
 
@@ -172,7 +204,7 @@ var _ = Describe("NodeIPAM", func() {
 	})
 
 	It("should timeout if there is no working controller", func() {
-		nodeIPAM := NewNodeIPAM("node1", ctrl.Log.WithName("NodeIPAM"), mgr, nil)
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM"), mgr, nil, nil, nil)
 
 		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
 		defer cancel()
@@ -184,8 +216,8 @@ var _ = Describe("NodeIPAM", func() {
 	It("should acquire block and allocate IP addresses", func() {
 		e1 := &mockExporter{}
 		e2 := &mockExporter{}
-		nodeIPAM := NewNodeIPAM("node1", ctrl.Log.WithName("NodeIPAM1"), mgr, e1)
-		nodeIPAM2 := NewNodeIPAM("node2", ctrl.Log.WithName("NodeIPAM2"), mgr, e2)
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM1"), mgr, e1, nil, nil)
+		nodeIPAM2 := NewNodeIPAM("node2", "", ctrl.Log.WithName("NodeIPAM2"), mgr, e2, nil, nil)
 
 		// run the dummy controller
 		ctx, cancel := context.WithCancel(ctx)
@@ -235,14 +267,62 @@ var _ = Describe("NodeIPAM", func() {
 		err = nodeIPAM2.Free(ctx, "d1", "eth0")
 		Expect(err).NotTo(HaveOccurred())
 
+		By("freeing again")
+		err = nodeIPAM2.Free(ctx, "d1", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		err = nodeIPAM2.Free(ctx, "unknown", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+
 		ipv4, ipv6, err = nodeIPAM.Allocate(ctx, "v4", "c101", "eth0")
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ipv4).To(EqualIP(net.ParseIP("10.4.0.0")))
 		Expect(ipv6).To(BeNil())
 	}, 5)
 
+	It("should quarantine a block whose route cannot be added", func() {
+		e1 := &mockExporter{broken: map[string]bool{"10.2.0.0/31": true}}
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-quarantine"), mgr, e1, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		for i := 0; i < MaxRouteFailures-1; i++ {
+			_, _, err := nodeIPAM.Allocate(ctx, "default", fmt.Sprintf("c%d", i), "eth0")
+			Expect(err).To(HaveOccurred())
+		}
+
+		By("allocating from another block after the broken block is quarantined")
+		ipv4, _, err := nodeIPAM.Allocate(ctx, "default", "c10", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.2")))
+		Expect(e1.Equal([]string{"10.2.0.2/31", "fd02::202/127"})).To(BeTrue())
+
+		block := &coilv2.AddressBlock{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: "default-0"}, block)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(block.Labels).To(HaveKeyWithValue(constants.LabelQuarantined, "true"))
+		Expect(block.Annotations[constants.AnnQuarantineReason]).To(ContainSubstring("file exists"))
+
+		By("releasing the addresses of the failed allocations")
+		np := nodePoolOf(nodeIPAM, "default")
+		np.mu.Lock()
+		Expect(np.blockAlloc["default-0"].isEmpty()).To(BeTrue())
+		np.mu.Unlock()
+
+		By("acquiring a block again instead of using the quarantined block")
+		err = nodeIPAM.Free(ctx, "c10", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		ipv4, _, err = nodeIPAM.Allocate(ctx, "default", "c11", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.2")))
+	}, 5)
+
 	It("can restore state and return unused blocks", func() {
-		nodeIPAM := NewNodeIPAM("node1", ctrl.Log.WithName("NodeIPAM3"), mgr, nil)
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM3"), mgr, nil, nil, nil)
 
 		// run the dummy controller
 		ctx, cancel := context.WithCancel(ctx)
@@ -272,7 +352,7 @@ var _ = Describe("NodeIPAM", func() {
 
 		// recreate node IPAM
 		e1 := &mockExporter{}
-		nodeIPAM = NewNodeIPAM("node1", ctrl.Log.WithName("NodeIPAM-recreated"), mgr, e1)
+		nodeIPAM = NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-recreated"), mgr, e1, nil, nil)
 		err = nodeIPAM.Register(ctx, "default", "c0", "eth2", ipv4, ipv6)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -292,6 +372,127 @@ var _ = Describe("NodeIPAM", func() {
 		Expect(ipv6).To(EqualIP(net.ParseIP("fd02::0203")))
 	}, 5)
 
+	It("should manage extra addresses of an interface", func() {
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-extra"), mgr, nil, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		ipv4, ipv6, err := nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		extra, _, err := nodeIPAM.Allocate(ctx, "v4", "c0", ExtraIFace("eth0", 1))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(extra).To(EqualIP(net.ParseIP("10.4.0.0")))
+
+		By("registering the extra address without the pool name")
+		nodeIPAM = NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-extra-recreated"), mgr, nil, nil, nil)
+		err = nodeIPAM.Register(ctx, "default", "c0", "eth0", ipv4, ipv6)
+		Expect(err).ToNot(HaveOccurred())
+		err = nodeIPAM.Register(ctx, "", "c0", ExtraIFace("eth0", 1), extra, nil)
+		Expect(err).ToNot(HaveOccurred())
+		err = nodeIPAM.GC(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		blocks := &coilv2.AddressBlockList{}
+		err = k8sClient.List(ctx, blocks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocks.Items).To(HaveLen(2))
+
+		err = nodeIPAM.Register(ctx, "", "c1", "eth0", net.ParseIP("192.168.0.1"), nil)
+		Expect(err).To(HaveOccurred())
+
+		By("freeing the interface")
+		err = nodeIPAM.Free(ctx, "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		blocks = &coilv2.AddressBlockList{}
+		err = k8sClient.List(ctx, blocks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocks.Items).To(BeEmpty())
+	}, 5)
+
+	It("should transfer addresses to another interface", func() {
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-transfer"), mgr, nil, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		ipv4, ipv6, err := nodeIPAM.Allocate(ctx, "default", "hold/ns1/pod1", "hold")
+		Expect(err).ToNot(HaveOccurred())
+		other, _, err := nodeIPAM.Allocate(ctx, "default", "c1", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, ok := nodeIPAM.Transfer("hold/ns1/pod1", "hold", "c1", "eth0")
+		Expect(ok).To(BeFalse())
+		_, _, ok = nodeIPAM.Transfer("hold/ns1/pod2", "hold", "c2", "eth0")
+		Expect(ok).To(BeFalse())
+
+		tv4, tv6, ok := nodeIPAM.Transfer("hold/ns1/pod1", "hold", "c0", "eth0")
+		Expect(ok).To(BeTrue())
+		Expect(tv4).To(EqualIP(ipv4))
+		Expect(tv6).To(EqualIP(ipv6))
+
+		lv4, _, ok := nodeIPAM.Lookup("c0", "eth0")
+		Expect(ok).To(BeTrue())
+		Expect(lv4).To(EqualIP(ipv4))
+		_, _, ok = nodeIPAM.Lookup("hold/ns1/pod1", "hold")
+		Expect(ok).To(BeFalse())
+
+		By("allocating for the transferred interface")
+		v4, _, err := nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v4).To(EqualIP(ipv4))
+		Expect(v4).NotTo(EqualIP(other))
+
+		By("freeing the original interface")
+		err = nodeIPAM.Free(ctx, "hold/ns1/pod1", "hold")
+		Expect(err).ToNot(HaveOccurred())
+		v4, _, err = nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v4).To(EqualIP(ipv4))
+
+		err = nodeIPAM.Free(ctx, "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		err = nodeIPAM.Free(ctx, "c1", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+	}, 5)
+
+	It("should spread addresses of a group over blocks", func() {
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-spread"), mgr, nil, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		ipv4, _, err := nodeIPAM.AllocateSpread(ctx, "default", "c0", "eth0", "group1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.0")))
+
+		By("acquiring another block for the same group")
+		ipv4, _, err = nodeIPAM.AllocateSpread(ctx, "default", "c1", "eth0", "group1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.2")))
+
+		By("allocating from any block after the pool runs out of blocks")
+		ipv4, _, err = nodeIPAM.AllocateSpread(ctx, "default", "c2", "eth0", "group1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(Or(EqualIP(net.ParseIP("10.2.0.1")), EqualIP(net.ParseIP("10.2.0.3"))))
+
+		ipv4, _, err = nodeIPAM.AllocateSpread(ctx, "default", "c3", "eth0", "group2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).NotTo(BeNil())
+	}, 5)
+
 	It("should ignore reserved blocks", func() {
 		By("creating a reserved block")
 		block := &coilv2.AddressBlock{
@@ -311,7 +512,7 @@ var _ = Describe("NodeIPAM", func() {
 		err := k8sClient.Create(ctx, block)
 		Expect(err).ShouldNot(HaveOccurred())
 
-		nodeIPAM := NewNodeIPAM("node1", ctrl.Log.WithName("NodeIPAM3"), mgr, nil)
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM3"), mgr, nil, nil, nil)
 
 		// run the dummy controller
 		ctx, cancel := context.WithCancel(ctx)
@@ -330,23 +531,294 @@ var _ = Describe("NodeIPAM", func() {
 		Expect(blocks.Items).To(HaveLen(2))
 	}, 5)
 
+	It("should preallocate and keep blocks", func() {
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM5"), mgr, nil, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		err := nodeIPAM.Preallocate(ctx, "default", 2)
+		Expect(err).ToNot(HaveOccurred())
+
+		countBlocks := func() int {
+			blocks := &coilv2.AddressBlockList{}
+			err := k8sClient.List(ctx, blocks)
+			Expect(err).ToNot(HaveOccurred())
+			return len(blocks.Items)
+		}
+		Expect(countBlocks()).To(Equal(2))
+
+		By("checking that preallocated blocks are used and kept")
+		ipv4, _, err := nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).NotTo(BeNil())
+		Expect(countBlocks()).To(Equal(2))
+
+		err = nodeIPAM.Free(ctx, "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(countBlocks()).To(Equal(2))
+
+		err = nodeIPAM.GC(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(countBlocks()).To(Equal(2))
+	}, 5)
+
+	It("should hand off unused blocks to other nodes", func() {
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM6"), mgr, nil, nil, nil)
+		e2 := &mockExporter{}
+		nodeIPAM2 := NewNodeIPAM("node2", "", ctrl.Log.WithName("NodeIPAM7"), mgr, e2, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+			"node2": nodeIPAM2,
+		})
+
+		err := nodeIPAM.Preallocate(ctx, "default", 1)
+		Expect(err).ToNot(HaveOccurred())
+		_, _, err = nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+
+		blocks := &coilv2.AddressBlockList{}
+		err = k8sClient.List(ctx, blocks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocks.Items).To(HaveLen(1))
+		blockName := blocks.Items[0].Name
+
+		By("checking that a block in use cannot be handed off")
+		err = nodeIPAM.Handoff(ctx, blockName, "node2")
+		Expect(err).To(MatchError(ErrBlockInUse))
+
+		err = nodeIPAM.Free(ctx, "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+
+		By("handing off the block")
+		err = nodeIPAM.Handoff(ctx, blockName, "node2")
+		Expect(err).ToNot(HaveOccurred())
+
+		block := &coilv2.AddressBlock{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: blockName}, block)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(block.Labels[constants.LabelNode]).To(Equal("node2"))
+
+		By("checking that the block is used by the destination node")
+		ipv4, ipv6, err := nodeIPAM2.Allocate(ctx, "default", "d0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.0")))
+		Expect(ipv6).To(EqualIP(net.ParseIP("fd02::0200")))
+		Expect(e2.Equal([]string{"10.2.0.0/31", "fd02::200/127"})).To(BeTrue())
+
+		blocks = &coilv2.AddressBlockList{}
+		err = k8sClient.List(ctx, blocks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocks.Items).To(HaveLen(1))
+	}, 5)
+
+	It("should not delete a block taken over by another node", func() {
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM-conflict"), mgr, nil, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		_, _, err := nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+
+		blocks := &coilv2.AddressBlockList{}
+		err = k8sClient.List(ctx, blocks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocks.Items).To(HaveLen(1))
+		orig := blocks.Items[0]
+
+		By("releasing the block and creating it again for node2 behind node1")
+		controllerutil.RemoveFinalizer(&orig, constants.FinCoil)
+		err = k8sClient.Update(ctx, &orig)
+		Expect(err).ToNot(HaveOccurred())
+		err = k8sClient.Delete(ctx, &orig)
+		Expect(err).ToNot(HaveOccurred())
+		block := &coilv2.AddressBlock{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: orig.Name,
+				Labels: map[string]string{
+					constants.LabelPool: "default",
+					constants.LabelNode: "node2",
+				},
+				Finalizers: []string{constants.FinCoil},
+			},
+			Index: orig.Index,
+			IPv4:  orig.IPv4,
+			IPv6:  orig.IPv6,
+		}
+		err = k8sClient.Create(ctx, block)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("freeing the last address of the block on node1")
+		err = nodeIPAM.Free(ctx, "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+
+		block = &coilv2.AddressBlock{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: orig.Name}, block)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(block.DeletionTimestamp).To(BeNil())
+		Expect(block.Labels[constants.LabelNode]).To(Equal("node2"))
+		Expect(block.Finalizers).To(ContainElement(constants.FinCoil))
+
+		By("checking that node1 forgot the block")
+		ipv4, _, err := nodeIPAM.Allocate(ctx, "default", "c1", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.2")))
+	}, 5)
+
+	It("should ignore blocks of other clusters", func() {
+		By("creating a block of another cluster")
+		block := &coilv2.AddressBlock{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "default-2",
+				Labels: map[string]string{
+					constants.LabelPool:    "default",
+					constants.LabelNode:    "node1",
+					constants.LabelCluster: "other",
+				},
+				Finalizers: []string{constants.FinCoil},
+			},
+			Index: 2,
+			IPv4:  strPtr("10.2.0.4/31"),
+			IPv6:  strPtr("fd02::0204/127"),
+		}
+		err := k8sClient.Create(ctx, block)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		nodeIPAM := NewNodeIPAM("node1", "mine", ctrl.Log.WithName("NodeIPAM4"), mgr, nil, nil, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		ipv4, _, err := nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.0")))
+
+		By("checking that GC does not delete the block of another cluster")
+		err = nodeIPAM.GC(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		blocks := &coilv2.AddressBlockList{}
+		err = k8sClient.List(ctx, blocks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocks.Items).To(HaveLen(2))
+	}, 5)
+
+	It("should skip quarantined and conflicting addresses", func() {
+		ap := &coilv2.AddressPool{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: "default"}, ap)
+		Expect(err).ToNot(HaveOccurred())
+		orig := ap.Spec.DeepCopy()
+		defer func() {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "default"}, ap)
+			Expect(err).ToNot(HaveOccurred())
+			ap.Spec = *orig
+			err = k8sClient.Update(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() []string {
+				ap := &coilv2.AddressPool{}
+				if err := mgr.GetClient().Get(ctx, client.ObjectKey{Name: "default"}, ap); err != nil {
+					return []string{err.Error()}
+				}
+				return ap.Spec.Quarantine
+			}).Should(BeEmpty())
+		}()
+
+		ap.Spec.ConflictDetection = true
+		ap.Spec.Quarantine = []string{"10.2.0.0"}
+		err = k8sClient.Update(ctx, ap)
+		Expect(err).ToNot(HaveOccurred())
+
+		// NodeIPAM reads the pool from the cache of the manager.
+		Eventually(func() []string {
+			ap := &coilv2.AddressPool{}
+			if err := mgr.GetClient().Get(ctx, client.ObjectKey{Name: "default"}, ap); err != nil {
+				return nil
+			}
+			return ap.Spec.Quarantine
+		}).Should(ConsistOf("10.2.0.0"))
+
+		prober := &mockProber{conflicts: map[string]bool{"10.2.0.1": true}}
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM6"), mgr, nil, prober, nil)
+
+		// run the dummy controller
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go testController(ctx, map[string]NodeIPAM{
+			"node1": nodeIPAM,
+		})
+
+		ipv4, ipv6, err := nodeIPAM.Allocate(ctx, "default", "c0", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.2")))
+		Expect(ipv6).To(EqualIP(net.ParseIP("fd02::0202")))
+
+		ap = &coilv2.AddressPool{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: "default"}, ap)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ap.Spec.Quarantine).To(ConsistOf("10.2.0.0", "10.2.0.1", "fd02::201"))
+
+		By("allocating again without reusing the conflicting address")
+		ipv4, _, err = nodeIPAM.Allocate(ctx, "default", "c1", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ipv4).To(EqualIP(net.ParseIP("10.2.0.3")))
+
+		By("freeing addresses while probing others")
+		prober.entered = make(chan struct{}, 4)
+		prober.release = make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := nodeIPAM.Allocate(ctx, "default", "c2", "eth0")
+			done <- err
+		}()
+		Eventually(prober.entered).Should(Receive())
+		err = nodeIPAM.Free(ctx, "c1", "eth0")
+		Expect(err).ToNot(HaveOccurred())
+		close(prober.release)
+		Eventually(done).Should(Receive(BeNil()))
+	}, 5)
+
 	It("can return node internal IPs", func() {
-		nodeIPAM := NewNodeIPAM("node1", ctrl.Log.WithName("NodeIPAM4"), mgr, nil)
+		nodeIPAM := NewNodeIPAM("node1", "", ctrl.Log.WithName("NodeIPAM4"), mgr, nil, nil, nil)
 		ipv4, ipv6, err := nodeIPAM.NodeInternalIP(ctx)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ipv4).To(EqualIP(net.ParseIP("10.20.30.41")))
 		Expect(ipv6).To(EqualIP(net.ParseIP("fd10::41")))
 
-		nodeIPAM = NewNodeIPAM("node2", ctrl.Log.WithName("NodeIPAM5"), mgr, nil)
+		nodeIPAM = NewNodeIPAM("node2", "", ctrl.Log.WithName("NodeIPAM5"), mgr, nil, nil, nil)
 		ipv4, ipv6, err = nodeIPAM.NodeInternalIP(ctx)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ipv4).To(EqualIP(net.ParseIP("10.20.30.42")))
 		Expect(ipv6).To(BeNil())
 
-		nodeIPAM = NewNodeIPAM("node3", ctrl.Log.WithName("NodeIPAM5"), mgr, nil)
+		nodeIPAM = NewNodeIPAM("node3", "", ctrl.Log.WithName("NodeIPAM5"), mgr, nil, nil, nil)
 		ipv4, ipv6, err = nodeIPAM.NodeInternalIP(ctx)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ipv4).To(BeNil())
 		Expect(ipv6).To(EqualIP(net.ParseIP("fd10::43")))
 	}, 5)
 })
+
+func nodePoolOf(ni NodeIPAM, pool string) *nodePool {
+	n := ni.(*nodeIPAM)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.pools[pool]
+}
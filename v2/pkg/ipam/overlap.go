@@ -0,0 +1,96 @@
+package ipam
+
+import (
+	"fmt"
+	"net"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Kinds of networks overlapping pools.
+const (
+	OverlapPool        = "AddressPool"
+	OverlapServiceCIDR = "ServiceCIDR"
+	OverlapNodeNetwork = "NodeNetwork"
+	OverlapNode        = "Node"
+)
+
+// Networks are the networks that pools must not overlap besides other pools.
+type Networks struct {
+	ServiceCIDRs []*net.IPNet
+	NodeNetworks []*net.IPNet
+
+	// Nodes are checked if their InternalIP or ExternalIP addresses are in pools.
+	Nodes []corev1.Node
+}
+
+// Overlap represents a subnet of a pool overlapping another network.
+type Overlap struct {
+	// Subnet is the subnet of the pool.
+	Subnet string
+
+	// Kind is one of OverlapPool, OverlapServiceCIDR, OverlapNodeNetwork, or OverlapNode.
+	Kind string
+
+	// Name is the name of the pool or the node.  It is empty for other kinds.
+	Name string
+
+	// Network is the overlapping subnet, or the address of the node.
+	Network string
+}
+
+func (o Overlap) String() string {
+	if o.Name != "" {
+		return fmt.Sprintf("%s overlaps %s of %s %s", o.Subnet, o.Network, o.Kind, o.Name)
+	}
+	return fmt.Sprintf("%s overlaps %s %s", o.Subnet, o.Kind, o.Network)
+}
+
+// FindOverlaps returns the subnets of `ap` overlapping those of `pools`
+// or `networks`.  `ap` itself in `pools` is skipped.  Invalid subnets are ignored.
+func FindOverlaps(ap *coilv2.AddressPool, pools []coilv2.AddressPool, networks Networks) []Overlap {
+	var overlaps []Overlap
+	for _, subnet := range PoolSubnets([]coilv2.AddressPool{*ap}) {
+		s := subnet.String()
+		for i := range pools {
+			other := &pools[i]
+			if other.Name == ap.Name {
+				continue
+			}
+			for _, n := range PoolSubnets(pools[i : i+1]) {
+				if subnetsOverlap(subnet, n) {
+					overlaps = append(overlaps, Overlap{Subnet: s, Kind: OverlapPool, Name: other.Name, Network: n.String()})
+				}
+			}
+		}
+		for _, n := range networks.ServiceCIDRs {
+			if subnetsOverlap(subnet, n) {
+				overlaps = append(overlaps, Overlap{Subnet: s, Kind: OverlapServiceCIDR, Network: n.String()})
+			}
+		}
+		for _, n := range networks.NodeNetworks {
+			if subnetsOverlap(subnet, n) {
+				overlaps = append(overlaps, Overlap{Subnet: s, Kind: OverlapNodeNetwork, Network: n.String()})
+			}
+		}
+		for i := range networks.Nodes {
+			node := &networks.Nodes[i]
+			for _, addr := range node.Status.Addresses {
+				if addr.Type != corev1.NodeInternalIP && addr.Type != corev1.NodeExternalIP {
+					continue
+				}
+				ip := net.ParseIP(addr.Address)
+				if ip != nil && subnet.Contains(ip) {
+					overlaps = append(overlaps, Overlap{Subnet: s, Kind: OverlapNode, Name: node.Name, Network: ip.String()})
+				}
+			}
+		}
+	}
+	return overlaps
+}
+
+// subnetsOverlap returns true if one of the subnets contains the other.
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
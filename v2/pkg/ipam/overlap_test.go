@@ -0,0 +1,64 @@
+package ipam
+
+import (
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestFindOverlaps(t *testing.T) {
+	t.Parallel()
+
+	newPool := func(name string, subnets ...coilv2.SubnetSet) coilv2.AddressPool {
+		ap := coilv2.AddressPool{}
+		ap.Name = name
+		ap.Spec.Subnets = subnets
+		return ap
+	}
+	ap := newPool("team-a",
+		coilv2.SubnetSet{IPv4: strPtr("10.10.0.0/16"), IPv6: strPtr("fd02::/112")},
+		coilv2.SubnetSet{IPv4: strPtr("10.96.0.0/24")},
+	)
+	pools := []coilv2.AddressPool{
+		ap,
+		newPool("default", coilv2.SubnetSet{IPv4: strPtr("10.0.0.0/16")}),
+		newPool("team-b", coilv2.SubnetSet{IPv4: strPtr("10.10.128.0/20")}),
+		newPool("broken", coilv2.SubnetSet{IPv4: strPtr("10.10.0.0")}),
+	}
+	node := corev1.Node{}
+	node.Name = "node1"
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "node1"},
+		{Type: corev1.NodeInternalIP, Address: "10.10.3.4"},
+		{Type: corev1.NodeInternalIP, Address: "fd10::4"},
+	}
+	networks := Networks{
+		ServiceCIDRs: parseNets(t, "10.96.0.0/12"),
+		NodeNetworks: parseNets(t, "192.168.0.0/16", "fd02::100/120"),
+		Nodes:        []corev1.Node{node},
+	}
+
+	expected := []Overlap{
+		{Subnet: "10.10.0.0/16", Kind: OverlapPool, Name: "team-b", Network: "10.10.128.0/20"},
+		{Subnet: "10.10.0.0/16", Kind: OverlapNode, Name: "node1", Network: "10.10.3.4"},
+		{Subnet: "fd02::/112", Kind: OverlapNodeNetwork, Network: "fd02::100/120"},
+		{Subnet: "10.96.0.0/24", Kind: OverlapServiceCIDR, Network: "10.96.0.0/12"},
+	}
+	overlaps := FindOverlaps(&ap, pools, networks)
+	if diff := cmp.Diff(expected, overlaps); diff != "" {
+		t.Errorf("unexpected overlaps (-want +got):\n%s", diff)
+	}
+	if s := overlaps[0].String(); s != "10.10.0.0/16 overlaps 10.10.128.0/20 of AddressPool team-b" {
+		t.Error("unexpected description:", s)
+	}
+	if s := overlaps[3].String(); s != "10.96.0.0/24 overlaps ServiceCIDR 10.96.0.0/12" {
+		t.Error("unexpected description:", s)
+	}
+
+	other := newPool("global", coilv2.SubnetSet{IPv4: strPtr("172.16.0.0/16")})
+	if overlaps := FindOverlaps(&other, pools, networks); len(overlaps) != 0 {
+		t.Error("unexpected overlaps:", overlaps)
+	}
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/cybozu-go/coil/v2/pkg/constants"
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -21,6 +25,36 @@ import (
 // ErrNoBlock is an error indicating there are no available address blocks in a pool.
 var ErrNoBlock = errors.New("out of blocks")
 
+// ErrNodeNotSelected is an error indicating the node is not selected by the node selector of a pool.
+var ErrNodeNotSelected = errors.New("node not selected")
+
+// ErrPoolCordoned is an error indicating the pool is cordoned and no more blocks are curved out of it.
+var ErrPoolCordoned = errors.New("pool cordoned")
+
+// ErrPoolPaused is an error indicating allocations from the pool are paused.
+var ErrPoolPaused = errors.New("pool paused")
+
+// PauseError is the error returned for paused pools with the reason of the pause.
+// errors.Is(err, ErrPoolPaused) is true for PauseError.
+type PauseError struct {
+	Reason string
+}
+
+func (e *PauseError) Error() string {
+	return "pool paused: " + e.Reason
+}
+
+// Is implements the interface used by errors.Is.
+func (e *PauseError) Is(target error) bool {
+	return target == ErrPoolPaused
+}
+
+// ErrPoolReserved is an error indicating the remaining blocks of a pool are reserved for system-critical Pods.
+var ErrPoolReserved = errors.New("blocks reserved for critical pods")
+
+// ErrNodeBlockLimit is an error indicating the node already has as many blocks of a pool as the pool allows.
+var ErrNodeBlockLimit = errors.New("too many blocks on the node")
+
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch;create
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
 
@@ -35,12 +69,24 @@ type PoolManager interface {
 
 	// AllocateBlock curves an AddressBlock out of the pool for a node.
 	// If the pool runs out of the free blocks, this returns ErrNoBlock.
+	// If the node is not selected by the pool's node selector, this returns ErrNodeNotSelected.
+	// If the pool is cordoned, this returns ErrPoolCordoned.
+	// If the pool is paused, this returns PauseError.
+	// If the node has as many blocks as MaxBlocksPerNode of the pool, this returns ErrNodeBlockLimit.
+	// If the pool has no more free blocks than ReservedBlocks and `ctx` is not
+	// created by WithCritical, this returns ErrPoolReserved.
 	AllocateBlock(ctx context.Context, poolName, nodeName, requestUID string) (*coilv2.AddressBlock, error)
 
 	// IsUsed returns true if a pool is used by some AddressBlock.
 	IsUsed(ctx context.Context, name string) (bool, error)
 }
 
+// SubnetGuard decides whether address blocks can be curved out of subnets.
+type SubnetGuard interface {
+	// Allowed returns false if address blocks must not be curved out of `subnet` of the pool.
+	Allowed(poolName string, subnet *net.IPNet) bool
+}
+
 var (
 	poolMaxBlocks = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -69,26 +115,33 @@ func init() {
 }
 
 type poolManager struct {
-	client client.Client
-	reader client.Reader
-	log    logr.Logger
-	scheme *runtime.Scheme
+	client      client.Client
+	reader      client.Reader
+	log         logr.Logger
+	scheme      *runtime.Scheme
+	clusterName string
+	guard       SubnetGuard
 
 	mu    sync.Mutex
 	pools map[string]*pool
 }
 
 // NewPoolManager creates a new PoolManager.
-func NewPoolManager(cl client.Client, r client.Reader, l logr.Logger, scheme *runtime.Scheme) PoolManager {
+//
+// If `clusterName` is not empty, AddressBlocks are labeled with it.
+// If `guard` is non-nil, blocks are not curved out of subnets denied by it.
+func NewPoolManager(cl client.Client, r client.Reader, l logr.Logger, scheme *runtime.Scheme, clusterName string, guard SubnetGuard) PoolManager {
 	poolMaxBlocks.Reset()
 	poolAllocated.Reset()
 
 	return &poolManager{
-		client: cl,
-		reader: r,
-		log:    l,
-		scheme: scheme,
-		pools:  make(map[string]*pool),
+		client:      cl,
+		reader:      r,
+		log:         l,
+		scheme:      scheme,
+		clusterName: clusterName,
+		guard:       guard,
+		pools:       make(map[string]*pool),
 	}
 }
 
@@ -105,6 +158,8 @@ func (pm *poolManager) getPool(ctx context.Context, name string) (*pool, error)
 			client:          pm.client,
 			reader:          pm.reader,
 			scheme:          pm.scheme,
+			clusterName:     pm.clusterName,
+			guard:           pm.guard,
 			maxBlocks:       poolMaxBlocks.WithLabelValues(name),
 			allocatedBlocks: poolAllocated.WithLabelValues(name),
 		}
@@ -158,6 +213,8 @@ type pool struct {
 	reader          client.Reader
 	log             logr.Logger
 	scheme          *runtime.Scheme
+	clusterName     string
+	guard           SubnetGuard
 	maxBlocks       prometheus.Gauge
 	allocatedBlocks prometheus.Gauge
 
@@ -165,16 +222,8 @@ type pool struct {
 	allocated bitset.BitSet
 }
 
-// SyncBlocks synchronizes allocated field with the current AddressBlocks.
-// This also updates the metrics of the pool.
-func (p *pool) SyncBlocks(ctx context.Context) error {
-	ap := &coilv2.AddressPool{}
-	err := p.client.Get(ctx, client.ObjectKey{Name: p.name}, ap)
-	if err != nil {
-		p.log.Error(err, "failed to get AddressPool")
-		return err
-	}
-
+// MaxBlocks returns the number of address blocks that can be curved out of the pool.
+func MaxBlocks(ap *coilv2.AddressPool) int {
 	var maxBlocks int
 	for _, sub := range ap.Spec.Subnets {
 		var n *net.IPNet
@@ -183,10 +232,39 @@ func (p *pool) SyncBlocks(ctx context.Context) error {
 		} else {
 			_, n, _ = net.ParseCIDR(*sub.IPv6)
 		}
+		if n == nil {
+			continue
+		}
 		ones, bits := n.Mask.Size()
 		maxBlocks += 1 << (bits - ones - int(ap.Spec.BlockSizeBits))
 	}
-	p.maxBlocks.Set(float64(maxBlocks))
+	return maxBlocks
+}
+
+// PauseReason returns the reason why allocations from the pool are paused.
+// The second return value is false if the pool is not paused.
+func PauseReason(ap *coilv2.AddressPool) (string, bool) {
+	if ap.Labels[constants.LabelPaused] != "true" {
+		return "", false
+	}
+	reason := ap.Annotations[constants.AnnPauseReason]
+	if reason == "" {
+		reason = "no reason given"
+	}
+	return reason, true
+}
+
+// SyncBlocks synchronizes allocated field with the current AddressBlocks.
+// This also updates the metrics of the pool.
+func (p *pool) SyncBlocks(ctx context.Context) error {
+	ap := &coilv2.AddressPool{}
+	err := p.client.Get(ctx, client.ObjectKey{Name: p.name}, ap)
+	if err != nil {
+		p.log.Error(err, "failed to get AddressPool")
+		return err
+	}
+
+	p.maxBlocks.Set(float64(MaxBlocks(ap)))
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -211,17 +289,53 @@ func (p *pool) SyncBlocks(ctx context.Context) error {
 	return nil
 }
 
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get
+
+func (p *pool) checkNode(ctx context.Context, sel *metav1.LabelSelector, nodeName string) error {
+	selector, err := metav1.LabelSelectorAsSelector(sel)
+	if err != nil {
+		return fmt.Errorf("invalid node selector: %w", err)
+	}
+
+	node := &corev1.Node{}
+	if err := p.reader.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	if !selector.Matches(labels.Set(node.Labels)) {
+		p.log.Info("node is not selected", "node", nodeName)
+		return ErrNodeNotSelected
+	}
+	return nil
+}
+
+func (p *pool) checkNodeBlocks(ctx context.Context, maxBlocks int, nodeName string) error {
+	blocks := &coilv2.AddressBlockList{}
+	err := p.reader.List(ctx, blocks, client.MatchingLabels{
+		constants.LabelPool: p.name,
+		constants.LabelNode: nodeName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list blocks of node %s: %w", nodeName, err)
+	}
+	if len(blocks.Items) >= maxBlocks {
+		p.log.Info("node has too many blocks", "node", nodeName, "blocks", len(blocks.Items), "max", maxBlocks)
+		return ErrNodeBlockLimit
+	}
+	return nil
+}
+
 // AllocateBlock creates an AddressBlock and returns it.
 // If the pool runs out of the free blocks, this returns ErrNoBlock.
+// If the node is not selected by the pool's node selector, this returns ErrNodeNotSelected.
+// If the pool is cordoned, this returns ErrPoolCordoned.
+// If the pool is paused, this returns PauseError.
+// If the node has as many blocks as MaxBlocksPerNode of the pool, this returns ErrNodeBlockLimit.
+// If the pool has no more free blocks than ReservedBlocks and `ctx` is not
+// created by WithCritical, this returns ErrPoolReserved.
 func (p *pool) AllocateBlock(ctx context.Context, nodeName, requestUID string) (*coilv2.AddressBlock, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	nextIndex, ok := p.allocated.NextClear(0)
-	if !ok {
-		nextIndex = p.allocated.Len()
-	}
-
 	ap := &coilv2.AddressPool{}
 	err := p.client.Get(ctx, client.ObjectKey{Name: p.name}, ap)
 	if err != nil {
@@ -232,6 +346,31 @@ func (p *pool) AllocateBlock(ctx context.Context, nodeName, requestUID string) (
 		p.log.Info("unable to curve out a block because pool is under deletion")
 		return nil, ErrNoBlock
 	}
+	if ap.Labels[constants.LabelCordoned] == "true" {
+		p.log.Info("unable to curve out a block because pool is cordoned", "reason", ap.Annotations[constants.AnnCordonReason])
+		return nil, ErrPoolCordoned
+	}
+	if reason, ok := PauseReason(ap); ok {
+		p.log.Info("unable to curve out a block because pool is paused", "reason", reason)
+		return nil, &PauseError{Reason: reason}
+	}
+	if ap.Spec.NodeSelector != nil {
+		if err := p.checkNode(ctx, ap.Spec.NodeSelector, nodeName); err != nil {
+			return nil, err
+		}
+	}
+	if ap.Spec.ReservedBlocks > 0 && !IsCritical(ctx) {
+		free := MaxBlocks(ap) - int(p.allocated.Count())
+		if free <= int(ap.Spec.ReservedBlocks) {
+			p.log.Info("remaining blocks are reserved for critical pods", "node", nodeName, "free", free, "reserved", ap.Spec.ReservedBlocks)
+			return nil, ErrPoolReserved
+		}
+	}
+	if ap.Spec.MaxBlocksPerNode > 0 {
+		if err := p.checkNodeBlocks(ctx, int(ap.Spec.MaxBlocksPerNode), nodeName); err != nil {
+			return nil, err
+		}
+	}
 
 	var currentIndex uint
 	for _, ss := range ap.Spec.Subnets {
@@ -244,6 +383,18 @@ func (p *pool) AllocateBlock(ctx context.Context, nodeName, requestUID string) (
 			ones, bits = n.Mask.Size()
 		}
 		size := uint(1) << (bits - ones - int(ap.Spec.BlockSizeBits))
+		if !p.isAllowed(ss) {
+			currentIndex += size
+			continue
+		}
+
+		nextIndex, ok := p.allocated.NextClear(currentIndex)
+		if !ok {
+			nextIndex = p.allocated.Len()
+		}
+		if nextIndex < currentIndex {
+			nextIndex = currentIndex
+		}
 		if nextIndex >= (currentIndex + size) {
 			currentIndex += size
 			continue
@@ -261,6 +412,9 @@ func (p *pool) AllocateBlock(ctx context.Context, nodeName, requestUID string) (
 			constants.LabelNode:    nodeName,
 			constants.LabelRequest: requestUID,
 		}
+		if p.clusterName != "" {
+			r.Labels[constants.LabelCluster] = p.clusterName
+		}
 		controllerutil.AddFinalizer(r, constants.FinCoil)
 		r.Index = int32(nextIndex)
 		if ipv4 != nil {
@@ -272,6 +426,9 @@ func (p *pool) AllocateBlock(ctx context.Context, nodeName, requestUID string) (
 			r.IPv6 = &s
 		}
 		if err := p.client.Create(ctx, r); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				contention.conflicted(p.name, r.Name, OpCreateBlock)
+			}
 			p.log.Error(err, "failed to create AddressBlock", "index", nextIndex, "node", nodeName)
 			return nil, err
 		}
@@ -286,6 +443,23 @@ func (p *pool) AllocateBlock(ctx context.Context, nodeName, requestUID string) (
 	return nil, ErrNoBlock
 }
 
+func (p *pool) isAllowed(ss coilv2.SubnetSet) bool {
+	if p.guard == nil {
+		return true
+	}
+	for _, s := range []*string{ss.IPv4, ss.IPv6} {
+		if s == nil {
+			continue
+		}
+		_, n, _ := net.ParseCIDR(*s)
+		if !p.guard.Allowed(p.name, n) {
+			p.log.Info("subnet is not allowed", "subnet", n.String())
+			return false
+		}
+	}
+	return true
+}
+
 // IsUsed returns true if the pool is used by some AddressBlock.
 func (p *pool) IsUsed(ctx context.Context) (bool, error) {
 	blocks := &coilv2.AddressBlockList{}
@@ -9,6 +9,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -23,7 +25,7 @@ var _ = Describe("PoolManager", func() {
 
 	Context("default pool", func() {
 		It("should allocate blocks", func() {
-			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme)
+			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme, "", nil)
 
 			used, err := pm.IsUsed(ctx, "default")
 			Expect(err).ToNot(HaveOccurred())
@@ -39,6 +41,7 @@ var _ = Describe("PoolManager", func() {
 			Expect(block.IPv6).To(Equal(strPtr("fd02::200/127")))
 			Expect(block.Labels[constants.LabelNode]).To(Equal("node1"))
 			Expect(block.Labels[constants.LabelPool]).To(Equal("default"))
+			Expect(block.Labels).NotTo(HaveKey(constants.LabelCluster))
 			Expect(controllerutil.ContainsFinalizer(block, constants.FinCoil)).To(BeTrue())
 
 			used, err = pm.IsUsed(ctx, "default")
@@ -102,7 +105,7 @@ var _ = Describe("PoolManager", func() {
 
 	Context("IPv4 pool", func() {
 		It("should allocate blocks", func() {
-			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme)
+			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme, "cluster1", nil)
 
 			blocks := make([]*coilv2.AddressBlock, 0, 2)
 			block, err := pm.AllocateBlock(ctx, "v4", "node1", "5a6d130a-adbe-46f9-9da9-bc5da7cc5f04")
@@ -114,6 +117,7 @@ var _ = Describe("PoolManager", func() {
 			Expect(block.IPv6).To(Equal((*string)(nil)))
 			Expect(block.Labels[constants.LabelNode]).To(Equal("node1"))
 			Expect(block.Labels[constants.LabelPool]).To(Equal("v4"))
+			Expect(block.Labels[constants.LabelCluster]).To(Equal("cluster1"))
 
 			verify := &coilv2.AddressBlock{}
 			err = k8sClient.Get(ctx, client.ObjectKey{Name: block.Name}, verify)
@@ -146,4 +150,150 @@ var _ = Describe("PoolManager", func() {
 			Expect(block.Labels[constants.LabelPool]).To(Equal("v4"))
 		})
 	})
+
+	Context("pool with node selector", func() {
+		It("should allocate blocks only to selected nodes", func() {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+			Expect(err).ToNot(HaveOccurred())
+			ap.Spec.NodeSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"example.com/gpu": "true"},
+			}
+			err = k8sClient.Update(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+				Expect(err).ToNot(HaveOccurred())
+				ap.Spec.NodeSelector = nil
+				err = k8sClient.Update(ctx, ap)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: "node2"}, node)
+			Expect(err).ToNot(HaveOccurred())
+			node.Labels = map[string]string{"example.com/gpu": "true"}
+			err = k8sClient.Update(ctx, node)
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: "node2"}, node)
+				Expect(err).ToNot(HaveOccurred())
+				node.Labels = nil
+				err = k8sClient.Update(ctx, node)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme, "", nil)
+
+			Eventually(func() error {
+				_, err := pm.AllocateBlock(ctx, "v4", "node1", "5a6d130a-adbe-46f9-9da9-bc5da7cc5f04")
+				return err
+			}).Should(MatchError(ErrNodeNotSelected))
+
+			block, err := pm.AllocateBlock(ctx, "v4", "node2", "5a6d130a-adbe-46f9-9da9-bc5da7cc5f04")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Labels[constants.LabelNode]).To(Equal("node2"))
+		})
+	})
+
+	Context("pool with a limit of blocks per node", func() {
+		It("should not allocate more blocks to a node", func() {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+			Expect(err).ToNot(HaveOccurred())
+			ap.Spec.MaxBlocksPerNode = 1
+			err = k8sClient.Update(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+				Expect(err).ToNot(HaveOccurred())
+				ap.Spec.MaxBlocksPerNode = 0
+				err = k8sClient.Update(ctx, ap)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			Eventually(func() int32 {
+				cached := &coilv2.AddressPool{}
+				if err := mgr.GetClient().Get(ctx, client.ObjectKey{Name: "v4"}, cached); err != nil {
+					return 0
+				}
+				return cached.Spec.MaxBlocksPerNode
+			}).Should(Equal(int32(1)))
+
+			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme, "", nil)
+
+			_, err = pm.AllocateBlock(ctx, "v4", "node3", "8c1e5f2a-4b7d-4e9a-a3c6-0d2f7b9e1a54")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = pm.AllocateBlock(ctx, "v4", "node3", "8c1e5f2a-4b7d-4e9a-a3c6-0d2f7b9e1a55")
+			Expect(err).To(MatchError(ErrNodeBlockLimit))
+
+			block, err := pm.AllocateBlock(ctx, "v4", "node4", "8c1e5f2a-4b7d-4e9a-a3c6-0d2f7b9e1a56")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Labels[constants.LabelNode]).To(Equal("node4"))
+		})
+	})
+
+	Context("pool with reserved blocks", func() {
+		It("should allocate the reserved blocks only for critical Pods", func() {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+			Expect(err).ToNot(HaveOccurred())
+			ap.Spec.ReservedBlocks = 1
+			err = k8sClient.Update(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+				Expect(err).ToNot(HaveOccurred())
+				ap.Spec.ReservedBlocks = 0
+				err = k8sClient.Update(ctx, ap)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			Eventually(func() int32 {
+				cached := &coilv2.AddressPool{}
+				if err := mgr.GetClient().Get(ctx, client.ObjectKey{Name: "v4"}, cached); err != nil {
+					return 0
+				}
+				return cached.Spec.ReservedBlocks
+			}).Should(Equal(int32(1)))
+
+			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme, "", nil)
+
+			_, err = pm.AllocateBlock(ctx, "v4", "node1", "b2d7e4a1-6c3f-4f8e-9a05-1e7c3d9b2f60")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = pm.AllocateBlock(ctx, "v4", "node1", "b2d7e4a1-6c3f-4f8e-9a05-1e7c3d9b2f61")
+			Expect(err).To(MatchError(ErrPoolReserved))
+
+			block, err := pm.AllocateBlock(WithCritical(ctx), "v4", "node1", "b2d7e4a1-6c3f-4f8e-9a05-1e7c3d9b2f62")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Index).To(Equal(int32(1)))
+		})
+	})
+
+	Context("cordoned pool", func() {
+		It("should not allocate blocks", func() {
+			ap := &coilv2.AddressPool{}
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+			Expect(err).ToNot(HaveOccurred())
+			ap.Labels = map[string]string{constants.LabelCordoned: "true"}
+			err = k8sClient.Update(ctx, ap)
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: "v4"}, ap)
+				Expect(err).ToNot(HaveOccurred())
+				delete(ap.Labels, constants.LabelCordoned)
+				err = k8sClient.Update(ctx, ap)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			pm := NewPoolManager(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("PoolManager"), scheme, "", nil)
+
+			Eventually(func() error {
+				_, err := pm.AllocateBlock(ctx, "v4", "node1", "3f0c2b6e-7d1a-4c5e-9b8f-2a6d4e1c0b97")
+				return err
+			}).Should(MatchError(ErrPoolCordoned))
+		})
+	})
 })
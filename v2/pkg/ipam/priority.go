@@ -0,0 +1,23 @@
+package ipam
+
+import "context"
+
+// CriticalPriority is the lowest priority of system-critical Pods,
+// that is the priority of system-cluster-critical PriorityClass.
+// system-node-critical has a higher priority.
+const CriticalPriority = 2000000000
+
+type criticalKey struct{}
+
+// WithCritical returns a context to allocate addresses for system-critical
+// Pods.  Address blocks requested with the context may be carved out of
+// those kept by ReservedBlocks of the pool.
+func WithCritical(ctx context.Context) context.Context {
+	return context.WithValue(ctx, criticalKey{}, true)
+}
+
+// IsCritical returns true if `ctx` is created by WithCritical.
+func IsCritical(ctx context.Context) bool {
+	critical, _ := ctx.Value(criticalKey{}).(bool)
+	return critical
+}
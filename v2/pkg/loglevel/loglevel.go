@@ -0,0 +1,103 @@
+// Package loglevel provides the log level of Coil programs that can be
+// changed at runtime.
+package loglevel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	crzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// Setup replaces the level of `opts` with a zap.AtomicLevel and returns it.
+// The initial level is the one given by --zap-log-level, or the default of `opts`.
+//
+// This must be called after parsing flags and before creating loggers from `opts`.
+func Setup(opts *crzap.Options) zap.AtomicLevel {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	switch {
+	case opts.Level != nil:
+		level.SetLevel(minEnabled(opts.Level))
+	case opts.Development:
+		level.SetLevel(zapcore.DebugLevel)
+	}
+	opts.Level = level
+	return level
+}
+
+// minEnabled returns the lowest level enabled by `e`.
+func minEnabled(e zapcore.LevelEnabler) zapcore.Level {
+	for l := zapcore.Level(-128); l < zapcore.FatalLevel; l++ {
+		if e.Enabled(l) {
+			return l
+		}
+	}
+	return zapcore.FatalLevel
+}
+
+// Parse parses a log level in the same format as --zap-log-level.
+// It is one of "debug", "info", "error", or an integer greater than 0
+// for the verbosity of logr.
+func Parse(s string) (zapcore.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 || v > 127 {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return zapcore.Level(-v), nil
+}
+
+// String returns `l` in the format accepted by Parse.
+// Levels more verbose than debug are represented by the verbosity of logr.
+func String(l zapcore.Level) string {
+	if l < zapcore.DebugLevel {
+		return strconv.Itoa(-int(l))
+	}
+	return l.String()
+}
+
+// Payload is the JSON body of requests and responses of the handler.
+type Payload struct {
+	Level string `json:"level"`
+}
+
+// Handler returns an http.Handler to get the level by GET
+// and to change it by PUT with a JSON Payload.
+func Handler(level zap.AtomicLevel) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var p Payload
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			l, err := Parse(p.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level.SetLevel(l)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Payload{Level: String(level.Level())})
+	})
+}
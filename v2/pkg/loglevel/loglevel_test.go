@@ -0,0 +1,109 @@
+package loglevel
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	crzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestSetup(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		args     []string
+		expected zapcore.Level
+	}{
+		{nil, zapcore.InfoLevel},
+		{[]string{"-zap-devel"}, zapcore.DebugLevel},
+		{[]string{"-zap-log-level=error"}, zapcore.ErrorLevel},
+		{[]string{"-zap-log-level=3"}, zapcore.Level(-3)},
+	}
+
+	for _, tc := range testCases {
+		opts := &crzap.Options{}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		opts.BindFlags(fs)
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+
+		level := Setup(opts)
+		if level.Level() != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.args, tc.expected, level.Level())
+		}
+
+		level.SetLevel(zapcore.Level(-5))
+		if !opts.Level.Enabled(zapcore.Level(-5)) {
+			t.Errorf("%v: the level of options should be changed", tc.args)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"debug": "debug",
+		"Info":  "info",
+		"error": "error",
+		"1":     "debug",
+		"4":     "4",
+	}
+	for s, expected := range testCases {
+		l, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got := String(l); got != expected {
+			t.Errorf("%s: expected %s, got %s", s, expected, got)
+		}
+	}
+
+	for _, s := range []string{"", "warn", "0", "-1", "128", "verbose"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	opts := &crzap.Options{}
+	h := Handler(Setup(opts))
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/debug/loglevel", strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodGet, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"level":"info"}` {
+		t.Error("unexpected response:", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPut, `{"level":"3"}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"level":"3"}` {
+		t.Error("unexpected response:", w.Code, w.Body.String())
+	}
+	if !opts.Level.Enabled(zapcore.Level(-3)) {
+		t.Error("the level should be changed")
+	}
+
+	if w := do(http.MethodPut, `{"level":"warn"}`); w.Code != http.StatusBadRequest {
+		t.Error("invalid level should be rejected:", w.Code)
+	}
+	if w := do(http.MethodPut, `level=debug`); w.Code != http.StatusBadRequest {
+		t.Error("invalid body should be rejected:", w.Code)
+	}
+	if w := do(http.MethodPost, `{"level":"debug"}`); w.Code != http.StatusMethodNotAllowed {
+		t.Error("POST should not be allowed:", w.Code)
+	}
+}
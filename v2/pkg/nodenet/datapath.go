@@ -0,0 +1,129 @@
+package nodenet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/utils/sysctl"
+	"github.com/vishvananda/netlink"
+)
+
+// Names of the datapaths.  They are the same as the datapaths of AddressPool.
+const (
+	DatapathRouted  = "routed"
+	DatapathMACVLAN = "macvlan"
+)
+
+// ErrNotFound is returned by Datapath when the container is not connected by it.
+var ErrNotFound = errors.New("not found")
+
+// Datapath is a way to connect containers to the network.
+//
+// PodNetwork dispatches requests to datapaths, and serializes them.
+// Therefore, implementations need not be safe for concurrent use.
+type Datapath interface {
+	// Name returns the name of the datapath.
+	Name() string
+
+	// Init initializes the host network for the datapath.
+	Init() error
+
+	// Cleanup removes the host network configurations made by the datapath.
+	// It should be called only when no containers are connected.
+	Cleanup() error
+
+	// Setup connects the container network.
+	// `nsPath` is the container network namespace's (possibly bind-mounted) file.
+	// If `hook` is non-nil, it is called in the container network namespace.
+	Setup(nsPath, podName, podNS string, conf *PodNetConf, hook SetupHook) (*current.Result, error)
+
+	// Check checks the container network's status.
+	// It returns ErrNotFound if the container is not connected by this datapath.
+	Check(containerId, iface string) error
+
+	// Destroy disconnects the container network.
+	// It returns ErrNotFound if the container is not connected by this datapath.
+	Destroy(containerId, iface string) error
+
+	// List returns the configurations of the containers connected by this datapath.
+	List() ([]*PodNetConf, error)
+
+	// Stats returns the traffic counters of the containers connected by this datapath.
+	Stats() ([]TrafficStats, error)
+}
+
+// TrafficStats is the traffic counters of a container interface.
+// The counters are seen from the container.
+type TrafficStats struct {
+	PoolName    string
+	ContainerId string
+	IFace       string
+
+	TxPackets uint64
+	TxBytes   uint64
+	RxPackets uint64
+	RxBytes   uint64
+}
+
+// L2Conf is the configuration for datapaths that attach containers directly
+// to the L2 network of the node.
+type L2Conf struct {
+	// IPv4Net and IPv6Net are the on-link subnets of the container addresses.
+	// If nil, the address is configured as a host address.
+	IPv4Net *net.IPNet
+	IPv6Net *net.IPNet
+
+	// Gateways are the default gateways of the container.
+	Gateways []net.IP
+}
+
+// disableRA disables IPv6 router advertisements and SLAAC on the interface
+// in the current network namespace.
+func disableRA(iface string) error {
+	return setIPv6Sysctls(iface, "0", "accept_ra", "autoconf")
+}
+
+// disableSLAAC disables SLAAC on the interface in the current network namespace.
+// Router advertisements are still accepted for routes and other options.
+func disableSLAAC(iface string) error {
+	if err := setIPv6Sysctls(iface, "1", "accept_ra"); err != nil {
+		return err
+	}
+	return setIPv6Sysctls(iface, "0", "autoconf")
+}
+
+func setIPv6Sysctls(iface, value string, names ...string) error {
+	for _, name := range names {
+		key := fmt.Sprintf("net/ipv6/conf/%s/%s", iface, name)
+		if _, err := sysctl.Sysctl(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// addPodRoutes adds `routes` via `gw4` or `gw6` on the link in the current
+// network namespace.  Routes of the family whose gateway is nil are skipped.
+func addPodRoutes(l netlink.Link, routes []*net.IPNet, gw4, gw6 net.IP) error {
+	for _, dst := range routes {
+		gw := gw4
+		if dst.IP.To4() == nil {
+			gw = gw6
+		}
+		if gw == nil {
+			continue
+		}
+		err := netlink.RouteAdd(&netlink.Route{
+			Dst:       dst,
+			Gw:        gw,
+			LinkIndex: l.Attrs().Index,
+			Scope:     netlink.SCOPE_UNIVERSE,
+		})
+		if err != nil {
+			return fmt.Errorf("netlink: failed to add route to %s via %s: %w", dst.String(), gw.String(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package nodenet
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// testDatapathConformance tests the behaviors common to all Datapath implementations.
+// `nsName` is the name of an empty network namespace for a container.
+func testDatapathConformance(t *testing.T, d Datapath, nsName string, conf *PodNetConf) {
+	if err := d.Check(conf.ContainerId, conf.IFace); err != ErrNotFound {
+		t.Fatal("Check should return ErrNotFound before setup:", err)
+	}
+	if err := d.Destroy(conf.ContainerId, conf.IFace); err != ErrNotFound {
+		t.Fatal("Destroy should return ErrNotFound before setup:", err)
+	}
+
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	var hooked bool
+	result, err := d.Setup(nsPath(nsName), nsName, "ns1", conf, func(ipv4, ipv6 net.IP) error {
+		hooked = ipv4.Equal(conf.IPv4) && ipv6.Equal(conf.IPv6)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hooked {
+		t.Error("hook should be called with the addresses")
+	}
+	if len(result.Interfaces) == 0 || result.Interfaces[0].Name != conf.IFace || result.Interfaces[0].Sandbox != nsPath(nsName) {
+		t.Errorf("unexpected interfaces: %+v", result.Interfaces)
+	}
+	for _, ipc := range result.IPs {
+		if !ipc.Address.IP.Equal(conf.IPv4) && !ipc.Address.IP.Equal(conf.IPv6) {
+			t.Errorf("unexpected IP: %+v", ipc)
+		}
+	}
+
+	out, err := exec.Command("ip", "netns", "exec", nsName, "ip", "addr", "show", conf.IFace).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []net.IP{conf.IPv4, conf.IPv6} {
+		if a != nil && !strings.Contains(string(out), a.String()+"/") {
+			t.Error("address is not configured:", a, string(out))
+		}
+	}
+
+	if err := d.Check(conf.ContainerId, conf.IFace); err != nil {
+		t.Error(err)
+	}
+
+	// setting up the same container again replaces the garbage
+	if _, err := d.Setup(nsPath(nsName), nsName, "ns1", conf, nil); err != nil {
+		t.Fatal(err)
+	}
+	confs, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	for _, c := range confs {
+		if c.ContainerId != conf.ContainerId || c.IFace != conf.IFace {
+			continue
+		}
+		found++
+		if c.PoolName != conf.PoolName || !c.IPv4.Equal(conf.IPv4) || !c.IPv6.Equal(conf.IPv6) {
+			t.Errorf("unexpected config: %+v", c)
+		}
+	}
+	if found != 1 {
+		t.Error("List should return the container exactly once:", found)
+	}
+
+	stats, err := d.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = 0
+	for _, st := range stats {
+		if st.ContainerId == conf.ContainerId && st.IFace == conf.IFace && st.PoolName == conf.PoolName {
+			found++
+		}
+	}
+	if found != 1 {
+		t.Error("Stats should return the container exactly once:", found)
+	}
+
+	if err := d.Destroy(conf.ContainerId, conf.IFace); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Command("ip", "netns", "exec", nsName, "ip", "link", "show", conf.IFace).Run(); err == nil {
+		t.Error("the interface should be deleted")
+	}
+	if err := d.Check(conf.ContainerId, conf.IFace); err != ErrNotFound {
+		t.Error("Check should return ErrNotFound after destroy:", err)
+	}
+	if err := d.Destroy(conf.ContainerId, conf.IFace); err != ErrNotFound {
+		t.Error("Destroy should return ErrNotFound after destroy:", err)
+	}
+	confs, err = d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range confs {
+		if c.ContainerId == conf.ContainerId {
+			t.Error("List should not return the destroyed container")
+		}
+	}
+	stats, err = d.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range stats {
+		if st.ContainerId == conf.ContainerId {
+			t.Error("Stats should not return the destroyed container")
+		}
+	}
+
+	if err := d.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	confs, err = d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(confs) != 0 {
+		t.Error("List should return nothing after cleanup:", confs)
+	}
+}
+
+func TestDatapathConformance(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	err := exec.Command("ip", "link", "add", "uplink0", "type", "veth", "peer", "name", "uplink1").Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Command("ip", "link", "del", "uplink0").Run()
+	for _, l := range []string{"uplink0", "uplink1"} {
+		if err := exec.Command("ip", "link", "set", l, "up").Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("routed", func(t *testing.T) {
+		d := NewRoutedDatapath(117, 2001, 30, net.ParseIP("10.20.30.41"), net.ParseIP("fd10::41"),
+			false, false, ctrl.Log.WithName("routed"))
+		testDatapathConformance(t, d, "pod4", &PodNetConf{
+			PoolName:    "default",
+			ContainerId: "f8f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+			IFace:       "eth0",
+			IPv4:        net.ParseIP("10.1.2.10").To4(),
+			IPv6:        net.ParseIP("fd02::10"),
+		})
+
+		for _, family := range []string{"-4", "-6"} {
+			out, err := exec.Command("ip", family, "rule", "show").Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(out), "lookup 117") {
+				t.Error("the rule for the pod table should be removed by cleanup:", string(out))
+			}
+		}
+	})
+
+	t.Run("fastpath", func(t *testing.T) {
+		routed := NewRoutedDatapath(117, 2001, 30, net.ParseIP("10.20.30.41"), net.ParseIP("fd10::41"),
+			false, false, ctrl.Log.WithName("routed"))
+		testDatapathConformance(t, NewFastPath(routed, ctrl.Log.WithName("fastpath")), "pod4", &PodNetConf{
+			PoolName:    "default",
+			ContainerId: "f8f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+			IFace:       "eth0",
+			IPv4:        net.ParseIP("10.1.2.10").To4(),
+			IPv6:        net.ParseIP("fd02::10"),
+		})
+	})
+
+	t.Run("macvlan", func(t *testing.T) {
+		d := NewMACVLANDatapath("uplink0", t.TempDir(), ctrl.Log.WithName("macvlan"))
+		testDatapathConformance(t, d, "pod4", &PodNetConf{
+			PoolName:    "flat",
+			ContainerId: "f8f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+			IFace:       "eth0",
+			IPv4:        net.ParseIP("192.168.20.10").To4(),
+			IPv6:        net.ParseIP("fd20::10"),
+			Datapath:    DatapathMACVLAN,
+			L2: &L2Conf{
+				IPv4Net: &net.IPNet{IP: net.ParseIP("192.168.20.0").To4(), Mask: net.CIDRMask(24, 32)},
+				IPv6Net: &net.IPNet{IP: net.ParseIP("fd20::"), Mask: net.CIDRMask(64, 128)},
+			},
+		})
+	})
+}
+
+func TestRoutedExtraAddresses(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	d := NewRoutedDatapath(117, 2001, 30, net.ParseIP("10.20.30.41"), net.ParseIP("fd10::41"),
+		false, false, ctrl.Log.WithName("routed"))
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+
+	conf := &PodNetConf{
+		PoolName:    "default",
+		ContainerId: "f9f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+		IFace:       "eth0",
+		IPv4:        net.ParseIP("10.1.2.20").To4(),
+		IPv6:        net.ParseIP("fd02::20"),
+		Extra: []ExtraAddress{
+			{PoolName: "smtp", IPv4: net.ParseIP("10.3.0.1").To4(), IPv6: net.ParseIP("fd03::1")},
+			{PoolName: "snat", IPv4: net.ParseIP("10.4.0.1").To4()},
+		},
+		Routes: []*net.IPNet{
+			{IP: net.ParseIP("169.254.20.10").To4(), Mask: net.CIDRMask(32, 32)},
+		},
+	}
+	result, err := d.Setup(nsPath("pod4"), "pod4", "ns1", conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy(conf.ContainerId, conf.IFace)
+	if len(result.IPs) != 5 || !result.IPs[0].Address.IP.Equal(conf.IPv4) || !result.IPs[1].Address.IP.Equal(conf.IPv6) {
+		t.Errorf("the primary addresses should come first: %+v", result.IPs)
+	}
+
+	out, err := exec.Command("ip", "netns", "exec", "pod4", "ip", "addr", "show", conf.IFace).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []string{"10.3.0.1/", "fd03::1/", "10.4.0.1/"} {
+		if !strings.Contains(string(out), a) {
+			t.Error("extra address is not configured:", a, string(out))
+		}
+	}
+
+	out, err = exec.Command("ip", "netns", "exec", "pod4", "ip", "route", "show", "169.254.20.10").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "via 10.20.30.41") {
+		t.Error("additional route is not configured:", string(out))
+	}
+
+	// the extra addresses are reachable from the host.
+	if err := exec.Command("ping", "-c", "1", "-W", "1", "10.4.0.1").Run(); err != nil {
+		t.Error("ping to the extra address failed:", err)
+	}
+
+	confs, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(confs) != 1 {
+		t.Fatal("unexpected configs:", confs)
+	}
+	c := confs[0]
+	if !c.IPv4.Equal(conf.IPv4) || !c.IPv6.Equal(conf.IPv6) {
+		t.Errorf("the primary addresses should not be mixed with the extra ones: %+v", c)
+	}
+	if len(c.Extra) != 2 ||
+		!c.Extra[0].IPv4.Equal(conf.Extra[0].IPv4) || !c.Extra[0].IPv6.Equal(conf.Extra[0].IPv6) ||
+		!c.Extra[1].IPv4.Equal(conf.Extra[1].IPv4) || c.Extra[1].IPv6 != nil {
+		t.Errorf("unexpected extra addresses: %+v", c.Extra)
+	}
+
+	// extra addresses need the primary address of the same family.
+	conf.IPv6 = nil
+	if _, err := d.Setup(nsPath("pod4"), "pod4", "ns1", conf, nil); err == nil {
+		t.Error("an extra IPv6 address should be rejected without the primary one")
+	}
+
+	m := NewMACVLANDatapath("uplink0", t.TempDir(), ctrl.Log.WithName("macvlan"))
+	if _, err := m.Setup(nsPath("pod4"), "pod4", "ns1", conf, nil); err == nil {
+		t.Error("the macvlan datapath should reject extra addresses")
+	}
+}
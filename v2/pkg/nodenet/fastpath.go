@@ -0,0 +1,228 @@
+package nodenet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cilium/ebpf"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// FastPath is a Datapath that wraps the routed datapath to forward packets
+// between containers on the same node with eBPF, and to count their traffic.
+// Unlike the routed datapath, Stats counts packets forwarded by the fast path.
+//
+// Packets forwarded by the fast path bypass netfilter of the host, so the fast path
+// cannot be used with network policies implemented with iptables.
+type FastPath interface {
+	Datapath
+}
+
+// NewFastPath creates a FastPath for `routed`, which should be created by NewRoutedDatapath.
+// The eBPF programs are loaded by Init.
+func NewFastPath(routed Datapath, log logr.Logger) FastPath {
+	return &fastPath{
+		Datapath: routed,
+		log:      log,
+	}
+}
+
+type fastPath struct {
+	Datapath
+	log logr.Logger
+
+	objs *fastPathObjects
+}
+
+func (fp *fastPath) Init() error {
+	if err := fp.Datapath.Init(); err != nil {
+		return err
+	}
+
+	objs, err := loadFastPathObjects()
+	if err != nil {
+		return err
+	}
+	fp.objs = objs
+
+	// attach to the existing containers
+	confs, err := fp.Datapath.List()
+	if err != nil {
+		return err
+	}
+	for _, c := range confs {
+		l, err := lookup(c.ContainerId, c.IFace)
+		if err != nil {
+			return err
+		}
+		if err := fp.attach(l, c.IPv4, c.IPv6); err != nil {
+			fp.log.Error(err, "failed to attach the fast path", "container", c.ContainerId, "iface", c.IFace)
+		}
+	}
+	return nil
+}
+
+func (fp *fastPath) Setup(nsPath, podName, podNS string, conf *PodNetConf, hook SetupHook) (*current.Result, error) {
+	result, err := fp.Datapath.Setup(nsPath, podName, podNS, conf, hook)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failures are not fatal because packets are forwarded by the host network stack anyway.
+	l, err := lookup(conf.ContainerId, conf.IFace)
+	if err != nil {
+		fp.log.Error(err, "failed to find the host-side veth", "container", conf.ContainerId, "iface", conf.IFace)
+		return result, nil
+	}
+	if err := fp.attach(l, conf.IPv4, conf.IPv6); err != nil {
+		fp.log.Error(err, "failed to attach the fast path", "container", conf.ContainerId, "iface", conf.IFace)
+	}
+	return result, nil
+}
+
+func (fp *fastPath) Destroy(containerId, iface string) error {
+	if l, err := lookup(containerId, iface); err == nil {
+		if err := fp.detach(l.Attrs().Index); err != nil {
+			return err
+		}
+	}
+	return fp.Datapath.Destroy(containerId, iface)
+}
+
+func (fp *fastPath) attach(l netlink.Link, ipv4, ipv6 net.IP) error {
+	if fp.objs == nil {
+		return errors.New("the fast path is not initialized")
+	}
+
+	idx := uint32(l.Attrs().Index)
+	// values for all CPUs are initialized to zero.
+	if err := fp.objs.stats.Update(idx, []trafficValue{}, ebpf.UpdateNoExist); err != nil && !errors.Is(err, ebpf.ErrKeyExist) {
+		return fmt.Errorf("failed to add the stats entry: %w", err)
+	}
+	if ipv4 != nil {
+		if err := fp.objs.endpoints4.Put([]byte(ipv4.To4()), idx); err != nil {
+			return fmt.Errorf("failed to add the endpoint %s: %w", ipv4, err)
+		}
+	}
+	if ipv6 != nil {
+		if err := fp.objs.endpoints6.Put([]byte(ipv6.To16()), idx); err != nil {
+			return fmt.Errorf("failed to add the endpoint %s: %w", ipv6, err)
+		}
+	}
+
+	err := netlink.QdiscReplace(&netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: l.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	})
+	if err != nil {
+		return fmt.Errorf("netlink: failed to add clsact qdisc: %w", err)
+	}
+
+	filters := []struct {
+		parent uint32
+		prog   *ebpf.Program
+		name   string
+	}{
+		{netlink.HANDLE_MIN_INGRESS, fp.objs.fromContainer, "coil-from-container"},
+		{netlink.HANDLE_MIN_EGRESS, fp.objs.toContainer, "coil-to-container"},
+	}
+	for _, f := range filters {
+		err := netlink.FilterReplace(&netlink.BpfFilter{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: l.Attrs().Index,
+				Parent:    f.parent,
+				Handle:    netlink.MakeHandle(0, 1),
+				Protocol:  unix.ETH_P_ALL,
+				Priority:  1,
+			},
+			Fd:           f.prog.FD(),
+			Name:         f.name,
+			DirectAction: true,
+		})
+		if err != nil {
+			return fmt.Errorf("netlink: failed to add %s filter: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// detach removes the entries for the host-side veth.  The filters are removed
+// along with the veth.
+func (fp *fastPath) detach(ifindex int) error {
+	if fp.objs == nil {
+		return nil
+	}
+
+	idx := uint32(ifindex)
+	for _, m := range []*ebpf.Map{fp.objs.endpoints4, fp.objs.endpoints6} {
+		var keys [][]byte
+		var key []byte
+		var value uint32
+		it := m.Iterate()
+		for it.Next(&key, &value) {
+			if value == idx {
+				keys = append(keys, append([]byte(nil), key...))
+			}
+		}
+		if err := it.Err(); err != nil {
+			return fmt.Errorf("failed to iterate the endpoints: %w", err)
+		}
+		for _, k := range keys {
+			if err := m.Delete(k); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return fmt.Errorf("failed to delete the endpoint: %w", err)
+			}
+		}
+	}
+
+	if err := fp.objs.stats.Delete(idx); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("failed to delete the stats entry: %w", err)
+	}
+	return nil
+}
+
+func (fp *fastPath) Stats() ([]TrafficStats, error) {
+	if fp.objs == nil {
+		return nil, errors.New("the fast path is not initialized")
+	}
+
+	var stats []TrafficStats
+	var idx uint32
+	var values []trafficValue
+	it := fp.objs.stats.Iterate()
+	for it.Next(&idx, &values) {
+		l, err := netlink.LinkByIndex(int(idx))
+		if err != nil {
+			// the veth has been deleted concurrently.
+			continue
+		}
+		c := parseLink(l)
+		if c == nil {
+			continue
+		}
+
+		s := TrafficStats{
+			PoolName:    c.PoolName,
+			ContainerId: c.ContainerId,
+			IFace:       c.IFace,
+		}
+		for _, v := range values {
+			s.TxPackets += v.TxPackets
+			s.TxBytes += v.TxBytes
+			s.RxPackets += v.RxPackets
+			s.RxBytes += v.RxBytes
+		}
+		stats = append(stats, s)
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate the stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,75 @@
+package nodenet
+
+import (
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	podTxPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "pod", "tx_packets_total"),
+		"the number of packets sent by the Pod interface",
+		[]string{"pool", "container", "interface"}, nil,
+	)
+
+	podTxBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "pod", "tx_bytes_total"),
+		"the number of bytes sent by the Pod interface",
+		[]string{"pool", "container", "interface"}, nil,
+	)
+
+	podRxPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "pod", "rx_packets_total"),
+		"the number of packets received by the Pod interface",
+		[]string{"pool", "container", "interface"}, nil,
+	)
+
+	podRxBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(constants.MetricsNS, "pod", "rx_bytes_total"),
+		"the number of bytes received by the Pod interface",
+		[]string{"pool", "container", "interface"}, nil,
+	)
+)
+
+// NewTrafficCollector creates a prometheus.Collector that exports
+// the traffic counters of Pods collected by `fp`.
+func NewTrafficCollector(fp FastPath, log logr.Logger) prometheus.Collector {
+	return &trafficCollector{
+		fastPath: fp,
+		log:      log,
+	}
+}
+
+type trafficCollector struct {
+	fastPath FastPath
+	log      logr.Logger
+}
+
+// Describe implements prometheus.Collector.
+func (c *trafficCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- podTxPacketsDesc
+	ch <- podTxBytesDesc
+	ch <- podRxPacketsDesc
+	ch <- podRxBytesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *trafficCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.fastPath.Stats()
+	if err != nil {
+		c.log.Error(err, "failed to get traffic stats")
+		return
+	}
+
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(podTxPacketsDesc, prometheus.CounterValue,
+			float64(s.TxPackets), s.PoolName, s.ContainerId, s.IFace)
+		ch <- prometheus.MustNewConstMetric(podTxBytesDesc, prometheus.CounterValue,
+			float64(s.TxBytes), s.PoolName, s.ContainerId, s.IFace)
+		ch <- prometheus.MustNewConstMetric(podRxPacketsDesc, prometheus.CounterValue,
+			float64(s.RxPackets), s.PoolName, s.ContainerId, s.IFace)
+		ch <- prometheus.MustNewConstMetric(podRxBytesDesc, prometheus.CounterValue,
+			float64(s.RxBytes), s.PoolName, s.ContainerId, s.IFace)
+	}
+}
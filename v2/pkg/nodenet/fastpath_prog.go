@@ -0,0 +1,231 @@
+package nodenet
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"golang.org/x/sys/unix"
+)
+
+// Offsets of the fields in struct __sk_buff.
+const (
+	skbLen      = 0
+	skbProtocol = 16
+	skbIfindex  = 40
+)
+
+// Offsets of the addresses in Ethernet frames.
+const (
+	ipv4DstOffset = 14 + 16
+	ipv6DstOffset = 14 + 24
+)
+
+const (
+	tcActOK = 0
+
+	maxFastPathEndpoints = 4096
+)
+
+// trafficValue is the value type of the stats map.  The layout is shared with the programs.
+type trafficValue struct {
+	TxPackets uint64
+	TxBytes   uint64
+	RxPackets uint64
+	RxBytes   uint64
+}
+
+type fastPathObjects struct {
+	// stats maps the host-side veth ifindex to trafficValue for each CPU.
+	stats *ebpf.Map
+	// endpoints4 and endpoints6 map container addresses to the host-side veth ifindex.
+	endpoints4 *ebpf.Map
+	endpoints6 *ebpf.Map
+
+	// fromContainer is attached to the ingress of host-side veths.
+	fromContainer *ebpf.Program
+	// toContainer is attached to the egress of host-side veths.
+	toContainer *ebpf.Program
+}
+
+func (o *fastPathObjects) Close() {
+	for _, p := range []*ebpf.Program{o.fromContainer, o.toContainer} {
+		if p != nil {
+			p.Close()
+		}
+	}
+	for _, m := range []*ebpf.Map{o.stats, o.endpoints4, o.endpoints6} {
+		if m != nil {
+			m.Close()
+		}
+	}
+}
+
+func loadFastPathObjects() (_ *fastPathObjects, err error) {
+	o := &fastPathObjects{}
+	defer func() {
+		if err != nil {
+			o.Close()
+		}
+	}()
+
+	o.stats, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "coil_stats",
+		Type:       ebpf.PerCPUHash,
+		KeySize:    4,
+		ValueSize:  uint32(unsafe.Sizeof(trafficValue{})),
+		MaxEntries: maxFastPathEndpoints,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the stats map: %w", err)
+	}
+	o.endpoints4, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "coil_ep4",
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: maxFastPathEndpoints,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the IPv4 endpoints map: %w", err)
+	}
+	o.endpoints6, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "coil_ep6",
+		Type:       ebpf.Hash,
+		KeySize:    16,
+		ValueSize:  4,
+		MaxEntries: maxFastPathEndpoints,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the IPv6 endpoints map: %w", err)
+	}
+
+	o.fromContainer, err = ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "coil_from_ctr",
+		Type:         ebpf.SchedCLS,
+		License:      "GPL",
+		Instructions: fromContainerInsns(o.stats.FD(), o.endpoints4.FD(), o.endpoints6.FD()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the program for container ingress: %w", err)
+	}
+	o.toContainer, err = ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "coil_to_ctr",
+		Type:         ebpf.SchedCLS,
+		License:      "GPL",
+		Instructions: toContainerInsns(o.stats.FD()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the program for container egress: %w", err)
+	}
+
+	return o, nil
+}
+
+// countInsns adds 1 to the packet counter and R8 to the byte counter
+// at `offset` of the trafficValue pointed by R0.
+func countInsns(offset int16) asm.Instructions {
+	return asm.Instructions{
+		asm.LoadMem(asm.R1, asm.R0, offset, asm.DWord),
+		asm.Add.Imm(asm.R1, 1),
+		asm.StoreMem(asm.R0, offset, asm.R1, asm.DWord),
+		asm.LoadMem(asm.R1, asm.R0, offset+8, asm.DWord),
+		asm.Add.Reg(asm.R1, asm.R8),
+		asm.StoreMem(asm.R0, offset+8, asm.R1, asm.DWord),
+	}
+}
+
+// fromContainerInsns returns a program that counts packets sent by the container,
+// and redirects them to the destination container on the same node, if any.
+//
+// Registers: R6 = skb, R7 = ifindex of the source, R8 = packet length,
+// R9 = ifindex of the destination.
+func fromContainerInsns(statsFD, ep4FD, ep6FD int) asm.Instructions {
+	insns := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.LoadMem(asm.R8, asm.R6, skbLen, asm.Word),
+		asm.LoadMem(asm.R7, asm.R6, skbIfindex, asm.Word),
+		asm.StoreMem(asm.RFP, -4, asm.R7, asm.Word),
+		asm.LoadMapPtr(asm.R1, statsFD),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "classify"),
+	}
+	insns = append(insns, countInsns(int16(unsafe.Offsetof(trafficValue{}.TxPackets)))...)
+	insns = append(insns,
+		asm.LoadMem(asm.R2, asm.R6, skbProtocol, asm.Word).Sym("classify"),
+		asm.JEq.Imm(asm.R2, int32(htons(unix.ETH_P_IP)), "ipv4"),
+		asm.JEq.Imm(asm.R2, int32(htons(unix.ETH_P_IPV6)), "ipv6"),
+		asm.Ja.Label("pass"),
+
+		// load the destination address into the stack and look up the endpoint
+		asm.Mov.Reg(asm.R1, asm.R6).Sym("ipv4"),
+		asm.Mov.Imm(asm.R2, ipv4DstOffset),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -24),
+		asm.Mov.Imm(asm.R4, 4),
+		asm.FnSkbLoadBytes.Call(),
+		asm.JNE.Imm(asm.R0, 0, "pass"),
+		asm.LoadMapPtr(asm.R1, ep4FD),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -24),
+		asm.FnMapLookupElem.Call(),
+		asm.Ja.Label("found"),
+
+		asm.Mov.Reg(asm.R1, asm.R6).Sym("ipv6"),
+		asm.Mov.Imm(asm.R2, ipv6DstOffset),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -24),
+		asm.Mov.Imm(asm.R4, 16),
+		asm.FnSkbLoadBytes.Call(),
+		asm.JNE.Imm(asm.R0, 0, "pass"),
+		asm.LoadMapPtr(asm.R1, ep6FD),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -24),
+		asm.FnMapLookupElem.Call(),
+
+		asm.JEq.Imm(asm.R0, 0, "pass").Sym("found"),
+		asm.LoadMem(asm.R9, asm.R0, 0, asm.Word),
+		asm.StoreMem(asm.RFP, -8, asm.R9, asm.Word),
+		asm.LoadMapPtr(asm.R1, statsFD),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "redirect"),
+	)
+	insns = append(insns, countInsns(int16(unsafe.Offsetof(trafficValue{}.RxPackets)))...)
+	insns = append(insns,
+		// bpf_redirect_peer delivers the packet to the ingress of the container
+		// interface without going through the host network stack.
+		asm.Mov.Reg(asm.R1, asm.R9).Sym("redirect"),
+		asm.Mov.Imm(asm.R2, 0),
+		asm.FnRedirectPeer.Call(),
+		asm.Return(),
+
+		asm.Mov.Imm(asm.R0, tcActOK).Sym("pass"),
+		asm.Return(),
+	)
+	return insns
+}
+
+// toContainerInsns returns a program that counts packets received by the container.
+func toContainerInsns(statsFD int) asm.Instructions {
+	insns := asm.Instructions{
+		asm.LoadMem(asm.R8, asm.R1, skbLen, asm.Word),
+		asm.LoadMem(asm.R7, asm.R1, skbIfindex, asm.Word),
+		asm.StoreMem(asm.RFP, -4, asm.R7, asm.Word),
+		asm.LoadMapPtr(asm.R1, statsFD),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "pass"),
+	}
+	insns = append(insns, countInsns(int16(unsafe.Offsetof(trafficValue{}.RxPackets)))...)
+	insns = append(insns,
+		asm.Mov.Imm(asm.R0, tcActOK).Sym("pass"),
+		asm.Return(),
+	)
+	return insns
+}
@@ -0,0 +1,135 @@
+package nodenet
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// sendUDP sends `n` UDP packets from the netns `from` to `dst` in the netns `to`,
+// and waits for the replies.
+func sendUDP(t *testing.T, from, to string, dst net.IP, n int) error {
+	toNS, err := ns.GetNS(nsPath(to))
+	if err != nil {
+		return err
+	}
+	defer toNS.Close()
+	fromNS, err := ns.GetNS(nsPath(from))
+	if err != nil {
+		return err
+	}
+	defer fromNS.Close()
+
+	var server *net.UDPConn
+	err = toNS.Do(func(ns.NetNS) error {
+		var err error
+		server, err = net.ListenUDP("udp", &net.UDPAddr{IP: dst, Port: 9999})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 100)
+		for {
+			n, addr, err := server.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			server.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	return fromNS.Do(func(ns.NetNS) error {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: dst, Port: 9999})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 100)
+		for i := 0; i < n; i++ {
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				return err
+			}
+			conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+			if _, err := conn.Read(buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestFastPath(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	routed := NewRoutedDatapath(118, 2002, 30, net.ParseIP("10.20.30.41"), net.ParseIP("fd10::41"),
+		false, false, ctrl.Log.WithName("routed"))
+	fp := NewFastPath(routed, ctrl.Log.WithName("fastpath"))
+	if err := fp.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	confs := map[string]*PodNetConf{
+		"pod4": {
+			PoolName:    "default",
+			ContainerId: "a1f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+			IFace:       "eth0",
+			IPv4:        net.ParseIP("10.1.3.4").To4(),
+			IPv6:        net.ParseIP("fd02::304"),
+		},
+		"pod5": {
+			PoolName:    "default",
+			ContainerId: "a2f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+			IFace:       "eth0",
+			IPv4:        net.ParseIP("10.1.3.5").To4(),
+			IPv6:        net.ParseIP("fd02::305"),
+		},
+	}
+	for name, conf := range confs {
+		if _, err := fp.Setup(nsPath(name), name, "ns1", conf, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer fp.Destroy(conf.ContainerId, conf.IFace)
+	}
+
+	for _, dst := range []net.IP{confs["pod5"].IPv4, confs["pod5"].IPv6} {
+		if err := sendUDP(t, "pod4", "pod5", dst, 3); err != nil {
+			t.Error("failed to send packets to", dst, err)
+		}
+	}
+
+	stats, err := fp.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatal("unexpected stats:", stats)
+	}
+	for _, s := range stats {
+		if s.TxPackets == 0 || s.RxPackets == 0 || s.TxBytes == 0 || s.RxBytes == 0 {
+			t.Errorf("unexpected counters: %+v", s)
+		}
+	}
+
+	c := confs["pod5"]
+	if err := fp.Destroy(c.ContainerId, c.IFace); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = fp.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].ContainerId != confs["pod4"].ContainerId {
+		t.Error("stats of the destroyed container should be removed:", stats)
+	}
+}
@@ -0,0 +1,454 @@
+package nodenet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NewMACVLANDatapath creates a Datapath that attaches containers to the
+// `uplink` interface with macvlan interfaces in bridge mode.
+//
+// The containers are recorded in `stateDir` because their interfaces are not
+// visible from the host network namespace.
+func NewMACVLANDatapath(uplink, stateDir string, log logr.Logger) Datapath {
+	return &macvlanDatapath{
+		uplink:   uplink,
+		stateDir: stateDir,
+		log:      log,
+	}
+}
+
+type macvlanDatapath struct {
+	uplink   string
+	stateDir string
+	log      logr.Logger
+}
+
+func (d *macvlanDatapath) Name() string {
+	return DatapathMACVLAN
+}
+
+func (d *macvlanDatapath) Init() error {
+	return nil
+}
+
+func (d *macvlanDatapath) Cleanup() error {
+	if err := os.RemoveAll(d.stateDir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", d.stateDir, err)
+	}
+	return nil
+}
+
+// macvlanState is recorded in the state directory for each Pod attached with
+// macvlan because the interface is not visible from the host network namespace.
+type macvlanState struct {
+	PoolName    string `json:"pool"`
+	ContainerId string `json:"container_id"`
+	IFace       string `json:"ifname"`
+	Netns       string `json:"netns"`
+	IPv4        net.IP `json:"ipv4,omitempty"`
+	IPv6        net.IP `json:"ipv6,omitempty"`
+}
+
+func macvlanStateFile(dir, containerId, iface string) (string, error) {
+	// container IDs and interface names never contain colons.
+	if strings.ContainsAny(containerId+iface, "/:") || strings.HasPrefix(containerId, ".") {
+		return "", fmt.Errorf("invalid container ID or interface name: %s %s", containerId, iface)
+	}
+	return filepath.Join(dir, containerId+":"+iface+".json"), nil
+}
+
+func (d *macvlanDatapath) saveMACVLANState(st *macvlanState) error {
+	p, err := macvlanStateFile(d.stateDir, st.ContainerId, st.IFace)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.stateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", d.stateDir, err)
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(d.stateDir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// loadMACVLANState returns nil if the container is not attached with macvlan.
+func (d *macvlanDatapath) loadMACVLANState(containerId, iface string) (*macvlanState, error) {
+	p, err := macvlanStateFile(d.stateDir, containerId, iface)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	st := &macvlanState{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("broken state file %s: %w", p, err)
+	}
+	return st, nil
+}
+
+func (d *macvlanDatapath) listMACVLANStates() ([]*macvlanState, error) {
+	files, err := os.ReadDir(d.stateDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var states []*macvlanState
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(d.stateDir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		st := &macvlanState{}
+		if err := json.Unmarshal(data, st); err != nil {
+			d.log.Error(err, "ignoring a broken state file", "file", fi.Name())
+			continue
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+func (d *macvlanDatapath) Setup(nsPath, podName, podNS string, conf *PodNetConf, hook SetupHook) (*current.Result, error) {
+	if len(conf.Extra) > 0 {
+		return nil, fmt.Errorf("%s datapath does not support extra addresses", DatapathMACVLAN)
+	}
+
+	// cleanup garbage interface
+	st, err := d.loadMACVLANState(conf.ContainerId, conf.IFace)
+	if err != nil {
+		return nil, err
+	}
+	if st != nil {
+		if err := d.destroyMACVLAN(st); err != nil {
+			return nil, fmt.Errorf("failed to delete broken link: %w", err)
+		}
+	}
+
+	parent, err := netlink.LinkByName(d.uplink)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to get link %s: %w", d.uplink, err)
+	}
+
+	containerNS, err := ns.GetNS(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netns path %s: %w", nsPath, err)
+	}
+	defer containerNS.Close()
+
+	// create the interface with a temporary name to avoid conflicts in the host netns.
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+	err = netlink.LinkAdd(&netlink.Macvlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        tmpName,
+			ParentIndex: parent.Attrs().Index,
+			MTU:         parent.Attrs().MTU,
+			Namespace:   netlink.NsFd(int(containerNS.Fd())),
+		},
+		Mode: netlink.MACVLAN_MODE_BRIDGE,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to add macvlan: %w", err)
+	}
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+	}
+	err = containerNS.Do(func(ns.NetNS) error {
+		l, err := netlink.LinkByName(tmpName)
+		if err != nil {
+			return fmt.Errorf("netlink: failed to find macvlan: %w", err)
+		}
+		if err := d.configureMACVLAN(l, nsPath, conf, hook, result); err != nil {
+			netlink.LinkDel(l)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.saveMACVLANState(&macvlanState{
+		PoolName:    conf.PoolName,
+		ContainerId: conf.ContainerId,
+		IFace:       conf.IFace,
+		Netns:       nsPath,
+		IPv4:        conf.IPv4,
+		IPv6:        conf.IPv6,
+	})
+	if err != nil {
+		containerNS.Do(func(ns.NetNS) error {
+			if l, err := netlink.LinkByName(conf.IFace); err == nil {
+				netlink.LinkDel(l)
+			}
+			return nil
+		})
+		return nil, fmt.Errorf("failed to save the state: %w", err)
+	}
+
+	return result, nil
+}
+
+// configureMACVLAN configures the macvlan interface in the container netns.
+func (d *macvlanDatapath) configureMACVLAN(l netlink.Link, nsPath string, conf *PodNetConf, hook SetupHook, result *current.Result) error {
+	if err := netlink.LinkSetName(l, conf.IFace); err != nil {
+		return fmt.Errorf("netlink: failed to rename macvlan to %s: %w", conf.IFace, err)
+	}
+	if conf.IPv6 != nil && !conf.AcceptRA {
+		if err := disableRA(conf.IFace); err != nil {
+			return err
+		}
+	}
+	if err := netlink.LinkSetUp(l); err != nil {
+		return fmt.Errorf("netlink: failed to bring up %s: %w", conf.IFace, err)
+	}
+
+	l2 := conf.L2
+	if l2 == nil {
+		l2 = &L2Conf{}
+	}
+
+	idx := 0
+	addAddr := func(addr net.IP, subnet *net.IPNet) error {
+		ipnet := netlink.NewIPNet(addr)
+		if subnet != nil {
+			ipnet.Mask = subnet.Mask
+		}
+		err := netlink.AddrAdd(l, &netlink.Addr{
+			IPNet: ipnet,
+			Scope: unix.RT_SCOPE_UNIVERSE,
+		})
+		if err != nil {
+			return fmt.Errorf("netlink: failed to add an address: %w", err)
+		}
+		ipc := &current.IPConfig{
+			Address:   *ipnet,
+			Interface: &idx,
+		}
+		for _, gw := range l2.Gateways {
+			if (gw.To4() != nil) == (addr.To4() != nil) {
+				ipc.Gateway = gw
+			}
+		}
+		result.IPs = append(result.IPs, ipc)
+		return nil
+	}
+	if conf.IPv4 != nil {
+		if err := addAddr(conf.IPv4, l2.IPv4Net); err != nil {
+			return err
+		}
+	}
+	if conf.IPv6 != nil {
+		if err := addAddr(conf.IPv6, l2.IPv6Net); err != nil {
+			return err
+		}
+		ip.SettleAddresses(conf.IFace, 10)
+	}
+
+	for _, ipc := range result.IPs {
+		if ipc.Gateway == nil || conf.NoDefaultRoute {
+			continue
+		}
+		dst := defaultGWv4
+		if ipc.Gateway.To4() == nil {
+			dst = defaultGWv6
+		}
+		err := netlink.RouteAdd(&netlink.Route{
+			Dst:       dst,
+			Gw:        ipc.Gateway,
+			LinkIndex: l.Attrs().Index,
+			Scope:     netlink.SCOPE_UNIVERSE,
+		})
+		if err != nil {
+			return fmt.Errorf("netlink: failed to add default gw %s: %w", ipc.Gateway.String(), err)
+		}
+	}
+
+	var gw4, gw6 net.IP
+	for _, ipc := range result.IPs {
+		if ipc.Gateway.To4() != nil {
+			gw4 = ipc.Gateway
+		} else if ipc.Gateway != nil {
+			gw6 = ipc.Gateway
+		}
+	}
+	if err := addPodRoutes(l, conf.Routes, gw4, gw6); err != nil {
+		return err
+	}
+
+	l, err := netlink.LinkByIndex(l.Attrs().Index)
+	if err != nil {
+		return fmt.Errorf("netlink: failed to get link %s: %w", conf.IFace, err)
+	}
+	result.Interfaces = []*current.Interface{
+		{
+			Name:    conf.IFace,
+			Mac:     l.Attrs().HardwareAddr.String(),
+			Sandbox: nsPath,
+		},
+	}
+
+	if hook != nil {
+		return hook(conf.IPv4, conf.IPv6)
+	}
+	return nil
+}
+
+func (d *macvlanDatapath) Check(containerId, iface string) error {
+	st, err := d.loadMACVLANState(containerId, iface)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (d *macvlanDatapath) Destroy(containerId, iface string) error {
+	st, err := d.loadMACVLANState(containerId, iface)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return ErrNotFound
+	}
+	return d.destroyMACVLAN(st)
+}
+
+func (d *macvlanDatapath) List() ([]*PodNetConf, error) {
+	states, err := d.listMACVLANStates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list macvlan states: %w", err)
+	}
+
+	var confs []*PodNetConf
+	for _, st := range states {
+		confs = append(confs, &PodNetConf{
+			PoolName:    st.PoolName,
+			ContainerId: st.ContainerId,
+			IFace:       st.IFace,
+			IPv4:        st.IPv4,
+			IPv6:        st.IPv6,
+			Datapath:    DatapathMACVLAN,
+		})
+	}
+	return confs, nil
+}
+
+func (d *macvlanDatapath) Stats() ([]TrafficStats, error) {
+	states, err := d.listMACVLANStates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list macvlan states: %w", err)
+	}
+
+	var stats []TrafficStats
+	for _, st := range states {
+		containerNS, err := ns.GetNS(st.Netns)
+		if err != nil {
+			// The netns may be removed concurrently.
+			continue
+		}
+		var ls *netlink.LinkStatistics
+		err = containerNS.Do(func(ns.NetNS) error {
+			l, err := netlink.LinkByName(st.IFace)
+			if err != nil {
+				return err
+			}
+			ls = l.Attrs().Statistics
+			return nil
+		})
+		containerNS.Close()
+		if err != nil || ls == nil {
+			continue
+		}
+		stats = append(stats, TrafficStats{
+			PoolName:    st.PoolName,
+			ContainerId: st.ContainerId,
+			IFace:       st.IFace,
+			TxPackets:   ls.TxPackets,
+			TxBytes:     ls.TxBytes,
+			RxPackets:   ls.RxPackets,
+			RxBytes:     ls.RxBytes,
+		})
+	}
+	return stats, nil
+}
+
+func (d *macvlanDatapath) destroyMACVLAN(st *macvlanState) error {
+	containerNS, err := ns.GetNS(st.Netns)
+	switch err.(type) {
+	case nil:
+		err = containerNS.Do(func(ns.NetNS) error {
+			l, err := netlink.LinkByName(st.IFace)
+			if err != nil {
+				if _, ok := err.(netlink.LinkNotFoundError); ok {
+					return nil
+				}
+				return fmt.Errorf("netlink: failed to get link %s: %w", st.IFace, err)
+			}
+			if err := netlink.LinkDel(l); err != nil && !errors.Is(err, unix.ENODEV) {
+				return fmt.Errorf("netlink: failed to delete link: %w", err)
+			}
+			return nil
+		})
+		containerNS.Close()
+		if err != nil {
+			return err
+		}
+	case ns.NSPathNotExistErr, ns.NSPathNotNSErr:
+		// The netns has been removed along with the macvlan interface in it.
+	default:
+		return fmt.Errorf("failed to open netns path %s: %w", st.Netns, err)
+	}
+
+	p, err := macvlanStateFile(d.stateDir, st.ContainerId, st.IFace)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package nodenet
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-logr/logr"
+)
+
+// MasqueradeChain is the name of the iptables chain in the nat table
+// to masquerade traffic from Pods.
+const MasqueradeChain = "COIL-MASQUERADE"
+
+// Masquerader masquerades traffic from Pods leaving the node through an
+// uplink interface.  This allows Pods with non-routable addresses to reach
+// the outside of the cluster without a separate NAT setup.
+type Masquerader interface {
+	// Sync makes the rules masquerade traffic from `sources` to destinations
+	// other than `exclude`.
+	Sync(sources, exclude []*net.IPNet) error
+
+	// Cleanup removes all the rules.
+	Cleanup() error
+}
+
+// IPTables is the set of iptables operations to program masquerade rules.
+// *iptables.IPTables implements this interface.
+type IPTables interface {
+	ChainExists(table, chain string) (bool, error)
+	ClearChain(table, chain string) error
+	ClearAndDeleteChain(table, chain string) error
+	List(table, chain string) ([]string, error)
+	Append(table, chain string, rulespec ...string) error
+	AppendUnique(table, chain string, rulespec ...string) error
+	DeleteIfExists(table, chain string, rulespec ...string) error
+}
+
+var _ IPTables = &iptables.IPTables{}
+
+// NewMasquerader creates a Masquerader for the uplink interface `ifName`.
+func NewMasquerader(ifName string, log logr.Logger) Masquerader {
+	return &masquerader{
+		ifName: ifName,
+		log:    log,
+		newIPTables: func(proto iptables.Protocol) (IPTables, error) {
+			return iptables.NewWithProtocol(proto)
+		},
+	}
+}
+
+type masquerader struct {
+	ifName      string
+	log         logr.Logger
+	newIPTables func(proto iptables.Protocol) (IPTables, error)
+
+	mu sync.Mutex
+}
+
+func filterFamily(subnets []*net.IPNet, proto iptables.Protocol) []*net.IPNet {
+	var filtered []*net.IPNet
+	for _, n := range subnets {
+		isIPv4 := n.IP.To4() != nil
+		if isIPv4 == (proto == iptables.ProtocolIPv4) {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered
+}
+
+func (m *masquerader) jumpRule() []string {
+	return []string{"-o", m.ifName, "-j", MasqueradeChain}
+}
+
+func (m *masquerader) Sync(sources, exclude []*net.IPNet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		srcs := filterFamily(sources, proto)
+		ipt, err := m.newIPTables(proto)
+		if err != nil {
+			if len(srcs) == 0 {
+				// the node may not support this family at all.
+				continue
+			}
+			return err
+		}
+		if err := m.sync(ipt, srcs, filterFamily(exclude, proto)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *masquerader) sync(ipt IPTables, sources, exclude []*net.IPNet) error {
+	if len(sources) == 0 {
+		exists, err := ipt.ChainExists("nat", MasqueradeChain)
+		if err != nil {
+			return fmt.Errorf("iptables: failed to check chain %s: %w", MasqueradeChain, err)
+		}
+		if !exists {
+			return nil
+		}
+		exclude = nil
+	}
+
+	var rules [][]string
+	for _, n := range exclude {
+		rules = append(rules, []string{"-d", n.String(), "-j", "RETURN"})
+	}
+	for _, n := range sources {
+		rules = append(rules, []string{"-s", n.String(), "-j", "MASQUERADE"})
+	}
+
+	current, err := ipt.List("nat", MasqueradeChain)
+	if err != nil {
+		// the chain does not exist yet.
+		current = nil
+	}
+	desired := []string{"-N " + MasqueradeChain}
+	for _, r := range rules {
+		desired = append(desired, "-A "+MasqueradeChain+" "+strings.Join(r, " "))
+	}
+	if !equalStrings(current, desired) {
+		if err := ipt.ClearChain("nat", MasqueradeChain); err != nil {
+			return fmt.Errorf("iptables: failed to clear chain %s: %w", MasqueradeChain, err)
+		}
+		for _, r := range rules {
+			if err := ipt.Append("nat", MasqueradeChain, r...); err != nil {
+				return fmt.Errorf("iptables: failed to append rule %v: %w", r, err)
+			}
+		}
+		m.log.Info("updated masquerade rules", "sources", len(sources), "excludes", len(exclude))
+	}
+
+	if err := ipt.AppendUnique("nat", "POSTROUTING", m.jumpRule()...); err != nil {
+		return fmt.Errorf("iptables: failed to jump to %s: %w", MasqueradeChain, err)
+	}
+	return nil
+}
+
+func (m *masquerader) Cleanup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := m.newIPTables(proto)
+		if err != nil {
+			continue
+		}
+		exists, err := ipt.ChainExists("nat", MasqueradeChain)
+		if err != nil {
+			return fmt.Errorf("iptables: failed to check chain %s: %w", MasqueradeChain, err)
+		}
+		if !exists {
+			continue
+		}
+		if err := ipt.DeleteIfExists("nat", "POSTROUTING", m.jumpRule()...); err != nil {
+			return fmt.Errorf("iptables: failed to delete jump to %s: %w", MasqueradeChain, err)
+		}
+		if err := ipt.ClearAndDeleteChain("nat", MasqueradeChain); err != nil {
+			return fmt.Errorf("iptables: failed to delete chain %s: %w", MasqueradeChain, err)
+		}
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
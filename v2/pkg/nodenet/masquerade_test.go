@@ -0,0 +1,163 @@
+package nodenet
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-iptables/iptables"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type mockIPTables struct {
+	chains  map[string][]string
+	appends int
+}
+
+var _ IPTables = &mockIPTables{}
+
+func newMockIPTables() *mockIPTables {
+	return &mockIPTables{chains: map[string][]string{"nat/POSTROUTING": nil}}
+}
+
+func (m *mockIPTables) ChainExists(table, chain string) (bool, error) {
+	_, ok := m.chains[table+"/"+chain]
+	return ok, nil
+}
+
+func (m *mockIPTables) ClearChain(table, chain string) error {
+	m.chains[table+"/"+chain] = nil
+	return nil
+}
+
+func (m *mockIPTables) ClearAndDeleteChain(table, chain string) error {
+	delete(m.chains, table+"/"+chain)
+	return nil
+}
+
+func (m *mockIPTables) List(table, chain string) ([]string, error) {
+	rules, ok := m.chains[table+"/"+chain]
+	if !ok {
+		return nil, errors.New("no such chain")
+	}
+	list := []string{"-N " + chain}
+	for _, r := range rules {
+		list = append(list, "-A "+chain+" "+r)
+	}
+	return list, nil
+}
+
+func (m *mockIPTables) Append(table, chain string, rulespec ...string) error {
+	key := table + "/" + chain
+	if _, ok := m.chains[key]; !ok {
+		return errors.New("no such chain")
+	}
+	m.chains[key] = append(m.chains[key], strings.Join(rulespec, " "))
+	m.appends++
+	return nil
+}
+
+func (m *mockIPTables) AppendUnique(table, chain string, rulespec ...string) error {
+	rule := strings.Join(rulespec, " ")
+	for _, r := range m.chains[table+"/"+chain] {
+		if r == rule {
+			return nil
+		}
+	}
+	return m.Append(table, chain, rulespec...)
+}
+
+func (m *mockIPTables) DeleteIfExists(table, chain string, rulespec ...string) error {
+	key := table + "/" + chain
+	rule := strings.Join(rulespec, " ")
+	for i, r := range m.chains[key] {
+		if r == rule {
+			m.chains[key] = append(m.chains[key][:i], m.chains[key][i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func parseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	var subnets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subnets = append(subnets, n)
+	}
+	return subnets
+}
+
+func TestMasquerader(t *testing.T) {
+	t.Parallel()
+
+	ipt4 := newMockIPTables()
+	m := NewMasquerader("eth0", ctrl.Log.WithName("masquerade")).(*masquerader)
+	m.newIPTables = func(proto iptables.Protocol) (IPTables, error) {
+		if proto == iptables.ProtocolIPv6 {
+			return nil, errors.New("ip6tables is not available")
+		}
+		return ipt4, nil
+	}
+
+	err := m.Sync(nil, parseCIDRs(t, "10.100.0.0/16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ipt4.chains["nat/"+MasqueradeChain]; ok {
+		t.Error("the chain should not be created without sources")
+	}
+
+	err = m.Sync(parseCIDRs(t, "10.100.0.0/16"), parseCIDRs(t, "10.100.0.0/16", "10.200.0.0/16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"-d 10.100.0.0/16 -j RETURN",
+		"-d 10.200.0.0/16 -j RETURN",
+		"-s 10.100.0.0/16 -j MASQUERADE",
+	}
+	if !equalStrings(ipt4.chains["nat/"+MasqueradeChain], expected) {
+		t.Error("unexpected rules:", ipt4.chains["nat/"+MasqueradeChain])
+	}
+	if !equalStrings(ipt4.chains["nat/POSTROUTING"], []string{"-o eth0 -j " + MasqueradeChain}) {
+		t.Error("unexpected POSTROUTING rules:", ipt4.chains["nat/POSTROUTING"])
+	}
+
+	appends := ipt4.appends
+	err = m.Sync(parseCIDRs(t, "10.100.0.0/16"), parseCIDRs(t, "10.100.0.0/16", "10.200.0.0/16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ipt4.appends != appends {
+		t.Error("rules should not be rewritten if unchanged")
+	}
+
+	err = m.Sync(parseCIDRs(t, "fd00::/64"), nil)
+	if err == nil {
+		t.Error("Sync should fail if ip6tables is not available for IPv6 sources")
+	}
+
+	err = m.Sync(nil, parseCIDRs(t, "10.100.0.0/16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := ipt4.chains["nat/"+MasqueradeChain]; len(rules) != 0 {
+		t.Error("rules should be removed:", rules)
+	}
+
+	err = m.Cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ipt4.chains["nat/"+MasqueradeChain]; ok {
+		t.Error("the chain should be deleted")
+	}
+	if rules := ipt4.chains["nat/POSTROUTING"]; len(rules) != 0 {
+		t.Error("the jump should be deleted:", rules)
+	}
+}
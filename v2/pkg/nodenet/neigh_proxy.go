@@ -0,0 +1,137 @@
+package nodenet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/containernetworking/plugins/pkg/utils/sysctl"
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+)
+
+// NeighborProxy makes the node answer ARP and NDP requests for Pod addresses
+// on an uplink interface.  This allows Pods to be reached in a flat L2 network
+// without routes to the address blocks of each node.
+type NeighborProxy interface {
+	// Sync makes the proxy entries on the uplink interface exactly match `ips`.
+	Sync(ips []net.IP) error
+}
+
+// NeighHandle is the set of netlink operations to program proxy neighbor entries.
+// *netlink.Handle implements this interface.
+type NeighHandle interface {
+	LinkByName(name string) (netlink.Link, error)
+	NeighProxyList(linkIndex, family int) ([]netlink.Neigh, error)
+	NeighAdd(neigh *netlink.Neigh) error
+	NeighDel(neigh *netlink.Neigh) error
+}
+
+var _ NeighHandle = &netlink.Handle{}
+
+// NewNeighborProxy creates a NeighborProxy for the uplink interface `ifName`.
+func NewNeighborProxy(ifName string, log logr.Logger) NeighborProxy {
+	return &neighborProxy{
+		ifName: ifName,
+		log:    log,
+		newHandle: func() (NeighHandle, func(), error) {
+			h, err := netlink.NewHandle()
+			if err != nil {
+				return nil, nil, err
+			}
+			return h, h.Delete, nil
+		},
+		enableNDP: enableProxyNDP,
+	}
+}
+
+type neighborProxy struct {
+	ifName    string
+	log       logr.Logger
+	newHandle func() (NeighHandle, func(), error)
+	enableNDP func(ifName string) error
+
+	mu sync.Mutex
+}
+
+func enableProxyNDP(ifName string) error {
+	key := fmt.Sprintf("net/ipv6/conf/%s/proxy_ndp", ifName)
+	if _, err := sysctl.Sysctl(key, "1"); err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+	return nil
+}
+
+func (p *neighborProxy) Sync(ips []net.IP) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, closeHandle, err := p.newHandle()
+	if err != nil {
+		return fmt.Errorf("netlink: failed to open handle: %w", err)
+	}
+	defer closeHandle()
+
+	link, err := h.LinkByName(p.ifName)
+	if err != nil {
+		return fmt.Errorf("netlink: failed to get link %s: %w", p.ifName, err)
+	}
+	linkIndex := link.Attrs().Index
+
+	desired := make(map[string]net.IP)
+	hasIPv6 := false
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			hasIPv6 = true
+		}
+		desired[ip.String()] = ip
+	}
+	if hasIPv6 {
+		// Linux answers NDP for proxy entries only when proxy_ndp is enabled.
+		// proxy_arp need not be enabled for IPv4 entries.
+		if err := p.enableNDP(p.ifName); err != nil {
+			return err
+		}
+	}
+
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		current, err := h.NeighProxyList(linkIndex, family)
+		if err != nil {
+			return fmt.Errorf("netlink: failed to list proxy neighbors: %w", err)
+		}
+		for _, n := range current {
+			if n.Flags&netlink.NTF_PROXY == 0 {
+				continue
+			}
+			key := n.IP.String()
+			if _, ok := desired[key]; ok {
+				delete(desired, key)
+				continue
+			}
+			n := n
+			if err := h.NeighDel(&n); err != nil {
+				return fmt.Errorf("netlink: failed to delete proxy neighbor %s: %w", key, err)
+			}
+			p.log.Info("deleted proxy neighbor", "ip", key, "iface", p.ifName)
+		}
+	}
+
+	for key, ip := range desired {
+		family := netlink.FAMILY_V4
+		if ip.To4() == nil {
+			family = netlink.FAMILY_V6
+		}
+		err := h.NeighAdd(&netlink.Neigh{
+			LinkIndex: linkIndex,
+			Family:    family,
+			Flags:     netlink.NTF_PROXY,
+			IP:        ip,
+		})
+		if err != nil {
+			return fmt.Errorf("netlink: failed to add proxy neighbor %s: %w", key, err)
+		}
+		p.log.Info("added proxy neighbor", "ip", key, "iface", p.ifName)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package nodenet
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type mockNeighHandle struct {
+	neighs []netlink.Neigh
+	closed bool
+}
+
+var _ NeighHandle = &mockNeighHandle{}
+
+func (m *mockNeighHandle) open() (NeighHandle, func(), error) {
+	m.closed = false
+	return m, func() { m.closed = true }, nil
+}
+
+func (m *mockNeighHandle) LinkByName(name string) (netlink.Link, error) {
+	if name != "eth0" {
+		return nil, errors.New("not found")
+	}
+	return &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name, Index: 2}}, nil
+}
+
+func (m *mockNeighHandle) NeighProxyList(linkIndex, family int) ([]netlink.Neigh, error) {
+	var neighs []netlink.Neigh
+	for _, n := range m.neighs {
+		if n.LinkIndex == linkIndex && n.Family == family {
+			neighs = append(neighs, n)
+		}
+	}
+	return neighs, nil
+}
+
+func (m *mockNeighHandle) NeighAdd(neigh *netlink.Neigh) error {
+	m.neighs = append(m.neighs, *neigh)
+	return nil
+}
+
+func (m *mockNeighHandle) NeighDel(neigh *netlink.Neigh) error {
+	for i, n := range m.neighs {
+		if n.LinkIndex == neigh.LinkIndex && n.IP.Equal(neigh.IP) {
+			m.neighs = append(m.neighs[:i], m.neighs[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such entry")
+}
+
+func (m *mockNeighHandle) ips() []string {
+	var ips []string
+	for _, n := range m.neighs {
+		ips = append(ips, n.IP.String())
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func TestNeighborProxy(t *testing.T) {
+	t.Parallel()
+
+	m := &mockNeighHandle{
+		neighs: []netlink.Neigh{
+			{LinkIndex: 2, Family: netlink.FAMILY_V4, Flags: netlink.NTF_PROXY, IP: net.ParseIP("10.2.0.1")},
+			{LinkIndex: 2, Family: netlink.FAMILY_V4, Flags: netlink.NTF_PROXY, IP: net.ParseIP("10.2.0.2")},
+		},
+	}
+	var ndpEnabled []string
+	proxy := NewNeighborProxy("eth0", ctrl.Log.WithName("neighbor-proxy")).(*neighborProxy)
+	proxy.newHandle = m.open
+	proxy.enableNDP = func(ifName string) error {
+		ndpEnabled = append(ndpEnabled, ifName)
+		return nil
+	}
+
+	err := proxy.Sync([]net.IP{net.ParseIP("10.2.0.2").To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.closed {
+		t.Error("handle is not closed")
+	}
+	if ips := m.ips(); len(ips) != 1 || ips[0] != "10.2.0.2" {
+		t.Error("unexpected proxy entries:", ips)
+	}
+	if len(ndpEnabled) != 0 {
+		t.Error("proxy_ndp should not be enabled for IPv4 only")
+	}
+
+	err = proxy.Sync([]net.IP{net.ParseIP("10.2.0.3").To4(), net.ParseIP("fd02::3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ips := m.ips(); len(ips) != 2 || ips[0] != "10.2.0.3" || ips[1] != "fd02::3" {
+		t.Error("unexpected proxy entries:", ips)
+	}
+	for _, n := range m.neighs {
+		if n.LinkIndex != 2 || n.Flags != netlink.NTF_PROXY {
+			t.Errorf("unexpected entry: %+v", n)
+		}
+	}
+	if len(ndpEnabled) != 1 || ndpEnabled[0] != "eth0" {
+		t.Error("proxy_ndp should be enabled on the uplink:", ndpEnabled)
+	}
+}
@@ -0,0 +1,29 @@
+package nodenet
+
+import "github.com/vishvananda/netlink"
+
+// RouteHandle is the set of netlink operations to program routing tables.
+//
+// All the operations are sent over NETLINK_ROUTE sockets.
+// *netlink.Handle implements this interface.
+//
+// Only RouteExporter and RouteSyncer use this interface.  PodNetwork and
+// the other components still call the netlink package directly.
+type RouteHandle interface {
+	LinkByName(name string) (netlink.Link, error)
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	RouteAdd(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+}
+
+var _ RouteHandle = &netlink.Handle{}
+
+// newRouteHandle opens a RouteHandle for the current network namespace.
+// The returned function closes the handle.
+func newRouteHandle() (RouteHandle, func(), error) {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, h.Delete, nil
+}
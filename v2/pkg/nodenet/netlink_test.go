@@ -0,0 +1,182 @@
+package nodenet
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type mockRouteHandle struct {
+	routes []netlink.Route
+	closed bool
+}
+
+var _ RouteHandle = &mockRouteHandle{}
+
+func (m *mockRouteHandle) open() (RouteHandle, func(), error) {
+	m.closed = false
+	return m, func() { m.closed = true }, nil
+}
+
+func (m *mockRouteHandle) LinkByName(name string) (netlink.Link, error) {
+	if name != "lo" {
+		return nil, errors.New("not found")
+	}
+	return &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name, Index: 1}}, nil
+}
+
+func (m *mockRouteHandle) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, r := range m.routes {
+		if filterMask&netlink.RT_FILTER_TABLE != 0 && r.Table != filter.Table {
+			continue
+		}
+		if filterMask&netlink.RT_FILTER_PROTOCOL != 0 && r.Protocol != filter.Protocol {
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func (m *mockRouteHandle) RouteAdd(route *netlink.Route) error {
+	m.routes = append(m.routes, *route)
+	return nil
+}
+
+func (m *mockRouteHandle) RouteDel(route *netlink.Route) error {
+	for i, r := range m.routes {
+		if r.Table == route.Table && r.Dst.String() == route.Dst.String() && r.Gw.Equal(route.Gw) {
+			m.routes = append(m.routes[:i], m.routes[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such route")
+}
+
+func (m *mockRouteHandle) dsts(table int) []string {
+	var dsts []string
+	for _, r := range m.routes {
+		if r.Table == table {
+			dsts = append(dsts, r.Dst.String())
+		}
+	}
+	sort.Strings(dsts)
+	return dsts
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestRouteHandleMock(t *testing.T) {
+	t.Run("exporter", testExporterWithMock)
+	t.Run("syncer", testSyncerWithMock)
+}
+
+func testExporterWithMock(t *testing.T) {
+	t.Parallel()
+
+	m := &mockRouteHandle{
+		routes: []netlink.Route{
+			{Table: 119, Dst: mustParseCIDR("10.2.0.0/27")},
+			{Table: 254, Dst: mustParseCIDR("10.3.0.0/27")},
+		},
+	}
+	exporter := NewRouteExporter(119, 30, ctrl.Log.WithName("exporter")).(*routeExporter)
+	exporter.newHandle = m.open
+
+	err := exporter.Sync([]*net.IPNet{mustParseCIDR("10.2.0.32/27"), mustParseCIDR("fd02::/120")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.closed {
+		t.Error("handle is not closed")
+	}
+
+	dsts := m.dsts(119)
+	if len(dsts) != 2 || dsts[0] != "10.2.0.32/27" || dsts[1] != "fd02::/120" {
+		t.Error("unexpected routes in the export table:", dsts)
+	}
+	if dsts := m.dsts(254); len(dsts) != 1 {
+		t.Error("routes in another table should not be touched:", dsts)
+	}
+	for _, r := range m.routes {
+		if r.Table == 119 && (r.Protocol != 30 || r.LinkIndex != 1) {
+			t.Errorf("unexpected route: %+v", r)
+		}
+	}
+
+	nets, err := exporter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 2 || nets[0].String() != "10.2.0.32/27" || nets[1].String() != "fd02::/120" {
+		t.Error("unexpected exported subnets:", nets)
+	}
+}
+
+func testSyncerWithMock(t *testing.T) {
+	t.Parallel()
+
+	gw1 := net.ParseIP("10.9.0.1")
+	gw2 := net.ParseIP("10.9.0.2")
+	m := &mockRouteHandle{
+		routes: []netlink.Route{
+			{Dst: mustParseCIDR("10.2.0.0/27"), Gw: gw1, Protocol: 31},
+			{Dst: mustParseCIDR("10.2.0.32/27"), Gw: gw1, Protocol: 31},
+			{Dst: mustParseCIDR("10.10.0.0/16"), Gw: gw1, Protocol: 2},
+		},
+	}
+	syncer := NewRouteSyncer(31, ctrl.Log.WithName("syncer")).(*routeSyncer)
+	syncer.newHandle = m.open
+
+	err := syncer.Sync([]GatewayInfo{
+		{Gateway: gw1, Networks: []*net.IPNet{mustParseCIDR("10.2.0.0/27")}},
+		{Gateway: gw2, Networks: []*net.IPNet{mustParseCIDR("10.2.0.64/27")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.closed {
+		t.Error("handle is not closed")
+	}
+
+	dsts := m.dsts(0)
+	if len(dsts) != 3 || dsts[0] != "10.10.0.0/16" || dsts[1] != "10.2.0.0/27" || dsts[2] != "10.2.0.64/27" {
+		t.Error("unexpected routes:", dsts)
+	}
+
+	src := net.ParseIP("192.168.0.1").To4()
+	err = syncer.Sync([]GatewayInfo{
+		{Gateway: gw1, Networks: []*net.IPNet{mustParseCIDR("10.2.0.0/27")}, Src: src, Scope: netlink.SCOPE_SITE},
+		{Gateway: gw2, Networks: []*net.IPNet{mustParseCIDR("10.2.0.64/27")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsts = m.dsts(0)
+	if len(dsts) != 3 {
+		t.Error("unexpected routes:", dsts)
+	}
+	for _, r := range m.routes {
+		switch r.Dst.String() {
+		case "10.2.0.0/27":
+			if !r.Src.Equal(src) || r.Scope != netlink.SCOPE_SITE {
+				t.Errorf("src and scope should be updated: %+v", r)
+			}
+		case "10.2.0.64/27":
+			if r.Src != nil || r.Scope != netlink.SCOPE_UNIVERSE {
+				t.Errorf("unexpected route: %+v", r)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package nodenet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ErrUnreachable is returned by Ping when no reply is received in time.
+var ErrUnreachable = errors.New("no echo reply")
+
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+var pingSeq uint32
+
+// Ping sends an ICMP echo request to `target` from the network namespace
+// at `nsPath`, and waits for the reply until `timeout` passes.
+// If no reply is received, ErrUnreachable is returned.
+func Ping(nsPath string, target net.IP, timeout time.Duration) error {
+	network, address, proto := "ip4:icmp", "0.0.0.0", protocolICMP
+	var reqType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if target.To4() == nil {
+		network, address, proto = "ip6:ipv6-icmp", "::", protocolICMPv6
+		reqType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	id := os.Getpid() & 0xffff
+	seq := int(atomic.AddUint32(&pingSeq, 1) & 0xffff)
+	req, err := (&icmp.Message{
+		Type: reqType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("coil")},
+	}).Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	return ns.WithNetNSPath(nsPath, func(ns.NetNS) error {
+		c, err := icmp.ListenPacket(network, address)
+		if err != nil {
+			return fmt.Errorf("failed to open ICMP socket: %w", err)
+		}
+		defer c.Close()
+
+		if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+		if _, err := c.WriteTo(req, &net.IPAddr{IP: target}); err != nil {
+			return fmt.Errorf("failed to send echo request to %s: %w", target, err)
+		}
+
+		buf := make([]byte, 1500)
+		for {
+			n, peer, err := c.ReadFrom(buf)
+			if err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					return fmt.Errorf("%w from %s", ErrUnreachable, target)
+				}
+				return err
+			}
+
+			// raw sockets receive every ICMP message in the netns.
+			msg, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil || msg.Type != replyType {
+				continue
+			}
+			echo, ok := msg.Body.(*icmp.Echo)
+			if !ok || echo.ID != id || echo.Seq != seq {
+				continue
+			}
+			if addr, ok := peer.(*net.IPAddr); ok && addr.IP.Equal(target) {
+				return nil
+			}
+		}
+	})
+}
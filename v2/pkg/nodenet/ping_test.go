@@ -0,0 +1,22 @@
+package nodenet
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	if err := Ping("/proc/self/ns/net", net.ParseIP("127.0.0.1"), time.Second); err != nil {
+		t.Error("ping to 127.0.0.1 failed:", err)
+	}
+	if err := Ping("/proc/self/ns/net", net.ParseIP("::1"), time.Second); err != nil {
+		t.Error("ping to ::1 failed:", err)
+	}
+
+}
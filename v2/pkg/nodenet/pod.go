@@ -1,26 +1,15 @@
 package nodenet
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
-	"errors"
 	"fmt"
 	"net"
-	"strings"
 	"sync"
 
 	current "github.com/containernetworking/cni/pkg/types/100"
-	"github.com/containernetworking/plugins/pkg/ip"
-	"github.com/containernetworking/plugins/pkg/ns"
-	"github.com/cybozu-go/netutil"
 	"github.com/go-logr/logr"
-	"github.com/vishvananda/netlink"
-	"golang.org/x/sys/unix"
 )
 
 var (
-	errNotFound = errors.New("not found")
-
 	defaultGWv4 = &net.IPNet{IP: net.ParseIP("0.0.0.0"), Mask: net.CIDRMask(0, 32)}
 	defaultGWv6 = &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
 )
@@ -35,6 +24,46 @@ type PodNetConf struct {
 	IFace       string
 	IPv4        net.IP
 	IPv6        net.IP
+
+	// AcceptRA allows the container interface to accept IPv6 router advertisements.
+	AcceptRA bool
+
+	// DelegatedPrefix is the IPv6 prefix delegated to the node that IPv6 is
+	// assigned from.  If set, the container accepts router advertisements
+	// without SLAAC, and the prefix is routed via the node.
+	// Only DatapathRouted supports this.
+	DelegatedPrefix *net.IPNet
+
+	// Datapath is the name of the datapath to connect the container.
+	// If empty, DatapathRouted is used.
+	Datapath string
+
+	// L2 is the configuration for DatapathMACVLAN.
+	L2 *L2Conf
+
+	// Extra is the list of additional addresses of the interface.
+	// Only DatapathRouted supports them.
+	//
+	// PoolName of the addresses returned by List is empty because
+	// the datapath does not record it.
+	Extra []ExtraAddress
+
+	// Routes are additional destinations routed via the gateway of the
+	// container, such as a node-local DNS cache or a metadata service.
+	// Routes of an address family without a gateway are ignored.
+	Routes []*net.IPNet
+
+	// NoDefaultRoute suppresses the default routes of the container.
+	// Routes are still added.
+	NoDefaultRoute bool
+}
+
+// ExtraAddress represents additional addresses assigned to the container
+// interface besides IPv4 and IPv6 of PodNetConf.
+type ExtraAddress struct {
+	PoolName string
+	IPv4     net.IP
+	IPv6     net.IP
 }
 
 // PodNetwork represents an interface to configure container networking.
@@ -42,7 +71,11 @@ type PodNetwork interface {
 	// Init initializes the host network.
 	Init() error
 
-	// Setup connects the host network and the container network with a veth pair.
+	// Cleanup removes the host network configurations made by Init and Setup.
+	// It should be called only when no containers are connected.
+	Cleanup() error
+
+	// Setup connects the container network with the datapath specified in `conf`.
 	// `nsPath` is the container network namespace's (possibly bind-mounted) file.
 	// If `hook` is non-nil, it is called in the Pod network.
 	Setup(nsPath, podName, podNS string, conf *PodNetConf, hook SetupHook) (*current.Result, error)
@@ -50,130 +83,65 @@ type PodNetwork interface {
 	// Check checks the pod network's status.
 	Check(containerId, iface string) error
 
-	// Destroy disconnects the container network by deleting the veth pair.
-	// IPv4 and IPv6 in conf can be left nil.
+	// Destroy disconnects the container network.
+	// It is not an error if the container network does not exist.
 	Destroy(containerId, iface string) error
 
 	// List returns a list of already setup network configurations.
 	List() ([]*PodNetConf, error)
-}
-
-// NewPodNetwork creates a PodNetwork
-func NewPodNetwork(podTableID, podRulePrio, protocolId int, hostIPv4, hostIPv6 net.IP, compatCalico, registerFromMain bool, log logr.Logger) PodNetwork {
-	return &podNetwork{
-		podTableId:       podTableID,
-		podRulePrio:      podRulePrio,
-		protocolId:       netlink.RouteProtocol(protocolId),
-		hostIPv4:         hostIPv4,
-		hostIPv6:         hostIPv6,
-		compatCalico:     compatCalico,
-		registerFromMain: registerFromMain,
-		log:              log,
-	}
-}
-
-type podNetwork struct {
-	podTableId       int
-	podRulePrio      int
-	protocolId       netlink.RouteProtocol
-	mtu              int
-	hostIPv4         net.IP
-	hostIPv6         net.IP
-	compatCalico     bool
-	registerFromMain bool
-	log              logr.Logger
-
-	mu sync.Mutex
-}
 
-func genAlias(conf *PodNetConf) string {
-	return fmt.Sprintf("COIL:%s:%s:%s", conf.PoolName, conf.ContainerId, conf.IFace)
+	// Stats returns the traffic counters of the container interfaces.
+	Stats() ([]TrafficStats, error)
 }
 
-func parseLink(l netlink.Link) *PodNetConf {
-	cols := strings.Split(l.Attrs().Alias, ":")
-	if len(cols) != 4 {
-		return nil
+// NewPodNetwork creates a PodNetwork with the routed and macvlan datapaths.
+//
+// `uplink` is the parent interface for containers attached with macvlan, and
+// `macvlanStateDir` is the directory to record them.  If `uplink` is empty,
+// containers cannot be attached with macvlan.
+func NewPodNetwork(podTableID, podRulePrio, protocolId int, hostIPv4, hostIPv6 net.IP, compatCalico, registerFromMain bool, uplink, macvlanStateDir string, log logr.Logger) PodNetwork {
+	datapaths := []Datapath{
+		NewRoutedDatapath(podTableID, podRulePrio, protocolId, hostIPv4, hostIPv6, compatCalico, registerFromMain, log),
 	}
-	if cols[0] != "COIL" {
-		return nil
+	if uplink != "" {
+		datapaths = append(datapaths, NewMACVLANDatapath(uplink, macvlanStateDir, log))
 	}
-
-	return &PodNetConf{
-		PoolName:    cols[1],
-		ContainerId: cols[2],
-		IFace:       cols[3],
-	}
-}
-
-func calicoVethName(podName, podNS string) string {
-	sum := sha1.Sum([]byte(fmt.Sprintf("%s.%s", podNS, podName)))
-	return "veth" + hex.EncodeToString(sum[:])[:11]
+	return NewPodNetworkWithDatapaths(datapaths, log)
 }
 
-func lookup(containerId, iface string) (netlink.Link, error) {
-	links, err := netlink.LinkList()
-	if err != nil {
-		return nil, fmt.Errorf("netlink: failed to list links: %w", err)
+// NewPodNetworkWithDatapaths creates a PodNetwork that dispatches requests to `datapaths`.
+func NewPodNetworkWithDatapaths(datapaths []Datapath, log logr.Logger) PodNetwork {
+	return &podNetwork{
+		datapaths: datapaths,
+		log:       log,
 	}
+}
 
-	for _, l := range links {
-		c := parseLink(l)
-		if c == nil {
-			continue
-		}
-
-		if c.ContainerId == containerId && c.IFace == iface {
-			return l, nil
-		}
-	}
+type podNetwork struct {
+	datapaths []Datapath
+	log       logr.Logger
 
-	return nil, errNotFound
+	mu sync.Mutex
 }
 
 func (pn *podNetwork) Init() error {
-	if err := ip.EnableIP4Forward(); err != nil {
-		pn.log.Error(err, "warning: failed to enable IPv4 forwarding")
-	}
-	if err := ip.EnableIP6Forward(); err != nil {
-		pn.log.Error(err, "warning: failed to enable IPv6 forwarding")
-	}
-
-	if err := pn.initRule(netlink.FAMILY_V4); err != nil {
-		pn.log.Error(err, "warning: failed to init IPv4 routing rule")
-	}
-	if err := pn.initRule(netlink.FAMILY_V6); err != nil {
-		pn.log.Error(err, "warning: failed to init IPv6 routing rule")
-	}
-
-	if mtu, err := netutil.DetectMTU(); err != nil {
-		pn.log.Error(err, "warning: failed to auto-detect the host MTU")
-	} else {
-		pn.mtu = mtu
+	for _, d := range pn.datapaths {
+		if err := d.Init(); err != nil {
+			return fmt.Errorf("failed to initialize %s datapath: %w", d.Name(), err)
+		}
 	}
-
 	return nil
 }
 
-func (pn *podNetwork) initRule(family int) error {
-	rules, err := netlink.RuleList(family)
-	if err != nil {
-		return fmt.Errorf("netlink: rule list failed: %w", err)
-	}
+func (pn *podNetwork) Cleanup() error {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
 
-	for _, r := range rules {
-		if r.Priority == pn.podRulePrio {
-			return nil
+	for _, d := range pn.datapaths {
+		if err := d.Cleanup(); err != nil {
+			return fmt.Errorf("failed to cleanup %s datapath: %w", d.Name(), err)
 		}
 	}
-
-	r := netlink.NewRule()
-	r.Family = family
-	r.Table = pn.podTableId
-	r.Priority = pn.podRulePrio
-	if err := netlink.RuleAdd(r); err != nil {
-		return fmt.Errorf("netlink: failed to add pod table rule: %w", err)
-	}
 	return nil
 }
 
@@ -181,249 +149,49 @@ func (pn *podNetwork) Setup(nsPath, podName, podNS string, conf *PodNetConf, hoo
 	pn.mu.Lock()
 	defer pn.mu.Unlock()
 
-	// cleanup garbage veth
-	switch l, err := lookup(conf.ContainerId, conf.IFace); err {
-	case errNotFound:
-	case nil:
-		// remove garbage link, if any
-		if err := netlink.LinkDel(l); err != nil {
-			return nil, fmt.Errorf("netlink: failed to delete broken link: %w", err)
-		}
-	default:
-		return nil, err
-	}
-
-	containerNS, err := ns.GetNS(nsPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open netns path %s: %w", nsPath, err)
-	}
-	defer containerNS.Close()
-
-	// setup veth and configure IP addresses
-	result := &current.Result{
-		CNIVersion: current.ImplementedSpecVersion,
-	}
-	err = containerNS.Do(func(hostNS ns.NetNS) error {
-		vethName := ""
-		if pn.compatCalico {
-			vethName = calicoVethName(podName, podNS)
-		}
-		hVeth, cVeth, err := ip.SetupVethWithName(conf.IFace, vethName, pn.mtu, "", hostNS)
-		if err != nil {
-			return fmt.Errorf("failed to setup veth: %w", err)
-		}
-
-		cLink, err := netlink.LinkByIndex(cVeth.Index)
-		if err != nil {
-			return fmt.Errorf("netlink: failed to get veth link for container: %w", err)
-		}
-
-		idx := 0
-		if conf.IPv4 != nil {
-			ipnet := netlink.NewIPNet(conf.IPv4)
-			err := netlink.AddrAdd(cLink, &netlink.Addr{
-				IPNet: ipnet,
-				Scope: unix.RT_SCOPE_UNIVERSE,
-			})
-			if err != nil {
-				netlink.LinkDel(cLink)
-				return fmt.Errorf("netlink: failed to add an address: %w", err)
-			}
-			result.IPs = append(result.IPs, &current.IPConfig{
-				Address:   *ipnet,
-				Interface: &idx,
-			})
-		}
-
-		if conf.IPv6 != nil {
-			ipnet := netlink.NewIPNet(conf.IPv6)
-			err := netlink.AddrAdd(cLink, &netlink.Addr{
-				IPNet: ipnet,
-				Scope: unix.RT_SCOPE_UNIVERSE,
-			})
-			if err != nil {
-				netlink.LinkDel(cLink)
-				return fmt.Errorf("netlink: failed to add an address: %w", err)
-			}
-			ip.SettleAddresses(conf.IFace, 10)
-			result.IPs = append(result.IPs, &current.IPConfig{
-				Address:   *ipnet,
-				Interface: &idx,
-			})
-		}
-
-		result.Interfaces = []*current.Interface{
-			{
-				Name:    cVeth.Name,
-				Mac:     cVeth.HardwareAddr.String(),
-				Sandbox: nsPath,
-			},
-			{
-				Name: hVeth.Name,
-				Mac:  hVeth.HardwareAddr.String(),
-			},
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	// install cleanup handler upon errors
-	hName := result.Interfaces[1].Name
-	hLink, err := netlink.LinkByName(hName)
-	if err != nil {
-		return nil, fmt.Errorf("netlink: failed to look up the host-side veth: %w", err)
+	name := conf.Datapath
+	if name == "" {
+		name = DatapathRouted
 	}
-	defer func() {
-		if hLink != nil {
-			netlink.LinkDel(hLink)
-		}
-	}()
-
-	// give identifer as an alias of host veth
-	err = netlink.LinkSetAlias(hLink, genAlias(conf))
-	if err != nil {
-		return nil, fmt.Errorf("netlink: failed to set alias: %w", err)
-	}
-
-	// setup routing on the host side
-	var hostIPv6 net.IP
-	if conf.IPv6 != nil {
-		ip.SettleAddresses(hName, 10)
 
-		err = netlink.AddrAdd(hLink, &netlink.Addr{
-			IPNet: netlink.NewIPNet(pn.hostIPv6),
-			Scope: unix.RT_SCOPE_UNIVERSE,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("netlink: failed to add a host IPv6 address: %w", err)
-		}
-
-		v6Addrs, err := netlink.AddrList(hLink, netlink.FAMILY_V6)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get v6 addresses: %w", err)
-		}
-		for _, a := range v6Addrs {
-			if a.Scope == unix.RT_SCOPE_LINK {
-				hostIPv6 = a.IP
-				break
-			}
-		}
-		if hostIPv6 == nil {
-			return nil, fmt.Errorf("failed to find link-local address of %s", hLink.Attrs().Name)
-		}
-
-		err = netlink.RouteAdd(&netlink.Route{
-			Dst:       netlink.NewIPNet(conf.IPv6),
-			LinkIndex: hLink.Attrs().Index,
-			Scope:     netlink.SCOPE_LINK,
-			Protocol:  pn.protocolId,
-			Table:     pn.podTableId,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("netlink: failed to add route to %s: %w", conf.IPv6.String(), err)
-		}
-	}
-	if conf.IPv4 != nil {
-		err = netlink.AddrAdd(hLink, &netlink.Addr{
-			IPNet: netlink.NewIPNet(pn.hostIPv4),
-			Scope: unix.RT_SCOPE_UNIVERSE,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("netlink: failed to add a hostIPv4 address: %w", err)
+	var datapath Datapath
+	for _, d := range pn.datapaths {
+		if d.Name() == name {
+			datapath = d
+			continue
 		}
-
-		err = netlink.RouteAdd(&netlink.Route{
-			Dst:       netlink.NewIPNet(conf.IPv4),
-			LinkIndex: hLink.Attrs().Index,
-			Scope:     netlink.SCOPE_LINK,
-			Protocol:  pn.protocolId,
-			Table:     pn.podTableId,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("netlink: failed to add route to %s: %w", conf.IPv4.String(), err)
+		// remove garbage left by another datapath, if any
+		if err := d.Destroy(conf.ContainerId, conf.IFace); err != nil && err != ErrNotFound {
+			return nil, fmt.Errorf("failed to delete broken link: %w", err)
 		}
 	}
-
-	// setup routing on the container side
-	err = containerNS.Do(func(ns.NetNS) error {
-		l, err := netlink.LinkByName(conf.IFace)
-		if err != nil {
-			return fmt.Errorf("netlink: failed to find link: %w", err)
-		}
-		if conf.IPv4 != nil {
-			err := netlink.RouteAdd(&netlink.Route{
-				Dst:       netlink.NewIPNet(pn.hostIPv4),
-				LinkIndex: l.Attrs().Index,
-				Scope:     netlink.SCOPE_LINK,
-			})
-			if err != nil {
-				return fmt.Errorf("netlink: failed to add route to %s: %w", pn.hostIPv4.String(), err)
-			}
-			err = netlink.RouteAdd(&netlink.Route{
-				Dst:   defaultGWv4,
-				Gw:    pn.hostIPv4,
-				Scope: netlink.SCOPE_UNIVERSE,
-			})
-			if err != nil {
-				return fmt.Errorf("netlink: failed to add default gw %s: %w", pn.hostIPv4.String(), err)
-			}
-		}
-		if conf.IPv6 != nil {
-			err = netlink.RouteAdd(&netlink.Route{
-				Dst:       defaultGWv6,
-				Gw:        hostIPv6,
-				LinkIndex: l.Attrs().Index, // hostIPv6 is a link-local address, so this is required
-				Scope:     netlink.SCOPE_UNIVERSE,
-			})
-			if err != nil {
-				return fmt.Errorf("netlink: failed to add default gw %s: %w", hostIPv6.String(), err)
-			}
-		}
-
-		if hook != nil {
-			return hook(conf.IPv4, conf.IPv6)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	if datapath == nil {
+		return nil, fmt.Errorf("datapath %s is not available", name)
 	}
 
-	hLink = nil
-	return result, nil
+	return datapath.Setup(nsPath, podName, podNS, conf, hook)
 }
 
 func (pn *podNetwork) Check(containerId, iface string) error {
 	pn.mu.Lock()
 	defer pn.mu.Unlock()
 
-	_, err := lookup(containerId, iface)
-	if err != nil {
-		return err
+	for _, d := range pn.datapaths {
+		if err := d.Check(containerId, iface); err != ErrNotFound {
+			return err
+		}
 	}
-
-	// TODO should check further details
-
-	return nil
+	return ErrNotFound
 }
 
 func (pn *podNetwork) Destroy(containerId, iface string) error {
 	pn.mu.Lock()
 	defer pn.mu.Unlock()
 
-	l, err := lookup(containerId, iface)
-	if err == errNotFound {
-		return nil
-	}
-	if err != nil {
-		return err
-	}
-
-	if err := netlink.LinkDel(l); err != nil {
-		return fmt.Errorf("netlink: failed to delete link: %w", err)
+	for _, d := range pn.datapaths {
+		if err := d.Destroy(containerId, iface); err != ErrNotFound {
+			return err
+		}
 	}
 	return nil
 }
@@ -432,74 +200,28 @@ func (pn *podNetwork) List() ([]*PodNetConf, error) {
 	pn.mu.Lock()
 	defer pn.mu.Unlock()
 
-	links, err := netlink.LinkList()
-	if err != nil {
-		return nil, fmt.Errorf("netlink: failed to list links: %w", err)
-	}
-
-	v4Routes, err := netlink.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: pn.podTableId}, netlink.RT_FILTER_TABLE)
-	if err != nil {
-		return nil, fmt.Errorf("netlink: failed to list IPv4 routes in table %d: %w", pn.podTableId, err)
-	}
-	v4Map := make(map[int]net.IP)
-	for _, r := range v4Routes {
-		v4Map[r.LinkIndex] = r.Dst.IP.To4()
-	}
-
-	// TODO: remove this when releasing Coil 2.1
-	if pn.registerFromMain {
-		v4Routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	var confs []*PodNetConf
+	for _, d := range pn.datapaths {
+		c, err := d.List()
 		if err != nil {
-			return nil, fmt.Errorf("netlink: failed to list IPv4 routes: %w", err)
-		}
-		for _, r := range v4Routes {
-			if r.Protocol != pn.protocolId && r.Protocol != 3 {
-				// Calico replaces protocol ID to 3 (== boot)
-				continue
-			}
-			if _, ok := v4Map[r.LinkIndex]; ok {
-				continue
-			}
-			v4Map[r.LinkIndex] = r.Dst.IP.To4()
+			return nil, fmt.Errorf("failed to list %s datapath: %w", d.Name(), err)
 		}
+		confs = append(confs, c...)
 	}
+	return confs, nil
+}
 
-	v6Routes, err := netlink.RouteListFiltered(netlink.FAMILY_V6, &netlink.Route{Table: pn.podTableId}, netlink.RT_FILTER_TABLE)
-	if err != nil {
-		return nil, fmt.Errorf("netlink: failed to list IPv6 routes in table %d: %w", pn.podTableId, err)
-	}
-	v6Map := make(map[int]net.IP)
-	for _, r := range v6Routes {
-		v6Map[r.LinkIndex] = r.Dst.IP.To16()
-	}
+func (pn *podNetwork) Stats() ([]TrafficStats, error) {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
 
-	// TODO: remove this when releasing Coil 2.1
-	if pn.registerFromMain {
-		v6Routes, err := netlink.RouteList(nil, netlink.FAMILY_V6)
+	var stats []TrafficStats
+	for _, d := range pn.datapaths {
+		s, err := d.Stats()
 		if err != nil {
-			return nil, fmt.Errorf("netlink: failed to list IPv6 routes: %w", err)
-		}
-		for _, r := range v6Routes {
-			if r.Protocol != pn.protocolId && r.Protocol != 3 {
-				continue
-			}
-			if _, ok := v6Map[r.LinkIndex]; ok {
-				continue
-			}
-			v6Map[r.LinkIndex] = r.Dst.IP.To16()
+			return nil, fmt.Errorf("failed to get stats of %s datapath: %w", d.Name(), err)
 		}
+		stats = append(stats, s...)
 	}
-
-	var confs []*PodNetConf
-	for _, l := range links {
-		conf := parseLink(l)
-		if conf != nil {
-			idx := l.Attrs().Index
-			conf.IPv4 = v4Map[idx]
-			conf.IPv6 = v6Map[idx]
-			confs = append(confs, conf)
-		}
-	}
-
-	return confs, nil
+	return stats, nil
 }
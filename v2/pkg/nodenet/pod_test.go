@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -21,7 +22,7 @@ func TestPodNetwork(t *testing.T) {
 	}
 
 	pn := NewPodNetwork(116, 2000, 30, net.ParseIP("10.20.30.41"), net.ParseIP("fd10::41"),
-		false, false, ctrl.Log.WithName("pod-network"))
+		false, false, "", "", ctrl.Log.WithName("pod-network"))
 	if err := pn.Init(); err != nil {
 		t.Fatal(err)
 	}
@@ -81,6 +82,16 @@ func TestPodNetwork(t *testing.T) {
 		t.Error(`CNI version != 1.0.0`)
 	}
 
+	for _, name := range []string{"accept_ra", "autoconf"} {
+		out, err := exec.Command("ip", "netns", "exec", "pod1", "sysctl", "-n", "net.ipv6.conf.eth0."+name).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(out)) != "0" {
+			t.Errorf("%s should be disabled: %s", name, out)
+		}
+	}
+
 	// run a test HTTP server
 	go func() {
 		serv := &http.Server{
@@ -282,3 +293,162 @@ func TestPodNetwork(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMACVLAN(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	err := exec.Command("ip", "link", "add", "uplink0", "type", "veth", "peer", "name", "uplink1").Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Command("ip", "link", "del", "uplink0").Run()
+	if err := exec.Command("ip", "link", "set", "uplink0", "up").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	pn := NewPodNetwork(116, 2000, 30, net.ParseIP("10.20.30.41"), net.ParseIP("fd10::41"),
+		false, false, "uplink0", t.TempDir(), ctrl.Log.WithName("pod-network"))
+
+	podConf := &PodNetConf{
+		PoolName:    "flat",
+		ContainerId: "e8f4a9c50c85b36eff718aab2ac39209e541a4551420488c33d9216cf1795b3a",
+		IFace:       "eth0",
+		IPv4:        net.ParseIP("192.168.20.10").To4(),
+		Datapath:    DatapathMACVLAN,
+		L2: &L2Conf{
+			IPv4Net:  &net.IPNet{IP: net.ParseIP("192.168.20.0").To4(), Mask: net.CIDRMask(24, 32)},
+			Gateways: []net.IP{net.ParseIP("192.168.20.1").To4()},
+		},
+		Routes: []*net.IPNet{
+			{IP: net.ParseIP("169.254.169.254").To4(), Mask: net.CIDRMask(32, 32)},
+			{IP: net.ParseIP("fd00::53"), Mask: net.CIDRMask(128, 128)},
+		},
+	}
+	result, err := pn.Setup(nsPath("pod4"), "pod4", "ns1", podConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Interfaces) != 1 || result.Interfaces[0].Sandbox != nsPath("pod4") {
+		t.Errorf("unexpected interfaces: %+v", result.Interfaces)
+	}
+	if len(result.IPs) != 1 || result.IPs[0].Address.String() != "192.168.20.10/24" || !result.IPs[0].Gateway.Equal(net.ParseIP("192.168.20.1")) {
+		t.Errorf("unexpected IPs: %+v", result.IPs)
+	}
+
+	out, err := exec.Command("ip", "netns", "exec", "pod4", "ip", "-d", "link", "show", "eth0").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "macvlan mode bridge") {
+		t.Error("eth0 is not a macvlan:", string(out))
+	}
+	out, err = exec.Command("ip", "netns", "exec", "pod4", "ip", "route", "show", "default").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "via 192.168.20.1") {
+		t.Error("default route is not configured:", string(out))
+	}
+	out, err = exec.Command("ip", "netns", "exec", "pod4", "ip", "route", "show", "169.254.169.254").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "via 192.168.20.1") {
+		t.Error("additional route is not configured:", string(out))
+	}
+
+	if err := pn.Check(podConf.ContainerId, podConf.IFace); err != nil {
+		t.Error(err)
+	}
+
+	confs, err := pn.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range confs {
+		if c.ContainerId == podConf.ContainerId {
+			found = true
+			if c.PoolName != "flat" || !c.IPv4.Equal(podConf.IPv4) {
+				t.Errorf("unexpected config: %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Error("config for pod4 not found")
+	}
+
+	if err := pn.Destroy(podConf.ContainerId, podConf.IFace); err != nil {
+		t.Fatal(err)
+	}
+	err = exec.Command("ip", "netns", "exec", "pod4", "ip", "link", "show", "eth0").Run()
+	if err == nil {
+		t.Error("eth0 should be deleted")
+	}
+	if err := pn.Check(podConf.ContainerId, podConf.IFace); err == nil {
+		t.Error("check should fail after destroy")
+	}
+
+	// destroy should be idempotent
+	if err := pn.Destroy(podConf.ContainerId, podConf.IFace); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListStaleVeths(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	const nsName = "stale-veth"
+	if err := exec.Command("ip", "netns", "add", nsName).Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Command("ip", "netns", "del", nsName).Run()
+
+	cmds := [][]string{
+		{"ip", "link", "add", "stale0", "type", "veth", "peer", "name", "stale1"},
+		{"ip", "link", "set", "stale0", "alias", "COIL:default:c-stale:eth0", "up"},
+		{"ip", "link", "add", "live0", "type", "veth", "peer", "name", "live1"},
+		{"ip", "link", "set", "live0", "alias", "COIL:default:c-live:eth0", "up"},
+		{"ip", "link", "set", "live1", "netns", nsName},
+		{"ip", "netns", "exec", nsName, "ip", "link", "set", "live1", "up"},
+	}
+	for _, args := range cmds {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s: %v", args, out, err)
+		}
+	}
+	defer exec.Command("ip", "link", "del", "stale0").Run()
+	defer exec.Command("ip", "link", "del", "live0").Run()
+
+	staleIDs := func() []string {
+		stale, err := ListStaleVeths()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, v := range stale {
+			if v.PoolName != "default" || v.IFace != "eth0" {
+				t.Errorf("unexpected stale veth: %+v", v)
+			}
+			ids = append(ids, v.ContainerId)
+		}
+		return ids
+	}
+
+	ids := staleIDs()
+	if len(ids) != 1 || ids[0] != "c-stale" {
+		t.Error("the veth whose peer is in the host namespace should be stale:", ids)
+	}
+
+	if err := exec.Command("ip", "netns", "exec", nsName, "ip", "link", "set", "live1", "down").Run(); err != nil {
+		t.Fatal(err)
+	}
+	ids = staleIDs()
+	if len(ids) != 2 {
+		t.Error("the veth whose peer is down should be stale:", ids)
+	}
+}
@@ -0,0 +1,241 @@
+package nodenet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultProbeTimeout is the default duration to wait for replies to a probe.
+const DefaultProbeTimeout = 1 * time.Second
+
+const (
+	ethHeaderLen  = 14
+	ipv6HeaderLen = 40
+
+	icmpv6NeighborSolicitation  = 135
+	icmpv6NeighborAdvertisement = 136
+)
+
+// ConflictProber detects IP address conflicts with other hosts on the same L2 segment.
+type ConflictProber interface {
+	// Probe returns true if some other host is using `ip`.
+	//
+	// IPv4 addresses are probed with ARP as described in RFC 5227.
+	// IPv6 addresses are probed with Duplicate Address Detection of RFC 4862.
+	Probe(ip net.IP) (bool, error)
+}
+
+// NewConflictProber creates a ConflictProber that sends probes from `ifName`.
+func NewConflictProber(ifName string, timeout time.Duration) ConflictProber {
+	return &conflictProber{
+		ifName:  ifName,
+		timeout: timeout,
+	}
+}
+
+type conflictProber struct {
+	ifName  string
+	timeout time.Duration
+}
+
+func (p *conflictProber) Probe(ip net.IP) (bool, error) {
+	iface, err := net.InterfaceByName(p.ifName)
+	if err != nil {
+		return false, fmt.Errorf("failed to find interface %s: %w", p.ifName, err)
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return false, fmt.Errorf("interface %s is not an ethernet device", p.ifName)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return p.probe(iface, unix.ETH_P_ARP, arpProbeFrame(iface.HardwareAddr, ip4), func(frame []byte) bool {
+			return isARPConflict(frame, iface.HardwareAddr, ip4)
+		})
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return p.probe(iface, unix.ETH_P_IPV6, dadProbeFrame(iface.HardwareAddr, ip16), func(frame []byte) bool {
+			return isDADConflict(frame, iface.HardwareAddr, ip16)
+		})
+	}
+	return false, errors.New("invalid IP address")
+}
+
+func (p *conflictProber) probe(iface *net.Interface, proto uint16, frame []byte, isConflict func([]byte) bool) (bool, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(proto)))
+	if err != nil {
+		return false, fmt.Errorf("failed to open packet socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	sa := &unix.SockaddrLinklayer{
+		Protocol: htons(proto),
+		Ifindex:  iface.Index,
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		return false, fmt.Errorf("failed to bind packet socket: %w", err)
+	}
+
+	tv := unix.NsecToTimeval((100 * time.Millisecond).Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return false, fmt.Errorf("failed to set receive timeout: %w", err)
+	}
+
+	sa.Halen = 6
+	copy(sa.Addr[:], frame[0:6])
+	if err := unix.Sendto(fd, frame, 0, sa); err != nil {
+		return false, fmt.Errorf("failed to send a probe: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	deadline := time.Now().Add(p.timeout)
+	for time.Now().Before(deadline) {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return false, fmt.Errorf("failed to receive packets: %w", err)
+		}
+		if isConflict(buf[:n]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func htons(v uint16) uint16 {
+	return (v << 8) | (v >> 8)
+}
+
+func ethHeader(dst, src net.HardwareAddr, etherType uint16) []byte {
+	h := make([]byte, ethHeaderLen)
+	copy(h[0:6], dst)
+	copy(h[6:12], src)
+	binary.BigEndian.PutUint16(h[12:14], etherType)
+	return h
+}
+
+// arpProbeFrame builds an ARP probe, an ARP request whose sender IP address is 0.0.0.0.
+func arpProbeFrame(mac net.HardwareAddr, ip net.IP) []byte {
+	frame := ethHeader(net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, mac, unix.ETH_P_ARP)
+
+	arp := make([]byte, 28)
+	binary.BigEndian.PutUint16(arp[0:2], 1) // Ethernet
+	binary.BigEndian.PutUint16(arp[2:4], unix.ETH_P_IP)
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:8], 1) // request
+	copy(arp[8:14], mac)
+	// sender IP address and target hardware address are zero
+	copy(arp[24:28], ip)
+	return append(frame, arp...)
+}
+
+// isARPConflict returns true if `frame` is an ARP packet sent from another host claiming `ip`,
+// or another ARP probe for `ip`.
+func isARPConflict(frame []byte, mac net.HardwareAddr, ip net.IP) bool {
+	if len(frame) < ethHeaderLen+28 {
+		return false
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != unix.ETH_P_ARP {
+		return false
+	}
+	arp := frame[ethHeaderLen:]
+	sha := net.HardwareAddr(arp[8:14])
+	if bytes.Equal(sha, mac) {
+		return false
+	}
+	spa := net.IP(arp[14:18])
+	if spa.Equal(ip) {
+		return true
+	}
+	op := binary.BigEndian.Uint16(arp[6:8])
+	tpa := net.IP(arp[24:28])
+	return op == 1 && spa.Equal(net.IPv4zero) && tpa.Equal(ip)
+}
+
+func solicitedNodeAddr(ip net.IP) net.IP {
+	addr := net.ParseIP("ff02::1:ff00:0")
+	copy(addr[13:16], ip[13:16])
+	return addr
+}
+
+// dadProbeFrame builds a Neighbor Solicitation message sent from the unspecified address.
+func dadProbeFrame(mac net.HardwareAddr, ip net.IP) []byte {
+	dst := solicitedNodeAddr(ip)
+	dstMAC := net.HardwareAddr{0x33, 0x33, dst[12], dst[13], dst[14], dst[15]}
+	frame := ethHeader(dstMAC, mac, unix.ETH_P_IPV6)
+
+	icmp := make([]byte, 24)
+	icmp[0] = icmpv6NeighborSolicitation
+	copy(icmp[8:24], ip)
+
+	ip6 := make([]byte, ipv6HeaderLen)
+	ip6[0] = 6 << 4
+	binary.BigEndian.PutUint16(ip6[4:6], uint16(len(icmp)))
+	ip6[6] = unix.IPPROTO_ICMPV6
+	ip6[7] = 255
+	copy(ip6[8:24], net.IPv6unspecified)
+	copy(ip6[24:40], dst)
+
+	binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(net.IPv6unspecified, dst, icmp))
+
+	frame = append(frame, ip6...)
+	return append(frame, icmp...)
+}
+
+func icmpv6Checksum(src, dst net.IP, msg []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	add(src.To16())
+	add(dst.To16())
+	sum += uint32(len(msg))
+	sum += unix.IPPROTO_ICMPV6
+	add(msg)
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// isDADConflict returns true if `frame` is a Neighbor Advertisement for `ip`
+// or a Neighbor Solicitation for `ip` sent by another host performing DAD.
+func isDADConflict(frame []byte, mac net.HardwareAddr, ip net.IP) bool {
+	if len(frame) < ethHeaderLen+ipv6HeaderLen+24 {
+		return false
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != unix.ETH_P_IPV6 {
+		return false
+	}
+	if bytes.Equal(frame[6:12], mac) {
+		return false
+	}
+	ip6 := frame[ethHeaderLen:]
+	if ip6[6] != unix.IPPROTO_ICMPV6 {
+		return false
+	}
+	icmp := ip6[ipv6HeaderLen:]
+	if !net.IP(icmp[8:24]).Equal(ip) {
+		return false
+	}
+	switch icmp[0] {
+	case icmpv6NeighborAdvertisement:
+		return true
+	case icmpv6NeighborSolicitation:
+		return net.IP(ip6[8:24]).Equal(net.IPv6unspecified)
+	}
+	return false
+}
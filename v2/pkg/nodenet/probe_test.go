@@ -0,0 +1,85 @@
+package nodenet
+
+import (
+	"net"
+	"testing"
+)
+
+func TestProbeFrames(t *testing.T) {
+	t.Run("arp", testARPFrames)
+	t.Run("dad", testDADFrames)
+}
+
+func testARPFrames(t *testing.T) {
+	t.Parallel()
+
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	other := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	ip := net.ParseIP("10.2.0.1").To4()
+
+	probe := arpProbeFrame(mac, ip)
+	if len(probe) != 42 {
+		t.Fatal("unexpected frame length:", len(probe))
+	}
+	if isARPConflict(probe, mac, ip) {
+		t.Error("own probe should not be a conflict")
+	}
+
+	// another host doing the same probe
+	otherProbe := arpProbeFrame(other, ip)
+	if !isARPConflict(otherProbe, mac, ip) {
+		t.Error("probe from another host should be a conflict")
+	}
+	if isARPConflict(otherProbe, mac, net.ParseIP("10.2.0.2").To4()) {
+		t.Error("probe for another address should not be a conflict")
+	}
+
+	// reply from a host owning the address
+	reply := arpProbeFrame(other, net.ParseIP("10.2.0.100").To4())
+	reply[ethHeaderLen+7] = 2
+	copy(reply[ethHeaderLen+14:ethHeaderLen+18], ip)
+	if !isARPConflict(reply, mac, ip) {
+		t.Error("reply from the owner should be a conflict")
+	}
+}
+
+func testDADFrames(t *testing.T) {
+	t.Parallel()
+
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	other := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	ip := net.ParseIP("fd02::1:2:3")
+
+	probe := dadProbeFrame(mac, ip)
+	if len(probe) != ethHeaderLen+ipv6HeaderLen+24 {
+		t.Fatal("unexpected frame length:", len(probe))
+	}
+	if probe[0] != 0x33 || probe[1] != 0x33 || probe[2] != 0xff || probe[5] != 0x03 {
+		t.Error("unexpected destination MAC:", net.HardwareAddr(probe[0:6]))
+	}
+	if !net.IP(probe[ethHeaderLen+24 : ethHeaderLen+40]).Equal(net.ParseIP("ff02::1:ff02:3")) {
+		t.Error("unexpected destination address")
+	}
+
+	// verify checksum: summing the whole message including the checksum yields 0.
+	icmp := probe[ethHeaderLen+ipv6HeaderLen:]
+	if icmpv6Checksum(net.IPv6unspecified, net.ParseIP("ff02::1:ff02:3"), icmp) != 0 {
+		t.Error("invalid checksum")
+	}
+
+	if isDADConflict(probe, mac, ip) {
+		t.Error("own probe should not be a conflict")
+	}
+	if !isDADConflict(dadProbeFrame(other, ip), mac, ip) {
+		t.Error("DAD from another host should be a conflict")
+	}
+
+	na := dadProbeFrame(other, ip)
+	na[ethHeaderLen+ipv6HeaderLen] = icmpv6NeighborAdvertisement
+	if !isDADConflict(na, mac, ip) {
+		t.Error("advertisement from another host should be a conflict")
+	}
+	if isDADConflict(na, mac, net.ParseIP("fd02::1")) {
+		t.Error("advertisement for another address should not be a conflict")
+	}
+}
@@ -9,9 +9,27 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
+// RouteAddError is returned by RouteExporter.Sync when it fails to add
+// the route to a subnet.
+type RouteAddError struct {
+	Network *net.IPNet
+	Err     error
+}
+
+func (e *RouteAddError) Error() string {
+	return fmt.Sprintf("netlink: failed to add route to %s: %v", e.Network, e.Err)
+}
+
+func (e *RouteAddError) Unwrap() error {
+	return e.Err
+}
+
 // RouteExporter exports subnets to a Linux kernel routing table.
 type RouteExporter interface {
 	Sync([]*net.IPNet) error
+
+	// List returns the subnets in the routing table.
+	List() ([]*net.IPNet, error)
 }
 
 // NewRouteExporter creates a new RouteExporter
@@ -20,6 +38,7 @@ func NewRouteExporter(tableId, protocolId int, log logr.Logger) RouteExporter {
 		tableId:    tableId,
 		protocolId: netlink.RouteProtocol(protocolId),
 		log:        log,
+		newHandle:  newRouteHandle,
 	}
 }
 
@@ -27,6 +46,7 @@ type routeExporter struct {
 	tableId    int
 	protocolId netlink.RouteProtocol
 	log        logr.Logger
+	newHandle  func() (RouteHandle, func(), error)
 
 	mu sync.Mutex
 }
@@ -37,12 +57,12 @@ func (r *routeExporter) Sync(nets []*net.IPNet) error {
 
 	r.log.Info("synchronizing routing table", "table-id", r.tableId)
 
-	h, err := netlink.NewHandle()
+	h, closeHandle, err := r.newHandle()
 	if err != nil {
 		r.log.Error(err, "netlink: failed to open handle")
 		return fmt.Errorf("netlink: failed to open handle: %w", err)
 	}
-	defer h.Delete()
+	defer closeHandle()
 
 	lo, err := h.LinkByName("lo")
 	if err != nil {
@@ -81,7 +101,7 @@ func (r *routeExporter) Sync(nets []*net.IPNet) error {
 		})
 		if err != nil {
 			r.log.Error(err, "netlink: failed to add route", "network", key)
-			return fmt.Errorf("netlink: failed to add route to %s: %w", key, err)
+			return &RouteAddError{Network: n, Err: err}
 		}
 	}
 
@@ -103,3 +123,27 @@ func (r *routeExporter) Sync(nets []*net.IPNet) error {
 	}
 	return nil
 }
+
+func (r *routeExporter) List() ([]*net.IPNet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, closeHandle, err := r.newHandle()
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to open handle: %w", err)
+	}
+	defer closeHandle()
+
+	filter := &netlink.Route{Table: r.tableId}
+	routes, err := h.RouteListFiltered(0, filter, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list routes: %w", err)
+	}
+	var nets []*net.IPNet
+	for _, route := range routes {
+		if route.Dst != nil {
+			nets = append(nets, route.Dst)
+		}
+	}
+	return nets, nil
+}
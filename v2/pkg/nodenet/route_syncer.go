@@ -13,6 +13,40 @@ import (
 type GatewayInfo struct {
 	Gateway  net.IP
 	Networks []*net.IPNet
+
+	// Src is the preferred source address of the routes, if not nil.
+	Src net.IP
+
+	// Scope is the scope of the routes.  The zero value is SCOPE_UNIVERSE.
+	Scope netlink.Scope
+}
+
+// InterfaceAddresses returns the first global IPv4 and IPv6 addresses of
+// the named interface.  Addresses not found are returned as nil.
+func InterfaceAddresses(name string) (ipv4, ipv6 net.IP, err error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("netlink: failed to find link %s: %w", name, err)
+	}
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("netlink: failed to list addresses of %s: %w", name, err)
+	}
+	for _, a := range addrs {
+		if a.Scope != int(netlink.SCOPE_UNIVERSE) {
+			continue
+		}
+		if ip4 := a.IP.To4(); ip4 != nil {
+			if ipv4 == nil {
+				ipv4 = ip4
+			}
+			continue
+		}
+		if ipv6 == nil {
+			ipv6 = a.IP
+		}
+	}
+	return ipv4, ipv6, nil
 }
 
 // RouteSyncer is the interface to program direct routing.
@@ -28,12 +62,14 @@ func NewRouteSyncer(protocolId int, log logr.Logger) RouteSyncer {
 	return &routeSyncer{
 		protocolId: netlink.RouteProtocol(protocolId),
 		log:        log,
+		newHandle:  newRouteHandle,
 	}
 }
 
 type routeSyncer struct {
 	protocolId netlink.RouteProtocol
 	log        logr.Logger
+	newHandle  func() (RouteHandle, func(), error)
 
 	mu sync.Mutex
 }
@@ -43,7 +79,13 @@ func (d *routeSyncer) Sync(gis []GatewayInfo) error {
 	defer d.mu.Unlock()
 
 	d.log.Info("synchronizing the main routing table", "gateways", len(gis))
-	routes, err := netlink.RouteListFiltered(0, &netlink.Route{Protocol: d.protocolId}, netlink.RT_FILTER_PROTOCOL)
+	h, closeHandle, err := d.newHandle()
+	if err != nil {
+		return fmt.Errorf("netlink: failed to open handle: %w", err)
+	}
+	defer closeHandle()
+
+	routes, err := h.RouteListFiltered(0, &netlink.Route{Protocol: d.protocolId}, netlink.RT_FILTER_PROTOCOL)
 	if err != nil {
 		return fmt.Errorf("netlink: failed to list routes: %w", err)
 	}
@@ -55,7 +97,8 @@ func (d *routeSyncer) Sync(gis []GatewayInfo) error {
 			routeMap[strIP+" "+n.String()] = &netlink.Route{
 				Dst:      n,
 				Gw:       gi.Gateway,
-				Scope:    netlink.SCOPE_UNIVERSE,
+				Src:      gi.Src,
+				Scope:    gi.Scope,
 				Protocol: d.protocolId,
 			}
 		}
@@ -64,8 +107,10 @@ func (d *routeSyncer) Sync(gis []GatewayInfo) error {
 	currentMap := make(map[string]bool)
 	for _, r := range routes {
 		key := r.Gw.String() + " " + r.Dst.String()
-		if _, ok := routeMap[key]; !ok {
-			if err := netlink.RouteDel(&r); err != nil {
+		desired, ok := routeMap[key]
+		if !ok || !r.Src.Equal(desired.Src) || r.Scope != desired.Scope {
+			// routes with outdated attributes are deleted and added again
+			if err := h.RouteDel(&r); err != nil {
 				return fmt.Errorf("netlink: failed to delete route: %w", err)
 			}
 			continue
@@ -75,7 +120,7 @@ func (d *routeSyncer) Sync(gis []GatewayInfo) error {
 
 	for k, v := range routeMap {
 		if !currentMap[k] {
-			if err := netlink.RouteAdd(v); err != nil {
+			if err := h.RouteAdd(v); err != nil {
 				return fmt.Errorf("netlink: failed to add route to %s: %w", k, err)
 			}
 			d.log.Info("added", "dst", v.Dst.String())
@@ -101,11 +101,11 @@ func TestRouteSyncer(t *testing.T) {
 	r := NewRouteSyncer(31, ctrl.Log.WithName("test"))
 
 	gws := []GatewayInfo{
-		{net.ParseIP("10.9.0.2"), []*net.IPNet{
+		{Gateway: net.ParseIP("10.9.0.2"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("192.168.1.0"), Mask: net.CIDRMask(24, 32)},
 			{IP: net.ParseIP("192.168.2.0"), Mask: net.CIDRMask(24, 32)},
 		}},
-		{net.ParseIP("fd09::2"), []*net.IPNet{
+		{Gateway: net.ParseIP("fd09::2"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("fd03::0100"), Mask: net.CIDRMask(120, 128)},
 			{IP: net.ParseIP("fd03::0200"), Mask: net.CIDRMask(120, 128)},
 		}},
@@ -115,10 +115,10 @@ func TestRouteSyncer(t *testing.T) {
 	}
 
 	gws = []GatewayInfo{
-		{net.ParseIP("10.9.0.2"), []*net.IPNet{
+		{Gateway: net.ParseIP("10.9.0.2"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("192.168.2.0"), Mask: net.CIDRMask(24, 32)},
 		}},
-		{net.ParseIP("fd09::2"), []*net.IPNet{
+		{Gateway: net.ParseIP("fd09::2"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("fd03::0100"), Mask: net.CIDRMask(120, 128)},
 			{IP: net.ParseIP("fd03::0200"), Mask: net.CIDRMask(120, 128)},
 		}},
@@ -128,13 +128,13 @@ func TestRouteSyncer(t *testing.T) {
 	}
 
 	gws = []GatewayInfo{
-		{net.ParseIP("10.9.0.2"), []*net.IPNet{
+		{Gateway: net.ParseIP("10.9.0.2"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("192.168.2.0"), Mask: net.CIDRMask(24, 32)},
 		}},
-		{net.ParseIP("10.9.0.3"), []*net.IPNet{
+		{Gateway: net.ParseIP("10.9.0.3"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("192.168.1.0"), Mask: net.CIDRMask(24, 32)},
 		}},
-		{net.ParseIP("fd09::2"), []*net.IPNet{
+		{Gateway: net.ParseIP("fd09::2"), Networks: []*net.IPNet{
 			{IP: net.ParseIP("fd03::0100"), Mask: net.CIDRMask(120, 128)},
 		}},
 	}
@@ -0,0 +1,703 @@
+package nodenet
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/cybozu-go/netutil"
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NewRoutedDatapath creates a Datapath that connects containers with veth pairs
+// and routes their packets on the node.
+//
+// The routes to containers are added to the table `podTableID`, which is looked up
+// by a routing rule of priority `podRulePrio`.
+func NewRoutedDatapath(podTableID, podRulePrio, protocolId int, hostIPv4, hostIPv6 net.IP, compatCalico, registerFromMain bool, log logr.Logger) Datapath {
+	return &routedDatapath{
+		podTableId:       podTableID,
+		podRulePrio:      podRulePrio,
+		protocolId:       netlink.RouteProtocol(protocolId),
+		hostIPv4:         hostIPv4,
+		hostIPv6:         hostIPv6,
+		compatCalico:     compatCalico,
+		registerFromMain: registerFromMain,
+		log:              log,
+	}
+}
+
+type routedDatapath struct {
+	podTableId       int
+	podRulePrio      int
+	protocolId       netlink.RouteProtocol
+	mtu              int
+	hostIPv4         net.IP
+	hostIPv6         net.IP
+	compatCalico     bool
+	registerFromMain bool
+	log              logr.Logger
+}
+
+func (d *routedDatapath) Name() string {
+	return DatapathRouted
+}
+
+func genAlias(conf *PodNetConf) string {
+	return fmt.Sprintf("COIL:%s:%s:%s", conf.PoolName, conf.ContainerId, conf.IFace)
+}
+
+func parseLink(l netlink.Link) *PodNetConf {
+	cols := strings.Split(l.Attrs().Alias, ":")
+	if len(cols) != 4 {
+		return nil
+	}
+	if cols[0] != "COIL" {
+		return nil
+	}
+
+	return &PodNetConf{
+		PoolName:    cols[1],
+		ContainerId: cols[2],
+		IFace:       cols[3],
+	}
+}
+
+func calicoVethName(podName, podNS string) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s.%s", podNS, podName)))
+	return "veth" + hex.EncodeToString(sum[:])[:11]
+}
+
+func lookup(containerId, iface string) (netlink.Link, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list links: %w", err)
+	}
+
+	for _, l := range links {
+		c := parseLink(l)
+		if c == nil {
+			continue
+		}
+
+		if c.ContainerId == containerId && c.IFace == iface {
+			return l, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// StaleVeth is a host-side veth of the routed datapath that is no longer
+// connected to a container.
+type StaleVeth struct {
+	Name        string
+	PoolName    string
+	ContainerId string
+	IFace       string
+}
+
+// ListStaleVeths returns the host-side veths of the routed datapath whose
+// peers are not in another network namespace or are down.
+//
+// The peer of a veth for a running container is up in the container's
+// network namespace.  A veth is left behind in other states when coild or
+// the container runtime crashed while the container was being set up or
+// torn down.
+func ListStaleVeths() ([]StaleVeth, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list links: %w", err)
+	}
+
+	var stale []StaleVeth
+	for _, l := range links {
+		if l.Type() != "veth" {
+			continue
+		}
+		c := parseLink(l)
+		if c == nil {
+			continue
+		}
+
+		// A veth is operationally down when its peer is down.
+		attrs := l.Attrs()
+		if attrs.NetNsID >= 0 && attrs.OperState != netlink.OperDown && attrs.OperState != netlink.OperLowerLayerDown {
+			continue
+		}
+		stale = append(stale, StaleVeth{
+			Name:        attrs.Name,
+			PoolName:    c.PoolName,
+			ContainerId: c.ContainerId,
+			IFace:       c.IFace,
+		})
+	}
+	return stale, nil
+}
+
+func (d *routedDatapath) Init() error {
+	if err := ip.EnableIP4Forward(); err != nil {
+		d.log.Error(err, "warning: failed to enable IPv4 forwarding")
+	}
+	if err := ip.EnableIP6Forward(); err != nil {
+		d.log.Error(err, "warning: failed to enable IPv6 forwarding")
+	}
+
+	if err := d.initRule(netlink.FAMILY_V4); err != nil {
+		d.log.Error(err, "warning: failed to init IPv4 routing rule")
+	}
+	if err := d.initRule(netlink.FAMILY_V6); err != nil {
+		d.log.Error(err, "warning: failed to init IPv6 routing rule")
+	}
+
+	if mtu, err := netutil.DetectMTU(); err != nil {
+		d.log.Error(err, "warning: failed to auto-detect the host MTU")
+	} else {
+		d.mtu = mtu
+	}
+
+	return nil
+}
+
+func (d *routedDatapath) initRule(family int) error {
+	rules, err := netlink.RuleList(family)
+	if err != nil {
+		return fmt.Errorf("netlink: rule list failed: %w", err)
+	}
+
+	for _, r := range rules {
+		if r.Priority == d.podRulePrio {
+			return nil
+		}
+	}
+
+	r := netlink.NewRule()
+	r.Family = family
+	r.Table = d.podTableId
+	r.Priority = d.podRulePrio
+	if err := netlink.RuleAdd(r); err != nil {
+		return fmt.Errorf("netlink: failed to add pod table rule: %w", err)
+	}
+	return nil
+}
+
+func (d *routedDatapath) Cleanup() error {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			return fmt.Errorf("netlink: rule list failed: %w", err)
+		}
+		for _, r := range rules {
+			if r.Priority != d.podRulePrio || r.Table != d.podTableId {
+				continue
+			}
+			// rules from RuleList cannot be passed to RuleDel as is because
+			// unset attributes are not distinguished from zero values.
+			r := netlink.NewRule()
+			r.Family = family
+			r.Table = d.podTableId
+			r.Priority = d.podRulePrio
+			if err := netlink.RuleDel(r); err != nil {
+				return fmt.Errorf("netlink: failed to delete pod table rule: %w", err)
+			}
+			d.log.Info("deleted pod table rule", "family", family, "priority", d.podRulePrio)
+		}
+
+		routes, err := netlink.RouteListFiltered(family, &netlink.Route{Table: d.podTableId}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return fmt.Errorf("netlink: failed to list routes in table %d: %w", d.podTableId, err)
+		}
+		for _, r := range routes {
+			r := r
+			if err := netlink.RouteDel(&r); err != nil && !errors.Is(err, unix.ESRCH) {
+				return fmt.Errorf("netlink: failed to delete route %s: %w", r.Dst, err)
+			}
+			d.log.Info("deleted pod route", "dst", r.Dst.String())
+		}
+	}
+	return nil
+}
+
+func (d *routedDatapath) Setup(nsPath, podName, podNS string, conf *PodNetConf, hook SetupHook) (*current.Result, error) {
+	for _, e := range conf.Extra {
+		if (e.IPv4 != nil && conf.IPv4 == nil) || (e.IPv6 != nil && conf.IPv6 == nil) {
+			return nil, errors.New("extra addresses require the primary address of the same family")
+		}
+	}
+
+	// cleanup garbage veth
+	switch l, err := lookup(conf.ContainerId, conf.IFace); err {
+	case ErrNotFound:
+	case nil:
+		// remove garbage link, if any
+		if err := netlink.LinkDel(l); err != nil {
+			return nil, fmt.Errorf("netlink: failed to delete broken link: %w", err)
+		}
+	default:
+		return nil, err
+	}
+
+	containerNS, err := ns.GetNS(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netns path %s: %w", nsPath, err)
+	}
+	defer containerNS.Close()
+
+	// setup veth and configure IP addresses
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+	}
+	err = containerNS.Do(func(hostNS ns.NetNS) error {
+		vethName := ""
+		if d.compatCalico {
+			vethName = calicoVethName(podName, podNS)
+		}
+		hVeth, cVeth, err := ip.SetupVethWithName(conf.IFace, vethName, d.mtu, "", hostNS)
+		if err != nil {
+			return fmt.Errorf("failed to setup veth: %w", err)
+		}
+
+		cLink, err := netlink.LinkByIndex(cVeth.Index)
+		if err != nil {
+			return fmt.Errorf("netlink: failed to get veth link for container: %w", err)
+		}
+
+		idx := 0
+		if conf.IPv4 != nil {
+			ipnet := netlink.NewIPNet(conf.IPv4)
+			err := netlink.AddrAdd(cLink, &netlink.Addr{
+				IPNet: ipnet,
+				Scope: unix.RT_SCOPE_UNIVERSE,
+			})
+			if err != nil {
+				netlink.LinkDel(cLink)
+				return fmt.Errorf("netlink: failed to add an address: %w", err)
+			}
+			result.IPs = append(result.IPs, &current.IPConfig{
+				Address:   *ipnet,
+				Interface: &idx,
+			})
+		}
+
+		if conf.IPv6 != nil {
+			var err error
+			switch {
+			case conf.AcceptRA:
+			case conf.DelegatedPrefix != nil:
+				err = disableSLAAC(conf.IFace)
+			default:
+				err = disableRA(conf.IFace)
+			}
+			if err != nil {
+				netlink.LinkDel(cLink)
+				return err
+			}
+
+			ipnet := netlink.NewIPNet(conf.IPv6)
+			err = netlink.AddrAdd(cLink, &netlink.Addr{
+				IPNet: ipnet,
+				Scope: unix.RT_SCOPE_UNIVERSE,
+			})
+			if err != nil {
+				netlink.LinkDel(cLink)
+				return fmt.Errorf("netlink: failed to add an address: %w", err)
+			}
+			ip.SettleAddresses(conf.IFace, 10)
+			result.IPs = append(result.IPs, &current.IPConfig{
+				Address:   *ipnet,
+				Interface: &idx,
+			})
+		}
+
+		settle := false
+		for _, e := range conf.Extra {
+			for _, a := range []net.IP{e.IPv4, e.IPv6} {
+				if a == nil {
+					continue
+				}
+				ipnet := netlink.NewIPNet(a)
+				err := netlink.AddrAdd(cLink, &netlink.Addr{
+					IPNet: ipnet,
+					Scope: unix.RT_SCOPE_UNIVERSE,
+				})
+				if err != nil {
+					netlink.LinkDel(cLink)
+					return fmt.Errorf("netlink: failed to add an extra address: %w", err)
+				}
+				settle = settle || a.To4() == nil
+				result.IPs = append(result.IPs, &current.IPConfig{
+					Address:   *ipnet,
+					Interface: &idx,
+				})
+			}
+		}
+		if settle {
+			ip.SettleAddresses(conf.IFace, 10)
+		}
+
+		result.Interfaces = []*current.Interface{
+			{
+				Name:    cVeth.Name,
+				Mac:     cVeth.HardwareAddr.String(),
+				Sandbox: nsPath,
+			},
+			{
+				Name: hVeth.Name,
+				Mac:  hVeth.HardwareAddr.String(),
+			},
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// install cleanup handler upon errors
+	hName := result.Interfaces[1].Name
+	hLink, err := netlink.LinkByName(hName)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to look up the host-side veth: %w", err)
+	}
+	defer func() {
+		if hLink != nil {
+			netlink.LinkDel(hLink)
+		}
+	}()
+
+	// give identifer as an alias of host veth
+	err = netlink.LinkSetAlias(hLink, genAlias(conf))
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to set alias: %w", err)
+	}
+
+	// setup routing on the host side
+	var hostIPv6 net.IP
+	if conf.IPv6 != nil {
+		ip.SettleAddresses(hName, 10)
+
+		err = netlink.AddrAdd(hLink, &netlink.Addr{
+			IPNet: netlink.NewIPNet(d.hostIPv6),
+			Scope: unix.RT_SCOPE_UNIVERSE,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("netlink: failed to add a host IPv6 address: %w", err)
+		}
+
+		v6Addrs, err := netlink.AddrList(hLink, netlink.FAMILY_V6)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get v6 addresses: %w", err)
+		}
+		for _, a := range v6Addrs {
+			if a.Scope == unix.RT_SCOPE_LINK {
+				hostIPv6 = a.IP
+				break
+			}
+		}
+		if hostIPv6 == nil {
+			return nil, fmt.Errorf("failed to find link-local address of %s", hLink.Attrs().Name)
+		}
+
+		err = netlink.RouteAdd(&netlink.Route{
+			Dst:       netlink.NewIPNet(conf.IPv6),
+			LinkIndex: hLink.Attrs().Index,
+			Scope:     netlink.SCOPE_LINK,
+			Protocol:  d.protocolId,
+			Table:     d.podTableId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("netlink: failed to add route to %s: %w", conf.IPv6.String(), err)
+		}
+	}
+	if conf.IPv4 != nil {
+		err = netlink.AddrAdd(hLink, &netlink.Addr{
+			IPNet: netlink.NewIPNet(d.hostIPv4),
+			Scope: unix.RT_SCOPE_UNIVERSE,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("netlink: failed to add a hostIPv4 address: %w", err)
+		}
+
+		err = netlink.RouteAdd(&netlink.Route{
+			Dst:       netlink.NewIPNet(conf.IPv4),
+			LinkIndex: hLink.Attrs().Index,
+			Scope:     netlink.SCOPE_LINK,
+			Protocol:  d.protocolId,
+			Table:     d.podTableId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("netlink: failed to add route to %s: %w", conf.IPv4.String(), err)
+		}
+	}
+
+	for i, e := range conf.Extra {
+		for _, a := range []net.IP{e.IPv4, e.IPv6} {
+			if a == nil {
+				continue
+			}
+			err = netlink.RouteAdd(&netlink.Route{
+				Dst:       netlink.NewIPNet(a),
+				LinkIndex: hLink.Attrs().Index,
+				Scope:     netlink.SCOPE_LINK,
+				Protocol:  d.protocolId,
+				Table:     d.podTableId,
+				Priority:  extraRouteMetric + i + 1,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("netlink: failed to add route to %s: %w", a.String(), err)
+			}
+		}
+	}
+
+	// setup routing on the container side
+	err = containerNS.Do(func(ns.NetNS) error {
+		l, err := netlink.LinkByName(conf.IFace)
+		if err != nil {
+			return fmt.Errorf("netlink: failed to find link: %w", err)
+		}
+		if conf.IPv4 != nil {
+			err := netlink.RouteAdd(&netlink.Route{
+				Dst:       netlink.NewIPNet(d.hostIPv4),
+				LinkIndex: l.Attrs().Index,
+				Scope:     netlink.SCOPE_LINK,
+			})
+			if err != nil {
+				return fmt.Errorf("netlink: failed to add route to %s: %w", d.hostIPv4.String(), err)
+			}
+		}
+		if conf.IPv4 != nil && !conf.NoDefaultRoute {
+			err = netlink.RouteAdd(&netlink.Route{
+				Dst:   defaultGWv4,
+				Gw:    d.hostIPv4,
+				Scope: netlink.SCOPE_UNIVERSE,
+			})
+			if err != nil {
+				return fmt.Errorf("netlink: failed to add default gw %s: %w", d.hostIPv4.String(), err)
+			}
+		}
+		if conf.IPv6 != nil && !conf.NoDefaultRoute {
+			err = netlink.RouteAdd(&netlink.Route{
+				Dst:       defaultGWv6,
+				Gw:        hostIPv6,
+				LinkIndex: l.Attrs().Index, // hostIPv6 is a link-local address, so this is required
+				Scope:     netlink.SCOPE_UNIVERSE,
+			})
+			if err != nil {
+				return fmt.Errorf("netlink: failed to add default gw %s: %w", hostIPv6.String(), err)
+			}
+		}
+
+		var gw4 net.IP
+		if conf.IPv4 != nil {
+			gw4 = d.hostIPv4
+		}
+		routes := conf.Routes
+		if conf.DelegatedPrefix != nil {
+			routes = append([]*net.IPNet{conf.DelegatedPrefix}, routes...)
+		}
+		if err := addPodRoutes(l, routes, gw4, hostIPv6); err != nil {
+			return err
+		}
+
+		if hook != nil {
+			return hook(conf.IPv4, conf.IPv6)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hLink = nil
+	return result, nil
+}
+
+func (d *routedDatapath) Check(containerId, iface string) error {
+	_, err := lookup(containerId, iface)
+	if err != nil {
+		return err
+	}
+
+	// TODO should check further details
+
+	return nil
+}
+
+func (d *routedDatapath) Destroy(containerId, iface string) error {
+	l, err := lookup(containerId, iface)
+	if err != nil {
+		return err
+	}
+
+	// The host-side veth may be removed concurrently along with the netns.
+	if err := netlink.LinkDel(l); err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok || errors.Is(err, unix.ENODEV) {
+			return nil
+		}
+		return fmt.Errorf("netlink: failed to delete link: %w", err)
+	}
+	return nil
+}
+
+func (d *routedDatapath) List() ([]*PodNetConf, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list links: %w", err)
+	}
+
+	v4Routes, err := netlink.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: d.podTableId}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list IPv4 routes in table %d: %w", d.podTableId, err)
+	}
+	v4Map := make(map[int]net.IP)
+	extras := make(extraRoutes)
+	for _, r := range v4Routes {
+		if r.Priority > extraRouteMetric {
+			extras.get(r.LinkIndex, r.Priority).IPv4 = r.Dst.IP.To4()
+			continue
+		}
+		v4Map[r.LinkIndex] = r.Dst.IP.To4()
+	}
+
+	// TODO: remove this when releasing Coil 2.1
+	if d.registerFromMain {
+		v4Routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+		if err != nil {
+			return nil, fmt.Errorf("netlink: failed to list IPv4 routes: %w", err)
+		}
+		for _, r := range v4Routes {
+			if r.Protocol != d.protocolId && r.Protocol != 3 {
+				// Calico replaces protocol ID to 3 (== boot)
+				continue
+			}
+			if _, ok := v4Map[r.LinkIndex]; ok {
+				continue
+			}
+			v4Map[r.LinkIndex] = r.Dst.IP.To4()
+		}
+	}
+
+	v6Routes, err := netlink.RouteListFiltered(netlink.FAMILY_V6, &netlink.Route{Table: d.podTableId}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list IPv6 routes in table %d: %w", d.podTableId, err)
+	}
+	v6Map := make(map[int]net.IP)
+	for _, r := range v6Routes {
+		if r.Priority > extraRouteMetric {
+			extras.get(r.LinkIndex, r.Priority).IPv6 = r.Dst.IP.To16()
+			continue
+		}
+		v6Map[r.LinkIndex] = r.Dst.IP.To16()
+	}
+
+	// TODO: remove this when releasing Coil 2.1
+	if d.registerFromMain {
+		v6Routes, err := netlink.RouteList(nil, netlink.FAMILY_V6)
+		if err != nil {
+			return nil, fmt.Errorf("netlink: failed to list IPv6 routes: %w", err)
+		}
+		for _, r := range v6Routes {
+			if r.Protocol != d.protocolId && r.Protocol != 3 {
+				continue
+			}
+			if _, ok := v6Map[r.LinkIndex]; ok {
+				continue
+			}
+			v6Map[r.LinkIndex] = r.Dst.IP.To16()
+		}
+	}
+
+	var confs []*PodNetConf
+	for _, l := range links {
+		conf := parseLink(l)
+		if conf != nil {
+			idx := l.Attrs().Index
+			conf.IPv4 = v4Map[idx]
+			conf.IPv6 = v6Map[idx]
+			conf.Extra = extras.list(idx)
+			confs = append(confs, conf)
+		}
+	}
+
+	return confs, nil
+}
+
+// extraRouteMetric is the base of the metrics of routes to extra addresses.
+// The route to the n-th extra address has the metric extraRouteMetric + n so
+// that List can tell them from the routes to the primary addresses, whose
+// metrics are 0 for IPv4 and 1024 for IPv6.
+const extraRouteMetric = 3000
+
+// extraRoutes collects extra addresses from routes by link index and metric.
+type extraRoutes map[int]map[int]*ExtraAddress
+
+func (e extraRoutes) get(linkIndex, metric int) *ExtraAddress {
+	m, ok := e[linkIndex]
+	if !ok {
+		m = make(map[int]*ExtraAddress)
+		e[linkIndex] = m
+	}
+	a, ok := m[metric]
+	if !ok {
+		a = &ExtraAddress{}
+		m[metric] = a
+	}
+	return a
+}
+
+// list returns the extra addresses of the link in the order of Setup.
+func (e extraRoutes) list(linkIndex int) []ExtraAddress {
+	m := e[linkIndex]
+	if len(m) == 0 {
+		return nil
+	}
+	metrics := make([]int, 0, len(m))
+	for metric := range m {
+		metrics = append(metrics, metric)
+	}
+	sort.Ints(metrics)
+	addrs := make([]ExtraAddress, len(metrics))
+	for i, metric := range metrics {
+		addrs[i] = *m[metric]
+	}
+	return addrs
+}
+
+func (d *routedDatapath) Stats() ([]TrafficStats, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("netlink: failed to list links: %w", err)
+	}
+
+	var stats []TrafficStats
+	for _, l := range links {
+		c := parseLink(l)
+		if c == nil {
+			continue
+		}
+		st := l.Attrs().Statistics
+		if st == nil {
+			continue
+		}
+		// the host-side veth receives what the container sends, and vice versa.
+		stats = append(stats, TrafficStats{
+			PoolName:    c.PoolName,
+			ContainerId: c.ContainerId,
+			IFace:       c.IFace,
+			TxPackets:   st.RxPackets,
+			TxBytes:     st.RxBytes,
+			RxPackets:   st.TxPackets,
+			RxBytes:     st.TxBytes,
+		})
+	}
+	return stats, nil
+}
@@ -0,0 +1,104 @@
+package nodenet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SelfTestContainerID is the container ID with which SelfTest connects
+// the scratch network namespace.
+const SelfTestContainerID = "coil-self-test"
+
+// selfTestAttempts is the number of echo requests sent to each target.
+// The host-side IPv6 address of a new veth is not usable until DAD completes,
+// which takes a couple of seconds.
+const selfTestAttempts = 5
+
+// Default addresses for SelfTest.  They are taken from the ranges reserved
+// for benchmarking by RFC 2544 and RFC 5180 so that they never collide with
+// the addresses of Pods.
+var (
+	DefaultSelfTestIPv4 = net.ParseIP("198.18.255.254")
+	DefaultSelfTestIPv6 = net.ParseIP("2001:2::fffe")
+)
+
+// SelfTest verifies the datapath of `pn` end to end.
+//
+// It creates a scratch network namespace, connects it to the host network
+// with `ipv4` and/or `ipv6` as if it were a Pod, and sends ICMP echo requests
+// from the namespace to `targets` of the same address family.  Each request
+// times out after `timeout`, and is retried a few times.
+// The namespace and the network configurations are removed before returning.
+func SelfTest(pn PodNetwork, ipv4, ipv6 net.IP, targets []net.IP, timeout time.Duration) error {
+	var pings []net.IP
+	for _, t := range targets {
+		if (t.To4() != nil && ipv4 != nil) || (t.To4() == nil && ipv6 != nil) {
+			pings = append(pings, t)
+		}
+	}
+	if len(pings) == 0 {
+		return errors.New("no target to ping for the self-test addresses")
+	}
+
+	return withScratchNS(func(nsPath string) (err error) {
+		conf := &PodNetConf{
+			ContainerId: SelfTestContainerID,
+			IFace:       "eth0",
+			IPv4:        ipv4,
+			IPv6:        ipv6,
+		}
+		if _, err := pn.Setup(nsPath, SelfTestContainerID, "", conf, nil); err != nil {
+			return fmt.Errorf("failed to set up the scratch network: %w", err)
+		}
+		defer func() {
+			if err2 := pn.Destroy(SelfTestContainerID, conf.IFace); err2 != nil && err == nil {
+				err = fmt.Errorf("failed to tear down the scratch network: %w", err2)
+			}
+		}()
+
+		for _, t := range pings {
+			for i := 0; ; i++ {
+				err := Ping(nsPath, t, timeout)
+				if err == nil {
+					break
+				}
+				if i+1 == selfTestAttempts || !errors.Is(err, ErrUnreachable) {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// withScratchNS calls `f` with the path of a new network namespace.
+// The namespace is held by a dedicated OS thread, and disappears when
+// `f` returns without leaving mount points behind.
+func withScratchNS(f func(nsPath string) error) error {
+	ready := make(chan error)
+	done := make(chan struct{})
+	var nsPath string
+	go func() {
+		// The thread is not unlocked so that it exits along with the namespace.
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			ready <- fmt.Errorf("failed to create a network namespace: %w", err)
+			return
+		}
+		nsPath = fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid())
+		close(ready)
+		<-done
+	}()
+	if err := <-ready; err != nil {
+		return err
+	}
+	defer close(done)
+
+	return f(nsPath)
+}
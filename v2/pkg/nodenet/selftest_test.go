@@ -0,0 +1,53 @@
+package nodenet
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestSelfTest(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("run as root")
+	}
+
+	hostIPv4 := net.ParseIP("10.20.30.42")
+	hostIPv6 := net.ParseIP("fd10::42")
+	pn := NewPodNetwork(116, 2000, 30, hostIPv4, hostIPv6,
+		false, false, "", "", ctrl.Log.WithName("pod-network"))
+	if err := pn.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := SelfTest(pn, DefaultSelfTestIPv4, DefaultSelfTestIPv6, []net.IP{hostIPv4, hostIPv6}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confs, err := pn.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range confs {
+		if c.ContainerId == SelfTestContainerID {
+			t.Error("the scratch network should be torn down")
+		}
+	}
+
+	// unreachable targets fail the test.
+	err = SelfTest(pn, DefaultSelfTestIPv4, nil, []net.IP{net.ParseIP("10.20.30.99")}, 100*time.Millisecond)
+	if err == nil {
+		t.Error("self-test should fail for unreachable targets")
+	}
+	if err := pn.Check(SelfTestContainerID, "eth0"); err == nil {
+		t.Error("the scratch network should be torn down after failure")
+	}
+
+	err = SelfTest(pn, nil, DefaultSelfTestIPv6, []net.IP{hostIPv4}, time.Second)
+	if err == nil {
+		t.Error("self-test should fail without targets of the family")
+	}
+}
@@ -0,0 +1,106 @@
+package nodenet
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ServiceRules keeps the traffic to Kubernetes Services off the routes of Coil.
+//
+// The routes to Pods are looked up before the main table by the rule of
+// `--pod-rule-prio`.  If an address block of Coil overlaps the Service CIDR,
+// packets to Service addresses are mis-routed to Pods instead of being
+// handled by kube-proxy, which is hard to notice with IPVS because the
+// Service addresses are assigned to a dummy interface on the node.
+// ServiceRules installs routing rules to look up the main table for the
+// Service CIDRs with a higher priority than the rule for Pods.
+type ServiceRules interface {
+	// Init installs the rules and removes stale ones of the same priority.
+	Init() error
+
+	// Cleanup removes the rules.
+	Cleanup() error
+}
+
+// NewServiceRules creates ServiceRules for `serviceCIDRs` with priority `prio`.
+func NewServiceRules(serviceCIDRs []*net.IPNet, prio int, log logr.Logger) ServiceRules {
+	return &serviceRules{
+		serviceCIDRs: serviceCIDRs,
+		prio:         prio,
+		log:          log,
+	}
+}
+
+type serviceRules struct {
+	serviceCIDRs []*net.IPNet
+	prio         int
+	log          logr.Logger
+}
+
+func (s *serviceRules) newRule(family int, dst *net.IPNet) *netlink.Rule {
+	r := netlink.NewRule()
+	r.Family = family
+	r.Table = unix.RT_TABLE_MAIN
+	r.Priority = s.prio
+	r.Dst = dst
+	return r
+}
+
+func (s *serviceRules) sync(cidrs []*net.IPNet) error {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			return fmt.Errorf("netlink: rule list failed: %w", err)
+		}
+
+		current := make(map[string]bool)
+		for _, r := range rules {
+			if r.Priority != s.prio || r.Table != unix.RT_TABLE_MAIN || r.Dst == nil {
+				continue
+			}
+			current[r.Dst.String()] = true
+		}
+
+		desired := make(map[string]bool)
+		for _, n := range cidrs {
+			if (n.IP.To4() != nil) != (family == netlink.FAMILY_V4) {
+				continue
+			}
+			desired[n.String()] = true
+			if current[n.String()] {
+				continue
+			}
+			if err := netlink.RuleAdd(s.newRule(family, n)); err != nil {
+				return fmt.Errorf("netlink: failed to add rule for %s: %w", n, err)
+			}
+			s.log.Info("added service rule", "dst", n.String(), "priority", s.prio)
+		}
+
+		for dst := range current {
+			if desired[dst] {
+				continue
+			}
+			_, n, err := net.ParseCIDR(dst)
+			if err != nil {
+				return err
+			}
+			if err := netlink.RuleDel(s.newRule(family, n)); err != nil {
+				return fmt.Errorf("netlink: failed to delete rule for %s: %w", dst, err)
+			}
+			s.log.Info("deleted service rule", "dst", dst, "priority", s.prio)
+		}
+	}
+	return nil
+}
+
+func (s *serviceRules) Init() error {
+	return s.sync(s.serviceCIDRs)
+}
+
+func (s *serviceRules) Cleanup() error {
+	return s.sync(nil)
+}
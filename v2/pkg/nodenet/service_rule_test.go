@@ -0,0 +1,67 @@
+package nodenet
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const testServiceRulePrio = 1888
+
+func getServiceRules(t *testing.T) map[string]bool {
+	result := make(map[string]bool)
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rules {
+			if r.Priority != testServiceRulePrio || r.Table != unix.RT_TABLE_MAIN || r.Dst == nil {
+				continue
+			}
+			result[r.Dst.String()] = true
+		}
+	}
+	return result
+}
+
+func TestServiceRules(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("need root privilege")
+	}
+
+	log := ctrl.Log.WithName("service-rules")
+	sr := NewServiceRules(parseCIDRs(t, "10.96.0.0/12", "fd03::/112"), testServiceRulePrio, log)
+	if err := sr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	// Init is idempotent.
+	if err := sr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	rules := getServiceRules(t)
+	if !cmp.Equal(rules, map[string]bool{"10.96.0.0/12": true, "fd03::/112": true}) {
+		t.Error("unexpected rules:", rules)
+	}
+
+	// rules for Service CIDRs no longer given are removed.
+	sr = NewServiceRules(parseCIDRs(t, "10.100.0.0/16"), testServiceRulePrio, log)
+	if err := sr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	rules = getServiceRules(t)
+	if !cmp.Equal(rules, map[string]bool{"10.100.0.0/16": true}) {
+		t.Error("stale rules should be removed:", rules)
+	}
+
+	if err := sr.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if rules := getServiceRules(t); len(rules) != 0 {
+		t.Error("rules should be removed:", rules)
+	}
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultTimeout is the default timeout duration to send a notification.
+const DefaultTimeout = 10 * time.Second
+
+// EventType enumerates the types of notified events.
+type EventType string
+
+// Valid values for EventType
+const (
+	EventPoolExhausted    EventType = "PoolExhausted"
+	EventOrphanedBlock    EventType = "OrphanedBlock"
+	EventBlockReleased    EventType = "BlockReleased"
+	EventGarbageCollected EventType = "GarbageCollected"
+)
+
+// Event represents an event that operators should be aware of.
+type Event struct {
+	Type    EventType `json:"type"`
+	Pool    string    `json:"pool,omitempty"`
+	Node    string    `json:"node,omitempty"`
+	Block   string    `json:"block,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func (ev Event) text() string {
+	s := fmt.Sprintf("[coil] %s: %s", ev.Type, ev.Message)
+	if ev.Pool != "" {
+		s += " pool=" + ev.Pool
+	}
+	if ev.Node != "" {
+		s += " node=" + ev.Node
+	}
+	if ev.Block != "" {
+		s += " block=" + ev.Block
+	}
+	return s
+}
+
+// Notifier notifies events to external systems.
+type Notifier interface {
+	// Notify sends ev asynchronously.  Failures are only logged.
+	Notify(ev Event)
+}
+
+type target struct {
+	url   string
+	slack bool
+}
+
+// NewWebhookNotifier creates a Notifier that POSTs events to HTTP webhooks.
+//
+// `urls` receive events as JSON objects of Event.
+// `slackURLs` receive events as Slack incoming webhook messages.
+// If both are empty, the returned Notifier does nothing.
+func NewWebhookNotifier(log logr.Logger, urls, slackURLs []string) Notifier {
+	var targets []target
+	for _, u := range urls {
+		targets = append(targets, target{url: u})
+	}
+	for _, u := range slackURLs {
+		targets = append(targets, target{url: u, slack: true})
+	}
+
+	return &webhookNotifier{
+		log:     log,
+		client:  &http.Client{Timeout: DefaultTimeout},
+		targets: targets,
+	}
+}
+
+type webhookNotifier struct {
+	log     logr.Logger
+	client  *http.Client
+	targets []target
+}
+
+func (n *webhookNotifier) Notify(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	for _, t := range n.targets {
+		go func(t target) {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+			defer cancel()
+
+			if err := n.send(ctx, t, ev); err != nil {
+				n.log.Error(err, "failed to send a notification", "type", ev.Type)
+			}
+		}(t)
+	}
+}
+
+func (n *webhookNotifier) send(ctx context.Context, t target, ev Event) error {
+	var body interface{} = ev
+	if t.slack {
+		body = map[string]string{"text": ev.text()}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
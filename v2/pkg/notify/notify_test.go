@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	generic := make(chan Event, 1)
+	genericServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		generic <- ev
+	}))
+	defer genericServer.Close()
+
+	slack := make(chan map[string]string, 1)
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := make(map[string]string)
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		slack <- msg
+	}))
+	defer slackServer.Close()
+
+	n := NewWebhookNotifier(logr.Discard(), []string{genericServer.URL}, []string{slackServer.URL})
+	n.Notify(Event{
+		Type:    EventPoolExhausted,
+		Pool:    "default",
+		Node:    "node1",
+		Message: "no free blocks",
+	})
+
+	select {
+	case ev := <-generic:
+		if ev.Type != EventPoolExhausted {
+			t.Error("unexpected event type:", ev.Type)
+		}
+		if ev.Pool != "default" || ev.Node != "node1" {
+			t.Errorf("unexpected event: %+v", ev)
+		}
+		if ev.Time.IsZero() {
+			t.Error("time should be filled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generic webhook was not called")
+	}
+
+	select {
+	case msg := <-slack:
+		text := msg["text"]
+		if !strings.Contains(text, "PoolExhausted") || !strings.Contains(text, "pool=default") {
+			t.Error("unexpected slack message:", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slack webhook was not called")
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(logr.Discard(), []string{server.URL}, nil).(*webhookNotifier)
+	err := n.send(context.Background(), n.targets[0], Event{Type: EventGarbageCollected})
+	if err == nil {
+		t.Error("send should fail for 500 response")
+	}
+}
@@ -0,0 +1,115 @@
+// Package resultcache implements a node-local cache of CNI ADD results.
+//
+// coil records the result of ADD for each container and interface, and returns
+// it for duplicate ADDs of the same container as libcni does with its cached
+// results.  Each entry is stored in a separate file, so the cache can be
+// written and read concurrently by different processes.
+package resultcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const fileSuffix = ".json"
+
+// Entry represents the result of ADD for a container and interface.
+type Entry struct {
+	ContainerID string          `json:"container_id"`
+	Ifname      string          `json:"ifname"`
+	Netns       string          `json:"netns"`
+	Result      json.RawMessage `json:"result"`
+	Cached      time.Time       `json:"cached"`
+}
+
+func fileName(containerID, ifname string) (string, error) {
+	if containerID == "" || ifname == "" {
+		return "", errors.New("container ID and interface name are required")
+	}
+	// container IDs and interface names never contain colons.
+	if strings.ContainsAny(containerID+ifname, "/:") || strings.HasPrefix(containerID, ".") {
+		return "", fmt.Errorf("invalid entry: %s %s", containerID, ifname)
+	}
+	return containerID + ":" + ifname + fileSuffix, nil
+}
+
+// Put stores `e` in the cache in `dir`, replacing the entry for the same
+// container and interface, if any.
+func Put(dir string, e Entry) error {
+	name, err := fileName(e.ContainerID, e.Ifname)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file then rename it to make the update atomic.
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
+
+// Get returns the entry for the container and interface in `dir`.
+// If there is no entry or the entry is broken, Get returns nil.
+func Get(dir, containerID, ifname string) (*Entry, error) {
+	name, err := fileName(containerID, ifname)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, nil
+	}
+	if e.ContainerID != containerID || e.Ifname != ifname || len(e.Result) == 0 {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// Remove removes the entry for the container and interface in `dir`.
+// Removing a non-existing entry is not an error.
+func Remove(dir, containerID, ifname string) error {
+	name, err := fileName(containerID, ifname)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
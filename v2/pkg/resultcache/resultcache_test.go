@@ -0,0 +1,66 @@
+package resultcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "results")
+
+	e, err := Get(dir, "c1", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Error("cache should be empty:", e)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	e1 := Entry{ContainerID: "c1", Ifname: "eth0", Netns: "/run/netns/ns1", Result: []byte(`{"cniVersion":"1.0.0"}`), Cached: now}
+	e2 := Entry{ContainerID: "c1", Ifname: "eth0", Netns: "/run/netns/ns2", Result: []byte(`{"cniVersion":"0.4.0"}`), Cached: now}
+	for _, e := range []Entry{e1, e2} {
+		if err := Put(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Put(dir, Entry{ContainerID: "../c3", Ifname: "eth0"}); err == nil {
+		t.Error("invalid entry should be rejected")
+	}
+
+	e, err = Get(dir, "c1", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || e.Netns != "/run/netns/ns2" || string(e.Result) != `{"cniVersion":"0.4.0"}` || !e.Cached.Equal(now) {
+		t.Error("the entry should be replaced:", e)
+	}
+
+	// broken files are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "broken:eth0.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e, err = Get(dir, "broken", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Error("broken entry should be ignored:", e)
+	}
+
+	if err := Remove(dir, "c1", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(dir, "c1", "eth0"); err != nil {
+		t.Error("removing a removed entry should succeed:", err)
+	}
+	e, err = Get(dir, "c1", "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Error("removed entry should not be returned:", e)
+	}
+}
@@ -0,0 +1,159 @@
+package routeaudit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StatusPath is the path of the metrics endpoint of coild serving NodeRoutes.
+const StatusPath = "/status/routes"
+
+// NodeRoutes is the routes of address blocks exported by coild on a node.
+type NodeRoutes struct {
+	Node     string   `json:"node"`
+	Exported []string `json:"exported"`
+}
+
+// NodeResult is the audit result of a node.
+//
+// Missing are the subnets of the address blocks of the node that are not exported.
+// Extra are the exported subnets that do not belong to the node.
+// Error is set if the routes of the node could not be fetched.
+type NodeResult struct {
+	Node    string   `json:"node"`
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// OK returns true if no problem is found in the node.
+func (r NodeResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && r.Error == ""
+}
+
+// Report is the result of an audit.
+type Report struct {
+	Time  time.Time    `json:"time"`
+	Nodes []NodeResult `json:"nodes"`
+}
+
+// Fetcher fetches the routes exported by a coild Pod.
+type Fetcher func(ctx context.Context, pod *corev1.Pod) (*NodeRoutes, error)
+
+// HTTPFetcher returns a Fetcher that requests the metrics endpoint of coild
+// on `port` of the Pod IP address.  coild runs in the host network, so it
+// is the address of the node.
+func HTTPFetcher(port int, timeout time.Duration) Fetcher {
+	hc := &http.Client{Timeout: timeout}
+	return func(ctx context.Context, pod *corev1.Pod) (*NodeRoutes, error) {
+		if pod.Status.PodIP == "" {
+			return nil, fmt.Errorf("pod %s has no IP address", pod.Name)
+		}
+		u := "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)) + StatusPath
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned %s", u, resp.Status)
+		}
+
+		nr := &NodeRoutes{}
+		if err := json.NewDecoder(resp.Body).Decode(nr); err != nil {
+			return nil, fmt.Errorf("failed to decode the response of %s: %w", u, err)
+		}
+		return nr, nil
+	}
+}
+
+// Audit compares the routes exported by coild Pods in `namespace` with
+// the address blocks assigned to their nodes.
+func Audit(ctx context.Context, r client.Reader, namespace string, fetch Fetcher) (*Report, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods,
+		client.InNamespace(namespace),
+		client.MatchingLabels{constants.LabelAppComponent: "coild"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list coild Pods: %w", err)
+	}
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.List(ctx, blocks); err != nil {
+		return nil, fmt.Errorf("failed to list AddressBlocks: %w", err)
+	}
+	expected := make(map[string][]string)
+	for _, b := range blocks.Items {
+		node := b.Labels[constants.LabelNode]
+		for _, s := range []*string{b.IPv4, b.IPv6} {
+			if s == nil {
+				continue
+			}
+			if _, n, err := net.ParseCIDR(*s); err == nil {
+				expected[node] = append(expected[node], n.String())
+			}
+		}
+	}
+
+	report := &Report{Time: time.Now().UTC()}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		res := NodeResult{Node: pod.Spec.NodeName}
+		nr, err := fetch(ctx, pod)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Missing, res.Extra = diff(expected[pod.Spec.NodeName], nr.Exported)
+		}
+		report.Nodes = append(report.Nodes, res)
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		return report.Nodes[i].Node < report.Nodes[j].Node
+	})
+	return report, nil
+}
+
+// diff returns the subnets in `expected` but not in `actual`, and vice versa.
+func diff(expected, actual []string) (missing, extra []string) {
+	actualSet := make(map[string]bool)
+	for _, a := range actual {
+		if _, n, err := net.ParseCIDR(a); err == nil {
+			actualSet[n.String()] = true
+		}
+	}
+	expectedSet := make(map[string]bool)
+	for _, e := range expected {
+		expectedSet[e] = true
+		if !actualSet[e] {
+			missing = append(missing, e)
+		}
+	}
+	for a := range actualSet {
+		if !expectedSet[a] {
+			extra = append(extra, a)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return
+}
@@ -0,0 +1,85 @@
+package routeaudit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func testBlock(name, node string, ipv4, ipv6 *string) *coilv2.AddressBlock {
+	b := &coilv2.AddressBlock{IPv4: ipv4, IPv6: ipv6}
+	b.Name = name
+	b.Labels = map[string]string{constants.LabelNode: node}
+	return b
+}
+
+func testCoild(name, node string) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Namespace = "kube-system"
+	pod.Name = name
+	pod.Labels = map[string]string{constants.LabelAppComponent: "coild"}
+	pod.Spec.NodeName = node
+	return pod
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	objs := []client.Object{
+		testBlock("default-0", "node1", strPtr("10.2.0.0/31"), strPtr("fd02::/127")),
+		testBlock("default-1", "node1", strPtr("10.2.0.2/31"), nil),
+		testBlock("default-2", "node2", strPtr("10.2.0.4/31"), nil),
+		testCoild("coild-3", "node3"),
+		testCoild("coild-2", "node2"),
+		testCoild("coild-1", "node1"),
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	exported := map[string][]string{
+		"node1": {"10.2.0.0/31", "fd02::/127", "10.2.0.6/31"},
+		"node2": {"10.2.0.4/31"},
+	}
+	fetch := func(ctx context.Context, pod *corev1.Pod) (*NodeRoutes, error) {
+		routes, ok := exported[pod.Spec.NodeName]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return &NodeRoutes{Node: pod.Spec.NodeName, Exported: routes}, nil
+	}
+
+	report, err := Audit(context.Background(), c, "kube-system", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []NodeResult{
+		{Node: "node1", Missing: []string{"10.2.0.2/31"}, Extra: []string{"10.2.0.6/31"}},
+		{Node: "node2"},
+		{Node: "node3", Error: "connection refused"},
+	}
+	if !reflect.DeepEqual(report.Nodes, expected) {
+		t.Errorf("unexpected report: %+v", report.Nodes)
+	}
+	if report.Nodes[0].OK() || !report.Nodes[1].OK() || report.Nodes[2].OK() {
+		t.Error("OK returned unexpected results")
+	}
+}
@@ -0,0 +1,175 @@
+package runners
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var addDedupCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "add_deduplicated_total",
+		Help:      "the number of Add requests served with the result of a preceding request",
+	},
+	[]string{"state"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(addDedupCounter)
+}
+
+type addKey struct {
+	containerID string
+	ifname      string
+}
+
+// addCall is an Add request in flight or completed recently.
+type addCall struct {
+	netns    string
+	done     chan struct{}
+	finished time.Time
+	resp     interface{}
+	err      error
+}
+
+// addDedup shares the results of Add requests for the same container
+// and interface.  kubelet retries ADD when the first attempt takes long,
+// and the retry would otherwise run concurrently with the first one or
+// find the address already allocated.
+//
+// A retry waits for the request in flight and receives its result.
+// A retry within `window` after the completion receives the same result.
+// Failed results are not kept after the completion so that the next retry
+// can start over.
+type addDedup struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	calls map[addKey]*addCall
+}
+
+func newAddDedup(window time.Duration) *addDedup {
+	return &addDedup{
+		window: window,
+		calls:  make(map[addKey]*addCall),
+	}
+}
+
+// expire removes completed calls older than the window.  d.mu must be held.
+func (d *addDedup) expire(now time.Time) {
+	for k, c := range d.calls {
+		if !c.finished.IsZero() && now.Sub(c.finished) > d.window {
+			delete(d.calls, k)
+		}
+	}
+}
+
+func (d *addDedup) add(ctx context.Context, args *cnirpc.CNIArgs, handler func() (interface{}, error)) (interface{}, error) {
+	key := addKey{containerID: args.ContainerId, ifname: args.Ifname}
+
+	d.mu.Lock()
+	d.expire(time.Now())
+	c, ok := d.calls[key]
+	if ok && c.netns == args.Netns {
+		inFlight := c.finished.IsZero()
+		d.mu.Unlock()
+		if inFlight {
+			addDedupCounter.WithLabelValues("in_flight").Inc()
+		} else {
+			addDedupCounter.WithLabelValues("completed").Inc()
+		}
+		select {
+		case <-c.done:
+			return c.resp, c.err
+		case <-ctx.Done():
+			return nil, newDeadlineError(ctx.Err(), "deadline exceeded while waiting for the preceding request")
+		}
+	}
+
+	// a different netns means the container was recreated with the same ID.
+	c = &addCall{netns: args.Netns, done: make(chan struct{})}
+	d.calls[key] = c
+	d.mu.Unlock()
+
+	resp, err := handler()
+
+	d.mu.Lock()
+	c.resp, c.err = resp, err
+	c.finished = time.Now()
+	if err != nil && d.calls[key] == c {
+		delete(d.calls, key)
+	}
+	d.mu.Unlock()
+	close(c.done)
+	return resp, err
+}
+
+// forget removes the result for the container and interface.
+// Requests waiting for the request in flight still receive its result.
+func (d *addDedup) forget(args *cnirpc.CNIArgs) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.calls, addKey{containerID: args.ContainerId, ifname: args.Ifname})
+}
+
+// wait waits for the Add request in flight for the container and interface, if any.
+func (d *addDedup) wait(ctx context.Context, args *cnirpc.CNIArgs) error {
+	d.mu.Lock()
+	c, ok := d.calls[addKey{containerID: args.ContainerId, ifname: args.Ifname}]
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return newDeadlineError(ctx.Err(), "deadline exceeded while waiting for the preceding request")
+	}
+}
+
+// addDedupInterceptor returns an interceptor that deduplicates Add requests
+// with `d`.  Del requests wait for Add in flight, and forget the results
+// of Add for the container.  Recover requests wait for Add in flight, and
+// forget its result unless the Pod network is committed.
+func addDedupInterceptor(d *addDedup) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		args, ok := req.(*cnirpc.CNIArgs)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		switch info.FullMethod {
+		case "/pkg.cnirpc.CNI/Add":
+			return d.add(ctx, args, func() (interface{}, error) {
+				return handler(ctx, req)
+			})
+		case "/pkg.cnirpc.CNI/Del":
+			// Add in flight would set up the Pod network again after Del tears it down.
+			if err := d.wait(ctx, args); err != nil {
+				return nil, err
+			}
+			d.forget(args)
+		case "/pkg.cnirpc.CNI/Recover":
+			if err := d.wait(ctx, args); err != nil {
+				return nil, err
+			}
+			resp, err := handler(ctx, req)
+			if r, ok := resp.(*cnirpc.RecoverResponse); !ok || !r.GetCommitted() {
+				d.forget(args)
+			}
+			return resp, err
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,242 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAddDedupInterceptor(t *testing.T) {
+	t.Parallel()
+
+	var nCalls int32
+	var fail int32
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&nCalls, 1)
+		<-release
+		if atomic.LoadInt32(&fail) != 0 {
+			return nil, errors.New("failed")
+		}
+		return n, nil
+	}
+	interceptor := addDedupInterceptor(newAddDedup(time.Hour))
+	addInfo := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Add"}
+	delInfo := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Del"}
+	args := &cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0", Netns: "/run/netns/c1"}
+
+	add := func(args *cnirpc.CNIArgs) (interface{}, error) {
+		return interceptor(context.Background(), args, addInfo, handler)
+	}
+
+	// concurrent requests share the request in flight.
+	var wg sync.WaitGroup
+	results := make([]interface{}, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := add(args)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = resp
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for _, r := range results {
+		if r != int32(1) {
+			t.Error("concurrent requests should receive the same result:", results)
+			break
+		}
+	}
+
+	// a retry after the completion receives the same result.
+	if resp, err := add(args); err != nil || resp != int32(1) {
+		t.Error("a retry should receive the previous result:", resp, err)
+	}
+
+	// a different interface or netns is a different request.
+	if resp, _ := add(&cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth1", Netns: "/run/netns/c1"}); resp != int32(2) {
+		t.Error("a request for another interface should be processed:", resp)
+	}
+	if resp, _ := add(&cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0", Netns: "/run/netns/c2"}); resp != int32(3) {
+		t.Error("a request for another netns should be processed:", resp)
+	}
+
+	// DEL forgets the result.
+	delHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	if _, err := interceptor(context.Background(), args, delInfo, delHandler); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&fail, 1)
+	if _, err := add(args); err == nil {
+		t.Error("a request after DEL should be processed")
+	}
+
+	// failures are not remembered.
+	atomic.StoreInt32(&fail, 0)
+	if resp, err := add(args); err != nil || resp != int32(5) {
+		t.Error("a retry after a failure should be processed:", resp, err)
+	}
+	if n := atomic.LoadInt32(&nCalls); n != 5 {
+		t.Error("unexpected number of calls:", n)
+	}
+}
+
+func TestAddDedupWait(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		return "ok", nil
+	}
+	interceptor := addDedupInterceptor(newAddDedup(time.Hour))
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Add"}
+	args := &cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0"}
+
+	go interceptor(context.Background(), args, info, handler)
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := interceptor(ctx, args, info, handler)
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("unexpected code %v: %v", code, err)
+	}
+}
+
+func TestAddDedupExpire(t *testing.T) {
+	t.Parallel()
+
+	var nCalls int32
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return atomic.AddInt32(&nCalls, 1), nil
+	}
+	interceptor := addDedupInterceptor(newAddDedup(50 * time.Millisecond))
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Add"}
+	args := &cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0"}
+
+	interceptor(context.Background(), args, info, handler)
+	time.Sleep(100 * time.Millisecond)
+	if resp, _ := interceptor(context.Background(), args, info, handler); resp != int32(2) {
+		t.Error("the result should expire after the window:", resp)
+	}
+}
+
+func TestAddDedupRecover(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	var nCalls int32
+	addHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		return atomic.AddInt32(&nCalls, 1), nil
+	}
+	var committed int32
+	recoverHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if atomic.LoadInt32(&nCalls) == 0 {
+			t.Error("Recover should wait for Add in flight")
+		}
+		return &cnirpc.RecoverResponse{Committed: atomic.LoadInt32(&committed) != 0}, nil
+	}
+	interceptor := addDedupInterceptor(newAddDedup(time.Hour))
+	addInfo := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Add"}
+	recoverInfo := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Recover"}
+	args := &cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0"}
+
+	go interceptor(context.Background(), args, addInfo, addHandler)
+	time.Sleep(100 * time.Millisecond)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+
+	// a committed result is kept.
+	atomic.StoreInt32(&committed, 1)
+	if _, err := interceptor(context.Background(), args, recoverInfo, recoverHandler); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := interceptor(context.Background(), args, addInfo, addHandler); resp != int32(1) {
+		t.Error("the result should be kept after committed Recover:", resp)
+	}
+
+	// otherwise the result is forgotten.
+	atomic.StoreInt32(&committed, 0)
+	if _, err := interceptor(context.Background(), args, recoverInfo, recoverHandler); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := interceptor(context.Background(), args, addInfo, addHandler); resp != int32(2) {
+		t.Error("the result should be forgotten after uncommitted Recover:", resp)
+	}
+}
+
+func TestAddDedupDel(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	var nAdds, nDels int32
+	addHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		if atomic.LoadInt32(&nDels) != 0 {
+			t.Error("Add should not run after Del")
+		}
+		return atomic.AddInt32(&nAdds, 1), nil
+	}
+	delHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if atomic.LoadInt32(&nAdds) == 0 {
+			t.Error("Del should wait for Add in flight")
+		}
+		atomic.AddInt32(&nDels, 1)
+		return "deleted", nil
+	}
+	interceptor := addDedupInterceptor(newAddDedup(time.Hour))
+	addInfo := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Add"}
+	delInfo := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Del"}
+	args := &cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0"}
+
+	added := make(chan interface{})
+	go func() {
+		resp, _ := interceptor(context.Background(), args, addInfo, addHandler)
+		added <- resp
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Del gives up if Add does not finish before the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := interceptor(ctx, args, delInfo, delHandler); status.Code(err) != codes.DeadlineExceeded {
+		t.Error("Del should time out while waiting for Add:", err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	if resp, err := interceptor(context.Background(), args, delInfo, delHandler); err != nil || resp != "deleted" {
+		t.Fatal(resp, err)
+	}
+	if resp := <-added; resp != int32(1) {
+		t.Error("unexpected result of Add:", resp)
+	}
+
+	// the result of Add is forgotten after Del.
+	atomic.StoreInt32(&nDels, 0)
+	if resp, _ := interceptor(context.Background(), args, addInfo, addHandler); resp != int32(2) {
+		t.Error("the result should be forgotten after Del:", resp)
+	}
+}
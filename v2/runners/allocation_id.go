@@ -0,0 +1,47 @@
+package runners
+
+import (
+	"fmt"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+)
+
+// Kinds of the IDs for which coild allocates addresses.
+const (
+	// AllocationIDContainer allocates addresses for each CNI container ID.
+	AllocationIDContainer = "container"
+
+	// AllocationIDPod allocates addresses for each Pod.  This is for
+	// runtimes that change the container ID across restarts of the same
+	// sandbox of a Pod, so that the Pod keeps its addresses.
+	AllocationIDPod = "pod"
+)
+
+// ValidateAllocationIDKind returns an error if `kind` is unknown.
+func ValidateAllocationIDKind(kind string) error {
+	switch kind {
+	case AllocationIDContainer, AllocationIDPod:
+		return nil
+	}
+	return fmt.Errorf("unknown allocation ID kind: %s", kind)
+}
+
+// AllocationID returns the ID for which the addresses of a container are
+// allocated.  The returned ID is used in place of the container ID for the
+// pod network and NodeIPAM.
+//
+// For AllocationIDPod, the ID is composed of the namespace and the name of
+// the Pod.  Since neither of them contains underscores, the ID is unique.
+// If the Pod is not known, the container ID is returned.
+func AllocationID(kind, containerID, podNS, podName string) string {
+	if kind != AllocationIDPod || podNS == "" || podName == "" {
+		return containerID
+	}
+	return podNS + "_" + podName
+}
+
+// allocationID returns the ID for which the addresses of the container in `args` are allocated.
+func (s *coildServer) allocationID(args *cnirpc.CNIArgs) string {
+	return AllocationID(s.allocIDKind, args.ContainerId, args.Args[constants.PodNamespaceKey], args.Args[constants.PodNameKey])
+}
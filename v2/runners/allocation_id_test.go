@@ -0,0 +1,68 @@
+package runners
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+)
+
+func TestAllocationID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		kind    string
+		podNS   string
+		podName string
+		expect  string
+	}{
+		{AllocationIDContainer, "ns1", "pod1", "c1"},
+		{AllocationIDPod, "ns1", "pod1", "ns1_pod1"},
+		{AllocationIDPod, "ns1", "", "c1"},
+		{AllocationIDPod, "", "pod1", "c1"},
+	}
+	for _, tc := range testCases {
+		id := AllocationID(tc.kind, "c1", tc.podNS, tc.podName)
+		if id != tc.expect {
+			t.Errorf("%s %s/%s: expected %s, got %s", tc.kind, tc.podNS, tc.podName, tc.expect, id)
+		}
+	}
+
+	if err := ValidateAllocationIDKind(AllocationIDPod); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateAllocationIDKind("sandbox"); err == nil {
+		t.Error("unknown kind should be rejected")
+	}
+}
+
+func TestReplacedContainer(t *testing.T) {
+	t.Parallel()
+
+	s := &coildServer{allocIDKind: AllocationIDPod}
+	podArgs := map[string]string{
+		constants.PodNamespaceKey: "ns1",
+		constants.PodNameKey:      "pod1",
+	}
+	old := &cnirpc.CNIArgs{ContainerId: "c1", Ifname: "eth0", Args: podArgs}
+	current := &cnirpc.CNIArgs{ContainerId: "c2", Ifname: "eth0", Args: podArgs}
+
+	if s.replaced(old) {
+		t.Error("no container has been set up")
+	}
+	s.recordAdd(old, "ns1", "pod1")
+	if s.replaced(old) {
+		t.Error("the container is the latest one")
+	}
+
+	s.recordAdd(current, "ns1", "pod1")
+	if !s.replaced(old) {
+		t.Error("the container should have been replaced")
+	}
+	if s.replaced(current) {
+		t.Error("the container is the latest one")
+	}
+	if id := s.allocationID(current); id != s.allocationID(old) {
+		t.Error("containers of the same Pod should share the allocation ID:", id)
+	}
+}
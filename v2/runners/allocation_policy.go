@@ -0,0 +1,192 @@
+package runners
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// ErrAllocationDenied is returned by AllocationPolicy when the policy denies an allocation.
+var ErrAllocationDenied = errors.New("allocation denied by policy")
+
+var allocationReviewCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "allocation_reviews_total",
+		Help:      "the number of allocations reviewed by the external policy",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(allocationReviewCounter)
+}
+
+// AllocationReview is the input given to external allocation policies.
+type AllocationReview struct {
+	Pod        ReviewedPod       `json:"pod"`
+	Namespace  ReviewedNamespace `json:"namespace"`
+	Node       string            `json:"node"`
+	Pool       string            `json:"pool"`
+	ExtraPools []string          `json:"extraPools,omitempty"`
+}
+
+// ReviewedPod is the identity of the Pod in AllocationReview.
+type ReviewedPod struct {
+	Name               string            `json:"name"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty"`
+	ServiceAccountName string            `json:"serviceAccountName,omitempty"`
+}
+
+// ReviewedNamespace is the namespace of the Pod in AllocationReview.
+type ReviewedNamespace struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// AllocationDecision is the output of external allocation policies.
+type AllocationDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// AllocationPolicy lets an external policy engine veto allocations of coild.
+type AllocationPolicy interface {
+	// Review returns nil if the allocation is allowed.  If denied, the
+	// returned error wraps ErrAllocationDenied.  Other errors mean that
+	// the policy could not be evaluated.
+	Review(ctx context.Context, review *AllocationReview) error
+}
+
+// NewExecAllocationPolicy creates an AllocationPolicy that executes `command`
+// for each allocation.  The command reads AllocationReview as JSON from stdin,
+// and writes AllocationDecision as JSON to stdout.
+//
+// If failOpen is true, allocations are allowed when the command fails.
+func NewExecAllocationPolicy(command string, timeout time.Duration, failOpen bool, log logr.Logger) AllocationPolicy {
+	return &allocationPolicy{
+		evaluate: func(ctx context.Context, input []byte) ([]byte, error) {
+			cmd := exec.CommandContext(ctx, command)
+			cmd.Stdin = bytes.NewReader(input)
+			stderr := &bytes.Buffer{}
+			cmd.Stderr = stderr
+			out, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("%s failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+			}
+			return out, nil
+		},
+		timeout:  timeout,
+		failOpen: failOpen,
+		log:      log,
+	}
+}
+
+// NewHTTPAllocationPolicy creates an AllocationPolicy that queries `url` for
+// each allocation.  The request and the response follow the Data API of
+// Open Policy Agent; AllocationReview is posted as `input`, and
+// AllocationDecision is read from `result`.
+//
+// If failOpen is true, allocations are allowed when the query fails.
+func NewHTTPAllocationPolicy(url string, timeout time.Duration, failOpen bool, log logr.Logger) AllocationPolicy {
+	return &allocationPolicy{
+		evaluate: func(ctx context.Context, input []byte) ([]byte, error) {
+			body, err := json.Marshal(map[string]json.RawMessage{"input": input})
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+			}
+
+			var data struct {
+				Result json.RawMessage `json:"result"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+				return nil, fmt.Errorf("failed to decode the response of %s: %w", url, err)
+			}
+			// OPA omits the result if the policy is undefined.
+			if len(data.Result) == 0 {
+				return nil, fmt.Errorf("%s returned no result", url)
+			}
+			return data.Result, nil
+		},
+		timeout:  timeout,
+		failOpen: failOpen,
+		log:      log,
+	}
+}
+
+type allocationPolicy struct {
+	evaluate func(ctx context.Context, input []byte) ([]byte, error)
+	timeout  time.Duration
+	failOpen bool
+	log      logr.Logger
+}
+
+func (p *allocationPolicy) Review(ctx context.Context, review *AllocationReview) error {
+	err := p.review(ctx, review)
+	switch {
+	case err == nil:
+		allocationReviewCounter.WithLabelValues("allowed").Inc()
+	case errors.Is(err, ErrAllocationDenied):
+		allocationReviewCounter.WithLabelValues("denied").Inc()
+	default:
+		allocationReviewCounter.WithLabelValues("error").Inc()
+		if p.failOpen {
+			p.log.Error(err, "allowed allocation as the policy failed", "namespace", review.Namespace.Name, "pod", review.Pod.Name)
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *allocationPolicy) review(ctx context.Context, review *AllocationReview) error {
+	input, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	out, err := p.evaluate(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate allocation policy: %w", err)
+	}
+
+	decision := &AllocationDecision{}
+	if err := json.Unmarshal(out, decision); err != nil {
+		return fmt.Errorf("invalid decision of allocation policy: %w", err)
+	}
+	if !decision.Allowed {
+		if decision.Reason == "" {
+			return ErrAllocationDenied
+		}
+		return fmt.Errorf("%w: %s", ErrAllocationDenied, decision.Reason)
+	}
+	return nil
+}
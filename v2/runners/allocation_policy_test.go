@@ -0,0 +1,125 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestExecAllocationPolicy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "policy")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+if grep -q '"pool":"global"'; then
+  echo '{"allowed": false, "reason": "no routable IPs"}'
+else
+  echo '{"allowed": true}'
+fi
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken")
+	if err := os.WriteFile(broken, []byte("#!/bin/sh\necho oops >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	log := ctrl.Log.WithName("allocation-policy")
+	p := NewExecAllocationPolicy(script, time.Second, false, log)
+	review := &AllocationReview{Pod: ReviewedPod{Name: "pod1"}, Namespace: ReviewedNamespace{Name: "ns1"}, Pool: "default"}
+	if err := p.Review(ctx, review); err != nil {
+		t.Error("allocation should be allowed:", err)
+	}
+
+	review.Pool = "global"
+	err = p.Review(ctx, review)
+	if !errors.Is(err, ErrAllocationDenied) {
+		t.Fatal("allocation should be denied:", err)
+	}
+	if !strings.Contains(err.Error(), "no routable IPs") {
+		t.Error("the reason is missing:", err)
+	}
+
+	p = NewExecAllocationPolicy(broken, time.Second, false, log)
+	err = p.Review(ctx, review)
+	if err == nil || errors.Is(err, ErrAllocationDenied) {
+		t.Fatal("failure of the command should be an error:", err)
+	}
+	if !strings.Contains(err.Error(), "oops") {
+		t.Error("stderr is missing:", err)
+	}
+
+	p = NewExecAllocationPolicy(broken, time.Second, true, log)
+	if err := p.Review(ctx, review); err != nil {
+		t.Error("allocation should be allowed with fail-open:", err)
+	}
+}
+
+func TestHTTPAllocationPolicy(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input AllocationReview `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch body.Input.Namespace.Name {
+		case "undefined":
+			w.Write([]byte(`{}`))
+		case "denied":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": AllocationDecision{Allowed: false},
+			})
+		default:
+			allowed := body.Input.Namespace.Labels["routable"] == "true"
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": AllocationDecision{Allowed: allowed, Reason: "namespace is not routable"},
+			})
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	p := NewHTTPAllocationPolicy(ts.URL, time.Second, false, ctrl.Log.WithName("allocation-policy"))
+	review := &AllocationReview{
+		Pod:       ReviewedPod{Name: "pod1"},
+		Namespace: ReviewedNamespace{Name: "ns1", Labels: map[string]string{"routable": "true"}},
+		Pool:      "global",
+	}
+	if err := p.Review(ctx, review); err != nil {
+		t.Error("allocation should be allowed:", err)
+	}
+
+	review.Namespace.Labels = nil
+	err := p.Review(ctx, review)
+	if !errors.Is(err, ErrAllocationDenied) || !strings.Contains(err.Error(), "namespace is not routable") {
+		t.Error("allocation should be denied with the reason:", err)
+	}
+
+	review.Namespace.Name = "denied"
+	if err := p.Review(ctx, review); err != ErrAllocationDenied {
+		t.Error("allocation should be denied without reason:", err)
+	}
+
+	review.Namespace.Name = "undefined"
+	err = p.Review(ctx, review)
+	if err == nil || errors.Is(err, ErrAllocationDenied) {
+		t.Error("undefined result should be an error:", err)
+	}
+}
@@ -0,0 +1,84 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var unsupportedAPIRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "unsupported_api_requests_total",
+		Help:      "the number of requests rejected due to unsupported API versions",
+	},
+	[]string{"api_version"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(unsupportedAPIRequests)
+}
+
+// newAPIVersionInterceptor returns an interceptor that rejects requests of
+// unsupported API versions.  Requests without the version are treated as
+// API version 1.
+//
+// The Coil version sent by the CNI plugin is recorded by `versions` if it is
+// not nil.  Incompatible plugin versions are logged but not rejected as long
+// as the API version is supported.
+func newAPIVersionInterceptor(versions VersionPublisher) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		version := 1
+		var clientVersion string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vals := md.Get(cnirpc.APIVersionKey); len(vals) > 0 {
+				v, err := strconv.Atoi(vals[0])
+				if err != nil {
+					unsupportedAPIRequests.WithLabelValues(vals[0]).Inc()
+					return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INCOMPATIBLE_CNI_VERSION,
+						"invalid API version", vals[0])
+				}
+				version = v
+			}
+			if vals := md.Get(cnirpc.VersionKey); len(vals) > 0 {
+				clientVersion = vals[0]
+			}
+		}
+
+		if version < cnirpc.MinAPIVersion || version > cnirpc.APIVersion {
+			unsupportedAPIRequests.WithLabelValues(strconv.Itoa(version)).Inc()
+			ctxzap.Extract(ctx).Warn("rejected a request of unsupported API version",
+				zap.Int("api_version", version),
+				zap.String("client_version", clientVersion),
+			)
+			return nil, newError(codes.FailedPrecondition, cnirpc.ErrorCode_INCOMPATIBLE_CNI_VERSION,
+				"unsupported API version",
+				fmt.Sprintf("requested %d, supported %d to %d", version, cnirpc.MinAPIVersion, cnirpc.APIVersion))
+		}
+
+		if clientVersion != "" {
+			if !v2.IsCompatible(clientVersion) {
+				ctxzap.Extract(ctx).Warn("client version is incompatible with coild",
+					zap.String("client_version", clientVersion),
+					zap.String("coild_version", v2.Version()),
+				)
+			}
+			if versions != nil {
+				versions.SetCNIVersion(clientVersion)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
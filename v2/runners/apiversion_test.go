@@ -0,0 +1,80 @@
+package runners
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIVersionInterceptor(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	testCases := []struct {
+		name string
+		md   metadata.MD
+		code codes.Code
+	}{
+		{"no metadata", nil, codes.OK},
+		{"no version", metadata.Pairs("foo", "bar"), codes.OK},
+		{"current", metadata.Pairs(cnirpc.APIVersionKey, "1"), codes.OK},
+		{"too old", metadata.Pairs(cnirpc.APIVersionKey, "0"), codes.FailedPrecondition},
+		{"too new", metadata.Pairs(cnirpc.APIVersionKey, "100"), codes.FailedPrecondition},
+		{"invalid", metadata.Pairs(cnirpc.APIVersionKey, "v1"), codes.InvalidArgument},
+		{"incompatible client", metadata.Pairs(cnirpc.APIVersionKey, "1", cnirpc.VersionKey, "1.0.0"), codes.OK},
+	}
+
+	for _, tc := range testCases {
+		ctx := context.Background()
+		if tc.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, tc.md)
+		}
+		_, err := newAPIVersionInterceptor(nil)(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("%s: unexpected code %v: %v", tc.name, code, err)
+		}
+	}
+}
+
+type mockVersionPublisher struct {
+	VersionPublisher
+	cniVersion string
+}
+
+func (p *mockVersionPublisher) SetCNIVersion(v string) {
+	p.cniVersion = v
+}
+
+func TestAPIVersionInterceptorRecordsCNIVersion(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	p := &mockVersionPublisher{}
+	interceptor := newAPIVersionInterceptor(p)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(cnirpc.APIVersionKey, "100", cnirpc.VersionKey, "9.0.0"))
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); err == nil {
+		t.Fatal("unsupported API version should be rejected")
+	}
+	if p.cniVersion != "" {
+		t.Error("version of rejected client should not be recorded:", p.cniVersion)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(cnirpc.APIVersionKey, "1", cnirpc.VersionKey, "2.0.13"))
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if p.cniVersion != "2.0.13" {
+		t.Error("unexpected CNI version:", p.cniVersion)
+	}
+}
@@ -0,0 +1,164 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var reclaimableBlocks = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "reclaimable_blocks",
+		Help:      "the number of address blocks of dead nodes waiting for approval to be reclaimed",
+	},
+)
+
+func init() {
+	metrics.Registry.MustRegister(reclaimableBlocks)
+}
+
+// NewBlockReclaimer creates a manager.Runnable to reclaim address blocks
+// of dead nodes.
+//
+// A node is dead if coild on the node has not renewed its heartbeat Lease
+// in `namespace` longer than `deadAfter`.  Blocks of dead nodes are only
+// annotated as reclaimable.  They are deleted after operators approve it
+// by annotating the blocks, because a node that has lost its network may
+// still be running Pods with the addresses.
+func NewBlockReclaimer(mgr manager.Manager, namespace string, deadAfter, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &blockReclaimer{
+		Client:    mgr.GetClient(),
+		apiReader: mgr.GetAPIReader(),
+		namespace: namespace,
+		deadAfter: deadAfter,
+		interval:  interval,
+		log:       log,
+	}
+}
+
+type blockReclaimer struct {
+	client.Client
+	apiReader client.Reader
+	namespace string
+	deadAfter time.Duration
+	interval  time.Duration
+	log       logr.Logger
+}
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=list
+
+var _ manager.LeaderElectionRunnable = &blockReclaimer{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*blockReclaimer) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (r *blockReclaimer) Start(ctx context.Context) error {
+	tick := time.NewTicker(r.interval)
+	defer tick.Stop()
+
+	for {
+		// errors are not fatal because the next cycle will retry.
+		if err := r.do(ctx, time.Now()); err != nil {
+			r.log.Error(err, "failed to reclaim address blocks")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (r *blockReclaimer) do(ctx context.Context, now time.Time) error {
+	renewed, err := listHeartbeats(ctx, r.apiReader, r.namespace)
+	if err != nil {
+		return err
+	}
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.apiReader.List(ctx, blocks); err != nil {
+		return fmt.Errorf("failed to list address blocks: %w", err)
+	}
+
+	reclaimable := 0
+	for i := range blocks.Items {
+		b := &blocks.Items[i]
+		if b.DeletionTimestamp != nil {
+			continue
+		}
+		node := b.Labels[constants.LabelNode]
+		t, ok := renewed[node]
+		if !ok {
+			// Blocks of deleted nodes are collected by the garbage collector.
+			continue
+		}
+
+		_, flagged := b.Annotations[constants.AnnReclaimable]
+		if now.Sub(t) <= r.deadAfter {
+			if flagged {
+				if err := r.unflag(ctx, b); err != nil {
+					return err
+				}
+				r.log.Info("node has come back; unflagged a reclaimable block", "block", b.Name, "node", node)
+			}
+			continue
+		}
+
+		if !flagged {
+			if err := r.flag(ctx, b, t); err != nil {
+				return err
+			}
+			r.log.Info("flagged a block of a dead node as reclaimable", "block", b.Name, "node", node, "last_heartbeat", t)
+			reclaimable++
+			continue
+		}
+
+		if b.Annotations[constants.AnnReclaimApproved] != "true" {
+			reclaimable++
+			continue
+		}
+		if err := deleteBlock(ctx, r.Client, r.apiReader, b.Name); err != nil {
+			return fmt.Errorf("failed to delete block %s: %w", b.Name, err)
+		}
+		r.log.Info("reclaimed a block of a dead node", "block", b.Name, "node", node)
+	}
+	reclaimableBlocks.Set(float64(reclaimable))
+	return nil
+}
+
+func (r *blockReclaimer) flag(ctx context.Context, b *coilv2.AddressBlock, lastHeartbeat time.Time) error {
+	orig := b.DeepCopy()
+	if b.Annotations == nil {
+		b.Annotations = make(map[string]string)
+	}
+	b.Annotations[constants.AnnReclaimable] = lastHeartbeat.UTC().Format(time.RFC3339)
+	if err := r.Patch(ctx, b, client.MergeFrom(orig)); err != nil {
+		return fmt.Errorf("failed to annotate block %s: %w", b.Name, err)
+	}
+	return nil
+}
+
+func (r *blockReclaimer) unflag(ctx context.Context, b *coilv2.AddressBlock) error {
+	orig := b.DeepCopy()
+	delete(b.Annotations, constants.AnnReclaimable)
+	delete(b.Annotations, constants.AnnReclaimApproved)
+	if err := r.Patch(ctx, b, client.MergeFrom(orig)); err != nil {
+		return fmt.Errorf("failed to unannotate block %s: %w", b.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package runners
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testBlock(name, node string) *coilv2.AddressBlock {
+	b := &coilv2.AddressBlock{}
+	b.Name = name
+	b.Labels = map[string]string{
+		constants.LabelPool: "default",
+		constants.LabelNode: node,
+	}
+	b.Finalizers = []string{constants.FinCoil}
+	return b
+}
+
+func TestBlockReclaimer(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		testLease("alive", now.Add(-time.Minute)),
+		testLease("dead", now.Add(-2*time.Hour)),
+		testBlock("default-0", "alive"),
+		testBlock("default-1", "dead"),
+		testBlock("default-2", "dead"),
+		testBlock("default-3", "unknown"),
+	).Build()
+	r := &blockReclaimer{
+		Client:    cl,
+		apiReader: cl,
+		namespace: "kube-system",
+		deadAfter: time.Hour,
+		log:       ctrl.Log.WithName("block-reclaimer"),
+	}
+
+	ctx := context.Background()
+	getBlock := func(name string) *coilv2.AddressBlock {
+		b := &coilv2.AddressBlock{}
+		if err := cl.Get(ctx, client.ObjectKey{Name: name}, b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if err := r.do(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{"default-0": false, "default-1": true, "default-2": true, "default-3": false} {
+		if _, ok := getBlock(name).Annotations[constants.AnnReclaimable]; ok != expected {
+			t.Errorf("%s: reclaimable should be %v", name, expected)
+		}
+	}
+
+	// approve default-1 only
+	b := getBlock("default-1")
+	b.Annotations[constants.AnnReclaimApproved] = "true"
+	if err := cl.Update(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.do(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	err := cl.Get(ctx, client.ObjectKey{Name: "default-1"}, &coilv2.AddressBlock{})
+	if !apierrors.IsNotFound(err) {
+		t.Error("approved block should be deleted:", err)
+	}
+	getBlock("default-2")
+
+	// the dead node comes back
+	if err := r.do(ctx, now.Add(-90*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getBlock("default-2").Annotations[constants.AnnReclaimable]; ok {
+		t.Error("block of a revived node should be unflagged")
+	}
+}
@@ -0,0 +1,299 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var canaryChecks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "canary_checks_total",
+		Help:      "the number of canary checks of coild finished by result",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(canaryChecks)
+}
+
+// Reasons of events recorded for nodes.
+const (
+	EventCanaryPassed = "CanaryPassed"
+	EventCanaryFailed = "CanaryFailed"
+)
+
+const (
+	canaryComponent = "coil-canary"
+
+	// canaryProbePort is the TCP port of canary Pods to probe.
+	// Nothing listens on it, so the kernel of the Pod network namespace
+	// answers with RST if the Pod is reachable.
+	canaryProbePort = 9
+
+	canaryProbeTimeout = 3 * time.Second
+)
+
+// NewCanaryChecker creates a manager.Runnable to check the datapath of
+// a new version of coild on each node with a canary Pod.
+//
+// Every `interval`, it looks for nodes where a ready coild Pod in `namespace`
+// reports a version different from the one last checked on the node.
+// It then schedules a canary Pod of `image` to the node, and verifies that
+// the Pod is given an address and is reachable from this process over TCP.
+// The result is recorded in the annotations of the Node along with the
+// version of coild.  The check fails if it does not pass in `timeout`.
+func NewCanaryChecker(c client.Client, recorder record.EventRecorder, namespace, image string, interval, timeout time.Duration, log logr.Logger) manager.Runnable {
+	return &canaryChecker{
+		client:    c,
+		recorder:  recorder,
+		namespace: namespace,
+		image:     image,
+		interval:  interval,
+		timeout:   timeout,
+		log:       log,
+		probe:     probeCanary,
+	}
+}
+
+type canaryChecker struct {
+	client    client.Client
+	recorder  record.EventRecorder
+	namespace string
+	image     string
+	interval  time.Duration
+	timeout   time.Duration
+	log       logr.Logger
+	probe     func(ctx context.Context, ip string) error
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list;create;delete
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+var _ manager.LeaderElectionRunnable = &canaryChecker{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*canaryChecker) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (c *canaryChecker) Start(ctx context.Context) error {
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+
+	for {
+		if err := c.check(ctx, time.Now()); err != nil {
+			c.log.Error(err, "failed to run canary checks")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// probeCanary connects to `ip`.  A refused connection means the Pod is reachable.
+func probeCanary(ctx context.Context, ip string) error {
+	d := &net.Dialer{Timeout: canaryProbeTimeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(canaryProbePort)))
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return nil
+	}
+	return err
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (c *canaryChecker) check(ctx context.Context, now time.Time) error {
+	coilds := &corev1.PodList{}
+	err := c.client.List(ctx, coilds,
+		client.InNamespace(c.namespace),
+		client.MatchingLabels{constants.LabelAppComponent: "coild"},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list coild Pods: %w", err)
+	}
+	canaries := &corev1.PodList{}
+	err = c.client.List(ctx, canaries,
+		client.InNamespace(c.namespace),
+		client.MatchingLabels{constants.LabelAppComponent: canaryComponent},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list canary Pods: %w", err)
+	}
+
+	canaryOf := make(map[string]*corev1.Pod)
+	for i := range canaries.Items {
+		pod := &canaries.Items[i]
+		canaryOf[pod.Labels[constants.LabelNode]] = pod
+	}
+
+	for i := range coilds.Items {
+		pod := &coilds.Items[i]
+		node := pod.Spec.NodeName
+		version := pod.Annotations[constants.AnnVersion]
+		if node == "" || version == "" || !isPodReady(pod) {
+			continue
+		}
+
+		canary := canaryOf[node]
+		delete(canaryOf, node)
+		if err := c.checkNode(ctx, now, node, version, canary); err != nil {
+			c.log.Error(err, "failed to run canary check", "node", node, "version", version)
+		}
+	}
+
+	// canaries of nodes where coild is not ready are no longer needed.
+	for _, canary := range canaryOf {
+		if err := c.deleteCanary(ctx, canary); err != nil {
+			c.log.Error(err, "failed to delete canary Pod", "pod", canary.Name)
+		}
+	}
+	return nil
+}
+
+func (c *canaryChecker) checkNode(ctx context.Context, now time.Time, nodeName, version string, canary *corev1.Pod) error {
+	node := &corev1.Node{}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	switch {
+	case node.Annotations[constants.AnnCanaryVersion] == version:
+		if canary != nil {
+			return c.deleteCanary(ctx, canary)
+		}
+		return nil
+	case canary == nil:
+		return c.createCanary(ctx, nodeName, version)
+	case canary.Annotations[constants.AnnCanaryVersion] != version:
+		// coild was upgraded again during the check.
+		return c.deleteCanary(ctx, canary)
+	}
+
+	var probeErr error
+	if canary.Status.PodIP != "" {
+		probeErr = c.probe(ctx, canary.Status.PodIP)
+		if probeErr == nil {
+			return c.record(ctx, node, version, canary, nil)
+		}
+	}
+	if now.Sub(canary.CreationTimestamp.Time) < c.timeout {
+		return nil
+	}
+
+	if canary.Status.PodIP == "" {
+		return c.record(ctx, node, version, canary, fmt.Errorf("no address was allocated to the canary Pod in %s", c.timeout))
+	}
+	return c.record(ctx, node, version, canary, fmt.Errorf("the canary Pod %s is unreachable: %w", canary.Status.PodIP, probeErr))
+}
+
+func (c *canaryChecker) createCanary(ctx context.Context, nodeName, version string) error {
+	uid := int64(10000)
+	gracePeriod := int64(0)
+	automount := false
+	pod := &corev1.Pod{}
+	pod.Namespace = c.namespace
+	pod.GenerateName = canaryComponent + "-"
+	pod.Labels = map[string]string{
+		constants.LabelAppComponent: canaryComponent,
+		constants.LabelNode:         nodeName,
+	}
+	pod.Annotations = map[string]string{constants.AnnCanaryVersion: version}
+	pod.Spec = corev1.PodSpec{
+		NodeName:                      nodeName,
+		RestartPolicy:                 corev1.RestartPolicyNever,
+		Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		AutomountServiceAccountToken:  &automount,
+		TerminationGracePeriodSeconds: &gracePeriod,
+		SecurityContext: &corev1.PodSecurityContext{
+			RunAsUser:  &uid,
+			RunAsGroup: &uid,
+		},
+		Containers: []corev1.Container{{
+			Name:    "canary",
+			Image:   c.image,
+			Command: []string{"sleep", "infinity"},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1m"),
+					corev1.ResourceMemory: resource.MustParse("8Mi"),
+				},
+			},
+		}},
+	}
+	if err := c.client.Create(ctx, pod); err != nil {
+		return fmt.Errorf("failed to create canary Pod: %w", err)
+	}
+	c.log.Info("started canary check", "node", nodeName, "version", version, "pod", pod.Name)
+	return nil
+}
+
+func (c *canaryChecker) deleteCanary(ctx context.Context, canary *corev1.Pod) error {
+	if err := c.client.Delete(ctx, canary); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete canary Pod %s: %w", canary.Name, err)
+	}
+	return nil
+}
+
+// record records the result of the check in the annotations of `node`,
+// and deletes the canary Pod.  `checkErr` is nil if the check passed.
+func (c *canaryChecker) record(ctx context.Context, node *corev1.Node, version string, canary *corev1.Pod, checkErr error) error {
+	result := constants.CanaryPassed
+	if checkErr != nil {
+		result = constants.CanaryFailed
+	}
+
+	orig := node.DeepCopy()
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	node.Annotations[constants.AnnCanaryVersion] = version
+	node.Annotations[constants.AnnCanaryResult] = result
+	if err := c.client.Patch(ctx, node, client.MergeFrom(orig)); err != nil {
+		return fmt.Errorf("failed to record the result of canary check: %w", err)
+	}
+	canaryChecks.WithLabelValues(result).Inc()
+
+	if checkErr != nil {
+		c.log.Info("canary check failed", "node", node.Name, "version", version, "error", checkErr.Error())
+		c.recorder.Eventf(node, corev1.EventTypeWarning, EventCanaryFailed, "canary check of coild %s failed: %v", version, checkErr)
+	} else {
+		c.log.Info("canary check passed", "node", node.Name, "version", version, "address", canary.Status.PodIP)
+		c.recorder.Eventf(node, corev1.EventTypeNormal, EventCanaryPassed, "canary check of coild %s passed with %s", version, canary.Status.PodIP)
+	}
+	return c.deleteCanary(ctx, canary)
+}
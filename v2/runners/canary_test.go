@@ -0,0 +1,186 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testCoildPod(node, version string, ready bool) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Namespace = "kube-system"
+	pod.Name = "coild-" + node
+	pod.Labels = map[string]string{constants.LabelAppComponent: "coild"}
+	pod.Annotations = map[string]string{constants.AnnVersion: version}
+	pod.Spec.NodeName = node
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	return pod
+}
+
+func TestCanaryChecker(t *testing.T) {
+	t.Parallel()
+
+	var nodes []client.Object
+	for _, name := range []string{"node1", "node2", "node3"} {
+		n := &corev1.Node{}
+		n.Name = name
+		nodes = append(nodes, n)
+	}
+	nodes[1].SetAnnotations(map[string]string{
+		constants.AnnCanaryVersion: "2.1.0",
+		constants.AnnCanaryResult:  constants.CanaryPassed,
+	})
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(nodes...).WithObjects(
+		testCoildPod("node1", "2.1.0", true),
+		testCoildPod("node2", "2.1.0", true),
+		testCoildPod("node3", "2.1.0", false),
+	).Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	c := NewCanaryChecker(cl, recorder, "kube-system", "coil:dev", time.Minute, 5*time.Minute, ctrl.Log.WithName("canary")).(*canaryChecker)
+	var probed []string
+	c.probe = func(_ context.Context, ip string) error {
+		probed = append(probed, ip)
+		if ip == "10.0.0.2" {
+			return errors.New("i/o timeout")
+		}
+		return nil
+	}
+
+	getCanary := func() *corev1.Pod {
+		t.Helper()
+		pods := &corev1.PodList{}
+		if err := cl.List(ctx, pods, client.MatchingLabels{constants.LabelAppComponent: canaryComponent}); err != nil {
+			t.Fatal(err)
+		}
+		switch len(pods.Items) {
+		case 0:
+			return nil
+		case 1:
+			return &pods.Items[0]
+		}
+		t.Fatal("too many canary Pods:", len(pods.Items))
+		return nil
+	}
+	getNodeAnnotations := func(name string) map[string]string {
+		t.Helper()
+		n := &corev1.Node{}
+		if err := cl.Get(ctx, client.ObjectKey{Name: name}, n); err != nil {
+			t.Fatal(err)
+		}
+		return n.Annotations
+	}
+	setPodIP := func(pod *corev1.Pod, ip string) {
+		t.Helper()
+		pod.Status.PodIP = ip
+		if err := cl.Status().Update(ctx, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only node1 needs a canary.
+	now := time.Now()
+	if err := c.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	canary := getCanary()
+	if canary == nil {
+		t.Fatal("canary Pod should be created")
+	}
+	if canary.Spec.NodeName != "node1" || canary.Labels[constants.LabelNode] != "node1" {
+		t.Error("canary Pod should be scheduled to node1:", canary.Spec.NodeName)
+	}
+	if canary.Annotations[constants.AnnCanaryVersion] != "2.1.0" {
+		t.Error("unexpected canary version:", canary.Annotations)
+	}
+	if canary.Spec.Containers[0].Image != "coil:dev" {
+		t.Error("unexpected image:", canary.Spec.Containers[0].Image)
+	}
+
+	// waiting for an address.
+	now = canary.CreationTimestamp.Time
+	if err := c.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if getCanary() == nil || len(probed) != 0 {
+		t.Error("canary Pod without address should be kept")
+	}
+
+	setPodIP(canary, "10.0.0.1")
+	if err := c.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if getCanary() != nil {
+		t.Error("canary Pod should be deleted after the check")
+	}
+	anns := getNodeAnnotations("node1")
+	if anns[constants.AnnCanaryVersion] != "2.1.0" || anns[constants.AnnCanaryResult] != constants.CanaryPassed {
+		t.Error("unexpected annotations:", anns)
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, EventCanaryPassed) || !strings.Contains(ev, "10.0.0.1") {
+		t.Error("unexpected event:", ev)
+	}
+
+	// nothing to do until coild is upgraded.
+	if err := c.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if getCanary() != nil {
+		t.Error("canary Pod should not be created for checked versions")
+	}
+
+	// an unreachable canary fails after the timeout.
+	if err := cl.Delete(ctx, testCoildPod("node1", "2.1.0", true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Create(ctx, testCoildPod("node1", "2.2.0", true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	canary = getCanary()
+	if canary == nil {
+		t.Fatal("canary Pod should be created for the new version")
+	}
+	setPodIP(canary, "10.0.0.2")
+	created := canary.CreationTimestamp.Time
+	if err := c.check(ctx, created.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if getCanary() == nil {
+		t.Error("unreachable canary Pod should be retried until the timeout")
+	}
+	if err := c.check(ctx, created.Add(6*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if getCanary() != nil {
+		t.Error("canary Pod should be deleted after the check")
+	}
+	anns = getNodeAnnotations("node1")
+	if anns[constants.AnnCanaryVersion] != "2.2.0" || anns[constants.AnnCanaryResult] != constants.CanaryFailed {
+		t.Error("unexpected annotations:", anns)
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, EventCanaryFailed) || !strings.Contains(ev, "unreachable") {
+		t.Error("unexpected event:", ev)
+	}
+	if v := testutil.ToFloat64(canaryChecks.WithLabelValues(constants.CanaryFailed)); v != 1 {
+		t.Error("failed checks should be counted:", v)
+	}
+}
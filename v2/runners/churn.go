@@ -0,0 +1,226 @@
+package runners
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// ChurnRetention is the longest window of ChurnReport.
+	ChurnRetention = time.Hour
+
+	churnSlotDuration  = time.Minute
+	defaultChurnWindow = 5 * time.Minute
+	defaultChurnTop    = 10
+)
+
+var (
+	churnAllocations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "coild",
+			Name:      "namespace_allocations_total",
+			Help:      "the number of Pods in each namespace whose addresses were allocated",
+		},
+		[]string{"namespace"},
+	)
+
+	churnFrees = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "coild",
+			Name:      "namespace_frees_total",
+			Help:      "the number of Pods in each namespace whose addresses were freed",
+		},
+		[]string{"namespace"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(churnAllocations, churnFrees)
+}
+
+// ChurnEntry is the churn of a namespace in ChurnReport.
+type ChurnEntry struct {
+	Namespace   string `json:"namespace"`
+	Allocations int    `json:"allocations"`
+	Frees       int    `json:"frees"`
+}
+
+// ChurnReport is the response of ChurnTracker.
+type ChurnReport struct {
+	Node       string       `json:"node"`
+	Window     string       `json:"window"`
+	Namespaces []ChurnEntry `json:"namespaces"`
+}
+
+// ChurnTracker records allocations and frees of addresses per namespace
+// to tell which workloads drive the churn of IPAM.
+//
+// As an http.Handler, it serves ChurnReport of the namespaces with the
+// most allocations and frees in a sliding window up to ChurnRetention.
+// The window and the number of namespaces are given by the query
+// parameters `window` and `top`.
+type ChurnTracker interface {
+	http.Handler
+
+	// Allocated records that the addresses of a container in `namespace` are allocated.
+	Allocated(containerID, namespace string)
+
+	// Freed records that the addresses of a container are freed.
+	// Containers not recorded by Allocated are ignored.
+	Freed(containerID string)
+}
+
+// NewChurnTracker creates a ChurnTracker.
+func NewChurnTracker(nodeName string) ChurnTracker {
+	return &churnTracker{
+		nodeName:   nodeName,
+		containers: make(map[string]string),
+		now:        time.Now,
+	}
+}
+
+type churnCount struct {
+	allocations int
+	frees       int
+}
+
+type churnSlot struct {
+	start  time.Time
+	counts map[string]*churnCount
+}
+
+type churnTracker struct {
+	nodeName string
+	now      func() time.Time
+
+	mu         sync.Mutex
+	containers map[string]string
+	slots      []*churnSlot
+}
+
+func (t *churnTracker) Allocated(containerID, namespace string) {
+	churnAllocations.WithLabelValues(namespace).Inc()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.containers[containerID] = namespace
+	t.count(namespace).allocations++
+}
+
+func (t *churnTracker) Freed(containerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	namespace, ok := t.containers[containerID]
+	if !ok {
+		return
+	}
+	delete(t.containers, containerID)
+	t.count(namespace).frees++
+	churnFrees.WithLabelValues(namespace).Inc()
+}
+
+// count returns the counter of `namespace` in the current slot.
+// The caller must hold the lock.
+func (t *churnTracker) count(namespace string) *churnCount {
+	now := t.now().Truncate(churnSlotDuration)
+	if len(t.slots) == 0 || !t.slots[len(t.slots)-1].start.Equal(now) {
+		t.slots = append(t.slots, &churnSlot{start: now, counts: make(map[string]*churnCount)})
+	}
+
+	// drop slots older than the retention.
+	for len(t.slots) > 0 && now.Sub(t.slots[0].start) >= ChurnRetention {
+		t.slots = t.slots[1:]
+	}
+
+	b := t.slots[len(t.slots)-1]
+	c, ok := b.counts[namespace]
+	if !ok {
+		c = &churnCount{}
+		b.counts[namespace] = c
+	}
+	return c
+}
+
+func (t *churnTracker) report(window time.Duration, top int) *ChurnReport {
+	since := t.now().Add(-window)
+
+	sums := make(map[string]*churnCount)
+	t.mu.Lock()
+	for _, b := range t.slots {
+		// include the slot if any part of it is in the window.
+		if b.start.Add(churnSlotDuration).Before(since) {
+			continue
+		}
+		for ns, c := range b.counts {
+			sum, ok := sums[ns]
+			if !ok {
+				sum = &churnCount{}
+				sums[ns] = sum
+			}
+			sum.allocations += c.allocations
+			sum.frees += c.frees
+		}
+	}
+	t.mu.Unlock()
+
+	entries := make([]ChurnEntry, 0, len(sums))
+	for ns, c := range sums {
+		entries = append(entries, ChurnEntry{Namespace: ns, Allocations: c.allocations, Frees: c.frees})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		ci := entries[i].Allocations + entries[i].Frees
+		cj := entries[j].Allocations + entries[j].Frees
+		if ci != cj {
+			return ci > cj
+		}
+		return entries[i].Namespace < entries[j].Namespace
+	})
+	if len(entries) > top {
+		entries = entries[:top]
+	}
+
+	return &ChurnReport{
+		Node:       t.nodeName,
+		Window:     window.String(),
+		Namespaces: entries,
+	}
+}
+
+func (t *churnTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := defaultChurnWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > ChurnRetention {
+			http.Error(w, "window must be a positive duration up to "+ChurnRetention.String(), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	top := defaultChurnTop
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "top must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.report(window, top))
+}
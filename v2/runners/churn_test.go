@@ -0,0 +1,88 @@
+package runners
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChurnTracker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, 1, 1, 0, 0, 30, 0, time.UTC)
+	tr := NewChurnTracker("node1").(*churnTracker)
+	tr.now = func() time.Time { return now }
+
+	tr.Allocated("c1", "ns1")
+	tr.Allocated("c2", "ns1")
+	tr.Allocated("c3", "ns2")
+	tr.Freed("c1")
+	tr.Freed("c1")      // freed twice
+	tr.Freed("unknown") // not allocated
+
+	now = now.Add(10 * time.Minute)
+	tr.Allocated("c4", "ns3")
+	tr.Freed("c3")
+
+	report := tr.report(5*time.Minute, 10)
+	expected := []ChurnEntry{
+		{Namespace: "ns2", Frees: 1},
+		{Namespace: "ns3", Allocations: 1},
+	}
+	if !reflect.DeepEqual(report.Namespaces, expected) {
+		t.Error("unexpected churn in 5m:", report.Namespaces)
+	}
+
+	report = tr.report(time.Hour, 10)
+	expected = []ChurnEntry{
+		{Namespace: "ns1", Allocations: 2, Frees: 1},
+		{Namespace: "ns2", Allocations: 1, Frees: 1},
+		{Namespace: "ns3", Allocations: 1},
+	}
+	if !reflect.DeepEqual(report.Namespaces, expected) {
+		t.Error("unexpected churn in 1h:", report.Namespaces)
+	}
+
+	report = tr.report(time.Hour, 1)
+	if len(report.Namespaces) != 1 || report.Namespaces[0].Namespace != "ns1" {
+		t.Error("unexpected top 1:", report.Namespaces)
+	}
+
+	// the first slot expires.
+	now = now.Add(55 * time.Minute)
+	tr.Allocated("c5", "ns3")
+	if len(tr.slots) != 2 {
+		t.Error("old slots should be dropped:", len(tr.slots))
+	}
+
+	w := httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status/churn?window=1h&top=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal("unexpected status:", w.Code)
+	}
+	resp := &ChurnReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node != "node1" || resp.Window != "1h0m0s" {
+		t.Error("unexpected report:", resp)
+	}
+	expected = []ChurnEntry{
+		{Namespace: "ns3", Allocations: 2},
+		{Namespace: "ns2", Frees: 1},
+	}
+	if !reflect.DeepEqual(resp.Namespaces, expected) {
+		t.Error("unexpected churn:", resp.Namespaces)
+	}
+
+	for _, q := range []string{"window=2h", "window=foo", "top=0"} {
+		w := httptest.NewRecorder()
+		tr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status/churn?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Error("invalid query should be rejected:", q, w.Code)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package runners
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"google.golang.org/grpc/codes"
+)
+
+// maxRequestSize is the maximum size of a request message to coild.
+const maxRequestSize = 1 << 20
+
+// maxContainerIDLength is the maximum length of a container ID.
+const maxContainerIDLength = 256
+
+// validContainerID matches the characters allowed in container IDs by the CNI spec.
+var validContainerID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-]*$`)
+
+var knownArgs = map[string]bool{
+	constants.PodNamespaceKey: true,
+	constants.PodNameKey:      true,
+	constants.PodContainerKey: true,
+}
+
+// validateArgs validates CNIArgs strictly.
+// If `needNetns` is true, Netns must be specified.
+//
+// The returned error is a gRPC status error with codes.InvalidArgument.
+func validateArgs(args *cnirpc.CNIArgs, needNetns bool) error {
+	if err := checkArgs(args, needNetns); err != nil {
+		return newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES,
+			"invalid arguments", err.Error())
+	}
+
+	if len(args.StdinData) > 0 {
+		var conf map[string]interface{}
+		if err := json.Unmarshal(args.StdinData, &conf); err != nil {
+			return newError(codes.InvalidArgument, cnirpc.ErrorCode_DECODING_FAILURE,
+				"invalid network configuration", err.Error())
+		}
+	}
+	return nil
+}
+
+func checkArgs(args *cnirpc.CNIArgs, needNetns bool) error {
+	if args.ContainerId == "" {
+		return errors.New("missing container ID")
+	}
+	if len(args.ContainerId) > maxContainerIDLength {
+		return fmt.Errorf("too long container ID: %d", len(args.ContainerId))
+	}
+	if !validContainerID.MatchString(args.ContainerId) {
+		return fmt.Errorf("invalid container ID: %q", args.ContainerId)
+	}
+
+	if err := checkIfname(args.Ifname); err != nil {
+		return err
+	}
+
+	switch {
+	case args.Netns == "" && needNetns:
+		return errors.New("missing network namespace")
+	case args.Netns != "" && !filepath.IsAbs(args.Netns):
+		return fmt.Errorf("network namespace must be an absolute path: %q", args.Netns)
+	}
+
+	for k, v := range args.Args {
+		if !knownArgs[k] {
+			return fmt.Errorf("unknown argument: %q", k)
+		}
+		// Pod names and namespaces compose allocation IDs.
+		if (k == constants.PodNamespaceKey || k == constants.PodNameKey) && strings.ContainsAny(v, "/:_ \t\n") {
+			return fmt.Errorf("invalid %s: %q", k, v)
+		}
+	}
+	return nil
+}
+
+// checkIfname checks the interface name in the same way as the Linux kernel.
+func checkIfname(name string) error {
+	switch {
+	case name == "":
+		return errors.New("missing interface name")
+	case len(name) > 15:
+		return fmt.Errorf("too long interface name: %q", name)
+	case name == "." || name == "..":
+		return fmt.Errorf("invalid interface name: %q", name)
+	case strings.ContainsAny(name, "/: \t\n"):
+		return fmt.Errorf("invalid interface name: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package runners
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateArgs(t *testing.T) {
+	t.Parallel()
+
+	valid := func() *cnirpc.CNIArgs {
+		return &cnirpc.CNIArgs{
+			ContainerId: "c8f4a9c50c85b36eff718aab2ac39209",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/foo",
+			Args:        map[string]string{"K8S_POD_NAME": "foo", "K8S_POD_NAMESPACE": "ns1"},
+			StdinData:   []byte(`{"cniVersion": "0.4.0", "name": "k8s", "type": "coil"}`),
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		modify    func(args *cnirpc.CNIArgs)
+		needNetns bool
+		cniCode   cnirpc.ErrorCode
+	}{
+		{"valid", func(args *cnirpc.CNIArgs) {}, true, -1},
+		{"no netns for DEL", func(args *cnirpc.CNIArgs) { args.Netns = "" }, false, -1},
+		{"no stdin", func(args *cnirpc.CNIArgs) { args.StdinData = nil }, true, -1},
+		{"no container ID", func(args *cnirpc.CNIArgs) { args.ContainerId = "" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"long container ID", func(args *cnirpc.CNIArgs) { args.ContainerId = strings.Repeat("a", 257) }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"bad container ID", func(args *cnirpc.CNIArgs) { args.ContainerId = "../etc" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"no ifname", func(args *cnirpc.CNIArgs) { args.Ifname = "" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"long ifname", func(args *cnirpc.CNIArgs) { args.Ifname = "eth0123456789012" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"bad ifname", func(args *cnirpc.CNIArgs) { args.Ifname = "eth/0" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"no netns", func(args *cnirpc.CNIArgs) { args.Netns = "" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"relative netns", func(args *cnirpc.CNIArgs) { args.Netns = "netns/foo" }, false, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"unknown args", func(args *cnirpc.CNIArgs) { args.Args["FOO"] = "bar" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"bad pod name", func(args *cnirpc.CNIArgs) { args.Args["K8S_POD_NAME"] = "foo:bar" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"bad pod namespace", func(args *cnirpc.CNIArgs) { args.Args["K8S_POD_NAMESPACE"] = "ns_1" }, true, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES},
+		{"bad stdin", func(args *cnirpc.CNIArgs) { args.StdinData = []byte(`{"cniVersion": `) }, true, cnirpc.ErrorCode_DECODING_FAILURE},
+		{"non-object stdin", func(args *cnirpc.CNIArgs) { args.StdinData = []byte(`[1, 2]`) }, true, cnirpc.ErrorCode_DECODING_FAILURE},
+	}
+
+	for _, tc := range testCases {
+		args := valid()
+		tc.modify(args)
+		err := validateArgs(args, tc.needNetns)
+		if tc.cniCode < 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+
+		st := status.Convert(err)
+		if st.Code() != codes.InvalidArgument {
+			t.Errorf("%s: unexpected code: %v", tc.name, err)
+			continue
+		}
+		details := st.Details()
+		if len(details) != 1 {
+			t.Errorf("%s: no details: %v", tc.name, err)
+			continue
+		}
+		if cniErr := details[0].(*cnirpc.CNIError); cniErr.Code != tc.cniCode {
+			t.Errorf("%s: unexpected CNI error code: %v", tc.name, cniErr.Code)
+		}
+	}
+}
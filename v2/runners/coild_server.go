@@ -6,16 +6,23 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ns"
+	v2 "github.com/cybozu-go/coil/v2"
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
 	"github.com/cybozu-go/coil/v2/pkg/founat"
 	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/loglevel"
 	"github.com/cybozu-go/coil/v2/pkg/nodenet"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
@@ -30,11 +37,16 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+// rollbackTimeout is the timeout to undo a partially completed Add.
+const rollbackTimeout = 30 * time.Second
+
 // GWNets represents networks for a destination.
 type GWNets struct {
 	Gateway  net.IP
@@ -87,22 +99,94 @@ func (n natSetup) Hook(l []GWNets, log *zap.Logger) func(ipv4, ipv6 net.IP) erro
 	}
 }
 
+// CoildServer is the gRPC server of coild.
+type CoildServer interface {
+	manager.Runnable
+
+	// SweepNamespace frees the addresses that remain for Pods in a deleted
+	// namespace, and returns the number of freed interfaces and holds.
+	SweepNamespace(ctx context.Context, namespace string) (int, error)
+}
+
+// CoildServerOptions is a set of optional features of CoildServer.
+//
+// The zero values disable the features.
+type CoildServerOptions struct {
+	// Verifier requires requests to have a bearer token accepted by it.
+	Verifier TokenVerifier
+
+	// Versions records the version of the CNI plugin.
+	Versions VersionPublisher
+
+	// ReadOnly can be switched with SetReadOnly RPC.
+	ReadOnly ReadOnlyMode
+
+	// Prober probes Pod networks after Add succeeds.
+	Prober NetworkProber
+
+	// Policy refuses Add unless it allows the allocation.
+	Policy AllocationPolicy
+
+	// Churn records allocations and frees.
+	Churn ChurnTracker
+
+	// Config gives the default pool.  If nil, constants.DefaultPool is used.
+	Config *coilconfig.Store
+
+	// PodRoutes are routed via the node in Pod networks in addition to
+	// the routes of the pools.
+	PodRoutes []*net.IPNet
+
+	// AllocationIDKind is the kind of the IDs for which addresses are
+	// allocated; see AllocationID.  If empty, AllocationIDContainer is used.
+	AllocationIDKind string
+
+	// LogLevel can be changed with SetLogLevel RPC.
+	LogLevel *zap.AtomicLevel
+
+	// Status reports the blocks of the node for NodeStatus RPC.
+	Status NodeStatusReporter
+
+	// AddDedupWindow is the period to give retried Add requests for the same
+	// container the result of the request in flight or completed within it.
+	AddDedupWindow time.Duration
+}
+
 // NewCoildServer returns an implementation of cnirpc.CNIServer for coild.
-func NewCoildServer(l net.Listener, mgr manager.Manager, nodeIPAM ipam.NodeIPAM, podNet nodenet.PodNetwork, setup NATSetup, logger *zap.Logger) manager.Runnable {
-	return &coildServer{
-		listener:  l,
-		apiReader: mgr.GetAPIReader(),
-		client:    mgr.GetClient(),
-		nodeIPAM:  nodeIPAM,
-		podNet:    podNet,
-		natSetup:  setup,
-		logger:    logger,
+func NewCoildServer(l net.Listener, mgr manager.Manager, nodeIPAM ipam.NodeIPAM, podNet nodenet.PodNetwork, setup NATSetup, opts CoildServerOptions, logger *zap.Logger) CoildServer {
+	s := &coildServer{
+		listener:    l,
+		apiReader:   mgr.GetAPIReader(),
+		client:      mgr.GetClient(),
+		nodeIPAM:    nodeIPAM,
+		podNet:      podNet,
+		natSetup:    setup,
+		verifier:    opts.Verifier,
+		versions:    opts.Versions,
+		readOnly:    opts.ReadOnly,
+		prober:      opts.Prober,
+		policy:      opts.Policy,
+		churn:       opts.Churn,
+		config:      opts.Config,
+		podRoutes:   opts.PodRoutes,
+		allocIDKind: opts.AllocationIDKind,
+		logLevel:    opts.LogLevel,
+		status:      opts.Status,
+		logger:      logger,
+		errors:      &nodeErrors{},
+		holds:       make(map[string]*heldAddresses),
+		pending:     make(map[string]*pendingHold),
+	}
+	if opts.AddDedupWindow > 0 {
+		s.addDedup = newAddDedup(opts.AddDedupWindow)
 	}
+	return s
 }
 
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get
 // +kubebuilder:rbac:groups="",resources=namespaces;services,verbs=get;list;watch
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=egresses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
 
 var grpcMetrics = grpc_prometheus.NewServerMetrics()
 
@@ -113,13 +197,37 @@ func init() {
 
 type coildServer struct {
 	cnirpc.UnimplementedCNIServer
-	listener  net.Listener
-	apiReader client.Reader
-	client    client.Client
-	nodeIPAM  ipam.NodeIPAM
-	podNet    nodenet.PodNetwork
-	natSetup  NATSetup
-	logger    *zap.Logger
+	listener    net.Listener
+	apiReader   client.Reader
+	client      client.Client
+	nodeIPAM    ipam.NodeIPAM
+	podNet      nodenet.PodNetwork
+	natSetup    NATSetup
+	verifier    TokenVerifier
+	versions    VersionPublisher
+	readOnly    ReadOnlyMode
+	prober      NetworkProber
+	policy      AllocationPolicy
+	churn       ChurnTracker
+	config      *coilconfig.Store
+	podRoutes   []*net.IPNet
+	allocIDKind string
+	logLevel    *zap.AtomicLevel
+	status      NodeStatusReporter
+	addDedup    *addDedup
+	logger      *zap.Logger
+
+	// errors keeps the last errors of RPCs for NodeStatus.
+	errors *nodeErrors
+
+	// addRecords maps Pods to their containers set up by Add for ForceFree.
+	addRecords sync.Map
+
+	// holds maps Pods to the addresses held for them by Hold.
+	// pending maps Pods to Hold requests allocating addresses for them.
+	holdsMu sync.Mutex
+	holds   map[string]*heldAddresses
+	pending map[string]*pendingHold
 }
 
 var _ manager.LeaderElectionRunnable = &coildServer{}
@@ -148,13 +256,26 @@ func fieldExtractor(fullMethod string, req interface{}) map[string]interface{} {
 }
 
 func (s *coildServer) Start(ctx context.Context) error {
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(
-		grpc_middleware.ChainUnaryServer(
-			grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(fieldExtractor)),
-			grpcMetrics.UnaryServerInterceptor(),
-			grpc_zap.UnaryServerInterceptor(s.logger),
-		),
-	))
+	interceptors := []grpc.UnaryServerInterceptor{
+		grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(fieldExtractor)),
+		grpcMetrics.UnaryServerInterceptor(),
+		grpc_zap.UnaryServerInterceptor(s.logger),
+		nodeErrorsInterceptor(s.errors),
+		newAPIVersionInterceptor(s.versions),
+	}
+	if s.verifier != nil {
+		interceptors = append(interceptors, tokenAuthInterceptor(s.verifier))
+	}
+	if s.readOnly != nil {
+		interceptors = append(interceptors, readOnlyInterceptor(s.readOnly))
+	}
+	if s.addDedup != nil {
+		interceptors = append(interceptors, addDedupInterceptor(s.addDedup))
+	}
+	grpcServer := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxRequestSize),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(interceptors...)),
+	)
 	cnirpc.RegisterCNIServer(grpcServer, s)
 
 	// after all services are registered, initialize metrics.
@@ -186,9 +307,20 @@ func newInternalError(err error, msg string) error {
 	return newError(codes.Internal, cnirpc.ErrorCode_INTERNAL, msg, err.Error())
 }
 
+// newDeadlineError returns an error for requests whose deadline has been exceeded.
+// The CNI plugin can retry them later.
+func newDeadlineError(err error, msg string) error {
+	return newError(codes.DeadlineExceeded, cnirpc.ErrorCode_TRY_AGAIN_LATER, msg, err.Error())
+}
+
 func (s *coildServer) Add(ctx context.Context, args *cnirpc.CNIArgs) (*cnirpc.AddResponse, error) {
 	logger := ctxzap.Extract(ctx)
 
+	if err := validateArgs(args, true); err != nil {
+		logger.Sugar().Errorw("invalid arguments", "error", err)
+		return nil, err
+	}
+
 	podName := args.Args[constants.PodNameKey]
 	podNS := args.Args[constants.PodNamespaceKey]
 	if podName == "" || podNS == "" {
@@ -214,19 +346,77 @@ func (s *coildServer) Add(ctx context.Context, args *cnirpc.CNIArgs) (*cnirpc.Ad
 		logger.Sugar().Errorw("failed to get namespace", "name", podNS, "error", err)
 		return nil, newInternalError(err, "failed to get namespace")
 	}
-	poolName := constants.DefaultPool
-	if v, ok := ns.Annotations[constants.AnnPool]; ok {
-		poolName = v
+	// Pods backing Services that preserve source addresses are annotated
+	// with their pool by the admission webhook of coil-controller.
+	poolName := pod.Annotations[constants.AnnSourceIPPool]
+	if poolName == "" {
+		var err error
+		poolName, err = s.getPoolName(ctx, ns)
+		if err != nil {
+			logger.Sugar().Errorw("failed to decide the pool", "namespace", podNS, "error", err)
+			return nil, err
+		}
+	}
+
+	noDefaultRoute, prefixes, err := defaultRoute(ns)
+	if err != nil {
+		logger.Sugar().Errorw("invalid default route", "namespace", podNS, "error", err)
+		return nil, err
 	}
 
-	ipv4, ipv6, err := s.nodeIPAM.Allocate(ctx, poolName, args.ContainerId, args.Ifname)
+	pool, err := s.getPool(ctx, poolName)
+	if err != nil {
+		// the datapath cannot be decided without the pool.
+		logger.Sugar().Errorw("failed to get the pool", "pool", poolName, "error", err)
+		return nil, newInternalError(err, "failed to get the pool")
+	}
+	if pool != nil {
+		if reason, ok := ipam.PauseReason(pool); ok {
+			// the reason reaches users through the events of the Pod recorded by kubelet.
+			logger.Sugar().Infow("pool paused", "pool", poolName, "reason", reason)
+			return nil, newError(codes.Unavailable, cnirpc.ErrorCode_TRY_AGAIN_LATER,
+				fmt.Sprintf("pool %s is paused: %s", poolName, reason), reason)
+		}
+	}
+
+	if s.policy != nil {
+		if err := s.policy.Review(ctx, newAllocationReview(pod, ns, poolName)); err != nil {
+			if errors.Is(err, ErrAllocationDenied) {
+				logger.Sugar().Infow("allocation denied by policy", "pool", poolName, "reason", err.Error())
+				return nil, newError(codes.PermissionDenied, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG,
+					"allocation denied by policy", err.Error())
+			}
+			logger.Sugar().Errorw("failed to review allocation", "error", err)
+			return nil, newError(codes.Unavailable, cnirpc.ErrorCode_TRY_AGAIN_LATER,
+				"failed to review allocation", err.Error())
+		}
+	}
+
+	id := s.allocationID(args)
+	s.claimHold(ctx, logger.Sugar(), podNS, podName, poolName, id, args.Ifname)
+	allocCtx := ctx
+	if isCritical(pod) {
+		allocCtx = ipam.WithCritical(ctx)
+	}
+	ipv4, ipv6, err := s.nodeIPAM.AllocateSpread(allocCtx, poolName, id, args.Ifname, spreadGroup(pod))
 	if err != nil {
 		logger.Sugar().Errorw("failed to allocate address", "error", err)
+		if ctx.Err() != nil {
+			return nil, newDeadlineError(err, "deadline exceeded while allocating address")
+		}
 		return nil, newInternalError(err, "failed to allocate address")
 	}
 
+	extra, err := s.allocateExtra(ctx, pod, args)
+	if err != nil {
+		s.rollbackAdd(logger, args, false)
+		logger.Sugar().Errorw("failed to allocate extra addresses", "error", err)
+		return nil, err
+	}
+
 	hook, err := s.getHook(ctx, pod)
 	if err != nil {
+		s.rollbackAdd(logger, args, false)
 		logger.Sugar().Errorw("failed to setup NAT hook", "error", err)
 		return nil, newInternalError(err, "failed to setup NAT hook")
 	}
@@ -235,37 +425,356 @@ func (s *coildServer) Add(ctx context.Context, args *cnirpc.CNIArgs) (*cnirpc.Ad
 	}
 
 	result, err := s.podNet.Setup(args.Netns, podName, podNS, &nodenet.PodNetConf{
-		ContainerId: args.ContainerId,
-		IFace:       args.Ifname,
-		IPv4:        ipv4,
-		IPv6:        ipv6,
-		PoolName:    poolName,
+		ContainerId:     id,
+		IFace:           args.Ifname,
+		IPv4:            ipv4,
+		IPv6:            ipv6,
+		PoolName:        poolName,
+		AcceptRA:        pool != nil && pool.Spec.AcceptRouterAdvertisements,
+		Datapath:        datapath(pool),
+		L2:              l2Conf(pool, ipv4, ipv6),
+		DelegatedPrefix: delegatedPrefix(pool, ipv6),
+		Extra:           extra,
+		Routes:          append(s.routes(pool), prefixes...),
+		NoDefaultRoute:  noDefaultRoute,
 	}, hook)
 	if err != nil {
-		if err := s.nodeIPAM.Free(ctx, args.ContainerId, args.Ifname); err != nil {
-			logger.Sugar().Warnw("failed to deallocate address", "error", err)
-		}
+		s.rollbackAdd(logger, args, false)
 		logger.Sugar().Errorw("failed to setup pod network", "error", err)
 		return nil, newInternalError(err, "failed to setup pod network")
 	}
 
+	setDNS(pool, result)
+
 	data, err := json.Marshal(result)
 	if err != nil {
-		if err := s.podNet.Destroy(args.ContainerId, args.Ifname); err != nil {
-			logger.Sugar().Warnw("failed to destroy pod network", "error", err)
-		}
-		if err := s.nodeIPAM.Free(ctx, args.ContainerId, args.Ifname); err != nil {
-			logger.Sugar().Warnw("failed to deallocate address", "error", err)
-		}
+		s.rollbackAdd(logger, args, true)
 		logger.Sugar().Errorw("failed to marshal the result", "error", err)
 		return nil, newInternalError(err, "failed to marshal the result")
 	}
+
+	// the CNI plugin no longer waits for the result.
+	if err := ctx.Err(); err != nil {
+		s.rollbackAdd(logger, args, true)
+		logger.Sugar().Errorw("deadline exceeded after setting up pod network", "error", err)
+		return nil, newDeadlineError(err, "deadline exceeded")
+	}
+
+	if s.prober != nil {
+		s.prober.Probe(pod, args.Netns, ipv4, ipv6, probeTargets(pool))
+	}
+	if s.churn != nil {
+		s.churn.Allocated(id, podNS)
+	}
+	s.recordAdd(args, podNS, podName)
 	return &cnirpc.AddResponse{Result: data}, nil
 }
 
+// probeTargets returns the addresses to probe the Pod network of `pool`.
+// Pods on the macvlan datapath are probed with the gateways of the pool
+// because they cannot reach the node.  For others, nil is returned to use
+// the default targets.
+func probeTargets(pool *coilv2.AddressPool) []net.IP {
+	if datapath(pool) != nodenet.DatapathMACVLAN {
+		return nil
+	}
+	targets := []net.IP{}
+	for _, gw := range pool.Spec.Gateways {
+		if ip := net.ParseIP(gw); ip != nil {
+			targets = append(targets, ip)
+		}
+	}
+	return targets
+}
+
+// rollbackAdd frees the address allocated by Add.  If destroy is true,
+// the pod network is also destroyed.
+//
+// The request context is not used because it may have been expired.
+func (s *coildServer) rollbackAdd(logger *zap.Logger, args *cnirpc.CNIArgs, destroy bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	id := s.allocationID(args)
+	if destroy {
+		if err := s.podNet.Destroy(id, args.Ifname); err != nil {
+			logger.Sugar().Warnw("failed to destroy pod network", "error", err)
+		}
+	}
+	if err := s.nodeIPAM.Free(ctx, id, args.Ifname); err != nil {
+		logger.Sugar().Warnw("failed to deallocate address", "error", err)
+	}
+}
+
+// allocateExtra allocates the extra addresses of the interface from the pools
+// listed in the annotation of `pod`.  The caller should free them on failure.
+func (s *coildServer) allocateExtra(ctx context.Context, pod *corev1.Pod, args *cnirpc.CNIArgs) ([]nodenet.ExtraAddress, error) {
+	poolNames := extraPools(pod)
+	if len(poolNames) == 0 {
+		return nil, nil
+	}
+	if len(poolNames) > ipam.MaxExtraAddresses {
+		return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG,
+			"too many extra pools", fmt.Sprintf("%d > %d", len(poolNames), ipam.MaxExtraAddresses))
+	}
+
+	var extra []nodenet.ExtraAddress
+	for i, name := range poolNames {
+		pool, err := s.getPool(ctx, name)
+		if err != nil {
+			return nil, newInternalError(err, "failed to get the pool")
+		}
+		if pool == nil {
+			return nil, newError(codes.FailedPrecondition, cnirpc.ErrorCode_TRY_AGAIN_LATER,
+				"extra pool not found", name)
+		}
+		if reason, ok := ipam.PauseReason(pool); ok {
+			return nil, newError(codes.Unavailable, cnirpc.ErrorCode_TRY_AGAIN_LATER,
+				fmt.Sprintf("pool %s is paused: %s", name, reason), reason)
+		}
+		ipv4, ipv6, err := s.nodeIPAM.Allocate(ctx, name, s.allocationID(args), ipam.ExtraIFace(args.Ifname, i+1))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, newDeadlineError(err, "deadline exceeded while allocating extra address")
+			}
+			return nil, newInternalError(err, "failed to allocate extra address")
+		}
+		extra = append(extra, nodenet.ExtraAddress{PoolName: name, IPv4: ipv4, IPv6: ipv6})
+	}
+	return extra, nil
+}
+
+// extraPools returns the names of the pools listed in the annotation of `pod`.
+func extraPools(pod *corev1.Pod) []string {
+	var poolNames []string
+	for _, name := range strings.Split(pod.Annotations[constants.AnnExtraPools], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			poolNames = append(poolNames, name)
+		}
+	}
+	return poolNames
+}
+
+// newAllocationReview returns the input of AllocationPolicy for `pod` in `ns`.
+func newAllocationReview(pod *corev1.Pod, ns *corev1.Namespace, poolName string) *AllocationReview {
+	return &AllocationReview{
+		Pod: ReviewedPod{
+			Name:               pod.Name,
+			Labels:             pod.Labels,
+			Annotations:        pod.Annotations,
+			ServiceAccountName: pod.Spec.ServiceAccountName,
+		},
+		Namespace: ReviewedNamespace{
+			Name:        ns.Name,
+			Labels:      ns.Labels,
+			Annotations: ns.Annotations,
+		},
+		Node:       pod.Spec.NodeName,
+		Pool:       poolName,
+		ExtraPools: extraPools(pod),
+	}
+}
+
+// getPool returns the pool, or nil if it does not exist.
+func (s *coildServer) getPool(ctx context.Context, poolName string) (*coilv2.AddressPool, error) {
+	pool := &coilv2.AddressPool{}
+	if err := s.client.Get(ctx, client.ObjectKey{Name: poolName}, pool); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return pool, nil
+}
+
+// datapath returns the datapath name of the pool.
+func datapath(pool *coilv2.AddressPool) string {
+	if pool == nil {
+		return nodenet.DatapathRouted
+	}
+	return pool.Spec.DatapathOrDefault()
+}
+
+// l2Conf returns the configuration to attach Pods directly to the L2 network,
+// or nil if the pool uses the routed datapath.
+func l2Conf(pool *coilv2.AddressPool, ipv4, ipv6 net.IP) *nodenet.L2Conf {
+	if datapath(pool) != coilv2.DatapathMACVLAN {
+		return nil
+	}
+
+	conf := &nodenet.L2Conf{}
+	for _, ss := range pool.Spec.Subnets {
+		if ss.IPv4 != nil && ipv4 != nil {
+			if _, n, err := net.ParseCIDR(*ss.IPv4); err == nil && n.Contains(ipv4) {
+				conf.IPv4Net = n
+			}
+		}
+		if ss.IPv6 != nil && ipv6 != nil {
+			if _, n, err := net.ParseCIDR(*ss.IPv6); err == nil && n.Contains(ipv6) {
+				conf.IPv6Net = n
+			}
+		}
+	}
+	for _, gw := range pool.Spec.Gateways {
+		if ip := net.ParseIP(gw); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			conf.Gateways = append(conf.Gateways, ip)
+		}
+	}
+	return conf
+}
+
+// delegatedPrefix returns the prefix delegated to this node that `ipv6`
+// belongs to, or nil if the pool does not use prefix delegation.
+func delegatedPrefix(pool *coilv2.AddressPool, ipv6 net.IP) *net.IPNet {
+	if pool == nil || !pool.Spec.PrefixDelegation || ipv6 == nil {
+		return nil
+	}
+	mask := net.CIDRMask(128-int(pool.Spec.BlockSizeBits), 128)
+	return &net.IPNet{IP: ipv6.Mask(mask), Mask: mask}
+}
+
+// routes returns the additional routes for Pods using the pool.
+// They are the routes given to coild followed by those of the pool.
+func (s *coildServer) routes(pool *coilv2.AddressPool) []*net.IPNet {
+	routes := append([]*net.IPNet(nil), s.podRoutes...)
+	if pool == nil {
+		return routes
+	}
+	for _, r := range pool.Spec.Routes {
+		if _, n, err := net.ParseCIDR(r); err == nil {
+			routes = append(routes, n)
+		}
+	}
+	return routes
+}
+
+// spreadGroup returns the group of Pods whose addresses should be spread over
+// address blocks, or an empty string.  Pods having AnnBlockAntiAffinity
+// annotation of "true" are grouped by their controllers.
+func spreadGroup(pod *corev1.Pod) string {
+	if pod.Annotations[constants.AnnBlockAntiAffinity] != "true" {
+		return ""
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return string(owner.UID)
+	}
+	return ""
+}
+
+// isCritical returns true if the Pod has the priority of system-critical Pods.
+// The priority is resolved from the PriorityClass by the admission controller.
+func isCritical(pod *corev1.Pod) bool {
+	return pod.Spec.Priority != nil && *pod.Spec.Priority >= ipam.CriticalPriority
+}
+
+// defaultRoute decides the default route of Pods in the namespace.
+//
+// If the namespace has AnnDefaultRoute annotation of DefaultRouteNone,
+// Pods have no default route.  If the value is a comma-separated list of
+// prefixes, Pods have routes only to them instead of the default route.
+func defaultRoute(ns *corev1.Namespace) (bool, []*net.IPNet, error) {
+	v, ok := ns.Annotations[constants.AnnDefaultRoute]
+	if !ok {
+		return false, nil, nil
+	}
+
+	switch v = strings.TrimSpace(v); v {
+	case constants.DefaultRouteGateway:
+		return false, nil, nil
+	case constants.DefaultRouteNone:
+		return true, nil, nil
+	}
+
+	var prefixes []*net.IPNet
+	for _, c := range strings.Split(v, ",") {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(c))
+		if err != nil {
+			return false, nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG,
+				"invalid default route", v)
+		}
+		prefixes = append(prefixes, n)
+	}
+	return true, prefixes, nil
+}
+
+// setDNS sets DNS settings of the pool to the CNI result.
+func setDNS(pool *coilv2.AddressPool, result *current.Result) {
+	if pool == nil || pool.Spec.DNS == nil {
+		return
+	}
+
+	result.DNS = types.DNS{
+		Nameservers: pool.Spec.DNS.Nameservers,
+		Domain:      pool.Spec.DNS.Domain,
+		Search:      pool.Spec.DNS.Search,
+		Options:     pool.Spec.DNS.Options,
+	}
+}
+
+// getPoolName decides the pool for Pods in the namespace.
+//
+// If the namespace has AnnPool annotation, its value is the pool name.
+// If the namespace has AnnPoolSelector annotation, the first pool by name
+// matching the label selector is chosen.  Otherwise, the default pool is used.
+func (s *coildServer) getPoolName(ctx context.Context, ns *corev1.Namespace) (string, error) {
+	if v, ok := ns.Annotations[constants.AnnPool]; ok {
+		return v, nil
+	}
+
+	v, ok := ns.Annotations[constants.AnnPoolSelector]
+	if !ok {
+		return s.defaultPool(), nil
+	}
+
+	sel, err := labels.Parse(v)
+	if err != nil {
+		return "", newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG,
+			"invalid pool selector", err.Error())
+	}
+
+	pools := &coilv2.AddressPoolList{}
+	if err := s.client.List(ctx, pools, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return "", newInternalError(err, "failed to list pools")
+	}
+
+	var names []string
+	for _, p := range pools.Items {
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) == 0 {
+		return "", newError(codes.FailedPrecondition, cnirpc.ErrorCode_TRY_AGAIN_LATER,
+			"no pool matches the selector", v)
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// defaultPool returns the pool for namespaces without pool annotations.
+func (s *coildServer) defaultPool() string {
+	if s.config == nil {
+		return constants.DefaultPool
+	}
+	return s.config.DefaultPool()
+}
+
 func (s *coildServer) Del(ctx context.Context, args *cnirpc.CNIArgs) (*emptypb.Empty, error) {
 	logger := ctxzap.Extract(ctx)
 
+	// DEL may be called without a network namespace.
+	if err := validateArgs(args, false); err != nil {
+		logger.Sugar().Errorw("invalid arguments", "error", err)
+		return nil, err
+	}
+
+	id := s.allocationID(args)
+	if id != args.ContainerId && s.replaced(args) {
+		logger.Sugar().Infow("ignoring DEL of a container replaced by another of the same Pod", "allocation_id", id)
+		return &emptypb.Empty{}, nil
+	}
+
 	duration := 30 * time.Second
 	deadline, ok := ctx.Deadline()
 	if ok {
@@ -277,7 +786,7 @@ func (s *coildServer) Del(ctx context.Context, args *cnirpc.CNIArgs) (*emptypb.E
 	logger.Sugar().Infow("waiting before destroying pod network", "duration", duration.String())
 	time.Sleep(duration)
 
-	if err := s.podNet.Destroy(args.ContainerId, args.Ifname); err != nil {
+	if err := s.podNet.Destroy(id, args.Ifname); err != nil {
 		logger.Sugar().Errorw("failed to destroy pod network", "error", err)
 		return nil, newInternalError(err, "failed to destroy pod network")
 	}
@@ -293,23 +802,224 @@ func (s *coildServer) Del(ctx context.Context, args *cnirpc.CNIArgs) (*emptypb.E
 		}
 	}
 
-	if err := s.nodeIPAM.Free(ctx, args.ContainerId, args.Ifname); err != nil {
+	if err := s.nodeIPAM.Free(ctx, id, args.Ifname); err != nil {
 		logger.Sugar().Errorw("failed to free addresses", "error", err)
 		return nil, newInternalError(err, "failed to free addresses")
 	}
+	if s.churn != nil {
+		s.churn.Freed(id)
+	}
+	s.forgetAdd(args)
 	return &emptypb.Empty{}, nil
 }
 
 func (s *coildServer) Check(ctx context.Context, args *cnirpc.CNIArgs) (*emptypb.Empty, error) {
 	logger := ctxzap.Extract(ctx)
 
-	if err := s.podNet.Check(args.ContainerId, args.Ifname); err != nil {
+	if err := validateArgs(args, true); err != nil {
+		logger.Sugar().Errorw("invalid arguments", "error", err)
+		return nil, err
+	}
+
+	if err := s.podNet.Check(s.allocationID(args), args.Ifname); err != nil {
 		logger.Sugar().Errorw("check failed", "error", err)
 		return nil, newInternalError(err, "check failed")
 	}
 	return &emptypb.Empty{}, nil
 }
 
+// Recover tells the outcome of a previous Add for the container to the CNI
+// plugin that could not receive the result, for instance because the deadline
+// was exceeded or coild restarted during Add.
+//
+// If the Pod network has been set up, it is kept and its addresses are returned.
+// Otherwise, the Pod network set up partially is destroyed and the address is
+// freed, so that the next Add can start over.
+func (s *coildServer) Recover(ctx context.Context, args *cnirpc.CNIArgs) (*cnirpc.RecoverResponse, error) {
+	logger := ctxzap.Extract(ctx)
+
+	if err := validateArgs(args, true); err != nil {
+		logger.Sugar().Errorw("invalid arguments", "error", err)
+		return nil, err
+	}
+
+	confs, err := s.podNet.List()
+	if err != nil {
+		logger.Sugar().Errorw("failed to list pod networks", "error", err)
+		return nil, newInternalError(err, "failed to list pod networks")
+	}
+	id := s.allocationID(args)
+	var conf *nodenet.PodNetConf
+	for _, c := range confs {
+		if c.ContainerId == id && c.IFace == args.Ifname {
+			conf = c
+			break
+		}
+	}
+
+	if conf != nil {
+		err := s.podNet.Check(id, args.Ifname)
+		if err == nil {
+			pool, err := s.getPool(ctx, conf.PoolName)
+			if err != nil {
+				logger.Sugar().Errorw("failed to get the pool", "pool", conf.PoolName, "error", err)
+				return nil, newInternalError(err, "failed to get the pool")
+			}
+			data, err := json.Marshal(recoveredResult(args, conf, pool))
+			if err != nil {
+				logger.Sugar().Errorw("failed to marshal the result", "error", err)
+				return nil, newInternalError(err, "failed to marshal the result")
+			}
+			logger.Sugar().Infow("recovered committed pod network", "ipv4", conf.IPv4, "ipv6", conf.IPv6)
+			return &cnirpc.RecoverResponse{Committed: true, Result: data}, nil
+		}
+		logger.Sugar().Infow("destroying broken pod network", "error", err)
+	}
+
+	if err := s.podNet.Destroy(id, args.Ifname); err != nil {
+		logger.Sugar().Errorw("failed to destroy pod network", "error", err)
+		return nil, newInternalError(err, "failed to destroy pod network")
+	}
+	if err := s.nodeIPAM.Free(ctx, id, args.Ifname); err != nil {
+		logger.Sugar().Errorw("failed to free addresses", "error", err)
+		return nil, newInternalError(err, "failed to free addresses")
+	}
+	logger.Sugar().Info("cleaned up uncommitted pod network")
+	return &cnirpc.RecoverResponse{}, nil
+}
+
+// recoveredResult returns the CNI result for the Pod network set up previously.
+// MAC addresses and the host-side interface are not included.
+func recoveredResult(args *cnirpc.CNIArgs, conf *nodenet.PodNetConf, pool *coilv2.AddressPool) *current.Result {
+	idx := 0
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{
+			{Name: args.Ifname, Sandbox: args.Netns},
+		},
+	}
+	if conf.IPv4 != nil {
+		result.IPs = append(result.IPs, &current.IPConfig{
+			Address:   net.IPNet{IP: conf.IPv4, Mask: net.CIDRMask(32, 32)},
+			Interface: &idx,
+		})
+	}
+	if conf.IPv6 != nil {
+		result.IPs = append(result.IPs, &current.IPConfig{
+			Address:   net.IPNet{IP: conf.IPv6, Mask: net.CIDRMask(128, 128)},
+			Interface: &idx,
+		})
+	}
+	for _, e := range conf.Extra {
+		if e.IPv4 != nil {
+			result.IPs = append(result.IPs, &current.IPConfig{
+				Address:   net.IPNet{IP: e.IPv4, Mask: net.CIDRMask(32, 32)},
+				Interface: &idx,
+			})
+		}
+		if e.IPv6 != nil {
+			result.IPs = append(result.IPs, &current.IPConfig{
+				Address:   net.IPNet{IP: e.IPv6, Mask: net.CIDRMask(128, 128)},
+				Interface: &idx,
+			})
+		}
+	}
+	setDNS(pool, result)
+	return result
+}
+
+func (s *coildServer) Version(ctx context.Context, _ *emptypb.Empty) (*cnirpc.VersionResponse, error) {
+	return &cnirpc.VersionResponse{
+		MinApiVersion: cnirpc.MinAPIVersion,
+		MaxApiVersion: cnirpc.APIVersion,
+		CoildVersion:  v2.Version(),
+	}, nil
+}
+
+func (s *coildServer) TrafficStats(ctx context.Context, _ *emptypb.Empty) (*cnirpc.TrafficStatsResponse, error) {
+	logger := ctxzap.Extract(ctx)
+
+	confs, err := s.podNet.List()
+	if err != nil {
+		logger.Sugar().Errorw("failed to list pod networks", "error", err)
+		return nil, newInternalError(err, "failed to list pod networks")
+	}
+	ips := make(map[string][]string)
+	for _, c := range confs {
+		ips[c.ContainerId+"/"+c.IFace] = podNetConfIPs(c)
+	}
+
+	stats, err := s.podNet.Stats()
+	if err != nil {
+		logger.Sugar().Errorw("failed to get traffic stats", "error", err)
+		return nil, newInternalError(err, "failed to get traffic stats")
+	}
+	resp := &cnirpc.TrafficStatsResponse{}
+	for _, st := range stats {
+		resp.Stats = append(resp.Stats, &cnirpc.PodTrafficStats{
+			Pool:        st.PoolName,
+			ContainerId: st.ContainerId,
+			Ifname:      st.IFace,
+			Ips:         ips[st.ContainerId+"/"+st.IFace],
+			TxPackets:   st.TxPackets,
+			TxBytes:     st.TxBytes,
+			RxPackets:   st.RxPackets,
+			RxBytes:     st.RxBytes,
+		})
+	}
+	sort.Slice(resp.Stats, func(i, j int) bool {
+		if resp.Stats[i].ContainerId != resp.Stats[j].ContainerId {
+			return resp.Stats[i].ContainerId < resp.Stats[j].ContainerId
+		}
+		return resp.Stats[i].Ifname < resp.Stats[j].Ifname
+	})
+	return resp, nil
+}
+
+func (s *coildServer) Contention(ctx context.Context, _ *emptypb.Empty) (*cnirpc.ContentionResponse, error) {
+	resp := &cnirpc.ContentionResponse{}
+	for _, pc := range ipam.ContentionReport() {
+		p := &cnirpc.PoolContention{
+			Pool:                    pc.Pool,
+			Allocations:             pc.Allocations,
+			Frees:                   pc.Frees,
+			BlockRequests:           pc.BlockRequests,
+			BlockRequestWaitSeconds: pc.BlockRequestWait.Seconds(),
+			LockWaitSeconds:         pc.LockWait.Seconds(),
+			Conflicts:               pc.Conflicts,
+		}
+		for _, bc := range pc.Blocks {
+			p.Blocks = append(p.Blocks, &cnirpc.BlockContention{
+				Block:       bc.Block,
+				Allocations: bc.Allocations,
+				Frees:       bc.Frees,
+				Conflicts:   bc.Conflicts,
+			})
+		}
+		resp.Pools = append(resp.Pools, p)
+	}
+	return resp, nil
+}
+
+func (s *coildServer) NodeStatus(ctx context.Context, _ *emptypb.Empty) (*cnirpc.NodeStatusResponse, error) {
+	if s.status == nil {
+		return nil, status.Error(codes.Unimplemented, "node status is not available")
+	}
+
+	resp := &cnirpc.NodeStatusResponse{
+		Version: v2.Version(),
+		Errors:  s.errors.list(),
+	}
+	if s.readOnly != nil {
+		resp.ReadOnly = s.readOnly.Enabled()
+	}
+	if err := s.status.Report(ctx, resp); err != nil {
+		ctxzap.Extract(ctx).Sugar().Errorw("failed to report node status", "error", err)
+		return nil, newInternalError(err, "failed to report node status")
+	}
+	return resp, nil
+}
+
 func (s *coildServer) getHook(ctx context.Context, pod *corev1.Pod) (nodenet.SetupHook, error) {
 	logger := ctxzap.Extract(ctx)
 
@@ -390,3 +1100,38 @@ func (s *coildServer) getHook(ctx context.Context, pod *corev1.Pod) (nodenet.Set
 	}
 	return nil, nil
 }
+
+func (s *coildServer) GetReadOnly(ctx context.Context, _ *emptypb.Empty) (*cnirpc.ReadOnlyMode, error) {
+	if s.readOnly == nil {
+		return &cnirpc.ReadOnlyMode{}, nil
+	}
+	return &cnirpc.ReadOnlyMode{Enabled: s.readOnly.Enabled()}, nil
+}
+
+func (s *coildServer) SetReadOnly(ctx context.Context, req *cnirpc.ReadOnlyMode) (*cnirpc.ReadOnlyMode, error) {
+	if s.readOnly == nil {
+		return nil, status.Error(codes.Unimplemented, "read-only mode is not supported")
+	}
+	s.readOnly.Set(req.Enabled)
+	return &cnirpc.ReadOnlyMode{Enabled: s.readOnly.Enabled()}, nil
+}
+
+func (s *coildServer) GetLogLevel(ctx context.Context, _ *emptypb.Empty) (*cnirpc.LogLevel, error) {
+	if s.logLevel == nil {
+		return nil, status.Error(codes.Unimplemented, "log level is not available")
+	}
+	return &cnirpc.LogLevel{Level: loglevel.String(s.logLevel.Level())}, nil
+}
+
+func (s *coildServer) SetLogLevel(ctx context.Context, req *cnirpc.LogLevel) (*cnirpc.LogLevel, error) {
+	if s.logLevel == nil {
+		return nil, status.Error(codes.Unimplemented, "log level is not available")
+	}
+	l, err := loglevel.Parse(req.Level)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.logLevel.SetLevel(l)
+	ctxzap.Extract(ctx).Info("changed log level", zap.String("level", req.Level))
+	return &cnirpc.LogLevel{Level: loglevel.String(s.logLevel.Level())}, nil
+}
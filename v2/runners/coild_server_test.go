@@ -9,11 +9,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"testing"
 	"time"
 
 	current "github.com/containernetworking/cni/pkg/types/100"
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
 	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
 	"github.com/cybozu-go/coil/v2/pkg/nodenet"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -22,8 +24,14 @@ import (
 	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
@@ -31,6 +39,7 @@ type mockNodeIPAM struct {
 	nAllocate int
 	nFree     int
 	errFree   bool
+	lastGroup string
 }
 
 func (n *mockNodeIPAM) Register(ctx context.Context, poolName, containerID, iface string, ipv4, ipv6 net.IP) error {
@@ -39,6 +48,18 @@ func (n *mockNodeIPAM) Register(ctx context.Context, poolName, containerID, ifac
 func (n *mockNodeIPAM) GC(ctx context.Context) error {
 	panic("not implemented")
 }
+func (n *mockNodeIPAM) Transfer(fromID, fromIface, toID, toIface string) (net.IP, net.IP, bool) {
+	panic("not implemented")
+}
+func (n *mockNodeIPAM) Lookup(containerID, iface string) (net.IP, net.IP, bool) {
+	panic("not implemented")
+}
+func (n *mockNodeIPAM) Preallocate(ctx context.Context, poolName string, num int) error {
+	panic("not implemented")
+}
+func (n *mockNodeIPAM) Handoff(ctx context.Context, blockName, nodeName string) error {
+	panic("not implemented")
+}
 func (n *mockNodeIPAM) Notify(*coilv2.BlockRequest) {
 	panic("not implemented")
 }
@@ -61,9 +82,17 @@ func (n *mockNodeIPAM) Allocate(ctx context.Context, poolName, containerID, ifac
 	if poolName == "global" && containerID == "dns1" {
 		return net.ParseIP("8.8.8.8"), nil, nil
 	}
+	if poolName == "smtp" {
+		return net.ParseIP("10.9.0.1"), nil, nil
+	}
 	return nil, nil, errors.New("some error")
 }
 
+func (n *mockNodeIPAM) AllocateSpread(ctx context.Context, poolName, containerID, iface, group string) (ipv4, ipv6 net.IP, err error) {
+	n.lastGroup = group
+	return n.Allocate(ctx, poolName, containerID, iface)
+}
+
 func (n *mockNodeIPAM) Free(ctx context.Context, containerID, iface string) error {
 	n.nFree++
 	if n.errFree {
@@ -72,6 +101,21 @@ func (n *mockNodeIPAM) Free(ctx context.Context, containerID, iface string) erro
 	return nil
 }
 
+type mockAllocationPolicy struct {
+	lastReview *AllocationReview
+}
+
+func (p *mockAllocationPolicy) Review(ctx context.Context, review *AllocationReview) error {
+	p.lastReview = review
+	switch review.Namespace.Name {
+	case "denied":
+		return fmt.Errorf("%w: not routable", ErrAllocationDenied)
+	case "policy-error":
+		return errors.New("policy engine is down")
+	}
+	return nil
+}
+
 type mockPodNetwork struct {
 	nSetup   int
 	nCheck   int
@@ -79,17 +123,31 @@ type mockPodNetwork struct {
 
 	errSetup   bool
 	errDestroy bool
+	setupDelay time.Duration
+
+	confs    []*nodenet.PodNetConf
+	stats    []nodenet.TrafficStats
+	lastConf *nodenet.PodNetConf
 }
 
 func (p *mockPodNetwork) Init() error {
 	panic("not implemented")
 }
-func (p *mockPodNetwork) List() ([]*nodenet.PodNetConf, error) {
+func (p *mockPodNetwork) Cleanup() error {
 	panic("not implemented")
 }
+func (p *mockPodNetwork) List() ([]*nodenet.PodNetConf, error) {
+	return p.confs, nil
+}
+
+func (p *mockPodNetwork) Stats() ([]nodenet.TrafficStats, error) {
+	return p.stats, nil
+}
 
 func (p *mockPodNetwork) Setup(nsPath, podName, podNS string, conf *nodenet.PodNetConf, hook nodenet.SetupHook) (*current.Result, error) {
 	p.nSetup++
+	p.lastConf = conf
+	time.Sleep(p.setupDelay)
 	if p.errSetup {
 		return nil, errors.New("setup failure")
 	}
@@ -151,6 +209,8 @@ var _ = Describe("Coild server", func() {
 	var nodeIPAM *mockNodeIPAM
 	var podNet *mockPodNetwork
 	var natsetup *mockNATSetup
+	var policy *mockAllocationPolicy
+	var churn ChurnTracker
 	var logbuf *bytes.Buffer
 	var conn *grpc.ClientConn
 	var cniClient cnirpc.CNIClient
@@ -173,9 +233,17 @@ var _ = Describe("Coild server", func() {
 		nodeIPAM = &mockNodeIPAM{}
 		podNet = &mockPodNetwork{}
 		natsetup = &mockNATSetup{}
+		policy = &mockAllocationPolicy{}
+		churn = NewChurnTracker("node1")
 		logbuf = &bytes.Buffer{}
 		logger := zap.NewRaw(zap.WriteTo(logbuf), zap.StacktraceLevel(zapcore.DPanicLevel))
-		serv := NewCoildServer(l, mgr, nodeIPAM, podNet, natsetup, logger)
+		nodeStatus := NewNodeStatusReporter(mgr.GetAPIReader(), podNet, nil, "node1")
+		serv := NewCoildServer(l, mgr, nodeIPAM, podNet, natsetup, CoildServerOptions{
+			Policy:           policy,
+			Churn:            churn,
+			AllocationIDKind: AllocationIDContainer,
+			Status:           nodeStatus,
+		}, logger)
 		err = mgr.Add(serv)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -259,6 +327,10 @@ var _ = Describe("Coild server", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(result.IPs).To(HaveLen(2))
 
+		By("checking the churn of ns1")
+		report := churn.(*churnTracker).report(time.Minute, 10)
+		Expect(report.Namespaces).To(Equal([]ChurnEntry{{Namespace: "ns1", Allocations: 1}}))
+
 		By("checking custom tags in gRPC log")
 		// Expecting JSON output like:
 		// {
@@ -415,6 +487,477 @@ var _ = Describe("Coild server", func() {
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("should select a pool by label selector", func() {
+		pod := &corev1.Pod{}
+		pod.Namespace = "ns3"
+		pod.Name = "selector"
+		pod.Spec.Containers = []corev1.Container{
+			{Name: "nginx", Image: "nginx"},
+		}
+		err := k8sClient.Create(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		args := &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "selector", "K8S_POD_NAMESPACE": "ns3"},
+			ContainerId: "dns1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/selector",
+		}
+
+		By("calling Add without matching pools")
+		_, err = cniClient.Add(ctx, args)
+		Expect(err).To(HaveOccurred())
+		Expect(nodeIPAM.nAllocate).To(Equal(0))
+
+		By("creating pools")
+		for _, name := range []string{"zzz", "global"} {
+			ap := &coilv2.AddressPool{}
+			ap.Name = name
+			ap.Labels = map[string]string{"tier": "routable"}
+			ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("8.8.8.0/24")}}
+			ap.Spec.DNS = &coilv2.DNSConfig{
+				Nameservers: []string{"10.100.0.53"},
+				Search:      []string{name + ".example.com"},
+			}
+			ap.Spec.Routes = []string{"169.254.169.254/32"}
+			err = k8sClient.Create(ctx, ap)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("calling Add for ns3/selector")
+		var data *cnirpc.AddResponse
+		Eventually(func() error {
+			var err error
+			data, err = cniClient.Add(ctx, args)
+			return err
+		}).Should(Succeed())
+
+		By("checking DNS settings of the pool in the result")
+		result := &current.Result{}
+		err = json.Unmarshal(data.Result, result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.DNS.Nameservers).To(Equal([]string{"10.100.0.53"}))
+		Expect(result.DNS.Search).To(Equal([]string{"global.example.com"}))
+
+		By("checking routes of the pool")
+		Expect(podNet.lastConf.Routes).To(HaveLen(1))
+		Expect(podNet.lastConf.Routes[0].String()).To(Equal("169.254.169.254/32"))
+	})
+
+	It("should override the default route by the namespace annotation", func() {
+		for name, v := range map[string]string{"restricted": "10.100.0.0/16, fd00:100::/64", "broken": "10.100.0.0"} {
+			ns := &corev1.Namespace{}
+			ns.Name = name
+			ns.Annotations = map[string]string{constants.AnnDefaultRoute: v}
+			err := k8sClient.Create(ctx, ns)
+			Expect(err).NotTo(HaveOccurred())
+
+			pod := &corev1.Pod{}
+			pod.Namespace = name
+			pod.Name = "pod"
+			pod.Spec.Containers = []corev1.Container{
+				{Name: "nginx", Image: "nginx"},
+			}
+			err = k8sClient.Create(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("calling Add for restricted/pod")
+		Eventually(func() error {
+			_, err := cniClient.Add(ctx, &cnirpc.CNIArgs{
+				Args:        map[string]string{"K8S_POD_NAME": "pod", "K8S_POD_NAMESPACE": "restricted"},
+				ContainerId: "pod1",
+				Ifname:      "eth0",
+				Netns:       "/run/netns/restricted",
+			})
+			return err
+		}).Should(Succeed())
+		Expect(podNet.lastConf.NoDefaultRoute).To(BeTrue())
+		Expect(podNet.lastConf.Routes).To(HaveLen(2))
+		Expect(podNet.lastConf.Routes[0].String()).To(Equal("10.100.0.0/16"))
+		Expect(podNet.lastConf.Routes[1].String()).To(Equal("fd00:100::/64"))
+
+		By("calling Add for broken/pod")
+		Eventually(func() codes.Code {
+			_, err := cniClient.Add(ctx, &cnirpc.CNIArgs{
+				Args:        map[string]string{"K8S_POD_NAME": "pod", "K8S_POD_NAMESPACE": "broken"},
+				ContainerId: "broken",
+				Ifname:      "eth0",
+				Netns:       "/run/netns/broken",
+			})
+			return status.Code(err)
+		}).Should(Equal(codes.InvalidArgument))
+	})
+
+	It("should refuse allocations denied by the policy", func() {
+		for _, name := range []string{"denied", "policy-error"} {
+			ns := &corev1.Namespace{}
+			ns.Name = name
+			ns.Labels = map[string]string{"team": "foo"}
+			err := k8sClient.Create(ctx, ns)
+			Expect(err).NotTo(HaveOccurred())
+
+			pod := &corev1.Pod{}
+			pod.Namespace = name
+			pod.Name = "pod"
+			pod.Annotations = map[string]string{constants.AnnExtraPools: "smtp"}
+			pod.Spec.Containers = []corev1.Container{
+				{Name: "nginx", Image: "nginx"},
+			}
+			err = k8sClient.Create(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("calling Add for denied/pod")
+		Eventually(func() codes.Code {
+			_, err := cniClient.Add(ctx, &cnirpc.CNIArgs{
+				Args:        map[string]string{"K8S_POD_NAME": "pod", "K8S_POD_NAMESPACE": "denied"},
+				ContainerId: "pod1",
+				Ifname:      "eth0",
+				Netns:       "/run/netns/denied",
+			})
+			return status.Code(err)
+		}).Should(Equal(codes.PermissionDenied))
+		Expect(nodeIPAM.nAllocate).To(Equal(0))
+		Expect(podNet.nSetup).To(Equal(0))
+
+		review := policy.lastReview
+		Expect(review).NotTo(BeNil())
+		Expect(review.Pod.Name).To(Equal("pod"))
+		Expect(review.Namespace.Labels).To(HaveKeyWithValue("team", "foo"))
+		Expect(review.Pool).To(Equal("default"))
+		Expect(review.ExtraPools).To(Equal([]string{"smtp"}))
+
+		By("calling Add for policy-error/pod")
+		_, err := cniClient.Add(ctx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "pod", "K8S_POD_NAMESPACE": "policy-error"},
+			ContainerId: "pod1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/policy-error",
+		})
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		Expect(nodeIPAM.nAllocate).To(Equal(0))
+	})
+
+	It("should refuse allocations from paused pools with the reason", func() {
+		ap := &coilv2.AddressPool{}
+		ap.Name = "maintained"
+		ap.Labels = map[string]string{constants.LabelPaused: "true"}
+		ap.Annotations = map[string]string{constants.AnnPauseReason: "replacing the routers until 18:00"}
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.8.0.0/24")}}
+		err := k8sClient.Create(ctx, ap)
+		Expect(err).NotTo(HaveOccurred())
+
+		ns := &corev1.Namespace{}
+		ns.Name = "paused"
+		ns.Annotations = map[string]string{constants.AnnPool: "maintained"}
+		err = k8sClient.Create(ctx, ns)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := &corev1.Pod{}
+		pod.Namespace = "paused"
+		pod.Name = "pod"
+		pod.Spec.Containers = []corev1.Container{
+			{Name: "nginx", Image: "nginx"},
+		}
+		err = k8sClient.Create(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("calling Add for paused/pod")
+		Eventually(func() codes.Code {
+			_, err = cniClient.Add(ctx, &cnirpc.CNIArgs{
+				Args:        map[string]string{"K8S_POD_NAME": "pod", "K8S_POD_NAMESPACE": "paused"},
+				ContainerId: "pod1",
+				Ifname:      "eth0",
+				Netns:       "/run/netns/paused",
+			})
+			return status.Code(err)
+		}).Should(Equal(codes.Unavailable))
+		Expect(status.Convert(err).Message()).To(ContainSubstring("replacing the routers until 18:00"))
+		Expect(nodeIPAM.nAllocate).To(Equal(0))
+
+		By("calling Add for a Pod requesting extra addresses from the paused pool")
+		pod = &corev1.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = "extra-paused"
+		pod.Annotations = map[string]string{constants.AnnExtraPools: "maintained"}
+		pod.Spec.Containers = []corev1.Container{
+			{Name: "nginx", Image: "nginx"},
+		}
+		err = k8sClient.Create(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cniClient.Add(ctx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "extra-paused", "K8S_POD_NAMESPACE": "ns1"},
+			ContainerId: "pod1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/extra-paused",
+		})
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		Expect(status.Convert(err).Message()).To(ContainSubstring("replacing the routers until 18:00"))
+		Expect(podNet.nSetup).To(Equal(0))
+		Expect(nodeIPAM.nFree).To(Equal(1))
+	})
+
+	It("should spread addresses of Pods with block anti-affinity", func() {
+		pod := &corev1.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = "spread"
+		pod.Annotations = map[string]string{constants.AnnBlockAntiAffinity: "true"}
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       "ReplicaSet",
+			Name:       "spread",
+			UID:        "d4a2a4c5-5ad3-4b0c-9b4a-3f8e4b8f2d2a",
+			Controller: pointer.BoolPtr(true),
+		}}
+		pod.Spec.Containers = []corev1.Container{
+			{Name: "nginx", Image: "nginx"},
+		}
+		err := k8sClient.Create(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cniClient.Add(ctx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "spread", "K8S_POD_NAMESPACE": "ns1"},
+			ContainerId: "pod1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/spread",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeIPAM.lastGroup).To(Equal("d4a2a4c5-5ad3-4b0c-9b4a-3f8e4b8f2d2a"))
+	})
+
+	It("should allocate extra addresses from the annotated pools", func() {
+		ap := &coilv2.AddressPool{}
+		ap.Name = "smtp"
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.9.0.0/24")}}
+		err := k8sClient.Create(ctx, ap)
+		Expect(err).NotTo(HaveOccurred())
+
+		for name, pools := range map[string]string{"extra": "smtp", "extra-missing": "smtp,missing"} {
+			pod := &corev1.Pod{}
+			pod.Namespace = "ns1"
+			pod.Name = name
+			pod.Annotations = map[string]string{constants.AnnExtraPools: pools}
+			pod.Spec.Containers = []corev1.Container{
+				{Name: "nginx", Image: "nginx"},
+			}
+			err = k8sClient.Create(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("calling Add for ns1/extra")
+		data, err := cniClient.Add(ctx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "extra", "K8S_POD_NAMESPACE": "ns1"},
+			ContainerId: "pod1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/extra",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).NotTo(BeNil())
+		Expect(nodeIPAM.nAllocate).To(Equal(2))
+		Expect(podNet.lastConf.IPv4.String()).To(Equal("10.1.2.3"))
+		Expect(podNet.lastConf.Extra).To(HaveLen(1))
+		Expect(podNet.lastConf.Extra[0].PoolName).To(Equal("smtp"))
+		Expect(podNet.lastConf.Extra[0].IPv4.String()).To(Equal("10.9.0.1"))
+
+		By("calling Add for a Pod requesting a missing pool")
+		_, err = cniClient.Add(ctx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "extra-missing", "K8S_POD_NAMESPACE": "ns1"},
+			ContainerId: "pod1",
+			Ifname:      "eth1",
+			Netns:       "/run/netns/extra-missing",
+		})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		Expect(podNet.nSetup).To(Equal(1))
+		Expect(nodeIPAM.nFree).To(Equal(1))
+	})
+
+	It("should roll back Add after the deadline is exceeded", func() {
+		pod := &corev1.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = "slow"
+		pod.Spec.Containers = []corev1.Container{
+			{Name: "nginx", Image: "nginx"},
+		}
+		err := k8sClient.Create(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		podNet.setupDelay = 500 * time.Millisecond
+		reqCtx, reqCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer reqCancel()
+		_, err = cniClient.Add(reqCtx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "slow", "K8S_POD_NAMESPACE": "ns1"},
+			ContainerId: "pod1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/slow",
+		})
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+
+		Eventually(func() []int {
+			return []int{podNet.nSetup, podNet.nDestroy, nodeIPAM.nFree}
+		}).Should(Equal([]int{1, 1, 1}))
+	})
+
+	It("should recover the outcome of Add", func() {
+		podNet.confs = []*nodenet.PodNetConf{
+			{PoolName: "default", ContainerId: "pod1", IFace: "eth0", IPv4: net.ParseIP("10.1.2.3").To4(), IPv6: net.ParseIP("fd02::1")},
+			{PoolName: "default", ContainerId: "broken", IFace: "eth0", IPv4: net.ParseIP("10.1.2.4").To4()},
+		}
+
+		By("recovering a committed pod network")
+		resp, err := cniClient.Recover(ctx, &cnirpc.CNIArgs{ContainerId: "pod1", Ifname: "eth0", Netns: "/run/netns/foo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Committed).To(BeTrue())
+		result := &current.Result{}
+		err = json.Unmarshal(resp.Result, result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs).To(HaveLen(2))
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.3/32"))
+		Expect(result.IPs[1].Address.String()).To(Equal("fd02::1/128"))
+		Expect(result.Interfaces).To(HaveLen(1))
+		Expect(result.Interfaces[0].Sandbox).To(Equal("/run/netns/foo"))
+		Expect(podNet.nDestroy).To(Equal(0))
+		Expect(nodeIPAM.nFree).To(Equal(0))
+
+		By("cleaning up a broken pod network")
+		resp, err = cniClient.Recover(ctx, &cnirpc.CNIArgs{ContainerId: "broken", Ifname: "eth0", Netns: "/run/netns/foo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Committed).To(BeFalse())
+		Expect(podNet.nDestroy).To(Equal(1))
+		Expect(nodeIPAM.nFree).To(Equal(1))
+
+		By("cleaning up a missing pod network")
+		resp, err = cniClient.Recover(ctx, &cnirpc.CNIArgs{ContainerId: "pod3", Ifname: "eth0", Netns: "/run/netns/foo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Committed).To(BeFalse())
+		Expect(podNet.nDestroy).To(Equal(2))
+		Expect(nodeIPAM.nFree).To(Equal(2))
+
+		By("failing to clean up")
+		nodeIPAM.errFree = true
+		_, err = cniClient.Recover(ctx, &cnirpc.CNIArgs{ContainerId: "pod3", Ifname: "eth0", Netns: "/run/netns/foo"})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+	})
+
+	It("should free addresses of a Pod forcibly", func() {
+		podNet.confs = []*nodenet.PodNetConf{
+			{PoolName: "default", ContainerId: "pod1", IFace: "eth0", IPv4: net.ParseIP("10.1.2.3").To4(), IPv6: net.ParseIP("fd02::1")},
+			{PoolName: "default", ContainerId: "other", IFace: "eth0", IPv4: net.ParseIP("10.1.2.4").To4()},
+		}
+		for _, name := range []string{"alive", "leaked"} {
+			pod := &corev1.Pod{}
+			pod.Namespace = "ns1"
+			pod.Name = name
+			pod.Spec.Containers = []corev1.Container{
+				{Name: "nginx", Image: "nginx"},
+			}
+			err := k8sClient.Create(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("refusing to free addresses of an existing Pod")
+		Eventually(func() codes.Code {
+			_, err := cniClient.ForceFree(ctx, &cnirpc.ForceFreeRequest{PodNamespace: "ns1", PodName: "alive"})
+			return status.Code(err)
+		}).Should(Equal(codes.FailedPrecondition))
+
+		By("locating addresses of an existing Pod with force and dry-run")
+		resp, err := cniClient.ForceFree(ctx, &cnirpc.ForceFreeRequest{
+			PodNamespace: "ns1", PodName: "alive", Ips: []string{"fd02::1"}, Force: true, DryRun: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.ContainerId).To(Equal("pod1"))
+		Expect(resp.Ips).To(Equal([]string{"10.1.2.3", "fd02::1"}))
+		Expect(resp.Freed).To(BeFalse())
+		Expect(podNet.nDestroy).To(Equal(0))
+		Expect(nodeIPAM.nFree).To(Equal(0))
+
+		By("failing to locate addresses of an unknown Pod")
+		_, err = cniClient.ForceFree(ctx, &cnirpc.ForceFreeRequest{PodNamespace: "ns1", PodName: "unknown"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+
+		By("freeing addresses of a deleted Pod recorded by Add")
+		_, err = cniClient.Add(ctx, &cnirpc.CNIArgs{
+			Args:        map[string]string{"K8S_POD_NAME": "leaked", "K8S_POD_NAMESPACE": "ns1"},
+			ContainerId: "pod1",
+			Ifname:      "eth0",
+			Netns:       "/run/netns/leaked",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		pod := &corev1.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = "leaked"
+		err = k8sClient.Delete(ctx, pod, client.GracePeriodSeconds(0))
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			resp, err = cniClient.ForceFree(ctx, &cnirpc.ForceFreeRequest{PodNamespace: "ns1", PodName: "leaked"})
+			return err
+		}).Should(Succeed())
+		Expect(resp.ContainerId).To(Equal("pod1"))
+		Expect(resp.Freed).To(BeTrue())
+		Expect(podNet.nDestroy).To(Equal(1))
+		Expect(nodeIPAM.nFree).To(Equal(1))
+
+		By("forgetting the freed Pod")
+		_, err = cniClient.ForceFree(ctx, &cnirpc.ForceFreeRequest{PodNamespace: "ns1", PodName: "leaked"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("should return traffic stats of pods", func() {
+		podNet.confs = []*nodenet.PodNetConf{
+			{PoolName: "default", ContainerId: "pod2", IFace: "eth0", IPv4: net.ParseIP("10.1.2.3"), IPv6: net.ParseIP("fd02::1")},
+			{PoolName: "global", ContainerId: "pod1", IFace: "eth0", IPv4: net.ParseIP("8.8.8.8")},
+		}
+		podNet.stats = []nodenet.TrafficStats{
+			{PoolName: "default", ContainerId: "pod2", IFace: "eth0", TxPackets: 1, TxBytes: 100, RxPackets: 2, RxBytes: 200},
+			{PoolName: "global", ContainerId: "pod1", IFace: "eth0", TxPackets: 3, TxBytes: 300},
+		}
+
+		resp, err := cniClient.TrafficStats(ctx, &emptypb.Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Stats).To(HaveLen(2))
+
+		st := resp.Stats[0]
+		Expect(st.Pool).To(Equal("global"))
+		Expect(st.ContainerId).To(Equal("pod1"))
+		Expect(st.Ips).To(Equal([]string{"8.8.8.8"}))
+		Expect(st.TxPackets).To(BeNumerically("==", 3))
+		Expect(st.TxBytes).To(BeNumerically("==", 300))
+
+		st = resp.Stats[1]
+		Expect(st.Pool).To(Equal("default"))
+		Expect(st.ContainerId).To(Equal("pod2"))
+		Expect(st.Ifname).To(Equal("eth0"))
+		Expect(st.Ips).To(Equal([]string{"10.1.2.3", "fd02::1"}))
+		Expect(st.TxPackets).To(BeNumerically("==", 1))
+		Expect(st.TxBytes).To(BeNumerically("==", 100))
+		Expect(st.RxPackets).To(BeNumerically("==", 2))
+		Expect(st.RxBytes).To(BeNumerically("==", 200))
+	})
+
+	It("should report node status with errors", func() {
+		_, err := cniClient.Add(ctx, &cnirpc.CNIArgs{
+			ContainerId: "node-status",
+			Netns:       "/run/netns/node-status",
+			Ifname:      "eth0",
+			Args: map[string]string{
+				constants.PodNameKey:      "notfound",
+				constants.PodNamespaceKey: "ns1",
+			},
+		})
+		Expect(err).To(HaveOccurred())
+
+		resp, err := cniClient.NodeStatus(ctx, &emptypb.Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Node).To(Equal("node1"))
+		Expect(resp.Version).NotTo(BeEmpty())
+		Expect(resp.Errors).NotTo(BeEmpty())
+		Expect(resp.Errors[0].Method).To(Equal("Add"))
+		Expect(resp.Errors[0].Pod).To(Equal("ns1/notfound"))
+	})
+
 	It("should setup Foo-over-UDP NAT", func() {
 		By("creating pod declaring itself as a NAT client")
 		pod := &corev1.Pod{}
@@ -437,6 +980,8 @@ var _ = Describe("Coild server", func() {
 			Netns:       "/run/netns/nat-client1",
 		})
 		Expect(err).To(HaveOccurred())
+		Expect(nodeIPAM.nAllocate).To(Equal(1))
+		Expect(nodeIPAM.nFree).To(Equal(1))
 
 		eg := &coilv2.Egress{}
 		eg.Namespace = "ns2"
@@ -484,3 +1029,23 @@ var _ = Describe("Coild server", func() {
 		Expect(subnet.IP.Equal(net.ParseIP("192.168.0.0"))).To(BeTrue())
 	})
 })
+
+func TestDelegatedPrefix(t *testing.T) {
+	t.Parallel()
+
+	pool := &coilv2.AddressPool{}
+	pool.Spec.BlockSizeBits = 64
+	pool.Spec.Subnets = []coilv2.SubnetSet{{IPv6: strPtr("2001:db8::/48")}}
+	ip := net.ParseIP("2001:db8:0:3::5")
+	if n := delegatedPrefix(pool, ip); n != nil {
+		t.Error("pools without prefix delegation should not have prefixes:", n)
+	}
+
+	pool.Spec.PrefixDelegation = true
+	if n := delegatedPrefix(pool, ip); n == nil || n.String() != "2001:db8:0:3::/64" {
+		t.Error("unexpected prefix:", n)
+	}
+	if n := delegatedPrefix(pool, nil); n != nil {
+		t.Error("no prefix should be returned without IPv6 address:", n)
+	}
+}
@@ -0,0 +1,281 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const federationClaimsKey = "claims"
+
+var federationDenied = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "federation_denied_subnets",
+		Help:      "the number of subnets in the pool claimed earlier by other clusters",
+	},
+	[]string{"pool"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(federationDenied)
+}
+
+// subnetClaim represents a subnet of a pool claimed by a cluster.
+type subnetClaim struct {
+	Pool   string      `json:"pool"`
+	Subnet string      `json:"subnet"`
+	Since  metav1.Time `json:"since"`
+}
+
+// Federation coordinates subnets of address pools with other clusters
+// through ConfigMaps in a hub cluster.
+//
+// Each cluster publishes the subnets of its pools as claims.
+// If subnets claimed by two clusters overlap, the cluster that claimed
+// later is denied to curve out address blocks from the subnet.
+type Federation interface {
+	manager.Runnable
+	ipam.SubnetGuard
+}
+
+// NewFederation creates a Federation.
+// `hub` is a client for the hub cluster, and `namespace` is the namespace
+// of the hub cluster to store ConfigMaps.
+func NewFederation(mgr manager.Manager, hub client.Client, clusterName, namespace string, log logr.Logger, interval time.Duration) Federation {
+	return &federation{
+		apiReader:   mgr.GetAPIReader(),
+		hub:         hub,
+		clusterName: clusterName,
+		namespace:   namespace,
+		log:         log,
+		interval:    interval,
+		denied:      make(map[string][]*net.IPNet),
+	}
+}
+
+type federation struct {
+	apiReader   client.Reader
+	hub         client.Client
+	clusterName string
+	namespace   string
+	log         logr.Logger
+	interval    time.Duration
+
+	mu     sync.RWMutex
+	denied map[string][]*net.IPNet
+}
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
+
+var _ manager.LeaderElectionRunnable = &federation{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*federation) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (f *federation) Start(ctx context.Context) error {
+	tick := time.NewTicker(f.interval)
+	defer tick.Stop()
+
+	for {
+		// The hub cluster may be temporarily unavailable.
+		// The last known state is kept in that case.
+		if err := f.sync(ctx); err != nil {
+			f.log.Error(err, "failed to synchronize with the hub cluster")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// Allowed implements ipam.SubnetGuard
+func (f *federation) Allowed(poolName string, subnet *net.IPNet) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, n := range f.denied[poolName] {
+		if n.String() == subnet.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *federation) configMapName(clusterName string) string {
+	return "coil-cluster-" + clusterName
+}
+
+func (f *federation) sync(ctx context.Context) error {
+	pools := &coilv2.AddressPoolList{}
+	if err := f.apiReader.List(ctx, pools); err != nil {
+		return fmt.Errorf("failed to list address pools: %w", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := f.hub.Get(ctx, client.ObjectKey{Namespace: f.namespace, Name: f.configMapName(f.clusterName)}, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get ConfigMap from the hub: %w", err)
+	}
+	exists := err == nil
+
+	current, err := parseClaims(cm)
+	if err != nil {
+		return err
+	}
+	claims := makeClaims(pools.Items, current, metav1.Now())
+
+	if !exists || !reflect.DeepEqual(current, claims) {
+		data, err := json.Marshal(claims)
+		if err != nil {
+			return err
+		}
+		cm.Namespace = f.namespace
+		cm.Name = f.configMapName(f.clusterName)
+		cm.Labels = map[string]string{constants.LabelFederation: f.clusterName}
+		cm.Data = map[string]string{federationClaimsKey: string(data)}
+		if exists {
+			err = f.hub.Update(ctx, cm)
+		} else {
+			err = f.hub.Create(ctx, cm)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to publish claims to the hub: %w", err)
+		}
+		f.log.Info("published claims", "claims", len(claims))
+	}
+
+	cms := &corev1.ConfigMapList{}
+	if err := f.hub.List(ctx, cms, client.InNamespace(f.namespace), client.HasLabels{constants.LabelFederation}); err != nil {
+		return fmt.Errorf("failed to list ConfigMaps in the hub: %w", err)
+	}
+	others := make(map[string][]subnetClaim)
+	for i := range cms.Items {
+		other := &cms.Items[i]
+		name := other.Labels[constants.LabelFederation]
+		if name == f.clusterName {
+			continue
+		}
+		c, err := parseClaims(other)
+		if err != nil {
+			f.log.Error(err, "ignoring broken claims", "cluster", name)
+			continue
+		}
+		others[name] = c
+	}
+
+	denied := computeDenied(f.clusterName, claims, others, f.log)
+
+	f.mu.Lock()
+	f.denied = denied
+	f.mu.Unlock()
+
+	federationDenied.Reset()
+	for _, p := range pools.Items {
+		federationDenied.WithLabelValues(p.Name).Set(float64(len(denied[p.Name])))
+	}
+	return nil
+}
+
+func parseClaims(cm *corev1.ConfigMap) ([]subnetClaim, error) {
+	data, ok := cm.Data[federationClaimsKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var claims []subnetClaim
+	if err := json.Unmarshal([]byte(data), &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims in %s/%s: %w", cm.Namespace, cm.Name, err)
+	}
+	return claims, nil
+}
+
+// makeClaims creates claims for the subnets of pools.
+// The claimed time of an existing claim in `current` is preserved.
+func makeClaims(pools []coilv2.AddressPool, current []subnetClaim, now metav1.Time) []subnetClaim {
+	since := make(map[string]metav1.Time)
+	for _, c := range current {
+		since[c.Pool+"/"+c.Subnet] = c.Since
+	}
+
+	var claims []subnetClaim
+	for _, p := range pools {
+		for _, ss := range p.Spec.Subnets {
+			for _, s := range []*string{ss.IPv4, ss.IPv6} {
+				if s == nil {
+					continue
+				}
+				t, ok := since[p.Name+"/"+*s]
+				if !ok {
+					t = now
+				}
+				claims = append(claims, subnetClaim{Pool: p.Name, Subnet: *s, Since: t})
+			}
+		}
+	}
+	return claims
+}
+
+// computeDenied returns subnets of each pool that overlap with earlier claims of other clusters.
+// If two claims are made at the same time, the cluster with the smaller name wins.
+func computeDenied(clusterName string, own []subnetClaim, others map[string][]subnetClaim, log logr.Logger) map[string][]*net.IPNet {
+	denied := make(map[string][]*net.IPNet)
+
+OUTER:
+	for _, c := range own {
+		_, n, err := net.ParseCIDR(c.Subnet)
+		if err != nil {
+			continue
+		}
+
+		for other, claims := range others {
+			for _, d := range claims {
+				_, m, err := net.ParseCIDR(d.Subnet)
+				if err != nil {
+					continue
+				}
+				if !n.Contains(m.IP) && !m.Contains(n.IP) {
+					continue
+				}
+				if c.Since.Before(&d.Since) || (c.Since.Equal(&d.Since) && clusterName < other) {
+					continue
+				}
+
+				log.Info("subnet is claimed earlier by another cluster",
+					"pool", c.Pool,
+					"subnet", c.Subnet,
+					"cluster", other,
+					"other-pool", d.Pool,
+					"other-subnet", d.Subnet,
+				)
+				denied[c.Pool] = append(denied[c.Pool], n)
+				continue OUTER
+			}
+		}
+	}
+
+	return denied
+}
@@ -0,0 +1,92 @@
+package runners
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFederationClaims(t *testing.T) {
+	t.Run("makeClaims", testMakeClaims)
+	t.Run("computeDenied", testComputeDenied)
+}
+
+func testMakeClaims(t *testing.T) {
+	t.Parallel()
+
+	t1 := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	t2 := metav1.NewTime(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC))
+
+	pool := coilv2.AddressPool{}
+	pool.Name = "default"
+	pool.Spec.Subnets = []coilv2.SubnetSet{
+		{IPv4: strPtr("10.2.0.0/16"), IPv6: strPtr("fd02::/112")},
+		{IPv4: strPtr("10.3.0.0/16"), IPv6: strPtr("fd03::/112")},
+	}
+	current := []subnetClaim{
+		{Pool: "default", Subnet: "10.2.0.0/16", Since: t1},
+		{Pool: "default", Subnet: "fd02::/112", Since: t1},
+		{Pool: "removed", Subnet: "10.9.0.0/16", Since: t1},
+	}
+
+	claims := makeClaims([]coilv2.AddressPool{pool}, current, t2)
+	if len(claims) != 4 {
+		t.Fatal("unexpected claims:", claims)
+	}
+	for _, c := range claims {
+		expected := t2
+		if c.Subnet == "10.2.0.0/16" || c.Subnet == "fd02::/112" {
+			expected = t1
+		}
+		if !c.Since.Equal(&expected) {
+			t.Error("unexpected claimed time", c)
+		}
+	}
+}
+
+func testComputeDenied(t *testing.T) {
+	t.Parallel()
+
+	t1 := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	t2 := metav1.NewTime(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC))
+
+	own := []subnetClaim{
+		{Pool: "default", Subnet: "10.2.0.0/16", Since: t2},
+		{Pool: "default", Subnet: "10.3.0.0/16", Since: t1},
+		{Pool: "global", Subnet: "10.4.0.0/24", Since: t1},
+		{Pool: "global", Subnet: "10.5.0.0/24", Since: t1},
+	}
+	others := map[string][]subnetClaim{
+		// cluster a claimed a part of 10.2.0.0/16 earlier
+		"a": {{Pool: "default", Subnet: "10.2.128.0/17", Since: t1}},
+		// cluster b claimed a subnet including 10.3.0.0/16 later
+		"b": {{Pool: "p", Subnet: "10.0.0.0/8", Since: t2}},
+		// cluster c claimed 10.4.0.0/24 at the same time
+		"c": {{Pool: "q", Subnet: "10.4.0.0/24", Since: t1}},
+		// cluster 0 claimed 10.5.0.0/24 at the same time
+		"0": {{Pool: "r", Subnet: "10.5.0.0/24", Since: t1}},
+	}
+
+	denied := computeDenied("x", own, others, logr.Discard())
+	if len(denied["default"]) != 1 || denied["default"][0].String() != "10.2.0.0/16" {
+		t.Error("unexpected denied subnets of default:", denied["default"])
+	}
+	// "x" > "c", so cluster c wins for 10.4.0.0/24 and "0" wins for 10.5.0.0/24.
+	if len(denied["global"]) != 2 {
+		t.Error("unexpected denied subnets of global:", denied["global"])
+	}
+
+	f := &federation{denied: denied}
+	_, n, _ := net.ParseCIDR("10.2.0.0/16")
+	if f.Allowed("default", n) {
+		t.Error("10.2.0.0/16 should be denied")
+	}
+	_, n, _ = net.ParseCIDR("10.3.0.0/16")
+	if !f.Allowed("default", n) {
+		t.Error("10.3.0.0/16 should be allowed")
+	}
+}
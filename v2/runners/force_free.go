@@ -0,0 +1,172 @@
+package runners
+
+import (
+	"context"
+	"net"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"google.golang.org/grpc/codes"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// addRecord is the container of a Pod set up by Add.
+type addRecord struct {
+	containerID string
+	allocID     string
+	ifname      string
+}
+
+func podKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// recordAdd remembers the container of a Pod for ForceFree.
+func (s *coildServer) recordAdd(args *cnirpc.CNIArgs, podNS, podName string) {
+	s.addRecords.Store(podKey(podNS, podName), addRecord{containerID: args.ContainerId, allocID: s.allocationID(args), ifname: args.Ifname})
+}
+
+// replaced returns true if another container of the Pod has been set up by Add
+// after the container in `args`.
+func (s *coildServer) replaced(args *cnirpc.CNIArgs) bool {
+	key := podKey(args.Args[constants.PodNamespaceKey], args.Args[constants.PodNameKey])
+	v, ok := s.addRecords.Load(key)
+	return ok && v.(addRecord).containerID != args.ContainerId
+}
+
+// forgetAdd forgets the container recorded by recordAdd.
+func (s *coildServer) forgetAdd(args *cnirpc.CNIArgs) {
+	key := podKey(args.Args[constants.PodNamespaceKey], args.Args[constants.PodNameKey])
+	if v, ok := s.addRecords.Load(key); ok && v.(addRecord).containerID == args.ContainerId {
+		s.addRecords.Delete(key)
+	}
+}
+
+func (s *coildServer) ForceFree(ctx context.Context, req *cnirpc.ForceFreeRequest) (*cnirpc.ForceFreeResponse, error) {
+	logger := ctxzap.Extract(ctx).Sugar().With("pod.namespace", req.PodNamespace, "pod.name", req.PodName)
+
+	if req.PodNamespace == "" || req.PodName == "" {
+		return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES,
+			"missing pod name/namespace", "")
+	}
+	var ips []net.IP
+	for _, s := range req.Ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG,
+				"invalid IP address", s)
+		}
+		ips = append(ips, ip)
+	}
+
+	pod := &corev1.Pod{}
+	err := s.apiReader.Get(ctx, client.ObjectKey{Namespace: req.PodNamespace, Name: req.PodName}, pod)
+	switch {
+	case apierrors.IsNotFound(err):
+		pod = nil
+	case err != nil:
+		logger.Errorw("failed to get pod", "error", err)
+		return nil, newInternalError(err, "failed to get pod")
+	case !req.Force:
+		return nil, newError(codes.FailedPrecondition, cnirpc.ErrorCode_UNKNOWN,
+			"pod still exists; free its addresses with force", "")
+	}
+
+	var record *addRecord
+	if len(ips) == 0 {
+		if pod != nil {
+			for _, podIP := range pod.Status.PodIPs {
+				if ip := net.ParseIP(podIP.IP); ip != nil {
+					ips = append(ips, ip)
+				}
+			}
+		} else if v, ok := s.addRecords.Load(podKey(req.PodNamespace, req.PodName)); ok {
+			r := v.(addRecord)
+			record = &r
+		}
+	}
+	if len(ips) == 0 && record == nil {
+		return nil, newError(codes.NotFound, cnirpc.ErrorCode_UNKNOWN_CONTAINER,
+			"no addresses are known for the pod; specify its addresses", "")
+	}
+
+	confs, err := s.podNet.List()
+	if err != nil {
+		logger.Errorw("failed to list pod networks", "error", err)
+		return nil, newInternalError(err, "failed to list pod networks")
+	}
+	conf := findPodNetConf(confs, record, ips)
+	if conf == nil {
+		return nil, newError(codes.NotFound, cnirpc.ErrorCode_UNKNOWN_CONTAINER,
+			"no pod network has the addresses of the pod", "")
+	}
+
+	resp := &cnirpc.ForceFreeResponse{
+		Pool:        conf.PoolName,
+		ContainerId: conf.ContainerId,
+		Ifname:      conf.IFace,
+		Ips:         podNetConfIPs(conf),
+	}
+	if req.DryRun {
+		return resp, nil
+	}
+
+	if err := s.podNet.Destroy(conf.ContainerId, conf.IFace); err != nil {
+		logger.Errorw("failed to destroy pod network", "error", err)
+		return nil, newInternalError(err, "failed to destroy pod network")
+	}
+	if err := s.nodeIPAM.Free(ctx, conf.ContainerId, conf.IFace); err != nil {
+		logger.Errorw("failed to free addresses", "error", err)
+		return nil, newInternalError(err, "failed to free addresses")
+	}
+	s.addRecords.Delete(podKey(req.PodNamespace, req.PodName))
+	if s.churn != nil {
+		s.churn.Freed(conf.ContainerId)
+	}
+	logger.Infow("freed addresses forcibly", "container_id", conf.ContainerId, "ifname", conf.IFace, "ips", resp.Ips, "force", req.Force)
+
+	resp.Freed = true
+	return resp, nil
+}
+
+// findPodNetConf returns the pod network of the container in `record`, or
+// the one having any of `ips`.
+func findPodNetConf(confs []*nodenet.PodNetConf, record *addRecord, ips []net.IP) *nodenet.PodNetConf {
+	for _, c := range confs {
+		if record != nil {
+			if c.ContainerId == record.allocID && c.IFace == record.ifname {
+				return c
+			}
+			continue
+		}
+		for _, s := range podNetConfIPs(c) {
+			for _, ip := range ips {
+				if ip.Equal(net.ParseIP(s)) {
+					return c
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// podNetConfIPs returns the addresses of the pod network including the extra addresses.
+func podNetConfIPs(c *nodenet.PodNetConf) []string {
+	var ips []string
+	add := func(ip net.IP) {
+		if ip != nil {
+			ips = append(ips, ip.String())
+		}
+	}
+	add(c.IPv4)
+	add(c.IPv6)
+	for _, e := range c.Extra {
+		add(e.IPv4)
+		add(e.IPv6)
+	}
+	return ips
+}
@@ -0,0 +1,93 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/freequeue"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// NewFreeQueueDrainer creates a manager.Runnable to replay DEL requests
+// recorded in the free queue at `dir` by coil while coild was not available.
+//
+// The queue is drained when the runner starts and every `interval`.
+// It is not drained while `readOnly` is enabled, if not nil.
+// Addresses are freed for the IDs of `allocIDKind`; see AllocationID.
+func NewFreeQueueDrainer(dir string, nodeIPAM ipam.NodeIPAM, podNet nodenet.PodNetwork, readOnly ReadOnlyMode, allocIDKind string, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &freeQueueDrainer{
+		dir:         dir,
+		nodeIPAM:    nodeIPAM,
+		podNet:      podNet,
+		readOnly:    readOnly,
+		allocIDKind: allocIDKind,
+		interval:    interval,
+		log:         log,
+	}
+}
+
+type freeQueueDrainer struct {
+	dir         string
+	nodeIPAM    ipam.NodeIPAM
+	podNet      nodenet.PodNetwork
+	readOnly    ReadOnlyMode
+	allocIDKind string
+	interval    time.Duration
+	log         logr.Logger
+}
+
+var _ manager.LeaderElectionRunnable = &freeQueueDrainer{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*freeQueueDrainer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (d *freeQueueDrainer) Start(ctx context.Context) error {
+	tick := time.NewTicker(d.interval)
+	defer tick.Stop()
+
+	for {
+		d.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (d *freeQueueDrainer) drain(ctx context.Context) {
+	if d.readOnly != nil && d.readOnly.Enabled() {
+		return
+	}
+
+	entries, err := freequeue.List(d.dir)
+	if err != nil {
+		d.log.Error(err, "failed to list the free queue", "dir", d.dir)
+		return
+	}
+
+	for _, e := range entries {
+		// failed entries are retried in the next round.
+		id := AllocationID(d.allocIDKind, e.ContainerID, e.PodNamespace, e.PodName)
+		if err := d.podNet.Destroy(id, e.Ifname); err != nil {
+			d.log.Error(err, "failed to destroy pod network", "container", e.ContainerID, "ifname", e.Ifname)
+			continue
+		}
+		if err := d.nodeIPAM.Free(ctx, id, e.Ifname); err != nil {
+			d.log.Error(err, "failed to free addresses", "container", e.ContainerID, "ifname", e.Ifname)
+			continue
+		}
+		if err := freequeue.Remove(d.dir, e); err != nil {
+			d.log.Error(err, "failed to remove an entry from the free queue", "container", e.ContainerID, "ifname", e.Ifname)
+			continue
+		}
+		d.log.Info("freed addresses of a deleted container", "container", e.ContainerID, "ifname", e.Ifname, "queued", e.Queued)
+	}
+}
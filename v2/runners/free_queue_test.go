@@ -0,0 +1,51 @@
+package runners
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/freequeue"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestFreeQueueDrainer(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, cid := range []string{"c1", "c2"} {
+		err := freequeue.Push(dir, freequeue.Entry{ContainerID: cid, Ifname: "eth0", Queued: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nodeIPAM := &mockNodeIPAM{errFree: true}
+	podNet := &mockPodNetwork{}
+	d := NewFreeQueueDrainer(dir, nodeIPAM, podNet, nil, AllocationIDContainer, time.Minute, ctrl.Log.WithName("free-queue")).(*freeQueueDrainer)
+
+	d.drain(context.Background())
+	if nodeIPAM.nFree != 2 || podNet.nDestroy != 2 {
+		t.Error("entries should be processed", nodeIPAM.nFree, podNet.nDestroy)
+	}
+	entries, err := freequeue.List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Error("failed entries should be kept:", entries)
+	}
+
+	nodeIPAM.errFree = false
+	d.drain(context.Background())
+	if nodeIPAM.nFree != 4 {
+		t.Error("entries should be retried", nodeIPAM.nFree)
+	}
+	entries, err = freequeue.List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Error("freed entries should be removed:", entries)
+	}
+}
@@ -2,27 +2,143 @@ package runners
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/notify"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
-// NewGarbageCollector creates a manager.Runnable to collect
-// orphaned AddressBlocks of deleted nodes.
-func NewGarbageCollector(mgr manager.Manager, log logr.Logger, interval time.Duration) manager.Runnable {
+var (
+	objectCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "objects",
+			Help:      "the number of Coil objects observed at the last garbage collection",
+		},
+		[]string{"kind"},
+	)
+
+	gcOrphanedBlocks = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "gc_orphaned_blocks",
+			Help:      "the number of address blocks of deleted or dead nodes found at the last garbage collection",
+		},
+	)
+
+	gcFreedBlocks = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "gc_freed_blocks",
+			Help:      "the number of orphaned address blocks deleted at the last garbage collection",
+		},
+	)
+
+	gcOldestOrphanAge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "gc_oldest_orphan_age_seconds",
+			Help:      "how long the oldest orphaned address block found at the last garbage collection has been orphaned",
+		},
+	)
+
+	gcLeakedBlocks = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "gc_leaked_blocks",
+			Help:      "the number of orphaned address blocks of each node found at the last garbage collection",
+		},
+		[]string{"node"},
+	)
+
+	gcLastRun = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "gc_last_run_timestamp_seconds",
+			Help:      "the time when the last garbage collection finished",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(objectCount, gcOrphanedBlocks, gcFreedBlocks, gcOldestOrphanAge, gcLeakedBlocks, gcLastRun)
+}
+
+// GarbageCollector is a manager.Runnable to collect garbage.
+//
+// It also serves the report of the last collection as JSON over HTTP.
+type GarbageCollector interface {
+	manager.Runnable
+	http.Handler
+}
+
+// GCReport is the result of a garbage collection.
+type GCReport struct {
+	// StartedAt is the time when the collection started.
+	StartedAt time.Time `json:"started_at"`
+
+	// DurationSeconds is the time taken for the collection.
+	DurationSeconds float64 `json:"duration_seconds"`
+
+	// OrphanedBlocks is the number of address blocks of deleted nodes,
+	// and those of dead nodes waiting for approval to be reclaimed.
+	OrphanedBlocks int `json:"orphaned_blocks"`
+
+	// FreedBlocks is the number of orphaned blocks deleted.
+	FreedBlocks int `json:"freed_blocks"`
+
+	// OldestOrphanAgeSeconds is how long the oldest orphaned block has been orphaned.
+	OldestOrphanAgeSeconds float64 `json:"oldest_orphan_age_seconds"`
+
+	// Leaks is the number of orphaned blocks of each node.
+	Leaks map[string]int `json:"leaks"`
+
+	// PrunedRequests is the number of finished BlockRequests deleted.
+	PrunedRequests int `json:"pruned_requests"`
+
+	// Error is the error that stopped the collection, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// NewGarbageCollector creates a GarbageCollector to collect
+// orphaned AddressBlocks of deleted nodes, and BlockRequests
+// completed or failed longer than RequestTTL of `config` ago.
+// Collections run every GCInterval of `config`.
+//
+// If notifier is not nil, each orphaned block and the summary of each
+// collection are notified through it.
+//
+// If stale is not nil, BlockRequests of stale nodes are kept because
+// coild on those nodes may not have read the results yet.
+func NewGarbageCollector(mgr manager.Manager, log logr.Logger, config *coilconfig.Store, notifier notify.Notifier, stale StaleNodeDetector) GarbageCollector {
 	return &garbageCollector{
 		Client:    mgr.GetClient(),
 		apiReader: mgr.GetAPIReader(),
 		log:       log,
-		interval:  interval,
+		config:    config,
+		notifier:  notifier,
+		stale:     stale,
+		firstSeen: make(map[string]time.Time),
 	}
 }
 
@@ -30,10 +146,19 @@ type garbageCollector struct {
 	client.Client
 	apiReader client.Reader
 	log       logr.Logger
-	interval  time.Duration
+	config    *coilconfig.Store
+	notifier  notify.Notifier
+	stale     StaleNodeDetector
+
+	// firstSeen records when orphaned blocks of deleted nodes are found first.
+	firstSeen map[string]time.Time
+
+	mu     sync.Mutex
+	report *GCReport
 }
 
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=blockrequests,verbs=get;list;watch;delete
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list
 
 var _ manager.LeaderElectionRunnable = &garbageCollector{}
@@ -45,22 +170,73 @@ func (*garbageCollector) NeedLeaderElection() bool {
 
 // Start starts this runner.  This implements manager.Runnable
 func (gc *garbageCollector) Start(ctx context.Context) error {
-	tick := time.NewTicker(gc.interval)
-	defer tick.Stop()
-
+	// The interval is read every time so that changes of the config take effect.
 	for {
+		timer := time.NewTimer(gc.config.GCInterval())
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return nil
-		case <-tick.C:
-			if err := gc.do(context.Background()); err != nil {
+		case <-timer.C:
+			if err := gc.do(context.Background(), time.Now()); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-func (gc *garbageCollector) do(ctx context.Context) error {
+// ServeHTTP serves the report of the last collection.  This implements http.Handler
+func (gc *garbageCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gc.mu.Lock()
+	report := gc.report
+	gc.mu.Unlock()
+	if report == nil {
+		// only the leader runs garbage collection.
+		http.Error(w, "no garbage collection has run in this process", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+func (gc *garbageCollector) do(ctx context.Context, now time.Time) error {
+	report := &GCReport{
+		StartedAt: now,
+		Leaks:     make(map[string]int),
+	}
+	err := gc.collectBlocks(ctx, now, report)
+	if err == nil {
+		err = gc.pruneRequests(ctx, now, report)
+	}
+	report.DurationSeconds = time.Since(now).Seconds()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	gc.mu.Lock()
+	gc.report = report
+	gc.mu.Unlock()
+
+	gcOrphanedBlocks.Set(float64(report.OrphanedBlocks))
+	gcFreedBlocks.Set(float64(report.FreedBlocks))
+	gcOldestOrphanAge.Set(report.OldestOrphanAgeSeconds)
+	gcLeakedBlocks.Reset()
+	for node, n := range report.Leaks {
+		gcLeakedBlocks.WithLabelValues(node).Set(float64(n))
+	}
+	gcLastRun.SetToCurrentTime()
+	return err
+}
+
+func (gc *garbageCollector) collectBlocks(ctx context.Context, now time.Time, report *GCReport) error {
 	gc.log.Info("start garbage collection")
 
 	blocks := &coilv2.AddressBlockList{}
@@ -78,28 +254,134 @@ func (gc *garbageCollector) do(ctx context.Context) error {
 		nodeNames[n.Name] = true
 	}
 
+	orphanSince := func(since time.Time) {
+		if age := now.Sub(since).Seconds(); age > report.OldestOrphanAgeSeconds {
+			report.OldestOrphanAgeSeconds = age
+		}
+	}
+
+	seen := make(map[string]bool)
 	for _, b := range blocks.Items {
 		n := b.Labels[constants.LabelNode]
 		if nodeNames[n] {
+			// blocks of dead nodes are released by the block reclaimer after approval.
+			if v, ok := b.Annotations[constants.AnnReclaimable]; ok {
+				report.OrphanedBlocks++
+				report.Leaks[n]++
+				if t, err := time.Parse(time.RFC3339, v); err == nil {
+					orphanSince(t)
+				}
+			}
 			continue
 		}
 
-		err := gc.deleteBlock(ctx, b.Name)
+		report.OrphanedBlocks++
+		report.Leaks[n]++
+		seen[b.Name] = true
+		if _, ok := gc.firstSeen[b.Name]; !ok {
+			gc.firstSeen[b.Name] = now
+		}
+		orphanSince(gc.firstSeen[b.Name])
+
+		// Notify one event per block: BlockReleased once it is deleted,
+		// or OrphanedBlock if it is left for the next collection.
+		err := deleteBlock(ctx, gc.Client, gc.apiReader, b.Name)
 		if err != nil {
+			gc.notify(notify.Event{
+				Type:    notify.EventOrphanedBlock,
+				Pool:    b.Labels[constants.LabelPool],
+				Node:    n,
+				Block:   b.Name,
+				Message: "found a block of a deleted node that cannot be released: " + err.Error(),
+			})
 			return fmt.Errorf("failed to delete a block: %w", err)
 		}
 
 		gc.log.Info("deleted an orphan block", "block", b.Name, "node", n)
+		gc.notify(notify.Event{
+			Type:    notify.EventBlockReleased,
+			Pool:    b.Labels[constants.LabelPool],
+			Node:    n,
+			Block:   b.Name,
+			Message: "released an orphaned block",
+		})
+		delete(gc.firstSeen, b.Name)
+		report.FreedBlocks++
+	}
+	for name := range gc.firstSeen {
+		if !seen[name] {
+			delete(gc.firstSeen, name)
+		}
 	}
 
+	if report.FreedBlocks > 0 {
+		gc.notify(notify.Event{
+			Type:    notify.EventGarbageCollected,
+			Message: fmt.Sprintf("deleted %d orphaned blocks", report.FreedBlocks),
+		})
+	}
+	objectCount.WithLabelValues("AddressBlock").Set(float64(len(blocks.Items) - report.FreedBlocks))
+
 	return nil
 }
 
-func (gc *garbageCollector) deleteBlock(ctx context.Context, name string) error {
+func (gc *garbageCollector) pruneRequests(ctx context.Context, now time.Time, report *GCReport) error {
+	reqs := &coilv2.BlockRequestList{}
+	if err := gc.apiReader.List(ctx, reqs); err != nil {
+		return fmt.Errorf("failed to list block requests: %w", err)
+	}
+
+	deadline := now.Add(-gc.config.RequestTTL())
+	remaining := len(reqs.Items)
+	for i := range reqs.Items {
+		r := &reqs.Items[i]
+		t, ok := finishedAt(r)
+		if !ok || t.After(deadline) {
+			continue
+		}
+		if gc.stale != nil && gc.stale.IsStale(r.Spec.NodeName) {
+			gc.log.Info("kept a finished block request of a stale node", "request", r.Name, "node", r.Spec.NodeName)
+			continue
+		}
+
+		if err := gc.Client.Delete(ctx, r); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete block request %s: %w", r.Name, err)
+		}
+		gc.log.Info("deleted a finished block request", "request", r.Name, "finished", t)
+		remaining--
+		report.PrunedRequests++
+	}
+	objectCount.WithLabelValues("BlockRequest").Set(float64(remaining))
+
+	return nil
+}
+
+// finishedAt returns the time when the request completed or failed.
+func finishedAt(r *coilv2.BlockRequest) (time.Time, bool) {
+	for _, cond := range r.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		if cond.Type == coilv2.BlockRequestComplete || cond.Type == coilv2.BlockRequestFailed {
+			return cond.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (gc *garbageCollector) notify(ev notify.Event) {
+	if gc.notifier == nil {
+		return
+	}
+	gc.notifier.Notify(ev)
+}
+
+// deleteBlock removes the finalizer from the address block and deletes it.
+func deleteBlock(ctx context.Context, c client.Client, r client.Reader, name string) error {
 	// remove finalizer
 	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		b := &coilv2.AddressBlock{}
-		err := gc.apiReader.Get(ctx, client.ObjectKey{Name: name}, b)
+		err := r.Get(ctx, client.ObjectKey{Name: name}, b)
 		if err != nil {
 			return client.IgnoreNotFound(err)
 		}
@@ -107,7 +389,7 @@ func (gc *garbageCollector) deleteBlock(ctx context.Context, name string) error
 			return nil
 		}
 		controllerutil.RemoveFinalizer(b, constants.FinCoil)
-		return gc.Client.Update(ctx, b)
+		return c.Update(ctx, b)
 	})
 	if err != nil {
 		return fmt.Errorf("failed to remove finalizer from %s: %w", name, err)
@@ -116,5 +398,5 @@ func (gc *garbageCollector) deleteBlock(ctx context.Context, name string) error
 	// delete ignoring notfound error.
 	b := &coilv2.AddressBlock{}
 	b.Name = name
-	return client.IgnoreNotFound(gc.Client.Delete(ctx, b))
+	return client.IgnoreNotFound(c.Delete(ctx, b))
 }
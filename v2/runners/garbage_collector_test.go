@@ -6,9 +6,12 @@ import (
 	"time"
 
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
 	"github.com/cybozu-go/coil/v2/pkg/constants"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -25,7 +28,7 @@ var _ = Describe("Garbage collector", func() {
 		})
 		Expect(err).ToNot(HaveOccurred())
 
-		gc := NewGarbageCollector(mgr, ctrl.Log.WithName("garbage collector"), 3*time.Second)
+		gc := NewGarbageCollector(mgr, ctrl.Log.WithName("garbage collector"), coilconfig.NewStore(coilconfig.Defaults{GCInterval: 3 * time.Second, RequestTTL: time.Minute}), nil, nil)
 		err = mgr.Add(gc)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -107,4 +110,48 @@ var _ = Describe("Garbage collector", func() {
 			return nil
 		}, 5).Should(Succeed())
 	})
+
+	It("should prune finished block requests", func() {
+		createRequest := func(name string, finished time.Time) {
+			req := &coilv2.BlockRequest{}
+			req.Name = name
+			req.Spec.NodeName = "node1"
+			req.Spec.PoolName = "default"
+			err := k8sClient.Create(ctx, req)
+			Expect(err).To(Succeed())
+
+			if finished.IsZero() {
+				return
+			}
+			req.Status.Conditions = []coilv2.BlockRequestCondition{
+				{
+					Type:               coilv2.BlockRequestComplete,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(finished),
+				},
+			}
+			err = k8sClient.Status().Update(ctx, req)
+			Expect(err).To(Succeed())
+		}
+
+		createRequest("old", time.Now().Add(-time.Hour))
+		createRequest("new", time.Now())
+		createRequest("pending", time.Time{})
+
+		Eventually(func() error {
+			reqs := &coilv2.BlockRequestList{}
+			err := k8sClient.List(ctx, reqs)
+			if err != nil {
+				return err
+			}
+			var names []string
+			for _, r := range reqs.Items {
+				names = append(names, r.Name)
+			}
+			if len(names) != 2 || names[0] != "new" || names[1] != "pending" {
+				return fmt.Errorf("unexpected requests: %v", names)
+			}
+			return nil
+		}, 5).Should(Succeed())
+	})
 })
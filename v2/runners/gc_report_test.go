@@ -0,0 +1,118 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/notify"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (n *recordingNotifier) Notify(ev notify.Event) {
+	n.events = append(n.events, ev)
+}
+
+func TestGarbageCollectorReport(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	dead := testBlock("default-1", "dead")
+	dead.Annotations = map[string]string{
+		constants.AnnReclaimable: now.Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "alive"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "dead"}},
+		testBlock("default-0", "alive"),
+		dead,
+		testBlock("default-2", "deleted"),
+		testBlock("default-3", "deleted"),
+	).Build()
+	notifier := &recordingNotifier{}
+	gc := &garbageCollector{
+		Client:    cl,
+		apiReader: cl,
+		log:       ctrl.Log.WithName("gc"),
+		config:    coilconfig.NewStore(coilconfig.Defaults{RequestTTL: time.Hour}),
+		notifier:  notifier,
+		firstSeen: make(map[string]time.Time),
+	}
+
+	rec := httptest.NewRecorder()
+	gc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/gc", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Error("report should not be available before collection", rec.Code)
+	}
+
+	if err := gc.do(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	gc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/gc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code)
+	}
+	report := &GCReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), report); err != nil {
+		t.Fatal(err)
+	}
+	if report.OrphanedBlocks != 3 || report.FreedBlocks != 2 {
+		t.Errorf("unexpected counts: %+v", report)
+	}
+	if report.Leaks["dead"] != 1 || report.Leaks["deleted"] != 2 || len(report.Leaks) != 2 {
+		t.Errorf("unexpected leaks: %v", report.Leaks)
+	}
+	if age := report.OldestOrphanAgeSeconds; age < 7199 || age > 7201 {
+		t.Errorf("unexpected oldest orphan age: %f", age)
+	}
+	if report.Error != "" {
+		t.Error("unexpected error:", report.Error)
+	}
+	if len(gc.firstSeen) != 0 {
+		t.Error("freed blocks should be forgotten:", gc.firstSeen)
+	}
+	var released []string
+	for _, ev := range notifier.events {
+		switch ev.Type {
+		case notify.EventBlockReleased:
+			released = append(released, ev.Block)
+		case notify.EventGarbageCollected:
+		default:
+			t.Error("unexpected event:", ev)
+		}
+	}
+	if len(released) != 2 || released[0] != "default-2" || released[1] != "default-3" {
+		t.Error("each freed block should be notified once:", released)
+	}
+
+	rec = httptest.NewRecorder()
+	gc.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status/gc", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Error("unexpected status for POST", rec.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// HeartbeatLeaseName returns the name of the Lease renewed by coild on `node`.
+func HeartbeatLeaseName(node string) string {
+	return "coild-" + node
+}
+
+// NewHeartbeat creates a manager.Runnable to renew the heartbeat Lease
+// of coild on `node` in `namespace` every `interval`.
+//
+// coil-controller detects nodes whose coild has stopped working by the Leases.
+func NewHeartbeat(c client.Client, namespace, node string, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &heartbeat{
+		client:    c,
+		namespace: namespace,
+		node:      node,
+		interval:  interval,
+		log:       log,
+	}
+}
+
+type heartbeat struct {
+	client    client.Client
+	namespace string
+	node      string
+	interval  time.Duration
+	log       logr.Logger
+}
+
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;create;update
+
+var _ manager.LeaderElectionRunnable = &heartbeat{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*heartbeat) NeedLeaderElection() bool {
+	return false
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (h *heartbeat) Start(ctx context.Context) error {
+	tick := time.NewTicker(h.interval)
+	defer tick.Stop()
+
+	for {
+		// errors are not fatal because the next heartbeat will retry.
+		if err := h.beat(ctx); err != nil {
+			h.log.Error(err, "failed to renew the heartbeat lease")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (h *heartbeat) beat(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(h.interval / time.Second)
+
+	lease := &coordinationv1.Lease{}
+	err := h.client.Get(ctx, client.ObjectKey{Namespace: h.namespace, Name: HeartbeatLeaseName(h.node)}, lease)
+	if apierrors.IsNotFound(err) {
+		lease.Namespace = h.namespace
+		lease.Name = HeartbeatLeaseName(h.node)
+		lease.Labels = map[string]string{
+			constants.LabelAppComponent: "coild",
+			constants.LabelNode:         h.node,
+		}
+		lease.Spec.HolderIdentity = &h.node
+		lease.Spec.LeaseDurationSeconds = &duration
+		lease.Spec.AcquireTime = &now
+		lease.Spec.RenewTime = &now
+		return h.client.Create(ctx, lease)
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &h.node
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	return h.client.Update(ctx, lease)
+}
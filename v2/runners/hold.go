@@ -0,0 +1,268 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultHoldTTL is the duration of a hold if Hold does not specify it.
+	DefaultHoldTTL = time.Minute
+
+	// MaxHoldTTL is the maximum duration of a hold.  Holds are meant to
+	// bridge the short time until a Pod is created.
+	MaxHoldTTL = 10 * time.Minute
+)
+
+// holdIface is the interface name for which held addresses are allocated.
+const holdIface = "hold"
+
+// heldAddresses is the addresses held for a Pod.
+type heldAddresses struct {
+	id      string
+	pool    string
+	ipv4    net.IP
+	ipv6    net.IP
+	expires time.Time
+	timer   *time.Timer
+}
+
+// pendingHold is a Hold request allocating addresses for a Pod.
+type pendingHold struct {
+	// done is closed when the request finishes.
+	done chan struct{}
+
+	// released is set if the hold is released or claimed before the addresses
+	// are allocated.  The request then frees the addresses.
+	released bool
+}
+
+// holdID returns the ID for which the addresses held for a Pod are allocated.
+// It never conflicts with container IDs or allocation IDs since they have no slashes.
+func holdID(podNS, podName string) string {
+	return "hold/" + podKey(podNS, podName)
+}
+
+func (h *heldAddresses) ips() []string {
+	var ips []string
+	if h.ipv4 != nil {
+		ips = append(ips, h.ipv4.String())
+	}
+	if h.ipv6 != nil {
+		ips = append(ips, h.ipv6.String())
+	}
+	return ips
+}
+
+func (h *heldAddresses) response() *cnirpc.HoldResponse {
+	return &cnirpc.HoldResponse{
+		Pool:    h.pool,
+		Ips:     h.ips(),
+		Expires: timestamppb.New(h.expires),
+	}
+}
+
+func (s *coildServer) Hold(ctx context.Context, req *cnirpc.HoldRequest) (*cnirpc.HoldResponse, error) {
+	logger := ctxzap.Extract(ctx).Sugar().With("pod.namespace", req.PodNamespace, "pod.name", req.PodName)
+
+	if req.PodNamespace == "" || req.PodName == "" {
+		return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES,
+			"missing pod name/namespace", "")
+	}
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	if ttl == 0 {
+		ttl = DefaultHoldTTL
+	}
+	if ttl < 0 || ttl > MaxHoldTTL {
+		return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG,
+			"invalid TTL", fmt.Sprintf("TTL must be between 1 and %d seconds", int(MaxHoldTTL.Seconds())))
+	}
+	key := podKey(req.PodNamespace, req.PodName)
+	if _, ok := s.addRecords.Load(key); ok {
+		return nil, newError(codes.FailedPrecondition, cnirpc.ErrorCode_UNKNOWN,
+			"pod has been set up", "")
+	}
+
+	// Allocate may wait for a new address block, so it is called without holdsMu,
+	// which every Add takes to claim the hold for its Pod.
+	var p *pendingHold
+	for p == nil {
+		s.holdsMu.Lock()
+		if h, ok := s.holds[key]; ok {
+			h.expires = time.Now().Add(ttl)
+			h.timer.Reset(ttl)
+			resp := h.response()
+			s.holdsMu.Unlock()
+			logger.Infow("extended hold", "ips", resp.Ips, "expires", resp.Expires.AsTime())
+			return resp, nil
+		}
+		other, ok := s.pending[key]
+		if !ok {
+			p = &pendingHold{done: make(chan struct{})}
+			s.pending[key] = p
+			s.holdsMu.Unlock()
+			continue
+		}
+		s.holdsMu.Unlock()
+
+		// wait for the concurrent Hold for the same Pod, then extend its hold.
+		select {
+		case <-other.done:
+		case <-ctx.Done():
+			return nil, newDeadlineError(ctx.Err(), "deadline exceeded while waiting for another hold")
+		}
+	}
+
+	h, err := s.allocateHold(ctx, logger, req.PodNamespace, req.PodName, ttl)
+
+	// the response is made while holdsMu is locked since a concurrent Hold
+	// may extend the hold once it is installed.
+	var resp *cnirpc.HoldResponse
+	s.holdsMu.Lock()
+	if err == nil && !p.released {
+		h.timer = time.AfterFunc(ttl, func() { s.expireHold(key, h) })
+		s.holds[key] = h
+		resp = h.response()
+	}
+	released := p.released
+	s.holdsMu.Unlock()
+
+	if err == nil && released {
+		// the addresses are freed before the reservation is removed since
+		// the next Hold for the Pod allocates them with the same ID.
+		if err := s.nodeIPAM.Free(ctx, h.id, holdIface); err != nil {
+			logger.Errorw("failed to free addresses of released hold", "error", err)
+		}
+		err = newError(codes.Aborted, cnirpc.ErrorCode_UNKNOWN, "hold has been released while allocating addresses", "")
+	}
+
+	s.holdsMu.Lock()
+	delete(s.pending, key)
+	s.holdsMu.Unlock()
+	close(p.done)
+
+	if err != nil {
+		return nil, err
+	}
+	logger.Infow("held addresses", "pool", resp.Pool, "ips", resp.Ips, "expires", resp.Expires.AsTime())
+	return resp, nil
+}
+
+// allocateHold allocates addresses for a Pod in the pool of its namespace.
+// The timer of the returned hold is not set.
+func (s *coildServer) allocateHold(ctx context.Context, logger *zap.SugaredLogger, podNS, podName string, ttl time.Duration) (*heldAddresses, error) {
+	ns := &corev1.Namespace{}
+	if err := s.client.Get(ctx, client.ObjectKey{Name: podNS}, ns); err != nil {
+		logger.Errorw("failed to get namespace", "error", err)
+		return nil, newInternalError(err, "failed to get namespace")
+	}
+	poolName, err := s.getPoolName(ctx, ns)
+	if err != nil {
+		logger.Errorw("failed to decide the pool", "error", err)
+		return nil, err
+	}
+
+	id := holdID(podNS, podName)
+	ipv4, ipv6, err := s.nodeIPAM.Allocate(ctx, poolName, id, holdIface)
+	if err != nil {
+		logger.Errorw("failed to allocate address", "error", err)
+		if ctx.Err() != nil {
+			return nil, newDeadlineError(err, "deadline exceeded while allocating address")
+		}
+		return nil, newInternalError(err, "failed to allocate address")
+	}
+
+	return &heldAddresses{
+		id:      id,
+		pool:    poolName,
+		ipv4:    ipv4,
+		ipv6:    ipv6,
+		expires: time.Now().Add(ttl),
+	}, nil
+}
+
+func (s *coildServer) ReleaseHold(ctx context.Context, req *cnirpc.ReleaseHoldRequest) (*emptypb.Empty, error) {
+	logger := ctxzap.Extract(ctx).Sugar().With("pod.namespace", req.PodNamespace, "pod.name", req.PodName)
+
+	h := s.takeHold(req.PodNamespace, req.PodName)
+	if h == nil {
+		return nil, newError(codes.NotFound, cnirpc.ErrorCode_UNKNOWN_CONTAINER,
+			"no addresses are held for the pod", "")
+	}
+	if err := s.nodeIPAM.Free(ctx, h.id, holdIface); err != nil {
+		logger.Errorw("failed to free held addresses", "error", err)
+		return nil, newInternalError(err, "failed to free held addresses")
+	}
+	logger.Infow("released hold", "ips", h.ips())
+	return &emptypb.Empty{}, nil
+}
+
+// takeHold removes the hold for a Pod and returns it, or nil if there is none.
+// If a Hold is allocating addresses for the Pod, it is told to free them.
+func (s *coildServer) takeHold(podNS, podName string) *heldAddresses {
+	key := podKey(podNS, podName)
+
+	s.holdsMu.Lock()
+	defer s.holdsMu.Unlock()
+
+	h, ok := s.holds[key]
+	if !ok {
+		if p, ok := s.pending[key]; ok {
+			p.released = true
+		}
+		return nil
+	}
+	h.timer.Stop()
+	delete(s.holds, key)
+	return h
+}
+
+// expireHold frees the addresses of `h` unless the hold has been taken or extended.
+func (s *coildServer) expireHold(key string, h *heldAddresses) {
+	s.holdsMu.Lock()
+	// the timer has been reset if the hold is extended after it fired.
+	if s.holds[key] != h || time.Now().Before(h.expires) {
+		s.holdsMu.Unlock()
+		return
+	}
+	delete(s.holds, key)
+	s.holdsMu.Unlock()
+
+	logger := s.logger.With(zap.String("pod", key))
+	if err := s.nodeIPAM.Free(context.Background(), h.id, holdIface); err != nil {
+		logger.Sugar().Errorw("failed to free expired hold", "error", err)
+		return
+	}
+	logger.Sugar().Infow("hold expired", "ips", h.ips())
+}
+
+// claimHold assigns the addresses held for a Pod to `(id, iface)` if they
+// are held in `poolName`.  Otherwise, the held addresses are freed.
+func (s *coildServer) claimHold(ctx context.Context, logger *zap.SugaredLogger, podNS, podName, poolName, id, iface string) {
+	h := s.takeHold(podNS, podName)
+	if h == nil {
+		return
+	}
+
+	if h.pool == poolName {
+		if _, _, ok := s.nodeIPAM.Transfer(h.id, holdIface, id, iface); ok {
+			logger.Infow("assigned held addresses", "ips", h.ips())
+			return
+		}
+	}
+	logger.Infow("freeing held addresses not assignable to the pod", "pool", h.pool, "ips", h.ips())
+	if err := s.nodeIPAM.Free(ctx, h.id, holdIface); err != nil {
+		logger.Errorw("failed to free held addresses", "error", err)
+	}
+}
@@ -0,0 +1,247 @@
+package runners
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type holdIPAM struct {
+	ipam.NodeIPAM
+
+	mu     sync.Mutex
+	next   byte
+	allocs map[string]net.IP
+}
+
+func (n *holdIPAM) Allocate(ctx context.Context, poolName, containerID, iface string) (net.IP, net.IP, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.next++
+	ip := net.IPv4(10, 1, 0, n.next)
+	n.allocs[containerID+"/"+iface] = ip
+	return ip, nil, nil
+}
+
+func (n *holdIPAM) Free(ctx context.Context, containerID, iface string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.allocs, containerID+"/"+iface)
+	return nil
+}
+
+func (n *holdIPAM) Transfer(fromID, fromIface, toID, toIface string) (net.IP, net.IP, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ip, ok := n.allocs[fromID+"/"+fromIface]
+	if !ok {
+		return nil, nil, false
+	}
+	delete(n.allocs, fromID+"/"+fromIface)
+	n.allocs[toID+"/"+toIface] = ip
+	return ip, nil, true
+}
+
+func (n *holdIPAM) get(key string) net.IP {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.allocs[key]
+}
+
+func TestHold(t *testing.T) {
+	t.Parallel()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Annotations: map[string]string{constants.AnnPool: "global"}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(ns).Build()
+	nodeIPAM := &holdIPAM{allocs: make(map[string]net.IP)}
+	s := &coildServer{
+		client:   cl,
+		nodeIPAM: nodeIPAM,
+		logger:   zap.NewNop(),
+		holds:    make(map[string]*heldAddresses),
+		pending:  make(map[string]*pendingHold),
+	}
+	ctx := context.Background()
+
+	_, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod1", TtlSeconds: 3600})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Error("too long TTL should be refused:", err)
+	}
+
+	res, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pool != "global" || len(res.Ips) != 1 || res.Ips[0] != "10.1.0.1" {
+		t.Error("unexpected hold:", res)
+	}
+	if d := time.Until(res.Expires.AsTime()); d <= 0 || d > DefaultHoldTTL {
+		t.Error("unexpected expiry:", res.Expires.AsTime())
+	}
+
+	res, err = s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod1", TtlSeconds: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Ips[0] != "10.1.0.1" || time.Until(res.Expires.AsTime()) <= DefaultHoldTTL {
+		t.Error("holding again should extend the hold:", res)
+	}
+
+	// the addresses held in the pool of the Pod are assigned to it.
+	s.claimHold(ctx, zap.NewNop().Sugar(), "ns1", "pod1", "global", "c1", "eth0")
+	if ip := nodeIPAM.get("c1/eth0"); !ip.Equal(net.ParseIP("10.1.0.1")) {
+		t.Error("held address is not assigned:", ip)
+	}
+	if _, err := s.ReleaseHold(ctx, &cnirpc.ReleaseHoldRequest{PodNamespace: "ns1", PodName: "pod1"}); status.Code(err) != codes.NotFound {
+		t.Error("claimed hold should be gone:", err)
+	}
+
+	// the addresses held in another pool are freed.
+	if _, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod2"}); err != nil {
+		t.Fatal(err)
+	}
+	s.claimHold(ctx, zap.NewNop().Sugar(), "ns1", "pod2", "default", "c2", "eth0")
+	if nodeIPAM.get("c2/eth0") != nil || nodeIPAM.get(holdID("ns1", "pod2")+"/"+holdIface) != nil {
+		t.Error("hold in another pool should be freed")
+	}
+
+	if _, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod3"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReleaseHold(ctx, &cnirpc.ReleaseHoldRequest{PodNamespace: "ns1", PodName: "pod3"}); err != nil {
+		t.Error(err)
+	}
+	if nodeIPAM.get(holdID("ns1", "pod3")+"/"+holdIface) != nil {
+		t.Error("released hold should be freed")
+	}
+
+	// expiry
+	if _, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod4", TtlSeconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if nodeIPAM.get(holdID("ns1", "pod4")+"/"+holdIface) != nil {
+		t.Error("expired hold should be freed")
+	}
+	if _, err := s.ReleaseHold(ctx, &cnirpc.ReleaseHoldRequest{PodNamespace: "ns1", PodName: "pod4"}); status.Code(err) != codes.NotFound {
+		t.Error("expired hold should be gone:", err)
+	}
+
+	s.addRecords.Store(podKey("ns1", "pod5"), addRecord{containerID: "c5", allocID: "c5", ifname: "eth0"})
+	if _, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "pod5"}); status.Code(err) != codes.FailedPrecondition {
+		t.Error("holding for a Pod set up should be refused:", err)
+	}
+}
+
+// blockingHoldIPAM is holdIPAM whose Allocate blocks until `unblock` is closed.
+type blockingHoldIPAM struct {
+	*holdIPAM
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (n *blockingHoldIPAM) Allocate(ctx context.Context, poolName, containerID, iface string) (net.IP, net.IP, error) {
+	n.started <- struct{}{}
+	<-n.unblock
+	return n.holdIPAM.Allocate(ctx, poolName, containerID, iface)
+}
+
+func TestHoldConcurrency(t *testing.T) {
+	t.Parallel()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Annotations: map[string]string{constants.AnnPool: "global"}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(ns).Build()
+	newServer := func() (*coildServer, *blockingHoldIPAM) {
+		nodeIPAM := &blockingHoldIPAM{
+			holdIPAM: &holdIPAM{allocs: make(map[string]net.IP)},
+			started:  make(chan struct{}, 2),
+			unblock:  make(chan struct{}),
+		}
+		return &coildServer{
+			client:   cl,
+			nodeIPAM: nodeIPAM,
+			logger:   zap.NewNop(),
+			holds:    make(map[string]*heldAddresses),
+			pending:  make(map[string]*pendingHold),
+		}, nodeIPAM
+	}
+	ctx := context.Background()
+
+	type result struct {
+		res *cnirpc.HoldResponse
+		err error
+	}
+	hold := func(s *coildServer, podName string) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			res, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: podName})
+			ch <- result{res, err}
+		}()
+		return ch
+	}
+
+	// a Hold waiting for Allocate does not block claiming holds of other Pods.
+	s, nodeIPAM := newServer()
+	first := hold(s, "pod1")
+	<-nodeIPAM.started
+	claimed := make(chan struct{})
+	go func() {
+		s.claimHold(ctx, zap.NewNop().Sugar(), "ns1", "pod2", "global", "c2", "eth0")
+		close(claimed)
+	}()
+	select {
+	case <-claimed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("claimHold is blocked by Hold for another Pod")
+	}
+
+	// a concurrent Hold for the same Pod waits for the first one and extends its hold.
+	second := hold(s, "pod1")
+	time.Sleep(100 * time.Millisecond)
+	close(nodeIPAM.unblock)
+	r1, r2 := <-first, <-second
+	if r1.err != nil || r2.err != nil {
+		t.Fatal(r1.err, r2.err)
+	}
+	if len(r1.res.Ips) != 1 || len(r2.res.Ips) != 1 || r1.res.Ips[0] != r2.res.Ips[0] {
+		t.Error("concurrent Holds should share the addresses:", r1.res, r2.res)
+	}
+	if len(nodeIPAM.started) != 0 {
+		t.Error("the second Hold should not allocate addresses")
+	}
+
+	// releasing the hold while Hold is allocating addresses frees them.
+	s, nodeIPAM = newServer()
+	third := hold(s, "pod3")
+	<-nodeIPAM.started
+	if _, err := s.ReleaseHold(ctx, &cnirpc.ReleaseHoldRequest{PodNamespace: "ns1", PodName: "pod3"}); status.Code(err) != codes.NotFound {
+		t.Error("no addresses should be held yet:", err)
+	}
+	close(nodeIPAM.unblock)
+	if r := <-third; status.Code(r.err) != codes.Aborted {
+		t.Error("Hold should be aborted by the release:", r.err)
+	}
+	if nodeIPAM.get(holdID("ns1", "pod3")+"/"+holdIface) != nil {
+		t.Error("addresses of the released hold should be freed")
+	}
+	if _, err := s.ReleaseHold(ctx, &cnirpc.ReleaseHoldRequest{PodNamespace: "ns1", PodName: "pod3"}); status.Code(err) != codes.NotFound {
+		t.Error("aborted hold should not be installed:", err)
+	}
+}
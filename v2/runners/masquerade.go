@@ -0,0 +1,86 @@
+package runners
+
+import (
+	"context"
+	"net"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// NewMasqueradeSyncer creates a manager.Runnable to keep the masquerade rules
+// for pools that have Masquerade enabled.
+//
+// The rules are synchronized every `interval`.
+func NewMasqueradeSyncer(r client.Reader, masq nodenet.Masquerader, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &masqueradeSyncer{
+		reader:   r,
+		masq:     masq,
+		interval: interval,
+		log:      log,
+	}
+}
+
+type masqueradeSyncer struct {
+	reader   client.Reader
+	masq     nodenet.Masquerader
+	interval time.Duration
+	log      logr.Logger
+}
+
+var _ manager.LeaderElectionRunnable = &masqueradeSyncer{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*masqueradeSyncer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (s *masqueradeSyncer) Start(ctx context.Context) error {
+	tick := time.NewTicker(s.interval)
+	defer tick.Stop()
+
+	for {
+		if err := s.sync(ctx); err != nil {
+			s.log.Error(err, "failed to synchronize masquerade rules")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (s *masqueradeSyncer) sync(ctx context.Context) error {
+	pools := &coilv2.AddressPoolList{}
+	if err := s.reader.List(ctx, pools); err != nil {
+		return err
+	}
+
+	var sources, exclude []*net.IPNet
+	for _, p := range pools.Items {
+		for _, ss := range p.Spec.Subnets {
+			for _, cidr := range []*string{ss.IPv4, ss.IPv6} {
+				if cidr == nil {
+					continue
+				}
+				_, n, err := net.ParseCIDR(*cidr)
+				if err != nil {
+					s.log.Error(err, "ignoring invalid subnet", "pool", p.Name, "subnet", *cidr)
+					continue
+				}
+				exclude = append(exclude, n)
+				if p.Spec.Masquerade {
+					sources = append(sources, n)
+				}
+			}
+		}
+	}
+	return s.masq.Sync(sources, exclude)
+}
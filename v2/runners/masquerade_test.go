@@ -0,0 +1,64 @@
+package runners
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type mockMasquerader struct {
+	sources []string
+	exclude []string
+}
+
+func (m *mockMasquerader) Sync(sources, exclude []*net.IPNet) error {
+	m.sources = nil
+	for _, n := range sources {
+		m.sources = append(m.sources, n.String())
+	}
+	m.exclude = nil
+	for _, n := range exclude {
+		m.exclude = append(m.exclude, n.String())
+	}
+	return nil
+}
+
+func (m *mockMasquerader) Cleanup() error {
+	return nil
+}
+
+func TestMasqueradeSyncer(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	private := &coilv2.AddressPool{}
+	private.Name = "default"
+	private.Spec.Masquerade = true
+	private.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.100.0.0/16"), IPv6: strPtr("fd00::/112")}}
+	global := &coilv2.AddressPool{}
+	global.Name = "global"
+	global.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("192.0.2.0/24")}}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(private, global).Build()
+
+	masq := &mockMasquerader{}
+	syncer := NewMasqueradeSyncer(cl, masq, time.Minute, ctrl.Log.WithName("masquerade-syncer")).(*masqueradeSyncer)
+	if err := syncer.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(masq.sources) != 2 || masq.sources[0] != "10.100.0.0/16" || masq.sources[1] != "fd00::/112" {
+		t.Error("unexpected sources:", masq.sources)
+	}
+	if len(masq.exclude) != 3 {
+		t.Error("unexpected excluded destinations:", masq.exclude)
+	}
+}
@@ -0,0 +1,161 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var sweptStragglers = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "namespace_stragglers_freed_total",
+		Help:      "the number of interfaces of Pods in deleted namespaces freed without DEL",
+	},
+)
+
+func init() {
+	metrics.Registry.MustRegister(sweptStragglers)
+}
+
+// errSweepReadOnly is returned by SweepNamespace in read-only mode.
+var errSweepReadOnly = errors.New("read-only mode is enabled")
+
+// SweepNamespace frees the addresses that remain for Pods in a deleted
+// namespace, and returns the number of freed interfaces and holds.
+//
+// Pods that still exist are skipped.  The addresses are located by the
+// record of Add kept since coild started, so stragglers set up before the
+// restart of coild are not found.
+func (s *coildServer) SweepNamespace(ctx context.Context, namespace string) (int, error) {
+	if s.readOnly != nil && s.readOnly.Enabled() {
+		return 0, errSweepReadOnly
+	}
+	resp, err := s.sweepNamespace(ctx, namespace, false)
+	return len(resp.Pods), err
+}
+
+// FreeNamespace frees the addresses of Pods in a namespace that have gone
+// without DEL, e.g. after the namespace was deleted with Pods removed forcibly.
+func (s *coildServer) FreeNamespace(ctx context.Context, req *cnirpc.FreeNamespaceRequest) (*cnirpc.FreeNamespaceResponse, error) {
+	logger := ctxzap.Extract(ctx).Sugar().With("pod.namespace", req.PodNamespace)
+
+	if req.PodNamespace == "" {
+		return nil, newError(codes.InvalidArgument, cnirpc.ErrorCode_INVALID_ENVIRONMENT_VARIABLES,
+			"missing pod namespace", "")
+	}
+	resp, err := s.sweepNamespace(ctx, req.PodNamespace, req.DryRun)
+	if err != nil {
+		logger.Errorw("failed to free addresses of the namespace", "error", err)
+		return nil, newInternalError(err, "failed to free addresses of the namespace")
+	}
+	return resp, nil
+}
+
+// sweepNamespace frees the addresses of Pods in `namespace` that do not exist.
+// If `dryRun` is true, it only locates the addresses.
+//
+// The returned response lists the freed addresses even if an error occurs.
+func (s *coildServer) sweepNamespace(ctx context.Context, namespace string, dryRun bool) (*cnirpc.FreeNamespaceResponse, error) {
+	logger := s.logger.Sugar().With("pod.namespace", namespace)
+	prefix := podKey(namespace, "")
+	resp := &cnirpc.FreeNamespaceResponse{Freed: !dryRun}
+
+	records := make(map[string]addRecord)
+	var keys []string
+	s.addRecords.Range(func(k, v interface{}) bool {
+		if key := k.(string); strings.HasPrefix(key, prefix) {
+			records[key] = v.(addRecord)
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sort.Strings(keys)
+
+	if len(records) > 0 {
+		confs, err := s.podNet.List()
+		if err != nil {
+			return resp, fmt.Errorf("failed to list pod networks: %w", err)
+		}
+		for _, key := range keys {
+			r := records[key]
+			podName := strings.TrimPrefix(key, prefix)
+			err := s.apiReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: podName}, &corev1.Pod{})
+			switch {
+			case err == nil:
+				resp.SkippedPods = append(resp.SkippedPods, podName)
+				continue
+			case !apierrors.IsNotFound(err):
+				return resp, fmt.Errorf("failed to get pod %s: %w", key, err)
+			}
+
+			freed := &cnirpc.FreedPod{PodName: podName, ContainerId: r.containerID, Ifname: r.ifname}
+			conf := findPodNetConf(confs, &r, nil)
+			if conf != nil {
+				freed.Pool = conf.PoolName
+				freed.Ips = podNetConfIPs(conf)
+			}
+			if dryRun {
+				resp.Pods = append(resp.Pods, freed)
+				continue
+			}
+
+			if conf != nil {
+				if err := s.podNet.Destroy(conf.ContainerId, conf.IFace); err != nil {
+					return resp, fmt.Errorf("failed to destroy pod network of %s: %w", key, err)
+				}
+			}
+			if err := s.nodeIPAM.Free(ctx, r.allocID, r.ifname); err != nil {
+				return resp, fmt.Errorf("failed to free addresses of %s: %w", key, err)
+			}
+			s.addRecords.Delete(key)
+			if s.churn != nil {
+				s.churn.Freed(r.allocID)
+			}
+			sweptStragglers.Inc()
+			resp.Pods = append(resp.Pods, freed)
+			logger.Infow("freed addresses of a pod in a deleted namespace", "pod.name", podName, "container_id", r.containerID, "ifname", r.ifname)
+		}
+	}
+
+	s.holdsMu.Lock()
+	held := make(map[string]*heldAddresses)
+	var heldNames []string
+	for key, h := range s.holds {
+		if strings.HasPrefix(key, prefix) {
+			name := strings.TrimPrefix(key, prefix)
+			held[name] = h
+			heldNames = append(heldNames, name)
+		}
+	}
+	s.holdsMu.Unlock()
+	sort.Strings(heldNames)
+
+	for _, podName := range heldNames {
+		h := held[podName]
+		if !dryRun {
+			if h = s.takeHold(namespace, podName); h == nil {
+				continue
+			}
+			if err := s.nodeIPAM.Free(ctx, h.id, holdIface); err != nil {
+				return resp, fmt.Errorf("failed to free addresses held for %s: %w", podKey(namespace, podName), err)
+			}
+			logger.Infow("released hold for a pod in a deleted namespace", "pod.name", podName, "ips", h.ips())
+		}
+		resp.Pods = append(resp.Pods, &cnirpc.FreedPod{PodName: podName, Pool: h.pool, Ifname: holdIface, Ips: h.ips()})
+	}
+	return resp, nil
+}
@@ -0,0 +1,114 @@
+package runners
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSweepNamespace(t *testing.T) {
+	t.Parallel()
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}}
+	alive := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "alive"}}
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(ns, alive).Build()
+	nodeIPAM := &holdIPAM{allocs: make(map[string]net.IP)}
+	podNet := &mockPodNetwork{confs: []*nodenet.PodNetConf{
+		{ContainerId: "c1", IFace: "eth0", IPv4: net.ParseIP("10.1.0.101")},
+		{ContainerId: "c2", IFace: "eth0", IPv4: net.ParseIP("10.1.0.102")},
+		{ContainerId: "c3", IFace: "eth0", IPv4: net.ParseIP("10.1.0.103")},
+	}}
+	readOnly := NewReadOnlyMode(false, logr.Discard())
+	s := &coildServer{
+		apiReader: cl,
+		client:    cl,
+		nodeIPAM:  nodeIPAM,
+		podNet:    podNet,
+		readOnly:  readOnly,
+		logger:    zap.NewNop(),
+		holds:     make(map[string]*heldAddresses),
+		pending:   make(map[string]*pendingHold),
+	}
+	ctx := context.Background()
+
+	for i, r := range []struct{ ns, pod, id string }{
+		{"ns1", "gone", "c1"},
+		{"ns1", "alive", "c2"},
+		{"ns10", "gone", "c3"},
+	} {
+		nodeIPAM.allocs[r.id+"/eth0"] = net.IPv4(10, 1, 0, byte(101+i))
+		s.addRecords.Store(podKey(r.ns, r.pod), addRecord{containerID: r.id, allocID: r.id, ifname: "eth0"})
+	}
+	if _, err := s.Hold(ctx, &cnirpc.HoldRequest{PodNamespace: "ns1", PodName: "later"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.FreeNamespace(ctx, &cnirpc.FreeNamespaceRequest{PodNamespace: "ns1", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Freed || len(resp.Pods) != 2 || len(resp.SkippedPods) != 1 || resp.SkippedPods[0] != "alive" {
+		t.Error("unexpected response of dry run:", resp)
+	}
+	if p := resp.Pods[0]; p.PodName != "gone" || p.ContainerId != "c1" || len(p.Ips) != 1 || p.Ips[0] != "10.1.0.101" {
+		t.Error("unexpected freed pod:", p)
+	}
+	if p := resp.Pods[1]; p.PodName != "later" || p.Ifname != holdIface || len(p.Ips) != 1 {
+		t.Error("unexpected held pod:", p)
+	}
+	if nodeIPAM.get("c1/eth0") == nil || podNet.nDestroy != 0 {
+		t.Error("dry run should free nothing")
+	}
+	if _, err := s.FreeNamespace(ctx, &cnirpc.FreeNamespaceRequest{}); err == nil {
+		t.Error("freeing without namespace should fail")
+	}
+
+	readOnly.Set(true)
+	if _, err := s.SweepNamespace(ctx, "ns1"); err == nil {
+		t.Error("sweeping should be refused in read-only mode")
+	}
+	readOnly.Set(false)
+
+	n, err := s.SweepNamespace(ctx, "ns1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Error("unexpected number of freed interfaces:", n)
+	}
+	if podNet.nDestroy != 1 {
+		t.Error("unexpected number of destroyed pod networks:", podNet.nDestroy)
+	}
+	if nodeIPAM.get("c1/eth0") != nil {
+		t.Error("addresses of a missing pod should be freed")
+	}
+	if nodeIPAM.get("c2/eth0") == nil {
+		t.Error("addresses of an existing pod should be kept")
+	}
+	if nodeIPAM.get("c3/eth0") == nil {
+		t.Error("addresses of a pod in another namespace should be kept")
+	}
+	if nodeIPAM.get(holdID("ns1", "later")+"/"+holdIface) != nil {
+		t.Error("held addresses should be freed")
+	}
+	if _, ok := s.addRecords.Load(podKey("ns1", "gone")); ok {
+		t.Error("the record of the freed pod should be removed")
+	}
+
+	n, err = s.SweepNamespace(ctx, "ns1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("sweeping again should free nothing:", n)
+	}
+}
@@ -0,0 +1,138 @@
+package runners
+
+import (
+	"context"
+	"net"
+	"time"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// NeighborProxySyncer keeps proxy ARP/NDP entries for Pods whose pools
+// have ProxyNeighbors enabled.
+type NeighborProxySyncer interface {
+	manager.Runnable
+
+	// PodNetwork returns a nodenet.PodNetwork that wraps `podNet` and
+	// triggers synchronization when a Pod network is set up or destroyed.
+	PodNetwork(podNet nodenet.PodNetwork) nodenet.PodNetwork
+}
+
+// NewNeighborProxySyncer creates a NeighborProxySyncer.
+//
+// The entries are synchronized when a Pod network is set up or destroyed,
+// and every `interval` to recover from failures.
+func NewNeighborProxySyncer(r client.Reader, podNet nodenet.PodNetwork, proxy nodenet.NeighborProxy, interval time.Duration, log logr.Logger) NeighborProxySyncer {
+	return &neighborProxySyncer{
+		reader:   r,
+		podNet:   podNet,
+		proxy:    proxy,
+		interval: interval,
+		log:      log,
+		notifyCh: make(chan struct{}, 1),
+	}
+}
+
+type neighborProxySyncer struct {
+	reader   client.Reader
+	podNet   nodenet.PodNetwork
+	proxy    nodenet.NeighborProxy
+	interval time.Duration
+	log      logr.Logger
+	notifyCh chan struct{}
+}
+
+var _ manager.LeaderElectionRunnable = &neighborProxySyncer{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*neighborProxySyncer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (s *neighborProxySyncer) Start(ctx context.Context) error {
+	tick := time.NewTicker(s.interval)
+	defer tick.Stop()
+
+	for {
+		if err := s.sync(ctx); err != nil {
+			s.log.Error(err, "failed to synchronize proxy neighbors")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		case <-s.notifyCh:
+		}
+	}
+}
+
+func (s *neighborProxySyncer) notify() {
+	select {
+	case s.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *neighborProxySyncer) sync(ctx context.Context) error {
+	pools := &coilv2.AddressPoolList{}
+	if err := s.reader.List(ctx, pools); err != nil {
+		return err
+	}
+	proxied := make(map[string]bool)
+	for _, p := range pools.Items {
+		if p.Spec.ProxyNeighbors {
+			proxied[p.Name] = true
+		}
+	}
+
+	confs, err := s.podNet.List()
+	if err != nil {
+		return err
+	}
+
+	var ips []net.IP
+	for _, c := range confs {
+		if !proxied[c.PoolName] {
+			continue
+		}
+		if c.IPv4 != nil {
+			ips = append(ips, c.IPv4)
+		}
+		if c.IPv6 != nil {
+			ips = append(ips, c.IPv6)
+		}
+	}
+	return s.proxy.Sync(ips)
+}
+
+func (s *neighborProxySyncer) PodNetwork(podNet nodenet.PodNetwork) nodenet.PodNetwork {
+	return &notifyingPodNetwork{PodNetwork: podNet, notify: s.notify}
+}
+
+type notifyingPodNetwork struct {
+	nodenet.PodNetwork
+	notify func()
+}
+
+func (n *notifyingPodNetwork) Setup(nsPath, podName, podNS string, conf *nodenet.PodNetConf, hook nodenet.SetupHook) (*current.Result, error) {
+	result, err := n.PodNetwork.Setup(nsPath, podName, podNS, conf, hook)
+	if err == nil {
+		n.notify()
+	}
+	return result, err
+}
+
+func (n *notifyingPodNetwork) Destroy(containerId, iface string) error {
+	err := n.PodNetwork.Destroy(containerId, iface)
+	if err == nil {
+		n.notify()
+	}
+	return err
+}
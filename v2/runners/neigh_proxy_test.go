@@ -0,0 +1,80 @@
+package runners
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type mockNeighborProxy struct {
+	ips []string
+}
+
+func (p *mockNeighborProxy) Sync(ips []net.IP) error {
+	p.ips = nil
+	for _, ip := range ips {
+		p.ips = append(p.ips, ip.String())
+	}
+	sort.Strings(p.ips)
+	return nil
+}
+
+func TestNeighborProxySyncer(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	proxied := &coilv2.AddressPool{}
+	proxied.Name = "flat"
+	proxied.Spec.ProxyNeighbors = true
+	routed := &coilv2.AddressPool{}
+	routed.Name = "default"
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(proxied, routed).Build()
+
+	podNet := &mockPodNetwork{
+		confs: []*nodenet.PodNetConf{
+			{PoolName: "flat", ContainerId: "c1", IFace: "eth0", IPv4: net.ParseIP("10.2.0.1"), IPv6: net.ParseIP("fd02::1")},
+			{PoolName: "default", ContainerId: "c2", IFace: "eth0", IPv4: net.ParseIP("10.100.0.1")},
+		},
+	}
+	proxy := &mockNeighborProxy{}
+	syncer := NewNeighborProxySyncer(cl, podNet, proxy, time.Minute, ctrl.Log.WithName("neighbor-proxy-syncer")).(*neighborProxySyncer)
+
+	if err := syncer.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxy.ips) != 2 || proxy.ips[0] != "10.2.0.1" || proxy.ips[1] != "fd02::1" {
+		t.Error("unexpected proxied addresses:", proxy.ips)
+	}
+
+	wrapped := syncer.PodNetwork(podNet)
+	if err := wrapped.Destroy("c1", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if podNet.nDestroy != 1 {
+		t.Error("Destroy should be delegated")
+	}
+	select {
+	case <-syncer.notifyCh:
+	default:
+		t.Error("Destroy should trigger synchronization")
+	}
+
+	podNet.errDestroy = true
+	wrapped.Destroy("c1", "eth0")
+	select {
+	case <-syncer.notifyCh:
+		t.Error("failed Destroy should not trigger synchronization")
+	default:
+	}
+}
@@ -0,0 +1,114 @@
+package runners
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var networkProbeCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "network_probes_total",
+		Help:      "the number of probes of Pod networks after setup",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(networkProbeCounter)
+}
+
+// Reasons of Events recorded by NetworkProber.
+const (
+	EventNetworkReachable   = "NetworkReachable"
+	EventNetworkUnreachable = "NetworkUnreachable"
+)
+
+// NetworkProber verifies the reachability of Pod networks just after setup.
+type NetworkProber interface {
+	// Probe sends ICMP echo requests from the network namespace `netns` of `pod`
+	// in the background, and records the result as an Event of `pod`.
+	//
+	// `targets` are the addresses to probe.  If nil, the default targets
+	// of the prober are used.  Only the targets of the address families of
+	// `ipv4` and `ipv6` are probed.
+	Probe(pod *corev1.Pod, netns string, ipv4, ipv6 net.IP, targets []net.IP)
+}
+
+// NewNetworkProber creates a NetworkProber.  `defaults` are the targets to
+// probe if none are given to Probe, e.g. the node addresses that are the
+// gateways of Pods on the routed datapath.
+func NewNetworkProber(recorder record.EventRecorder, defaults []net.IP, timeout time.Duration, log logr.Logger) NetworkProber {
+	return &networkProber{
+		recorder: recorder,
+		defaults: defaults,
+		timeout:  timeout,
+		log:      log,
+		ping:     nodenet.Ping,
+	}
+}
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+type networkProber struct {
+	recorder record.EventRecorder
+	defaults []net.IP
+	timeout  time.Duration
+	log      logr.Logger
+	ping     func(nsPath string, target net.IP, timeout time.Duration) error
+}
+
+func (p *networkProber) Probe(pod *corev1.Pod, netns string, ipv4, ipv6 net.IP, targets []net.IP) {
+	if targets == nil {
+		targets = p.defaults
+	}
+
+	var filtered []net.IP
+	for _, t := range targets {
+		if (t.To4() != nil && ipv4 != nil) || (t.To4() == nil && ipv6 != nil) {
+			filtered = append(filtered, t)
+		}
+	}
+	if len(filtered) == 0 {
+		return
+	}
+
+	go p.probe(pod, netns, filtered)
+}
+
+func (p *networkProber) probe(pod *corev1.Pod, netns string, targets []net.IP) {
+	log := p.log.WithValues("pod", pod.Namespace+"/"+pod.Name)
+
+	var reached, failures []string
+	for _, t := range targets {
+		if err := p.ping(netns, t, p.timeout); err != nil {
+			log.Error(err, "pod network is unreachable", "target", t.String())
+			failures = append(failures, fmt.Sprintf("%s: %v", t, err))
+			continue
+		}
+		reached = append(reached, t.String())
+	}
+
+	if len(failures) > 0 {
+		networkProbeCounter.WithLabelValues("unreachable").Inc()
+		p.recorder.Eventf(pod, corev1.EventTypeWarning, EventNetworkUnreachable,
+			"Pod network failed to reach %s", strings.Join(failures, ", "))
+		return
+	}
+
+	networkProbeCounter.WithLabelValues("reachable").Inc()
+	log.V(1).Info("pod network is reachable", "targets", reached)
+	p.recorder.Eventf(pod, corev1.EventTypeNormal, EventNetworkReachable,
+		"Pod network reached %s", strings.Join(reached, ", "))
+}
@@ -0,0 +1,61 @@
+package runners
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestNetworkProber(t *testing.T) {
+	t.Parallel()
+
+	recorder := record.NewFakeRecorder(10)
+	p := NewNetworkProber(recorder, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")},
+		time.Second, ctrl.Log.WithName("network-prober")).(*networkProber)
+	pinged := make(chan string, 10)
+	p.ping = func(nsPath string, target net.IP, timeout time.Duration) error {
+		pinged <- nsPath + " " + target.String()
+		if target.Equal(net.ParseIP("192.168.0.1")) {
+			return errors.New("no echo reply")
+		}
+		return nil
+	}
+
+	pod := &corev1.Pod{}
+	pod.Namespace = "ns1"
+	pod.Name = "pod1"
+
+	// the default targets of the families of the Pod are probed.
+	p.Probe(pod, "/run/netns/pod1", net.ParseIP("10.1.0.1"), nil, nil)
+	ev := <-recorder.Events
+	if !strings.HasPrefix(ev, "Normal NetworkReachable") || !strings.Contains(ev, "10.0.0.1") {
+		t.Error("unexpected event:", ev)
+	}
+	if s := <-pinged; s != "/run/netns/pod1 10.0.0.1" {
+		t.Error("unexpected ping:", s)
+	}
+	if len(pinged) != 0 {
+		t.Error("IPv6 targets should not be probed")
+	}
+
+	// given targets are probed instead.
+	p.Probe(pod, "/run/netns/pod1", net.ParseIP("10.1.0.1"), net.ParseIP("fd01::1"), []net.IP{net.ParseIP("192.168.0.1")})
+	ev = <-recorder.Events
+	if !strings.HasPrefix(ev, "Warning NetworkUnreachable") || !strings.Contains(ev, "192.168.0.1") {
+		t.Error("unexpected event:", ev)
+	}
+
+	// nothing is probed without targets.
+	p.Probe(pod, "/run/netns/pod1", net.ParseIP("10.1.0.1"), nil, []net.IP{})
+	select {
+	case ev := <-recorder.Events:
+		t.Error("unexpected event:", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,189 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxNodeErrors is the number of errors kept for NodeStatus RPC.
+const maxNodeErrors = 20
+
+// NodeStatusReporter reports the address blocks of the node and their routes
+// for NodeStatus RPC.
+type NodeStatusReporter interface {
+	// Report fills the node name, blocks, and exported routes of `resp`.
+	Report(ctx context.Context, resp *cnirpc.NodeStatusResponse) error
+}
+
+// NewNodeStatusReporter creates a NodeStatusReporter.
+//
+// The blocks are read from the API server, and the addresses allocated
+// from them are counted from the Pod networks configured by coild.
+func NewNodeStatusReporter(apiReader client.Reader, podNet nodenet.PodNetwork, exporter nodenet.RouteExporter, nodeName string) NodeStatusReporter {
+	return &nodeStatusReporter{
+		apiReader: apiReader,
+		podNet:    podNet,
+		exporter:  exporter,
+		nodeName:  nodeName,
+	}
+}
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=list
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=list
+
+type nodeStatusReporter struct {
+	apiReader client.Reader
+	podNet    nodenet.PodNetwork
+	exporter  nodenet.RouteExporter
+	nodeName  string
+}
+
+func (r *nodeStatusReporter) Report(ctx context.Context, resp *cnirpc.NodeStatusResponse) error {
+	resp.Node = r.nodeName
+
+	blocks := &coilv2.AddressBlockList{}
+	if err := r.apiReader.List(ctx, blocks, client.MatchingLabels{constants.LabelNode: r.nodeName}); err != nil {
+		return fmt.Errorf("failed to list AddressBlock: %w", err)
+	}
+	pools := &coilv2.AddressPoolList{}
+	if err := r.apiReader.List(ctx, pools); err != nil {
+		return fmt.Errorf("failed to list AddressPool: %w", err)
+	}
+	blockSizes := make(map[string]int)
+	for _, p := range pools.Items {
+		blockSizes[p.Name] = int(p.Spec.BlockSizeBits)
+	}
+
+	confs, err := r.podNet.List()
+	if err != nil {
+		return fmt.Errorf("failed to list pod networks: %w", err)
+	}
+	var podIPs []net.IP
+	for _, c := range confs {
+		for _, ip := range podNetConfIPs(c) {
+			podIPs = append(podIPs, net.ParseIP(ip))
+		}
+	}
+
+	exported := make(map[string]bool)
+	if r.exporter != nil {
+		nets, err := r.exporter.List()
+		if err != nil {
+			return fmt.Errorf("failed to list exported routes: %w", err)
+		}
+		for _, n := range nets {
+			exported[n.String()] = true
+			resp.ExportedRoutes = append(resp.ExportedRoutes, n.String())
+		}
+		sort.Strings(resp.ExportedRoutes)
+	}
+
+	for _, b := range blocks.Items {
+		nb := &cnirpc.NodeBlock{
+			Name:          b.Name,
+			Pool:          b.Labels[constants.LabelPool],
+			Quarantined:   b.Labels[constants.LabelQuarantined] == "true",
+			RouteExported: true,
+		}
+		if bits, ok := blockSizes[nb.Pool]; ok {
+			nb.Capacity = uint32(ipam.BlockCapacity(bits))
+		}
+
+		// In a dual-stack block, an index is shared by the IPv4 and IPv6
+		// addresses of a Pod, so counting one of the families is enough.
+		counted := false
+		for _, s := range []*string{b.IPv4, b.IPv6} {
+			if s == nil {
+				continue
+			}
+			_, n, err := net.ParseCIDR(*s)
+			if err != nil {
+				continue
+			}
+			nb.Subnets = append(nb.Subnets, n.String())
+			if !exported[n.String()] {
+				nb.RouteExported = false
+			}
+			if counted {
+				continue
+			}
+			counted = true
+			for _, ip := range podIPs {
+				if n.Contains(ip) {
+					nb.Allocated++
+				}
+			}
+		}
+		resp.Blocks = append(resp.Blocks, nb)
+	}
+	sort.Slice(resp.Blocks, func(i, j int) bool { return resp.Blocks[i].Name < resp.Blocks[j].Name })
+	return nil
+}
+
+// nodeErrors keeps the last errors returned by coild.
+type nodeErrors struct {
+	mu     sync.Mutex
+	errors []*cnirpc.NodeError
+}
+
+func (e *nodeErrors) record(ne *cnirpc.NodeError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errors = append(e.errors, ne)
+	if len(e.errors) > maxNodeErrors {
+		e.errors = e.errors[len(e.errors)-maxNodeErrors:]
+	}
+}
+
+// list returns the errors, the newest first.
+func (e *nodeErrors) list() []*cnirpc.NodeError {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	l := make([]*cnirpc.NodeError, 0, len(e.errors))
+	for i := len(e.errors) - 1; i >= 0; i-- {
+		l = append(l, e.errors[i])
+	}
+	return l
+}
+
+// nodeErrorsInterceptor records the errors returned by RPCs.
+func nodeErrorsInterceptor(e *nodeErrors) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		ne := &cnirpc.NodeError{
+			Time:   timestamppb.New(time.Now()),
+			Method: path.Base(info.FullMethod),
+		}
+		st := status.Convert(err)
+		ne.Message = st.Message()
+		for _, d := range st.Details() {
+			if cniErr, ok := d.(*cnirpc.CNIError); ok && cniErr.Details != "" {
+				ne.Message += ": " + cniErr.Details
+			}
+		}
+		if args, ok := req.(*cnirpc.CNIArgs); ok && args.Args[constants.PodNameKey] != "" {
+			ne.Pod = args.Args[constants.PodNamespaceKey] + "/" + args.Args[constants.PodNameKey]
+		}
+		e.record(ne)
+		return resp, err
+	}
+}
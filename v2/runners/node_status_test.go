@@ -0,0 +1,146 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNodeStatusReporter(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &coilv2.AddressPool{}
+	pool.Name = "default"
+	pool.Spec.BlockSizeBits = 2
+	var objs []client.Object
+	objs = append(objs, pool)
+	for _, b := range []struct {
+		name, node, ipv4, ipv6 string
+		quarantined            bool
+	}{
+		{"default-1", "node1", "10.2.0.4/30", "fd02::4/126", false},
+		{"default-0", "node1", "10.2.0.0/30", "", true},
+		{"default-2", "node2", "10.2.0.8/30", "", false},
+	} {
+		block := &coilv2.AddressBlock{}
+		block.Name = b.name
+		block.Labels = map[string]string{constants.LabelNode: b.node, constants.LabelPool: "default"}
+		if b.quarantined {
+			block.Labels[constants.LabelQuarantined] = "true"
+		}
+		block.IPv4 = strPtr(b.ipv4)
+		if b.ipv6 != "" {
+			block.IPv6 = strPtr(b.ipv6)
+		}
+		objs = append(objs, block)
+	}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+
+	podNet := &mockPodNetwork{
+		confs: []*nodenet.PodNetConf{
+			{PoolName: "default", ContainerId: "pod1", IFace: "eth0", IPv4: net.ParseIP("10.2.0.4"), IPv6: net.ParseIP("fd02::4")},
+			{PoolName: "default", ContainerId: "pod2", IFace: "eth0", IPv4: net.ParseIP("10.2.0.5"), IPv6: net.ParseIP("fd02::5")},
+			{PoolName: "default", ContainerId: "pod3", IFace: "eth0", IPv4: net.ParseIP("10.2.0.1")},
+		},
+	}
+	_, n1, _ := net.ParseCIDR("10.2.0.4/30")
+	_, n2, _ := net.ParseCIDR("fd02::4/126")
+	exporter := &listExporter{nets: []*net.IPNet{n2, n1}}
+
+	r := NewNodeStatusReporter(c, podNet, exporter, "node1")
+	resp := &cnirpc.NodeStatusResponse{}
+	if err := r.Report(context.Background(), resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Node != "node1" {
+		t.Error("unexpected node:", resp.Node)
+	}
+	if len(resp.ExportedRoutes) != 2 || resp.ExportedRoutes[0] != "10.2.0.4/30" || resp.ExportedRoutes[1] != "fd02::4/126" {
+		t.Error("unexpected routes:", resp.ExportedRoutes)
+	}
+	if len(resp.Blocks) != 2 {
+		t.Fatalf("unexpected blocks: %+v", resp.Blocks)
+	}
+
+	b := resp.Blocks[0]
+	if b.Name != "default-0" || !b.Quarantined || b.RouteExported || b.Allocated != 1 || b.Capacity != 4 {
+		t.Errorf("unexpected block: %+v", b)
+	}
+	b = resp.Blocks[1]
+	if b.Name != "default-1" || b.Quarantined || !b.RouteExported || b.Allocated != 2 || b.Capacity != 4 {
+		t.Errorf("unexpected block: %+v", b)
+	}
+	if len(b.Subnets) != 2 || b.Subnets[0] != "10.2.0.4/30" || b.Subnets[1] != "fd02::4/126" {
+		t.Error("unexpected subnets:", b.Subnets)
+	}
+}
+
+func TestNodeErrorsInterceptor(t *testing.T) {
+	t.Parallel()
+
+	e := &nodeErrors{}
+	interceptor := nodeErrorsInterceptor(e)
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/Add"}
+	args := &cnirpc.CNIArgs{Args: map[string]string{
+		constants.PodNamespaceKey: "ns1",
+		constants.PodNameKey:      "pod1",
+	}}
+
+	_, err := interceptor(context.Background(), args, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &cnirpc.AddResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.list()) != 0 {
+		t.Error("success should not be recorded")
+	}
+
+	for i := 0; i < maxNodeErrors+1; i++ {
+		_, err := interceptor(context.Background(), args, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, newInternalError(errors.New("no space"), "failed to allocate")
+		})
+		if status.Code(err) != codes.Internal {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.cnirpc.CNI/SetReadOnly"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unimplemented, "read-only mode is not supported")
+	})
+	if err == nil {
+		t.Fatal("error should be returned")
+	}
+
+	l := e.list()
+	if len(l) != maxNodeErrors {
+		t.Fatal("unexpected number of errors:", len(l))
+	}
+	if l[0].Method != "SetReadOnly" || l[0].Pod != "" || l[0].Message != "read-only mode is not supported" {
+		t.Errorf("unexpected error: %+v", l[0])
+	}
+	if l[1].Method != "Add" || l[1].Pod != "ns1/pod1" || l[1].Message != "failed to allocate: no space" || l[1].Time == nil {
+		t.Errorf("unexpected error: %+v", l[1])
+	}
+}
@@ -0,0 +1,213 @@
+package runners
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Network types of Pods in PodAccounting.
+const (
+	PodNetworkCoil        = "coil"
+	PodNetworkHostNetwork = "hostNetwork"
+	PodNetworkOther       = "other"
+)
+
+// PodAccountingEntry represents a Pod running on the node.
+type PodAccountingEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// Network is one of PodNetworkCoil, PodNetworkHostNetwork, or PodNetworkOther.
+	Network string `json:"network"`
+
+	// Pool is the address pool of the Pod if Network is PodNetworkCoil.
+	Pool string `json:"pool,omitempty"`
+
+	// Owner is the workload controlling the Pod, if any.
+	Owner *PodOwner `json:"owner,omitempty"`
+
+	// Labels are the labels of the Pod selected to be reported.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PodOwner represents the workload controlling a Pod.
+type PodOwner struct {
+	// Kind is the kind of the workload, such as Deployment, StatefulSet, or Job.
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// PodAccounting is the response of the handler returned by NewPodAccountingHandler.
+type PodAccounting struct {
+	Node string `json:"node"`
+
+	// Coil is the number of Pods having addresses from Coil.
+	Coil int `json:"coil"`
+
+	// HostNetwork is the number of Pods running in the host network.
+	HostNetwork int `json:"hostNetwork"`
+
+	// Other is the number of Pods that have no addresses from Coil yet,
+	// or got their addresses from other means.
+	Other int `json:"other"`
+
+	Pods []PodAccountingEntry `json:"pods"`
+}
+
+// NewPodAccountingHandler returns an http.Handler that reports which Pods on
+// the node have addresses from Coil and which bypass Coil by running in the
+// host network.  DaemonSets often run in the host network, so the number of
+// Pods on a node does not tell how many addresses are used.
+//
+// A Pod has addresses from Coil if one of its IP addresses is configured
+// by coild.  Pods are read from the API server on every request.
+//
+// Each Pod is reported with its owner workload and the labels of `labelKeys`
+// so that addresses can be grouped by workload.
+func NewPodAccountingHandler(apiReader client.Reader, podNet nodenet.PodNetwork, nodeName string, labelKeys []string, log logr.Logger) http.Handler {
+	return &podAccounting{
+		apiReader: apiReader,
+		podNet:    podNet,
+		nodeName:  nodeName,
+		labelKeys: labelKeys,
+		log:       log,
+	}
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list
+
+type podAccounting struct {
+	apiReader client.Reader
+	podNet    nodenet.PodNetwork
+	nodeName  string
+	labelKeys []string
+	log       logr.Logger
+}
+
+func (a *podAccounting) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := a.account(r)
+	if err != nil {
+		a.log.Error(err, "failed to account pods")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *podAccounting) account(r *http.Request) (*PodAccounting, error) {
+	confs, err := a.podNet.List()
+	if err != nil {
+		return nil, err
+	}
+	pools := make(map[string]string)
+	for _, c := range confs {
+		if c.IPv4 != nil {
+			pools[c.IPv4.String()] = c.PoolName
+		}
+		if c.IPv6 != nil {
+			pools[c.IPv6.String()] = c.PoolName
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := a.apiReader.List(r.Context(), pods, client.MatchingFields{"spec.nodeName": a.nodeName}); err != nil {
+		return nil, err
+	}
+
+	resp := &PodAccounting{Node: a.nodeName, Pods: []PodAccountingEntry{}}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != a.nodeName {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		entry := PodAccountingEntry{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Network:   PodNetworkOther,
+			Owner:     podOwner(&pod),
+		}
+		for _, k := range a.labelKeys {
+			if v, ok := pod.Labels[k]; ok {
+				if entry.Labels == nil {
+					entry.Labels = make(map[string]string)
+				}
+				entry.Labels[k] = v
+			}
+		}
+		if pod.Spec.HostNetwork {
+			entry.Network = PodNetworkHostNetwork
+		} else {
+			for _, podIP := range pod.Status.PodIPs {
+				ip := net.ParseIP(podIP.IP)
+				if ip == nil {
+					continue
+				}
+				if pool, ok := pools[ip.String()]; ok {
+					entry.Network = PodNetworkCoil
+					entry.Pool = pool
+					break
+				}
+			}
+		}
+
+		switch entry.Network {
+		case PodNetworkCoil:
+			resp.Coil++
+		case PodNetworkHostNetwork:
+			resp.HostNetwork++
+		default:
+			resp.Other++
+		}
+		resp.Pods = append(resp.Pods, entry)
+	}
+
+	sort.Slice(resp.Pods, func(i, j int) bool {
+		if resp.Pods[i].Namespace != resp.Pods[j].Namespace {
+			return resp.Pods[i].Namespace < resp.Pods[j].Namespace
+		}
+		return resp.Pods[i].Name < resp.Pods[j].Name
+	})
+	return resp, nil
+}
+
+// podOwner returns the workload controlling `pod`, or nil.
+//
+// The ReplicaSet of a Deployment is named after the Deployment with the
+// pod-template-hash label of its Pods as the suffix, so the Deployment is
+// found without reading the ReplicaSet.
+func podOwner(pod *corev1.Pod) *PodOwner {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil
+	}
+
+	owner := &PodOwner{Kind: ref.Kind, Name: ref.Name}
+	if ref.Kind == "ReplicaSet" {
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+			owner.Kind = "Deployment"
+			owner.Name = strings.TrimSuffix(ref.Name, "-"+hash)
+		}
+	}
+	return owner
+}
@@ -0,0 +1,92 @@
+package runners
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testAccountingPod(name, node string, hostNetwork bool, phase corev1.PodPhase, ips ...string) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Namespace = "default"
+	pod.Name = name
+	pod.Spec.NodeName = node
+	pod.Spec.HostNetwork = hostNetwork
+	pod.Status.Phase = phase
+	for _, ip := range ips {
+		pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+	}
+	return pod
+}
+
+func TestPodAccounting(t *testing.T) {
+	t.Parallel()
+
+	objs := []client.Object{
+		testAccountingPod("coil1", "node1", false, corev1.PodRunning, "10.1.0.1"),
+		testAccountingPod("coil2", "node1", false, corev1.PodRunning, "10.2.0.1", "fd02::1"),
+		testAccountingPod("host1", "node1", true, corev1.PodRunning, "192.168.0.1"),
+		testAccountingPod("pending", "node1", false, corev1.PodPending),
+		testAccountingPod("done", "node1", false, corev1.PodSucceeded, "10.1.0.2"),
+		testAccountingPod("remote", "node2", false, corev1.PodRunning, "10.1.0.3"),
+	}
+	objs[0].SetLabels(map[string]string{"app": "web", "pod-template-hash": "5d4f8c7b9", "tier": "front"})
+	objs[0].SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d4f8c7b9", UID: "1", Controller: pointer.Bool(true)}})
+	objs[1].SetLabels(map[string]string{"app": "db"})
+	objs[1].SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db", UID: "2", Controller: pointer.Bool(true)}})
+	objs[2].SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: "node1", UID: "3"}})
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objs...).Build()
+	podNet := &mockPodNetwork{confs: []*nodenet.PodNetConf{
+		{PoolName: "default", ContainerId: "c1", IFace: "eth0", IPv4: net.ParseIP("10.1.0.1")},
+		{PoolName: "global", ContainerId: "c2", IFace: "eth0", IPv6: net.ParseIP("fd02::1")},
+	}}
+	h := NewPodAccountingHandler(cl, podNet, "node1", []string{"app", "team"}, ctrl.Log.WithName("pod-accounting"))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status/pods", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal("unexpected status:", w.Code, w.Body.String())
+	}
+	var resp PodAccounting
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node != "node1" || resp.Coil != 2 || resp.HostNetwork != 1 || resp.Other != 1 {
+		t.Errorf("unexpected counts: %+v", resp)
+	}
+
+	expected := []PodAccountingEntry{
+		{Namespace: "default", Name: "coil1", Network: PodNetworkCoil, Pool: "default",
+			Owner: &PodOwner{Kind: "Deployment", Name: "web"}, Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Name: "coil2", Network: PodNetworkCoil, Pool: "global",
+			Owner: &PodOwner{Kind: "StatefulSet", Name: "db"}, Labels: map[string]string{"app": "db"}},
+		{Namespace: "default", Name: "host1", Network: PodNetworkHostNetwork},
+		{Namespace: "default", Name: "pending", Network: PodNetworkOther},
+	}
+	if len(resp.Pods) != len(expected) {
+		t.Fatalf("unexpected pods: %+v", resp.Pods)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(resp.Pods[i], expected[i]) {
+			t.Errorf("unexpected pod #%d: %+v", i, resp.Pods[i])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/status/pods", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("PUT should not be allowed:", w.Code)
+	}
+}
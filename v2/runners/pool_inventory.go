@@ -0,0 +1,198 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PoolInventoryPath is the path of the metrics endpoint of coil-controller
+// serving PoolInventory.
+const PoolInventoryPath = "/status/pools"
+
+// PoolInventory is the response of the handler returned by NewPoolInventoryHandler.
+type PoolInventory struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Pools       []PoolInventoryPool `json:"pools"`
+}
+
+// PoolInventoryPool represents an AddressPool and its address blocks.
+type PoolInventoryPool struct {
+	Name          string   `json:"name"`
+	Subnets       []string `json:"subnets"`
+	BlockSizeBits int32    `json:"block_size_bits"`
+	Cordoned      bool     `json:"cordoned,omitempty"`
+
+	// PauseReason is set if allocations from the pool are paused.
+	PauseReason string `json:"pause_reason,omitempty"`
+
+	// MaxBlocks is the number of blocks that can be curved out of the pool.
+	MaxBlocks int `json:"max_blocks"`
+
+	// Capacity and Allocated are the sums of those of the blocks.
+	Capacity  int `json:"capacity"`
+	Allocated int `json:"allocated"`
+
+	Blocks []PoolInventoryBlock `json:"blocks"`
+}
+
+// PoolInventoryBlock represents an AddressBlock.
+type PoolInventoryBlock struct {
+	Name      string `json:"name"`
+	Node      string `json:"node"`
+	IPv4      string `json:"ipv4,omitempty"`
+	IPv6      string `json:"ipv6,omitempty"`
+	Capacity  int    `json:"capacity"`
+	Allocated int    `json:"allocated"`
+}
+
+// NewPoolInventoryHandler returns an http.Handler that lists pools, their
+// utilization, and the blocks of each node so that external systems can poll
+// one endpoint.  The list is computed in the same way as the block metrics,
+// and reused for `ttl` to bear frequent polling.
+//
+// `?pool=<name>` limits the response to the pool.
+func NewPoolInventoryHandler(r client.Reader, ttl time.Duration, log logr.Logger) http.Handler {
+	return &poolInventory{
+		reader: r,
+		ttl:    ttl,
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+type poolInventory struct {
+	reader client.Reader
+	ttl    time.Duration
+	log    logr.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache *PoolInventory
+}
+
+func (h *poolInventory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	inv, err := h.get(r.Context())
+	if err != nil {
+		h.log.Error(err, "failed to list pools")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if name := r.URL.Query().Get("pool"); name != "" {
+		filtered := &PoolInventory{GeneratedAt: inv.GeneratedAt, Pools: []PoolInventoryPool{}}
+		for _, p := range inv.Pools {
+			if p.Name == name {
+				filtered.Pools = append(filtered.Pools, p)
+			}
+		}
+		if len(filtered.Pools) == 0 {
+			http.Error(w, "pool not found", http.StatusNotFound)
+			return
+		}
+		inv = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(inv)
+}
+
+func (h *poolInventory) get(ctx context.Context) (*PoolInventory, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	if h.cache != nil && now.Sub(h.cache.GeneratedAt) < h.ttl {
+		return h.cache, nil
+	}
+
+	inv, err := h.build(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	h.cache = inv
+	return inv, nil
+}
+
+func (h *poolInventory) build(ctx context.Context, now time.Time) (*PoolInventory, error) {
+	pools := &coilv2.AddressPoolList{}
+	if err := h.reader.List(ctx, pools); err != nil {
+		return nil, err
+	}
+	usages, err := ipam.ListBlockUsage(ctx, h.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*PoolInventoryPool)
+	inv := &PoolInventory{GeneratedAt: now, Pools: make([]PoolInventoryPool, len(pools.Items))}
+	for i := range pools.Items {
+		ap := &pools.Items[i]
+		p := &inv.Pools[i]
+		p.Name = ap.Name
+		p.BlockSizeBits = ap.Spec.BlockSizeBits
+		p.Cordoned = ap.Labels[constants.LabelCordoned] == "true"
+		p.PauseReason, _ = ipam.PauseReason(ap)
+		p.MaxBlocks = ipam.MaxBlocks(ap)
+		p.Subnets = []string{}
+		for _, ss := range ap.Spec.Subnets {
+			if ss.IPv4 != nil {
+				p.Subnets = append(p.Subnets, *ss.IPv4)
+			}
+			if ss.IPv6 != nil {
+				p.Subnets = append(p.Subnets, *ss.IPv6)
+			}
+		}
+		p.Blocks = []PoolInventoryBlock{}
+		entries[ap.Name] = p
+	}
+
+	for _, u := range usages {
+		p, ok := entries[u.Pool]
+		if !ok {
+			continue
+		}
+		b := PoolInventoryBlock{
+			Name:      u.Block.Name,
+			Node:      u.Node,
+			Capacity:  u.Capacity,
+			Allocated: u.Allocated,
+		}
+		if u.Block.IPv4 != nil {
+			b.IPv4 = *u.Block.IPv4
+		}
+		if u.Block.IPv6 != nil {
+			b.IPv6 = *u.Block.IPv6
+		}
+		p.Blocks = append(p.Blocks, b)
+		p.Capacity += u.Capacity
+		p.Allocated += u.Allocated
+	}
+
+	sort.Slice(inv.Pools, func(i, j int) bool { return inv.Pools[i].Name < inv.Pools[j].Name })
+	for _, p := range inv.Pools {
+		sort.Slice(p.Blocks, func(i, j int) bool {
+			if p.Blocks[i].Node != p.Blocks[j].Node {
+				return p.Blocks[i].Node < p.Blocks[j].Node
+			}
+			return p.Blocks[i].Name < p.Blocks[j].Name
+		})
+	}
+	return inv, nil
+}
@@ -0,0 +1,120 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPoolInventory(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	def := &coilv2.AddressPool{}
+	def.Name = "default"
+	def.Spec.BlockSizeBits = 2
+	def.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("10.2.0.0/28"), IPv6: strPtr("fd02::/124")}}
+	global := &coilv2.AddressPool{}
+	global.Name = "global"
+	global.Labels = map[string]string{constants.LabelCordoned: "true", constants.LabelPaused: "true"}
+	global.Annotations = map[string]string{constants.AnnPauseReason: "router maintenance"}
+	global.Spec.BlockSizeBits = 0
+	global.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr("192.0.2.0/30")}}
+
+	newBlock := func(name, pool, node, ipv4 string) *coilv2.AddressBlock {
+		b := &coilv2.AddressBlock{}
+		b.Name = name
+		b.Labels = map[string]string{constants.LabelPool: pool, constants.LabelNode: node}
+		b.IPv4 = strPtr(ipv4)
+		return b
+	}
+	pod := &corev1.Pod{}
+	pod.Namespace = "ns1"
+	pod.Name = "pod1"
+	pod.Spec.NodeName = "node2"
+	pod.Status.PodIPs = []corev1.PodIP{{IP: "10.2.0.5"}}
+
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		def, global,
+		newBlock("default-1", "default", "node2", "10.2.0.4/30"),
+		newBlock("default-0", "default", "node1", "10.2.0.0/30"),
+		newBlock("global-0", "global", "node1", "192.0.2.0/32"),
+		pod,
+	).Build()
+
+	h := NewPoolInventoryHandler(cl, time.Minute, ctrl.Log.WithName("pool-inventory")).(*poolInventory)
+	now := time.Date(2021, 10, 15, 3, 4, 5, 0, time.UTC)
+	h.now = func() time.Time { return now }
+
+	get := func(query string) (int, *PoolInventory) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, PoolInventoryPath+query, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		inv := &PoolInventory{}
+		if err := json.Unmarshal(w.Body.Bytes(), inv); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, inv
+	}
+
+	_, inv := get("")
+	if !inv.GeneratedAt.Equal(now) {
+		t.Error("unexpected generation time:", inv.GeneratedAt)
+	}
+	if len(inv.Pools) != 2 {
+		t.Fatal("unexpected pools:", inv.Pools)
+	}
+	p := inv.Pools[0]
+	if p.Name != "default" || p.MaxBlocks != 4 || p.Capacity != 8 || p.Allocated != 1 || p.Cordoned || p.PauseReason != "" {
+		t.Errorf("unexpected default pool: %+v", p)
+	}
+	if len(p.Subnets) != 2 || p.Subnets[1] != "fd02::/124" {
+		t.Error("unexpected subnets:", p.Subnets)
+	}
+	if len(p.Blocks) != 2 || p.Blocks[0].Node != "node1" || p.Blocks[1].Name != "default-1" || p.Blocks[1].Allocated != 1 {
+		t.Errorf("unexpected blocks: %+v", p.Blocks)
+	}
+	if p := inv.Pools[1]; p.Name != "global" || !p.Cordoned || p.PauseReason != "router maintenance" || p.MaxBlocks != 4 || p.Capacity != 1 {
+		t.Errorf("unexpected global pool: %+v", p)
+	}
+
+	// the cached inventory is served until the TTL expires.
+	if err := cl.Delete(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	_, inv = get("?pool=default")
+	if len(inv.Pools) != 1 || inv.Pools[0].Allocated != 1 {
+		t.Errorf("the cached inventory should be served: %+v", inv.Pools)
+	}
+
+	now = now.Add(time.Minute)
+	_, inv = get("?pool=default")
+	if inv.Pools[0].Allocated != 0 {
+		t.Errorf("the inventory should be refreshed: %+v", inv.Pools)
+	}
+
+	if code, _ := get("?pool=missing"); code != http.StatusNotFound {
+		t.Error("unexpected status for a missing pool:", code)
+	}
+}
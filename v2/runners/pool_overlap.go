@@ -0,0 +1,134 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var poolOverlaps = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "pool_overlaps",
+		Help:      "the number of networks overlapping the subnets of the pool",
+	},
+	[]string{"pool", "kind"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(poolOverlaps)
+}
+
+// EventPoolOverlap is the reason of events recorded for pools overlapping other networks.
+const EventPoolOverlap = "PoolOverlap"
+
+// NewPoolOverlapChecker creates a manager.Runnable to check every `interval`
+// that the subnets of AddressPools overlap neither each other, the networks
+// in CoilConfig, nor the addresses of nodes.
+//
+// The webhook of coil-controller rejects such pools when they are created,
+// but nodes and networks added later may collide with existing pools.
+// A Warning event is recorded for the pool when an overlap is found.
+func NewPoolOverlapChecker(r client.Reader, recorder record.EventRecorder, config *coilconfig.Store, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &poolOverlapChecker{
+		reader:   r,
+		recorder: recorder,
+		config:   config,
+		interval: interval,
+		log:      log,
+		reported: make(map[string]map[ipam.Overlap]bool),
+	}
+}
+
+type poolOverlapChecker struct {
+	reader   client.Reader
+	recorder record.EventRecorder
+	config   *coilconfig.Store
+	interval time.Duration
+	log      logr.Logger
+
+	// reported are the overlaps of each pool found in the last check.
+	reported map[string]map[ipam.Overlap]bool
+}
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=list
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=list
+
+var _ manager.LeaderElectionRunnable = &poolOverlapChecker{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*poolOverlapChecker) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (c *poolOverlapChecker) Start(ctx context.Context) error {
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+
+	for {
+		if err := c.check(ctx); err != nil {
+			c.log.Error(err, "failed to check overlaps of pools")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (c *poolOverlapChecker) check(ctx context.Context) error {
+	pools := &coilv2.AddressPoolList{}
+	if err := c.reader.List(ctx, pools); err != nil {
+		return fmt.Errorf("failed to list pools: %w", err)
+	}
+	nodes := &corev1.NodeList{}
+	if err := c.reader.List(ctx, nodes); err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	networks := ipam.Networks{
+		ServiceCIDRs: c.config.ServiceCIDRs(),
+		NodeNetworks: c.config.NodeNetworks(),
+		Nodes:        nodes.Items,
+	}
+
+	reported := make(map[string]map[ipam.Overlap]bool)
+	poolOverlaps.Reset()
+	for i := range pools.Items {
+		ap := &pools.Items[i]
+		overlaps := ipam.FindOverlaps(ap, pools.Items, networks)
+		if len(overlaps) == 0 {
+			continue
+		}
+
+		found := make(map[ipam.Overlap]bool)
+		for _, o := range overlaps {
+			found[o] = true
+			poolOverlaps.WithLabelValues(ap.Name, o.Kind).Inc()
+			if c.reported[ap.Name][o] {
+				continue
+			}
+			c.log.Info("pool overlaps another network", "pool", ap.Name, "overlap", o.String())
+			c.recorder.Event(ap, corev1.EventTypeWarning, EventPoolOverlap, o.String())
+		}
+		reported[ap.Name] = found
+	}
+	c.reported = reported
+	return nil
+}
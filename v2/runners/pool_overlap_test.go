@@ -0,0 +1,96 @@
+package runners
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/coilconfig"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPoolOverlapChecker(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	newPool := func(name, ipv4 string) *coilv2.AddressPool {
+		ap := &coilv2.AddressPool{}
+		ap.Name = name
+		ap.Spec.Subnets = []coilv2.SubnetSet{{IPv4: strPtr(ipv4)}}
+		return ap
+	}
+	cc := &coilv2.CoilConfig{}
+	cc.Name = constants.CoilConfigName
+	cc.Spec.ServiceCIDRs = []string{"10.96.0.0/12"}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		cc,
+		newPool("overlap-a", "10.128.0.0/16"),
+		newPool("overlap-b", "10.128.16.0/20"),
+		newPool("overlap-c", "10.200.0.0/16"),
+	).Build()
+
+	ctx := context.Background()
+	config := coilconfig.NewStore(coilconfig.Defaults{})
+	if _, err := config.Load(ctx, cl); err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := NewPoolOverlapChecker(cl, recorder, config, time.Minute, ctrl.Log.WithName("pool-overlap")).(*poolOverlapChecker)
+
+	if err := c.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, pool := range []string{"overlap-a", "overlap-b"} {
+		if v := testutil.ToFloat64(poolOverlaps.WithLabelValues(pool, "AddressPool")); v != 1 {
+			t.Errorf("%s should overlap a pool: %v", pool, v)
+		}
+	}
+	if len(recorder.Events) != 2 {
+		t.Fatal("events should be recorded for overlapping pools:", len(recorder.Events))
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, EventPoolOverlap) || !strings.Contains(ev, "10.128.16.0/20") {
+		t.Error("unexpected event:", ev)
+	}
+	<-recorder.Events
+
+	// no duplicate events
+	if err := c.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Error("overlaps should not be reported twice")
+	}
+
+	// a node added later collides with an existing pool.
+	node := &corev1.Node{}
+	node.Name = "node1"
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.200.0.10"}}
+	if err := cl.Create(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, "10.200.0.10 of Node node1") {
+		t.Error("unexpected event:", ev)
+	}
+	if v := testutil.ToFloat64(poolOverlaps.WithLabelValues("overlap-c", "Node")); v != 1 {
+		t.Error("overlap-c should overlap a node:", v)
+	}
+}
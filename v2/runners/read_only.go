@@ -0,0 +1,102 @@
+package runners
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var readOnlyGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "read_only",
+		Help:      "1 if coild is in read-only mode, 0 otherwise",
+	},
+)
+
+func init() {
+	metrics.Registry.MustRegister(readOnlyGauge)
+}
+
+// ReadOnlyMode is a switch to stop coild from changing address assignments,
+// e.g. while the cluster state is being restored from a backup.
+//
+// In read-only mode, coild refuses Add and Del requests with TRY_AGAIN_LATER
+// and stops draining the free queue.  Other requests are served as usual.
+type ReadOnlyMode interface {
+	// Enabled returns true if read-only mode is enabled.
+	Enabled() bool
+
+	// Set enables or disables read-only mode.
+	Set(enabled bool)
+}
+
+// NewReadOnlyMode creates a ReadOnlyMode.
+func NewReadOnlyMode(enabled bool, log logr.Logger) ReadOnlyMode {
+	m := &readOnlyMode{log: log}
+	if enabled {
+		m.enabled = 1
+		readOnlyGauge.Set(1)
+	} else {
+		readOnlyGauge.Set(0)
+	}
+	return m
+}
+
+type readOnlyMode struct {
+	enabled int32
+	log     logr.Logger
+}
+
+func (m *readOnlyMode) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) != 0
+}
+
+func (m *readOnlyMode) Set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	if atomic.SwapInt32(&m.enabled, v) == v {
+		return
+	}
+	readOnlyGauge.Set(float64(v))
+	if enabled {
+		m.log.Info("entered read-only mode")
+	} else {
+		m.log.Info("left read-only mode")
+	}
+}
+
+// readOnlyMethods are gRPC methods that change address assignments.
+var readOnlyMethods = map[string]bool{
+	"/pkg.cnirpc.CNI/Add":           true,
+	"/pkg.cnirpc.CNI/Del":           true,
+	"/pkg.cnirpc.CNI/Recover":       true,
+	"/pkg.cnirpc.CNI/ForceFree":     true,
+	"/pkg.cnirpc.CNI/Hold":          true,
+	"/pkg.cnirpc.CNI/ReleaseHold":   true,
+	"/pkg.cnirpc.CNI/FreeNamespace": true,
+}
+
+// readOnlyInterceptor returns an interceptor that refuses requests changing
+// address assignments while `mode` is enabled.
+//
+// The refusal has codes.Unavailable so that the CNI plugin queues DEL requests
+// in the free queue.  They are replayed after read-only mode is disabled.
+func readOnlyInterceptor(mode ReadOnlyMode) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if readOnlyMethods[info.FullMethod] && mode.Enabled() {
+			return nil, newError(codes.Unavailable, cnirpc.ErrorCode_TRY_AGAIN_LATER, "coild is in read-only mode", "")
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,77 @@
+package runners
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/freequeue"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadOnlyInterceptor(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	mode := NewReadOnlyMode(false, logr.Discard())
+	interceptor := readOnlyInterceptor(mode)
+
+	methods := []string{"/pkg.cnirpc.CNI/Add", "/pkg.cnirpc.CNI/Del", "/pkg.cnirpc.CNI/Check", "/pkg.cnirpc.CNI/TrafficStats"}
+	for _, m := range methods {
+		if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: m}, handler); err != nil {
+			t.Errorf("%s should be accepted: %v", m, err)
+		}
+	}
+
+	mode.Set(true)
+	if !mode.Enabled() {
+		t.Fatal("read-only mode should be enabled")
+	}
+	for _, m := range methods[:2] {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: m}, handler)
+		if code := status.Code(err); code != codes.Unavailable {
+			t.Errorf("%s: unexpected code %v: %v", m, code, err)
+		}
+	}
+	for _, m := range methods[2:] {
+		if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: m}, handler); err != nil {
+			t.Errorf("%s should be accepted in read-only mode: %v", m, err)
+		}
+	}
+
+	mode.Set(false)
+	if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: methods[0]}, handler); err != nil {
+		t.Error("Add should be accepted after read-only mode is disabled:", err)
+	}
+}
+
+func TestFreeQueueDrainerReadOnly(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := freequeue.Push(dir, freequeue.Entry{ContainerID: "c1", Ifname: "eth0", Queued: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeIPAM := &mockNodeIPAM{}
+	podNet := &mockPodNetwork{}
+	mode := NewReadOnlyMode(true, logr.Discard())
+	d := NewFreeQueueDrainer(dir, nodeIPAM, podNet, mode, AllocationIDContainer, time.Minute, logr.Discard()).(*freeQueueDrainer)
+
+	d.drain(context.Background())
+	if nodeIPAM.nFree != 0 || podNet.nDestroy != 0 {
+		t.Error("entries should not be processed in read-only mode", nodeIPAM.nFree, podNet.nDestroy)
+	}
+
+	mode.Set(false)
+	d.drain(context.Background())
+	if nodeIPAM.nFree != 1 || podNet.nDestroy != 1 {
+		t.Error("entries should be processed", nodeIPAM.nFree, podNet.nDestroy)
+	}
+}
@@ -0,0 +1,219 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var rebalancedBlocks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "rebalanced_blocks_total",
+		Help:      "the number of address blocks requested to hand off by the rebalancer",
+	},
+	[]string{"pool"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(rebalancedBlocks)
+}
+
+// NewRebalancer creates a manager.Runnable to move free address blocks
+// from nodes having spare blocks to nodes whose blocks are exhausted.
+//
+// At most `maxMoves` blocks are moved in each cycle.  The blocks are moved
+// by coild on the source nodes through the handoff annotation.
+//
+// If stale is not nil, blocks are neither moved from nor to stale nodes
+// because coild on those nodes cannot complete the handoff.
+func NewRebalancer(mgr manager.Manager, log logr.Logger, interval time.Duration, maxMoves int, stale StaleNodeDetector) manager.Runnable {
+	return &rebalancer{
+		Client:   mgr.GetClient(),
+		log:      log,
+		interval: interval,
+		maxMoves: maxMoves,
+		stale:    stale,
+	}
+}
+
+type rebalancer struct {
+	client.Client
+	log      logr.Logger
+	interval time.Duration
+	maxMoves int
+	stale    StaleNodeDetector
+}
+
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch;update;patch
+
+var _ manager.LeaderElectionRunnable = &rebalancer{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*rebalancer) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (r *rebalancer) Start(ctx context.Context) error {
+	tick := time.NewTicker(r.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+			// errors are not fatal because the next cycle will retry.
+			if err := r.do(ctx); err != nil {
+				r.log.Error(err, "failed to rebalance address blocks")
+			}
+		}
+	}
+}
+
+func (r *rebalancer) do(ctx context.Context) error {
+	usages, err := ipam.ListBlockUsage(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+	if r.stale != nil {
+		// Stale nodes are neither donors nor starved without their blocks.
+		filtered := usages[:0]
+		for _, u := range usages {
+			if !r.stale.IsStale(u.Node) {
+				filtered = append(filtered, u)
+			}
+		}
+		usages = filtered
+	}
+
+	for _, m := range planMoves(usages, r.maxMoves) {
+		b := &coilv2.AddressBlock{}
+		if err := r.Get(ctx, client.ObjectKey{Name: m.block}, b); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if b.Annotations[constants.AnnHandoffTo] != "" {
+			continue
+		}
+
+		orig := b.DeepCopy()
+		if b.Annotations == nil {
+			b.Annotations = make(map[string]string)
+		}
+		b.Annotations[constants.AnnHandoffTo] = m.to
+		if err := r.Patch(ctx, b, client.MergeFrom(orig)); err != nil {
+			return fmt.Errorf("failed to annotate block %s: %w", m.block, err)
+		}
+
+		r.log.Info("requested to hand off a block", "block", m.block, "pool", m.pool, "from", m.from, "to", m.to)
+		rebalancedBlocks.WithLabelValues(m.pool).Inc()
+	}
+	return nil
+}
+
+// blockMove represents a free block to be moved between nodes.
+type blockMove struct {
+	pool  string
+	block string
+	from  string
+	to    string
+}
+
+// planMoves decides which blocks should be moved.
+//
+// A node is starved if all of its blocks in a pool are full.
+// A node can donate its free blocks in a pool but keeps one of them.
+// Blocks already being handed off are not moved again, and nodes
+// receiving such blocks are not considered starved.
+func planMoves(usages []ipam.BlockUsage, maxMoves int) []blockMove {
+	type nodeState struct {
+		free      []string
+		available int
+		receiving bool
+	}
+	pools := make(map[string]map[string]*nodeState)
+	state := func(pool, node string) *nodeState {
+		nodes, ok := pools[pool]
+		if !ok {
+			nodes = make(map[string]*nodeState)
+			pools[pool] = nodes
+		}
+		st, ok := nodes[node]
+		if !ok {
+			st = &nodeState{}
+			nodes[node] = st
+		}
+		return st
+	}
+
+	for _, u := range usages {
+		if u.Block.DeletionTimestamp != nil {
+			continue
+		}
+		if to := u.Block.Annotations[constants.AnnHandoffTo]; to != "" {
+			state(u.Pool, to).receiving = true
+			continue
+		}
+		st := state(u.Pool, u.Node)
+		st.available += u.Capacity - u.Allocated
+		if u.Allocated == 0 {
+			st.free = append(st.free, u.Block.Name)
+		}
+	}
+
+	poolNames := make([]string, 0, len(pools))
+	for p := range pools {
+		poolNames = append(poolNames, p)
+	}
+	sort.Strings(poolNames)
+
+	var moves []blockMove
+	for _, p := range poolNames {
+		nodes := pools[p]
+		var starved, donors []string
+		for n, st := range nodes {
+			switch {
+			case st.available <= 0 && !st.receiving:
+				starved = append(starved, n)
+			case len(st.free) > 1:
+				sort.Strings(st.free)
+				donors = append(donors, n)
+			}
+		}
+		sort.Strings(starved)
+		sort.Strings(donors)
+
+		for _, to := range starved {
+			if len(moves) >= maxMoves {
+				return moves
+			}
+
+			// donate from the node having the most free blocks.
+			from := ""
+			for _, n := range donors {
+				if len(nodes[n].free) > 1 && (from == "" || len(nodes[n].free) > len(nodes[from].free)) {
+					from = n
+				}
+			}
+			if from == "" {
+				break
+			}
+			st := nodes[from]
+			moves = append(moves, blockMove{pool: p, block: st.free[0], from: from, to: to})
+			st.free = st.free[1:]
+		}
+	}
+	return moves
+}
@@ -0,0 +1,110 @@
+package runners
+
+import (
+	"reflect"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testUsage(pool, node, name string, allocated int, handoffTo string) ipam.BlockUsage {
+	b := &coilv2.AddressBlock{}
+	b.Name = name
+	if handoffTo != "" {
+		b.Annotations = map[string]string{constants.AnnHandoffTo: handoffTo}
+	}
+	return ipam.BlockUsage{
+		Block:     b,
+		Pool:      pool,
+		Node:      node,
+		Capacity:  4,
+		Allocated: allocated,
+	}
+}
+
+func TestRebalancerPlan(t *testing.T) {
+	t.Run("moves", testPlanMoves)
+	t.Run("budget", testPlanBudget)
+	t.Run("pending", testPlanPending)
+}
+
+func testPlanMoves(t *testing.T) {
+	t.Parallel()
+
+	usages := []ipam.BlockUsage{
+		testUsage("default", "node1", "default-0", 4, ""),
+		testUsage("default", "node1", "default-1", 4, ""),
+		testUsage("default", "node2", "default-2", 0, ""),
+		testUsage("default", "node2", "default-3", 0, ""),
+		testUsage("default", "node2", "default-4", 0, ""),
+		testUsage("default", "node3", "default-5", 0, ""),
+		testUsage("default", "node4", "default-6", 3, ""),
+		testUsage("other", "node5", "other-0", 4, ""),
+		testUsage("other", "node6", "other-1", 0, ""),
+	}
+
+	moves := planMoves(usages, 10)
+	expected := []blockMove{
+		{pool: "default", block: "default-2", from: "node2", to: "node1"},
+	}
+	if !reflect.DeepEqual(moves, expected) {
+		t.Errorf("unexpected moves: %+v", moves)
+	}
+}
+
+func testPlanBudget(t *testing.T) {
+	t.Parallel()
+
+	usages := []ipam.BlockUsage{
+		testUsage("default", "node1", "default-0", 4, ""),
+		testUsage("default", "node2", "default-1", 4, ""),
+		testUsage("default", "node3", "default-2", 4, ""),
+		testUsage("default", "node4", "default-3", 0, ""),
+		testUsage("default", "node4", "default-4", 0, ""),
+		testUsage("default", "node5", "default-5", 0, ""),
+		testUsage("default", "node5", "default-6", 0, ""),
+		testUsage("default", "node5", "default-7", 0, ""),
+	}
+
+	moves := planMoves(usages, 2)
+	expected := []blockMove{
+		{pool: "default", block: "default-5", from: "node5", to: "node1"},
+		{pool: "default", block: "default-3", from: "node4", to: "node2"},
+	}
+	if !reflect.DeepEqual(moves, expected) {
+		t.Errorf("unexpected moves: %+v", moves)
+	}
+
+	moves = planMoves(usages, 0)
+	if len(moves) != 0 {
+		t.Errorf("unexpected moves: %+v", moves)
+	}
+}
+
+func testPlanPending(t *testing.T) {
+	t.Parallel()
+
+	deleting := testUsage("default", "node2", "default-4", 0, "")
+	now := metav1.Now()
+	deleting.Block.DeletionTimestamp = &now
+
+	usages := []ipam.BlockUsage{
+		testUsage("default", "node1", "default-0", 4, ""),
+		testUsage("default", "node2", "default-1", 0, "node1"),
+		testUsage("default", "node2", "default-2", 0, ""),
+		testUsage("default", "node2", "default-3", 0, ""),
+		deleting,
+		testUsage("default", "node3", "default-5", 4, ""),
+	}
+
+	moves := planMoves(usages, 10)
+	expected := []blockMove{
+		{pool: "default", block: "default-2", from: "node2", to: "node3"},
+	}
+	if !reflect.DeepEqual(moves, expected) {
+		t.Errorf("unexpected moves: %+v", moves)
+	}
+}
@@ -0,0 +1,201 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/cybozu-go/coil/v2/pkg/routeaudit"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	routeAuditMissing = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "route_audit_missing_routes",
+			Help:      "the number of address block routes not exported by coild on each node",
+		},
+		[]string{"node"},
+	)
+
+	routeAuditExtra = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "route_audit_extra_routes",
+			Help:      "the number of routes exported by coild on each node for blocks not assigned to the node",
+		},
+		[]string{"node"},
+	)
+
+	routeAuditUnreachable = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "route_audit_unreachable_nodes",
+			Help:      "the number of nodes whose coild did not answer the last route audit",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(routeAuditMissing, routeAuditExtra, routeAuditUnreachable)
+}
+
+// NewRouteStatusHandler returns an http.Handler for coild to serve the
+// routes of address blocks exported to the kernel routing table.
+func NewRouteStatusHandler(exporter nodenet.RouteExporter, nodeName string, log logr.Logger) http.Handler {
+	return &routeStatus{
+		exporter: exporter,
+		nodeName: nodeName,
+		log:      log,
+	}
+}
+
+type routeStatus struct {
+	exporter nodenet.RouteExporter
+	nodeName string
+	log      logr.Logger
+}
+
+func (s *routeStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nets, err := s.exporter.List()
+	if err != nil {
+		s.log.Error(err, "failed to list exported routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := &routeaudit.NodeRoutes{Node: s.nodeName, Exported: []string{}}
+	for _, n := range nets {
+		resp.Exported = append(resp.Exported, n.String())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RouteAuditor is a manager.Runnable to audit the routes of address blocks
+// exported by coild on every node.
+//
+// It also serves the report of the last audit as JSON over HTTP.
+type RouteAuditor interface {
+	manager.Runnable
+	http.Handler
+}
+
+// NewRouteAuditor creates a RouteAuditor that compares the routes exported
+// by coild Pods in `namespace` with AddressBlocks every `interval`.
+// The routes are fetched by `fetch`.
+func NewRouteAuditor(mgr manager.Manager, namespace string, fetch routeaudit.Fetcher, interval time.Duration, log logr.Logger) RouteAuditor {
+	return &routeAuditor{
+		apiReader: mgr.GetAPIReader(),
+		namespace: namespace,
+		fetch:     fetch,
+		interval:  interval,
+		log:       log,
+	}
+}
+
+type routeAuditor struct {
+	apiReader client.Reader
+	namespace string
+	fetch     routeaudit.Fetcher
+	interval  time.Duration
+	log       logr.Logger
+
+	mu     sync.Mutex
+	report *routeaudit.Report
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=list
+
+var _ manager.LeaderElectionRunnable = &routeAuditor{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*routeAuditor) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (a *routeAuditor) Start(ctx context.Context) error {
+	tick := time.NewTicker(a.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+			if err := a.audit(ctx); err != nil {
+				a.log.Error(err, "failed to audit routes")
+			}
+		}
+	}
+}
+
+// ServeHTTP serves the report of the last audit.  This implements http.Handler
+func (a *routeAuditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.mu.Lock()
+	report := a.report
+	a.mu.Unlock()
+	if report == nil {
+		// only the leader audits routes.
+		http.Error(w, "no route audit has run in this process", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+func (a *routeAuditor) audit(ctx context.Context) error {
+	report, err := routeaudit.Audit(ctx, a.apiReader, a.namespace, a.fetch)
+	if err != nil {
+		return err
+	}
+
+	routeAuditMissing.Reset()
+	routeAuditExtra.Reset()
+	unreachable := 0
+	for _, res := range report.Nodes {
+		if res.Error != "" {
+			unreachable++
+			a.log.Error(nil, "failed to fetch routes", "node", res.Node, "error", res.Error)
+			continue
+		}
+		routeAuditMissing.WithLabelValues(res.Node).Set(float64(len(res.Missing)))
+		routeAuditExtra.WithLabelValues(res.Node).Set(float64(len(res.Extra)))
+		if !res.OK() {
+			a.log.Info("found inconsistent routes", "node", res.Node, "missing", res.Missing, "extra", res.Extra)
+		}
+	}
+	routeAuditUnreachable.Set(float64(unreachable))
+
+	a.mu.Lock()
+	a.report = report
+	a.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,105 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/routeaudit"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type listExporter struct {
+	nets []*net.IPNet
+}
+
+func (e *listExporter) Sync(nets []*net.IPNet) error {
+	e.nets = nets
+	return nil
+}
+
+func (e *listExporter) List() ([]*net.IPNet, error) {
+	return e.nets, nil
+}
+
+func TestRouteStatusHandler(t *testing.T) {
+	t.Parallel()
+
+	_, n1, _ := net.ParseCIDR("10.2.0.0/31")
+	_, n2, _ := net.ParseCIDR("fd02::/127")
+	h := NewRouteStatusHandler(&listExporter{nets: []*net.IPNet{n1, n2}}, "node1", ctrl.Log.WithName("route-status"))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, routeaudit.StatusPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status:", rec.Code, rec.Body.String())
+	}
+	nr := &routeaudit.NodeRoutes{}
+	if err := json.Unmarshal(rec.Body.Bytes(), nr); err != nil {
+		t.Fatal(err)
+	}
+	if nr.Node != "node1" || len(nr.Exported) != 2 || nr.Exported[0] != "10.2.0.0/31" || nr.Exported[1] != "fd02::/127" {
+		t.Errorf("unexpected routes: %+v", nr)
+	}
+}
+
+func TestRouteAuditor(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	coild := &corev1.Pod{}
+	coild.Namespace = "kube-system"
+	coild.Name = "coild-a"
+	coild.Labels = map[string]string{constants.LabelAppComponent: "coild"}
+	coild.Spec.NodeName = "node1"
+	block := testBlock("default-0", "node1")
+	ipv4 := "10.2.0.0/31"
+	block.IPv4 = &ipv4
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(block, coild).Build()
+
+	a := &routeAuditor{
+		apiReader: cl,
+		namespace: "kube-system",
+		fetch: func(ctx context.Context, pod *corev1.Pod) (*routeaudit.NodeRoutes, error) {
+			return &routeaudit.NodeRoutes{Node: pod.Spec.NodeName}, nil
+		},
+		log: ctrl.Log.WithName("route-auditor"),
+	}
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, routeaudit.StatusPath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Error("report should not be available before audit", rec.Code)
+	}
+
+	if err := a.audit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, routeaudit.StatusPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status:", rec.Code, rec.Body.String())
+	}
+	report := &routeaudit.Report{}
+	if err := json.Unmarshal(rec.Body.Bytes(), report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Nodes) != 1 || report.Nodes[0].Node != "node1" || len(report.Nodes[0].Missing) != 1 || report.Nodes[0].Missing[0] != "10.2.0.0/31" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
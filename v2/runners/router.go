@@ -12,6 +12,7 @@ import (
 	"github.com/cybozu-go/coil/v2/pkg/nodenet"
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vishvananda/netlink"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -57,6 +58,8 @@ func NewRouter(mgr manager.Manager, log logr.Logger, nodeName string, notifyCh <
 		notifyCh:  notifyCh,
 		syncer:    syncer,
 		interval:  interval,
+
+		interfaceAddrs: nodenet.InterfaceAddresses,
 	}
 }
 
@@ -68,9 +71,14 @@ type router struct {
 	notifyCh  <-chan struct{}
 	syncer    nodenet.RouteSyncer
 	interval  time.Duration
+
+	// interfaceAddrs returns the addresses of a network interface of this node
+	// for the src hint of block routes.
+	interfaceAddrs func(name string) (net.IP, net.IP, error)
 }
 
 // +kubebuilder:rbac:groups=coil.cybozu.com,resources=addressblocks,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coil.cybozu.com,resources=addresspools,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=list
 
 var _ manager.LeaderElectionRunnable = &router{}
@@ -135,12 +143,56 @@ func (r *router) sync(ctx context.Context) error {
 		nodeMap[n.Name] = nodeIP{IPv4: ipv4, IPv6: ipv6}
 	}
 
+	pools := &coilv2.AddressPoolList{}
+	if err := r.Client.List(ctx, pools); err != nil {
+		return fmt.Errorf("failed to list AddressPools: %w", err)
+	}
+	ifAddrs := make(map[string]nodeIP)
+	srcMap := make(map[string]nodeIP)
+	scopeMap := make(map[string]netlink.Scope)
+	for _, p := range pools.Items {
+		conf := p.Spec.BlockRoutes
+		if conf == nil {
+			continue
+		}
+		if conf.Scope == coilv2.RouteScopeSite {
+			scopeMap[p.Name] = netlink.SCOPE_SITE
+		}
+		if conf.SourceInterface == "" {
+			continue
+		}
+		addrs, ok := ifAddrs[conf.SourceInterface]
+		if !ok {
+			ipv4, ipv6, err := r.interfaceAddrs(conf.SourceInterface)
+			if err != nil {
+				r.log.Error(err, "failed to get source addresses", "pool", p.Name, "interface", conf.SourceInterface)
+			}
+			addrs = nodeIP{IPv4: ipv4, IPv6: ipv6}
+			ifAddrs[conf.SourceInterface] = addrs
+		}
+		srcMap[p.Name] = addrs
+	}
+
 	blocks := &coilv2.AddressBlockList{}
 	if err := r.Client.List(ctx, blocks); err != nil {
 		return fmt.Errorf("failed to list AddressBlocks: %w", err)
 	}
 	nRoutes := 0
 	giMap := make(map[string]*nodenet.GatewayInfo)
+	addRoute := func(gw, src net.IP, scope netlink.Scope, n *net.IPNet) {
+		nRoutes++
+		key := fmt.Sprintf("%s %s %d", gw, src, scope)
+		if gi, ok := giMap[key]; ok {
+			gi.Networks = append(gi.Networks, n)
+			return
+		}
+		giMap[key] = &nodenet.GatewayInfo{
+			Gateway:  gw,
+			Networks: []*net.IPNet{n},
+			Src:      src,
+			Scope:    scope,
+		}
+	}
 	for _, b := range blocks.Items {
 		nodeName := b.Labels[constants.LabelNode]
 		nm, ok := nodeMap[nodeName]
@@ -148,45 +200,25 @@ func (r *router) sync(ctx context.Context) error {
 			// node might be deleted
 			continue
 		}
+		poolName := b.Labels[constants.LabelPool]
+		src := srcMap[poolName]
+		scope := scopeMap[poolName]
 
 		if b.IPv4 != nil {
 			_, n, _ := net.ParseCIDR(*b.IPv4)
-			gw := nm.IPv4
-			if gw == nil {
-				r.log.Info("node has no IPv4 address", "node", nodeName)
-				goto IPv6
-			}
-
-			nRoutes++
-			gwStr := gw.String()
-			if gi, ok := giMap[gwStr]; ok {
-				gi.Networks = append(gi.Networks, n)
+			if gw := nm.IPv4; gw != nil {
+				addRoute(gw, src.IPv4, scope, n)
 			} else {
-				giMap[gwStr] = &nodenet.GatewayInfo{
-					Gateway:  gw,
-					Networks: []*net.IPNet{n},
-				}
+				r.log.Info("node has no IPv4 address", "node", nodeName)
 			}
 		}
 
-	IPv6:
 		if b.IPv6 != nil {
 			_, n, _ := net.ParseCIDR(*b.IPv6)
-			gw := nm.IPv6
-			if gw == nil {
-				r.log.Info("node has no IPv6 address", "node", nodeName)
-				continue
-			}
-
-			nRoutes++
-			gwStr := gw.String()
-			if gi, ok := giMap[gwStr]; ok {
-				gi.Networks = append(gi.Networks, n)
+			if gw := nm.IPv6; gw != nil {
+				addRoute(gw, src.IPv6, scope, n)
 			} else {
-				giMap[gwStr] = &nodenet.GatewayInfo{
-					Gateway:  gw,
-					Networks: []*net.IPNet{n},
-				}
+				r.log.Info("node has no IPv6 address", "node", nodeName)
 			}
 		}
 	}
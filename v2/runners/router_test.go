@@ -2,9 +2,11 @@ package runners
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"testing"
 	"time"
 
 	coilv2 "github.com/cybozu-go/coil/v2/api/v2"
@@ -14,7 +16,13 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/prometheus/common/expfmt"
+	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 type fakeSyncer struct {
@@ -190,3 +198,100 @@ var _ = Describe("Router", func() {
 		Expect(metric.GetGauge().GetValue()).To(BeNumerically("==", 6))
 	})
 })
+
+type recordingSyncer struct {
+	gis []nodenet.GatewayInfo
+}
+
+func (s *recordingSyncer) Sync(gis []nodenet.GatewayInfo) error {
+	s.gis = gis
+	return nil
+}
+
+func TestRouterBlockRoutes(t *testing.T) {
+	t.Parallel()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := coilv2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	node := &corev1.Node{}
+	node.Name = "node2"
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "10.20.30.42"},
+		{Type: corev1.NodeInternalIP, Address: "fd10::42"},
+	}
+	storage := &coilv2.AddressPool{}
+	storage.Name = "storage"
+	storage.Spec.BlockRoutes = &coilv2.BlockRouteConfig{Scope: coilv2.RouteScopeSite, SourceInterface: "eth1"}
+	missing := &coilv2.AddressPool{}
+	missing.Name = "missing"
+	missing.Spec.BlockRoutes = &coilv2.BlockRouteConfig{SourceInterface: "eth9"}
+	var objs []client.Object
+	objs = append(objs, node, storage, missing)
+	for _, b := range []struct {
+		name, pool, ipv4, ipv6 string
+	}{
+		{"default-0", "default", "10.30.0.0/24", "fd02::/120"},
+		{"storage-0", "storage", "10.40.0.0/24", "fd04::/120"},
+		{"missing-0", "missing", "10.50.0.0/24", ""},
+	} {
+		block := &coilv2.AddressBlock{}
+		block.Name = b.name
+		block.Labels = map[string]string{constants.LabelNode: "node2", constants.LabelPool: b.pool}
+		block.IPv4 = strPtr(b.ipv4)
+		if b.ipv6 != "" {
+			block.IPv6 = strPtr(b.ipv6)
+		}
+		objs = append(objs, block)
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+
+	initMetrics("node1")
+	syncer := &recordingSyncer{}
+	r := &router{
+		Client:    cl,
+		apiReader: cl,
+		log:       ctrl.Log.WithName("router"),
+		nodeName:  "node1",
+		syncer:    syncer,
+		interfaceAddrs: func(name string) (net.IP, net.IP, error) {
+			if name != "eth1" {
+				return nil, nil, errors.New("not found")
+			}
+			return net.ParseIP("192.168.10.1"), nil, nil
+		},
+	}
+	if err := r.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type route struct {
+		src   string
+		scope netlink.Scope
+	}
+	routes := make(map[string]route)
+	for _, gi := range syncer.gis {
+		for _, n := range gi.Networks {
+			var src string
+			if gi.Src != nil {
+				src = gi.Src.String()
+			}
+			routes[n.String()] = route{src: src, scope: gi.Scope}
+		}
+	}
+	expected := map[string]route{
+		"10.30.0.0/24": {},
+		"fd02::/120":   {},
+		"10.40.0.0/24": {src: "192.168.10.1", scope: netlink.SCOPE_SITE},
+		"fd04::/120":   {scope: netlink.SCOPE_SITE},
+		"10.50.0.0/24": {},
+	}
+	if !cmp.Equal(routes, expected, cmp.AllowUnexported(route{})) {
+		t.Error("unexpected routes:", cmp.Diff(routes, expected, cmp.AllowUnexported(route{})))
+	}
+}
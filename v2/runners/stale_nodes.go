@@ -0,0 +1,188 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	staleNodes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "stale_nodes",
+			Help:      "the number of nodes where coild has not sent heartbeats",
+		},
+	)
+	heartbeatAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: constants.MetricsNS,
+			Subsystem: "controller",
+			Name:      "coild_heartbeat_age_seconds",
+			Help:      "the elapsed time since the last heartbeat of coild",
+		},
+		[]string{"node"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(staleNodes, heartbeatAge)
+}
+
+// Reasons of events recorded for nodes.
+const (
+	EventCoildStale     = "CoildStale"
+	EventCoildRecovered = "CoildRecovered"
+)
+
+// listHeartbeats returns the last heartbeat time of coild for each node.
+func listHeartbeats(ctx context.Context, r client.Reader, namespace string) (map[string]time.Time, error) {
+	leases := &coordinationv1.LeaseList{}
+	err := r.List(ctx, leases,
+		client.InNamespace(namespace),
+		client.MatchingLabels{constants.LabelAppComponent: "coild"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list leases: %w", err)
+	}
+
+	renewed := make(map[string]time.Time)
+	for _, l := range leases.Items {
+		node := l.Labels[constants.LabelNode]
+		if node == "" || l.Spec.RenewTime == nil {
+			continue
+		}
+		renewed[node] = l.Spec.RenewTime.Time
+	}
+	return renewed, nil
+}
+
+// StaleNodeDetector detects nodes whose coild has not renewed its heartbeat
+// Lease created by NewHeartbeat for a while.
+type StaleNodeDetector interface {
+	manager.Runnable
+
+	// IsStale returns true if coild on `node` was stale at the last check.
+	IsStale(node string) bool
+}
+
+// NewStaleNodeDetector creates a StaleNodeDetector that reads heartbeat Leases
+// in `namespace` every `interval`.  A node is stale if its Lease has not been
+// renewed longer than `threshold`.
+//
+// Nodes without Leases are not considered stale so that upgrading from
+// versions without heartbeats does not flag all nodes.
+func NewStaleNodeDetector(r client.Reader, recorder record.EventRecorder, namespace string, threshold, interval time.Duration, log logr.Logger) StaleNodeDetector {
+	return &staleNodeDetector{
+		reader:    r,
+		recorder:  recorder,
+		namespace: namespace,
+		threshold: threshold,
+		interval:  interval,
+		log:       log,
+		stale:     make(map[string]bool),
+	}
+}
+
+type staleNodeDetector struct {
+	reader    client.Reader
+	recorder  record.EventRecorder
+	namespace string
+	threshold time.Duration
+	interval  time.Duration
+	log       logr.Logger
+
+	mu    sync.Mutex
+	stale map[string]bool
+}
+
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=list
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=list
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+var _ manager.LeaderElectionRunnable = &staleNodeDetector{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*staleNodeDetector) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (d *staleNodeDetector) Start(ctx context.Context) error {
+	tick := time.NewTicker(d.interval)
+	defer tick.Stop()
+
+	for {
+		if err := d.check(ctx, time.Now()); err != nil {
+			d.log.Error(err, "failed to check heartbeats of coild")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (d *staleNodeDetector) IsStale(node string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stale[node]
+}
+
+func (d *staleNodeDetector) check(ctx context.Context, now time.Time) error {
+	nodes := &corev1.NodeList{}
+	if err := d.reader.List(ctx, nodes); err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	renewed, err := listHeartbeats(ctx, d.reader, d.namespace)
+	if err != nil {
+		return err
+	}
+
+	stale := make(map[string]bool)
+	heartbeatAge.Reset()
+	for i := range nodes.Items {
+		n := &nodes.Items[i]
+		t, ok := renewed[n.Name]
+		if !ok {
+			continue
+		}
+		age := now.Sub(t)
+		heartbeatAge.WithLabelValues(n.Name).Set(age.Seconds())
+		if age <= d.threshold {
+			if d.IsStale(n.Name) {
+				d.log.Info("coild has recovered", "node", n.Name)
+				d.recorder.Event(n, corev1.EventTypeNormal, EventCoildRecovered, "coild has resumed heartbeats")
+			}
+			continue
+		}
+
+		stale[n.Name] = true
+		if !d.IsStale(n.Name) {
+			d.log.Info("coild has not sent heartbeats", "node", n.Name, "last_heartbeat", t)
+			d.recorder.Eventf(n, corev1.EventTypeWarning, EventCoildStale,
+				"coild has not sent heartbeats since %s", t.UTC().Format(time.RFC3339))
+		}
+	}
+	staleNodes.Set(float64(len(stale)))
+
+	d.mu.Lock()
+	d.stale = stale
+	d.mu.Unlock()
+	return nil
+}
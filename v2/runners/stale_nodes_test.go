@@ -0,0 +1,123 @@
+package runners
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	hb := NewHeartbeat(cl, "kube-system", "node1", time.Minute, ctrl.Log.WithName("heartbeat")).(*heartbeat)
+
+	ctx := context.Background()
+	if err := hb.beat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lease := &coordinationv1.Lease{}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "coild-node1"}, lease); err != nil {
+		t.Fatal(err)
+	}
+	if lease.Labels[constants.LabelNode] != "node1" || lease.Labels[constants.LabelAppComponent] != "coild" {
+		t.Error("unexpected labels:", lease.Labels)
+	}
+	if lease.Spec.LeaseDurationSeconds == nil || *lease.Spec.LeaseDurationSeconds != 60 {
+		t.Error("unexpected lease duration:", lease.Spec.LeaseDurationSeconds)
+	}
+	first := lease.Spec.RenewTime.Time
+
+	time.Sleep(10 * time.Millisecond)
+	if err := hb.beat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "coild-node1"}, lease); err != nil {
+		t.Fatal(err)
+	}
+	if !lease.Spec.RenewTime.After(first) {
+		t.Error("the lease should be renewed")
+	}
+}
+
+func testLease(node string, renewed time.Time) *coordinationv1.Lease {
+	l := &coordinationv1.Lease{}
+	l.Namespace = "kube-system"
+	l.Name = HeartbeatLeaseName(node)
+	l.Labels = map[string]string{
+		constants.LabelAppComponent: "coild",
+		constants.LabelNode:         node,
+	}
+	t := metav1.NewMicroTime(renewed)
+	l.Spec.RenewTime = &t
+	return l
+}
+
+func TestStaleNodeDetector(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	objs := []client.Object{
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node3"}},
+		testLease("node1", now.Add(-time.Minute)),
+		testLease("node2", now.Add(-10*time.Minute)),
+		// node3 has no lease; node4 has been deleted.
+		testLease("node4", now.Add(-time.Hour)),
+	}
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objs...).Build()
+	recorder := record.NewFakeRecorder(10)
+	d := NewStaleNodeDetector(cl, recorder, "kube-system", 5*time.Minute, time.Minute, ctrl.Log.WithName("stale-nodes")).(*staleNodeDetector)
+
+	ctx := context.Background()
+	if err := d.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	for node, expected := range map[string]bool{"node1": false, "node2": true, "node3": false, "node4": false} {
+		if d.IsStale(node) != expected {
+			t.Errorf("IsStale(%s) should be %v", node, expected)
+		}
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, EventCoildStale) {
+		t.Error("unexpected event:", ev)
+	}
+
+	// no duplicate events
+	if err := d.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Error("events should not be recorded again:", <-recorder.Events)
+	}
+
+	lease := &coordinationv1.Lease{}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "coild-node2"}, lease); err != nil {
+		t.Fatal(err)
+	}
+	renewed := metav1.NewMicroTime(now)
+	lease.Spec.RenewTime = &renewed
+	if err := cl.Update(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.check(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if d.IsStale("node2") {
+		t.Error("node2 should be recovered")
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, EventCoildRecovered) {
+		t.Error("unexpected event:", ev)
+	}
+}
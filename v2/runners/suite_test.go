@@ -117,6 +117,14 @@ var _ = BeforeSuite(func() {
 	err = k8sClient.Create(ctx, ns2)
 	Expect(err).ToNot(HaveOccurred())
 
+	ns3 := &corev1.Namespace{}
+	ns3.Name = "ns3"
+	ns3.Annotations = map[string]string{
+		"coil.cybozu.com/pool-selector": "tier=routable",
+	}
+	err = k8sClient.Create(ctx, ns3)
+	Expect(err).ToNot(HaveOccurred())
+
 })
 
 var _ = AfterSuite(func() {
@@ -157,3 +165,7 @@ OUTER:
 	}
 	return nil
 }
+
+func strPtr(s string) *string {
+	return &s
+}
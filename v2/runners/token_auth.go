@@ -0,0 +1,132 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/cnirpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	authv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// authorizationKey is the gRPC metadata key to pass a bearer token.
+const authorizationKey = "authorization"
+
+// tokenCacheTTL is the duration to cache the result of a TokenReview.
+const tokenCacheTTL = 1 * time.Minute
+
+// ErrUnauthorized is returned from TokenVerifier when a token is rejected.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// TokenVerifier verifies bearer tokens presented to coild API.
+type TokenVerifier interface {
+	// Verify returns nil if `token` is valid and belongs to an allowed user.
+	// If the token is rejected, the returned error wraps ErrUnauthorized.
+	Verify(ctx context.Context, token string) error
+}
+
+// NewTokenVerifier creates a TokenVerifier that verifies tokens with TokenReview.
+//
+// Only tokens of `users` are accepted.  Users are specified by their
+// names such as "system:serviceaccount:kube-system:coil-cni".
+// If `audiences` are not empty, tokens must be issued for one of them.
+func NewTokenVerifier(cl client.Client, users, audiences []string) TokenVerifier {
+	allowed := make(map[string]bool)
+	for _, u := range users {
+		allowed[u] = true
+	}
+
+	return &tokenVerifier{
+		review: func(ctx context.Context, token string) (*authv1.TokenReviewStatus, error) {
+			tr := &authv1.TokenReview{
+				Spec: authv1.TokenReviewSpec{
+					Token:     token,
+					Audiences: audiences,
+				},
+			}
+			if err := cl.Create(ctx, tr); err != nil {
+				return nil, err
+			}
+			return &tr.Status, nil
+		},
+		allowed: allowed,
+		cache:   make(map[string]time.Time),
+	}
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+type tokenVerifier struct {
+	review  func(ctx context.Context, token string) (*authv1.TokenReviewStatus, error)
+	allowed map[string]bool
+
+	mu    sync.Mutex
+	cache map[string]time.Time
+}
+
+func (v *tokenVerifier) Verify(ctx context.Context, token string) error {
+	now := time.Now()
+
+	v.mu.Lock()
+	expire, ok := v.cache[token]
+	v.mu.Unlock()
+	if ok && now.Before(expire) {
+		return nil
+	}
+
+	st, err := v.review(ctx, token)
+	if err != nil {
+		return fmt.Errorf("failed to review token: %w", err)
+	}
+	if !st.Authenticated {
+		return fmt.Errorf("%w: token is not authenticated: %s", ErrUnauthorized, st.Error)
+	}
+	if !v.allowed[st.User.Username] {
+		return fmt.Errorf("%w: user %s is not allowed", ErrUnauthorized, st.User.Username)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, exp := range v.cache {
+		if now.After(exp) {
+			delete(v.cache, k)
+		}
+	}
+	v.cache[token] = now.Add(tokenCacheTTL)
+	return nil
+}
+
+// tokenAuthInterceptor returns a gRPC interceptor that requires a bearer token
+// verified by `v` in the request metadata.
+func tokenAuthInterceptor(v TokenVerifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			for _, val := range md.Get(authorizationKey) {
+				if strings.HasPrefix(val, "Bearer ") {
+					token = strings.TrimPrefix(val, "Bearer ")
+					break
+				}
+			}
+		}
+		if token == "" {
+			return nil, newError(codes.Unauthenticated, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG, "missing bearer token", "")
+		}
+
+		err := v.Verify(ctx, token)
+		if errors.Is(err, ErrUnauthorized) {
+			return nil, newError(codes.PermissionDenied, cnirpc.ErrorCode_INVALID_NETWORK_CONFIG, "unauthorized", err.Error())
+		}
+		if err != nil {
+			return nil, newError(codes.Unavailable, cnirpc.ErrorCode_TRY_AGAIN_LATER, "failed to verify token", err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
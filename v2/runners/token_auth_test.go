@@ -0,0 +1,112 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func TestTokenAuth(t *testing.T) {
+	t.Run("verifier", testTokenVerifier)
+	t.Run("interceptor", testTokenAuthInterceptor)
+}
+
+func testTokenVerifier(t *testing.T) {
+	t.Parallel()
+
+	reviews := 0
+	v := &tokenVerifier{
+		review: func(ctx context.Context, token string) (*authv1.TokenReviewStatus, error) {
+			reviews++
+			switch token {
+			case "good":
+				return &authv1.TokenReviewStatus{Authenticated: true, User: authv1.UserInfo{Username: "cni"}}, nil
+			case "other":
+				return &authv1.TokenReviewStatus{Authenticated: true, User: authv1.UserInfo{Username: "someone"}}, nil
+			case "broken":
+				return nil, errors.New("apiserver is down")
+			}
+			return &authv1.TokenReviewStatus{Error: "invalid token"}, nil
+		},
+		allowed: map[string]bool{"cni": true},
+		cache:   make(map[string]time.Time),
+	}
+
+	ctx := context.Background()
+	if err := v.Verify(ctx, "good"); err != nil {
+		t.Error("good token should be accepted:", err)
+	}
+	if err := v.Verify(ctx, "good"); err != nil {
+		t.Error("good token should be accepted:", err)
+	}
+	if reviews != 1 {
+		t.Error("the result should be cached, but reviewed", reviews, "times")
+	}
+
+	for _, token := range []string{"other", "bad"} {
+		err := v.Verify(ctx, token)
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("token %s should be rejected: %v", token, err)
+		}
+	}
+
+	err := v.Verify(ctx, "broken")
+	if err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Error("review failure should not be reported as unauthorized:", err)
+	}
+}
+
+type mockVerifier struct{}
+
+func (mockVerifier) Verify(ctx context.Context, token string) error {
+	switch token {
+	case "good":
+		return nil
+	case "broken":
+		return errors.New("failed")
+	}
+	return ErrUnauthorized
+}
+
+func testTokenAuthInterceptor(t *testing.T) {
+	t.Parallel()
+
+	interceptor := tokenAuthInterceptor(mockVerifier{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	testCases := []struct {
+		name string
+		md   metadata.MD
+		code codes.Code
+	}{
+		{"no metadata", nil, codes.Unauthenticated},
+		{"no bearer", metadata.Pairs("authorization", "Basic foo"), codes.Unauthenticated},
+		{"good", metadata.Pairs("authorization", "Bearer good"), codes.OK},
+		{"bad", metadata.Pairs("authorization", "Bearer bad"), codes.PermissionDenied},
+		{"broken", metadata.Pairs("authorization", "Bearer broken"), codes.Unavailable},
+	}
+
+	for _, tc := range testCases {
+		ctx := context.Background()
+		if tc.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, tc.md)
+		}
+		resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("%s: unexpected code %v: %v", tc.name, code, err)
+			continue
+		}
+		if tc.code == codes.OK && resp != "ok" {
+			t.Errorf("%s: handler is not called", tc.name)
+		}
+	}
+}
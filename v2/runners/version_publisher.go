@@ -0,0 +1,134 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const versionPublishRetryInterval = 10 * time.Second
+
+// VersionPublisher records the versions of Coil components in annotations
+// of the Pod running this program.  The annotations are checked by the
+// version skew checker of coil-controller and by `coilctl version --cluster`.
+type VersionPublisher interface {
+	manager.Runnable
+
+	// SetCNIVersion records the version of the CNI plugin that called coild.
+	SetCNIVersion(v string)
+}
+
+// NewVersionPublisher creates a VersionPublisher for `pod`.
+//
+// If `apiVersions` is not empty, it is published as the range of the CNI API
+// versions supported by this program.
+func NewVersionPublisher(c client.Client, pod client.ObjectKey, apiVersions string, log logr.Logger) VersionPublisher {
+	return &versionPublisher{
+		client:      c,
+		pod:         pod,
+		apiVersions: apiVersions,
+		log:         log,
+		notifyCh:    make(chan struct{}, 1),
+	}
+}
+
+type versionPublisher struct {
+	client      client.Client
+	pod         client.ObjectKey
+	apiVersions string
+	log         logr.Logger
+	notifyCh    chan struct{}
+
+	mu         sync.Mutex
+	cniVersion string
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=patch
+
+var _ manager.LeaderElectionRunnable = &versionPublisher{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*versionPublisher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (p *versionPublisher) Start(ctx context.Context) error {
+	published := false
+	var publishedCNI string
+	for {
+		var retryCh <-chan time.Time
+		cniVersion := p.getCNIVersion()
+		if !published || cniVersion != publishedCNI {
+			if err := p.publish(ctx, cniVersion); err != nil {
+				p.log.Error(err, "failed to publish versions", "pod", p.pod)
+				retryCh = time.After(versionPublishRetryInterval)
+			} else {
+				published = true
+				publishedCNI = cniVersion
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.notifyCh:
+		case <-retryCh:
+		}
+	}
+}
+
+func (p *versionPublisher) getCNIVersion() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cniVersion
+}
+
+func (p *versionPublisher) SetCNIVersion(v string) {
+	p.mu.Lock()
+	changed := p.cniVersion != v
+	p.cniVersion = v
+	p.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	select {
+	case p.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (p *versionPublisher) publish(ctx context.Context, cniVersion string) error {
+	anns := map[string]string{
+		constants.AnnVersion: v2.Version(),
+	}
+	if p.apiVersions != "" {
+		anns[constants.AnnAPIVersions] = p.apiVersions
+	}
+	if cniVersion != "" {
+		anns[constants.AnnCNIVersion] = cniVersion
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": anns,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	pod := &corev1.Pod{}
+	pod.Namespace = p.pod.Namespace
+	pod.Name = p.pod.Name
+	return p.client.Patch(ctx, pod, client.RawPatch(types.MergePatchType, data))
+}
@@ -0,0 +1,167 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	v2 "github.com/cybozu-go/coil/v2"
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var componentVersions = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "controller",
+		Name:      "component_versions",
+		Help:      "the number of Coil components by version and compatibility with the controller",
+	},
+	[]string{"component", "version", "compatible"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(componentVersions)
+}
+
+// componentVersion is the version of a Coil component published by VersionPublisher.
+type componentVersion struct {
+	component string
+	pod       types.NamespacedName
+	node      string
+	version   string
+}
+
+// podComponentVersions returns the versions published in the annotations of `pod`.
+// The CNI plugin reported by coild is returned as the component "coil".
+func podComponentVersions(pod *corev1.Pod) []componentVersion {
+	v, ok := pod.Annotations[constants.AnnVersion]
+	if !ok {
+		return nil
+	}
+	key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+	vers := []componentVersion{{
+		component: pod.Labels[constants.LabelAppComponent],
+		pod:       key,
+		node:      pod.Spec.NodeName,
+		version:   v,
+	}}
+	if cni, ok := pod.Annotations[constants.AnnCNIVersion]; ok {
+		vers = append(vers, componentVersion{
+			component: "coil",
+			pod:       key,
+			node:      pod.Spec.NodeName,
+			version:   cni,
+		})
+	}
+	return vers
+}
+
+// NewVersionSkewChecker creates a manager.Runnable to check the versions of
+// Coil components running in `namespace` every `interval`.
+//
+// Components whose versions are incompatible with this controller are logged
+// and exported as metrics.
+func NewVersionSkewChecker(mgr manager.Manager, namespace string, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &versionSkewChecker{
+		apiReader: mgr.GetAPIReader(),
+		namespace: namespace,
+		interval:  interval,
+		log:       log,
+		reported:  make(map[string]string),
+	}
+}
+
+type versionSkewChecker struct {
+	apiReader client.Reader
+	namespace string
+	interval  time.Duration
+	log       logr.Logger
+
+	// reported keeps the incompatible versions already logged to avoid flooding logs.
+	reported map[string]string
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list
+
+var _ manager.LeaderElectionRunnable = &versionSkewChecker{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*versionSkewChecker) NeedLeaderElection() bool {
+	return true
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (c *versionSkewChecker) Start(ctx context.Context) error {
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+
+	for {
+		if err := c.check(ctx); err != nil {
+			c.log.Error(err, "failed to check versions of Coil components")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (c *versionSkewChecker) check(ctx context.Context) error {
+	pods := &corev1.PodList{}
+	err := c.apiReader.List(ctx, pods,
+		client.InNamespace(c.namespace),
+		client.MatchingLabels{constants.LabelAppName: "coil"},
+	)
+	if err != nil {
+		return err
+	}
+
+	type gaugeKey struct {
+		component  string
+		version    string
+		compatible bool
+	}
+	counts := make(map[gaugeKey]float64)
+	reported := make(map[string]string)
+	for i := range pods.Items {
+		for _, cv := range podComponentVersions(&pods.Items[i]) {
+			compatible := v2.IsCompatible(cv.version)
+			counts[gaugeKey{cv.component, cv.version, compatible}]++
+			if compatible {
+				continue
+			}
+
+			id := cv.pod.String() + "/" + cv.component
+			reported[id] = cv.version
+			if c.reported[id] == cv.version {
+				continue
+			}
+			c.log.Info("found an incompatible version of Coil component",
+				"component", cv.component,
+				"pod", cv.pod.String(),
+				"node", cv.node,
+				"version", cv.version,
+				"controller_version", v2.Version(),
+			)
+		}
+	}
+	c.reported = reported
+
+	componentVersions.Reset()
+	for k, n := range counts {
+		compatible := "false"
+		if k.compatible {
+			compatible = "true"
+		}
+		componentVersions.WithLabelValues(k.component, k.version, compatible).Set(n)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/constants"
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var staleVethsDeleted = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: constants.MetricsNS,
+		Subsystem: "coild",
+		Name:      "stale_veths_deleted_total",
+		Help:      "the number of host-side veths deleted because their containers were gone",
+	},
+	[]string{"pool"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(staleVethsDeleted)
+}
+
+// NewVethJanitor creates a manager.Runnable to delete host-side veths left
+// behind by crashes.
+//
+// Every `interval`, the janitor looks for veths listed by nodenet.ListStaleVeths
+// whose addresses are no longer allocated in `nodeIPAM`, and destroys them
+// with `podNet` if they are still found in the next round.  Waiting for a
+// round keeps the janitor away from the containers being set up.
+// Nothing is deleted while `readOnly` is enabled, if not nil.
+func NewVethJanitor(nodeIPAM ipam.NodeIPAM, podNet nodenet.PodNetwork, readOnly ReadOnlyMode, interval time.Duration, log logr.Logger) manager.Runnable {
+	return &vethJanitor{
+		nodeIPAM:  nodeIPAM,
+		podNet:    podNet,
+		readOnly:  readOnly,
+		interval:  interval,
+		log:       log,
+		listStale: nodenet.ListStaleVeths,
+		suspects:  make(map[nodenet.StaleVeth]bool),
+	}
+}
+
+type vethJanitor struct {
+	nodeIPAM  ipam.NodeIPAM
+	podNet    nodenet.PodNetwork
+	readOnly  ReadOnlyMode
+	interval  time.Duration
+	log       logr.Logger
+	listStale func() ([]nodenet.StaleVeth, error)
+
+	// suspects are the stale veths found in the last round.
+	suspects map[nodenet.StaleVeth]bool
+}
+
+var _ manager.LeaderElectionRunnable = &vethJanitor{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (*vethJanitor) NeedLeaderElection() bool {
+	return false
+}
+
+// Start starts this runner.  This implements manager.Runnable
+func (j *vethJanitor) Start(ctx context.Context) error {
+	tick := time.NewTicker(j.interval)
+	defer tick.Stop()
+
+	for {
+		j.sweep()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (j *vethJanitor) sweep() {
+	if j.readOnly != nil && j.readOnly.Enabled() {
+		return
+	}
+
+	stale, err := j.listStale()
+	if err != nil {
+		j.log.Error(err, "failed to list stale veths")
+		return
+	}
+
+	suspects := make(map[nodenet.StaleVeth]bool)
+	for _, v := range stale {
+		if _, _, ok := j.nodeIPAM.Lookup(v.ContainerId, v.IFace); ok {
+			continue
+		}
+		if !j.suspects[v] {
+			suspects[v] = true
+			continue
+		}
+
+		// failed veths are retried in the next round.
+		if err := j.podNet.Destroy(v.ContainerId, v.IFace); err != nil {
+			j.log.Error(err, "failed to delete stale veth", "veth", v.Name, "container", v.ContainerId, "ifname", v.IFace)
+			suspects[v] = true
+			continue
+		}
+		staleVethsDeleted.WithLabelValues(v.PoolName).Inc()
+		j.log.Info("deleted stale veth", "veth", v.Name, "pool", v.PoolName, "container", v.ContainerId, "ifname", v.IFace)
+	}
+	j.suspects = suspects
+}
@@ -0,0 +1,77 @@
+package runners
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/coil/v2/pkg/ipam"
+	"github.com/cybozu-go/coil/v2/pkg/nodenet"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type lookupIPAM struct {
+	ipam.NodeIPAM
+	allocated map[string]bool
+}
+
+func (n *lookupIPAM) Lookup(containerID, iface string) (net.IP, net.IP, bool) {
+	if n.allocated[containerID+"/"+iface] {
+		return net.ParseIP("10.1.0.1"), nil, true
+	}
+	return nil, nil, false
+}
+
+func TestVethJanitor(t *testing.T) {
+	t.Parallel()
+
+	stale := []nodenet.StaleVeth{
+		{Name: "veth1", PoolName: "janitor", ContainerId: "c1", IFace: "eth0"},
+		{Name: "veth2", PoolName: "janitor", ContainerId: "c2", IFace: "eth0"},
+	}
+	nodeIPAM := &lookupIPAM{allocated: map[string]bool{"c2/eth0": true}}
+	podNet := &mockPodNetwork{}
+	readOnly := NewReadOnlyMode(false, ctrl.Log.WithName("read-only"))
+	j := NewVethJanitor(nodeIPAM, podNet, readOnly, time.Minute, ctrl.Log.WithName("veth-janitor")).(*vethJanitor)
+	j.listStale = func() ([]nodenet.StaleVeth, error) { return stale, nil }
+
+	j.sweep()
+	if podNet.nDestroy != 0 {
+		t.Error("veths should not be deleted in the first round")
+	}
+
+	readOnly.Set(true)
+	j.sweep()
+	if podNet.nDestroy != 0 {
+		t.Error("veths should not be deleted in read-only mode")
+	}
+	readOnly.Set(false)
+
+	podNet.errDestroy = true
+	j.sweep()
+	if podNet.nDestroy != 1 {
+		t.Error("only the veth without allocation should be deleted:", podNet.nDestroy)
+	}
+	if v := testutil.ToFloat64(staleVethsDeleted.WithLabelValues("janitor")); v != 0 {
+		t.Error("failed deletion should not be counted:", v)
+	}
+
+	podNet.errDestroy = false
+	j.sweep()
+	if podNet.nDestroy != 2 {
+		t.Error("failed deletion should be retried:", podNet.nDestroy)
+	}
+	if v := testutil.ToFloat64(staleVethsDeleted.WithLabelValues("janitor")); v != 1 {
+		t.Error("deletion should be counted:", v)
+	}
+
+	// a veth recovered before the second round is not deleted.
+	stale = []nodenet.StaleVeth{{Name: "veth3", PoolName: "janitor", ContainerId: "c3", IFace: "eth0"}}
+	j.sweep()
+	stale = nil
+	j.sweep()
+	if podNet.nDestroy != 2 {
+		t.Error("recovered veth should not be deleted:", podNet.nDestroy)
+	}
+}
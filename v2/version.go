@@ -2,6 +2,7 @@ package v2
 
 import (
 	"runtime/debug"
+	"strconv"
 	"strings"
 )
 
@@ -21,3 +22,45 @@ func Version() string {
 
 	return version
 }
+
+// IsCompatible returns true if a component of Coil version `v` is supported
+// to run together with this version.
+func IsCompatible(v string) bool {
+	return Compatible(v, Version())
+}
+
+// Compatible returns true if components of Coil version `a` and `b` are
+// supported to run together.
+//
+// Components of the same major version are compatible if their minor versions
+// differ by at most one.  This allows upgrading components one by one.
+func Compatible(a, b string) bool {
+	majorA, minorA, ok := parseVersion(a)
+	if !ok {
+		return false
+	}
+	majorB, minorB, ok := parseVersion(b)
+	if !ok {
+		return false
+	}
+	if majorA != majorB {
+		return false
+	}
+	return minorA-minorB <= 1 && minorB-minorA <= 1
+}
+
+func parseVersion(v string) (major, minor int, ok bool) {
+	fields := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
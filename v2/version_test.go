@@ -0,0 +1,51 @@
+package v2
+
+import "testing"
+
+func TestIsCompatible(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		version    string
+		compatible bool
+	}{
+		{Version(), true},
+		{"2.0.0", true},
+		{"v2.0.1", true},
+		{"2.1.0", true},
+		{"2.2.0", false},
+		{"1.0.14", false},
+		{"3.0.0", false},
+		{"2", false},
+		{"(devel)", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		if c := IsCompatible(tc.version); c != tc.compatible {
+			t.Errorf("IsCompatible(%q) = %v, want %v", tc.version, c, tc.compatible)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		a, b       string
+		compatible bool
+	}{
+		{"2.0.14", "2.0.1", true},
+		{"2.1.0", "2.0.14", true},
+		{"2.0.14", "2.1.0", true},
+		{"2.3.0", "2.1.0", false},
+		{"2.0.0", "1.9.0", false},
+		{"2.0.0", "invalid", false},
+	}
+
+	for _, tc := range testCases {
+		if c := Compatible(tc.a, tc.b); c != tc.compatible {
+			t.Errorf("Compatible(%q, %q) = %v, want %v", tc.a, tc.b, c, tc.compatible)
+		}
+	}
+}